@@ -0,0 +1,175 @@
+// Package absint provides a framework for abstract interpretation of SSA
+// functions, where the abstract domain is a plug-in.
+//
+// A Domain defines the abstract states of the analysis, with the transfer
+// function of each instruction, and the join and widening of states. Analyse
+// computes the states at the start and end of each block of a function by
+// iterating the transfer functions to a fixpoint, widening the states of
+// blocks visited too many times (i.e. loop heads) to ensure termination.
+//
+// The package provides domains tracking channels (Chans), locks held
+// (Locks), tainted values (Taint) and ranges of integers (Intervals). Domains are intraprocedural; calls are
+// handled by the transfer functions of the domain, e.g. by a summary of the
+// callee.
+package absint
+
+import (
+	"github.com/nickng/gospal/metrics"
+	"golang.org/x/tools/go/ssa"
+)
+
+// State is an abstract state of a domain. States are immutable: transfer,
+// join and widening return a new state instead of modifying their arguments.
+type State interface{}
+
+// Domain is an abstract domain.
+type Domain interface {
+	// Bottom returns the least state, i.e. of unreachable code.
+	Bottom() State
+
+	// Entry returns the state at the entry of fn.
+	Entry(fn *ssa.Function) State
+
+	// Transfer returns the state after instr, given the state s before.
+	Transfer(instr ssa.Instruction, s State) State
+
+	// Join returns the least upper bound of a and b.
+	Join(a, b State) State
+
+	// Widen returns an upper bound of prev and next which ensures the
+	// termination of the iteration (for domains of infinite height). Domains
+	// of finite height can return Join(prev, next).
+	Widen(prev, next State) State
+
+	// Leq returns true if a is less than or equal to b.
+	Leq(a, b State) bool
+}
+
+// EdgeDomain is a Domain with transfer functions for the edges of the control
+// flow graph, e.g. for refining states by branch conditions.
+type EdgeDomain interface {
+	Domain
+
+	// Edge returns the state at the start of block to, given the state s at
+	// the end of block from.
+	Edge(from, to *ssa.BasicBlock, s State) State
+}
+
+// WidenDelay is the number of times a loop head is updated before its state is
+// widened.
+var WidenDelay = 3
+
+// Result is the result of an analysis of a function.
+type Result struct {
+	Func *ssa.Function
+	In   map[*ssa.BasicBlock]State // States at the start of reachable blocks.
+	Out  map[*ssa.BasicBlock]State // States at the end of reachable blocks.
+
+	dom Domain
+}
+
+// Analyse returns the fixpoint of the states of fn in domain d.
+func Analyse(fn *ssa.Function, d Domain) *Result {
+	res := &Result{
+		Func: fn,
+		In:   make(map[*ssa.BasicBlock]State),
+		Out:  make(map[*ssa.BasicBlock]State),
+		dom:  d,
+	}
+	if len(fn.Blocks) == 0 {
+		return res
+	}
+	edge, _ := d.(EdgeDomain)
+	bottom := d.Bottom()
+	updates := make(map[*ssa.BasicBlock]int)
+	queued := make(map[*ssa.BasicBlock]bool)
+	entry := fn.Blocks[0]
+	res.In[entry] = d.Entry(fn)
+	queue := []*ssa.BasicBlock{entry}
+	queued[entry] = true
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		queued[b] = false
+		s := res.In[b]
+		for _, instr := range b.Instrs {
+			s = d.Transfer(instr, s)
+		}
+		res.Out[b] = s
+		for _, succ := range b.Succs {
+			out := s
+			if edge != nil {
+				out = edge.Edge(b, succ, s)
+			}
+			if d.Leq(out, bottom) {
+				continue // Infeasible edge.
+			}
+			next := out
+			if old, ok := res.In[succ]; ok {
+				next = d.Join(old, out)
+				if d.Leq(next, old) {
+					continue
+				}
+				// Widen at loop heads, so the states in the loop body keep
+				// the bounds refined by the loop condition. Other blocks
+				// are widened later, e.g. in loops entered by goto.
+				if updates[succ]++; updates[succ] > WidenDelay && succ.Dominates(b) || updates[succ] > 2*WidenDelay {
+					next = d.Widen(old, next)
+					metrics.Widenings.Inc()
+				}
+			}
+			res.In[succ] = next
+			if !queued[succ] {
+				queued[succ] = true
+				queue = append(queue, succ)
+			}
+		}
+	}
+	return res
+}
+
+// Reachable returns true if block b is reachable.
+func (r *Result) Reachable(b *ssa.BasicBlock) bool {
+	_, ok := r.In[b]
+	return ok
+}
+
+// Walk calls f with each instruction of the reachable blocks of the function
+// and the state before the instruction, in block order.
+func (r *Result) Walk(f func(instr ssa.Instruction, s State)) {
+	for _, b := range r.Func.Blocks {
+		s, ok := r.In[b]
+		if !ok {
+			continue
+		}
+		for _, instr := range b.Instrs {
+			f(instr, s)
+			s = r.dom.Transfer(instr, s)
+		}
+	}
+}
+
+// Before returns the state before instr, or the bottom state if instr is
+// unreachable.
+func (r *Result) Before(instr ssa.Instruction) State {
+	s, ok := r.In[instr.Block()]
+	if !ok {
+		return r.dom.Bottom()
+	}
+	for _, i := range instr.Block().Instrs {
+		if i == instr {
+			break
+		}
+		s = r.dom.Transfer(i, s)
+	}
+	return s
+}
+
+// After returns the state after instr, or the bottom state if instr is
+// unreachable.
+func (r *Result) After(instr ssa.Instruction) State {
+	if !r.Reachable(instr.Block()) {
+		return r.dom.Bottom()
+	}
+	return r.dom.Transfer(instr, r.Before(instr))
+}
@@ -0,0 +1,135 @@
+package absint
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/nickng/gospal/ssa/build"
+	"golang.org/x/tools/go/ssa"
+)
+
+func buildFunc(t *testing.T, name string) *ssa.Function {
+	info, err := build.FromFiles("testdata/absint.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	for _, pkg := range info.Prog.AllPackages() {
+		if pkg.Pkg.Name() == "main" {
+			if fn := pkg.Func(name); fn != nil {
+				return fn
+			}
+		}
+	}
+	t.Fatalf("Cannot find function %s", name)
+	return nil
+}
+
+// returnOf returns the return instruction of fn.
+func returnOf(fn *ssa.Function) *ssa.Return {
+	for _, b := range fn.Blocks {
+		if ret, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return); ok {
+			return ret
+		}
+	}
+	return nil
+}
+
+// Tests that locks held on every path are in the lockset, and locks released
+// are not.
+func TestLocks(t *testing.T) {
+	fn := buildFunc(t, "locked")
+	res := Analyse(fn, &Locks{Key: func(v ssa.Value) (string, bool) {
+		if g, ok := v.(*ssa.Global); ok {
+			return g.Name(), true
+		}
+		return "", false
+	}})
+	var unlocks []LockSet
+	res.Walk(func(instr ssa.Instruction, s State) {
+		if call, ok := instr.(*ssa.Call); ok {
+			if callee := call.Call.StaticCallee(); callee != nil && callee.Name() == "Unlock" {
+				unlocks = append(unlocks, s.(LockSet))
+			}
+		}
+	})
+	if expect, got := 2, len(unlocks); expect != got {
+		t.Fatalf("Unlocks mismatch:\nExpect:\t%d\nGot:\t%d\n", expect, got)
+	}
+	for _, locks := range unlocks {
+		if !locks["mu"] {
+			t.Errorf("Lock mismatch:\nExpect:\t{mu}\nGot:\t%v\n", locks)
+		}
+	}
+	if locks := res.Before(returnOf(fn)).(LockSet); len(locks) != 0 {
+		t.Errorf("Lock at return mismatch:\nExpect:\t{}\nGot:\t%v\n", locks)
+	}
+}
+
+// Tests that the channels of both branches flow to the return value.
+func TestChans(t *testing.T) {
+	fn := buildFunc(t, "chans")
+	res := Analyse(fn, Chans{})
+	ret := returnOf(fn)
+	s := res.Before(ret).(ChanState)
+	if expect, got := 2, len(s.Of(ret.Results[0])); expect != got {
+		t.Errorf("Channels returned mismatch:\nExpect:\t%d\nGot:\t%d (%v)\n", expect, got, s.Of(ret.Results[0]))
+	}
+}
+
+// Tests that a value derived from a source is tainted until sanitized.
+func TestTaint(t *testing.T) {
+	fn := buildFunc(t, "tainted")
+	dom := &Taint{
+		Source:    func(fn *ssa.Function) bool { return fn.String() == "os.Getenv" },
+		Sanitizer: func(fn *ssa.Function) bool { return fn.String() == "strings.TrimSpace" },
+	}
+	res := Analyse(fn, dom)
+	var upper, trim ssa.Value
+	res.Walk(func(instr ssa.Instruction, s State) {
+		if call, ok := instr.(*ssa.Call); ok {
+			switch call.Call.StaticCallee().String() {
+			case "strings.ToUpper":
+				upper = call
+			case "strings.TrimSpace":
+				trim = call
+			}
+		}
+	})
+	s := res.After(returnOf(fn)).(TaintSet)
+	if !s[upper] {
+		t.Errorf("Expecting strings.ToUpper result to be tainted")
+	}
+	if s[trim] {
+		t.Errorf("Expecting strings.TrimSpace result to be untainted")
+	}
+}
+
+// Tests the range of a computed buffer size, and of a loop index refined by
+// the loop condition.
+func TestIntervals(t *testing.T) {
+	fn := buildFunc(t, "workers")
+	res := Analyse(fn, Intervals{})
+	var size Interval
+	res.Walk(func(instr ssa.Instruction, s State) {
+		if mk, ok := instr.(*ssa.MakeChan); ok {
+			size = s.(IntervalState).Of(mk.Size)
+		}
+	})
+	if expect := (Interval{Lo: 2, Hi: PosInf}); size != expect {
+		t.Errorf("Buffer size range mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, size)
+	}
+
+	fn = buildFunc(t, "sum")
+	res = Analyse(fn, Intervals{})
+	var index Interval
+	res.Walk(func(instr ssa.Instruction, s State) {
+		if b, ok := instr.(*ssa.BinOp); ok && b.Op == token.ADD {
+			if c, ok := b.Y.(*ssa.Const); ok && c.Int64() == 1 {
+				index = s.(IntervalState).Of(b.X)
+			}
+		}
+	})
+	if expect := (Interval{Lo: 0, Hi: 9}); index != expect {
+		t.Errorf("Loop index range mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, index)
+	}
+}
@@ -0,0 +1,152 @@
+package absint
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// ChanSet is a set of channels, identified by their creation (make).
+type ChanSet map[*ssa.MakeChan]bool
+
+// ChanState maps values (and local variables) to the channels they may hold,
+// i.e. the state of the Chans domain. The nil ChanState is the bottom state.
+type ChanState map[ssa.Value]ChanSet
+
+// Of returns the channels v may hold in s.
+func (s ChanState) Of(v ssa.Value) ChanSet {
+	return s[v]
+}
+
+// with returns a copy of s where v may hold chans (in addition to the
+// channels held before if weak).
+func (s ChanState) with(v ssa.Value, chans ChanSet, weak bool) ChanState {
+	t := make(ChanState, len(s)+1)
+	for k, cs := range s {
+		t[k] = cs
+	}
+	set := make(ChanSet)
+	if weak {
+		for c := range s[v] {
+			set[c] = true
+		}
+	}
+	for c := range chans {
+		set[c] = true
+	}
+	t[v] = set
+	return t
+}
+
+// Chans is the domain of the channels each value may hold, i.e. a may
+// analysis of the flow of channels from their creation through registers and
+// variables. Channels flowing through struct fields, containers or calls are
+// not tracked.
+type Chans struct{}
+
+// Bottom returns the nil ChanState.
+func (Chans) Bottom() State { return ChanState(nil) }
+
+// Entry returns the state where no value holds a channel.
+func (Chans) Entry(fn *ssa.Function) State { return make(ChanState) }
+
+// Transfer records the channels held by the value defined (or the variable
+// stored to) by instr.
+func (Chans) Transfer(instr ssa.Instruction, s State) State {
+	cs := s.(ChanState)
+	if cs == nil {
+		return s
+	}
+	switch instr := instr.(type) {
+	case *ssa.MakeChan:
+		return cs.with(instr, ChanSet{instr: true}, false)
+	case *ssa.Phi:
+		set := make(ChanSet)
+		for _, e := range instr.Edges {
+			for c := range cs[e] {
+				set[c] = true
+			}
+		}
+		if len(set) > 0 {
+			return cs.with(instr, set, false)
+		}
+	case *ssa.ChangeType:
+		if set := cs[instr.X]; len(set) > 0 {
+			return cs.with(instr, set, false)
+		}
+	case *ssa.MakeInterface:
+		if set := cs[instr.X]; len(set) > 0 {
+			return cs.with(instr, set, false)
+		}
+	case *ssa.TypeAssert:
+		if set := cs[instr.X]; len(set) > 0 && !instr.CommaOk {
+			return cs.with(instr, set, false)
+		}
+	case *ssa.UnOp:
+		if instr.Op == token.MUL {
+			if set := cs[instr.X]; len(set) > 0 {
+				return cs.with(instr, set, false)
+			}
+		}
+	case *ssa.Store:
+		if set := cs[instr.Val]; len(set) > 0 || len(cs[instr.Addr]) > 0 {
+			// Strong update of local variables, weak update otherwise.
+			alloc, local := instr.Addr.(*ssa.Alloc)
+			return cs.with(instr.Addr, set, !local || alloc.Heap)
+		}
+	}
+	return s
+}
+
+// Join returns the union of the channels held in a and b.
+func (Chans) Join(a, b State) State {
+	ca, cb := a.(ChanState), b.(ChanState)
+	switch {
+	case ca == nil:
+		return cb
+	case cb == nil:
+		return ca
+	}
+	s := make(ChanState, len(ca))
+	for v, set := range ca {
+		s[v] = set
+	}
+	for v, set := range cb {
+		if len(s[v]) == 0 {
+			s[v] = set
+			continue
+		}
+		union := make(ChanSet, len(s[v])+len(set))
+		for c := range s[v] {
+			union[c] = true
+		}
+		for c := range set {
+			union[c] = true
+		}
+		s[v] = union
+	}
+	return s
+}
+
+// Widen returns the join of prev and next (the channels of a function are
+// finite).
+func (d Chans) Widen(prev, next State) State { return d.Join(prev, next) }
+
+// Leq returns true if every channel held in a is held in b.
+func (Chans) Leq(a, b State) bool {
+	ca, cb := a.(ChanState), b.(ChanState)
+	if ca == nil {
+		return true
+	}
+	if cb == nil {
+		return false
+	}
+	for v, set := range ca {
+		for c := range set {
+			if !cb[v][c] {
+				return false
+			}
+		}
+	}
+	return true
+}
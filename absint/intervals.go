@@ -0,0 +1,451 @@
+package absint
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Infinite bounds of intervals.
+const (
+	NegInf int64 = math.MinInt64
+	PosInf int64 = math.MaxInt64
+)
+
+// Interval is a range [Lo, Hi] of integers, where the bounds NegInf and PosInf
+// stand for -∞ and +∞.
+type Interval struct {
+	Lo, Hi int64
+}
+
+// Top is the interval of all integers.
+var Top = Interval{Lo: NegInf, Hi: PosInf}
+
+// Singleton returns the interval [n, n].
+func Singleton(n int64) Interval { return Interval{Lo: n, Hi: n} }
+
+// Const returns the value of the interval if it is a singleton.
+func (i Interval) Const() (int64, bool) {
+	return i.Lo, i.Lo == i.Hi && i.Lo != NegInf && i.Hi != PosInf
+}
+
+// Empty returns true if the interval has no integers.
+func (i Interval) Empty() bool { return i.Lo > i.Hi }
+
+func (i Interval) String() string {
+	lo, hi := fmt.Sprint(i.Lo), fmt.Sprint(i.Hi)
+	if i.Lo == NegInf {
+		lo = "-inf"
+	}
+	if i.Hi == PosInf {
+		hi = "+inf"
+	}
+	return fmt.Sprintf("[%s, %s]", lo, hi)
+}
+
+func (i Interval) join(j Interval) Interval {
+	return Interval{Lo: min64(i.Lo, j.Lo), Hi: max64(i.Hi, j.Hi)}
+}
+
+func (i Interval) meet(j Interval) Interval {
+	return Interval{Lo: max64(i.Lo, j.Lo), Hi: min64(i.Hi, j.Hi)}
+}
+
+// widen returns i with the bounds growing in j moved to infinity.
+func (i Interval) widen(j Interval) Interval {
+	w := i
+	if j.Lo < i.Lo {
+		w.Lo = NegInf
+	}
+	if j.Hi > i.Hi {
+		w.Hi = PosInf
+	}
+	return w
+}
+
+func (i Interval) leq(j Interval) bool { return j.Lo <= i.Lo && i.Hi <= j.Hi }
+
+// binOp returns the interval of x op y.
+func binOp(op token.Token, x, y Interval) Interval {
+	switch op {
+	case token.ADD:
+		return Interval{Lo: addBound(x.Lo, y.Lo, NegInf), Hi: addBound(x.Hi, y.Hi, PosInf)}
+	case token.SUB:
+		return binOp(token.ADD, x, neg(y))
+	case token.MUL:
+		return hull(mulBound(x.Lo, y.Lo), mulBound(x.Lo, y.Hi), mulBound(x.Hi, y.Lo), mulBound(x.Hi, y.Hi))
+	case token.QUO:
+		if y.Lo <= 0 && y.Hi >= 0 {
+			return Top
+		}
+		return hull(quoBound(x.Lo, y.Lo), quoBound(x.Lo, y.Hi), quoBound(x.Hi, y.Lo), quoBound(x.Hi, y.Hi))
+	case token.REM:
+		if y.Lo == NegInf || y.Hi == PosInf {
+			return Top
+		}
+		m := max64(abs64(y.Lo), abs64(y.Hi)) - 1
+		if m < 0 {
+			return Top
+		}
+		if x.Lo >= 0 {
+			return Interval{Lo: 0, Hi: min64(m, x.Hi)}
+		}
+		return Interval{Lo: -m, Hi: m}
+	case token.AND:
+		if x.Lo >= 0 || y.Lo >= 0 { // Bounded by the non-negative operand.
+			hi := PosInf
+			if x.Lo >= 0 {
+				hi = x.Hi
+			}
+			if y.Lo >= 0 {
+				hi = min64(hi, y.Hi)
+			}
+			return Interval{Lo: 0, Hi: hi}
+		}
+	case token.SHR:
+		if x.Lo >= 0 && y.Lo >= 0 {
+			return Interval{Lo: 0, Hi: x.Hi}
+		}
+	}
+	return Top
+}
+
+func neg(i Interval) Interval {
+	return Interval{Lo: negBound(i.Hi), Hi: negBound(i.Lo)}
+}
+
+func negBound(n int64) int64 {
+	switch n {
+	case NegInf:
+		return PosInf
+	case PosInf:
+		return NegInf
+	}
+	return -n
+}
+
+// addBound returns x+y, or inf if either is infinite or the sum overflows.
+func addBound(x, y, inf int64) int64 {
+	if x == NegInf || x == PosInf || y == NegInf || y == PosInf {
+		return inf
+	}
+	s := x + y
+	if (y > 0 && s < x) || (y < 0 && s > x) {
+		return inf
+	}
+	return s
+}
+
+// mulBound returns x*y, saturated to the infinite bounds.
+func mulBound(x, y int64) int64 {
+	if x == 0 || y == 0 {
+		return 0
+	}
+	inf := PosInf
+	if (x < 0) != (y < 0) {
+		inf = NegInf
+	}
+	if x == NegInf || x == PosInf || y == NegInf || y == PosInf {
+		return inf
+	}
+	p := x * y
+	if p/y != x || p == NegInf || p == PosInf {
+		return inf
+	}
+	return p
+}
+
+// quoBound returns x/y for y non-zero, saturated to the infinite bounds.
+func quoBound(x, y int64) int64 {
+	switch {
+	case y == NegInf || y == PosInf:
+		return 0
+	case x == NegInf || x == PosInf:
+		if (x < 0) != (y < 0) {
+			return NegInf
+		}
+		return PosInf
+	}
+	return x / y
+}
+
+func hull(bounds ...int64) Interval {
+	i := Interval{Lo: bounds[0], Hi: bounds[0]}
+	for _, b := range bounds[1:] {
+		i.Lo, i.Hi = min64(i.Lo, b), max64(i.Hi, b)
+	}
+	return i
+}
+
+func min64(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func max64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return negBound(n)
+	}
+	return n
+}
+
+// IntervalState maps integer values to their ranges, i.e. the state of the
+// Intervals domain. Values not in the state range over all integers. The nil
+// IntervalState is the bottom state.
+type IntervalState map[ssa.Value]Interval
+
+// Of returns the range of v in s.
+func (s IntervalState) Of(v ssa.Value) Interval {
+	if c, ok := v.(*ssa.Const); ok && c.Value != nil && c.Value.Kind() == constant.Int {
+		if n, exact := constant.Int64Val(c.Value); exact {
+			return Singleton(n)
+		}
+	}
+	if i, ok := s[v]; ok {
+		return i
+	}
+	return Top
+}
+
+// with returns a copy of s where v ranges over i.
+func (s IntervalState) with(v ssa.Value, i Interval) IntervalState {
+	t := make(IntervalState, len(s)+1)
+	for k, r := range s {
+		t[k] = r
+	}
+	if i == Top {
+		delete(t, v)
+	} else {
+		t[v] = i
+	}
+	return t
+}
+
+// Intervals is the domain of the ranges of integer values, i.e. a constant
+// propagation generalised to intervals, e.g. n := runtime.NumCPU(); m := n*2
+// gives m the range [2, +inf]. Branch conditions comparing integers refine the
+// ranges of the operands on each edge, and φ-nodes take the range of the value
+// on the incoming edge. Overflows are not modelled, i.e. arithmetic is over
+// the (unbounded) integers, and variables in memory are not tracked.
+type Intervals struct{}
+
+// Bottom returns the nil IntervalState.
+func (Intervals) Bottom() State { return IntervalState(nil) }
+
+// Entry returns the state where every value ranges over all integers.
+func (Intervals) Entry(fn *ssa.Function) State { return make(IntervalState) }
+
+// Transfer records the range of the integer value defined by instr.
+func (Intervals) Transfer(instr ssa.Instruction, s State) State {
+	is := s.(IntervalState)
+	v, ok := instr.(ssa.Value)
+	if _, isRange := instr.(*ssa.Range); isRange { // Iterator of opaque type.
+		return s
+	}
+	if is == nil || !ok || !isInt(v.Type()) {
+		return s
+	}
+	switch v := v.(type) {
+	case *ssa.Phi: // See Edge.
+		return s
+	case *ssa.BinOp:
+		return is.with(v, binOp(v.Op, is.Of(v.X), is.Of(v.Y)))
+	case *ssa.UnOp:
+		if v.Op == token.SUB {
+			return is.with(v, neg(is.Of(v.X)))
+		}
+	case *ssa.Convert:
+		if isInt(v.X.Type()) {
+			return is.with(v, is.Of(v.X))
+		}
+	case *ssa.ChangeType:
+		return is.with(v, is.Of(v.X))
+	case *ssa.Call:
+		return is.with(v, callRange(v.Common()))
+	}
+	return is.with(v, Top)
+}
+
+// callRange returns the range of the result of call c.
+func callRange(c *ssa.CallCommon) Interval {
+	if b, ok := c.Value.(*ssa.Builtin); ok && (b.Name() == "len" || b.Name() == "cap") {
+		return Interval{Lo: 0, Hi: PosInf}
+	}
+	if fn := c.StaticCallee(); fn != nil {
+		switch fn.String() {
+		case "runtime.NumCPU", "runtime.GOMAXPROCS", "runtime.NumGoroutine":
+			return Interval{Lo: 1, Hi: PosInf}
+		}
+	}
+	return Top
+}
+
+// Edge refines the ranges of the operands of the branch condition of from,
+// and sets the ranges of the φ-nodes of to from the values on the edge.
+func (Intervals) Edge(from, to *ssa.BasicBlock, s State) State {
+	is := s.(IntervalState)
+	if is == nil {
+		return s
+	}
+	if instr, ok := from.Instrs[len(from.Instrs)-1].(*ssa.If); ok && from.Succs[0] != from.Succs[1] {
+		if is = refine(is, instr.Cond, to == from.Succs[0]); is == nil {
+			return IntervalState(nil)
+		}
+	}
+	phis := make(map[ssa.Value]Interval)
+	for _, instr := range to.Instrs {
+		phi, ok := instr.(*ssa.Phi)
+		if !ok {
+			break
+		}
+		if isInt(phi.Type()) {
+			for i, pred := range to.Preds {
+				if pred == from {
+					phis[phi] = is.Of(phi.Edges[i])
+				}
+			}
+		}
+	}
+	for phi, i := range phis {
+		is = is.with(phi, i)
+	}
+	return is
+}
+
+// refine returns s refined by cond (or its negation), or nil if cond cannot
+// hold in s.
+func refine(s IntervalState, cond ssa.Value, holds bool) IntervalState {
+	if not, ok := cond.(*ssa.UnOp); ok && not.Op == token.NOT {
+		return refine(s, not.X, !holds)
+	}
+	b, ok := cond.(*ssa.BinOp)
+	if !ok || !isInt(b.X.Type()) {
+		return s
+	}
+	op := b.Op
+	if !holds {
+		switch op {
+		case token.EQL:
+			op = token.NEQ
+		case token.NEQ:
+			op = token.EQL
+		case token.LSS:
+			op = token.GEQ
+		case token.LEQ:
+			op = token.GTR
+		case token.GTR:
+			op = token.LEQ
+		case token.GEQ:
+			op = token.LSS
+		default:
+			return s
+		}
+	}
+	x, y := s.Of(b.X), s.Of(b.Y)
+	var nx, ny Interval
+	switch op {
+	case token.EQL:
+		nx = x.meet(y)
+		ny = nx
+	case token.LSS: // x < y
+		nx = x.meet(Interval{Lo: NegInf, Hi: addBound(y.Hi, -1, PosInf)})
+		ny = y.meet(Interval{Lo: addBound(x.Lo, 1, NegInf), Hi: PosInf})
+	case token.LEQ:
+		nx = x.meet(Interval{Lo: NegInf, Hi: y.Hi})
+		ny = y.meet(Interval{Lo: x.Lo, Hi: PosInf})
+	case token.GTR: // y < x
+		ny = y.meet(Interval{Lo: NegInf, Hi: addBound(x.Hi, -1, PosInf)})
+		nx = x.meet(Interval{Lo: addBound(y.Lo, 1, NegInf), Hi: PosInf})
+	case token.GEQ:
+		ny = y.meet(Interval{Lo: NegInf, Hi: x.Hi})
+		nx = x.meet(Interval{Lo: y.Lo, Hi: PosInf})
+	default:
+		return s
+	}
+	if nx.Empty() || ny.Empty() {
+		return nil
+	}
+	if _, ok := b.X.(*ssa.Const); !ok {
+		s = s.with(b.X, nx)
+	}
+	if _, ok := b.Y.(*ssa.Const); !ok {
+		s = s.with(b.Y, ny)
+	}
+	return s
+}
+
+// isInt returns true if t is an integer type.
+func isInt(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsInteger != 0
+}
+
+// Join returns the union of the ranges in a and b.
+func (Intervals) Join(a, b State) State {
+	ia, ib := a.(IntervalState), b.(IntervalState)
+	switch {
+	case ia == nil:
+		return ib
+	case ib == nil:
+		return ia
+	}
+	s := make(IntervalState)
+	for v, i := range ia {
+		if j, ok := ib[v]; ok {
+			s[v] = i.join(j)
+		}
+	}
+	return s
+}
+
+// Widen returns the join of prev and next, with the bounds growing from prev
+// to next moved to infinity.
+func (Intervals) Widen(prev, next State) State {
+	ip, in := prev.(IntervalState), next.(IntervalState)
+	switch {
+	case ip == nil:
+		return in
+	case in == nil:
+		return ip
+	}
+	s := make(IntervalState)
+	for v, i := range ip {
+		if j, ok := in[v]; ok {
+			if w := i.widen(j); w != Top {
+				s[v] = w
+			}
+		}
+	}
+	return s
+}
+
+// Leq returns true if the ranges in a are included in the ranges in b.
+func (Intervals) Leq(a, b State) bool {
+	ia, ib := a.(IntervalState), b.(IntervalState)
+	if ia == nil {
+		return true
+	}
+	if ib == nil {
+		return false
+	}
+	for v, j := range ib {
+		i, ok := ia[v]
+		if !ok || !i.leq(j) {
+			return false
+		}
+	}
+	return true
+}
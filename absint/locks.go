@@ -0,0 +1,134 @@
+package absint
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// LockSet is a set of locks held, i.e. the state of the Locks domain. The nil
+// LockSet is the bottom state.
+type LockSet map[string]bool
+
+// Intersect returns the locks in both l and m.
+func (l LockSet) Intersect(m LockSet) LockSet {
+	s := make(LockSet)
+	for k := range l {
+		if m[k] {
+			s[k] = true
+		}
+	}
+	return s
+}
+
+// Equal returns true if l and m hold the same locks.
+func (l LockSet) Equal(m LockSet) bool {
+	if len(l) != len(m) {
+		return false
+	}
+	for k := range l {
+		if !m[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of l.
+func (l LockSet) Clone() LockSet {
+	s := make(LockSet, len(l))
+	for k := range l {
+		s[k] = true
+	}
+	return s
+}
+
+func (l LockSet) String() string {
+	var keys []string
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return "{" + strings.Join(keys, ", ") + "}"
+}
+
+// Locks is the domain of the locks (sync.Mutex and sync.RWMutex) held on
+// every path to an instruction, i.e. a must analysis where the join of
+// states is the intersection of locks held.
+type Locks struct {
+	Held LockSet // Locks held at entry.
+
+	// Key returns the key of the mutex at address v, or false if the mutex
+	// is not tracked.
+	Key func(v ssa.Value) (string, bool)
+}
+
+// Bottom returns the nil LockSet.
+func (l *Locks) Bottom() State { return LockSet(nil) }
+
+// Entry returns the locks held at entry.
+func (l *Locks) Entry(fn *ssa.Function) State {
+	if l.Held == nil {
+		return make(LockSet)
+	}
+	return l.Held.Clone()
+}
+
+// Transfer adds the locks acquired and removes the locks released by instr.
+func (l *Locks) Transfer(instr ssa.Instruction, s State) State {
+	locks := s.(LockSet)
+	call, ok := instr.(*ssa.Call)
+	if !ok || locks == nil {
+		return s
+	}
+	callee := call.Call.StaticCallee()
+	if callee == nil || len(call.Call.Args) == 0 {
+		return s
+	}
+	switch callee.String() {
+	case "(*sync.Mutex).Lock", "(*sync.RWMutex).Lock", "(*sync.RWMutex).RLock":
+		if k, ok := l.Key(call.Call.Args[0]); ok && !locks[k] {
+			locks = locks.Clone()
+			locks[k] = true
+		}
+	case "(*sync.Mutex).Unlock", "(*sync.RWMutex).Unlock", "(*sync.RWMutex).RUnlock":
+		if k, ok := l.Key(call.Call.Args[0]); ok && locks[k] {
+			locks = locks.Clone()
+			delete(locks, k)
+		}
+	}
+	return locks
+}
+
+// Join returns the locks held in both a and b.
+func (l *Locks) Join(a, b State) State {
+	la, lb := a.(LockSet), b.(LockSet)
+	switch {
+	case la == nil:
+		return lb
+	case lb == nil:
+		return la
+	}
+	return la.Intersect(lb)
+}
+
+// Widen returns the join of prev and next (the domain is finite).
+func (l *Locks) Widen(prev, next State) State { return l.Join(prev, next) }
+
+// Leq returns true if a holds all locks of b (or a is bottom).
+func (l *Locks) Leq(a, b State) bool {
+	la, lb := a.(LockSet), b.(LockSet)
+	if la == nil {
+		return true
+	}
+	if lb == nil {
+		return false
+	}
+	for k := range lb {
+		if !la[k] {
+			return false
+		}
+	}
+	return true
+}
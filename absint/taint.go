@@ -0,0 +1,138 @@
+package absint
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// TaintSet is a set of tainted values (and variables), i.e. the state of the
+// Taint domain. The nil TaintSet is the bottom state.
+type TaintSet map[ssa.Value]bool
+
+// with returns a copy of s where v is tainted (or untainted).
+func (s TaintSet) with(v ssa.Value, tainted bool) TaintSet {
+	if s[v] == tainted {
+		return s
+	}
+	t := make(TaintSet, len(s)+1)
+	for k := range s {
+		t[k] = true
+	}
+	if tainted {
+		t[v] = true
+	} else {
+		delete(t, v)
+	}
+	return t
+}
+
+// Taint is the domain of tainted values, i.e. a may analysis of the flow of
+// values returned by sources, where the results of operations on tainted
+// values are tainted, and the results of sanitizers are not.
+type Taint struct {
+	Source    func(fn *ssa.Function) bool // Function returns tainted values.
+	Sanitizer func(fn *ssa.Function) bool // Function returns untainted values.
+	Params    []int                       // Indices of parameters tainted at entry.
+}
+
+// Bottom returns the nil TaintSet.
+func (d *Taint) Bottom() State { return TaintSet(nil) }
+
+// Entry returns the state where the parameters in Params are tainted.
+func (d *Taint) Entry(fn *ssa.Function) State {
+	s := make(TaintSet)
+	for _, i := range d.Params {
+		if i < len(fn.Params) {
+			s[fn.Params[i]] = true
+		}
+	}
+	return s
+}
+
+// Transfer taints the value defined (or the variable stored to) by instr if
+// it is derived from a tainted value.
+func (d *Taint) Transfer(instr ssa.Instruction, s State) State {
+	ts := s.(TaintSet)
+	if ts == nil {
+		return s
+	}
+	switch instr := instr.(type) {
+	case *ssa.Store:
+		if ts[instr.Val] {
+			return ts.with(instr.Addr, true)
+		}
+		// Strong update of local variables.
+		if alloc, ok := instr.Addr.(*ssa.Alloc); ok && !alloc.Heap {
+			return ts.with(alloc, false)
+		}
+		return s
+	case *ssa.UnOp:
+		if instr.Op == token.MUL {
+			return ts.with(instr, ts[instr.X])
+		}
+	case ssa.CallInstruction:
+		v := instr.Value()
+		if v == nil {
+			return s
+		}
+		if fn := instr.Common().StaticCallee(); fn != nil {
+			if d.Source != nil && d.Source(fn) {
+				return ts.with(v, true)
+			}
+			if d.Sanitizer != nil && d.Sanitizer(fn) {
+				return ts.with(v, false)
+			}
+		}
+	}
+	v, ok := instr.(ssa.Value)
+	if !ok {
+		return s
+	}
+	for _, op := range instr.Operands(nil) {
+		if *op != nil && ts[*op] {
+			return ts.with(v, true)
+		}
+	}
+	return s
+}
+
+// Join returns the values tainted in a or b.
+func (d *Taint) Join(a, b State) State {
+	ta, tb := a.(TaintSet), b.(TaintSet)
+	switch {
+	case ta == nil:
+		return tb
+	case tb == nil:
+		return ta
+	}
+	s := make(TaintSet, len(ta)+len(tb))
+	for v := range ta {
+		s[v] = true
+	}
+	for v := range tb {
+		s[v] = true
+	}
+	return s
+}
+
+// Widen returns the join of prev and next (the values of a function are
+// finite).
+func (d *Taint) Widen(prev, next State) State { return d.Join(prev, next) }
+
+// Leq returns true if every value tainted in a is tainted in b.
+func (d *Taint) Leq(a, b State) bool {
+	ta, tb := a.(TaintSet), b.(TaintSet)
+	if ta == nil {
+		return true
+	}
+	if tb == nil {
+		return false
+	}
+	for v := range ta {
+		if !tb[v] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var mu sync.Mutex
+
+func locked(n int) int {
+	mu.Lock()
+	x := n
+	if n > 0 {
+		mu.Unlock()
+		x = 0
+		mu.Lock()
+	}
+	x++ // Locked on every path.
+	mu.Unlock()
+	return x // Not locked.
+}
+
+func chans(b bool) chan int {
+	ch1, ch2 := make(chan int), make(chan int)
+	ch := ch1
+	if b {
+		ch = ch2
+	}
+	return ch
+}
+
+func tainted() string {
+	s := os.Getenv("X")
+	t := strings.ToUpper(s)
+	clean := strings.TrimSpace(t)
+	return clean
+}
+
+func workers() chan int {
+	n := runtime.NumCPU()
+	m := n * 2
+	return make(chan int, m)
+}
+
+func sum() int {
+	s := 0
+	for i := 0; i < 10; i++ {
+		s += i
+	}
+	return s
+}
+
+func main() {
+	locked(1)
+	chans(true)
+	tainted()
+	workers()
+	sum()
+}
@@ -53,6 +53,14 @@ func Toplevel() Context {
 	return toplevel
 }
 
+// NewToplevel returns a new empty context, with its own backing storage.
+//
+// Unlike Toplevel, the contexts of independent analyses (e.g. concurrent)
+// created from different NewToplevel do not share storage.
+func NewToplevel() Context {
+	return &emptyCtx{s: store.New()}
+}
+
 // Updater is an interface for a context that has the ability to modify the
 // underlying storage which the instances point to.
 //
@@ -142,15 +150,30 @@ func Switch(parent Context, call *funcs.Instance) Context {
 					if sf.Key != nil {
 						argFieldVal := parent.Get(sf.Key)
 						c.Put(paramField, argFieldVal)
+					} else {
+						// Field stored by index, e.g. of a struct returned
+						// from a constructor.
+						switch argFieldVal := parent.Get(sf).(type) {
+						case nil, store.MockValue:
+						default:
+							c.Put(paramField, argFieldVal)
+						}
 					}
 				case *structs.Struct:
 					// Skip. The fields would be handled above after Expand()
 				}
 			}
 		} else {
-			if param != nil {
+			if param != nil && argValue != nil {
 				c.Put(param, argValue)
 			}
+			if closure, ok := argValue.(*funcs.Definition); ok {
+				// Closure bindings are only visible in caller, copy them
+				// so the closure can be called from callee.
+				for _, binding := range closure.Bindings() {
+					c.Put(binding, parent.Get(binding))
+				}
+			}
 		}
 	}
 	return &c
@@ -0,0 +1,164 @@
+// Package callgraph provides call graphs of SSA programs built with a
+// selectable algorithm, for resolving the callees of dynamic calls.
+//
+// The algorithms available are those of golang.org/x/tools/go/callgraph:
+//
+//   - static  static calls only (unsound)
+//   - cha     Class Hierarchy Analysis
+//   - rta     Rapid Type Analysis
+//   - pta     inclusion-based Points-To Analysis
+//
+// from the least to the most precise (and expensive).
+package callgraph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	gssa "github.com/nickng/gospal/ssa"
+	xcallgraph "golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Algo is a call graph construction algorithm.
+type Algo string
+
+// Call graph construction algorithms.
+const (
+	Static Algo = "static"
+	CHA    Algo = "cha"
+	RTA    Algo = "rta"
+	PTA    Algo = "pta"
+)
+
+// ParseAlgo returns the algorithm named s.
+func ParseAlgo(s string) (Algo, error) {
+	switch algo := Algo(s); algo {
+	case Static, CHA, RTA, PTA:
+		return algo, nil
+	}
+	return "", fmt.Errorf("unknown call graph algorithm %q (use static, cha, rta or pta)", s)
+}
+
+// Graph is a call graph of a program.
+type Graph struct {
+	Algo Algo
+
+	cg      *xcallgraph.Graph
+	prog    *ssa.Program
+	callees map[*ssa.CallCommon][]*ssa.Function
+	callers map[*ssa.Function][]ssa.CallInstruction
+}
+
+// Build returns the call graph of the program in info built with algo.
+func Build(info *gssa.Info, algo Algo) (*Graph, error) {
+	cg, err := info.BuildCallGraph(string(algo), false)
+	if err != nil {
+		return nil, err
+	}
+	g := &Graph{
+		Algo:    algo,
+		cg:      cg.Graph(),
+		prog:    info.Prog,
+		callees: make(map[*ssa.CallCommon][]*ssa.Function),
+		callers: make(map[*ssa.Function][]ssa.CallInstruction),
+	}
+	seen := make(map[*xcallgraph.Edge]bool)
+	for _, n := range g.cg.Nodes {
+		for _, e := range n.Out {
+			if seen[e] || e.Site == nil || e.Callee.Func == nil {
+				continue
+			}
+			seen[e] = true
+			c := e.Site.Common()
+			g.callees[c] = append(g.callees[c], e.Callee.Func)
+			g.callers[e.Callee.Func] = append(g.callers[e.Callee.Func], e.Site)
+		}
+	}
+	for _, fns := range g.callees {
+		sort.Slice(fns, func(i, j int) bool { return fns[i].String() < fns[j].String() })
+	}
+	return g, nil
+}
+
+// Graph returns the underlying call graph.
+func (g *Graph) Graph() *xcallgraph.Graph {
+	return g.cg
+}
+
+// Callees returns the functions which may be called by c, ordered by name.
+func (g *Graph) Callees(c *ssa.CallCommon) []*ssa.Function {
+	return g.callees[c]
+}
+
+// Callers returns the call sites which may call fn.
+func (g *Graph) Callers(fn *ssa.Function) []ssa.CallInstruction {
+	return g.callers[fn]
+}
+
+// edges returns the edges of the call graph, ordered by caller and callee.
+func (g *Graph) edges() []*xcallgraph.Edge {
+	var edges []*xcallgraph.Edge
+	xcallgraph.GraphVisitEdges(g.cg, func(e *xcallgraph.Edge) error {
+		if e.Caller.Func != nil && e.Callee.Func != nil {
+			edges = append(edges, e)
+		}
+		return nil
+	})
+	sort.SliceStable(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.Caller.Func != b.Caller.Func {
+			return a.Caller.Func.String() < b.Caller.Func.String()
+		}
+		return a.Callee.Func.String() < b.Callee.Func.String()
+	})
+	return edges
+}
+
+// WriteDot writes the call graph to w in graphviz dot format.
+func (g *Graph) WriteDot(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("digraph callgraph {\n")
+	for _, e := range g.edges() {
+		style := ""
+		if e.Site != nil && e.Site.Common().StaticCallee() == nil {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(bufw, "  %q -> %q%s\n", e.Caller.Func, e.Callee.Func, style)
+	}
+	bufw.WriteString("}\n")
+	return bufw.Flush()
+}
+
+// jsonEdge is an edge of the call graph in JSON.
+type jsonEdge struct {
+	Caller  string `json:"caller"`
+	Callee  string `json:"callee"`
+	Pos     string `json:"pos,omitempty"`
+	Dynamic bool   `json:"dynamic"`
+}
+
+// WriteJSON writes the call graph to w as a JSON object with the algorithm
+// and the list of edges.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	edges := []jsonEdge{}
+	for _, e := range g.edges() {
+		je := jsonEdge{Caller: e.Caller.Func.String(), Callee: e.Callee.Func.String()}
+		if e.Site != nil {
+			if pos := e.Site.Pos(); pos.IsValid() {
+				je.Pos = g.prog.Fset.Position(pos).String()
+			}
+			je.Dynamic = e.Site.Common().StaticCallee() == nil
+		}
+		edges = append(edges, je)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Algo  Algo       `json:"algo"`
+		Edges []jsonEdge `json:"edges"`
+	}{g.Algo, edges})
+}
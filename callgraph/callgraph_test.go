@@ -0,0 +1,74 @@
+package callgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	gssa "github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/ssa/build"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Tests resolving an invoke call with the callgraph.
+func TestCallees(t *testing.T) {
+	info, err := build.FromFiles("testdata/dynamic.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		t.Fatalf("no main package: %v", err)
+	}
+	total := mains[0].Func("total")
+	for _, algo := range []Algo{CHA, RTA, PTA} {
+		g, err := Build(info, algo)
+		if err != nil {
+			t.Fatalf("cannot build %s callgraph: %v", algo, err)
+		}
+		var callees []*ssa.Function
+		for _, blk := range total.Blocks {
+			for _, instr := range blk.Instrs {
+				if call, ok := instr.(*ssa.Call); ok && call.Call.IsInvoke() {
+					callees = g.Callees(call.Common())
+				}
+			}
+		}
+		if len(callees) < 2 {
+			t.Errorf("%s: expecting callees of s.area() to be (main.square).area and (*main.rect).area but got %v", algo, callees)
+		}
+	}
+}
+
+// Tests JSON export of callgraph.
+func TestWriteJSON(t *testing.T) {
+	info, err := build.FromFiles("testdata/dynamic.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	g, err := Build(info, Static)
+	if err != nil {
+		t.Fatalf("cannot build callgraph: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatalf("cannot write JSON: %v", err)
+	}
+	var out struct {
+		Algo  string
+		Edges []struct{ Caller, Callee string }
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if out.Algo != "static" || len(out.Edges) == 0 {
+		t.Errorf("Unexpected callgraph: %s", buf.String())
+	}
+}
+
+// Tests unknown algorithm.
+func TestParseAlgo(t *testing.T) {
+	if _, err := ParseAlgo("vta"); err == nil {
+		t.Errorf("Expecting error for unknown algorithm")
+	}
+}
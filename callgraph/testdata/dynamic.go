@@ -0,0 +1,25 @@
+package main
+
+type shape interface {
+	area() int
+}
+
+type square struct{ n int }
+
+func (s square) area() int { return s.n * s.n }
+
+type rect struct{ w, h int }
+
+func (r *rect) area() int { return r.w * r.h }
+
+func total(shapes []shape) int {
+	sum := 0
+	for _, s := range shapes {
+		sum += s.area()
+	}
+	return sum
+}
+
+func main() {
+	total([]shape{square{2}, &rect{2, 3}})
+}
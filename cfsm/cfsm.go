@@ -0,0 +1,206 @@
+// Package cfsm exports the goroutines of MiGo programs as communicating finite
+// state machines (CFSMs), i.e. finite state machines whose transitions send
+// messages to, or receive messages from, the other machines.
+//
+// Each role of the session of the program (see session.Extract), i.e. each
+// goroutine, is a machine whose states are the states of its local type (see
+// session.NewAutomaton) without internal transitions. The message of a
+// transition is the channel (MiGo newchan) it is sent on, and the peer of a
+// transition is the machine at the other end of the channel, so a send on a
+// channel with several receivers is a transition to each receiver. Closing a
+// channel is an internal transition, as the channels of CFSMs are not closed.
+// Note that the channels of CFSMs are asynchronous (FIFO queues), whereas
+// unbuffered Go channels are synchronous.
+//
+// The machines are written in the fsa format of CFSM tools (e.g. the global
+// graph synthesis of GMC), where machines are numbered from 0 in order, e.g.
+//
+//	.outputs main.main
+//	.state graph
+//	q0 1 ? main.main.t0_chan0 q1
+//	.marking q0
+//	.end
+//
+// where q0 1 ? m q1 is a transition from state q0 to q1 receiving message m
+// from machine 1 (! for send), and .marking is the initial state.
+package cfsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/migo"
+)
+
+// Machine is a communicating finite state machine.
+type Machine struct {
+	Name        string
+	States      int   // Number of states, where the initial state is 0.
+	Final       []int // Final states.
+	Transitions []Transition
+}
+
+// Transition is a transition of a machine, sending message Msg to (or
+// receiving from) machine Peer.
+type Transition struct {
+	Src, Dst int
+	Peer     int // Index of the peer machine.
+	Send     bool
+	Msg      string
+}
+
+// System is a system of communicating machines.
+type System struct {
+	Machines []*Machine
+}
+
+// New returns the system of the goroutines of prog.
+func New(prog *migo.Program) *System {
+	sess := session.Extract(prog)
+	index := make(map[string]int)
+	for i, r := range sess.Roles {
+		index[r.Name] = i
+	}
+	peers := func(m *session.Msg, self string) []int {
+		if m.Peer != "" {
+			return []int{index[m.Peer]}
+		}
+		senders, receivers := sess.Endpoints(m.Chan)
+		others := senders
+		if m.Send {
+			others = receivers
+		}
+		var idx []int
+		for _, r := range others {
+			if r != self {
+				idx = append(idx, index[r])
+			}
+		}
+		return idx
+	}
+	sys := new(System)
+	for _, r := range sess.Roles {
+		a := session.NewAutomaton(r.Type)
+		var labelled []Transition
+		internal := make(map[int][]int)
+		for _, tr := range a.Transitions {
+			if tr.Msg == nil || tr.Msg.Send && tr.Msg.Label == "close" {
+				internal[tr.Src] = append(internal[tr.Src], tr.Dst)
+				continue
+			}
+			for _, p := range peers(tr.Msg, r.Name) {
+				labelled = append(labelled, Transition{Src: tr.Src, Dst: tr.Dst, Peer: p, Send: tr.Msg.Send, Msg: tr.Msg.Chan})
+			}
+		}
+		sys.Machines = append(sys.Machines, eliminate(r.Name, a, labelled, internal))
+	}
+	return sys
+}
+
+// eliminate returns the machine of automaton a with transitions labelled,
+// where the internal transitions, and the states unreachable from the initial
+// state, are removed. The machine may be non-deterministic.
+func eliminate(name string, a *session.Automaton, labelled []Transition, internal map[int][]int) *Machine {
+	closure := func(s int) []int {
+		seen := map[int]bool{s: true}
+		states := []int{s}
+		for i := 0; i < len(states); i++ {
+			for _, t := range internal[states[i]] {
+				if !seen[t] {
+					seen[t] = true
+					states = append(states, t)
+				}
+			}
+		}
+		return states
+	}
+	from := make(map[int][]Transition)
+	for _, t := range labelled {
+		from[t.Src] = append(from[t.Src], t)
+	}
+	m := &Machine{Name: name}
+	renum := make(map[int]int)
+	var queue []int
+	state := func(s int) int {
+		if n, ok := renum[s]; ok {
+			return n
+		}
+		renum[s] = m.States
+		m.States++
+		queue = append(queue, s)
+		return renum[s]
+	}
+	state(0)
+	for i := 0; i < len(queue); i++ {
+		s := queue[i]
+		seen := make(map[Transition]bool)
+		final := false
+		for _, c := range closure(s) {
+			final = final || c == a.Final
+			for _, t := range from[c] {
+				nt := Transition{Src: renum[s], Dst: state(t.Dst), Peer: t.Peer, Send: t.Send, Msg: t.Msg}
+				if !seen[nt] {
+					seen[nt] = true
+					m.Transitions = append(m.Transitions, nt)
+				}
+			}
+		}
+		if final {
+			m.Final = append(m.Final, renum[s])
+		}
+	}
+	sort.SliceStable(m.Transitions, func(i, j int) bool { return m.Transitions[i].Src < m.Transitions[j].Src })
+	return m
+}
+
+// WriteFSA writes the machines of sys to w in fsa format.
+func (sys *System) WriteFSA(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	for _, m := range sys.Machines {
+		fmt.Fprintf(bufw, ".outputs %s\n.state graph\n", m.Name)
+		for _, t := range m.Transitions {
+			op := "?"
+			if t.Send {
+				op = "!"
+			}
+			fmt.Fprintf(bufw, "q%d %d %s %s q%d\n", t.Src, t.Peer, op, t.Msg, t.Dst)
+		}
+		bufw.WriteString(".marking q0\n.end\n\n")
+	}
+	return bufw.Flush()
+}
+
+// WriteDot writes the machines of sys to w in dot format, one cluster per
+// machine, where final states are double circles.
+func (sys *System) WriteDot(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("digraph cfsm {\n")
+	for i, m := range sys.Machines {
+		fmt.Fprintf(bufw, "  subgraph cluster_%d {\n    label=%q;\n", i, m.Name)
+		final := make(map[int]bool)
+		for _, s := range m.Final {
+			final[s] = true
+		}
+		for s := 0; s < m.States; s++ {
+			shape := "circle"
+			if final[s] {
+				shape = "doublecircle"
+			}
+			fmt.Fprintf(bufw, "    m%d_q%d [label=\"q%d\" shape=%s];\n", i, s, s, shape)
+		}
+		for _, t := range m.Transitions {
+			op := "?"
+			if t.Send {
+				op = "!"
+			}
+			fmt.Fprintf(bufw, "    m%d_q%d -> m%d_q%d [label=%q];\n", i, t.Src, i, t.Dst,
+				fmt.Sprintf("%s%s%s", sys.Machines[t.Peer].Name, op, t.Msg))
+		}
+		bufw.WriteString("  }\n")
+	}
+	bufw.WriteString("}\n")
+	return bufw.Flush()
+}
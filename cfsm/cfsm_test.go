@@ -0,0 +1,51 @@
+package cfsm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests the machines of a program with a goroutine sending to main.
+func TestNew(t *testing.T) {
+	info, err := build.FromFiles("../migoinfer/testdata/verify/main.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	sys := New(inferer.Env.Prog)
+	index := make(map[string]int)
+	for i, m := range sys.Machines {
+		index[m.Name] = i
+	}
+	main, ok1 := index["main.main"]
+	worker, ok2 := index["main.main$1"]
+	if !ok1 || !ok2 {
+		t.Fatalf("Machines mismatch:\nExpect:\t%s\nGot:\t%v\n", "main.main, main.main$1", index)
+	}
+	expect := []struct {
+		m, peer int
+		send    bool
+	}{{main, worker, false}, {worker, main, true}}
+	for _, e := range expect {
+		m := sys.Machines[e.m]
+		if len(m.Transitions) != 1 || m.Transitions[0].Peer != e.peer || m.Transitions[0].Send != e.send {
+			t.Errorf("Transitions of %s mismatch:\nExpect:\t1 transition with %d (send=%t)\nGot:\t%+v\n", m.Name, e.peer, e.send, m.Transitions)
+		}
+		if len(m.Final) != 1 || m.Final[0] != 1 {
+			t.Errorf("Final states of %s mismatch:\nExpect:\t%v\nGot:\t%v\n", m.Name, []int{1}, m.Final)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := sys.WriteFSA(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if fsa := buf.String(); !strings.Contains(fsa, ".outputs main.main\n.state graph\nq0 ") || !strings.Contains(fsa, ".marking q0\n.end") {
+		t.Errorf("Unexpected fsa:\n%s", fsa)
+	}
+}
@@ -0,0 +1,13 @@
+// Command gospal-vet runs the checks of gospal as a vet tool, e.g.
+//
+//	go vet -vettool=$(which gospal-vet) ./...
+package main
+
+import (
+	"github.com/nickng/gospal/vet"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() {
+	unitchecker.Main(vet.Analyzers...)
+}
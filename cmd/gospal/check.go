@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+const checkUsage = `Usage:
+
+  gospal check [options] file.go [files.go...]
+  gospal check [options] packages (e.g. ./... or import paths)
+
+Infers the MiGo types of each entry point (main function or function with
+the entrypoint directive) and checks them for deadlocks with the builtin
+checker, or with an external verifier (-verify). The exit status is 1 if a
+check fails.
+
+Options:
+
+`
+
+// check runs inference followed by a checker on each entry point of the
+// program given by args, writes the verdicts to w, and returns false if a
+// check fails.
+func check(w io.Writer, args []string) (bool, error) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, checkUsage)
+		fs.PrintDefaults()
+	}
+	verifier := fs.String("verify", "", `Check with external verifier gong or kittel instead of the builtin checker, optionally with its command line (e.g. "gong=/opt/gong/Gong -T")`)
+	trace := fs.Bool("trace", false, "Show the trace leading to each deadlock, mapped to the source")
+	depth := fs.Int("depth", 0, "Maximum number of nested calls of a goroutine explored (0 means default)")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conf := build.FromFiles(fs.Args()...).Default()
+	if build.IsPackagePattern(fs.Arg(0)) {
+		conf = build.FromPackages(fs.Args()...).Default()
+	}
+	info, err := conf.Build()
+	if err != nil {
+		return false, fmt.Errorf("build failed: %v", err)
+	}
+	var v migoinfer.Verifier
+	if *verifier != "" {
+		name, cmd := *verifier, ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, cmd = name[:i], name[i+1:]
+		}
+		if v, err = migoinfer.NewVerifier(name, cmd); err != nil {
+			return false, err
+		}
+	}
+
+	entries := migoinfer.New(info, nil).Entrypoints()
+	if len(entries) == 0 {
+		return false, fmt.Errorf("no entry point (main function or entrypoint directive) found")
+	}
+	ok := true
+	for _, entry := range entries {
+		inferer := migoinfer.New(info, nil)
+		inferer.SetOutput(ioutil.Discard)
+		if *depth > 0 {
+			inferer.Bounds.MaxDepth = *depth
+		}
+		inferer.AnalyseEntry(entry)
+		fmt.Fprintf(w, "%s (%s):\n", entry.String(), info.FSet.Position(entry.Pos()))
+
+		if v != nil {
+			verdict, err := inferer.Verify(v)
+			if err != nil {
+				return false, err
+			}
+			verdict.WriteTo(w)
+			ok = ok && verdict.Holds()
+			continue
+		}
+		deadlocks, complete := inferer.DeadlocksFrom(entry, inferer.Bounds)
+		for _, d := range deadlocks {
+			fmt.Fprintln(w, d.String())
+			if *trace {
+				fmt.Fprintln(w, "trace:")
+				inferer.WriteTrace(w, d.Trace)
+			}
+		}
+		switch {
+		case len(deadlocks) > 0:
+			fmt.Fprintf(w, "FAIL: %d deadlock(s) found\n", len(deadlocks))
+			ok = false
+		case !complete:
+			fmt.Fprintln(w, "ok: no deadlock found (state space bounds reached, deadlocks may be missed)")
+		default:
+			fmt.Fprintln(w, "ok: no deadlock found")
+		}
+	}
+	return ok, nil
+}
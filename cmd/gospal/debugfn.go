@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+const debugFnUsage = `Usage:
+
+  gospal debug-fn [options] pkg.Func file.go [files.go...]
+  gospal debug-fn [options] pkg.Func packages (e.g. ./... or import paths)
+
+Analyses the program from its entry points (or -entry), and prints the SSA of
+function pkg.Func (e.g. main.worker, (*example.com/pkg.T).Run or main.main$1),
+the store at the entry and exit of each block, and the MiGo fragment emitted
+for the block, side by side.
+
+Options:
+
+`
+
+// debugFn analyses the program given by args and writes the dump of the
+// function named by the first argument to w.
+func debugFn(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("debug-fn", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, debugFnUsage)
+		fs.PrintDefaults()
+	}
+	entry := fs.String("entry", "", `Function to analyse from (format: (import/path).FuncName, empty means the entry points)`)
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	name, srcs := fs.Arg(0), fs.Args()[1:]
+	conf := build.FromFiles(srcs...).Default()
+	if build.IsPackagePattern(srcs[0]) {
+		conf = build.FromPackages(srcs...).Default()
+	}
+	info, err := conf.Build()
+	if err != nil {
+		return fmt.Errorf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.SetOutput(ioutil.Discard)
+	if *entry != "" {
+		inferer.SetEntryFunc(*entry)
+	}
+	for fn := range ssautil.AllFunctions(info.Prog) {
+		if fn.String() == name {
+			inferer.DebugFunc(fn)
+		}
+	}
+	if inferer.Env.DebugFunc == nil {
+		return fmt.Errorf("function %s not found", name)
+	}
+	inferer.Analyse()
+	inferer.WriteDebugFunc(w)
+	return nil
+}
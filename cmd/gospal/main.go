@@ -0,0 +1,76 @@
+// Command gospal is the entry point to the gospal tools which run as
+// subcommands, e.g. the Language Server Protocol server.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nickng/gospal/lsp"
+	"github.com/nickng/gospal/rpc"
+)
+
+const (
+	Usage = `gospal is a tool for static analysis of Go programs.
+
+Usage:
+
+  gospal command [arguments]
+
+Commands:
+
+  check     infer MiGo types of each entry point and check for deadlocks
+  debug-fn  dump the SSA, store and MiGo of the blocks of a function
+  lsp       run the Language Server Protocol server on stdin/stdout
+  repl      infer MiGo types once and query the results interactively
+  rpc       run the JSON-RPC backend for editor extensions on stdin/stdout
+  serve     serve the analysis of modules over HTTP, with jobs and caching
+
+`
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, Usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "check":
+		ok, err := check(os.Stdout, os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gospal check: %v\n", err)
+			os.Exit(2)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case "debug-fn":
+		if err := debugFn(os.Stdout, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "gospal debug-fn: %v\n", err)
+			os.Exit(2)
+		}
+	case "lsp":
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "repl":
+		if err := repl(os.Stdin, os.Stdout, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "gospal repl: %v\n", err)
+			os.Exit(2)
+		}
+	case "rpc":
+		if err := rpc.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "serve":
+		if err := serve(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "gospal serve: %v\n", err)
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "gospal: unknown command %q\n\n", os.Args[1])
+		fmt.Fprintf(os.Stderr, Usage)
+		os.Exit(2)
+	}
+}
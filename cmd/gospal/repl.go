@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+const replUsage = `Usage:
+
+  gospal repl [options] file.go [files.go...]
+  gospal repl [options] packages (e.g. ./... or import paths)
+
+Infers the MiGo types of the program once, then reads queries over the
+results from stdin, one per line (see help).
+
+Options:
+
+`
+
+const replHelp = `Queries:
+
+  funcs [name]       list MiGo definitions (containing name)
+  migo name          show MiGo definitions of function name, e.g. main.main
+  roles              list goroutines with their local session types
+  spawns [role]      list goroutines spawned (transitively) from role (default main.main)
+  chans              list channels with their creation sites
+  senders chan       list goroutines which send on chan (name or creation site)
+  receivers chan     list goroutines which receive from chan (name or creation site)
+  leaks              list goroutines which may leak
+  deadlocks          list deadlocks of the program
+  help               show this help
+  quit               exit
+`
+
+// repl analyses the program given by args, then answers the queries read
+// from r until quit or end of input, and writes the answers to w.
+func repl(r io.Reader, w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, replUsage)
+		fs.PrintDefaults()
+	}
+	entry := fs.String("entry", "", `Function to analyse from (format: (import/path).FuncName, empty means main.main)`)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conf := build.FromFiles(fs.Args()...).Default()
+	if build.IsPackagePattern(fs.Arg(0)) {
+		conf = build.FromPackages(fs.Args()...).Default()
+	}
+	info, err := conf.Build()
+	if err != nil {
+		return fmt.Errorf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.SetOutput(ioutil.Discard)
+	if *entry != "" {
+		inferer.SetEntryFunc(*entry)
+	}
+	inferer.Analyse()
+	q := &queries{inferer: inferer, sess: session.Extract(inferer.Env.Prog)}
+
+	s := bufio.NewScanner(r)
+	for fmt.Fprint(w, "> "); s.Scan(); fmt.Fprint(w, "> ") {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+		if err := q.run(w, fields[0], fields[1:]); err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+	}
+	fmt.Fprintln(w)
+	return s.Err()
+}
+
+// queries answers queries over the results of an analysis.
+type queries struct {
+	inferer *migoinfer.Inferer
+	sess    *session.Session
+}
+
+// run answers query cmd with arguments args.
+func (q *queries) run(w io.Writer, cmd string, args []string) error {
+	arg := strings.Join(args, " ")
+	switch cmd {
+	case "help":
+		fmt.Fprint(w, replHelp)
+	case "funcs":
+		for _, f := range q.inferer.Env.Prog.Funcs {
+			if strings.Contains(f.SimpleName(), arg) {
+				fmt.Fprintln(w, f.SimpleName())
+			}
+		}
+	case "migo":
+		if arg == "" {
+			return fmt.Errorf("missing function name")
+		}
+		found := false
+		for _, f := range q.inferer.Env.Prog.Funcs {
+			if f.SimpleName() == arg {
+				fmt.Fprint(w, f.String())
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no MiGo definition of %s (see funcs)", arg)
+		}
+	case "roles":
+		q.sess.WriteTo(w)
+	case "spawns":
+		if arg == "" {
+			arg = "main.main"
+		}
+		role := q.sess.Role(arg)
+		if role == nil {
+			return fmt.Errorf("no goroutine %s (see roles)", arg)
+		}
+		q.writeSpawns(w, role, "")
+	case "chans":
+		var names []string
+		for name := range q.inferer.Env.Chans {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, q.inferer.Env.Chans[name])
+		}
+	case "senders", "receivers":
+		ch, err := q.chanName(arg)
+		if err != nil {
+			return err
+		}
+		senders, receivers := q.sess.Endpoints(ch)
+		roles := senders
+		if cmd == "receivers" {
+			roles = receivers
+		}
+		for _, role := range roles {
+			fmt.Fprintln(w, role)
+		}
+	case "leaks":
+		q.inferer.WriteLeaks(w)
+	case "deadlocks":
+		if q.inferer.WriteDeadlocks(w) == 0 {
+			fmt.Fprintln(w, "no deadlock found")
+		}
+	default:
+		return fmt.Errorf("unknown query %q (see help)", cmd)
+	}
+	return nil
+}
+
+// writeSpawns writes the goroutines spawned from role, indented by depth,
+// with their spawn sites.
+func (q *queries) writeSpawns(w io.Writer, role *session.Role, indent string) {
+	for _, r := range q.sess.Roles {
+		if r.Spawner == role {
+			fmt.Fprintf(w, "%s%s\t%s\n", indent, r.Name, q.inferer.Env.Spawns[r.Def])
+			q.writeSpawns(w, r, indent+"  ")
+		}
+	}
+}
+
+// chanName returns the MiGo name of channel ch, given by name or by (a
+// suffix of) its creation site, e.g. main.go:12.
+func (q *queries) chanName(ch string) (string, error) {
+	if ch == "" {
+		return "", fmt.Errorf("missing channel")
+	}
+	if _, ok := q.inferer.Env.Chans[ch]; ok {
+		return ch, nil
+	}
+	var matched []string
+	for name, pos := range q.inferer.Env.Chans {
+		if pos == ch || strings.HasSuffix(pos, "/"+ch) || strings.HasPrefix(pos, ch+":") || strings.Contains(pos, "/"+ch+":") {
+			matched = append(matched, name)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("no channel %s (see chans)", ch)
+	case 1:
+		return matched[0], nil
+	}
+	sort.Strings(matched)
+	return "", fmt.Errorf("ambiguous channel %s: %s", ch, strings.Join(matched, ", "))
+}
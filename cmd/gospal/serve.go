@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/nickng/gospal/server"
+)
+
+const serveUsage = `Usage:
+
+  gospal serve [options]
+
+Serves the analysis of modules over HTTP: jobs submitted by module reference
+or archive are analysed by a pool of workers, and their MiGo programs and
+diagnostics are cached (see package server for the API).
+
+Options:
+
+`
+
+// serve runs the analysis server until it fails.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, serveUsage)
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	workers := fs.Int("workers", 1, "Number of jobs analysed concurrently")
+	dir := fs.String("dir", "", "Directory of the sources of the jobs (empty means the temporary directory)")
+	fs.Parse(args)
+
+	s := server.NewServer(*workers)
+	s.Dir = *dir
+	s.Log = os.Stderr
+	log.Printf("gospal serve: listening on %s", *addr)
+	return http.ListenAndServe(*addr, s)
+}
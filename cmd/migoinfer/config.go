@@ -0,0 +1,232 @@
+package main
+
+// Configuration file.
+//
+// The configuration file gospal.toml at the module root (or the file given by
+// -config) sets the default value of the command line flags, and is written
+// in a subset of TOML, one flag per line, e.g.
+//
+//	# Analysis configuration, reviewed with the code.
+//	tags = ["integration"]
+//	entry = "(example.com/server).Serve"
+//	skip = ["(example.com/server).logRequest"]
+//	exclude = ["*/mocks", "*.pb.go"]
+//	depth = 16
+//	format = "json"
+//	sarif = "gospal.sarif"
+//
+// Strings, integers, booleans and arrays of strings on one line (joined by
+// commas, so an element cannot contain a comma) are accepted as values, and a
+// comment can follow a value. Other TOML syntax (e.g. tables or multi-line
+// values) is rejected. Flags given on the command line override the
+// configuration file.
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ConfigFile is the filename of the configuration file.
+const ConfigFile = "gospal.toml"
+
+// findConfig returns the path of the configuration file in the current
+// directory or its parents up to the module root (with go.mod), or empty if
+// not found.
+func findConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ConfigFile)); err == nil {
+			return filepath.Join(dir, ConfigFile)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// parseConfig reads the flags of a configuration file from r, in order.
+func parseConfig(r io.Reader) ([][2]string, error) {
+	var flags [][2]string
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", line)
+		}
+		idx := strings.Index(text, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expecting key = value but got %q", line, s.Text())
+		}
+		key, value := strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+1:])
+		if !isBareKey(key) {
+			return nil, fmt.Errorf("line %d: expecting bare key but got %q", line, key)
+		}
+		v, err := parseValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", line, key, err)
+		}
+		flags = append(flags, [2]string{key, v})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// isBareKey returns true if key is a bare TOML key, i.e. letters, digits,
+// underscores and dashes.
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseValue returns the flag value of a TOML value, optionally followed by a
+// comment.
+func parseValue(value string) (string, error) {
+	v, rest, err := scanValue(value)
+	if err != nil {
+		return "", err
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %s after value", rest)
+	}
+	return v, nil
+}
+
+// scanValue scans a TOML value at the start of s, and returns its flag value
+// and the rest of s.
+func scanValue(s string) (string, string, error) {
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("missing value")
+	case s[0] == '[':
+		return scanArray(s)
+	case s[0] == '"' || s[0] == '\'':
+		return scanString(s)
+	}
+	end := strings.IndexAny(s, " \t#")
+	if end < 0 {
+		end = len(s)
+	}
+	v := s[:end]
+	if v != "true" && v != "false" {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return "", "", fmt.Errorf("expecting string, integer, boolean or array of strings but got %s", v)
+		}
+	}
+	return v, s[end:], nil
+}
+
+// scanString scans a basic ("...") or literal ('...') TOML string at the
+// start of s.
+func scanString(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''") {
+		return "", "", fmt.Errorf("multi-line strings are not supported")
+	}
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
+
+// scanArray scans a TOML array of strings at the start of s, and returns its
+// elements joined by commas. Elements containing commas are rejected, as the
+// flags are comma-separated.
+func scanArray(s string) (string, string, error) {
+	var elems []string
+	rest := strings.TrimSpace(s[1:])
+	for {
+		if rest == "" || rest[0] == '#' {
+			return "", "", fmt.Errorf("unterminated array %s (arrays must be on one line)", s)
+		}
+		if rest[0] == ']' {
+			return strings.Join(elems, ","), rest[1:], nil
+		}
+		if rest[0] != '"' && rest[0] != '\'' {
+			return "", "", fmt.Errorf("expecting string but got %s", rest)
+		}
+		elem, r, err := scanString(rest)
+		if err != nil {
+			return "", "", err
+		}
+		if strings.Contains(elem, ",") {
+			return "", "", fmt.Errorf("array element %q contains a comma", elem)
+		}
+		elems = append(elems, elem)
+		rest = strings.TrimSpace(r)
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = strings.TrimSpace(rest[1:])
+		case !strings.HasPrefix(rest, "]"):
+			return "", "", fmt.Errorf("expecting , or ] but got %s", rest)
+		}
+	}
+}
+
+// applyConfig sets the flags not given on the command line from the
+// configuration file path.
+func applyConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	flags, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, kv := range flags {
+		if kv[0] == "config" || flag.Lookup(kv[0]) == nil {
+			return fmt.Errorf("%s: unknown key %s", path, kv[0])
+		}
+		if !set[kv[0]] {
+			if err := flag.Set(kv[0], kv[1]); err != nil {
+				return fmt.Errorf("%s: %s: %v", path, kv[0], err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests parsing of the configuration file.
+func TestParseConfig(t *testing.T) {
+	config := `# Analysis configuration.
+tags = ["integration", 'e2e'] # Build tags.
+entry = "(example.com/server).Serve"
+exclude = ["*/mocks", "*.pb.go",]
+depth = 16 # Context depth.
+tests = true
+log = "gospal#1.log"
+sarif = 'C:\reports\gospal.sarif'
+`
+	flags, err := parseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("cannot parse config: %v", err)
+	}
+	expect := [][2]string{
+		{"tags", "integration,e2e"},
+		{"entry", "(example.com/server).Serve"},
+		{"exclude", "*/mocks,*.pb.go"},
+		{"depth", "16"},
+		{"tests", "true"},
+		{"log", "gospal#1.log"},
+		{"sarif", `C:\reports\gospal.sarif`},
+	}
+	if !reflect.DeepEqual(flags, expect) {
+		t.Errorf("Wrong flags:\nExpect:\t%v\nGot:\t%v\n", expect, flags)
+	}
+}
+
+// Tests that unsupported syntax is rejected.
+func TestParseConfigErrors(t *testing.T) {
+	for _, config := range []string{
+		`[analysis]`,
+		`tags`,
+		`"quoted key" = 1`,
+		`depth = 1.5`,
+		`depth = 16 16`,
+		`entry = "main.main`,
+		`entry = """main.main"""`,
+		`tags = ["a", "b"`,
+		`tags = ["a",`,
+		`tags = ["a,b"]`,
+		`tags = ["a" "b"]`,
+		`tags = [1, 2]`,
+		`entry =`,
+	} {
+		if flags, err := parseConfig(strings.NewReader(config)); err == nil {
+			t.Errorf("Expect error parsing %q but got %v", config, flags)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nickng/gospal/migoinfer"
+)
+
+// diff infers the MiGo programs of two revisions (or directories) given by
+// args, followed by the source files or package patterns (./... if none), and
+// writes the differences of their definitions to stdout. The exit status is 1
+// if the programs differ.
+func diff(args []string) {
+	if len(args) < 2 {
+		fatal("Usage: migoinfer [options] diff rev1|dir1 rev2|dir2 [files.go|packages]")
+	}
+	srcs := args[2:]
+	if len(srcs) == 0 {
+		srcs = []string{"./..."}
+	}
+	old, err := inferAt(args[0], srcs)
+	if err != nil {
+		fatal(err)
+	}
+	new, err := inferAt(args[1], srcs)
+	if err != nil {
+		fatal(err)
+	}
+	diffs := migoinfer.Diff(old, new)
+	for _, d := range diffs {
+		d.WriteTo(os.Stdout)
+	}
+	if len(diffs) > 0 {
+		exit(exitFindings)
+	}
+}
+
+// inferAt returns the inferer of the sources srcs in directory rev, or in a
+// worktree checked out at git revision rev if rev is not a directory. The
+// worktree is removed before inferAt returns.
+func inferAt(rev string, srcs []string) (*migoinfer.Inferer, error) {
+	dir := rev
+	if fi, err := os.Stat(rev); err != nil || !fi.IsDir() {
+		worktree, err := checkout(rev)
+		if err != nil {
+			return nil, fmt.Errorf("cannot check out %s: %v", rev, err)
+		}
+		defer removeWorktree(worktree)
+		prefix, err := exec.Command("git", "rev-parse", "--show-prefix").Output()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find path in repository: %v", err)
+		}
+		dir = filepath.Join(worktree, strings.TrimSpace(string(prefix)))
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, err
+	}
+	defer os.Chdir(wd)
+
+	info, err := buildConfig(srcs).Build()
+	if err != nil {
+		return nil, fmt.Errorf("build of %s failed: %v", rev, err)
+	}
+	inferer := migoinfer.New(info, logWriter)
+	setLogOptions(inferer)
+	configure(inferer)
+	inferer.SetOutput(ioutil.Discard)
+	inferer.Analyse()
+	return inferer, nil
+}
+
+// checkout checks out git revision rev in a temporary worktree, and returns
+// the directory of the worktree.
+func checkout(rev string) (string, error) {
+	worktree, err := ioutil.TempDir("", "gospal-diff-")
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "worktree", "add", "--detach", worktree, rev)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(worktree)
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return worktree, nil
+}
+
+// removeWorktree removes the temporary worktree.
+func removeWorktree(worktree string) {
+	exec.Command("git", "worktree", "remove", "--force", worktree).Run()
+	os.RemoveAll(worktree)
+}
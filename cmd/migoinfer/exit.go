@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa"
+)
+
+// Exit statuses of migoinfer.
+const (
+	exitClean    = 0 // No findings.
+	exitFindings = 1 // Findings over the failure thresholds.
+	exitError    = 2 // Analysis error.
+)
+
+// fatal logs v and exits with analysis error.
+func fatal(v ...interface{}) {
+	log.Print(v...)
+	exit(exitError)
+}
+
+// fatalf logs a formatted message and exits with analysis error.
+func fatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	exit(exitError)
+}
+
+// gating returns true if the exit status depends on the findings.
+func gating() bool {
+	return failOn != "" || maxNew >= 0
+}
+
+// gate writes the findings over the failure thresholds to stderr, and returns
+// false if there are any. The findings are the diagnostics of the rules in
+// -fail-on (all if empty) not in the baseline, and the threshold is the
+// maximum number of new findings.
+func gate(inferer *migoinfer.Inferer, info *ssa.Info) bool {
+	diags := diagnostics(inferer, info)
+	if failOn != "" {
+		var matched []diag.Diagnostic
+		for _, d := range diags {
+			if diag.MatchRule(d, strings.Split(failOn, ",")) {
+				matched = append(matched, d)
+			}
+		}
+		diags = matched
+	}
+	if baseline != "" {
+		f, err := os.Open(baseline)
+		if err != nil {
+			fatalf("Cannot open baseline: %v", err)
+		}
+		b, err := diag.ReadBaseline(f)
+		f.Close()
+		if err != nil {
+			fatalf("Cannot read baseline %s: %v", baseline, err)
+		}
+		diags = b.New(diags)
+	}
+	threshold := maxNew
+	if threshold < 0 {
+		threshold = 0
+	}
+	if len(diags) <= threshold {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "%d finding(s), at most %d allowed:\n", len(diags), threshold)
+	for _, d := range diags {
+		fmt.Fprintln(os.Stderr, d.String())
+	}
+	return false
+}
+
+// writeBaseline writes the baseline of all findings to file path.
+func writeBaseline(path string, inferer *migoinfer.Inferer, info *ssa.Info) {
+	f, err := os.Create(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := diag.NewBaseline(diagnostics(inferer, info)).WriteTo(f); err != nil {
+		fatalf("Cannot write baseline: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+// Resource limits.
+//
+// -p bounds the workers of the analysis and the CPUs used, and
+// -mem-limit bounds the heap size through the analysis budget (see
+// migoinfer.Budget). The heap size is unbounded by default, so the analysis
+// is not degraded silently. With -mem-limit=auto the limit is derived from the
+// memory limit of the cgroup of the process (e.g. a container of a CI
+// runner), so the analysis degrades instead of being killed.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// memFraction is the fraction of the cgroup memory limit used by default.
+const memFraction = 0.75
+
+// cgroupLimits are the files of the cgroup memory limit (v2 then v1).
+var cgroupLimits = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// sizeUnits are the multipliers of the size suffixes.
+var sizeUnits = []struct {
+	suffix string
+	mult   uint64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseSize parses a size in bytes with an optional unit, e.g. 512MiB or 2G.
+func parseSize(size string) (uint64, error) {
+	s := strings.TrimSpace(size)
+	mult := uint64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expecting e.g. 512MiB or 2G)", size)
+	}
+	return uint64(n * float64(mult)), nil
+}
+
+// cgroupMemLimit returns the memory limit of the cgroup of the process in
+// bytes, or 0 if unlimited or unknown.
+func cgroupMemLimit() uint64 {
+	for _, path := range cgroupLimits {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil || n >= 1<<62 { // "max" or no limit (v1).
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+// heapLimit returns the heap size the analysis is budgeted to in bytes (0
+// means unbounded), given by -budget-mem in MiB if set, or else -mem-limit.
+func heapLimit() uint64 {
+	if budgetMem > 0 {
+		return budgetMem << 20
+	}
+	switch memLimit {
+	case "auto":
+		return uint64(float64(cgroupMemLimit()) * memFraction)
+	case "", "0", "none":
+		return 0
+	}
+	n, err := parseSize(memLimit)
+	if err != nil {
+		fatalf("Invalid -mem-limit: %v", err)
+	}
+	return n
+}
+
+// setProcs bounds the CPUs used to the number of workers, if any.
+func setProcs() {
+	if parallel > 0 && parallel < runtime.NumCPU() {
+		runtime.GOMAXPROCS(parallel)
+	}
+}
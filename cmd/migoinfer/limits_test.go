@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Tests the heap limit given by -budget-mem and -mem-limit (unbounded by
+// default), with a cgroup memory limit of 1GiB.
+func TestHeapLimit(t *testing.T) {
+	cgroup := filepath.Join(t.TempDir(), "memory.max")
+	if err := ioutil.WriteFile(cgroup, []byte("1073741824\n"), 0644); err != nil {
+		t.Fatalf("cannot write cgroup limit: %v", err)
+	}
+	defer func(limits []string) { cgroupLimits = limits }(cgroupLimits)
+	cgroupLimits = []string{cgroup}
+	defer func(mem uint64, limit string) { budgetMem, memLimit = mem, limit }(budgetMem, memLimit)
+
+	tests := []struct {
+		budgetMem uint64
+		memLimit  string
+		expect    uint64
+	}{
+		{0, "auto", 768 << 20},
+		{0, "none", 0},
+		{0, "2G", 2 << 30},
+		{256, "auto", 256 << 20},
+		{256, "none", 256 << 20},
+		{256, "2G", 256 << 20},
+	}
+	if def := flag.Lookup("mem-limit").DefValue; def != "none" {
+		t.Errorf("Wrong default -mem-limit:\nExpect:\t%s\nGot:\t%s\n", "none", def)
+	}
+	for _, test := range tests {
+		budgetMem, memLimit = test.budgetMem, test.memLimit
+		if got := heapLimit(); got != test.expect {
+			t.Errorf("Wrong heap limit with -budget-mem=%d -mem-limit=%s:\nExpect:\t%d\nGot:\t%d\n",
+				test.budgetMem, test.memLimit, test.expect, got)
+		}
+	}
+}
+
+// Tests parsing of sizes with units.
+func TestParseSize(t *testing.T) {
+	for s, expect := range map[string]uint64{
+		"512MiB": 512 << 20,
+		"2G":     2 << 30,
+		"1.5KB":  1500,
+		"100":    100,
+	} {
+		if got, err := parseSize(s); err != nil || got != expect {
+			t.Errorf("Wrong size of %q:\nExpect:\t%d\nGot:\t%d (%v)\n", s, expect, got, err)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Errorf("Expect error parsing size %q", "lots")
+	}
+}
@@ -2,14 +2,38 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/nickng/gospal/callgraph"
+	"github.com/nickng/gospal/cfsm"
+	"github.com/nickng/gospal/coq"
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/escape"
+	"github.com/nickng/gospal/hb"
+	"github.com/nickng/gospal/metrics"
 	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/pluscal"
+	"github.com/nickng/gospal/pnml"
+	"github.com/nickng/gospal/race"
+	"github.com/nickng/gospal/report"
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/gospal/sqlite"
+	"github.com/nickng/gospal/ssa"
 	"github.com/nickng/gospal/ssa/build"
+	"github.com/nickng/gospal/sym"
+	"github.com/nickng/gospal/taint"
+	"github.com/nickng/gospal/uppaal"
 )
 
 const (
@@ -18,6 +42,11 @@ const (
 Usage:
 
   migoinfer [options] file.go [files.go...]
+  migoinfer [options] packages (e.g. ./... or import paths)
+  migoinfer [options] diff rev1|dir1 rev2|dir2 [files.go|packages]
+
+Exit status is 0 if clean, 1 if there are findings over the failure
+thresholds (see -fail-on and -max-findings-new), and 2 on analysis error.
 
 Options:
 
@@ -26,16 +55,156 @@ Options:
 
 var (
 	logPath   string
+	format    string
+	output    string
+	watchMode bool
+	watchHTTP string
 	showRaw   bool
+	stream    bool
 	entryFunc string
+	tests     bool
+	config    string
+	tags      string
+	include   string
+	exclude   string
+	depth     int
+	noModels  string
+	summaries string
+	skipFuncs string
+	chanDir   string
+	leaks     string
+	misuses   string
+	unused    string
+	lockOrder string
+	wgMisuses string
+	lifetimes string
+	silent    string
+	summarise bool
+	reuse     bool
+	unroll    int
+	buffers   string
+	check     bool
+	trace     bool
+	replay    string
+	races     string
+	escapes   string
+	taintSpec string
+	cgAlgo    string
+	cgOut     string
+	sarifOut  string
+	hbOut     string
+	sessOut   string
+	scrOut    string
+	choreoOut string
+	topoOut   string
+	uppaalOut string
+	pnmlOut   string
+	cfsmOut   string
+	plusDir   string
+	deadline  time.Duration
+	srcOut    string
+	sqlOut    string
+	verifier  string
+	specFile  string
+	prune     bool
+	smtCmd    string
+	parallel  int
+	budget    time.Duration
+	budgetMem uint64
+	memLimit  string
+	cpuProf   string
+	memProf   string
+	execTrace string
+	otel      string
+	stats     bool
+	statsHTTP string
 	logFile   string
+	verbose   bool
+	debug     bool
+	quiet     bool
+	logFormat string
+	logFunc   string
+	failOn    string
+	maxNew    int
+	baseline  string
+	baseOut   string
 	logWriter = ioutil.Discard
 )
 
 func init() {
 	flag.StringVar(&logPath, "log", "", "Specify analysis log file (use '-' for stderr)")
+	flag.BoolVar(&verbose, "v", false, "Log progress of the inference (to stderr)")
+	flag.BoolVar(&debug, "vv", false, "Log every step of the inference (to stderr)")
+	flag.BoolVar(&quiet, "q", false, "Log errors of the inference only")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of the log of the inference (text or json)")
+	flag.StringVar(&logFunc, "log-func", "", "Log verbosely (-v or -vv) only the inference of functions with name containing the string")
+	flag.StringVar(&output, "o", "", "Comma-separated files to write the results to, in the format given by the extension: .sarif (SARIF), .json (JSON), .html (report), .dot (choreography), .db or .sqlite (SQLite, with the sqlite3 command), .sql (SQL script to load into SQLite), .pnml (Petri net), .v (Gallina), otherwise MiGo in -format (use '-' for stdout)")
+	flag.BoolVar(&watchMode, "watch", false, "Watch the source files for changes, and infer MiGo again incrementally on each change (changes reported to stderr)")
+	flag.StringVar(&watchHTTP, "watch-http", "", "Serve the latest MiGo of -watch at address (e.g. localhost:8080), at / (text) and /delta (changes in JSON)")
+	flag.StringVar(&format, "format", "text", "Output format of the MiGo program (text, json for the MiGo program, diagnostics and source metadata of definitions, html for a self-contained report with topology, goroutine behaviours and diagnostics, or coq for Gallina terms for the Coq proof assistant)")
 	flag.BoolVar(&showRaw, "raw", false, "Show raw unfiltered MiGo")
+	flag.BoolVar(&stream, "stream", false, "Write MiGo definitions to stdout as they are inferred instead of building the program in memory (raw, text format only, without -o, and disables analyses of the program such as -check)")
 	flag.StringVar(&entryFunc, "entry", "", `Specify the function to view (format: (import/path).FuncName, empty means main.main)`)
+	flag.StringVar(&config, "config", "", "Read default flags from configuration file (empty means "+ConfigFile+" in the current directory or its parents up to the module root)")
+	flag.StringVar(&tags, "tags", "", "Comma-separated build tags to satisfy when selecting files of packages")
+	flag.StringVar(&include, "include", "", `Comma-separated glob patterns of packages or files whose functions are analysed, others are treated as not communicating (e.g. "example.com/app/...")`)
+	flag.StringVar(&exclude, "exclude", "", `Comma-separated glob patterns of packages or files whose functions are treated as not communicating instead of analysed (e.g. "*/mocks,*.pb.go")`)
+	flag.IntVar(&depth, "depth", 0, "Maximum number of calls in the context of a function analysed separately, deeper calls to functions analysed already reuse their definition (0 means unbounded); approximations reported to stderr")
+	flag.BoolVar(&tests, "tests", false, "Also analyse the tests of packages (when given package patterns)")
+	flag.StringVar(&noModels, "no-model", "", `Comma-separated library functions to analyse instead of using builtin models (format: (import/path).FuncName)`)
+	flag.StringVar(&summaries, "summaries", "", "Comma-separated summary files (JSON, or YAML with extension .yaml or .yml) declaring the channel operations and spawns of external functions")
+	flag.StringVar(&chanDir, "chandir", "", "Write channel parameter directions of MiGo definitions to file (use '-' for stderr)")
+	flag.StringVar(&leaks, "leaks", "", "Write goroutines which may leak to file (use '-' for stderr)")
+	flag.StringVar(&misuses, "chanmisuse", "", "Write channel misuses (double close, send on closed, close by receiver, receive never sent) to file (use '-' for stderr)")
+	flag.StringVar(&unused, "unused", "", "Write channels never received from or never sent to to file (use '-' for stderr)")
+	flag.StringVar(&lockOrder, "lockorder", "", "Write cycles of the lock-order graph (locks acquired in inconsistent orders) with acquisition stacks to file (use '-' for stderr)")
+	flag.StringVar(&wgMisuses, "wgmisuse", "", "Write WaitGroup misuses (Add concurrent with Wait, Done without Add, Add after Wait) to file (use '-' for stderr)")
+	flag.StringVar(&lifetimes, "lifetime", "", "Write lifetime of each goroutine (spawn site, channels, WaitGroups and contexts which can end it, and whether it can return) to file, or JSON if the file ends with .json (use '-' for stdout)")
+	flag.StringVar(&silent, "silent", "", "Write spawns of goroutines which do not communicate (no channel, lock or spawn operations) to file (use '-' for stderr)")
+	flag.BoolVar(&summarise, "summarise-silent", false, "Do not analyse goroutines which do not communicate, to shrink the inferred MiGo")
+	flag.BoolVar(&reuse, "reuse-summaries", false, "Reuse the MiGo definition of a function across calls in contexts which differ only in bindings the function does not use")
+	flag.IntVar(&unroll, "unroll", migoinfer.DefaultUnrollLimit, "Maximum number of iterations unrolled of a loop with a constant number of iterations creating a channel per iteration, e.g. stored in a slice of channels (below 2 disables unrolling, loops with more iterations are reported)")
+	flag.StringVar(&buffers, "buffers", "", "Write the smallest buffer size of each buffered channel which does not introduce deadlocks (load-bearing or insufficient buffers) to file (use '-' for stderr)")
+	flag.BoolVar(&check, "check", false, "Check the inferred MiGo for global and partial deadlocks, and panics on channels (report to stderr)")
+	flag.BoolVar(&trace, "trace", false, "Show the trace leading to each deadlock found by -check, mapped to the source")
+	flag.StringVar(&replay, "replay", "", "Replay trace of MiGo actions in file (e.g. counterexample of external checker) onto the source (report to stderr)")
+	flag.StringVar(&races, "races", "", "Write possible data races to file (use '-' for stderr)")
+	flag.StringVar(&escapes, "escape", "", "Write goroutines and packages each channel escapes to to file (use '-' for stderr)")
+	flag.StringVar(&taintSpec, "taint", "", "Report flows from sources to sinks declared in taint specification file (report to stderr)")
+	flag.StringVar(&cgAlgo, "callgraph", "", "Resolve dynamic calls with callgraph built by algorithm (static, cha, rta or pta)")
+	flag.StringVar(&cgOut, "callgraph-out", "", "Write callgraph to file in dot format, or JSON if the file ends with .json (use '-' for stdout)")
+	flag.StringVar(&sarifOut, "sarif", "", "Write goroutine leaks, deadlocks, and channel misuses, unused endpoints, lock-order cycles, WaitGroup misuses, races and taint flows (if enabled) to file in SARIF format (use '-' for stdout)")
+	flag.StringVar(&hbOut, "hb", "", "Write happens-before graph of synchronisation events to file in dot format (use '-' for stdout)")
+	flag.StringVar(&sessOut, "session", "", "Write local session types of goroutines, and global protocol if synthesisable, to file (use '-' for stdout)")
+	flag.StringVar(&scrOut, "scribble", "", "Write global protocol (if synthesisable) and local protocols of goroutines in Scribble to file, e.g. session.scr (use '-' for stdout)")
+	flag.StringVar(&topoOut, "topology", "", "Write communication topology (goroutine spawns, and creator, senders and receivers of each channel, with positions) to file in dot format (use '-' for stdout)")
+	flag.StringVar(&uppaalOut, "uppaal", "", "Write timed automata of goroutines, with one-shot timers as clocks, to file in UPPAAL XML format (use '-' for stdout)")
+	flag.DurationVar(&deadline, "uppaal-deadline", 0, "Add UPPAAL query that main terminates within duration (e.g. 5s)")
+	flag.StringVar(&pnmlOut, "pnml", "", "Write Petri net of goroutines and channel occupancy to file in PNML format (use '-' for stdout)")
+	flag.StringVar(&cfsmOut, "cfsm", "", "Write communicating finite state machine of each goroutine to file in fsa format, or dot format if the file ends with .dot (use '-' for stdout); see package cfsm for the format")
+	flag.StringVar(&plusDir, "pluscal", "", "Write PlusCal algorithm (Name.tla) and TLC configuration with deadlock check (Name.cfg) of each entry point to directory")
+	flag.StringVar(&srcOut, "srcmap", "", "Write source map linking MiGo definitions, spawns, branch conditions, channels and channel operations to their Go source spans, as a JSON sidecar of any output format (use '-' for stdout)")
+	flag.StringVar(&sqlOut, "sqlite", "", "Write channels, goroutines, communications, definitions and diagnostics to SQLite database file (with the sqlite3 command), or SQL script if the file ends with .sql (use '-' for stdout); see package sqlite for the schema")
+	flag.StringVar(&choreoOut, "choreo", "", "Write global choreography graph (roles, channels between them and phases) to file in dot format, or interactive HTML if the file ends with .html (use '-' for stdout)")
+	flag.StringVar(&verifier, "verify", "", `Verify with external tool gong (liveness and safety of MiGo) or kittel (termination of loops), optionally with its command line, e.g. "gong=/opt/gong/Gong -T" (report to stderr, exit status 1 if a property is not shown)`)
+	flag.StringVar(&specFile, "conform", "", "Check local session types of goroutines against protocol specification file (report to stderr, exit status 1 on deviation)")
+	flag.BoolVar(&prune, "prune", false, "Prune branches infeasible given dominating branch conditions and constant arguments")
+	flag.StringVar(&smtCmd, "smt", "", `Prune infeasible branches with external SMT-LIB 2 solver command (e.g. "z3 -in")`)
+	flag.IntVar(&parallel, "p", 0, "Analyse the entry points with N workers and at most N CPUs (0 analyses serially with all CPUs); the output does not depend on N")
+	flag.DurationVar(&budget, "budget-time", 0, "Degrade analysis to finish within wall-clock time (e.g. 30s, 0 means unbounded); approximations reported to stderr")
+	flag.Uint64Var(&budgetMem, "budget-mem", 0, "Degrade analysis to keep heap size within MiB, overriding -mem-limit (0 means -mem-limit); approximations reported to stderr")
+	flag.StringVar(&memLimit, "mem-limit", "none", "Degrade analysis to keep heap size within limit (e.g. 512MiB or 2G, none means unbounded, auto means 75% of the cgroup memory limit if any); approximations reported to stderr")
+	flag.StringVar(&cpuProf, "cpuprofile", "", "Write CPU profile of the analysis to file (see go tool pprof)")
+	flag.StringVar(&memProf, "memprofile", "", "Write heap profile at the end of the analysis to file (see go tool pprof)")
+	flag.StringVar(&execTrace, "exectrace", "", "Write execution trace of the analysis to file (see go tool trace)")
+	flag.StringVar(&otel, "otel", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "Export OpenTelemetry spans of the analysis phases to an OTLP/HTTP collector (http:// or https:// URL, default $OTEL_EXPORTER_OTLP_ENDPOINT) or to file in OTLP/JSON")
+	flag.BoolVar(&stats, "stats", false, "Show counters and timings of the analysis phases (report to stderr)")
+	flag.StringVar(&statsHTTP, "stats-http", "", "Serve counters and timings during the analysis at address (e.g. localhost:6060), at /debug/vars (expvar) and /metrics (Prometheus)")
+	flag.StringVar(&failOn, "fail-on", "", `Comma-separated rules of findings which fail the run with exit status 1, by code, identifier or last word (e.g. "GSP0001,deadlock,leak")`)
+	flag.IntVar(&maxNew, "max-findings-new", -1, "Fail the run with exit status 1 if there are more findings not in the baseline (-1 means no threshold unless -fail-on is set)")
+	flag.StringVar(&baseline, "baseline", "", "Read pre-existing findings (not counted by -fail-on and -max-findings-new) from baseline file")
+	flag.StringVar(&baseOut, "write-baseline", "", "Write all findings to baseline file")
+	flag.StringVar(&skipFuncs, "skip", "", `Comma-separated functions to treat as not communicating (format: (import/path).FuncName)`)
 }
 
 func main() {
@@ -43,10 +212,40 @@ func main() {
 	if flag.NArg() == 0 {
 		fmt.Fprintf(os.Stderr, Usage)
 		flag.PrintDefaults()
-		os.Exit(0)
+		os.Exit(exitClean)
+	}
+	if config == "" {
+		config = findConfig()
 	}
+	if config != "" {
+		if err := applyConfig(config); err != nil {
+			fatalf("Cannot read configuration: %v", err)
+		}
+	}
+
+	checkSQLite()
+	setProcs()
+	startProfiling()
+	startTracing()
+	defer func() { stopProfiling() }()
 
-	conf := build.FromFiles(flag.Args()...).Default()
+	if statsHTTP != "" {
+		http.Handle("/metrics", metrics.Handler())
+		go func() {
+			fatal(http.ListenAndServe(statsHTTP, nil))
+		}()
+	}
+	if stats {
+		defer metrics.WriteSummary(os.Stderr)
+	}
+	if flag.Arg(0) == "diff" {
+		diff(flag.Args()[1:])
+		return
+	}
+	if watchMode {
+		watch(flag.Args(), watchHTTP)
+	}
+	conf := buildConfig(flag.Args())
 	switch logPath {
 	case "":
 	case "-":
@@ -55,7 +254,7 @@ func main() {
 	default:
 		f, err := os.Create(logPath)
 		if err != nil {
-			log.Fatalf("Cannot create log %s: %v", logPath, err)
+			fatalf("Cannot create log %s: %v", logPath, err)
 		}
 		defer f.Close()
 		conf = conf.WithBuildLog(f, log.LstdFlags)
@@ -64,18 +263,822 @@ func main() {
 	}
 	info, err := conf.Build()
 	if err != nil {
-		log.Fatal("Build failed:", err)
+		fatal("Build failed:", err)
 	}
 	inferer := migoinfer.New(info, logWriter)
+	setLogOptions(inferer)
+	configure(inferer)
+	if cgAlgo != "" {
+		algo, err := callgraph.ParseAlgo(cgAlgo)
+		if err != nil {
+			fatal(err)
+		}
+		g, err := callgraph.Build(info, algo)
+		if err != nil {
+			fatalf("Cannot build callgraph: %v", err)
+		}
+		inferer.SetCallGraph(g)
+		if cgOut != "" {
+			writeCallGraph(g, cgOut)
+		}
+	}
+	var migoBuf bytes.Buffer
+	switch {
+	case format != "text" && format != "json" && format != "html" && format != "coq":
+		fatalf("Unknown output format %s (expecting text, json, html or coq)", format)
+	case stream && (format != "text" || output != ""):
+		fatalf("-stream writes MiGo text to stdout, and cannot be used with -format other than text or -o")
+	case format == "text" && output == "":
+		inferer.SetOutput(os.Stdout)
+	default:
+		inferer.SetOutput(&migoBuf)
+	}
+	if showRaw {
+		inferer.Raw = true
+	}
+	inferer.SummariseSilent(summarise)
+	inferer.ReuseSummaries(reuse)
+	inferer.SetUnrollLimit(unroll)
+	inferer.Stream(stream)
+	if parallel > 1 {
+		inferer.AnalyseParallel(parallel)
+	} else {
+		inferer.Analyse()
+	}
+	if len(inferer.Approximations()) > 0 {
+		fmt.Fprintln(os.Stderr, "Calls analysed with degraded precision (budget or context depth):")
+		inferer.WriteApproximations(os.Stderr)
+	}
+	if len(inferer.TruncatedUnrolls()) > 0 {
+		fmt.Fprintln(os.Stderr, "Loops unrolled up to the unroll limit:")
+		inferer.WriteTruncatedUnrolls(os.Stderr)
+	}
+	if chanDir != "" {
+		writeFile(chanDir, inferer.WriteChanDirs)
+	}
+	if leaks != "" {
+		writeFile(leaks, inferer.WriteLeaks)
+	}
+	if misuses != "" {
+		writeFile(misuses, inferer.WriteChanMisuses)
+	}
+	if unused != "" {
+		writeFile(unused, inferer.WriteUnusedEndpoints)
+	}
+	switch {
+	case check && trace:
+		inferer.WriteDeadlockTraces(os.Stderr)
+	case check:
+		inferer.WriteDeadlocks(os.Stderr)
+	}
+	if buffers != "" {
+		writeFile(buffers, inferer.WriteBuffers)
+	}
+	if replay != "" {
+		f, err := os.Open(replay)
+		if err != nil {
+			fatalf("Cannot open trace: %v", err)
+		}
+		defer f.Close()
+		if err := inferer.ReplayTrace(f, os.Stderr); err != nil {
+			fatalf("Cannot replay trace %s: %v", replay, err)
+		}
+	}
+	if races != "" {
+		writeFile(races, func(w io.Writer) { writeRaces(w, info) })
+	}
+	if escapes != "" {
+		writeFile(escapes, func(w io.Writer) { writeEscapes(w, info) })
+	}
+	if taintSpec != "" {
+		writeFlows(os.Stderr, info, taintSpec)
+	}
+	if hbOut != "" {
+		writeHB(hbOut, info)
+	}
+	if sessOut != "" {
+		writeSession(sessOut, inferer)
+	}
+	if scrOut != "" {
+		writeScribble(scrOut, inferer)
+	}
+	if topoOut != "" {
+		writeTopology(topoOut, inferer)
+	}
+	if uppaalOut != "" {
+		writeUPPAAL(uppaalOut, inferer)
+	}
+	if pnmlOut != "" {
+		writePNML(pnmlOut, inferer)
+	}
+	if cfsmOut != "" {
+		writeCFSM(cfsmOut, inferer)
+	}
+	if plusDir != "" {
+		writePlusCal(plusDir, inferer)
+	}
+	if srcOut != "" {
+		writeSourceMap(srcOut, inferer)
+	}
+	if sqlOut != "" {
+		writeSQLite(sqlOut, inferer, info)
+	}
+	if choreoOut != "" {
+		writeChoreography(choreoOut, inferer)
+	}
+	if silent != "" {
+		writeFile(silent, inferer.WriteSilentGoroutines)
+	}
+	if lockOrder != "" {
+		writeFile(lockOrder, inferer.WriteLockCycles)
+	}
+	if wgMisuses != "" {
+		writeWaitGroupMisuses(wgMisuses, info)
+	}
+	if lifetimes != "" {
+		writeLifetimes(lifetimes, info)
+	}
+	if sarifOut != "" {
+		writeSARIF(sarifOut, inferer, info)
+	}
+	switch {
+	case output != "":
+		for _, path := range strings.Split(output, ",") {
+			if path != "" {
+				writeOutput(path, migoBuf.String(), inferer, info)
+			}
+		}
+	case format == "json":
+		writeJSON(os.Stdout, migoBuf.String(), inferer, info)
+	case format == "html":
+		writeReport(os.Stdout, inferer, info)
+	case format == "coq":
+		writeCoq(os.Stdout, inferer)
+	}
+	if baseOut != "" {
+		writeBaseline(baseOut, inferer, info)
+	}
+	if gating() && !gate(inferer, info) {
+		if stats {
+			metrics.WriteSummary(os.Stderr)
+		}
+		exit(exitFindings)
+	}
+	if verifier != "" {
+		if v := verify(inferer, verifier); !v.Holds() {
+			if stats {
+				metrics.WriteSummary(os.Stderr)
+			}
+			exit(exitFindings)
+		}
+	}
+	if specFile != "" {
+		if devs := conform(inferer, specFile); len(devs) > 0 {
+			for _, d := range devs {
+				fmt.Fprintln(os.Stderr, d.String())
+			}
+			if stats {
+				metrics.WriteSummary(os.Stderr)
+			}
+			exit(exitFindings)
+		}
+	}
+}
+
+// buildConfig returns the build configuration of the source files or package
+// patterns args.
+func buildConfig(args []string) build.Configurer {
+	conf := build.FromFiles(args...).Default()
+	if len(args) > 0 && build.IsPackagePattern(args[0]) {
+		conf = build.FromPackages(args...).Default().WithTests(tests)
+	}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag != "" {
+			conf = conf.WithBuildTags(tag)
+		}
+	}
+	return conf
+}
+
+// setLogOptions sets the options of the log of the inference given by flags.
+func setLogOptions(inferer *migoinfer.Inferer) {
+	opts := migoinfer.LogOptions{Level: migoinfer.Normal, Func: logFunc}
+	switch {
+	case quiet:
+		opts.Level = migoinfer.Quiet
+	case debug:
+		opts.Level = migoinfer.Debug
+	case verbose:
+		opts.Level = migoinfer.Verbose
+	}
+	switch logFormat {
+	case "text":
+	case "json":
+		opts.JSON = true
+	default:
+		fatalf("Unknown log format %s (expecting text or json)", logFormat)
+	}
 	if logFile != "" {
-		inferer.AddLogFiles(logFile)
+		opts.Files = []string{logFile}
 	}
+	inferer.SetLogOptions(opts)
+}
+
+// splitList returns the non-empty elements of comma-separated list s.
+func splitList(s string) []string {
+	var elems []string
+	for _, elem := range strings.Split(s, ",") {
+		if elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// configure sets the options of the inference given by flags.
+func configure(inferer *migoinfer.Inferer) {
 	if entryFunc != "" {
 		inferer.SetEntryFunc(entryFunc)
 	}
-	inferer.SetOutput(os.Stdout)
-	if showRaw {
-		inferer.Raw = true
+	inferer.SetTests(tests)
+	inferer.SetBudget(budget, heapLimit())
+	inferer.SetContextDepth(depth)
+	for _, name := range strings.Split(noModels, ",") {
+		if name != "" {
+			inferer.DisableModel(name)
+		}
+	}
+	for _, file := range splitList(summaries) {
+		sums, err := migoinfer.ReadSummaries(file)
+		if err != nil {
+			fatalf("Cannot read summaries: %v", err)
+		}
+		inferer.AddSummaries(sums)
+	}
+	inferer.SetFilter(splitList(include), splitList(exclude))
+	for _, name := range strings.Split(skipFuncs, ",") {
+		if name != "" {
+			inferer.SkipFunc(name)
+		}
+	}
+	switch {
+	case smtCmd != "":
+		inferer.SetSolver(sym.NewSMTLIB(smtCmd))
+	case prune:
+		inferer.SetSolver(sym.Intervals{})
+	}
+}
+
+// openOutput creates file path for writing results, or returns stdout if path
+// is '-' (closing stdout is a no-op).
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return stdout{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// stdout is an output (stdout or stderr) which is not closed.
+type stdout struct{ io.Writer }
+
+func (stdout) Close() error { return nil }
+
+// openReport creates file path for writing a side report (e.g. -leaks), or
+// returns stderr if path is '-', so the report does not mix with the results
+// written to stdout (closing stderr is a no-op).
+func openReport(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return stdout{os.Stderr}, nil
+	}
+	return os.Create(path)
+}
+
+// writeFile writes a side report to file path (see openReport) with write.
+func writeFile(path string, write func(w io.Writer)) {
+	w, err := openReport(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	write(w)
+}
+
+// writeSARIF writes the diagnostics of the checks enabled to file path in
+// SARIF format.
+func writeSARIF(path string, inferer *migoinfer.Inferer, info *ssa.Info) {
+	diags := diagnostics(inferer, info)
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	wd, _ := os.Getwd()
+	sarif := diag.SARIF{Tool: "gospal", ToolURI: "https://github.com/nickng/gospal", BaseDir: wd}
+	if err := sarif.Write(w, diags); err != nil {
+		fatalf("Cannot write SARIF: %v", err)
+	}
+}
+
+// writeOutput writes the results of the analysis to file path, in the format
+// given by the extension of path.
+func writeOutput(path, migo string, inferer *migoinfer.Inferer, info *ssa.Info) {
+	switch filepath.Ext(path) {
+	case ".sarif":
+		writeSARIF(path, inferer, info)
+		return
+	case ".dot":
+		writeChoreography(path, inferer)
+		return
+	case ".db", ".sqlite", ".sql":
+		writeSQLite(path, inferer, info)
+		return
+	case ".pnml":
+		writePNML(path, inferer)
+		return
+	}
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	switch {
+	case filepath.Ext(path) == ".html", filepath.Ext(path) == "" && format == "html":
+		writeReport(w, inferer, info)
+		return
+	case filepath.Ext(path) == ".json", format == "json":
+		writeJSON(w, migo, inferer, info)
+		return
+	case filepath.Ext(path) == ".v", filepath.Ext(path) == "" && format == "coq":
+		writeCoq(w, inferer)
+		return
+	}
+	if _, err := io.WriteString(w, migo); err != nil {
+		fatalf("Cannot write MiGo: %v", err)
+	}
+}
+
+// writeCoq writes the MiGo program to w in Gallina (see package coq).
+func writeCoq(w io.Writer, inferer *migoinfer.Inferer) {
+	if err := coq.Write(w, inferer.Env.Prog); err != nil {
+		fatalf("Cannot write Gallina: %v", err)
+	}
+}
+
+// writeJSON writes the MiGo program, the source metadata of its definitions
+// and the diagnostics of the checks enabled to w as a JSON document.
+func writeJSON(w io.Writer, migo string, inferer *migoinfer.Inferer, info *ssa.Info) {
+	doc := struct {
+		Schema      int                    `json:"schemaVersion"`
+		MiGo        string                 `json:"migo"`
+		Definitions []migoinfer.Definition `json:"definitions"`
+		Diagnostics []diag.Diagnostic      `json:"diagnostics"`
+	}{
+		Schema:      diag.SchemaVersion,
+		MiGo:        migo,
+		Definitions: inferer.Definitions(),
+		Diagnostics: diagnostics(inferer, info),
+	}
+	if doc.Diagnostics == nil {
+		doc.Diagnostics = []diag.Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		fatalf("Cannot write JSON: %v", err)
+	}
+}
+
+// writeReport writes a self-contained HTML report of the analysis to w, with
+// the communication topology, the behaviour of each goroutine and the
+// diagnostics of the checks enabled.
+func writeReport(w io.Writer, inferer *migoinfer.Inferer, info *ssa.Info) {
+	sess := session.Extract(inferer.Env.Prog)
+	r := report.Report{
+		Title:       "gospal: " + strings.Join(flag.Args(), " "),
+		Topology:    sess.Choreography(),
+		Diagnostics: diagnostics(inferer, info),
+	}
+	for _, role := range sess.Roles {
+		g := report.Goroutine{
+			Name:      role.Name,
+			Spawn:     inferer.Env.Spawns[role.Def],
+			Behaviour: role.Type.String(),
+		}
+		for _, f := range inferer.Env.Prog.Funcs {
+			if f.SimpleName() == role.Def {
+				g.MiGo = f.String()
+			}
+		}
+		r.Goroutines = append(r.Goroutines, g)
+	}
+	if err := r.WriteHTML(w); err != nil {
+		fatalf("Cannot write report: %v", err)
+	}
+}
+
+// collected are the diagnostics of the checks enabled, once collected.
+var collected *[]diag.Diagnostic
+
+// diagnostics returns the diagnostics of the checks enabled, sorted by
+// position. The checks are run once.
+func diagnostics(inferer *migoinfer.Inferer, info *ssa.Info) []diag.Diagnostic {
+	if collected != nil {
+		return *collected
+	}
+	diags := inferer.LeakDiagnostics()
+	diags = append(diags, inferer.DeadlockDiagnostics(inferer.Bounds)...)
+	diags = append(diags, inferer.UnrollDiagnostics()...)
+	if misuses != "" {
+		diags = append(diags, inferer.ChanMisuseDiagnostics()...)
+	}
+	if unused != "" {
+		diags = append(diags, inferer.UnusedEndpointDiagnostics()...)
+	}
+	if lockOrder != "" {
+		diags = append(diags, inferer.LockCycleDiagnostics()...)
+	}
+	if wgMisuses != "" {
+		for _, m := range waitGroupMisuses(info) {
+			diags = append(diags, m.Diagnostic())
+		}
+	}
+	if races != "" {
+		rs, err := race.Check(info)
+		if err != nil {
+			fatalf("Race detection failed: %v", err)
+		}
+		for _, r := range rs {
+			diags = append(diags, r.Diagnostic())
+		}
+	}
+	if taintSpec != "" {
+		for _, flow := range taintFlows(info, taintSpec) {
+			diags = append(diags, flow.Diagnostic())
+		}
+	}
+	if specFile != "" {
+		for _, d := range conform(inferer, specFile) {
+			diags = append(diags, d.Diagnostic())
+		}
+	}
+	if verifier != "" {
+		diags = append(diags, verify(inferer, verifier).Diagnostics()...)
+	}
+	diags = diag.Suppress(diags, info.Directives.Ignored)
+	diag.Sort(diags)
+	collected = &diags
+	return diags
+}
+
+// writeRaces writes the possible data races in the program to w.
+func writeRaces(w io.Writer, info *ssa.Info) {
+	rs, err := race.Check(info)
+	if err != nil {
+		fatalf("Race detection failed: %v", err)
+	}
+	for _, r := range rs {
+		fmt.Fprintln(w, r)
+	}
+}
+
+// writeEscapes writes the escape summaries of the channels in the program to w.
+func writeEscapes(w io.Writer, info *ssa.Info) {
+	es, err := escape.Analyse(info)
+	if err != nil {
+		fatalf("Escape analysis failed: %v", err)
+	}
+	for _, e := range es {
+		fmt.Fprintln(w, e)
+	}
+}
+
+// writeFlows writes the flows of tainted values in the program, as specified
+// by the file spec, to w.
+func writeFlows(w io.Writer, info *ssa.Info, spec string) {
+	for _, flow := range taintFlows(info, spec) {
+		fmt.Fprintln(w, flow)
+	}
+}
+
+// taintFlows returns the flows of tainted values in the program, as specified
+// by the file spec.
+func taintFlows(info *ssa.Info, spec string) []taint.Flow {
+	f, err := os.Open(spec)
+	if err != nil {
+		fatalf("Cannot open %s: %v", spec, err)
+	}
+	defer f.Close()
+	s, err := taint.ParseSpec(f)
+	if err != nil {
+		fatalf("Cannot parse %s: %v", spec, err)
+	}
+	flows, err := taint.Analyse(info, s)
+	if err != nil {
+		fatalf("Taint analysis failed: %v", err)
+	}
+	return flows
+}
+
+// waitGroupMisuses returns the misuses of the WaitGroups of the program.
+func waitGroupMisuses(info *ssa.Info) []hb.WaitGroupMisuse {
+	g, err := hb.Build(info)
+	if err != nil {
+		fatalf("Cannot build happens-before graph: %v", err)
+	}
+	return g.WaitGroupMisuses()
+}
+
+// writeWaitGroupMisuses writes the misuses of the WaitGroups of the program to
+// file path.
+func writeWaitGroupMisuses(path string, info *ssa.Info) {
+	writeFile(path, func(w io.Writer) {
+		for _, m := range waitGroupMisuses(info) {
+			fmt.Fprintln(w, m.String())
+		}
+	})
+}
+
+// writeLifetimes writes the lifetimes of the goroutines of the program to file
+// path.
+func writeLifetimes(path string, info *ssa.Info) {
+	g, err := hb.Build(info)
+	if err != nil {
+		fatalf("Cannot build happens-before graph: %v", err)
+	}
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	write := g.WriteLifetimes
+	if strings.HasSuffix(path, ".json") {
+		write = g.WriteLifetimesJSON
+	}
+	if err := write(w); err != nil {
+		fatalf("Cannot write goroutine lifetimes: %v", err)
+	}
+}
+
+// writeHB writes the happens-before graph of the program to file path.
+func writeHB(path string, info *ssa.Info) {
+	g, err := hb.Build(info)
+	if err != nil {
+		fatalf("Cannot build happens-before graph: %v", err)
+	}
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if err := g.WriteDot(w); err != nil {
+		fatalf("Cannot write happens-before graph: %v", err)
+	}
+}
+
+// writeSession writes the local session types of the inferred MiGo program,
+// and its global protocol (or why it cannot be synthesised), to file path.
+func writeSession(path string, inferer *migoinfer.Inferer) {
+	sess := session.Extract(inferer.Env.Prog)
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if _, err := sess.WriteTo(w); err != nil {
+		fatalf("Cannot write session types: %v", err)
+	}
+	if g, err := sess.Synthesise(); err != nil {
+		fmt.Fprintf(w, "global: none (%v)\n", err)
+	} else {
+		fmt.Fprintf(w, "global: %s\n", g)
+	}
+}
+
+// writeScribble writes the protocols of the session of the inferred MiGo
+// program to file path in Scribble, in the module named after the file.
+func writeScribble(path string, inferer *migoinfer.Inferer) {
+	module := "Session"
+	if path != "-" {
+		module = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if err := session.Extract(inferer.Env.Prog).WriteScribble(w, module, "Session"); err != nil {
+		fatalf("Cannot write Scribble: %v", err)
+	}
+}
+
+// writeTopology writes the communication topology of the program to file path
+// in dot format.
+func writeTopology(path string, inferer *migoinfer.Inferer) {
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if err := inferer.Topology().WriteDot(w); err != nil {
+		fatalf("Cannot write topology: %v", err)
+	}
+}
+
+// writeUPPAAL writes the timed automata of the program to file path in
+// UPPAAL XML format.
+func writeUPPAAL(path string, inferer *migoinfer.Inferer) {
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	m := &uppaal.Model{Prog: inferer.Env.Prog, Timers: make(map[string]time.Duration), Deadline: deadline}
+	for ch, timer := range inferer.Timers() {
+		if !timer.Ticker {
+			m.Timers[ch] = timer.Duration
+		}
+	}
+	if err := m.WriteXML(w); err != nil {
+		fatalf("Cannot write UPPAAL model: %v", err)
+	}
+}
+
+// writePNML writes the Petri net of the program to file path in PNML format.
+func writePNML(path string, inferer *migoinfer.Inferer) {
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if err := pnml.New(inferer.Env.Prog).WritePNML(w); err != nil {
+		fatalf("Cannot write Petri net: %v", err)
+	}
+}
+
+// writeCFSM writes the communicating finite state machines of the goroutines
+// to file path in fsa format, or dot format if path ends with .dot.
+func writeCFSM(path string, inferer *migoinfer.Inferer) {
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	sys := cfsm.New(inferer.Env.Prog)
+	write := sys.WriteFSA
+	if filepath.Ext(path) == ".dot" {
+		write = sys.WriteDot
+	}
+	if err := write(w); err != nil {
+		fatalf("Cannot write CFSMs: %v", err)
+	}
+}
+
+// writePlusCal writes the PlusCal algorithm and TLC configuration of each
+// entry point to directory dir.
+func writePlusCal(dir string, inferer *migoinfer.Inferer) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatalf("Cannot create %s: %v", dir, err)
+	}
+	for _, alg := range pluscal.Generate(inferer.Env.Prog) {
+		for ext, write := range map[string]func(io.Writer) error{".tla": alg.WriteTLA, ".cfg": alg.WriteCfg} {
+			path := filepath.Join(dir, alg.Name+ext)
+			f, err := os.Create(path)
+			if err != nil {
+				fatalf("Cannot create %s: %v", path, err)
+			}
+			err = write(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				fatalf("Cannot write %s: %v", path, err)
+			}
+		}
+	}
+}
+
+// writeSourceMap writes the source map of the MiGo program to file path.
+func writeSourceMap(path string, inferer *migoinfer.Inferer) {
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if _, err := inferer.SourceMap().WriteTo(w); err != nil {
+		fatalf("Cannot write source map: %v", err)
+	}
+}
+
+// checkSQLite exits if SQLite databases are to be written but the sqlite3
+// command is not found, rather than after the analysis.
+func checkSQLite() {
+	var dbs []string
+	for _, path := range strings.Split(output, ",") {
+		if ext := filepath.Ext(path); ext == ".db" || ext == ".sqlite" {
+			dbs = append(dbs, path)
+		}
+	}
+	if sqlOut != "" && sqlOut != "-" && filepath.Ext(sqlOut) != ".sql" {
+		dbs = append(dbs, sqlOut)
+	}
+	if len(dbs) == 0 {
+		return
+	}
+	if err := sqlite.CheckCommand(); err != nil {
+		fatalf("Cannot write SQLite database %s: %v", strings.Join(dbs, ", "), err)
+	}
+}
+
+// writeSQLite writes the results of the analysis to the SQLite database file
+// path, or as a SQL script if path is '-' or ends with .sql.
+func writeSQLite(path string, inferer *migoinfer.Inferer, info *ssa.Info) {
+	diags := diagnostics(inferer, info)
+	if path != "-" && filepath.Ext(path) != ".sql" {
+		if err := sqlite.Create(path, inferer, diags); err != nil {
+			fatalf("Cannot write SQLite database: %v", err)
+		}
+		return
+	}
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	if err := sqlite.Write(w, inferer, diags); err != nil {
+		fatalf("Cannot write SQL: %v", err)
+	}
+}
+
+// writeChoreography writes the choreography graph of the inferred MiGo program
+// to file path, in dot format or HTML.
+func writeChoreography(path string, inferer *migoinfer.Inferer) {
+	c := session.Extract(inferer.Env.Prog).Choreography()
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	write := c.WriteDot
+	if strings.HasSuffix(path, ".html") {
+		write = c.WriteHTML
+	}
+	if err := write(w); err != nil {
+		fatalf("Cannot write choreography: %v", err)
+	}
+}
+
+// verdict is the verdict of the external verifier, once run.
+var verdict *migoinfer.Verdict
+
+// verify runs the external verifier in spec (name, or name=command) on the
+// inferred MiGo program once, and writes its verdict to stderr.
+func verify(inferer *migoinfer.Inferer, spec string) *migoinfer.Verdict {
+	if verdict != nil {
+		return verdict
+	}
+	name, cmd := spec, ""
+	if i := strings.Index(spec, "="); i >= 0 {
+		name, cmd = spec[:i], spec[i+1:]
+	}
+	v, err := migoinfer.NewVerifier(name, cmd)
+	if err != nil {
+		fatal(err)
+	}
+	verdict, err = inferer.Verify(v)
+	if err != nil {
+		fatalf("Cannot verify with %s: %v", name, err)
+	}
+	verdict.WriteTo(os.Stderr)
+	return verdict
+}
+
+// conform returns the deviations of the inferred MiGo program from the
+// protocol specification in file path.
+func conform(inferer *migoinfer.Inferer, path string) []session.Deviation {
+	f, err := os.Open(path)
+	if err != nil {
+		fatalf("Cannot open protocol specification: %v", err)
+	}
+	defer f.Close()
+	spec, err := session.ParseSpec(f)
+	if err != nil {
+		fatalf("Cannot parse protocol specification %s: %v", path, err)
+	}
+	return session.Extract(inferer.Env.Prog).Conform(spec, inferer.Env.Spawns, inferer.Env.Chans)
+}
+
+// writeCallGraph writes the callgraph g to file path.
+func writeCallGraph(g *callgraph.Graph, path string) {
+	w, err := openOutput(path)
+	if err != nil {
+		fatalf("Cannot create %s: %v", path, err)
+	}
+	defer w.Close()
+	write := g.WriteDot
+	if strings.HasSuffix(path, ".json") {
+		write = g.WriteJSON
+	}
+	if err := write(w); err != nil {
+		fatalf("Cannot write callgraph: %v", err)
 	}
-	inferer.Analyse()
 }
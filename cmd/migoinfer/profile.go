@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	rtrace "runtime/trace"
+)
+
+// stopProfiling stops the profiles and writes them, once.
+var stopProfiling = func() {}
+
+// startProfiling starts the CPU profile and execution trace, and sets
+// stopProfiling to stop them and write the heap profile, as given by
+// -cpuprofile, -exectrace and -memprofile.
+func startProfiling() {
+	var stops []func()
+	if cpuProf != "" {
+		f, err := os.Create(cpuProf)
+		if err != nil {
+			fatalf("Cannot create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fatalf("Cannot start CPU profile: %v", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+	if execTrace != "" {
+		f, err := os.Create(execTrace)
+		if err != nil {
+			fatalf("Cannot create execution trace: %v", err)
+		}
+		if err := rtrace.Start(f); err != nil {
+			fatalf("Cannot start execution trace: %v", err)
+		}
+		stops = append(stops, func() {
+			rtrace.Stop()
+			f.Close()
+		})
+	}
+	if memProf != "" {
+		stops = append(stops, func() {
+			f, err := os.Create(memProf)
+			if err != nil {
+				log.Printf("Cannot create memory profile: %v", err)
+				return
+			}
+			defer f.Close()
+			runtime.GC() // Up-to-date statistics of live objects.
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Printf("Cannot write memory profile: %v", err)
+			}
+		})
+	}
+	stopProfiling = func() {
+		stopProfiling = func() {}
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// exit stops the profiles and exits with status code.
+func exit(code int) {
+	stopProfiling()
+	os.Exit(code)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nickng/gospal/tracing"
+)
+
+// startTracing enables the OpenTelemetry spans of the analysis phases, as
+// given by -otel, under a root span of the run, and sets stopProfiling to
+// also end the root span and export the spans.
+func startTracing() {
+	if otel == "" {
+		return
+	}
+	var (
+		e    tracing.Exporter
+		file *os.File
+	)
+	if strings.HasPrefix(otel, "http://") || strings.HasPrefix(otel, "https://") {
+		e = tracing.NewHTTPExporter(otel)
+	} else {
+		f, err := os.Create(otel)
+		if err != nil {
+			fatalf("Cannot create trace: %v", err)
+		}
+		file, e = f, &tracing.FileExporter{W: f}
+	}
+	tracing.Enable(e)
+	root := tracing.StartRoot("migoinfer", tracing.String("args", strings.Join(os.Args[1:], " ")))
+	stop := stopProfiling
+	stopProfiling = func() {
+		stop()
+		root.End()
+		if err := tracing.Flush(); err != nil {
+			log.Printf("Cannot export trace %s: %v", root.TraceIDString(), err)
+		}
+		if file != nil {
+			file.Close()
+		}
+	}
+}
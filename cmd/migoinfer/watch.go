@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nickng/gospal/incr"
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/migo"
+)
+
+// watchInterval is the interval of polling the files for changes.
+const watchInterval = time.Second
+
+// watcher is the latest result of the watch mode.
+type watcher struct {
+	sync.Mutex
+	migo  string      // MiGo program.
+	delta *incr.Delta // Changes of the last analysis.
+	err   error       // Error of the last analysis, if any.
+}
+
+// ServeHTTP serves the MiGo program at /, and the changes of the last
+// analysis in JSON at /delta.
+func (w *watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.Lock()
+	defer w.Unlock()
+	switch r.URL.Path {
+	case "/":
+		if w.err != nil {
+			http.Error(rw, w.err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(rw, w.migo)
+	case "/delta":
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(w.delta)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+// watch analyses the source files incrementally whenever they change, and
+// writes the MiGo program to stdout and the changes to stderr after each
+// analysis. The latest results are also served over HTTP at addr, if not
+// empty. watch does not return.
+func watch(files []string, addr string) {
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".go") {
+			fatalf("Watch mode needs source files, not packages: %s", f)
+		}
+	}
+	a := incr.New()
+	a.Log = logWriter
+	a.Setup = func(inferer *migoinfer.Inferer) {
+		setLogOptions(inferer)
+		configure(inferer)
+	}
+	w := new(watcher)
+	if addr != "" {
+		go func() {
+			fatal(http.ListenAndServe(addr, w))
+		}()
+	}
+	for ; ; time.Sleep(watchInterval) {
+		d, err := a.Update(files, nil)
+		if err != nil {
+			w.Lock()
+			if w.err == nil || w.err.Error() != err.Error() {
+				log.Printf("Build failed: %v", err)
+			}
+			w.err = err
+			w.Unlock()
+			continue
+		}
+		w.Lock()
+		failed := w.err != nil
+		w.err = nil
+		if len(d.Files) > 0 || failed {
+			var buf bytes.Buffer
+			writeProg(&buf, a.Prog)
+			w.migo, w.delta = buf.String(), d
+			fmt.Fprintf(os.Stderr, "%s: %s\n", time.Now().Format("15:04:05"), d)
+			os.Stdout.Write(buf.Bytes())
+		}
+		w.Unlock()
+	}
+}
+
+// writeProg writes the MiGo program prog to w, with main.main first.
+func writeProg(w io.Writer, prog *migo.Program) {
+	for _, f := range prog.Funcs {
+		if f.SimpleName() == "main.main" {
+			io.WriteString(w, f.String())
+		}
+	}
+	for _, f := range prog.Funcs {
+		if f.SimpleName() != "main.main" {
+			io.WriteString(w, f.String())
+		}
+	}
+}
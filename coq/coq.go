@@ -0,0 +1,224 @@
+// Package coq exports MiGo programs as Gallina terms, for carrying the
+// inferred models into machine-checked proofs with the Coq proof assistant.
+//
+// The syntax of MiGo is the inductive type stmt of the preamble (see Prelude),
+// which follows the abstract syntax of MiGo in its mechanisations: a
+// definition is a name, its channel parameters and a body of statements, and
+// a program is a list of definitions with the entry definition first. Names
+// of definitions and channels are strings, as MiGo names (e.g. main.main#2)
+// are not Gallina identifiers, e.g.
+//
+//	Definition main_main : def := {|
+//	  def_name := "main.main";
+//	  def_params := [];
+//	  def_body := [NewChan "t0" "main.main.t0_chan0" 0; Spawn "main.main$1" ["t0"]; Recv "t0"]
+//	|}.
+package coq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nickng/gospal/internal/cancel"
+	"github.com/nickng/migo"
+)
+
+// Prelude is the Gallina syntax of MiGo, written before the definitions
+// unless disabled (see Writer).
+const Prelude = `Require Import Coq.Strings.String.
+Require Import Coq.Lists.List.
+Import ListNotations.
+Open Scope string_scope.
+
+(* Statements of MiGo. *)
+Inductive stmt : Type :=
+| Send (c : string)
+| Recv (c : string)
+| Close (c : string)
+| Tau
+| NewChan (x : string) (c : string) (size : nat)
+| Call (f : string) (args : list string)
+| Spawn (f : string) (args : list string)
+| If (s1 s2 : list stmt)
+| IfFor (cond : string) (s1 s2 : list stmt)
+| Select (cases : list (list stmt)).
+
+(* Definitions: name, channel parameters and body. *)
+Record def : Type := mkDef {
+  def_name : string;
+  def_params : list string;
+  def_body : list stmt
+}.
+
+(* Programs: definitions, the entry definition first. *)
+Definition prog : Type := list def.
+`
+
+// reserved are the identifiers of the preamble and the Gallina keywords, not
+// used for definitions.
+var reserved = []string{
+	"stmt", "Send", "Recv", "Close", "Tau", "NewChan", "Call", "Spawn", "If", "IfFor", "Select",
+	"def", "mkDef", "def_name", "def_params", "def_body", "prog",
+	"as", "at", "cofix", "else", "end", "exists", "fix", "for", "forall", "fun", "if",
+	"in", "let", "match", "mod", "return", "then", "using", "where", "with", "Type", "Prop", "Set",
+}
+
+// Writer writes MiGo programs in Gallina.
+type Writer struct {
+	NoPrelude bool   // Omit the preamble, e.g. if imported from another file.
+	Name      string // Name of the program definition (default program).
+}
+
+// Write writes prog to w in Gallina, with the preamble.
+func Write(w io.Writer, prog *migo.Program) error {
+	return Writer{}.Write(w, prog)
+}
+
+// Write writes prog to w in Gallina.
+func (cw Writer) Write(w io.Writer, prog *migo.Program) error {
+	bufw := bufio.NewWriter(w)
+	if !cw.NoPrelude {
+		bufw.WriteString(Prelude)
+		bufw.WriteString("\n")
+	}
+	name := cw.Name
+	if name == "" {
+		name = "program"
+	}
+	used := map[string]bool{ident(name): true}
+	for _, id := range reserved {
+		used[id] = true
+	}
+	var idents []string
+	for _, f := range order(prog) {
+		id := uniqIdent(ident(f.SimpleName()), used)
+		idents = append(idents, id)
+		fmt.Fprintf(bufw, "Definition %s : def := {|\n", id)
+		fmt.Fprintf(bufw, "  def_name := %s;\n", quote(f.SimpleName()))
+		params := make([]string, len(f.Params))
+		for i, p := range f.Params {
+			params[i] = p.Callee.Name()
+		}
+		fmt.Fprintf(bufw, "  def_params := %s;\n", list(params))
+		fmt.Fprintf(bufw, "  def_body := %s\n|}.\n\n", stmts(f.Stmts))
+	}
+	fmt.Fprintf(bufw, "Definition %s : prog := [%s].\n", ident(name), strings.Join(idents, "; "))
+	return bufw.Flush()
+}
+
+// order returns the definitions of prog with main.main first.
+func order(prog *migo.Program) []*migo.Function {
+	var fns []*migo.Function
+	for _, f := range prog.Funcs {
+		if f.SimpleName() == "main.main" {
+			fns = append(fns, f)
+		}
+	}
+	for _, f := range prog.Funcs {
+		if f.SimpleName() != "main.main" {
+			fns = append(fns, f)
+		}
+	}
+	return fns
+}
+
+// stmts returns the Gallina list of statements ss.
+func stmts(ss []migo.Statement) string {
+	terms := make([]string, len(ss))
+	for i, s := range ss {
+		terms[i] = stmt(s)
+	}
+	return "[" + strings.Join(terms, "; ") + "]"
+}
+
+// stmt returns the Gallina term of statement s. Statements without a
+// counterpart in the syntax are silent (Tau).
+func stmt(s migo.Statement) string {
+	switch s := s.(type) {
+	case *migo.SendStatement:
+		return "Send " + quote(s.Chan)
+	case *migo.RecvStatement:
+		return "Recv " + quote(s.Chan)
+	case *migo.CloseStatement:
+		return "Close " + quote(s.Chan)
+	case *cancel.Close: // Written as in MiGo (see cancel.Close).
+		return stmt(&migo.SelectStatement{Cases: [][]migo.Statement{
+			{&migo.RecvStatement{Chan: s.Chan}},
+			{&migo.TauStatement{}, &migo.CloseStatement{Chan: s.Chan}},
+		}})
+	case *migo.TauStatement:
+		return "Tau"
+	case *migo.NewChanStatement:
+		return fmt.Sprintf("NewChan %s %s %d", quote(s.Name.Name()), quote(s.Chan), s.Size)
+	case *migo.CallStatement:
+		return fmt.Sprintf("Call %s %s", quote(s.SimpleName()), args(s.Params))
+	case *migo.SpawnStatement:
+		return fmt.Sprintf("Spawn %s %s", quote(s.SimpleName()), args(s.Params))
+	case *migo.IfStatement:
+		return fmt.Sprintf("If %s %s", stmts(s.Then), stmts(s.Else))
+	case *migo.IfForStatement:
+		return fmt.Sprintf("IfFor %s %s %s", quote(s.ForCond), stmts(s.Then), stmts(s.Else))
+	case *migo.SelectStatement:
+		cases := make([]string, len(s.Cases))
+		for i, c := range s.Cases {
+			cases[i] = stmts(c)
+		}
+		return "Select [" + strings.Join(cases, "; ") + "]"
+	}
+	return fmt.Sprintf("(* %s *) Tau", strings.Replace(s.String(), "*)", "* )", -1))
+}
+
+// args returns the Gallina list of the arguments (caller names) of params.
+func args(params []*migo.Parameter) string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Caller.Name()
+	}
+	return list(names)
+}
+
+// list returns the Gallina list of strings ss.
+func list(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = quote(s)
+	}
+	return "[" + strings.Join(quoted, "; ") + "]"
+}
+
+// quote returns s as a Gallina string literal, where quotes are doubled.
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// ident returns a Gallina identifier for name, replacing the characters not
+// allowed in identifiers (e.g. main.main#2 is main_main_2).
+func ident(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '_' || r == '\'' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	id := b.String()
+	if id == "" || unicode.IsDigit([]rune(id)[0]) || id[0] == '\'' {
+		id = "d_" + id
+	}
+	return id
+}
+
+// uniqIdent returns id, suffixed if it is in used, and marks it used.
+func uniqIdent(id string, used map[string]bool) string {
+	uniq := id
+	for n := 1; used[uniq]; n++ {
+		uniq = id + "_" + strconv.Itoa(n)
+	}
+	used[uniq] = true
+	return uniq
+}
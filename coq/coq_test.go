@@ -0,0 +1,51 @@
+package coq
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests identifiers of MiGo names.
+func TestIdent(t *testing.T) {
+	for name, expect := range map[string]string{
+		"main.main":      "main_main",
+		"main.main$1#2":  "main_main_1_2",
+		"2":              "d_2",
+		"pkg.(*T).Close": "pkg___T__Close",
+	} {
+		if got := ident(name); got != expect {
+			t.Errorf("Identifier of %s mismatch:\nExpect:\t%s\nGot:\t%s\n", name, expect, got)
+		}
+	}
+}
+
+// Tests the Gallina terms of a program with a goroutine sending to main.
+func TestWrite(t *testing.T) {
+	info, err := build.FromFiles("../migoinfer/testdata/verify/main.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	var buf bytes.Buffer
+	if err := Write(&buf, inferer.Env.Prog); err != nil {
+		t.Fatal(err)
+	}
+	v := buf.String()
+	for _, expect := range []string{
+		"Inductive stmt : Type :=",
+		"Definition main_main : def := {|\n  def_name := \"main.main\";",
+		"Spawn \"main.main$1\" [",
+		"Recv \"",
+		"Send \"",
+		"Definition program : prog := [main_main; ",
+	} {
+		if !strings.Contains(v, expect) {
+			t.Errorf("Expecting %q in Gallina:\n%s", expect, v)
+		}
+	}
+}
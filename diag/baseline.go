@@ -0,0 +1,114 @@
+package diag
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Baseline is a set of pre-existing diagnostics, by fingerprint, with the
+// number of occurrences of each fingerprint.
+type Baseline map[string]int
+
+// Fingerprint returns the fingerprint of d, which identifies d by its rule
+// code, file and message, but not its line, so the fingerprint is stable
+// across unrelated changes of the file, and across releases.
+func Fingerprint(d Diagnostic) string {
+	return fingerprint(d.Rule.key(), d)
+}
+
+// legacyFingerprint returns the fingerprint of d in baselines written before
+// rules had codes, which identifies the rule by its category.
+func legacyFingerprint(d Diagnostic) string {
+	return fingerprint(d.Rule.category(), d)
+}
+
+func fingerprint(rule string, d Diagnostic) string {
+	return fmt.Sprintf("%s\t%s\t%s", rule, filepath.Base(d.Pos.Filename), strings.Replace(d.Message, "\n", " ", -1))
+}
+
+// NewBaseline returns the baseline of diags.
+func NewBaseline(diags []Diagnostic) Baseline {
+	b := make(Baseline)
+	for _, d := range diags {
+		b[Fingerprint(d)]++
+	}
+	return b
+}
+
+// ReadBaseline reads a baseline from r, with one fingerprint per line.
+func ReadBaseline(r io.Reader) (Baseline, error) {
+	b := make(Baseline)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := s.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			b[line]++
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteTo writes the baseline to w, with one fingerprint per line in sorted
+// order.
+func (b Baseline) WriteTo(w io.Writer) (int64, error) {
+	var lines []string
+	for fp, n := range b {
+		for i := 0; i < n; i++ {
+			lines = append(lines, fp)
+		}
+	}
+	sort.Strings(lines)
+	var written int64
+	for _, line := range lines {
+		n, err := fmt.Fprintln(w, line)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// New returns the diagnostics of diags not in the baseline. Each diagnostic
+// in the baseline matches at most one diagnostic of diags, by fingerprint or
+// by the fingerprint of earlier releases.
+func (b Baseline) New(diags []Diagnostic) []Diagnostic {
+	seen := make(map[string]int)
+	var fresh []Diagnostic
+	for _, d := range diags {
+		if fp := Fingerprint(d); seen[fp] < b[fp] {
+			seen[fp]++
+			continue
+		}
+		if fp := legacyFingerprint(d); seen[fp] < b[fp] {
+			seen[fp]++
+			continue
+		}
+		fresh = append(fresh, d)
+	}
+	return fresh
+}
+
+// MatchRule returns true if the rule of d is one of names, where a name is
+// the code of the rule, its identifier or category, or their last word, e.g.
+// "GSP0110", "goroutine-leak" or "leak" for the goroutine leak rule, or
+// "deadlock" for both partial and global deadlocks.
+func MatchRule(d Diagnostic, names []string) bool {
+	for _, name := range names {
+		if d.Rule.Code != "" && strings.EqualFold(d.Rule.Code, name) {
+			return true
+		}
+		for _, id := range []string{d.Rule.ID, d.Rule.category()} {
+			if id == name || strings.HasSuffix(id, "-"+name) {
+				return true
+			}
+		}
+	}
+	return false
+}
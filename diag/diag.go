@@ -0,0 +1,258 @@
+// Package diag provides a common model of diagnostics reported by the checks
+// of gospal, and serialisation of diagnostics in SARIF 2.1.0 (Static Analysis
+// Results Interchange Format), e.g. for uploading to GitHub code scanning.
+//
+// Each rule has a stable code (e.g. GSP0001 for send on closed channels),
+// which identifies the rule in baselines, suppression comments (see
+// IgnoreDirective) and documentation links across releases, and the JSON
+// encoding of diagnostics is versioned (see Schema).
+package diag
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severity is the severity of a diagnostic.
+type Severity string
+
+// Severities of diagnostics, named after SARIF levels.
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Note    Severity = "note"
+)
+
+// Rule is a kind of diagnostic reported by a check.
+type Rule struct {
+	Code        string   // Stable code of the rule, e.g. "GSP0110".
+	ID          string   // Identifier of the rule, e.g. "goroutine-leak".
+	Category    string   // Identifier of the group of the rule, or ID if empty, e.g. "deadlock".
+	Description string   // Short description of the rule.
+	Severity    Severity // Default severity.
+}
+
+// DocsURL is the base URL of the documentation of rules, where the
+// documentation of a rule is at the anchor of its code in lower case.
+const DocsURL = "https://github.com/nickng/gospal/blob/master/docs/diagnostics.md"
+
+// Rules of the checks of gospal. Codes are stable across releases: a rule
+// may be reworded but its code is never reused. Codes are grouped by check,
+// i.e. GSP00xx channel misuses, GSP01xx deadlocks and leaks, GSP02xx
+// synchronisation, GSP03xx data flow, GSP04xx protocols, GSP05xx external
+// verifiers, and GSP06xx approximations of the model.
+var (
+	SendOnClosed        = Rule{Code: "GSP0001", ID: "send-on-closed", Category: "chan-misuse", Description: "Channel may be sent to after close", Severity: Error}
+	DoubleClose         = Rule{Code: "GSP0002", ID: "double-close", Category: "chan-misuse", Description: "Channel may be closed twice", Severity: Error}
+	CloseByReceiver     = Rule{Code: "GSP0003", ID: "close-by-receiver", Category: "chan-misuse", Description: "Channel is closed by a goroutine which only receives from it", Severity: Error}
+	RecvNeverSent       = Rule{Code: "GSP0004", ID: "recv-never-sent", Category: "chan-misuse", Description: "Channel is received from but never sent to or closed", Severity: Error}
+	CloseOfNil          = Rule{Code: "GSP0005", ID: "close-of-nil", Category: "chan-misuse", Description: "Nil channel may be closed", Severity: Error}
+	UnusedEndpoint      = Rule{Code: "GSP0010", ID: "unused-endpoint", Description: "Channel is never received from or never sent to", Severity: Warning}
+	PartialDeadlock     = Rule{Code: "GSP0100", ID: "partial-deadlock", Category: "deadlock", Description: "Goroutines may deadlock after main terminates", Severity: Error}
+	GlobalDeadlock      = Rule{Code: "GSP0101", ID: "global-deadlock", Category: "deadlock", Description: "All goroutines may deadlock", Severity: Error}
+	GoroutineLeak       = Rule{Code: "GSP0110", ID: "goroutine-leak", Description: "Goroutine may block forever", Severity: Warning}
+	LockOrder           = Rule{Code: "GSP0120", ID: "lock-order", Description: "Locks may be acquired in inconsistent orders and deadlock", Severity: Warning}
+	AddConcurrentWait   = Rule{Code: "GSP0200", ID: "add-concurrent-with-wait", Category: "waitgroup-misuse", Description: "WaitGroup Add may be concurrent with Wait", Severity: Error}
+	AddAfterWait        = Rule{Code: "GSP0201", ID: "add-after-wait", Category: "waitgroup-misuse", Description: "WaitGroup Add may happen after Wait", Severity: Error}
+	DoneWithoutAdd      = Rule{Code: "GSP0202", ID: "done-without-add", Category: "waitgroup-misuse", Description: "WaitGroup Done may not be matched by an Add", Severity: Error}
+	DataRace            = Rule{Code: "GSP0210", ID: "data-race", Description: "Shared variable may be accessed concurrently without synchronisation", Severity: Warning}
+	TaintFlow           = Rule{Code: "GSP0300", ID: "taint-flow", Description: "Tainted value flows to a sink", Severity: Error}
+	ProtocolConformance = Rule{Code: "GSP0400", ID: "protocol-conformance", Description: "Goroutine deviates from the specified protocol", Severity: Error}
+	Verification        = Rule{Code: "GSP0500", ID: "verification", Description: "External verifier does not show a property of the MiGo types", Severity: Error}
+	Termination         = Rule{Code: "GSP0501", ID: "termination", Description: "External prover does not show termination of loops, assumed by liveness", Severity: Note}
+	UnrollTruncated     = Rule{Code: "GSP0600", ID: "unroll-truncated", Description: "Loop creating a channel per iteration has more iterations than the unroll limit", Severity: Note}
+)
+
+// Rules are all the rules of the checks of gospal, in order of code.
+var Rules = []Rule{
+	SendOnClosed, DoubleClose, CloseByReceiver, RecvNeverSent, CloseOfNil, UnusedEndpoint,
+	PartialDeadlock, GlobalDeadlock, GoroutineLeak, LockOrder,
+	AddConcurrentWait, AddAfterWait, DoneWithoutAdd, DataRace,
+	TaintFlow, ProtocolConformance, Verification, Termination,
+	UnrollTruncated,
+}
+
+// LookupRule returns the rule with code or identifier name, e.g. "GSP0001" or
+// "send-on-closed".
+func LookupRule(name string) (Rule, bool) {
+	for _, r := range Rules {
+		if strings.EqualFold(r.Code, name) || r.ID == name {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// category returns the identifier of the group of r.
+func (r Rule) category() string {
+	if r.Category != "" {
+		return r.Category
+	}
+	return r.ID
+}
+
+// HelpURI returns the URL of the documentation of r, or empty if r has no
+// code.
+func (r Rule) HelpURI() string {
+	if r.Code == "" {
+		return ""
+	}
+	return DocsURL + "#" + strings.ToLower(r.Code)
+}
+
+// key returns the code of r, or its identifier if r has no code.
+func (r Rule) key() string {
+	if r.Code != "" {
+		return r.Code
+	}
+	return r.ID
+}
+
+// Location is a location in the source code, with an optional message
+// describing the location.
+type Location struct {
+	Pos     token.Position
+	Message string
+}
+
+// Diagnostic is a result of a check.
+type Diagnostic struct {
+	Rule     Rule
+	Severity Severity       // Severity, or the default severity of Rule if empty.
+	Message  string         // Message describing the result.
+	Pos      token.Position // Primary location.
+	Related  []Location     // Related locations, e.g. other accesses of a race.
+}
+
+func (d Diagnostic) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %s: %s [%s]", d.Pos, d.level(), d.Message, d.Rule.key())
+	for _, l := range d.Related {
+		fmt.Fprintf(&buf, "\n\t%s: %s", l.Pos, l.Message)
+	}
+	return buf.String()
+}
+
+// level returns the severity of d.
+func (d Diagnostic) level() Severity {
+	if d.Severity != "" {
+		return d.Severity
+	}
+	if d.Rule.Severity != "" {
+		return d.Rule.Severity
+	}
+	return Warning
+}
+
+// ParsePos parses a position in the format of token.Position, i.e.
+// file:line:column, file:line, or file. The position is invalid if s is empty
+// or "-".
+func ParsePos(s string) token.Position {
+	var pos token.Position
+	if s == "" || s == "-" {
+		return pos
+	}
+	parts := strings.Split(s, ":")
+	// Trailing numbers are the line and column.
+	var nums []int
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	pos.Filename = strings.Join(parts, ":")
+	if len(nums) > 0 {
+		pos.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		pos.Column = nums[1]
+	}
+	return pos
+}
+
+// Sort sorts diagnostics by position, then by rule.
+func Sort(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.Pos.Filename != b.Pos.Filename {
+			return a.Pos.Filename < b.Pos.Filename
+		}
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line < b.Pos.Line
+		}
+		if a.Pos.Column != b.Pos.Column {
+			return a.Pos.Column < b.Pos.Column
+		}
+		return a.Rule.key() < b.Rule.key()
+	})
+}
+
+// jsonLocation is a Location in JSON.
+type jsonLocation struct {
+	Pos     string `json:"pos"`
+	Message string `json:"message,omitempty"`
+}
+
+// MarshalJSON encodes d as a JSON object with the rule code and identifier,
+// severity, message and positions (in the format of token.Position), as
+// defined by Schema, e.g.
+//
+//	{"code": "GSP0101", "rule": "global-deadlock", "severity": "error", "message": "...", "pos": "main.go:5:2", ...}
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	related := []jsonLocation{}
+	for _, l := range d.Related {
+		related = append(related, jsonLocation{Pos: l.Pos.String(), Message: l.Message})
+	}
+	return json.Marshal(struct {
+		Code     string         `json:"code,omitempty"`
+		Rule     string         `json:"rule"`
+		Category string         `json:"category"`
+		Severity Severity       `json:"severity"`
+		Message  string         `json:"message"`
+		Pos      string         `json:"pos"`
+		Related  []jsonLocation `json:"related"`
+		Help     string         `json:"help,omitempty"`
+	}{d.Rule.Code, d.Rule.ID, d.Rule.category(), d.level(), d.Message, d.Pos.String(), related, d.Rule.HelpURI()})
+}
+
+// UnmarshalJSON decodes d from a JSON object encoded by MarshalJSON. The rule
+// is looked up by its code or identifier (see LookupRule), or is a rule with
+// the code, identifier and category of the object if unknown.
+func (d *Diagnostic) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Code     string         `json:"code"`
+		Rule     string         `json:"rule"`
+		Category string         `json:"category"`
+		Severity Severity       `json:"severity"`
+		Message  string         `json:"message"`
+		Pos      string         `json:"pos"`
+		Related  []jsonLocation `json:"related"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	rule, ok := LookupRule(v.Code)
+	if !ok {
+		if rule, ok = LookupRule(v.Rule); !ok {
+			rule = Rule{Code: v.Code, ID: v.Rule}
+			if v.Category != v.Rule {
+				rule.Category = v.Category
+			}
+		}
+	}
+	*d = Diagnostic{Rule: rule, Message: v.Message, Pos: ParsePos(v.Pos)}
+	if v.Severity != d.level() {
+		d.Severity = v.Severity
+	}
+	for _, l := range v.Related {
+		d.Related = append(d.Related, Location{Pos: ParsePos(l.Pos), Message: l.Message})
+	}
+	return nil
+}
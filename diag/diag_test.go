@@ -0,0 +1,209 @@
+package diag
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests parsing of positions.
+func TestParsePos(t *testing.T) {
+	for s, expect := range map[string]token.Position{
+		"main.go:10:5":    {Filename: "main.go", Line: 10, Column: 5},
+		"main.go:10":      {Filename: "main.go", Line: 10},
+		"C:/src/a.go:3:1": {Filename: "C:/src/a.go", Line: 3, Column: 1},
+		"-":               {},
+	} {
+		if got := ParsePos(s); got != expect {
+			t.Errorf("Wrong position of %q:\nExpect:\t%v\nGot:\t%v\n", s, expect, got)
+		}
+	}
+}
+
+// Tests SARIF output of diagnostics.
+func TestSARIF(t *testing.T) {
+	diags := []Diagnostic{
+		{Rule: DataRace, Message: "data race on x", Pos: ParsePos("/src/main.go:4:2"),
+			Related: []Location{{Pos: ParsePos("/src/main.go:8:2"), Message: "conflicting write"}}},
+		{Rule: GoroutineLeak, Message: "goroutine may leak", Pos: ParsePos("/src/main.go:6:2")},
+	}
+	var buf bytes.Buffer
+	if err := (SARIF{Tool: "gospal", BaseDir: "/src"}).Write(&buf, diags); err != nil {
+		t.Fatalf("cannot write SARIF: %v", err)
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				RuleIndex int
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Wrong SARIF log: %s", buf.String())
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 2 || len(run.Results) != 2 {
+		t.Fatalf("Wrong rules or results: %s", buf.String())
+	}
+	for _, res := range run.Results {
+		if expect, got := res.RuleID, run.Tool.Driver.Rules[res.RuleIndex].ID; expect != got {
+			t.Errorf("Wrong rule index:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+		}
+		if expect, got := "main.go", res.Locations[0].PhysicalLocation.ArtifactLocation.URI; expect != got {
+			t.Errorf("Wrong location:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+		}
+	}
+}
+
+// Tests baseline of diagnostics.
+func TestBaseline(t *testing.T) {
+	old := []Diagnostic{
+		{Rule: GoroutineLeak, Message: "goroutine main.f may leak", Pos: ParsePos("/src/main.go:6:2")},
+		{Rule: GlobalDeadlock, Message: "global deadlock", Pos: ParsePos("/src/main.go:9:2")},
+	}
+	var buf bytes.Buffer
+	if _, err := NewBaseline(old).WriteTo(&buf); err != nil {
+		t.Fatalf("cannot write baseline: %v", err)
+	}
+	b, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatalf("cannot read baseline: %v", err)
+	}
+	diags := []Diagnostic{
+		{Rule: GoroutineLeak, Message: "goroutine main.f may leak", Pos: ParsePos("/src/main.go:8:2")}, // Moved.
+		{Rule: GoroutineLeak, Message: "goroutine main.g may leak", Pos: ParsePos("/src/main.go:12:2")},
+	}
+	fresh := b.New(diags)
+	if len(fresh) != 1 || fresh[0].Message != "goroutine main.g may leak" {
+		t.Errorf("Wrong new diagnostics:\nExpect:\t%s\nGot:\t%v\n", "goroutine main.g may leak", fresh)
+	}
+	if !MatchRule(diags[0], []string{"deadlock", "leak"}) || MatchRule(old[1], []string{"leak"}) {
+		t.Errorf("Wrong match of rules %s and %s", diags[0].Rule.ID, old[1].Rule.ID)
+	}
+	if !MatchRule(old[1], []string{"deadlock"}) || !MatchRule(old[1], []string{"gsp0101"}) || MatchRule(old[1], []string{"GSP0100"}) {
+		t.Errorf("Wrong match of rule %s by category or code", old[1].Rule.Code)
+	}
+}
+
+// Tests baselines written before rules had codes, which identify rules by
+// category.
+func TestBaselineLegacy(t *testing.T) {
+	b, err := ReadBaseline(strings.NewReader("deadlock\tmain.go\tglobal deadlock\nchan-misuse\tmain.go\tdouble close: x\n"))
+	if err != nil {
+		t.Fatalf("cannot read baseline: %v", err)
+	}
+	diags := []Diagnostic{
+		{Rule: GlobalDeadlock, Message: "global deadlock", Pos: ParsePos("/src/main.go:9:2")},
+		{Rule: DoubleClose, Message: "double close: x", Pos: ParsePos("/src/main.go:12:2")},
+		{Rule: SendOnClosed, Message: "send on closed: x", Pos: ParsePos("/src/main.go:14:2")},
+	}
+	if fresh := b.New(diags); len(fresh) != 1 || fresh[0].Rule.Code != "GSP0001" {
+		t.Errorf("Wrong new diagnostics:\nExpect:\t%s\nGot:\t%v\n", "GSP0001", fresh)
+	}
+}
+
+// Tests that codes and identifiers of rules are unique.
+func TestRules(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, r := range Rules {
+		if seen[r.Code] || seen[r.ID] {
+			t.Errorf("Duplicate rule %s %s", r.Code, r.ID)
+		}
+		seen[r.Code], seen[r.ID] = true, true
+		if got, ok := LookupRule(r.Code); !ok || got != r {
+			t.Errorf("Wrong rule of %s:\nExpect:\t%v\nGot:\t%v\n", r.Code, r, got)
+		}
+	}
+}
+
+// Tests that diagnostics are decoded from their JSON encoding.
+func TestJSON(t *testing.T) {
+	for _, d := range []Diagnostic{
+		{Rule: DoubleClose, Message: "channel t0 closed twice", Pos: ParsePos("main.go:8:7"),
+			Related: []Location{{Pos: ParsePos("main.go:6:7"), Message: "first close"}}},
+		{Rule: GoroutineLeak, Severity: Error, Message: "goroutine main.worker leaks", Pos: ParsePos("main.go:3:2")},
+		{Rule: Rule{ID: "custom", Category: "plugin"}, Message: "custom check", Pos: ParsePos("main.go:1:1")},
+	} {
+		b, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("cannot encode diagnostic: %v", err)
+		}
+		var got Diagnostic
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("cannot decode diagnostic %s: %v", b, err)
+		}
+		if got.String() != d.String() || got.Rule != d.Rule || got.Severity != d.Severity {
+			t.Errorf("Wrong decoded diagnostic of %s:\nExpect:\t%+v\nGot:\t%+v\n", b, d, got)
+		}
+	}
+}
+
+// Tests suppression of diagnostics by ignore directives.
+func TestSuppress(t *testing.T) {
+	ignores := map[int]string{4: "GSP0210", 6: "data-race", 8: ""}
+	ignored := func(pos token.Position) (string, bool) {
+		arg, ok := ignores[pos.Line]
+		return arg, ok
+	}
+	diags := []Diagnostic{
+		{Rule: DataRace, Message: "data race on x", Pos: ParsePos("/src/main.go:4:2")},
+		{Rule: GoroutineLeak, Message: "goroutine may leak", Pos: ParsePos("/src/main.go:6:2")},
+		{Rule: GoroutineLeak, Message: "goroutine may leak", Pos: ParsePos("/src/main.go:8:2")},
+		{Rule: GoroutineLeak, Message: "goroutine may leak", Pos: ParsePos("/src/main.go:10:2")},
+	}
+	kept := Suppress(diags, ignored)
+	if len(kept) != 2 || kept[0].Pos.Line != 6 || kept[1].Pos.Line != 10 {
+		t.Errorf("Wrong diagnostics kept:\nExpect:\t%v\nGot:\t%v\n", "lines 6 and 10", kept)
+	}
+}
+
+// Tests JSON encoding of diagnostics against the schema.
+func TestSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(Schema), &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join("..", "docs", "diagnostics-v1.schema.json"))
+	if err != nil {
+		t.Fatalf("cannot read schema: %v", err)
+	}
+	if string(b) != Schema {
+		t.Errorf("Schema in docs differs from Schema, update docs/diagnostics-v1.schema.json")
+	}
+	d := Diagnostic{Rule: SendOnClosed, Message: "send on closed", Pos: ParsePos("main.go:5:2")}
+	b, err = json.Marshal(d)
+	if err != nil {
+		t.Fatalf("cannot encode diagnostic: %v", err)
+	}
+	var obj map[string]interface{}
+	json.Unmarshal(b, &obj)
+	required := schema["definitions"].(map[string]interface{})["diagnostic"].(map[string]interface{})["required"].([]interface{})
+	for _, prop := range required {
+		if _, ok := obj[prop.(string)]; !ok {
+			t.Errorf("Missing property %s in %s", prop, b)
+		}
+	}
+	if expect, got := "GSP0001", obj["code"]; expect != got {
+		t.Errorf("Wrong code:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+	}
+}
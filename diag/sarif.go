@@ -0,0 +1,176 @@
+package diag
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// SARIF 2.1.0 log (only the properties used are defined).
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name,omitempty"`
+	HelpURI              string             `json:"helpUri,omitempty"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level Severity `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	RuleIndex        int             `json:"ruleIndex"`
+	Level            Severity        `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// SARIF is a writer of diagnostics as a SARIF log.
+type SARIF struct {
+	Tool    string // Name of the tool.
+	ToolURI string // URI of the tool (optional).
+	BaseDir string // Directory file locations are relative to (optional).
+}
+
+// location returns the SARIF location of pos, with file paths relative to
+// BaseDir if possible.
+func (s SARIF) location(pos Location) sarifLocation {
+	uri := pos.Pos.Filename
+	if s.BaseDir != "" {
+		if rel, err := filepath.Rel(s.BaseDir, uri); err == nil {
+			uri = rel
+		}
+	}
+	loc := sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(uri)},
+		},
+	}
+	if pos.Pos.Line > 0 {
+		loc.PhysicalLocation.Region = &sarifRegion{StartLine: pos.Pos.Line, StartColumn: pos.Pos.Column}
+	}
+	if pos.Message != "" {
+		loc.Message = &sarifMessage{Text: pos.Message}
+	}
+	return loc
+}
+
+// Write writes diags to w as a SARIF log with a single run.
+func (s SARIF) Write(w io.Writer, diags []Diagnostic) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           s.Tool,
+			InformationURI: s.ToolURI,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	// Rules are identified by their codes, which are stable across releases.
+	ruleIndex := make(map[string]int)
+	var rules []Rule
+	for _, d := range diags {
+		if _, ok := ruleIndex[d.Rule.key()]; !ok {
+			ruleIndex[d.Rule.key()] = -1
+			rules = append(rules, d.Rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].key() < rules[j].key() })
+	for i, r := range rules {
+		ruleIndex[r.key()] = i
+		level := r.Severity
+		if level == "" {
+			level = Warning
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   r.key(),
+			Name:                 r.ID,
+			HelpURI:              r.HelpURI(),
+			ShortDescription:     sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{Level: level},
+		})
+	}
+	for _, d := range diags {
+		res := sarifResult{
+			RuleID:    d.Rule.key(),
+			RuleIndex: ruleIndex[d.Rule.key()],
+			Level:     d.level(),
+			Message:   sarifMessage{Text: d.Message},
+		}
+		if d.Pos.IsValid() || d.Pos.Filename != "" {
+			res.Locations = []sarifLocation{s.location(Location{Pos: d.Pos})}
+		}
+		for i, l := range d.Related {
+			if !l.Pos.IsValid() && l.Pos.Filename == "" {
+				continue
+			}
+			loc := s.location(l)
+			id := i
+			loc.ID = &id
+			res.RelatedLocations = append(res.RelatedLocations, loc)
+		}
+		run.Results = append(run.Results, res)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
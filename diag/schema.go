@@ -0,0 +1,81 @@
+package diag
+
+import (
+	"go/token"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON encoding of diagnostics (see
+// Diagnostic.MarshalJSON), incremented on incompatible changes, e.g. removing
+// or renaming a property. Adding properties or rules is compatible.
+const SchemaVersion = 1
+
+// SchemaID is the identifier of the JSON schema of diagnostics.
+const SchemaID = "https://raw.githubusercontent.com/nickng/gospal/master/docs/diagnostics-v1.schema.json"
+
+// Schema is the JSON schema (draft-07) of documents with the diagnostics of
+// gospal, i.e. an object with the property diagnostics, and the property
+// schemaVersion for the version of the schema.
+const Schema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "` + SchemaID + `",
+  "title": "gospal diagnostics",
+  "type": "object",
+  "required": ["diagnostics"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "diagnostics": {"type": "array", "items": {"$ref": "#/definitions/diagnostic"}}
+  },
+  "definitions": {
+    "diagnostic": {
+      "type": "object",
+      "required": ["rule", "category", "severity", "message", "pos", "related"],
+      "properties": {
+        "code": {"type": "string", "pattern": "^GSP[0-9]{4}$", "description": "Stable code of the rule."},
+        "rule": {"type": "string", "description": "Identifier of the rule."},
+        "category": {"type": "string", "description": "Identifier of the group of the rule."},
+        "severity": {"enum": ["error", "warning", "note"]},
+        "message": {"type": "string"},
+        "pos": {"$ref": "#/definitions/pos"},
+        "related": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["pos"],
+            "properties": {
+              "pos": {"$ref": "#/definitions/pos"},
+              "message": {"type": "string"}
+            }
+          }
+        },
+        "help": {"type": "string", "format": "uri", "description": "Documentation of the rule."}
+      }
+    },
+    "pos": {"type": "string", "description": "Position as file:line:column, or - if unknown."}
+  }
+}
+`
+
+// IgnoreDirective is the name of the directive comment suppressing the
+// diagnostics on its line (or the line after), of the rules given by code or
+// identifier, or of all rules if none, e.g.
+//
+//	ch <- v //gospal:ignore GSP0001
+const IgnoreDirective = "ignore"
+
+// Suppress returns diags without the diagnostics suppressed by ignore
+// directives, where ignored returns the argument of the ignore directive at
+// a position (see ssa.Directives.Ignored), if any.
+func Suppress(diags []Diagnostic, ignored func(token.Position) (string, bool)) []Diagnostic {
+	var kept []Diagnostic
+	for _, d := range diags {
+		if arg, ok := ignored(d.Pos); ok {
+			names := strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' })
+			if len(names) == 0 || MatchRule(d, names) {
+				continue
+			}
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
@@ -0,0 +1,399 @@
+// Package escape implements an escape analysis of channels.
+//
+// For each channel creation site (make(chan T)) in the main packages, the
+// analysis follows the flow of the channel value through the program and
+// reports where the channel escapes to, i.e.
+//
+//   - the goroutines it is passed to (as spawn arguments or closure captures),
+//   - the packages of the functions it reaches, and
+//   - how it escapes (parameters, captures, return values, struct fields,
+//     package variables, container elements and channel payloads).
+//
+// The analysis is flow-insensitive and conservative. Struct fields are
+// identified by their type and name, and channel payloads by the type of the
+// carrying channel, so a channel stored in a field (or sent over a channel)
+// reaches every load of the field (or receive of the channel type). Calls of
+// function values and interface methods are reported as dynamic calls and not
+// followed, and functions in the standard library are not analysed.
+package escape
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	gssa "github.com/nickng/gospal/ssa"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Escape is the escape summary of a channel creation site.
+type Escape struct {
+	Pos        token.Position // Position of the channel creation.
+	Func       string         // Function creating the channel.
+	Goroutines []string       // Spawned functions the channel is passed to.
+	Packages   []string       // Packages of functions the channel reaches.
+	Via        []string       // How the channel escapes.
+}
+
+func (e Escape) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: channel created in %s", e.Pos, e.Func)
+	if len(e.Via) == 0 {
+		b.WriteString(" does not escape")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\n\tgoroutines: %s", strings.Join(e.Goroutines, ", "))
+	fmt.Fprintf(&b, "\n\tpackages: %s", strings.Join(e.Packages, ", "))
+	fmt.Fprintf(&b, "\n\tvia: %s", strings.Join(e.Via, ", "))
+	return b.String()
+}
+
+// index is an index of the program for following values across functions.
+type index struct {
+	callers    map[*ssa.Function][]ssa.CallInstruction
+	globals    map[*ssa.Global][]ssa.Value // Loads of package variables.
+	fields     map[string][]ssa.Value      // Loads of fields, by field name.
+	recvs      map[string][]ssa.Value      // Received values, by channel type.
+	fieldNames map[*ssa.FieldAddr]string
+}
+
+// Analyse returns the escape summaries of the channels created in the main
+// packages of the program, ordered by position.
+func Analyse(info *gssa.Info) ([]Escape, error) {
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		return nil, err
+	}
+	isMain := make(map[*ssa.Package]bool)
+	for _, main := range mains {
+		isMain[main] = true
+	}
+	idx := newIndex(info.Prog)
+	var fns []*ssa.Function
+	for fn := range ssautil.AllFunctions(info.Prog) {
+		if fn.Pkg != nil && isMain[fn.Pkg] {
+			fns = append(fns, fn)
+		}
+	}
+	var escapes []Escape
+	for _, fn := range fns {
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				if mk, ok := instr.(*ssa.MakeChan); ok {
+					escapes = append(escapes, idx.escape(info.FSet, mk))
+				}
+			}
+		}
+	}
+	sort.Slice(escapes, func(i, j int) bool {
+		a, b := escapes[i].Pos, escapes[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return escapes, nil
+}
+
+// newIndex indexes the loads, receives and calls in prog.
+func newIndex(prog *ssa.Program) *index {
+	idx := &index{
+		callers:    make(map[*ssa.Function][]ssa.CallInstruction),
+		globals:    make(map[*ssa.Global][]ssa.Value),
+		fields:     make(map[string][]ssa.Value),
+		recvs:      make(map[string][]ssa.Value),
+		fieldNames: make(map[*ssa.FieldAddr]string),
+	}
+	for fn := range ssautil.AllFunctions(prog) {
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				switch instr := instr.(type) {
+				case *ssa.UnOp:
+					switch instr.Op {
+					case token.MUL:
+						switch x := instr.X.(type) {
+						case *ssa.Global:
+							idx.globals[x] = append(idx.globals[x], instr)
+						case *ssa.FieldAddr:
+							name := idx.fieldName(x)
+							idx.fields[name] = append(idx.fields[name], instr)
+						}
+					case token.ARROW:
+						t := instr.X.Type().String()
+						if instr.CommaOk {
+							for _, ref := range *instr.Referrers() {
+								if ex, ok := ref.(*ssa.Extract); ok && ex.Index == 0 {
+									idx.recvs[t] = append(idx.recvs[t], ex)
+								}
+							}
+						} else {
+							idx.recvs[t] = append(idx.recvs[t], instr)
+						}
+					}
+				case *ssa.Field:
+					name := fieldName(instr.X.Type(), instr.Field)
+					idx.fields[name] = append(idx.fields[name], instr)
+				case *ssa.Select:
+					recv := 0
+					for _, st := range instr.States {
+						if st.Dir != types.RecvOnly {
+							continue
+						}
+						t := st.Chan.Type().String()
+						for _, ref := range *instr.Referrers() {
+							if ex, ok := ref.(*ssa.Extract); ok && ex.Index == 2+recv {
+								idx.recvs[t] = append(idx.recvs[t], ex)
+							}
+						}
+						recv++
+					}
+				case ssa.CallInstruction:
+					if callee := instr.Common().StaticCallee(); callee != nil {
+						idx.callers[callee] = append(idx.callers[callee], instr)
+					}
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// fieldName returns the name of the field at fa.
+func (idx *index) fieldName(fa *ssa.FieldAddr) string {
+	if name, ok := idx.fieldNames[fa]; ok {
+		return name
+	}
+	var name string
+	if ptr, ok := fa.X.Type().Underlying().(*types.Pointer); ok {
+		name = fieldName(ptr.Elem(), fa.Field)
+	}
+	idx.fieldNames[fa] = name
+	return name
+}
+
+// fieldName returns the name of field i of struct type t.
+func fieldName(t types.Type, i int) string {
+	if s, ok := t.Underlying().(*types.Struct); ok {
+		return fmt.Sprintf("(%s).%s", t, s.Field(i).Name())
+	}
+	return ""
+}
+
+// isStd returns true if fn is in the standard library.
+func isStd(fn *ssa.Function) bool {
+	if fn.Pkg == nil {
+		return false
+	}
+	path := fn.Pkg.Pkg.Path()
+	if path == "main" || path == "command-line-arguments" {
+		return false
+	}
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// summary is the escape summary being computed.
+type summary struct {
+	goroutines map[string]bool
+	packages   map[string]bool
+	via        map[string]bool
+}
+
+func (s *summary) reach(fn *ssa.Function) {
+	if fn != nil && fn.Pkg != nil {
+		s.packages[fn.Pkg.Pkg.Path()] = true
+	}
+}
+
+// escape returns the escape summary of the channel created by mk.
+func (idx *index) escape(fset *token.FileSet, mk *ssa.MakeChan) Escape {
+	s := summary{
+		goroutines: make(map[string]bool),
+		packages:   make(map[string]bool),
+		via:        make(map[string]bool),
+	}
+	s.reach(mk.Parent())
+	visited := make(map[ssa.Value]bool)
+	queue := []ssa.Value{mk}
+	track := func(vs ...ssa.Value) {
+		for _, v := range vs {
+			if v != nil && !visited[v] {
+				visited[v] = true
+				queue = append(queue, v)
+			}
+		}
+	}
+	visited[mk] = true
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if fn := v.Parent(); fn != nil {
+			s.reach(fn)
+		}
+		refs := v.Referrers()
+		if refs == nil {
+			continue
+		}
+		for _, ref := range *refs {
+			track(idx.flow(&s, v, ref)...)
+		}
+	}
+	return Escape{
+		Pos:        fset.Position(mk.Pos()),
+		Func:       mk.Parent().String(),
+		Goroutines: sorted(s.goroutines),
+		Packages:   sorted(s.packages),
+		Via:        sorted(s.via),
+	}
+}
+
+// flow returns the values v flows to through instruction ref, and records
+// the escapes in s.
+func (idx *index) flow(s *summary, v ssa.Value, ref ssa.Instruction) []ssa.Value {
+	switch ref := ref.(type) {
+	case *ssa.Phi, *ssa.ChangeType, *ssa.ChangeInterface, *ssa.MakeInterface,
+		*ssa.TypeAssert, *ssa.Slice, *ssa.IndexAddr, *ssa.Index, *ssa.Lookup,
+		*ssa.Range, *ssa.Next, *ssa.Extract:
+		return []ssa.Value{ref.(ssa.Value)}
+	case *ssa.UnOp:
+		if ref.Op == token.MUL {
+			return []ssa.Value{ref} // Load from address holding the channel.
+		}
+	case *ssa.Store:
+		if ref.Val != v {
+			return nil
+		}
+		switch addr := ref.Addr.(type) {
+		case *ssa.Global:
+			s.via["package variable "+addr.String()] = true
+			return idx.globals[addr]
+		case *ssa.FieldAddr:
+			name := idx.fieldName(addr)
+			s.via["field "+name] = true
+			return idx.fields[name]
+		case *ssa.IndexAddr:
+			s.via["container element"] = true
+			return []ssa.Value{addr, addr.X}
+		}
+		return []ssa.Value{ref.Addr}
+	case *ssa.MapUpdate:
+		s.via["container element"] = true
+		return []ssa.Value{ref.Map}
+	case *ssa.Send:
+		if ref.X == v {
+			s.via["channel payload"] = true
+			return idx.recvs[ref.Chan.Type().String()]
+		}
+	case *ssa.Select:
+		var vs []ssa.Value
+		for _, st := range ref.States {
+			if st.Dir == types.SendOnly && st.Send == v {
+				s.via["channel payload"] = true
+				vs = append(vs, idx.recvs[st.Chan.Type().String()]...)
+			}
+		}
+		return vs
+	case *ssa.Return:
+		var vs []ssa.Value
+		for i, res := range ref.Results {
+			if res != v {
+				continue
+			}
+			s.via["return value"] = true
+			for _, call := range idx.callers[ref.Parent()] {
+				vs = append(vs, result(call, i, len(ref.Results))...)
+			}
+		}
+		return vs
+	case *ssa.MakeClosure:
+		var vs []ssa.Value
+		fn := ref.Fn.(*ssa.Function)
+		for i, b := range ref.Bindings {
+			if b == v && i < len(fn.FreeVars) {
+				s.via["closure capture"] = true
+				vs = append(vs, fn.FreeVars[i])
+			}
+		}
+		if len(vs) > 0 {
+			for _, cref := range *ref.Referrers() {
+				if g, ok := cref.(*ssa.Go); ok && g.Call.Value == ref {
+					s.goroutines[fn.String()] = true
+				}
+			}
+			s.reach(fn)
+		}
+		return vs
+	case ssa.CallInstruction:
+		return idx.call(s, v, ref)
+	}
+	return nil
+}
+
+// call returns the parameters v flows to as argument of call, and records the
+// escapes in s.
+func (idx *index) call(s *summary, v ssa.Value, call ssa.CallInstruction) []ssa.Value {
+	c := call.Common()
+	var vs []ssa.Value
+	for i, arg := range c.Args {
+		if arg != v {
+			continue
+		}
+		s.via["parameter"] = true
+		if b, ok := c.Value.(*ssa.Builtin); ok {
+			if b.Name() == "append" {
+				s.via["container element"] = true
+				if v, ok := call.(*ssa.Call); ok {
+					vs = append(vs, v)
+				}
+			}
+			continue
+		}
+		callee := c.StaticCallee()
+		if callee == nil {
+			s.via["dynamic call"] = true
+			continue
+		}
+		s.reach(callee)
+		if _, ok := call.(*ssa.Go); ok {
+			s.goroutines[callee.String()] = true
+		}
+		if !isStd(callee) && i < len(callee.Params) {
+			vs = append(vs, callee.Params[i])
+		}
+	}
+	if c.IsInvoke() && c.Value == v {
+		s.via["dynamic call"] = true
+	}
+	return vs
+}
+
+// result returns the values of result i of call (of a function with n
+// results).
+func result(call ssa.CallInstruction, i, n int) []ssa.Value {
+	v, ok := call.(*ssa.Call)
+	if !ok {
+		return nil // Go or Defer, results are discarded.
+	}
+	if n == 1 {
+		return []ssa.Value{v}
+	}
+	var vs []ssa.Value
+	for _, ref := range *v.Referrers() {
+		if ex, ok := ref.(*ssa.Extract); ok && ex.Index == i {
+			vs = append(vs, ex)
+		}
+	}
+	return vs
+}
+
+// sorted returns the keys of set in order.
+func sorted(set map[string]bool) []string {
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,46 @@
+package escape
+
+import (
+	"testing"
+
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests escape of channels through parameters, fields and package variables.
+func TestEscape(t *testing.T) {
+	info, err := build.FromFiles("testdata/escape.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	escapes, err := Analyse(info)
+	if err != nil {
+		t.Fatalf("escape analysis failed: %v", err)
+	}
+	if expect, got := 4, len(escapes); expect != got {
+		t.Fatalf("Wrong number of channels:\nExpect:\t%d\nGot:\t%d\n", expect, got)
+	}
+	has := func(ss []string, s string) bool {
+		for _, x := range ss {
+			if x == s {
+				return true
+			}
+		}
+		return false
+	}
+	byLine := make(map[int]Escape)
+	for _, e := range escapes {
+		byLine[e.Pos.Line] = e
+	}
+	if e := byLine[7]; !has(e.Via, "package variable main.quit") {
+		t.Errorf("Expecting quit to escape to a package variable: %v", e)
+	}
+	if e := byLine[15]; !has(e.Via, "field (main.server).reqs") {
+		t.Errorf("Expecting server.reqs to escape to a field: %v", e)
+	}
+	if e := byLine[19]; len(e.Via) != 0 {
+		t.Errorf("Expecting local not to escape: %v", e)
+	}
+	if e := byLine[23]; !has(e.Goroutines, "main.worker") {
+		t.Errorf("Expecting ch to escape to main.worker: %v", e)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+type server struct {
+	reqs chan int
+}
+
+var quit = make(chan struct{})
+
+func worker(ch chan int) {
+	for range ch {
+	}
+}
+
+func newServer() *server {
+	return &server{reqs: make(chan int)}
+}
+
+func main() {
+	local := make(chan int, 1)
+	local <- 1
+	<-local
+
+	ch := make(chan int)
+	go worker(ch)
+	ch <- 1
+
+	s := newServer()
+	go func() {
+		s.reqs <- 1
+	}()
+	<-s.reqs
+	close(quit)
+}
@@ -0,0 +1,90 @@
+package fn
+
+import (
+	"go/types"
+	"sync"
+
+	"github.com/nickng/gospal/metrics"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Cache caches the resolution of interface implementations of a program, i.e.
+// the most concrete value of an SSA value (see concreteImpl), and the method
+// of a type, shared by the analyses of the program (e.g. all the workers of
+// an inference). The methods of a nil Cache do not cache.
+//
+// Cache is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	concrete map[ssa.Value]ssa.Value
+	methods  typeutil.Map // types.Type → map[string]*ssa.Function, by method Id.
+}
+
+// NewCache returns an empty cache.
+func NewCache() *Cache {
+	return &Cache{concrete: make(map[ssa.Value]ssa.Value)}
+}
+
+// Len returns the number of values and methods cached.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.concrete)
+	c.methods.Iterate(func(_ types.Type, v interface{}) {
+		n += len(v.(map[string]*ssa.Function))
+	})
+	return n
+}
+
+// concreteImpl returns the SSA value with the most concrete type of v, i.e.
+// v chased through calls, conversions to interfaces, type assertions and
+// loads of structs, caching each value of the chain.
+func (c *Cache) concreteImpl(v ssa.Value) ssa.Value {
+	if c == nil {
+		return c.chase(v)
+	}
+	metrics.ImplCacheGets.Inc()
+	c.mu.Lock()
+	cv, ok := c.concrete[v]
+	c.mu.Unlock()
+	if ok {
+		return cv
+	}
+	metrics.ImplCacheMisses.Inc()
+	cv = c.chase(v)
+	c.mu.Lock()
+	c.concrete[v] = cv
+	c.mu.Unlock()
+	return cv
+}
+
+// lookupMethod returns the method meth of type t in prog, or nil if not found.
+func (c *Cache) lookupMethod(prog *ssa.Program, t types.Type, meth *types.Func) *ssa.Function {
+	if c == nil {
+		return prog.LookupMethod(t, meth.Pkg(), meth.Name())
+	}
+	id := meth.Id()
+	metrics.ImplCacheGets.Inc()
+	c.mu.Lock()
+	fns, _ := c.methods.At(t).(map[string]*ssa.Function)
+	fn, ok := fns[id]
+	c.mu.Unlock()
+	if ok {
+		return fn
+	}
+	metrics.ImplCacheMisses.Inc()
+	fn = prog.LookupMethod(t, meth.Pkg(), meth.Name())
+	c.mu.Lock()
+	fns, _ = c.methods.At(t).(map[string]*ssa.Function)
+	if fns == nil {
+		fns = make(map[string]*ssa.Function)
+		c.methods.Set(t, fns)
+	}
+	fns[id] = fn
+	c.mu.Unlock()
+	return fn
+}
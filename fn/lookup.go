@@ -6,7 +6,10 @@ import (
 	"go/token"
 	"go/types"
 	"log"
+	"sort"
 
+	"github.com/nickng/gospal/callgraph"
+	"github.com/nickng/gospal/metrics"
 	"golang.org/x/tools/go/ssa"
 )
 
@@ -14,6 +17,7 @@ var (
 	ErrNilMeth      = errors.New("interface method is nil")
 	ErrNilImpl      = errors.New("interface implementation is nil")
 	ErrAbstractMeth = errors.New("interface method is abstract")
+	ErrNoCallees    = errors.New("call has no callees in callgraph")
 )
 
 // MethTypeError is the error when interface Iface with method Meth is
@@ -63,6 +67,17 @@ func (e UnknownInvokeError) Error() string {
 // Return function is not guaranteed to be concrete, use FindConcrete on the
 // results to get a concrete function.
 func LookupImpl(prog *ssa.Program, meth *types.Func, impl ssa.Value) (*ssa.Function, error) {
+	return (*Cache)(nil).LookupImpl(prog, meth, impl)
+}
+
+// LookupImpl is LookupImpl with the concrete values and methods cached in c.
+func (c *Cache) LookupImpl(prog *ssa.Program, meth *types.Func, impl ssa.Value) (_ *ssa.Function, err error) {
+	metrics.Lookups.Inc()
+	defer func() {
+		if err != nil {
+			metrics.LookupMisses.Inc()
+		}
+	}()
 	if meth == nil {
 		return nil, ErrNilMeth
 	}
@@ -78,20 +93,20 @@ func LookupImpl(prog *ssa.Program, meth *types.Func, impl ssa.Value) (*ssa.Funct
 		}
 		return nil, MethNotFoundError{Meth: missing}
 	}
-	switch t := concreteImpl(impl).(type) {
+	switch t := c.concreteImpl(impl).(type) {
 	case *ssa.Alloc:
-		if fn := prog.LookupMethod(t.Type(), meth.Pkg(), meth.Name()); fn != nil {
+		if fn := c.lookupMethod(prog, t.Type(), meth); fn != nil {
 			return fn, nil
 		}
 		return nil, ErrAbstractMeth
 	case *ssa.Extract:
 		// Implementation is a tuple.
-		if fn := prog.LookupMethod(t.Type(), meth.Pkg(), meth.Name()); fn != nil {
+		if fn := c.lookupMethod(prog, t.Type(), meth); fn != nil {
 			return fn, nil
 		}
 		return nil, ErrAbstractMeth
 	case *ssa.Parameter:
-		if fn := prog.LookupMethod(t.Type(), meth.Pkg(), meth.Name()); fn != nil {
+		if fn := c.lookupMethod(prog, t.Type(), meth); fn != nil {
 			return fn, nil
 		}
 		return nil, ErrAbstractMeth
@@ -99,7 +114,7 @@ func LookupImpl(prog *ssa.Program, meth *types.Func, impl ssa.Value) (*ssa.Funct
 		// Merging of implementation (e.g. by reflection)
 		// The edges are not important as long as they are type checked
 		// and the Phi value's type is used.
-		if fn := prog.LookupMethod(t.Type(), meth.Pkg(), meth.Name()); fn != nil {
+		if fn := c.lookupMethod(prog, t.Type(), meth); fn != nil {
 			return fn, nil
 		}
 		return nil, ErrAbstractMeth
@@ -111,25 +126,93 @@ func LookupImpl(prog *ssa.Program, meth *types.Func, impl ssa.Value) (*ssa.Funct
 	}
 }
 
+// LookupImpls finds the candidate implementation Functions of a given
+// interface/abstract type.
+// If the implementation can be determined statically (see LookupImpl), the
+// result is the single implementation. Otherwise (e.g. the interface is a
+// function parameter), the candidates are the methods of the types in prog
+// which implement the interface. The returned functions are concrete.
+func LookupImpls(prog *ssa.Program, meth *types.Func, impl ssa.Value) ([]*ssa.Function, error) {
+	return (*Cache)(nil).LookupImpls(prog, meth, impl)
+}
+
+// LookupImpls is LookupImpls with the concrete values and methods cached in c.
+func (c *Cache) LookupImpls(prog *ssa.Program, meth *types.Func, impl ssa.Value) ([]*ssa.Function, error) {
+	fn, err := c.LookupImpl(prog, meth, impl)
+	if err == nil {
+		return []*ssa.Function{FindConcrete(prog, fn)}, nil
+	}
+	if _, unknown := err.(UnknownInvokeError); err != ErrAbstractMeth && !unknown {
+		return nil, err
+	}
+	iface, ok := impl.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, err
+	}
+	seen := make(map[*ssa.Function]bool)
+	var fns []*ssa.Function
+	for _, t := range prog.RuntimeTypes() {
+		if types.IsInterface(t) || !types.Implements(t, iface) {
+			continue
+		}
+		if fn := c.lookupMethod(prog, t, meth); fn != nil {
+			if fn = FindConcrete(prog, fn); !seen[fn] {
+				seen[fn] = true
+				fns = append(fns, fn)
+			}
+		}
+	}
+	if len(fns) == 0 {
+		return nil, err
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].String() < fns[j].String() })
+	return fns, nil
+}
+
+// LookupCallees finds the concrete Functions which may be called by c
+// according to the callgraph g, ordered by name.
+// Unlike LookupImpls, this also resolves calls of function values.
+func LookupCallees(prog *ssa.Program, g *callgraph.Graph, c *ssa.CallCommon) ([]*ssa.Function, error) {
+	seen := make(map[*ssa.Function]bool)
+	var fns []*ssa.Function
+	for _, fn := range g.Callees(c) {
+		if fn = FindConcrete(prog, fn); !seen[fn] {
+			seen[fn] = true
+			fns = append(fns, fn)
+		}
+	}
+	if len(fns) == 0 {
+		return nil, ErrNoCallees
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].String() < fns[j].String() })
+	return fns, nil
+}
+
 // concreteImpl finds the SSA value with the most concrete type.
 func concreteImpl(v ssa.Value) ssa.Value {
+	return (*Cache)(nil).concreteImpl(v)
+}
+
+// chase returns the most concrete value of v, where the values of the chain
+// are resolved by c.
+func (c *Cache) chase(v ssa.Value) ssa.Value {
 	switch instr := v.(type) {
 	case *ssa.Call:
 		if instr.Call.IsInvoke() {
-			return concreteImpl(instr.Call.Value) // use return value.
+			return c.concreteImpl(instr.Call.Value) // use return value.
 		}
 		if fn := instr.Call.StaticCallee(); fn != nil && len(fn.Blocks) > 0 {
-			return concreteImpl(fnBodyRetval(fn)) // use return value from func body.
+			return c.concreteImpl(fnBodyRetval(fn)) // use return value from func body.
 		}
 	case *ssa.MakeInterface:
-		return concreteImpl(instr.X) // revert interface to original struct.
+		return c.concreteImpl(instr.X) // revert interface to original struct.
 	case *ssa.TypeAssert:
-		return concreteImpl(instr.X) // revert assert to original.
+		return c.concreteImpl(instr.X) // revert assert to original.
 	case *ssa.UnOp:
 		if instr.Op == token.MUL {
 			switch instr.Type().Underlying().(type) {
 			case *types.Struct:
-				return concreteImpl(instr.X)
+				return c.concreteImpl(instr.X)
 			case *types.Interface: // Interface is always a pointer, so don't need to deref.
 				return instr
 			}
@@ -159,3 +159,75 @@ func TestChainedCall(t *testing.T) {
 	}
 	t.Logf("%v has type %v", c.Call.Value.Name(), fn.String())
 }
+
+// Tests lookup of candidate implementations of interface parameter.
+func TestLookupCandidates(t *testing.T) {
+	info, err := build.FromFiles("testdata/candidates.go").Default().Build()
+	if err != nil {
+		t.Errorf("SSA build failed: %v", err)
+	}
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		t.Errorf("no main package: %v", err)
+	}
+	var c *ssa.Call
+	for _, instr := range mains[0].Func("call").Blocks[0].Instrs {
+		if call, ok := instr.(*ssa.Call); ok && call.Call.IsInvoke() {
+			c = call
+		}
+	}
+	if c == nil {
+		t.Fatalf("Expecting an invoke call in main.call")
+	}
+	t.Logf("Lookup of %v with method %v (from interface parameter)", c, c.Call.Method)
+	fns, err := LookupImpls(info.Prog, c.Call.Method, c.Call.Value)
+	if err != nil {
+		t.Errorf("cannot find candidate implementations of %v: %v", c, err)
+	}
+	var got []string
+	for _, fn := range fns {
+		got = append(got, fn.Signature.Recv().Type().String())
+	}
+	if expect := []string{"*main.t", "main.u"}; len(got) != len(expect) || got[0] != expect[0] || got[1] != expect[1] {
+		t.Errorf("Candidate lookup wrong:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+	}
+}
+
+// Tests cached lookups of chained calls resolve as uncached lookups, and hit
+// the cache when repeated.
+func TestCache(t *testing.T) {
+	info, err := build.FromFiles("testdata/chained.go").Default().Build()
+	if err != nil {
+		t.Errorf("SSA build failed: %v", err)
+	}
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		t.Errorf("no main package: %v", err)
+	}
+	cache := NewCache()
+	for _, idx := range []int{7, 9} {
+		c, ok := mains[0].Func("main").Blocks[0].Instrs[idx].(*ssa.Call)
+		if !ok {
+			t.Fatalf("Expecting an invoke call: %v", mains[0].Func("main").Blocks[0].Instrs[idx])
+		}
+		expect, err := LookupImpl(info.Prog, c.Call.Method, c.Call.Value)
+		if err != nil {
+			t.Errorf("cannot find concrete implementation of %v: %v", c, err)
+		}
+		for i := 0; i < 2; i++ {
+			got, err := cache.LookupImpl(info.Prog, c.Call.Method, c.Call.Value)
+			if err != nil || got != expect {
+				t.Errorf("Cached lookup wrong:\nExpect:\t%v\nGot:\t%v (%v)\n", expect, got, err)
+			}
+		}
+	}
+	n := cache.Len()
+	if n == 0 {
+		t.Errorf("Expecting cached values and methods")
+	}
+	c := mains[0].Func("main").Blocks[0].Instrs[7].(*ssa.Call)
+	cache.LookupImpl(info.Prog, c.Call.Method, c.Call.Value)
+	if cache.Len() != n {
+		t.Errorf("Cache size mismatch after repeated lookup:\nExpect:\t%d\nGot:\t%d\n", n, cache.Len())
+	}
+}
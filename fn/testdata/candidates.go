@@ -0,0 +1,24 @@
+// +build ignore
+
+package main
+
+type t struct{}
+
+func (*t) f() {}
+
+type u struct{}
+
+func (u) f() {}
+
+type fer interface {
+	f()
+}
+
+func call(x fer) {
+	x.f()
+}
+
+func main() {
+	call(new(t))
+	call(u{})
+}
@@ -7,6 +7,7 @@ import (
 	"go/types"
 	"log"
 
+	"github.com/nickng/gospal/internal/intern"
 	"github.com/nickng/gospal/store"
 
 	"golang.org/x/tools/go/ssa"
@@ -93,6 +94,12 @@ func (d *Definition) FreeVar(i int) store.Key {
 	return d.Parameters[d.NParam+i]
 }
 
+// Bindings returns the variables bound to the free variables of a closure, in
+// the scope where the closure is created.
+func (d *Definition) Bindings() []ssa.Value {
+	return d.bindings
+}
+
 // Return returns the i-th return values in the function body.
 // Note that it only returns the most commonly used
 func (d *Definition) Return(i int) store.Key {
@@ -111,20 +118,39 @@ func (d *Definition) IsReturn(k store.Key) bool {
 	return false
 }
 
-// getName returns the function name as "package".function_name.
+// Name returns the name of the function, which is also the name of its
+// instances (see Instance.Name).
+func (d *Definition) Name() string {
+	return intern.Default.Bytes(d.getName())
+}
+
+// getName returns the function name as "package".function_name, or
+// "package".Type.method_name for methods, so methods of the same name are
+// distinct for each receiver type.
 func (d *Definition) getName() []byte {
 	var buf bytes.Buffer
 	if r := d.Function.Signature.Recv(); r != nil {
-		buf.WriteString(fmt.Sprintf("\"%s\".%s", r.Pkg().Path(), r.Name()))
+		buf.WriteString("\"" + r.Pkg().Path() + "\"." + recvTypeName(r.Type()))
 	} else {
 		if pkg := d.Function.Package(); pkg != nil {
-			buf.WriteString(fmt.Sprintf("\"%s\"", pkg.Pkg.Path()))
+			buf.WriteString("\"" + pkg.Pkg.Path() + "\"")
 		}
 	}
-	buf.WriteString(fmt.Sprintf(".%s", d.Function.Name()))
+	buf.WriteString("." + d.Function.Name())
 	return buf.Bytes()
 }
 
+// recvTypeName returns the name of receiver type t, i.e. T for T or *T.
+func recvTypeName(t types.Type) string {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return t.String()
+}
+
 func (d *Definition) String() string {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("func def(%d): ", len(d.Parameters)))
@@ -163,7 +189,7 @@ func (d *Definition) String() string {
 }
 
 func (d *Definition) UniqName() string {
-	return string(d.getName())
+	return d.Name()
 }
 
 // hasBody returns true if the function has body defined.
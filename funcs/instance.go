@@ -1,30 +1,39 @@
 package funcs
 
 import (
-	"fmt"
 	"sync"
 
+	"github.com/nickng/gospal/internal/intern"
 	"golang.org/x/tools/go/ssa"
 )
 
-var instances struct {
+// Instances numbers the instances of functions, so instances of the same
+// function are distinct. Instances is safe for concurrent use.
+type Instances struct {
 	mu    sync.Mutex
 	calls map[*ssa.Function]int
 }
 
-// Instantiate materialises a new function call instance.
+// NewInstances returns a new Instances, numbering from 0.
+func NewInstances() *Instances {
+	return &Instances{calls: make(map[*ssa.Function]int)}
+}
+
+var instances = NewInstances()
+
+// Instantiate materialises a new function call instance, numbered by the
+// package-wide Instances.
 func Instantiate(call *Call) *Instance {
-	if instances.calls == nil {
-		instances.calls = make(map[*ssa.Function]int)
-	}
-	instances.mu.Lock()
-	defer instances.mu.Unlock()
+	return instances.Instantiate(call)
+}
+
+// Instantiate materialises a new function call instance.
+func (is *Instances) Instantiate(call *Call) *Instance {
+	is.mu.Lock()
+	defer is.mu.Unlock()
 	f := call.Function()
-	if _, ok := instances.calls[f]; !ok {
-		instances.calls[f] = 0
-	}
-	seq := instances.calls[f]
-	instances.calls[f]++
+	seq := is.calls[f]
+	is.calls[f]++
 	return &Instance{
 		call: call,
 		seq:  seq,
@@ -57,12 +66,12 @@ func (i Instance) Name() string {
 	if i.call == nil {
 		return "_emptycall_"
 	}
-	return string(i.Definition().getName())
+	return i.Definition().Name()
 }
 
 func (i Instance) UniqName() string {
 	if i.call == nil {
 		return "_emptycall_"
 	}
-	return fmt.Sprintf("%s%d", string(i.Definition().getName()), i.seq)
+	return intern.Sprintf("%s%d", i.Definition().getName(), i.seq)
 }
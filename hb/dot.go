@@ -0,0 +1,53 @@
+package hb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// edgeStyles are the dot attributes of each kind of edge.
+var edgeStyles = map[EdgeKind]string{
+	Program:   "",
+	SpawnEdge: " [color=blue]",
+	Sync:      " [color=red]",
+	LockEdge:  " [color=gray]",
+}
+
+// WriteDot writes the happens-before graph to w in graphviz dot format, with
+// the events of each goroutine in a cluster. Edges which may not hold in every
+// execution are dashed.
+func (g *Graph) WriteDot(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("digraph hb {\n")
+	for i, t := range g.gs {
+		fmt.Fprintf(bufw, "  subgraph cluster_%d {\n    label=%q;\n", i, t.name)
+		for _, e := range g.Events {
+			if e.g != t {
+				continue
+			}
+			label := e.Kind.String()
+			if e.Object != "" {
+				label += " " + e.Object
+			}
+			if e.Pos.IsValid() {
+				label += "\n" + e.Pos.String()
+			}
+			fmt.Fprintf(bufw, "    e%d [label=%q];\n", e.ID, label)
+		}
+		bufw.WriteString("  }\n")
+	}
+	for _, e := range g.Edges {
+		style := edgeStyles[e.Kind]
+		if !e.Must {
+			if style == "" {
+				style = " [style=dashed]"
+			} else {
+				style = style[:len(style)-1] + ",style=dashed]"
+			}
+		}
+		fmt.Fprintf(bufw, "  e%d -> e%d%s;\n", e.From.ID, e.To.ID, style)
+	}
+	bufw.WriteString("}\n")
+	return bufw.Flush()
+}
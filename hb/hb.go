@@ -0,0 +1,720 @@
+// Package hb builds a happens-before graph of the synchronisation events of a
+// program, i.e. goroutine spawns, channel operations, sync.WaitGroup joins and
+// lock acquisitions, and answers queries of the ordering between two source
+// positions.
+//
+// Goroutines are identified by their spawn sites (go statements), starting
+// from main.main, and functions called (statically) by a goroutine are part of
+// the goroutine, as in the race detector. A goroutine spawned in a loop (or by
+// a goroutine with many instances) has many instances, and the events of
+// different instances are not ordered.
+//
+// The edges of the graph are
+//
+//   - program order between the events of a goroutine,
+//   - spawn, from a go statement to the beginning of the spawned goroutine,
+//   - sync, from a send on (or close of) a channel to a receive of the channel
+//     in another goroutine, and from sync.WaitGroup.Done to
+//     sync.WaitGroup.Wait of the same WaitGroup, and
+//   - lock, from an unlock of a mutex to a lock of the mutex in another
+//     goroutine.
+//
+// Channel operations are matched by channel, so a sync edge relates a send
+// and a receive which may (not must) communicate. Orderings are only derived
+// from sync edges which must hold, i.e. from a send (or close) which is the
+// only one of its channel in a goroutine with a single instance (to a receive
+// outside of select, and in a goroutine with a single instance unless closed),
+// and from all Done of a WaitGroup. Lock edges depend on the execution and are never used for
+// ordering.
+package hb
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+
+	gssa "github.com/nickng/gospal/ssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Kind is a kind of event.
+type Kind int
+
+// Kinds of events.
+const (
+	Spawn  Kind = iota // go statement.
+	Begin              // Beginning of a goroutine.
+	Send               // Send on a channel.
+	Recv               // Receive from a channel.
+	Close              // Close of a channel.
+	Add                // sync.WaitGroup.Add.
+	Done               // sync.WaitGroup.Done.
+	Wait               // sync.WaitGroup.Wait.
+	Lock               // Lock (or RLock) of a mutex.
+	Unlock             // Unlock (or RUnlock) of a mutex.
+)
+
+var kindNames = [...]string{"spawn", "begin", "send", "recv", "close", "add", "done", "wait", "lock", "unlock"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// EdgeKind is a kind of happens-before edge.
+type EdgeKind int
+
+// Kinds of edges.
+const (
+	Program   EdgeKind = iota // Program order in a goroutine.
+	SpawnEdge                 // Spawn of a goroutine.
+	Sync                      // Channel or WaitGroup synchronisation.
+	LockEdge                  // Unlock followed by lock of a mutex.
+)
+
+var edgeKindNames = [...]string{"program", "spawn", "sync", "lock"}
+
+func (k EdgeKind) String() string {
+	if int(k) < len(edgeKindNames) {
+		return edgeKindNames[k]
+	}
+	return fmt.Sprintf("EdgeKind(%d)", int(k))
+}
+
+// Event is a synchronisation event of a goroutine.
+type Event struct {
+	ID        int
+	Kind      Kind
+	Pos       token.Position // Position of the event.
+	Goroutine string         // Root function of the goroutine.
+	Object    string         // Channel, WaitGroup or mutex (empty for spawns).
+
+	point
+	obj string // Key of Object.
+}
+
+func (e *Event) String() string {
+	if e.Object == "" {
+		return fmt.Sprintf("%s: %s in goroutine %s", e.Pos, e.Kind, e.Goroutine)
+	}
+	return fmt.Sprintf("%s: %s %s in goroutine %s", e.Pos, e.Kind, e.Object, e.Goroutine)
+}
+
+// Edge is a happens-before edge between two events.
+type Edge struct {
+	From, To *Event
+	Kind     EdgeKind
+	Must     bool // The ordering holds in every execution.
+}
+
+// point is an instruction of a goroutine.
+type point struct {
+	instr  ssa.Instruction
+	anchor ssa.Instruction // Instruction in the goroutine root function.
+	init   bool            // In a package initialiser.
+	g      *goroutine
+}
+
+// goroutine is a (static) goroutine.
+type goroutine struct {
+	root    *ssa.Function
+	name    string
+	spawner *goroutine
+	spawn   *ssa.Go // Spawn site (nil for main).
+	at      point   // Spawn site in the spawner.
+	multi   bool    // Many instances may run in parallel.
+	free    map[*ssa.FreeVar]ssa.Value
+	begin   *Event
+	points  []point // Instructions, for position queries.
+}
+
+// Graph is a happens-before graph.
+type Graph struct {
+	Events []*Event
+	Edges  []Edge
+
+	fset    *token.FileSet
+	spawned map[spawnKey]*goroutine
+	succs   map[*Event][]Edge
+	reach   map[ssa.Instruction]map[ssa.Instruction]bool
+	gs      []*goroutine
+}
+
+type spawnKey struct {
+	spawn   *ssa.Go
+	spawner *goroutine
+}
+
+// Build returns the happens-before graph of the main packages of the program.
+func Build(info *gssa.Info) (*Graph, error) {
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		return nil, err
+	}
+	g := &Graph{
+		fset:    info.FSet,
+		spawned: make(map[spawnKey]*goroutine),
+		succs:   make(map[*Event][]Edge),
+		reach:   make(map[ssa.Instruction]map[ssa.Instruction]bool),
+	}
+	for _, main := range mains {
+		mainFn := main.Func("main")
+		if mainFn == nil {
+			continue
+		}
+		t := &goroutine{root: mainFn, name: mainFn.String(), free: make(map[*ssa.FreeVar]ssa.Value)}
+		g.gs = append(g.gs, t)
+		t.begin = g.event(Begin, point{g: t}, mainFn.Pos(), "", "")
+		if initFn := main.Func("init"); initFn != nil {
+			g.analyse(t, initFn, true)
+		}
+		g.analyse(t, mainFn, false)
+	}
+	g.link()
+	return g, nil
+}
+
+// isStd returns true if the package path is in the standard library.
+func isStd(fn *ssa.Function) bool {
+	if fn.Pkg == nil {
+		return true
+	}
+	path := fn.Pkg.Pkg.Path()
+	if path == "main" || path == "command-line-arguments" {
+		return false
+	}
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// event adds an event to the graph.
+func (g *Graph) event(kind Kind, p point, pos token.Pos, obj, name string) *Event {
+	e := &Event{
+		ID:        len(g.Events),
+		Kind:      kind,
+		Pos:       g.fset.Position(pos),
+		Goroutine: p.g.name,
+		Object:    name,
+		point:     p,
+		obj:       obj,
+	}
+	g.Events = append(g.Events, e)
+	return e
+}
+
+// work is a function to analyse in a goroutine, reached from anchor in the
+// root function of the goroutine.
+type work struct {
+	fn     *ssa.Function
+	anchor ssa.Instruction
+}
+
+// analyse records the events of the functions reachable from root in
+// goroutine t.
+func (g *Graph) analyse(t *goroutine, root *ssa.Function, init bool) {
+	visited := map[work]bool{{fn: root}: true}
+	queue := []work{{fn: root}}
+	for len(queue) > 0 {
+		w := queue[0]
+		queue = queue[1:]
+		if len(w.fn.Blocks) == 0 || isStd(w.fn) {
+			continue
+		}
+		for _, b := range w.fn.Blocks {
+			for _, instr := range b.Instrs {
+				anchor := w.anchor
+				if anchor == nil || w.fn == t.root {
+					anchor = instr
+				}
+				p := point{instr: instr, anchor: anchor, init: init, g: t}
+				t.points = append(t.points, p)
+				g.visit(t, p)
+				if call, ok := instr.(ssa.CallInstruction); ok {
+					if _, ok := instr.(*ssa.Go); ok {
+						continue
+					}
+					if callee := g.callee(t, call.Common()); callee != nil && callee != t.root {
+						next := work{fn: callee, anchor: w.anchor}
+						if w.fn == t.root || w.anchor == nil {
+							next.anchor = anchor
+						}
+						if !visited[next] {
+							visited[next] = true
+							queue = append(queue, next)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// visit records the events of the instruction at p.
+func (g *Graph) visit(t *goroutine, p point) {
+	switch instr := p.instr.(type) {
+	case *ssa.Go:
+		g.spawn(t, instr, p)
+	case *ssa.Send:
+		g.chanEvent(Send, p, instr.Pos(), instr.Chan)
+	case *ssa.UnOp:
+		if instr.Op == token.ARROW {
+			g.chanEvent(Recv, p, instr.Pos(), instr.X)
+		}
+	case *ssa.Select:
+		for _, st := range instr.States {
+			if st.Dir == types.SendOnly {
+				g.chanEvent(Send, p, st.Pos, st.Chan)
+			} else {
+				g.chanEvent(Recv, p, st.Pos, st.Chan)
+			}
+		}
+	case ssa.CallInstruction:
+		c := instr.Common()
+		if b, ok := c.Value.(*ssa.Builtin); ok && b.Name() == "close" {
+			g.chanEvent(Close, p, c.Pos(), c.Args[0])
+			return
+		}
+		callee := c.StaticCallee()
+		if callee == nil || len(c.Args) == 0 {
+			return
+		}
+		var kind Kind
+		switch callee.String() {
+		case "(*sync.WaitGroup).Add":
+			kind = Add
+		case "(*sync.WaitGroup).Done":
+			kind = Done
+		case "(*sync.WaitGroup).Wait":
+			kind = Wait
+		case "(*sync.Mutex).Lock", "(*sync.RWMutex).Lock", "(*sync.RWMutex).RLock":
+			kind = Lock
+		case "(*sync.Mutex).Unlock", "(*sync.RWMutex).Unlock", "(*sync.RWMutex).RUnlock":
+			kind = Unlock
+		default:
+			return
+		}
+		obj, name := g.object(t, c.Args[0])
+		g.event(kind, p, c.Pos(), obj, name)
+	}
+}
+
+// chanEvent records an operation on channel ch.
+func (g *Graph) chanEvent(kind Kind, p point, pos token.Pos, ch ssa.Value) {
+	obj, name := g.object(p.g, ch)
+	g.event(kind, p, pos, obj, name)
+}
+
+// callee returns the function called by c, and binds the captures of a
+// closure called in goroutine t.
+func (g *Graph) callee(t *goroutine, c *ssa.CallCommon) *ssa.Function {
+	if mc, ok := c.Value.(*ssa.MakeClosure); ok {
+		fn := mc.Fn.(*ssa.Function)
+		for i, fv := range fn.FreeVars {
+			if i < len(mc.Bindings) {
+				t.free[fv] = g.resolve(t, mc.Bindings[i])
+			}
+		}
+		return fn
+	}
+	return c.StaticCallee()
+}
+
+// resolve returns the value in the spawner bound to v, if v is a capture or
+// a parameter of the root function of goroutine t.
+func (g *Graph) resolve(t *goroutine, v ssa.Value) ssa.Value {
+	v = base(v)
+	switch v := v.(type) {
+	case *ssa.FreeVar:
+		if b, ok := t.free[v]; ok {
+			return b
+		}
+	case *ssa.Parameter:
+		if t.spawn == nil || v.Parent() != t.root {
+			return v
+		}
+		for i, param := range t.root.Params {
+			if param == v && i < len(t.spawn.Call.Args) {
+				return g.resolve(t.spawner, t.spawn.Call.Args[i])
+			}
+		}
+	}
+	return v
+}
+
+// object returns the key and name of the channel, WaitGroup or mutex v.
+func (g *Graph) object(t *goroutine, v ssa.Value) (key, name string) {
+	switch v := g.resolve(t, v).(type) {
+	case *ssa.Global:
+		return "g:" + v.String(), v.String()
+	case *ssa.FieldAddr:
+		if ptr, ok := v.X.Type().Underlying().(*types.Pointer); ok {
+			if s, ok := ptr.Elem().Underlying().(*types.Struct); ok {
+				name := fmt.Sprintf("(%s).%s", ptr.Elem(), s.Field(v.Field).Name())
+				return "f:" + name, name
+			}
+		}
+		return fmt.Sprintf("v:%p", v), v.Name()
+	case *ssa.Alloc:
+		name := v.Comment
+		if name == "" {
+			name = v.Name()
+		}
+		return fmt.Sprintf("v:%p", v), fmt.Sprintf("%s (%s)", name, g.fset.Position(v.Pos()))
+	default:
+		name := v.Name()
+		if pos := v.Pos(); pos.IsValid() {
+			name = fmt.Sprintf("%s (%s)", name, g.fset.Position(pos))
+		}
+		return fmt.Sprintf("v:%p", v), name
+	}
+}
+
+// spawn creates (and analyses) the goroutine spawned by s in goroutine t.
+func (g *Graph) spawn(t *goroutine, s *ssa.Go, p point) {
+	spawnEv := g.event(Spawn, p, s.Pos(), "", "")
+	k := spawnKey{spawn: s, spawner: t}
+	if child, ok := g.spawned[k]; ok {
+		g.addEdge(spawnEv, child.begin, SpawnEdge, true)
+		return
+	}
+	var root *ssa.Function
+	var bindings []ssa.Value
+	switch fv := s.Call.Value.(type) {
+	case *ssa.MakeClosure:
+		root, bindings = fv.Fn.(*ssa.Function), fv.Bindings
+	default:
+		root = s.Call.StaticCallee()
+	}
+	if root == nil || s.Call.IsInvoke() || isStd(root) {
+		return
+	}
+	child := &goroutine{
+		root:    root,
+		name:    root.String(),
+		spawner: t,
+		spawn:   s,
+		at:      p,
+		multi:   t.multi || g.reachable(s)[s],
+		free:    make(map[*ssa.FreeVar]ssa.Value),
+	}
+	for i, fv := range root.FreeVars {
+		if i < len(bindings) {
+			child.free[fv] = g.resolve(t, bindings[i])
+		}
+	}
+	g.spawned[k] = child
+	g.gs = append(g.gs, child)
+	child.begin = g.event(Begin, point{g: child}, root.Pos(), "", "")
+	g.addEdge(spawnEv, child.begin, SpawnEdge, true)
+	g.analyse(child, root, false)
+}
+
+// addEdge adds an edge from a to b.
+func (g *Graph) addEdge(a, b *Event, kind EdgeKind, must bool) {
+	e := Edge{From: a, To: b, Kind: kind, Must: must}
+	g.Edges = append(g.Edges, e)
+	g.succs[a] = append(g.succs[a], e)
+}
+
+// link adds the program order, sync and lock edges between the events.
+func (g *Graph) link() {
+	byGoroutine := make(map[*goroutine][]*Event)
+	byObj := make(map[string][]*Event)
+	for _, e := range g.Events {
+		byGoroutine[e.g] = append(byGoroutine[e.g], e)
+		if e.obj != "" {
+			byObj[e.obj] = append(byObj[e.obj], e)
+		}
+	}
+	// Program order, transitively reduced.
+	for _, t := range g.gs {
+		evs := byGoroutine[t]
+		for _, a := range evs {
+			for _, b := range evs {
+				if a == b || !g.po(a.point, b.point) {
+					continue
+				}
+				direct := true
+				for _, c := range evs {
+					if c != a && c != b && g.po(a.point, c.point) && g.po(c.point, b.point) {
+						direct = false
+						break
+					}
+				}
+				if direct {
+					g.addEdge(a, b, Program, true)
+				}
+			}
+		}
+	}
+	for _, evs := range byObj {
+		var signals, dones int
+		for _, e := range evs {
+			switch e.Kind {
+			case Send, Close:
+				signals++
+			case Done:
+				dones++
+			}
+		}
+		for _, a := range evs {
+			for _, b := range evs {
+				if a.g == b.g {
+					continue
+				}
+				switch {
+				case (a.Kind == Send || a.Kind == Close) && b.Kind == Recv:
+					// A receive in a select may not happen, and a send is
+					// received by only one instance of a goroutine.
+					_, sel := b.instr.(*ssa.Select)
+					must := signals == 1 && !a.g.multi && !sel && (a.Kind == Close || !b.g.multi)
+					g.addEdge(a, b, Sync, must)
+				case a.Kind == Done && b.Kind == Wait:
+					g.addEdge(a, b, Sync, true)
+				case a.Kind == Unlock && b.Kind == Lock:
+					g.addEdge(a, b, LockEdge, false)
+				}
+			}
+		}
+	}
+}
+
+// reachable returns the instructions reachable from instruction from (in the
+// same function invocation), including from itself if it is in a loop.
+func (g *Graph) reachable(from ssa.Instruction) map[ssa.Instruction]bool {
+	if r, ok := g.reach[from]; ok {
+		return r
+	}
+	r := make(map[ssa.Instruction]bool)
+	b := from.Block()
+	after := false
+	for _, instr := range b.Instrs {
+		if after {
+			r[instr] = true
+		}
+		after = after || instr == from
+	}
+	visited := make(map[*ssa.BasicBlock]bool)
+	queue := append([]*ssa.BasicBlock(nil), b.Succs...)
+	for len(queue) > 0 {
+		blk := queue[0]
+		queue = queue[1:]
+		if visited[blk] {
+			continue
+		}
+		visited[blk] = true
+		for _, instr := range blk.Instrs {
+			r[instr] = true
+		}
+		queue = append(queue, blk.Succs...)
+	}
+	g.reach[from] = r
+	return r
+}
+
+// ordered returns true if instruction a is before b in every execution of
+// their function.
+func (g *Graph) ordered(a, b ssa.Instruction) bool {
+	return g.reachable(a)[b] && !g.reachable(b)[a]
+}
+
+// po returns true if p is before q in program order of their goroutine (in
+// the same instance).
+func (g *Graph) po(p, q point) bool {
+	if p.g != q.g {
+		return false
+	}
+	switch {
+	case p.instr == nil: // Beginning of the goroutine (of every instance).
+		return q.instr != nil
+	case q.instr == nil:
+		return false
+	case p.init != q.init:
+		return p.init
+	}
+	a, b := p.anchor, q.anchor
+	if a == b {
+		a, b = p.instr, q.instr
+	}
+	if a == b || a.Parent() != b.Parent() {
+		return false
+	}
+	// Deferred calls run after the other instructions of the function, in
+	// reverse order.
+	_, da := a.(*ssa.Defer)
+	_, db := b.(*ssa.Defer)
+	switch {
+	case da && db:
+		return g.ordered(b, a)
+	case db:
+		return true
+	case da:
+		return false
+	}
+	return g.ordered(a, b)
+}
+
+// Before returns true if event a happens before event b in every execution.
+func (g *Graph) Before(a, b *Event) bool {
+	return g.before(a.point, b.point)
+}
+
+// before returns true if p happens before q, i.e. p is before q in program
+// order, or p is before an event which reaches an event before q by edges
+// which must hold.
+func (g *Graph) before(p, q point) bool {
+	return g.beforeBy(p, q, nil)
+}
+
+// beforeBy returns true if p happens before q (see before), without the
+// edges for which skip returns true.
+func (g *Graph) beforeBy(p, q point, skip func(Edge) bool) bool {
+	if p.g == q.g {
+		// Different instances of a goroutine are not ordered.
+		return !p.g.multi && g.po(p, q)
+	}
+	visited := make(map[*Event]bool)
+	var queue []*Event
+	for _, e := range g.Events {
+		if e.g == p.g && (e.point == p || g.po(p, e.point)) {
+			visited[e] = true
+			queue = append(queue, e)
+		}
+	}
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		if e.g == q.g && (e.point == q || g.po(e.point, q)) {
+			return true
+		}
+		for _, edge := range g.succs[e] {
+			if edge.Must && !visited[edge.To] && (skip == nil || !skip(edge)) {
+				visited[edge.To] = true
+				queue = append(queue, edge.To)
+			}
+		}
+		// Program order edges are transitively reduced, so follow the
+		// program order directly.
+		for _, f := range g.Events {
+			if f.g == e.g && !visited[f] && g.po(e.point, f.point) {
+				visited[f] = true
+				queue = append(queue, f)
+			}
+		}
+	}
+	return false
+}
+
+// Order is the ordering between two positions.
+type Order int
+
+// Orderings of positions.
+const (
+	Concurrent Order = iota // Neither happens before the other.
+	IsBefore                // First happens before second.
+	IsAfter                 // Second happens before first.
+)
+
+func (o Order) String() string {
+	switch o {
+	case IsBefore:
+		return "before"
+	case IsAfter:
+		return "after"
+	}
+	return "concurrent"
+}
+
+// ErrNoInstr is the error of a position without instructions of the
+// analysed goroutines.
+type ErrNoInstr struct {
+	Pos token.Position
+}
+
+func (e ErrNoInstr) Error() string {
+	return fmt.Sprintf("no instruction at %s", e.Pos)
+}
+
+// At returns the events at pos. The column of pos is ignored if it is 0, and
+// the filename is matched by suffix.
+func (g *Graph) At(pos token.Position) []*Event {
+	var evs []*Event
+	for _, e := range g.Events {
+		if match(pos, e.Pos) {
+			evs = append(evs, e)
+		}
+	}
+	return evs
+}
+
+// match returns true if position p is at pos.
+func match(pos, p token.Position) bool {
+	return p.Line == pos.Line && (pos.Column == 0 || p.Column == pos.Column) &&
+		p.Filename != "" && strings.HasSuffix(p.Filename, pos.Filename)
+}
+
+// points returns the instructions at pos in all goroutines.
+func (g *Graph) points(pos token.Position) []point {
+	var ps []point
+	for _, t := range g.gs {
+		for _, p := range t.points {
+			if ip := p.instr.Pos(); ip.IsValid() && match(pos, g.fset.Position(ip)) {
+				ps = append(ps, p)
+			}
+		}
+	}
+	for _, e := range g.At(pos) {
+		if e.instr == nil { // Beginning of goroutine.
+			ps = append(ps, e.point)
+		}
+	}
+	return ps
+}
+
+// Order returns the ordering of the code at positions a and b, e.g. IsBefore
+// if every instruction at a (in every goroutine) happens before every
+// instruction at b. The positions are matched as in At.
+func (g *Graph) Order(a, b token.Position) (Order, error) {
+	pa, pb := g.points(a), g.points(b)
+	if len(pa) == 0 {
+		return Concurrent, ErrNoInstr{Pos: a}
+	}
+	if len(pb) == 0 {
+		return Concurrent, ErrNoInstr{Pos: b}
+	}
+	all := func(xs, ys []point) bool {
+		for _, x := range xs {
+			for _, y := range ys {
+				if !g.before(x, y) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	switch {
+	case all(pa, pb):
+		return IsBefore, nil
+	case all(pb, pa):
+		return IsAfter, nil
+	}
+	return Concurrent, nil
+}
+
+// base returns the variable loaded by v (if v is a load), so that a value and
+// the loads of the same variable are identified.
+func base(v ssa.Value) ssa.Value {
+	switch u := v.(type) {
+	case *ssa.UnOp:
+		if u.Op == token.MUL {
+			return u.X
+		}
+	case *ssa.ChangeType:
+		return base(u.X)
+	case *ssa.MakeInterface:
+		return base(u.X)
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package hb
+
+import (
+	"bytes"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/ssa/build"
+)
+
+func line(n int) token.Position {
+	return token.Position{Filename: "testdata/hb.go", Line: n}
+}
+
+// Tests ordering by spawn, channel close and receive, and WaitGroup.
+func TestOrder(t *testing.T) {
+	info, err := build.FromFiles("testdata/hb.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	g, err := Build(info)
+	if err != nil {
+		t.Fatalf("happens-before graph failed: %v", err)
+	}
+	tests := []struct {
+		a, b  int
+		order Order
+	}{
+		{11, 14, IsBefore},   // x = 1 before spawn.
+		{15, 20, IsBefore},   // y = 2 before close and receive.
+		{18, 15, Concurrent}, // z = 3 not ordered with goroutine.
+		{27, 31, IsBefore},   // z++ before wg.Wait.
+		{27, 27, Concurrent}, // z++ in many goroutines.
+	}
+	for _, test := range tests {
+		order, err := g.Order(line(test.a), line(test.b))
+		if err != nil {
+			t.Errorf("Order of lines %d and %d failed: %v", test.a, test.b, err)
+			continue
+		}
+		if order != test.order {
+			t.Errorf("Order of lines %d and %d mismatch:\nExpect:\t%v\nGot:\t%v\n", test.a, test.b, test.order, order)
+		}
+	}
+	if _, err := g.Order(line(1), line(11)); err == nil {
+		t.Errorf("Expecting error for position without instructions")
+	}
+	var buf bytes.Buffer
+	if err := g.WriteDot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "close") {
+		t.Errorf("Expecting close event in dot output:\n%s", buf.String())
+	}
+}
+
+// Tests WaitGroup misuses.
+func TestWaitGroupMisuses(t *testing.T) {
+	info, err := build.FromFiles("testdata/wg.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	g, err := Build(info)
+	if err != nil {
+		t.Fatalf("happens-before graph failed: %v", err)
+	}
+	expect := map[int]string{
+		11: "add concurrent with wait",
+		21: "done without add",
+		27: "add after wait",
+	}
+	got := make(map[int]string)
+	for _, m := range g.WaitGroupMisuses() {
+		got[m.Event.Pos.Line] = m.Kind
+	}
+	for line, kind := range expect {
+		if got[line] != kind {
+			t.Errorf("Misuse at line %d mismatch:\nExpect:\t%s\nGot:\t%s\n", line, kind, got[line])
+		}
+	}
+	if len(got) != len(expect) {
+		t.Errorf("Misuses mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+	}
+}
+
+// Tests lifetimes of goroutines.
+func TestLifetimes(t *testing.T) {
+	info, err := build.FromFiles("testdata/lifetime.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	g, err := Build(info)
+	if err != nil {
+		t.Fatalf("happens-before graph failed: %v", err)
+	}
+	lts := g.Lifetimes()
+	if len(lts) != 2 {
+		t.Fatalf("Lifetimes mismatch:\nExpect:\t%d\nGot:\t%v\n", 2, lts)
+	}
+	worker, spin := lts[0], lts[1]
+	if !worker.Terminates || len(worker.Chans) != 1 || len(worker.WaitGroups) != 1 || len(worker.Contexts) != 1 {
+		t.Errorf("Lifetime of worker mismatch:\nExpect:\t%s\nGot:\t%v\n", "terminates, 1 channel, 1 WaitGroup, 1 context", worker)
+	}
+	if spin.Terminates {
+		t.Errorf("Lifetime of spin mismatch:\nExpect:\t%s\nGot:\t%v\n", "never terminates", spin)
+	}
+	var buf bytes.Buffer
+	if err := g.WriteLifetimesJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"goroutine": "main.worker"`) {
+		t.Errorf("Expecting worker in JSON output:\n%s", buf.String())
+	}
+}
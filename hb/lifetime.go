@@ -0,0 +1,181 @@
+package hb
+
+// Goroutine lifetimes.
+//
+// The lifetime of a spawned goroutine is summarised by its spawn site, the
+// synchronisation objects which can end it, i.e. the channels it receives
+// from (including in select and range), the WaitGroups it signals with Done,
+// and the contexts it waits for cancellation of, and whether its root function
+// can return at all. A goroutine which cannot return (e.g. for {} without
+// break) runs until the program exits.
+//
+// The report is an audit of the structured concurrency of a program, not an
+// error report: a goroutine which waits on a channel terminates only if the
+// channel is eventually sent to (or closed), which is checked by the deadlock
+// and leak detection.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Lifetime is the lifetime of a spawned goroutine.
+type Lifetime struct {
+	Goroutine  string         `json:"goroutine"`
+	Spawn      token.Position `json:"-"`
+	Multi      bool           `json:"multi"`      // Many instances may run in parallel.
+	Terminates bool           `json:"terminates"` // Root function can return.
+	Chans      []string       `json:"chans"`      // Channels received from.
+	WaitGroups []string       `json:"waitgroups"` // WaitGroups signalled by Done.
+	Contexts   []string       `json:"contexts"`   // Contexts waited for cancellation.
+}
+
+func (lt Lifetime) String() string {
+	var buf strings.Builder
+	instances := ""
+	if lt.Multi {
+		instances = ", many instances"
+	}
+	fmt.Fprintf(&buf, "%s: goroutine %s%s\n", lt.Spawn, lt.Goroutine, instances)
+	if lt.Terminates {
+		buf.WriteString("\tterminates: on return\n")
+	} else {
+		buf.WriteString("\tterminates: never (no return reachable)\n")
+	}
+	for _, item := range []struct {
+		what string
+		objs []string
+	}{
+		{"waits on channels", lt.Chans},
+		{"signals WaitGroups", lt.WaitGroups},
+		{"cancelled by contexts", lt.Contexts},
+	} {
+		if len(item.objs) > 0 {
+			fmt.Fprintf(&buf, "\t%s: %s\n", item.what, strings.Join(item.objs, ", "))
+		}
+	}
+	return buf.String()
+}
+
+// Lifetimes returns the lifetimes of the goroutines spawned by the program,
+// in order of spawn.
+func (g *Graph) Lifetimes() []Lifetime {
+	var lts []Lifetime
+	for _, t := range g.gs {
+		if t.spawn == nil { // main.
+			continue
+		}
+		lt := Lifetime{
+			Goroutine:  t.name,
+			Spawn:      g.fset.Position(t.spawn.Pos()),
+			Multi:      t.multi,
+			Terminates: returns(t.root),
+		}
+		chans, wgs, ctxs := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+		for _, p := range t.points {
+			switch instr := p.instr.(type) {
+			case *ssa.UnOp:
+				if instr.Op == token.ARROW {
+					g.waitOn(t, instr.X, chans, ctxs)
+				}
+			case *ssa.Select:
+				for _, st := range instr.States {
+					if st.Dir == types.RecvOnly {
+						g.waitOn(t, st.Chan, chans, ctxs)
+					}
+				}
+			case ssa.CallInstruction:
+				c := instr.Common()
+				if fn := c.StaticCallee(); fn != nil && fn.String() == "(*sync.WaitGroup).Done" && len(c.Args) > 0 {
+					_, name := g.object(t, c.Args[0])
+					wgs[name] = true
+				}
+			}
+		}
+		lt.Chans, lt.WaitGroups, lt.Contexts = sorted(chans), sorted(wgs), sorted(ctxs)
+		lts = append(lts, lt)
+	}
+	return lts
+}
+
+// waitOn records channel ch received from in goroutine t, as a context if ch
+// is the Done channel of a context.
+func (g *Graph) waitOn(t *goroutine, ch ssa.Value, chans, ctxs map[string]bool) {
+	if call, ok := base(ch).(*ssa.Call); ok && isContextDone(call.Common()) {
+		_, name := g.object(t, call.Common().Value)
+		ctxs[name] = true
+		return
+	}
+	_, name := g.object(t, ch)
+	chans[name] = true
+}
+
+// isContextDone returns true if c calls the Done method of a context.Context.
+func isContextDone(c *ssa.CallCommon) bool {
+	if !c.IsInvoke() || c.Method.Name() != "Done" {
+		return false
+	}
+	named, ok := c.Value.Type().(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// returns returns true if fn has a return instruction, i.e. a path of fn
+// returns.
+func returns(fn *ssa.Function) bool {
+	for _, b := range fn.Blocks {
+		if len(b.Instrs) > 0 {
+			if _, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sorted returns the keys of set in order.
+func sorted(set map[string]bool) []string {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteLifetimes writes the lifetimes of the goroutines to w, e.g.
+//
+//	main.go:12:2: goroutine main.worker, many instances
+//		terminates: on return
+//		waits on channels: jobs (main.go:9:14)
+//		signals WaitGroups: wg (main.go:10:6)
+func (g *Graph) WriteLifetimes(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	for _, lt := range g.Lifetimes() {
+		bufw.WriteString(lt.String())
+	}
+	return bufw.Flush()
+}
+
+// WriteLifetimesJSON writes the lifetimes of the goroutines to w as a JSON
+// list.
+func (g *Graph) WriteLifetimesJSON(w io.Writer) error {
+	type jsonLifetime struct {
+		Lifetime
+		Spawn string `json:"spawn"`
+	}
+	lts := []jsonLifetime{}
+	for _, lt := range g.Lifetimes() {
+		lts = append(lts, jsonLifetime{Lifetime: lt, Spawn: lt.Spawn.String()})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lts)
+}
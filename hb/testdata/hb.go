@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+var x, y, z int
+
+func main() {
+	x = 1
+	done := make(chan struct{})
+	go func() {
+		fmt.Println(x)
+		y = 2
+		close(done)
+	}()
+	z = 3
+	<-done
+	fmt.Println(y)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			z++
+		}()
+	}
+	wg.Wait()
+	fmt.Println(z)
+}
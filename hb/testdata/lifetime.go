@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+func worker(ctx context.Context, jobs chan int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-jobs:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func spin() {
+	for {
+	}
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go worker(ctx, jobs, &wg)
+	go spin()
+	jobs <- 1
+	cancel()
+	wg.Wait()
+}
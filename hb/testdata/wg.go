@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+func main() {
+	var a sync.WaitGroup
+	go func() {
+		a.Add(1)
+		defer a.Done()
+	}()
+	a.Wait()
+
+	var b sync.WaitGroup
+	if len(os.Args) > 1 {
+		b.Add(1)
+	}
+	go func() {
+		b.Done()
+	}()
+	b.Wait()
+
+	var c sync.WaitGroup
+	c.Wait()
+	c.Add(1)
+	go c.Done()
+}
@@ -0,0 +1,165 @@
+package hb
+
+// WaitGroup misuses.
+//
+// The Add, Done and Wait events of each sync.WaitGroup are checked against
+// the happens-before graph for
+//
+//   - add concurrent with wait: an Add in another goroutine which is not
+//     ordered before the Wait (e.g. wg.Add(1) inside the spawned goroutine),
+//     so the Wait may return before the Add. The edges from the Done of the
+//     WaitGroup to the Wait are not used, as they assume the Adds happen
+//     before the Wait,
+//   - done without add: a Done without an Add of the WaitGroup before it on
+//     every path (e.g. an Add in a branch only), which may make the counter
+//     negative, and
+//   - add after wait: an Add after every Wait of the WaitGroup, so the
+//     goroutines of the Add are never waited for.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+)
+
+// WaitGroupMisuse is a misuse of a sync.WaitGroup.
+type WaitGroupMisuse struct {
+	Kind    string   // Kind of misuse, e.g. "done without add".
+	Event   *Event   // Add or Done misused.
+	Related []*Event // Events of the WaitGroup involved, e.g. the Wait.
+	Message string   // Description of the misuse.
+}
+
+func (m WaitGroupMisuse) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %s: %s", m.Event.Pos, m.Kind, m.Message)
+	for _, e := range m.Related {
+		fmt.Fprintf(&buf, "\n\t%s", e)
+	}
+	return buf.String()
+}
+
+// waitGroupRules are the rules of the kinds of WaitGroup misuses.
+var waitGroupRules = map[string]diag.Rule{
+	"add concurrent with wait": diag.AddConcurrentWait,
+	"add after wait":           diag.AddAfterWait,
+	"done without add":         diag.DoneWithoutAdd,
+}
+
+// Diagnostic returns the misuse as a diagnostic at the Add (or Done), with the
+// related events as related locations.
+func (m WaitGroupMisuse) Diagnostic() diag.Diagnostic {
+	dg := diag.Diagnostic{
+		Rule:    waitGroupRules[m.Kind],
+		Message: fmt.Sprintf("%s: %s", m.Kind, m.Message),
+		Pos:     m.Event.Pos,
+	}
+	for _, e := range m.Related {
+		dg.Related = append(dg.Related, diag.Location{Pos: e.Pos, Message: e.String()})
+	}
+	return dg
+}
+
+// WaitGroupMisuses returns the misuses of the WaitGroups of the program.
+func (g *Graph) WaitGroupMisuses() []WaitGroupMisuse {
+	byObj := make(map[string]map[Kind][]*Event)
+	var objs []string
+	for _, e := range g.Events {
+		if e.Kind != Add && e.Kind != Done && e.Kind != Wait {
+			continue
+		}
+		if byObj[e.obj] == nil {
+			byObj[e.obj] = make(map[Kind][]*Event)
+			objs = append(objs, e.obj)
+		}
+		byObj[e.obj][e.Kind] = append(byObj[e.obj][e.Kind], e)
+	}
+	sort.Strings(objs)
+
+	var misuses []WaitGroupMisuse
+	for _, obj := range objs {
+		evs := byObj[obj]
+		adds, dones, waits := evs[Add], evs[Done], evs[Wait]
+		toWait := func(e Edge) bool { return e.Kind == Sync && e.To.Kind == Wait && e.To.obj == obj }
+		for _, a := range adds {
+			var concurrent, before []*Event
+			for _, w := range waits {
+				switch {
+				case g.mustBefore(w, a):
+					before = append(before, w)
+				case a.g != w.g && !g.beforeBy(a.point, w.point, toWait):
+					concurrent = append(concurrent, w)
+				}
+			}
+			switch {
+			case len(concurrent) > 0:
+				misuses = append(misuses, WaitGroupMisuse{
+					Kind:    "add concurrent with wait",
+					Event:   a,
+					Related: concurrent,
+					Message: fmt.Sprintf("Add of %s may run concurrently with Wait, which may return before the Add", a.Object),
+				})
+			case len(waits) > 0 && len(before) == len(waits):
+				misuses = append(misuses, WaitGroupMisuse{
+					Kind:    "add after wait",
+					Event:   a,
+					Related: before,
+					Message: fmt.Sprintf("Add of %s happens after every Wait, so it is never waited for", a.Object),
+				})
+			}
+		}
+		for _, d := range dones {
+			matched := false
+			for _, a := range adds {
+				if g.mustBefore(a, d) && g.onAllPaths(a.point, d.point) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				misuses = append(misuses, WaitGroupMisuse{
+					Kind:    "done without add",
+					Event:   d,
+					Related: adds,
+					Message: fmt.Sprintf("Done of %s may be called without a matching Add on some path", d.Object),
+				})
+			}
+		}
+	}
+	return misuses
+}
+
+// mustBefore returns true if event a happens before event b, in the same
+// instance if they are in the same goroutine.
+func (g *Graph) mustBefore(a, b *Event) bool {
+	if a.g == b.g {
+		return g.po(a.point, b.point)
+	}
+	return g.before(a.point, b.point)
+}
+
+// onAllPaths returns true if p is on every path to q (or the spawn of the
+// goroutine of q) in the root function of the goroutine of p, i.e. the block
+// of p dominates the block of q. It returns true if the goroutine of p is not
+// an ancestor of the goroutine of q, as the paths cannot be compared.
+func (g *Graph) onAllPaths(p, q point) bool {
+	for q.g != p.g {
+		if q.g.spawner == nil {
+			return true
+		}
+		q = q.g.at
+	}
+	if p.instr == nil || q.instr == nil {
+		return p.instr == nil
+	}
+	a, b := p.anchor, q.anchor
+	if a == b {
+		a, b = p.instr, q.instr
+	}
+	if a.Parent() != b.Parent() {
+		return true
+	}
+	return a.Block().Dominates(b.Block())
+}
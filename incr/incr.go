@@ -0,0 +1,394 @@
+// Package incr provides incremental MiGo inference for programs under edit,
+// e.g. in an editor or a watch loop.
+//
+// An Analysis keeps the result of the last inference with the content hashes
+// of the source files and of each function (its source text and position).
+// On Update, unchanged files are detected without building the program. The
+// program is rebuilt otherwise, and the changed functions are those added,
+// removed, edited or moved. A changed function is communicating if it
+// operates on channels, spawns goroutines, calls a modelled library (e.g.
+// time, sync) or calls a communicating function. The affected functions are
+// the changed communicating functions and their (transitive) callers.
+//
+// If no function is affected (e.g. an edit of a helper computing strings),
+// the MiGo program cannot change and is reused without inference. Otherwise
+// the program is inferred again from its entry, since inference is context
+// sensitive, and the previous MiGo program is patched in place: definitions
+// which are unchanged keep their identity, and only the definitions which
+// differ are replaced, added or removed.
+package incr
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/migoinfer"
+	gssa "github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/ssa/build"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/static"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// commPkgs are the library packages modelled by inference.
+var commPkgs = map[string]bool{
+	"context":                     true,
+	"net/http":                    true,
+	"os/signal":                   true,
+	"reflect":                     true,
+	"sync":                        true,
+	"time":                        true,
+	"golang.org/x/sync/errgroup":  true,
+	"golang.org/x/net/context":    true,
+	"github.com/nickng/gospal/rt": true,
+}
+
+// Analysis is the state of incremental inference of a program.
+type Analysis struct {
+	Info    *gssa.Info               // SSA IR of the last build.
+	Inferer *migoinfer.Inferer       // Inferer of the last inference (or nil).
+	Prog    *migo.Program            // MiGo program, patched in place.
+	Log     io.Writer                // Log of inference.
+	Setup   func(*migoinfer.Inferer) // Configures inferers (if not nil).
+
+	files map[string][sha256.Size]byte // Content hashes, by file.
+	funcs map[string]fnState           // Functions, by name.
+}
+
+// fnState is the state of a function in the last build.
+type fnState struct {
+	hash [sha256.Size]byte
+	comm bool
+}
+
+// Delta is the result of an update.
+type Delta struct {
+	Files      []string // Changed files.
+	Changed    []string // Changed functions.
+	Affected   []string // Changed communicating functions and their callers.
+	Reanalysed bool     // Program inferred again.
+	Added      []string // MiGo definitions added.
+	Removed    []string // MiGo definitions removed.
+	Replaced   []string // MiGo definitions replaced.
+}
+
+func (d *Delta) String() string {
+	if len(d.Files) == 0 {
+		return "no change"
+	}
+	s := fmt.Sprintf("%d file(s), %d function(s) changed, %d affected", len(d.Files), len(d.Changed), len(d.Affected))
+	if !d.Reanalysed {
+		return s + ", MiGo reused"
+	}
+	return s + fmt.Sprintf(", MiGo patched: %d added, %d removed, %d replaced", len(d.Added), len(d.Removed), len(d.Replaced))
+}
+
+// New returns a new Analysis.
+func New() *Analysis {
+	return &Analysis{
+		Prog:  migo.NewProgram(),
+		Log:   ioutil.Discard,
+		files: make(map[string][sha256.Size]byte),
+		funcs: make(map[string]fnState),
+	}
+}
+
+// content returns the content of file, from overlay if present.
+func content(file string, overlay map[string][]byte) ([]byte, error) {
+	if b, ok := overlay[file]; ok {
+		return b, nil
+	}
+	return ioutil.ReadFile(file)
+}
+
+// Update analyses files (with the content in overlay instead of the disk, if
+// present), reusing the last analysis for the parts unchanged.
+func (a *Analysis) Update(files []string, overlay map[string][]byte) (*Delta, error) {
+	d := new(Delta)
+	srcs := make(map[string][]byte)
+	hashes := make(map[string][sha256.Size]byte)
+	for _, f := range files {
+		b, err := content(f, overlay)
+		if err != nil {
+			return nil, err
+		}
+		srcs[f] = b
+		hashes[f] = sha256.Sum256(b)
+		if old, ok := a.files[f]; !ok || old != hashes[f] {
+			d.Files = append(d.Files, f)
+		}
+	}
+	for f := range a.files {
+		if _, ok := hashes[f]; !ok {
+			d.Files = append(d.Files, f)
+		}
+	}
+	sort.Strings(d.Files)
+	if len(d.Files) == 0 && a.Info != nil {
+		return d, nil
+	}
+
+	info, err := build.FromOverlay(files, overlay).Default().Build()
+	if err != nil {
+		return nil, err
+	}
+	fns := make(map[string]fnState)
+	comm := commFuncs(info, srcs)
+	for fn := range ssautil.AllFunctions(info.Prog) {
+		if fn.Syntax() == nil || !fn.Pos().IsValid() {
+			continue
+		}
+		start, end := info.FSet.Position(fn.Syntax().Pos()), info.FSet.Position(fn.Syntax().End())
+		src, ok := srcs[start.Filename]
+		if !ok || end.Offset > len(src) {
+			continue
+		}
+		h := sha256.New()
+		fmt.Fprintf(h, "%s:%d:%d\x00", start.Filename, start.Line, start.Column)
+		h.Write(src[start.Offset:end.Offset])
+		var st fnState
+		copy(st.hash[:], h.Sum(nil))
+		st.comm = comm[fn]
+		fns[fn.String()] = st
+	}
+	changedComm := make(map[string]bool)
+	for name, st := range fns {
+		if old, ok := a.funcs[name]; !ok || old.hash != st.hash {
+			d.Changed = append(d.Changed, name)
+			if st.comm || ok && old.comm {
+				changedComm[name] = true
+			}
+		}
+	}
+	for name, old := range a.funcs {
+		if _, ok := fns[name]; !ok {
+			d.Changed = append(d.Changed, name)
+			if old.comm {
+				changedComm[name] = true
+			}
+		}
+	}
+	sort.Strings(d.Changed)
+	d.Affected = callers(info, changedComm)
+
+	first := a.Info == nil
+	a.Info, a.files, a.funcs = info, hashes, fns
+	if len(d.Affected) == 0 && !first {
+		return d, nil
+	}
+	d.Reanalysed = true
+	if _, err := gssa.MainPkgs(info.Prog, false); err != nil {
+		a.Inferer = nil
+		a.patch(d, nil)
+		return d, nil // Not a main package, nothing to infer.
+	}
+	inferer := migoinfer.New(info, a.Log)
+	if a.Setup != nil {
+		a.Setup(inferer)
+	}
+	inferer.Analyse()
+	a.Inferer = inferer
+	a.patch(d, inferer.Env.Prog.Funcs)
+	return d, nil
+}
+
+// patch replaces the definitions of a.Prog by defs, keeping the definitions
+// which are unchanged, and records the differences in d.
+func (a *Analysis) patch(d *Delta, defs []*migo.Function) {
+	old := make(map[string]*migo.Function)
+	for _, f := range a.Prog.Funcs {
+		old[f.SimpleName()] = f
+	}
+	seen := make(map[string]bool)
+	updated := a.Prog.Funcs[:0]
+	for _, f := range defs {
+		name := f.SimpleName()
+		seen[name] = true
+		switch prev, ok := old[name]; {
+		case !ok:
+			d.Added = append(d.Added, name)
+			updated = append(updated, f)
+		case prev.String() != f.String():
+			d.Replaced = append(d.Replaced, name)
+			updated = append(updated, f)
+		default:
+			updated = append(updated, prev)
+		}
+	}
+	for name := range old {
+		if !seen[name] {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Removed)
+	a.Prog.Funcs = updated
+}
+
+// DefsOf returns the MiGo definitions of SSA function fn.
+func (a *Analysis) DefsOf(fn *ssa.Function) []*migo.Function {
+	name := migo.NewFunction(funcs.MakeDefinition(fn).Name()).SimpleName()
+	var defs []*migo.Function
+	for _, f := range a.Prog.Funcs {
+		n := f.SimpleName()
+		if i := strings.Index(n, "#"); i >= 0 {
+			n = n[:i]
+		}
+		if n == name {
+			defs = append(defs, f)
+		}
+	}
+	return defs
+}
+
+// callers returns the names of the functions in fns and their transitive
+// callers in the static callgraph of info.
+func callers(info *gssa.Info, fns map[string]bool) []string {
+	if len(fns) == 0 {
+		return nil
+	}
+	affected := make(map[string]bool)
+	for name := range fns {
+		affected[name] = true
+	}
+	g := static.CallGraph(info.Prog)
+	var queue []*callgraph.Node
+	for fn, n := range g.Nodes {
+		if fn != nil && fns[fn.String()] {
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range n.In {
+			if caller := e.Caller.Func; caller != nil && !affected[caller.String()] {
+				affected[caller.String()] = true
+				queue = append(queue, e.Caller)
+			}
+		}
+	}
+	var names []string
+	for name := range affected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commFuncs returns the communicating functions of info. Only the functions
+// in srcs are inspected, library functions are communicating if their package
+// is modelled, e.g. fmt.Println is not communicating although it uses sync.
+func commFuncs(info *gssa.Info, srcs map[string][]byte) map[*ssa.Function]bool {
+	all := ssautil.AllFunctions(info.Prog)
+	comm := make(map[*ssa.Function]bool)
+	calls := make(map[*ssa.Function][]*ssa.Function)
+	for fn := range all {
+		if fn.Pkg != nil && commPkgs[fn.Pkg.Pkg.Path()] {
+			comm[fn] = true
+			continue
+		}
+		if _, ok := srcs[info.FSet.Position(fn.Pos()).Filename]; !ok {
+			continue
+		}
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				if isComm(instr) {
+					comm[fn] = true
+				}
+				if call, ok := instr.(ssa.CallInstruction); ok {
+					if callee := call.Common().StaticCallee(); callee != nil {
+						calls[fn] = append(calls[fn], callee)
+					}
+				}
+			}
+		}
+		for _, anon := range fn.AnonFuncs {
+			calls[fn] = append(calls[fn], anon)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for fn, callees := range calls {
+			if comm[fn] {
+				continue
+			}
+			for _, callee := range callees {
+				if comm[callee] {
+					comm[fn], changed = true, true
+					break
+				}
+			}
+		}
+	}
+	return comm
+}
+
+// isComm returns true if instr communicates, i.e. operates on channels or
+// spawns goroutines, or involves channels.
+func isComm(instr ssa.Instruction) bool {
+	switch instr := instr.(type) {
+	case *ssa.Send, *ssa.Select, *ssa.MakeChan, *ssa.Go:
+		return true
+	case *ssa.UnOp:
+		if instr.Op == token.ARROW {
+			return true
+		}
+	case ssa.CallInstruction:
+		if b, ok := instr.Common().Value.(*ssa.Builtin); ok && b.Name() == "close" {
+			return true
+		}
+	}
+	if v, ok := instr.(ssa.Value); ok && hasChan(v.Type(), nil) {
+		return true
+	}
+	return false
+}
+
+// hasChan returns true if t is (or contains) a channel type.
+func hasChan(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	if seen == nil {
+		seen = make(map[types.Type]bool)
+	}
+	seen[t] = true
+	switch t := t.(type) {
+	case *types.Chan:
+		return true
+	case *types.Named:
+		return hasChan(t.Underlying(), seen)
+	case *types.Pointer:
+		return hasChan(t.Elem(), seen)
+	case *types.Slice:
+		return hasChan(t.Elem(), seen)
+	case *types.Array:
+		return hasChan(t.Elem(), seen)
+	case *types.Map:
+		return hasChan(t.Key(), seen) || hasChan(t.Elem(), seen)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasChan(t.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if hasChan(t.At(i).Type(), seen) {
+				return true
+			}
+		}
+	case *types.Signature:
+		return hasChan(t.Params(), seen) || hasChan(t.Results(), seen)
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package incr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+const file = "testdata/edit.go"
+
+func update(t *testing.T, a *Analysis, overlay map[string][]byte) *Delta {
+	d, err := a.Update([]string{file}, overlay)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	return d
+}
+
+// Tests that an edit of a non-communicating function reuses the MiGo program,
+// and an edit of a communicating function patches it.
+func TestUpdate(t *testing.T) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New()
+	if d := update(t, a, nil); !d.Reanalysed || len(d.Added) == 0 {
+		t.Fatalf("First update mismatch:\nExpect:\tReanalysed with definitions added\nGot:\t%v\n", d)
+	}
+	defs := append(a.Prog.Funcs[:0:0], a.Prog.Funcs...)
+
+	if d := update(t, a, nil); len(d.Files) != 0 || d.Reanalysed {
+		t.Errorf("Unchanged update mismatch:\nExpect:\tno change\nGot:\t%v\n", d)
+	}
+
+	edited := bytes.Replace(src, []byte(`"n=%d"`), []byte(`"value %d"`), 1)
+	d := update(t, a, map[string][]byte{file: edited})
+	if len(d.Changed) != 1 || d.Changed[0] != "main.label" {
+		t.Errorf("Changed functions mismatch:\nExpect:\t%v\nGot:\t%v\n", []string{"main.label"}, d.Changed)
+	}
+	if d.Reanalysed || len(d.Affected) != 0 {
+		t.Errorf("Non-communicating edit mismatch:\nExpect:\tMiGo reused\nGot:\t%v\n", d)
+	}
+
+	edited = bytes.Replace(edited, []byte("ch <- 1"), []byte("ch <- 1\n\tch <- 2"), 1)
+	d = update(t, a, map[string][]byte{file: edited})
+	if !d.Reanalysed {
+		t.Fatalf("Communicating edit mismatch:\nExpect:\tReanalysed\nGot:\t%v\n", d)
+	}
+	affected := make(map[string]bool)
+	for _, fn := range d.Affected {
+		affected[fn] = true
+	}
+	if !affected["main.send"] || !affected["main.main"] {
+		t.Errorf("Affected functions mismatch:\nExpect:\t%v\nGot:\t%v\n", []string{"main.main", "main.send"}, d.Affected)
+	}
+	if len(d.Replaced) == 0 {
+		t.Errorf("Replaced definitions mismatch:\nExpect:\tmain.send\nGot:\t%v\n", d.Replaced)
+	}
+	kept := 0
+	for _, f := range a.Prog.Funcs {
+		for _, old := range defs {
+			if f == old {
+				kept++
+			}
+		}
+	}
+	if kept == 0 {
+		t.Errorf("Patched program mismatch:\nExpect:\tunchanged definitions kept\nGot:\tall definitions replaced\n")
+	}
+}
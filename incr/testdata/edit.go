@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+func label(n int) string {
+	return fmt.Sprintf("n=%d", n)
+}
+
+func send(ch chan int) {
+	ch <- 1
+}
+
+func main() {
+	ch := make(chan int)
+	go send(ch)
+	fmt.Println(label(<-ch))
+}
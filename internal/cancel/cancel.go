@@ -0,0 +1,30 @@
+// Package cancel defines the MiGo statement cancelling a context (e.g. the
+// cancel function of context.WithCancel), i.e. closing the Done channel of the
+// context unless it is already closed.
+//
+// MiGo has no conditional close, so the statement is written as a select
+// which either observes that the channel is closed, or closes it, i.e.
+//
+//	select case recv ch; case tau; close ch; endselect
+//
+// The analyses which recognise the statement, e.g. the deadlock checker and
+// the session types, only close the channel if it is open, so cancelling a
+// context more than once (e.g. a cancel() followed by a deferred cancel()) is
+// not a double close.
+package cancel
+
+import "github.com/nickng/migo"
+
+// Close is a MiGo statement closing the Done channel Chan of a context, if it
+// is not closed.
+type Close struct {
+	Chan string // Done channel of the context.
+}
+
+func (s *Close) String() string {
+	sel := &migo.SelectStatement{Cases: [][]migo.Statement{
+		{&migo.RecvStatement{Chan: s.Chan}},
+		{&migo.TauStatement{}, &migo.CloseStatement{Chan: s.Chan}},
+	}}
+	return sel.String()
+}
@@ -0,0 +1,86 @@
+// Package intern interns strings, i.e. keeps a single copy of equal strings,
+// for the names of the MiGo definitions, channels and positions, which are
+// built many times (mostly equal) over an inference and retained in the
+// emitted program.
+//
+// Interned strings are never released, so tables are for strings of the
+// program analysed, whose number is bounded by the program.
+package intern
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/nickng/gospal/metrics"
+)
+
+// Table is a table of interned strings, safe for concurrent use.
+type Table struct {
+	mu   sync.Mutex
+	strs map[string]string
+}
+
+// New returns an empty table.
+func New() *Table {
+	return &Table{strs: make(map[string]string)}
+}
+
+// Default is the table of the package functions.
+var Default = New()
+
+// buffers are the buffers of Sprintf.
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// String returns the interned copy of s.
+func (t *Table) String(s string) string {
+	metrics.InternGets.Inc()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if is, ok := t.strs[s]; ok {
+		return is
+	}
+	metrics.InternMisses.Inc()
+	t.strs[s] = s
+	return s
+}
+
+// Bytes returns the interned string of b, allocating only if not interned.
+func (t *Table) Bytes(b []byte) string {
+	metrics.InternGets.Inc()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if is, ok := t.strs[string(b)]; ok { // Does not allocate.
+		return is
+	}
+	metrics.InternMisses.Inc()
+	s := string(b)
+	t.strs[s] = s
+	return s
+}
+
+// Sprintf returns the interned string formatted by fmt.Sprintf, allocating
+// only if not interned.
+func (t *Table) Sprintf(format string, args ...interface{}) string {
+	buf := buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	fmt.Fprintf(buf, format, args...)
+	s := t.Bytes(buf.Bytes())
+	buffers.Put(buf)
+	return s
+}
+
+// Len returns the number of strings interned.
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.strs)
+}
+
+// String returns the interned copy of s in Default.
+func String(s string) string { return Default.String(s) }
+
+// Sprintf returns the interned string formatted by fmt.Sprintf in Default.
+func Sprintf(format string, args ...interface{}) string {
+	return Default.Sprintf(format, args...)
+}
@@ -0,0 +1,36 @@
+package intern
+
+import "testing"
+
+func TestIntern(t *testing.T) {
+	tab := New()
+	a := tab.Sprintf("%s_chan%d", "main.main.t0", 1)
+	b := tab.String(string([]byte("main.main.t0_chan1")))
+	if a != b {
+		t.Errorf("Interned string mismatch:\nExpect:\t%s\nGot:\t%s\n", a, b)
+	}
+	if tab.Len() != 1 {
+		t.Errorf("Interned strings mismatch:\nExpect:\t%d\nGot:\t%d\n", 1, tab.Len())
+	}
+	tab.String("main.main#1")
+	if tab.Len() != 2 {
+		t.Errorf("Interned strings mismatch:\nExpect:\t%d\nGot:\t%d\n", 2, tab.Len())
+	}
+}
+
+// Tests that looking up an interned string does not allocate.
+func TestBytesAllocs(t *testing.T) {
+	tab := New()
+	b := []byte("main.send")
+	tab.Bytes(b)
+	if n := testing.AllocsPerRun(100, func() { tab.Bytes(b) }); n != 0 {
+		t.Errorf("Allocations mismatch:\nExpect:\t%d\nGot:\t%v\n", 0, n)
+	}
+}
+
+func BenchmarkSprintf(b *testing.B) {
+	tab := New()
+	for i := 0; i < b.N; i++ {
+		tab.Sprintf("%s.%s_chan%d", "main.main", "t0", i%64)
+	}
+}
@@ -0,0 +1,120 @@
+// Package jsonrpc provides JSON-RPC 2.0 connections with messages framed by
+// Content-Length headers, as in the base protocol of LSP, for the servers of
+// editor integrations.
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+// Error is the error of a JSON-RPC response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s (%d)", e.Message, e.Code) }
+
+// JSON-RPC error codes.
+const (
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	ServerError    = -32000 // Start of the range of server errors.
+)
+
+// Unmarshal decodes the params of a request into v.
+func Unmarshal(params json.RawMessage, v interface{}) *Error {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// Conn is a JSON-RPC 2.0 connection. Messages may be written concurrently.
+type Conn struct {
+	r  *textproto.Reader
+	br *bufio.Reader
+
+	mu sync.Mutex // Guards w.
+	w  io.Writer
+}
+
+// NewConn returns a connection reading messages from r and writing to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	br := bufio.NewReader(r)
+	return &Conn{r: textproto.NewReader(br), br: br, w: w}
+}
+
+// Read reads the next message.
+func (c *Conn) Read() (*Message, error) {
+	hdr, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(hdr.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %v", err)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.br, body); err != nil {
+		return nil, err
+	}
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Write writes msg.
+func (c *Conn) Write(msg *Message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+// Reply writes the response to the request with id.
+func (c *Conn) Reply(id *json.RawMessage, result interface{}, err *Error) error {
+	if result == nil && err == nil {
+		result = json.RawMessage("null")
+	}
+	return c.Write(&Message{ID: id, Result: result, Error: err})
+}
+
+// Notify writes a notification.
+func (c *Conn) Notify(method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.Write(&Message{Method: method, Params: b})
+}
@@ -0,0 +1,32 @@
+// Package timer defines the MiGo statements of one-shot timers (e.g.
+// time.After, time.NewTimer).
+//
+// MiGo has no timed actions, so the statements are internal actions in MiGo
+// (written as tau), labelled with the channel of the timer for the analyses
+// which recognise them, e.g. the deadlock checker, the session types and the
+// timed automata of package uppaal: the timer is started (Start) when it is
+// created or reset, and a timeout (Timeout) is a receive from the timer,
+// enabled once the timer is started, e.g. the guard of the timeout case of a
+// select. In a session, starting a timer is a message sent on the channel of
+// the timer, and a timeout is a message received on it.
+package timer
+
+// Start is a MiGo statement starting (or restarting) the one-shot timer of
+// channel Chan.
+type Start struct {
+	Chan string // Channel of the timer.
+}
+
+func (s *Start) String() string {
+	return "tau"
+}
+
+// Timeout is a MiGo statement receiving the timeout of the one-shot timer of
+// channel Chan.
+type Timeout struct {
+	Chan string // Channel of the timer.
+}
+
+func (s *Timeout) String() string {
+	return "tau"
+}
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"log"
 
+	"github.com/nickng/gospal/absint"
 	"golang.org/x/tools/go/ssa"
 )
 
@@ -33,6 +34,8 @@ type Detector struct {
 
 	blockState map[*ssa.BasicBlock]State
 	blockScope map[*ssa.BasicBlock]*Info
+
+	ranges *absint.Result // Ranges of integers (Intervals), if not nil.
 }
 
 func NewDetector() *Detector {
@@ -50,6 +53,29 @@ func (d *Detector) SetLog(w io.Writer) {
 	d.logger.SetOutput(w)
 }
 
+// SetRanges sets the ranges of the integers of the function (the result of
+// analysis in the absint.Intervals domain), used for the initial values,
+// increments and bounds of loops which are computed instead of constant.
+func (d *Detector) SetRanges(res *absint.Result) {
+	d.ranges = res
+}
+
+// intConst returns the constant value of v, or the value of v at the end of
+// block b if its range is a singleton.
+func (d *Detector) intConst(v ssa.Value, b *ssa.BasicBlock) (int64, bool) {
+	if c, ok := v.(*ssa.Const); ok {
+		val, err := getIntConst(c)
+		return val, err == nil
+	}
+	if d.ranges == nil || b == nil {
+		return 0, false
+	}
+	if s, ok := d.ranges.Out[b].(absint.IntervalState); ok && s != nil {
+		return s.Of(v).Const()
+	}
+	return 0, false
+}
+
 // ExtractIndex takes a Phi inside an Enter state work out the initial value
 // and increment.
 func (d *Detector) ExtractIndex(phi *ssa.Phi) {
@@ -67,31 +93,26 @@ func (d *Detector) ExtractIndex(phi *ssa.Phi) {
 		return
 	}
 
-	for i := 0; i < 2; i++ {
-		switch edge := phi.Edges[i].(type) {
-		case *ssa.Const:
-			if val, err := getIntConst(edge); err == nil {
-				scope.initVal = val
-				scope.indexVar = phi
-			}
-		case *ssa.BinOp:
-			switch edge.Op {
-			case token.ADD:
-				if y, ok := edge.Y.(*ssa.Const); ok {
-					if val, err := getIntConst(y); err == nil {
-						scope.stepVal = val
-						scope.indexOK = true
-					}
-				}
-			case token.SUB:
-				if y, ok := edge.Y.(*ssa.Const); ok {
-					if val, err := getIntConst(y); err == nil {
-						scope.stepVal = -val
-						scope.indexOK = true
-					}
+	for i := 0; i < 2 && i < len(phi.Edges); i++ {
+		var pred *ssa.BasicBlock
+		if i < len(phi.Block().Preds) {
+			pred = phi.Block().Preds[i]
+		}
+		edge := phi.Edges[i]
+		if binop, ok := edge.(*ssa.BinOp); ok && (binop.Op == token.ADD || binop.Op == token.SUB) {
+			if val, ok := d.intConst(binop.Y, pred); ok {
+				if binop.Op == token.SUB {
+					val = -val
 				}
+				scope.stepVal = val
+				scope.indexOK = true
+				continue
 			}
 		}
+		if val, ok := d.intConst(edge, pred); ok {
+			scope.initVal = val
+			scope.indexVar = phi
+		}
 	}
 }
 
@@ -119,6 +140,7 @@ func (d *Detector) ExtractCond(ifelse *ssa.If) {
 				scope.condOK = true
 			}
 		}
+		scope.bound = d.bound(ifelse, scope.indexVar)
 	case CondTrue: // Intermediate condition.
 		scope.AddTrue(ifelse.Cond)
 	case CondFalse: // Intermediate condition.
@@ -209,6 +231,25 @@ func (d *Detector) Detect(from, to *ssa.BasicBlock) {
 	}
 }
 
+// bound returns the range of the operand compared with index in the loop
+// condition of ifelse, e.g. n in i < n.
+func (d *Detector) bound(ifelse *ssa.If, index ssa.Value) absint.Interval {
+	cond, ok := ifelse.Cond.(*ssa.BinOp)
+	if !ok || index == nil || d.ranges == nil {
+		return absint.Top
+	}
+	other := cond.Y
+	if cond.Y == index {
+		other = cond.X
+	} else if cond.X != index {
+		return absint.Top
+	}
+	if s, ok := d.ranges.Before(ifelse).(absint.IntervalState); ok && s != nil {
+		return s.Of(other)
+	}
+	return absint.Top
+}
+
 func (d *Detector) debugShowScopes() {
 	for blk, loop := range d.blockScope {
 		fmt.Printf("%d: loop rooted at %d body:%t done:%t\n", blk.Index, loop.loopIdx, blk.Index == loop.bodyIdx, blk.Index == loop.doneIdx)
@@ -3,9 +3,12 @@ package loop
 import (
 	"bytes"
 	"fmt"
+	"go/constant"
+	"go/token"
 	"log"
 	"strings"
 
+	"github.com/nickng/gospal/absint"
 	"golang.org/x/tools/go/ssa"
 )
 
@@ -18,8 +21,9 @@ type Info struct {
 	subtrees map[ssa.Value]*BinTree // Quick lookup for subtree.
 	prevCond ssa.Value
 
-	initVal int64 // initial value.
-	stepVal int64 // step value.
+	initVal int64           // initial value.
+	stepVal int64           // step value.
+	bound   absint.Interval // Range of the bound compared with the index.
 
 	loopIdx int // Block index of for.loop.
 	bodyIdx int // Block index of for.body.
@@ -35,6 +39,7 @@ func New(index int) *Info {
 		loopIdx:  index,
 		subtrees: make(map[ssa.Value]*BinTree),
 		target:   &BinTree{Target: true},
+		bound:    absint.Top,
 	}
 }
 
@@ -139,6 +144,10 @@ func (i *Info) String() string {
 	return buf.String()
 }
 
+// Bound returns the range of the bound the index is compared with in the loop
+// condition (e.g. n in i < n), or absint.Top if unknown.
+func (i *Info) Bound() absint.Interval { return i.bound }
+
 func (i *Info) BodyIdx() int { return i.bodyIdx }
 
 func (i *Info) DoneIdx() int { return i.doneIdx }
@@ -147,3 +156,65 @@ func (i *Info) DoneIdx() int { return i.doneIdx }
 func (i *Info) ParamsOK() bool {
 	return i.indexVar != nil && i.indexOK && i.condRoot != nil && i.condRoot.Cond != nil && i.condOK
 }
+
+// IndexVar returns the index variable of the loop, or nil if not detected.
+func (i *Info) IndexVar() ssa.Value { return i.indexVar }
+
+// Iterations returns the number of iterations of the loop if constant, i.e.
+// the loop condition is a single comparison (<, <=, > or >=) of the index
+// with a constant (or a bound of a single value), e.g. 3 for
+//
+//	for i := 0; i < 3; i++ { ... }
+func (i *Info) Iterations() (int64, bool) {
+	if !i.ParamsOK() || len(i.subtrees) != 1 || i.stepVal == 0 {
+		return 0, false
+	}
+	cond, ok := i.condRoot.Cond.(*ssa.BinOp)
+	if !ok {
+		return 0, false
+	}
+	op, other := cond.Op, cond.Y
+	if cond.Y == i.indexVar {
+		other = cond.X
+		switch op { // Mirror, e.g. 3 > i ⇔ i < 3.
+		case token.LSS:
+			op = token.GTR
+		case token.LEQ:
+			op = token.GEQ
+		case token.GTR:
+			op = token.LSS
+		case token.GEQ:
+			op = token.LEQ
+		}
+	} else if cond.X != i.indexVar {
+		return 0, false
+	}
+	bound, ok := i.bound.Const()
+	if c, isConst := other.(*ssa.Const); isConst && c.Value != nil && c.Value.Kind() == constant.Int {
+		bound, ok = c.Int64(), true
+	}
+	if !ok {
+		return 0, false
+	}
+	var span int64 // Distance from the initial value to the last value.
+	switch {
+	case op == token.LSS && i.stepVal > 0:
+		span = bound - 1 - i.initVal
+	case op == token.LEQ && i.stepVal > 0:
+		span = bound - i.initVal
+	case op == token.GTR && i.stepVal < 0:
+		span = i.initVal - (bound + 1)
+	case op == token.GEQ && i.stepVal < 0:
+		span = i.initVal - bound
+	default:
+		return 0, false
+	}
+	if span < 0 {
+		return 0, true
+	}
+	step := i.stepVal
+	if step < 0 {
+		step = -step
+	}
+	return span/step + 1, true
+}
@@ -141,3 +141,50 @@ func TestNotLoop(t *testing.T) {
 		}
 	}
 }
+
+func TestIterations(t *testing.T) {
+	src := `package main
+	import "os"
+	func main() {
+		for i := 0; i < 3; i++ {
+		}
+		for i := 5; i >= 1; i-- {
+		}
+		for i := 0; i <= 10; i += 4 {
+		}
+		for i := 0; i < len(os.Args); i++ {
+		}
+	}`
+	type iters struct {
+		n  int64
+		ok bool
+	}
+	expect := []iters{{3, true}, {5, true}, {3, true}, {0, false}}
+	info, err := build.FromReader(strings.NewReader(src)).Default().Build()
+	if err != nil {
+		t.Error("cannot build SSA:", err)
+	}
+	mains, err := ssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		t.Error("Cannot find main package:", err)
+	}
+	ld := loopDetector{d: NewDetector()}
+	for _, main := range mains {
+		block.TraverseEdges(main.Func("main"), ld.detect)
+		var got []iters
+		for _, blk := range main.Func("main").Blocks {
+			if l := ld.d.ForLoopAt(blk); blk.Comment == "for.loop" && l != nil {
+				n, ok := l.Iterations()
+				got = append(got, iters{n, ok})
+			}
+		}
+		if len(got) != len(expect) {
+			t.Fatalf("Loops mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+		}
+		for i := range expect {
+			if got[i] != expect[i] {
+				t.Errorf("Iterations of loop %d mismatch:\nExpect:\t%v\nGot:\t%v\n", i, expect[i], got[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,451 @@
+// Package lsp provides a Language Server Protocol server, which publishes the
+// inferred MiGo types of functions as hovers and code lenses, and goroutine
+// leaks and deadlocks as diagnostics of the documents opened in an editor.
+//
+// The documents of a directory are analysed together as a main package, with
+// the content of the opened documents read from the editor (overlay) instead
+// of the disk. The results are cached until the content of the directory
+// changes.
+package lsp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/internal/jsonrpc"
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/ssa/build"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Name is the name of the server.
+const Name = "gospal"
+
+// Server is a Language Server Protocol server.
+type Server struct {
+	Log io.Writer // Log of the server (defaults to discard).
+
+	conn *jsonrpc.Conn
+
+	mu       sync.Mutex
+	overlay  map[string][]byte  // Content of opened documents, by filename.
+	results  map[string]*result // Analysis result, by directory.
+	shutdown bool
+}
+
+// result is the analysis result of the files of a directory.
+type result struct {
+	hash  [sha256.Size]byte // Hash of the analysed files.
+	files []string          // Analysed files.
+	fset  *token.FileSet
+	funcs []*fnInfo
+	diags map[string][]Diagnostic // Diagnostics, by filename.
+	err   error
+}
+
+// fnInfo is an analysed function and its MiGo definitions.
+type fnInfo struct {
+	file  string
+	rng   Range
+	start token.Pos
+	end   token.Pos
+	defs  []*migo.Function
+}
+
+// NewServer returns a new server.
+func NewServer() *Server {
+	return &Server{
+		Log:     ioutil.Discard,
+		overlay: make(map[string][]byte),
+		results: make(map[string]*result),
+	}
+}
+
+// Serve serves LSP requests read from r, writing responses to w, until the
+// exit notification or the end of r.
+func Serve(r io.Reader, w io.Writer) error {
+	return NewServer().Serve(r, w)
+}
+
+// Serve serves LSP requests read from r, writing responses to w, until the
+// exit notification or the end of r.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = jsonrpc.NewConn(r, w)
+	for {
+		msg, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a request or notification.
+func (s *Server) handle(msg *jsonrpc.Message) error {
+	fmt.Fprintf(s.Log, "lsp: %s\n", msg.Method)
+	var (
+		result interface{}
+		rerr   *jsonrpc.Error
+	)
+	switch msg.Method {
+	case "initialize":
+		var res InitializeResult
+		res.Capabilities = ServerCapabilities{
+			TextDocumentSync: syncFull,
+			HoverProvider:    true,
+			CodeLensProvider: &CodeLensOptions{},
+		}
+		res.ServerInfo.Name = Name
+		result = res
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			s.update(p.TextDocument.URI, []byte(p.TextDocument.Text))
+		}
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil && len(p.ContentChanges) > 0 {
+			s.update(p.TextDocument.URI, []byte(p.ContentChanges[len(p.ContentChanges)-1].Text))
+		}
+	case "textDocument/didSave":
+		var p DidCloseTextDocumentParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			s.publish(filepath.Dir(uriToPath(p.TextDocument.URI)))
+		}
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			s.mu.Lock()
+			delete(s.overlay, uriToPath(p.TextDocument.URI))
+			s.mu.Unlock()
+		}
+	case "textDocument/hover":
+		var p TextDocumentPositionParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			if h := s.hover(uriToPath(p.TextDocument.URI), p.Position); h != nil {
+				result = h
+			}
+		}
+	case "textDocument/codeLens":
+		var p CodeLensParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			result = s.codeLens(uriToPath(p.TextDocument.URI))
+		}
+	default:
+		if msg.ID != nil {
+			rerr = &jsonrpc.Error{Code: jsonrpc.MethodNotFound, Message: "method not found: " + msg.Method}
+		}
+	}
+	if msg.ID == nil { // Notification.
+		return nil
+	}
+	return s.conn.Reply(msg.ID, result, rerr)
+}
+
+// update sets the content of the document uri and publishes the diagnostics
+// of its directory.
+func (s *Server) update(uri string, content []byte) {
+	file := uriToPath(uri)
+	s.mu.Lock()
+	s.overlay[file] = content
+	s.mu.Unlock()
+	s.publish(filepath.Dir(file))
+}
+
+// publish analyses the directory dir and publishes the diagnostics of its
+// files.
+func (s *Server) publish(dir string) {
+	res := s.analyse(dir)
+	for _, file := range res.files {
+		diags := res.diags[file]
+		if diags == nil {
+			diags = []Diagnostic{} // Clears the diagnostics of the file.
+		}
+		s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         pathToURI(file),
+			Diagnostics: diags,
+		})
+	}
+}
+
+// sources returns the Go source files of dir (excluding tests) with the opened
+// documents of dir, and a copy of the overlay.
+func (s *Server) sources(dir string) ([]string, map[string][]byte) {
+	seen := make(map[string]bool)
+	var files []string
+	if matches, err := filepath.Glob(filepath.Join(dir, "*.go")); err == nil {
+		for _, f := range matches {
+			if !strings.HasSuffix(f, "_test.go") {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	overlay := make(map[string][]byte)
+	for f, b := range s.overlay {
+		if filepath.Dir(f) != dir || strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		overlay[f] = b
+		if !seen[f] {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files, overlay
+}
+
+// analyse returns the analysis result of dir, from the cache if the files of
+// dir are unchanged.
+func (s *Server) analyse(dir string) *result {
+	files, overlay := s.sources(dir)
+	h := sha256.New()
+	for _, f := range files {
+		content, ok := overlay[f]
+		if !ok {
+			content, _ = ioutil.ReadFile(f)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", f, len(content))
+		h.Write(content)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+
+	s.mu.Lock()
+	if res, ok := s.results[dir]; ok && res.hash == sum {
+		s.mu.Unlock()
+		return res
+	}
+	s.mu.Unlock()
+
+	res := &result{hash: sum, files: files, diags: make(map[string][]Diagnostic)}
+	res.err = s.infer(res, files, overlay)
+	if res.err != nil {
+		fmt.Fprintf(s.Log, "lsp: %s: %v\n", dir, res.err)
+	}
+	s.mu.Lock()
+	s.results[dir] = res
+	s.mu.Unlock()
+	return res
+}
+
+// infer builds files and infers their MiGo types, and fills in res.
+func (s *Server) infer(res *result, files []string, overlay map[string][]byte) (err error) {
+	if len(files) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("analysis failed: %v", r)
+		}
+	}()
+	info, err := build.FromOverlay(files, overlay).Default().Build()
+	if err != nil {
+		return err
+	}
+	res.fset = info.FSet
+	if _, err := ssa.MainPkgs(info.Prog, false); err != nil {
+		return nil // Not a main package, nothing to infer.
+	}
+	inferer := migoinfer.New(info, s.Log)
+	inferer.Analyse()
+
+	defs := make(map[string][]*migo.Function)
+	for _, f := range inferer.Env.Prog.Funcs {
+		name := f.SimpleName()
+		if i := strings.Index(name, "#"); i >= 0 {
+			name = name[:i]
+		}
+		defs[name] = append(defs[name], f)
+	}
+	for fn := range ssautil.AllFunctions(info.Prog) {
+		if fn.Syntax() == nil || fn.Pos() == token.NoPos {
+			continue
+		}
+		start, end := fn.Syntax().Pos(), fn.Syntax().End()
+		file := info.FSet.Position(start).Filename
+		if !contains(files, file) {
+			continue
+		}
+		name := migo.NewFunction(funcs.MakeDefinition(fn).Name()).SimpleName()
+		if len(defs[name]) == 0 {
+			continue
+		}
+		res.funcs = append(res.funcs, &fnInfo{
+			file:  file,
+			rng:   Range{Start: position(info.FSet.Position(start)), End: position(info.FSet.Position(end))},
+			start: start,
+			end:   end,
+			defs:  defs[name],
+		})
+	}
+	sort.Slice(res.funcs, func(i, j int) bool { return res.funcs[i].start < res.funcs[j].start })
+
+	diags := inferer.LeakDiagnostics()
+	diags = append(diags, inferer.DeadlockDiagnostics(migoinfer.DefaultBounds())...)
+	diag.Sort(diags)
+	for _, d := range diags {
+		if d.Pos.Filename == "" {
+			continue
+		}
+		res.diags[d.Pos.Filename] = append(res.diags[d.Pos.Filename], toDiagnostic(d))
+	}
+	return nil
+}
+
+// hover returns the MiGo definitions of the innermost function at pos of
+// file, or nil if there is none.
+func (s *Server) hover(file string, pos Position) *Hover {
+	res := s.analyse(filepath.Dir(file))
+	var inner *fnInfo
+	for _, fn := range res.funcs {
+		if fn.file == file && within(pos, fn.rng) {
+			if inner == nil || fn.start >= inner.start && fn.end <= inner.end {
+				inner = fn
+			}
+		}
+	}
+	if inner == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("```\n")
+	for _, def := range inner.defs {
+		buf.WriteString(def.String())
+	}
+	buf.WriteString("```\n")
+	rng := inner.rng
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: buf.String()}, Range: &rng}
+}
+
+// codeLens returns a code lens with the number of MiGo definitions of each
+// function in file.
+func (s *Server) codeLens(file string) []CodeLens {
+	res := s.analyse(filepath.Dir(file))
+	lenses := []CodeLens{}
+	for _, fn := range res.funcs {
+		if fn.file != file {
+			continue
+		}
+		title := fmt.Sprintf("MiGo: %d definitions", len(fn.defs))
+		if len(fn.defs) == 1 {
+			title = "MiGo: 1 definition"
+		}
+		lenses = append(lenses, CodeLens{
+			Range:   Range{Start: fn.rng.Start, End: fn.rng.Start},
+			Command: &Command{Title: title},
+		})
+	}
+	return lenses
+}
+
+// toDiagnostic converts d to a LSP diagnostic.
+func toDiagnostic(d diag.Diagnostic) Diagnostic {
+	sev := SeverityWarning
+	switch d.Severity {
+	case diag.Error:
+		sev = SeverityError
+	case diag.Note:
+		sev = SeverityInformation
+	case "":
+		if d.Rule.Severity == diag.Error {
+			sev = SeverityError
+		}
+	}
+	pos := position(d.Pos)
+	ld := Diagnostic{
+		Range:    Range{Start: pos, End: pos},
+		Severity: sev,
+		Code:     d.Rule.ID,
+		Source:   Name,
+		Message:  d.Message,
+	}
+	if d.Rule.Code != "" {
+		ld.Code = d.Rule.Code
+		ld.CodeDescription = &CodeDescription{Href: d.Rule.HelpURI()}
+	}
+	for _, l := range d.Related {
+		if l.Pos.Filename == "" {
+			continue
+		}
+		p := position(l.Pos)
+		ld.RelatedInformation = append(ld.RelatedInformation, DiagnosticRelatedInformation{
+			Location: Location{URI: pathToURI(l.Pos.Filename), Range: Range{Start: p, End: p}},
+			Message:  l.Message,
+		})
+	}
+	return ld
+}
+
+// position converts pos to a zero-based LSP position. Columns are in bytes,
+// which are the same as UTF-16 code units for ASCII.
+func position(pos token.Position) Position {
+	p := Position{Line: pos.Line - 1, Character: pos.Column - 1}
+	if p.Line < 0 {
+		p.Line = 0
+	}
+	if p.Character < 0 {
+		p.Character = 0
+	}
+	return p
+}
+
+// within returns true if pos is within rng.
+func within(pos Position, rng Range) bool {
+	before := func(a, b Position) bool {
+		return a.Line < b.Line || a.Line == b.Line && a.Character <= b.Character
+	}
+	return before(rng.Start, pos) && before(pos, rng.End)
+}
+
+func contains(files []string, file string) bool {
+	for _, f := range files {
+		if f == file {
+			return true
+		}
+	}
+	return false
+}
+
+// uriToPath converts a file URI to a path.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathToURI converts a path to a file URI.
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,65 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/internal/jsonrpc"
+)
+
+// frame frames JSON-RPC messages with Content-Length headers.
+func frame(msgs ...string) string {
+	var buf strings.Builder
+	for _, m := range msgs {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return buf.String()
+}
+
+// Tests that initialize is answered with the capabilities of the server, and
+// that unknown methods are errors.
+func TestInitialize(t *testing.T) {
+	in := frame(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown/method"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	var out bytes.Buffer
+	if err := Serve(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	c := jsonrpc.NewConn(&out, nil)
+	var resps []*jsonrpc.Message
+	for {
+		msg, err := c.Read()
+		if err != nil {
+			break
+		}
+		resps = append(resps, msg)
+	}
+	if expect, got := 3, len(resps); expect != got {
+		t.Fatalf("Responses mismatch:\nExpect:\t%d\nGot:\t%d\n", expect, got)
+	}
+	b, _ := json.Marshal(resps[0].Result)
+	var res InitializeResult
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Capabilities.HoverProvider || res.Capabilities.TextDocumentSync != syncFull {
+		t.Errorf("Capabilities mismatch:\nExpect:\thover, full sync\nGot:\t%+v\n", res.Capabilities)
+	}
+	if resps[1].Error == nil || resps[1].Error.Code != jsonrpc.MethodNotFound {
+		t.Errorf("Unknown method error mismatch:\nExpect:\t%d\nGot:\t%+v\n", jsonrpc.MethodNotFound, resps[1].Error)
+	}
+}
+
+func TestURI(t *testing.T) {
+	if expect, got := "/tmp/a b/main.go", uriToPath(pathToURI("/tmp/a b/main.go")); expect != got {
+		t.Errorf("URI round trip mismatch:\nExpect:\t%s\nGot:\t%s\n", expect, got)
+	}
+}
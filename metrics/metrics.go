@@ -0,0 +1,195 @@
+// Package metrics provides counters and timers of the phases of the analyses,
+// for diagnosing inputs which are slow (or large) to analyse.
+//
+// The metrics are process-wide, and are published with expvar (as the map
+// "gospal", served at /debug/vars by the expvar handler), in the Prometheus
+// text format by Handler, and as a summary by WriteSummary.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric is a counter or timer.
+type Metric interface {
+	Name() string
+	Help() string
+}
+
+// Counter is a monotonic counter, safe for concurrent use.
+type Counter struct {
+	name, help string
+	n          int64
+}
+
+func (c *Counter) Name() string { return c.name }
+func (c *Counter) Help() string { return c.help }
+
+// Inc increments the counter.
+func (c *Counter) Inc() { atomic.AddInt64(&c.n, 1) }
+
+// Add adds n to the counter.
+func (c *Counter) Add(n int64) { atomic.AddInt64(&c.n, n) }
+
+// Value returns the value of the counter.
+func (c *Counter) Value() int64 { return atomic.LoadInt64(&c.n) }
+
+// Timer is the total duration and number of runs of a phase, safe for
+// concurrent use.
+type Timer struct {
+	name, help string
+	count      int64
+	total      int64 // Nanoseconds.
+}
+
+func (t *Timer) Name() string { return t.name }
+func (t *Timer) Help() string { return t.help }
+
+// Start starts a run of the phase, and returns a function which stops it,
+// e.g.
+//
+//	defer metrics.Build.Start()()
+func (t *Timer) Start() func() {
+	start := time.Now()
+	return func() { t.Observe(time.Since(start)) }
+}
+
+// Observe records a run of the phase of duration d.
+func (t *Timer) Observe(d time.Duration) {
+	atomic.AddInt64(&t.count, 1)
+	atomic.AddInt64(&t.total, int64(d))
+}
+
+// Count returns the number of runs of the phase.
+func (t *Timer) Count() int64 { return atomic.LoadInt64(&t.count) }
+
+// Total returns the total duration of the runs of the phase.
+func (t *Timer) Total() time.Duration { return time.Duration(atomic.LoadInt64(&t.total)) }
+
+var registry struct {
+	sync.Mutex
+	metrics []Metric
+}
+
+// NewCounter returns a new registered Counter.
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(c)
+	return c
+}
+
+// NewTimer returns a new registered Timer.
+func NewTimer(name, help string) *Timer {
+	t := &Timer{name: name, help: help}
+	register(t)
+	return t
+}
+
+func register(m Metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// All returns the registered metrics, in order of registration.
+func All() []Metric {
+	registry.Lock()
+	defer registry.Unlock()
+	return append([]Metric(nil), registry.metrics...)
+}
+
+// Metrics of the phases of the analyses.
+var (
+	Build           = NewTimer("build", "Loading, type-checking and building SSA of programs")
+	Inference       = NewTimer("inference", "MiGo inference of programs")
+	FuncsEntered    = NewCounter("funcs_entered", "Function instances analysed by MiGo inference")
+	Lookups         = NewCounter("lookups", "Implementations of invoke calls looked up")
+	LookupMisses    = NewCounter("lookup_misses", "Implementations of invoke calls not found")
+	ImplCacheGets   = NewCounter("impl_cache_gets", "Lookups of concrete values and methods in caches of implementations")
+	ImplCacheMisses = NewCounter("impl_cache_misses", "Lookups of concrete values and methods not cached")
+	InternGets      = NewCounter("intern_gets", "Lookups of names in tables of interned strings")
+	InternMisses    = NewCounter("intern_misses", "Names interned, i.e. lookups of names not interned")
+	StoreGets       = NewCounter("store_gets", "Lookups of variables in analysis stores")
+	StoreMisses     = NewCounter("store_misses", "Lookups of undefined variables in analysis stores")
+	SummariesReused = NewCounter("summaries_reused", "Calls reusing the definition of an equivalent context")
+	Widenings       = NewCounter("widenings", "Widenings of abstract states of blocks")
+)
+
+func init() {
+	expvar.Publish("gospal", expvar.Func(func() interface{} {
+		vars := make(map[string]interface{})
+		for _, m := range All() {
+			switch m := m.(type) {
+			case *Counter:
+				vars[m.Name()] = m.Value()
+			case *Timer:
+				vars[m.Name()+"_count"] = m.Count()
+				vars[m.Name()+"_seconds"] = m.Total().Seconds()
+			}
+		}
+		return vars
+	}))
+}
+
+// WritePrometheus writes the metrics to w in the Prometheus text format, with
+// names prefixed by gospal_.
+func WritePrometheus(w io.Writer) {
+	for _, m := range All() {
+		switch m := m.(type) {
+		case *Counter:
+			fmt.Fprintf(w, "# HELP gospal_%s_total %s\n", m.Name(), m.Help())
+			fmt.Fprintf(w, "# TYPE gospal_%s_total counter\n", m.Name())
+			fmt.Fprintf(w, "gospal_%s_total %d\n", m.Name(), m.Value())
+		case *Timer:
+			fmt.Fprintf(w, "# HELP gospal_%s_seconds %s\n", m.Name(), m.Help())
+			fmt.Fprintf(w, "# TYPE gospal_%s_seconds summary\n", m.Name())
+			fmt.Fprintf(w, "gospal_%s_seconds_sum %g\n", m.Name(), m.Total().Seconds())
+			fmt.Fprintf(w, "gospal_%s_seconds_count %d\n", m.Name(), m.Count())
+		}
+	}
+}
+
+// Handler returns an http.Handler serving the metrics in the Prometheus text
+// format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w)
+	})
+}
+
+// WriteSummary writes a summary of the metrics to w, one per line, with the
+// hit rates of lookups, caches of implementations and stores, e.g.
+//
+//	build          1 run(s), 412ms
+//	inference      1 run(s), 35ms
+//	funcs_entered  12
+//	...
+//	store hit rate 97.2%
+func WriteSummary(w io.Writer) {
+	for _, m := range All() {
+		switch m := m.(type) {
+		case *Counter:
+			fmt.Fprintf(w, "%-14s %d\n", m.Name(), m.Value())
+		case *Timer:
+			fmt.Fprintf(w, "%-14s %d run(s), %v\n", m.Name(), m.Count(), m.Total().Round(time.Microsecond))
+		}
+	}
+	writeRate(w, "lookup", Lookups, LookupMisses)
+	writeRate(w, "impl cache", ImplCacheGets, ImplCacheMisses)
+	writeRate(w, "intern", InternGets, InternMisses)
+	writeRate(w, "store", StoreGets, StoreMisses)
+}
+
+// writeRate writes the hit rate of the lookups of name, if any.
+func writeRate(w io.Writer, name string, total, misses *Counter) {
+	if n := total.Value(); n > 0 {
+		fmt.Fprintf(w, "%s hit rate %.1f%%\n", name, 100*float64(n-misses.Value())/float64(n))
+	}
+}
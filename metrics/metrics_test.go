@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests counters and timers in the Prometheus format and the summary.
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_counter", "Test counter")
+	c.Inc()
+	c.Add(2)
+	tm := NewTimer("test_timer", "Test timer")
+	tm.Observe(1500 * time.Millisecond)
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf)
+	for _, line := range []string{
+		"# TYPE gospal_test_counter_total counter",
+		"gospal_test_counter_total 3",
+		"gospal_test_timer_seconds_sum 1.5",
+		"gospal_test_timer_seconds_count 1",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Prometheus output mismatch:\nExpect:\t%s\nGot:\t%s\n", line, buf.String())
+		}
+	}
+
+	buf.Reset()
+	StoreGets.Add(4)
+	StoreMisses.Add(1)
+	WriteSummary(&buf)
+	for _, line := range []string{"test_counter   3", "test_timer     1 run(s), 1.5s", "store hit rate"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Summary mismatch:\nExpect:\t%s\nGot:\t%s\n", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package migoinfer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
+	gossa "golang.org/x/tools/go/ssa"
+)
+
+// DebugFunc records the state of the analysis at the entry and exit of each
+// block of fn during the analysis (see WriteDebugFunc).
+func (i *Inferer) DebugFunc(fn *gossa.Function) {
+	i.Env.DebugFunc = fn
+}
+
+// WriteDebugFunc writes the SSA of the debugged function, the store at the
+// entry and exit of each block, and the MiGo fragment emitted for the block,
+// side by side, for each instance of the function analysed.
+func (i *Inferer) WriteDebugFunc(w io.Writer) {
+	fn := i.Env.DebugFunc
+	if fn == nil {
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", fn.String(), i.Info.FSet.Position(fn.Pos()))
+	if len(i.Env.BlockStates) == 0 {
+		fmt.Fprintln(w, "not analysed (unreachable from the entry points, or modelled)")
+		return
+	}
+	defs := make(map[string]string)
+	for _, f := range i.Env.Prog.Funcs {
+		defs[f.SimpleName()] = f.String()
+	}
+	states := i.Env.BlockStates
+	for len(states) > 0 {
+		entry, exit := states[0], (*migoinfer.BlockState)(nil)
+		states = states[1:]
+		if len(states) > 0 && states[0].Exit && states[0].Instance == entry.Instance && states[0].Block == entry.Block {
+			exit, states = &states[0], states[1:]
+		}
+		blk := fn.Blocks[entry.Block]
+		fmt.Fprintf(w, "\n%s block %d (%s)\n", entry.Instance, blk.Index, blk.Comment)
+
+		var ssaCol, storeCol, migoCol []string
+		for _, instr := range blk.Instrs {
+			if v, ok := instr.(gossa.Value); ok && v.Name() != "" {
+				ssaCol = append(ssaCol, fmt.Sprintf("%s = %s", v.Name(), instr.String()))
+			} else {
+				ssaCol = append(ssaCol, instr.String())
+			}
+		}
+		storeCol = append(storeCol, "entry:")
+		storeCol = append(storeCol, stateLines(entry)...)
+		if exit != nil {
+			storeCol = append(storeCol, "exit:")
+			storeCol = append(storeCol, stateLines(*exit)...)
+		}
+		if def, ok := defs[entry.Def]; ok {
+			migoCol = strings.Split(strings.TrimRight(def, "\n"), "\n")
+		} else {
+			migoCol = []string{fmt.Sprintf("(%s removed)", entry.Def)}
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.Debug)
+		fmt.Fprintln(tw, "SSA\tStore\tMiGo")
+		for n := 0; n < len(ssaCol) || n < len(storeCol) || n < len(migoCol); n++ {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", cell(ssaCol, n), cell(storeCol, n), cell(migoCol, n))
+		}
+		tw.Flush()
+	}
+}
+
+// stateLines returns the lines of the store and exported variables of s.
+func stateLines(s migoinfer.BlockState) []string {
+	var lines []string
+	for _, v := range s.Store {
+		lines = append(lines, "  "+v)
+	}
+	if len(s.Exported) > 0 {
+		lines = append(lines, "  exported: "+strings.Join(s.Exported, ", "))
+	}
+	return lines
+}
+
+// cell returns line n of a column, without tabs, or empty if out of range.
+func cell(col []string, n int) string {
+	if n >= len(col) {
+		return ""
+	}
+	return strings.Replace(col[n], "\t", "    ", -1)
+}
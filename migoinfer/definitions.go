@@ -0,0 +1,74 @@
+package migoinfer
+
+import (
+	"strings"
+
+	"github.com/nickng/migo"
+	gossa "golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Definition is a MiGo definition with its source metadata.
+type Definition struct {
+	Name    string   `json:"name"`              // Name of the definition, e.g. main.main#2.
+	Params  []string `json:"params"`            // Parameters.
+	Func    string   `json:"func,omitempty"`    // Go function of the definition.
+	Pos     string   `json:"pos,omitempty"`     // Position of the Go function.
+	Spawn   string   `json:"spawn,omitempty"`   // Spawn site, if spawned as a goroutine.
+	Cond    string   `json:"cond,omitempty"`    // Branch condition, if a branch.
+	CondPos string   `json:"condPos,omitempty"` // Position of the branch condition.
+	MiGo    string   `json:"migo"`              // MiGo of the definition.
+}
+
+// Definitions returns the definitions of the inferred MiGo program with their
+// source metadata, in the order of the program.
+func (i *Inferer) Definitions() []Definition {
+	fns := i.Env.DefFuncs()
+	var byName map[string]*gossa.Function // Functions by name, for entry points.
+	defs := []Definition{}
+	spawns := i.spawnSites()
+	for _, f := range i.Env.Prog.Funcs {
+		def := Definition{Name: f.SimpleName(), Params: []string{}, MiGo: f.String()}
+		for _, p := range f.Params {
+			def.Params = append(def.Params, p.Callee.Name())
+		}
+		base := def.Name
+		if idx := strings.Index(base, "#"); idx >= 0 {
+			base = base[:idx]
+		}
+		fn, ok := fns[base]
+		if !ok {
+			if byName == nil {
+				byName = make(map[string]*gossa.Function)
+				for fn := range ssautil.AllFunctions(i.Info.Prog) {
+					byName[fn.String()] = fn
+				}
+			}
+			fn = byName[base]
+		}
+		if fn != nil {
+			def.Func = fn.String()
+			if fn.Pos().IsValid() {
+				def.Pos = i.Info.FSet.Position(fn.Pos()).String()
+			}
+		}
+		def.Spawn = spawns[def.Name]
+		if cond, ok := i.Env.BranchConds[def.Name]; ok {
+			if idx := strings.Index(cond, "\t"); idx >= 0 {
+				def.Cond, def.CondPos = cond[:idx], cond[idx+1:]
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// spawnSites returns the spawn sites of the definitions by name, as the
+// definitions are named (see migo.Function.SimpleName).
+func (i *Inferer) spawnSites() map[string]string {
+	sites := make(map[string]string, len(i.Env.Spawns))
+	for def, pos := range i.Env.Spawns {
+		sites[migo.NewFunction(def).SimpleName()] = pos
+	}
+	return sites
+}
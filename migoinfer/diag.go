@@ -0,0 +1,153 @@
+package migoinfer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
+)
+
+// LeakDiagnostics returns the goroutines which may leak as diagnostics, at
+// the spawn sites of the goroutines.
+func (i *Inferer) LeakDiagnostics() []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	for _, leak := range i.Leaks() {
+		reason := "peer not on every path of " + leak.Spawner
+		if leak.NoPeer {
+			reason = "no peer"
+		}
+		diags = append(diags, diag.Diagnostic{
+			Rule:    diag.GoroutineLeak,
+			Message: fmt.Sprintf("goroutine %s may leak: blocked on %s %s (%s)", leak.Goroutine, leak.Op, leak.Chan, reason),
+			Pos:     diag.ParsePos(leak.SpawnPos),
+		})
+	}
+	return diags
+}
+
+// panicRules are the rules of the panics found by the deadlock checker.
+var panicRules = map[string]diag.Rule{
+	"send on closed channel":  diag.SendOnClosed,
+	"close of closed channel": diag.DoubleClose,
+	"close of nil channel":    diag.CloseOfNil,
+}
+
+// DeadlockDiagnostics returns the deadlocks (and panics on channels) found
+// within bounds as diagnostics, at the spawn site of a blocked (or panicking)
+// goroutine, with the creation sites of the channels blocked on as related
+// locations.
+func (i *Inferer) DeadlockDiagnostics(bounds migoinfer.Bounds) []diag.Diagnostic {
+	deadlocks, _ := i.Deadlocks(bounds)
+	var diags []diag.Diagnostic
+	for _, d := range deadlocks {
+		kind, rule, state := "partial deadlock (after main terminates)", diag.PartialDeadlock, "blocked"
+		if d.Global {
+			kind, rule = "global deadlock", diag.GlobalDeadlock
+		}
+		if r, ok := panicRules[d.Panic]; ok {
+			kind, rule, state = "panic: "+d.Panic, r, "panics"
+		}
+		dg := diag.Diagnostic{Rule: rule}
+		var blocked []string
+		for _, b := range d.Blocked {
+			blocked = append(blocked, fmt.Sprintf("%s %s in %s on %s", b.Goroutine, state, b.Def, strings.Join(b.Ops, " | ")))
+			if pos := diag.ParsePos(b.SpawnPos); pos.Filename != "" && dg.Pos.Filename == "" {
+				dg.Pos = pos
+			}
+			for _, chPos := range b.ChanPos {
+				if pos := diag.ParsePos(chPos); pos.Filename != "" {
+					dg.Related = append(dg.Related, diag.Location{Pos: pos, Message: "channel created here"})
+				}
+			}
+		}
+		dg.Message = fmt.Sprintf("%s: %s", kind, strings.Join(blocked, "; "))
+		diags = append(diags, dg)
+	}
+	return diags
+}
+
+// UnrollDiagnostics returns the loops unrolled up to the unroll limit as
+// diagnostics, at the creation sites of the channels of the loops.
+func (i *Inferer) UnrollDiagnostics() []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	for _, t := range i.TruncatedUnrolls() {
+		diags = append(diags, diag.Diagnostic{
+			Rule:    diag.UnrollTruncated,
+			Message: fmt.Sprintf("loop in %s creating a channel per iteration unrolled %d of %d iterations", t.Func, t.Limit, t.Iterations),
+			Pos:     diag.ParsePos(t.Pos),
+		})
+	}
+	return diags
+}
+
+// misuseRules are the rules of the kinds of channel misuses.
+var misuseRules = map[string]diag.Rule{
+	"send on closed":    diag.SendOnClosed,
+	"double close":      diag.DoubleClose,
+	"close by receiver": diag.CloseByReceiver,
+	"recv never sent":   diag.RecvNeverSent,
+}
+
+// ChanMisuseDiagnostics returns the misuses of channels as diagnostics, with
+// the other operations on the channel as related locations.
+func (i *Inferer) ChanMisuseDiagnostics() []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	for _, m := range i.ChanMisuses() {
+		dg := diag.Diagnostic{
+			Rule:    misuseRules[m.Kind],
+			Message: fmt.Sprintf("%s: %s", m.Kind, m.Message),
+			Pos:     diag.ParsePos(m.Pos),
+		}
+		for _, e := range m.Evidence {
+			if parts := strings.SplitN(e, ": ", 2); len(parts) == 2 {
+				dg.Related = append(dg.Related, diag.Location{Pos: diag.ParsePos(parts[0]), Message: parts[1]})
+			}
+		}
+		diags = append(diags, dg)
+	}
+	return diags
+}
+
+// LockCycleDiagnostics returns the cycles of the lock-order graph as
+// diagnostics, at the first acquisition of each cycle, with the acquisitions
+// of the cycle as related locations.
+func (i *Inferer) LockCycleDiagnostics() []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	for _, c := range i.LockCycles() {
+		dg := diag.Diagnostic{
+			Rule:    diag.LockOrder,
+			Message: fmt.Sprintf("lock order cycle %s → %s", strings.Join(c.Locks, " → "), c.Locks[0]),
+			Pos:     diag.ParsePos(c.Pos()),
+		}
+		for _, e := range c.Edges {
+			for _, acq := range []migoinfer.LockAcq{e.Held, e.Acquired} {
+				if len(acq.Stack) > 0 {
+					dg.Related = append(dg.Related, diag.Location{Pos: diag.ParsePos(acq.Stack[0]), Message: acq.String()})
+				}
+			}
+		}
+		diags = append(diags, dg)
+	}
+	return diags
+}
+
+// UnusedEndpointDiagnostics returns the channels where a direction is never
+// used as diagnostics, at the creation sites of the channels.
+func (i *Inferer) UnusedEndpointDiagnostics() []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	for _, u := range i.UnusedEndpoints() {
+		dg := diag.Diagnostic{
+			Rule:    diag.UnusedEndpoint,
+			Message: fmt.Sprintf("channel %s %s", u.Chan, u.Message),
+			Pos:     diag.ParsePos(u.Pos),
+		}
+		for _, op := range u.Used {
+			if parts := strings.SplitN(op, ": ", 2); len(parts) == 2 {
+				dg.Related = append(dg.Related, diag.Location{Pos: diag.ParsePos(parts[0]), Message: parts[1]})
+			}
+		}
+		diags = append(diags, dg)
+	}
+	return diags
+}
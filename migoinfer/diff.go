@@ -0,0 +1,165 @@
+package migoinfer
+
+// Behavioural diff.
+//
+// The MiGo definitions of two inferred programs are compared by name, after
+// normalising the names local to each definition (parameters, let-bound
+// variables and channels created) to the order of their binding, so that
+// renaming of SSA values in unrelated changes does not show in the diff.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// migoIdent matches identifiers and keywords of MiGo.
+var migoIdent = regexp.MustCompile(`[^\s(),;:=]+`)
+
+// DefDiff is the difference of a MiGo definition between two programs.
+type DefDiff struct {
+	Name string
+	Old  []string // Normalised lines of the old definition, nil if added.
+	New  []string // Normalised lines of the new definition, nil if removed.
+}
+
+// Kind returns the kind of the difference: added, removed or changed.
+func (d DefDiff) Kind() string {
+	switch {
+	case d.Old == nil:
+		return "added"
+	case d.New == nil:
+		return "removed"
+	}
+	return "changed"
+}
+
+// WriteTo writes the difference to w, one line of the definitions per line
+// prefixed by - if removed or + if added, e.g.
+//
+//	changed main.worker
+//	  def main.worker(p0):
+//	-     send p0;
+//	+     recv p0;
+func (d DefDiff) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", d.Kind(), d.Name)
+	for _, l := range diffLines(d.Old, d.New) {
+		buf.WriteString(l + "\n")
+	}
+	return buf.WriteTo(w)
+}
+
+// Diff returns the differences of the definitions of the MiGo programs
+// inferred by old and new, sorted by name of definition.
+func Diff(old, new *Inferer) []DefDiff {
+	olds, news := normalisedDefs(old), normalisedDefs(new)
+	var diffs []DefDiff
+	for name, o := range olds {
+		n, ok := news[name]
+		if !ok {
+			diffs = append(diffs, DefDiff{Name: name, Old: o})
+		} else if strings.Join(o, "\n") != strings.Join(n, "\n") {
+			diffs = append(diffs, DefDiff{Name: name, Old: o, New: n})
+		}
+	}
+	for name, n := range news {
+		if _, ok := olds[name]; !ok {
+			diffs = append(diffs, DefDiff{Name: name, New: n})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs
+}
+
+// normalisedDefs returns the normalised definitions of the MiGo program
+// inferred by i, by name.
+func normalisedDefs(i *Inferer) map[string][]string {
+	defs := make(map[string][]string)
+	for _, f := range i.Env.Prog.Funcs {
+		defs[f.SimpleName()] = Normalise(f.String())
+	}
+	return defs
+}
+
+// Normalise returns the lines of MiGo definition def, with its parameters
+// renamed to p0, p1, ..., its let-bound variables to v0, v1, ... and the
+// channels it creates to c0, c1, ..., in order of binding.
+func Normalise(def string) []string {
+	names := make(map[string]string)
+	bind := func(id, prefix string, n *int) {
+		names[id] = fmt.Sprintf("%s%d", prefix, *n)
+		*n++
+	}
+	var params, vars, chans int
+	var lines []string
+	for i, line := range strings.Split(strings.TrimRight(def, "\n"), "\n") {
+		ids := migoIdent.FindAllStringIndex(line, -1)
+		for j, idx := range ids {
+			id := line[idx[0]:idx[1]]
+			switch {
+			case i == 0 && j > 1: // def name(params):
+				bind(id, "p", &params)
+			case j > 0 && line[ids[j-1][0]:ids[j-1][1]] == "let":
+				bind(id, "v", &vars)
+			case j > 0 && line[ids[j-1][0]:ids[j-1][1]] == "newchan":
+				bind(id, "c", &chans)
+			}
+		}
+		var buf bytes.Buffer
+		last := 0
+		for _, idx := range ids {
+			buf.WriteString(line[last:idx[0]])
+			id := line[idx[0]:idx[1]]
+			if name, ok := names[id]; ok {
+				id = name
+			}
+			buf.WriteString(id)
+			last = idx[1]
+		}
+		buf.WriteString(line[last:])
+		lines = append(lines, buf.String())
+	}
+	return lines
+}
+
+// diffLines returns the lines of a and b prefixed by "- " if only in a, "+ "
+// if only in b, or "  " if in both, in the order of a longest common
+// subsequence.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:], b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -2,16 +2,24 @@ package migoinfer
 
 import (
 	"fmt"
+	"go/types"
 	"io"
 	"io/ioutil"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
-	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/callgraph"
 	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/metrics"
 	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
 	"github.com/nickng/gospal/ssa"
 	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/sym"
+	"github.com/nickng/gospal/tracing"
 	"github.com/nickng/migo"
+	gossa "golang.org/x/tools/go/ssa"
 )
 
 // Inferer is the main MiGo inference entry point.
@@ -21,7 +29,11 @@ type Inferer struct {
 	MiGo      *migo.Program         // MiGo program.
 	EntryFunc string
 
-	Raw bool
+	Raw    bool
+	Tests  bool             // Also analyse from the test main packages.
+	Bounds migoinfer.Bounds // Bounds of the exploration of states by the writers of deadlocks and buffers.
+
+	stream bool // Write definitions as they are finalised (see Stream).
 
 	outWriter io.Writer // Output stream.
 	errWriter io.Writer // Error stream.
@@ -35,6 +47,7 @@ func New(info *ssa.Info, w io.Writer) *Inferer {
 		Info:      info,
 		MiGo:      migo.NewProgram(),
 		Raw:       false,
+		Bounds:    migoinfer.DefaultBounds(),
 		outWriter: ioutil.Discard,
 		errWriter: ioutil.Discard,
 		Logger:    newLogger(),
@@ -42,6 +55,7 @@ func New(info *ssa.Info, w io.Writer) *Inferer {
 	if w != nil {
 		inferer.errWriter = w
 	}
+	inferer.registerHandlers()
 	return &inferer
 }
 
@@ -49,69 +63,608 @@ func (i *Inferer) SetEntryFunc(path string) {
 	i.EntryFunc = path
 }
 
+// SetTests sets whether the test main packages (of packages loaded with their
+// tests) are analysed with the main packages.
+func (i *Inferer) SetTests(tests bool) {
+	i.Tests = tests
+}
+
+// DisableModel removes the builtin behavioural model of the library function
+// name (e.g. "net/http.ListenAndServe"), so the function body is analysed.
+func (i *Inferer) DisableModel(name string) {
+	delete(i.Env.Models, name)
+}
+
+// SkipFunc models the function name (e.g. "(*os/exec.Cmd).Run") as not
+// communicating, so the function body is not analysed.
+func (i *Inferer) SkipFunc(name string) {
+	i.Env.Models[name] = migoinfer.NoComm
+}
+
+// SetFilter analyses only the bodies of functions matching a glob pattern of
+// include (or all functions if include is empty) and no pattern of exclude,
+// e.g. "*/mocks" or "*.pb.go" (see migoinfer.Filter). Calls of the other
+// functions are handled as calls of functions which do not communicate.
+func (i *Inferer) SetFilter(include, exclude []string) {
+	if len(include) == 0 && len(exclude) == 0 {
+		i.Env.Filter = nil
+		return
+	}
+	i.Env.Filter = &migoinfer.Filter{Include: include, Exclude: exclude}
+}
+
+// SetCallGraph uses the callgraph g to resolve calls of interface methods and
+// function values which cannot be resolved locally.
+func (i *Inferer) SetCallGraph(g *callgraph.Graph) {
+	i.Env.CallGraph = g
+}
+
+// SetSolver uses the solver s to prune branches which are infeasible given the
+// conditions of the dominating branches and the constant arguments of the
+// call (see package sym). Pruning is disabled if s is nil.
+func (i *Inferer) SetSolver(s sym.Solver) {
+	i.Env.Solver = s
+}
+
+// SetBudget bounds the wall-clock time d and heap size (in bytes) of the
+// analysis (0 means unbounded). The analysis degrades when half of the budget
+// is used (functions are analysed once, context-insensitive), and when the
+// budget is exceeded (functions not analysed are opaque), see Approximations.
+func (i *Inferer) SetBudget(d time.Duration, heap uint64) {
+	if d == 0 && heap == 0 {
+		i.Env.Budget = nil
+		return
+	}
+	i.Env.Budget = &migoinfer.Budget{Time: d, Heap: heap}
+}
+
+// SummariseSilent does not analyse (nor spawn in MiGo) the goroutines which do
+// not communicate, i.e. without channel, lock or spawn operations, which
+// shrinks the model. The goroutines are reported by SilentGoroutines either
+// way.
+func (i *Inferer) SummariseSilent(summarise bool) {
+	i.Env.SummariseSilent = summarise
+}
+
+// ReuseSummaries reuses the MiGo definition of a function for calls in
+// contexts equivalent for the function, i.e. which differ only in bindings
+// the function does not use, instead of analysing the function in each
+// context, which shrinks the model and the analysis time of fan-in heavy
+// programs (see the summaries_reused metric).
+func (i *Inferer) ReuseSummaries(reuse bool) {
+	i.Env.ReuseSummaries = reuse
+}
+
+// Stream writes the MiGo definitions to the output as they are finalised
+// during Analyse, instead of building the program in memory and writing it at
+// the end, so the memory of the emission does not grow with the program.
+// Definitions called but never finalised (e.g. opaque functions) are written
+// as stubs at the end. The output is not cleaned up (as if Raw), and the
+// program is not kept for the other analyses (e.g. deadlocks).
+func (i *Inferer) Stream(stream bool) {
+	i.stream = stream
+}
+
+// SilentGoroutines returns the spawns of goroutines which do not communicate,
+// e.g. where communication is expected but missing.
+func (i *Inferer) SilentGoroutines() []migoinfer.SilentGoroutine {
+	return i.Env.Silent
+}
+
+// WriteSilentGoroutines writes the spawns of goroutines which do not
+// communicate to w, one per line, e.g.
+//
+//	main.go:12:2: goroutine main.compute does not communicate (no channel, lock or spawn operations)
+func (i *Inferer) WriteSilentGoroutines(w io.Writer) {
+	for _, s := range i.SilentGoroutines() {
+		fmt.Fprintln(w, s.String())
+	}
+}
+
+// Approximations returns the calls analysed with degraded precision because
+// the budget of the analysis is used up (see SetBudget), or the context depth
+// is reached (see SetContextDepth).
+func (i *Inferer) Approximations() []migoinfer.Approximation {
+	return i.Env.Degraded
+}
+
+// WriteApproximations writes the calls analysed with degraded precision to w,
+// one function per line, e.g.
+//
+//	main.go:12:6: main.worker summarised as opaque (not communicating) at 3 call site(s): 10.002s of time budget 10s used
+func (i *Inferer) WriteApproximations(w io.Writer) {
+	for _, a := range i.Approximations() {
+		fmt.Fprintln(w, a.String())
+	}
+}
+
+// DefaultUnrollLimit is the default maximum number of iterations unrolled of a
+// loop creating a channel per iteration (see SetUnrollLimit).
+const DefaultUnrollLimit = migoinfer.DefaultUnrollLimit
+
+// SetUnrollLimit sets the maximum number of iterations unrolled of a loop
+// with a constant number of iterations creating a channel per iteration
+// (DefaultUnrollLimit by default), where a limit below 2 disables
+// unrolling. Loops with more iterations are unrolled up to the limit, see
+// TruncatedUnrolls.
+func (i *Inferer) SetUnrollLimit(limit int) {
+	i.Env.UnrollLimit = limit
+}
+
+// SetContextDepth sets the maximum number of calls in the context of a
+// function analysed separately (0, the default, means unbounded). A call
+// nested deeper to a function already analysed calls its existing definition,
+// and is reported in Approximations.
+func (i *Inferer) SetContextDepth(depth int) {
+	i.Env.ContextDepth = depth
+}
+
+// TruncatedUnrolls returns the loops creating a channel per iteration with
+// more iterations than the unroll limit (see SetUnrollLimit).
+func (i *Inferer) TruncatedUnrolls() []migoinfer.TruncatedUnroll {
+	return i.Env.Truncated
+}
+
+// WriteTruncatedUnrolls writes the loops unrolled up to the unroll limit to w,
+// one loop per line, e.g.
+//
+//	main.go:8:14: loop in main.main creating a channel per iteration unrolled 8 of 100 iterations
+func (i *Inferer) WriteTruncatedUnrolls(w io.Writer) {
+	for _, t := range i.TruncatedUnrolls() {
+		fmt.Fprintln(w, t.String())
+	}
+}
+
 func (i *Inferer) Analyse() {
-	go i.Env.HandleErrors()
+	defer metrics.Inference.Start()()
+	i.Env.Span = tracing.Start(nil, "inference")
+	defer i.Env.Span.End()
+	defer i.handleErrors()()
 	// Sync error ignored. See https://github.com/uber-go/zap/issues/328
 	defer i.Logger.Sync()
 
+	if i.stream {
+		i.Env.Stream = migoinfer.NewStream(i.outWriter)
+	}
 	pkg := migoinfer.NewPackage(&i.Env)
 	pkg.SetLogger(i.Logger)
 	// Package/global variables initialisation.
 	for _, p := range i.Info.Prog.AllPackages() {
 		pkg.InitGlobals(p)
-		pkg.VisitInit(p)
 	}
 	if i.EntryFunc == "" { // main.main
-		// Find main packages to start analysis.
-		mains, err := ssa.MainPkgs(i.Info.Prog, false)
+		entries, err := i.entries()
 		if err != nil {
 			log.Fatal("Cannot find main package:", err)
 		}
-		// Call context
-		ctx := callctx.Toplevel()
-		if l, ok := ctx.(store.Logger); ok {
-			l.SetLog(i.errWriter)
-		}
-		for _, main := range mains {
-			if mainFn := main.Func("main"); mainFn != nil {
-				mainDef := funcs.MakeCall(funcs.MakeDefinition(mainFn), nil, nil)
-				mainFnAnalyser := migoinfer.NewFunction(mainDef, ctx, &i.Env)
-				mainFnAnalyser.SetLogger(i.Logger)
-				mainFnAnalyser.EnterFunc(mainDef.Function())
+		mains := false
+		for _, e := range entries {
+			if e.main {
+				mains = true
 			}
 		}
+		if !mains {
+			i.visitInits(pkg)
+		}
+		for _, e := range entries {
+			i.analyseEntrypoint(e)
+		}
 	} else {
 		fn, err := i.Info.FindFunc(i.EntryFunc)
 		if err != nil {
 			log.Fatalf("Cannot find entry function %s", i.EntryFunc)
 		}
-		ctx := callctx.Toplevel()
-		if l, ok := ctx.(store.Logger); ok {
-			l.SetLog(i.errWriter)
-		}
-		if fn != nil {
-			fnDef := funcs.MakeCall(funcs.MakeDefinition(fn), nil, nil)
-			fnAnalyser := migoinfer.NewFunction(fnDef, ctx, &i.Env)
-			fnAnalyser.SetLogger(i.Logger)
-			fnAnalyser.EnterFunc(fnDef.Function())
+		i.analyseFrom(pkg, fn)
+	}
+	if i.Env.Stream != nil {
+		if err := i.Env.Stream.Close(); err != nil {
+			log.Print("Cannot write MiGo: ", err)
 		}
+		return
 	}
 	if !i.Raw {
 		i.Env.Prog.CleanUp()
 	}
+	i.writeProg()
+}
+
+// writeProg writes the MiGo program to the output, main.main first if
+// analysed from the main functions.
+func (i *Inferer) writeProg() {
 	if i.EntryFunc == "" { // main.main
 		// Print main.main first.
 		for _, f := range i.Env.Prog.Funcs {
 			if f.SimpleName() == "main.main" {
-				fmt.Fprintf(i.outWriter, f.String())
+				fmt.Fprint(i.outWriter, f.String())
 			}
 		}
 		for _, f := range i.Env.Prog.Funcs {
 			if f.SimpleName() != "main.main" {
-				fmt.Fprintf(i.outWriter, f.String())
+				fmt.Fprint(i.outWriter, f.String())
+			}
+		}
+	}
+}
+
+// Entrypoints returns the entry functions of the program, i.e. the main
+// functions of the main packages and the functions with the entrypoint
+// directive, in order of position.
+func (i *Inferer) Entrypoints() []*gossa.Function {
+	var entries []*gossa.Function
+	mains, _ := ssa.MainPkgs(i.Info.Prog, false)
+	for _, main := range mains {
+		if fn := main.Func("main"); fn != nil {
+			entries = append(entries, fn)
+		}
+	}
+	entries = append(entries, i.entrypoints()...)
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].Pos() < entries[b].Pos() })
+	return entries
+}
+
+// handleErrors reports the errors of the analysis until the returned function
+// is called, which ends the reporting (and so the references to the program)
+// once the analysis is done.
+func (i *Inferer) handleErrors() (stop func()) {
+	errs := make(chan error)
+	i.Env.Errors = errs
+	go i.Env.HandleErrors()
+	return func() { close(errs) }
+}
+
+// AnalyseEntry infers the MiGo program from entry function fn only, after
+// the initialisers of all packages. The program is not written to the output.
+func (i *Inferer) AnalyseEntry(fn *gossa.Function) {
+	defer metrics.Inference.Start()()
+	i.Env.Span = tracing.Start(nil, "inference", tracing.String("entry", fn.String()))
+	defer i.Env.Span.End()
+	defer i.handleErrors()()
+	// Sync error ignored. See https://github.com/uber-go/zap/issues/328
+	defer i.Logger.Sync()
+
+	pkg := migoinfer.NewPackage(&i.Env)
+	pkg.SetLogger(i.Logger)
+	for _, p := range i.Info.Prog.AllPackages() {
+		pkg.InitGlobals(p)
+	}
+	i.analyseFrom(pkg, fn)
+	if !i.Raw {
+		i.Env.Prog.CleanUp()
+	}
+}
+
+// analyseFrom analyses the program from entry function fn, after the
+// initialisers of all packages.
+func (i *Inferer) analyseFrom(pkg *migoinfer.Package, fn *gossa.Function) {
+	i.visitInits(pkg)
+	i.analyseEntry(fn)
+}
+
+// visitInits visits the initialisers of all packages.
+func (i *Inferer) visitInits(pkg *migoinfer.Package) {
+	for _, p := range i.Info.Prog.AllPackages() {
+		pkg.VisitInit(p)
+	}
+}
+
+// entrypoints returns the functions declared as entry points by a directive
+// (see ssa.Entrypoint), in source order.
+func (i *Inferer) entrypoints() []*gossa.Function {
+	var entries []*gossa.Function
+	for obj := range i.Info.Directives.Funcs {
+		if _, ok := i.Info.Directives.Func(obj, ssa.Entrypoint); ok {
+			if fn := i.Info.Prog.FuncValue(obj); fn != nil {
+				entries = append(entries, fn)
 			}
 		}
 	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Pos() < entries[b].Pos() })
+	return entries
+}
+
+// entrypoint is an entry point of the analysis.
+type entrypoint struct {
+	fn   *gossa.Function // Entry function.
+	main bool            // Main function of a main package.
+	init *gossa.Function // Initialiser of the main package (or nil).
+}
+
+// entries returns the entry points analysed by Analyse in order, i.e. the
+// main functions of the main packages (and test main packages if Tests), then
+// the functions with the entrypoint directive.
+func (i *Inferer) entries() ([]entrypoint, error) {
+	mains, err := ssa.MainPkgs(i.Info.Prog, false)
+	if i.Tests {
+		if tests, terr := ssa.MainPkgs(i.Info.Prog, true); terr == nil {
+			for _, test := range tests {
+				test.Build()
+			}
+			mains, err = append(mains, tests...), nil
+		}
+	}
+	var entries []entrypoint
+	for _, main := range mains {
+		if fn := main.Func("main"); fn != nil {
+			entries = append(entries, entrypoint{fn: fn, main: true, init: main.Func("init")})
+		}
+	}
+	for _, fn := range i.entrypoints() {
+		entries = append(entries, entrypoint{fn: fn})
+	}
+	if err != nil && len(entries) == 0 {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// analyseEntrypoint analyses the program from entry point e. The main
+// function of a main package is analysed after its initialiser, which
+// initialises all (imported) packages.
+func (i *Inferer) analyseEntrypoint(e entrypoint) {
+	if !e.main {
+		i.analyseEntry(e.fn)
+		return
+	}
+	ctx := i.Env.Toplevel
+	if l, ok := ctx.(store.Logger); ok {
+		l.SetLog(i.errWriter)
+	}
+	mainDef := funcs.MakeCall(funcs.MakeDefinition(e.fn), nil, nil)
+	mainFnAnalyser := migoinfer.NewFunction(mainDef, ctx, &i.Env)
+	mainFnAnalyser.SetLogger(i.Logger)
+	if e.init != nil {
+		mainFnAnalyser.SetInits(e.init)
+	}
+	mainFnAnalyser.EnterFunc(mainDef.Function())
+}
+
+// analyseEntry analyses the program from entry function fn.
+func (i *Inferer) analyseEntry(fn *gossa.Function) {
+	ctx := i.Env.Toplevel
+	if l, ok := ctx.(store.Logger); ok {
+		l.SetLog(i.errWriter)
+	}
+	if fn != nil {
+		fnDef := funcs.MakeCall(funcs.MakeDefinition(fn), nil, nil)
+		fnAnalyser := migoinfer.NewFunction(fnDef, ctx, &i.Env)
+		fnAnalyser.SetLogger(i.Logger)
+		fnAnalyser.EnterFunc(fnDef.Function())
+	}
+}
+
+// Topology returns the communication topology of the program, i.e. the
+// goroutine spawns and the creator, senders, receivers and closers of each
+// channel, with their positions.
+func (i *Inferer) Topology() *migoinfer.Topology {
+	return i.Env.Topology()
+}
+
+// ChanDirs returns the directions of channel parameters of each function, i.e.
+// the endpoint of the channel the function may use, keyed by the function
+// (MiGo definition) name and the parameter name.
+func (i *Inferer) ChanDirs() map[string]map[string]types.ChanDir {
+	return i.Env.ChanDirs
+}
+
+// Timers returns the timer channels created by the time package (time.After,
+// time.NewTimer, time.Tick and time.NewTicker) with their durations, keyed by
+// MiGo channel name.
+func (i *Inferer) Timers() map[string]migoinfer.Timer {
+	return i.Env.Timers
+}
+
+// BranchConds returns the conditions of data-dependent branches, keyed by the
+// name of the MiGo definition containing the branch (if-then-else).
+func (i *Inferer) BranchConds() map[string]string {
+	return i.Env.BranchConds
+}
+
+// Leaks returns the goroutines which may leak (see migoinfer.FindLeaks) in the
+// inferred MiGo program.
+func (i *Inferer) Leaks() []migoinfer.Leak {
+	defer tracing.Start(nil, "check leaks").End()
+	return migoinfer.FindLeaks(i.Env.Prog, i.Env.Spawns)
+}
+
+// WriteLeaks writes the goroutines which may leak to w, one per line, e.g.
+//
+//	main.go:10:5: goroutine main.main$1 may leak: blocked on send ch (no peer)
+func (i *Inferer) WriteLeaks(w io.Writer) {
+	for _, leak := range i.Leaks() {
+		fmt.Fprintln(w, leak.String())
+	}
+}
+
+// ChanMisuses returns the misuses of channels (see migoinfer.FindChanMisuses)
+// found during inference.
+func (i *Inferer) ChanMisuses() []migoinfer.ChanMisuse {
+	defer tracing.Start(nil, "check channel misuses").End()
+	return migoinfer.FindChanMisuses(&i.Env)
+}
+
+// WriteChanMisuses writes the misuses of channels to w, each followed by the
+// other operations on the channel, e.g.
+//
+//	main.go:8:7: double close: channel t0 (created at main.go:4:12) may be closed twice (also closed at main.go:7:7)
+//		main.go:7:7: close via ch in main.main
+func (i *Inferer) WriteChanMisuses(w io.Writer) {
+	for _, m := range i.ChanMisuses() {
+		fmt.Fprintln(w, m.String())
+	}
+}
+
+// LockCycles returns the cycles of the lock-order graph (see
+// migoinfer.FindLockCycles), i.e. potential deadlocks by locks acquired in
+// inconsistent orders.
+func (i *Inferer) LockCycles() []migoinfer.LockCycle {
+	defer tracing.Start(nil, "check lock order").End()
+	return migoinfer.FindLockCycles(&i.Env)
+}
+
+// WriteLockCycles writes the cycles of the lock-order graph to w, each
+// followed by the acquisition stacks of its edges, e.g.
+//
+//	main.go:20:9: potential deadlock: lock order cycle (main.Bank).a → (main.Bank).b → (main.Bank).a
+//		(main.Bank).b at main.go:20:9 in (*main.Bank).AB ← main.main
+//			while holding (main.Bank).a at main.go:19:9 in (*main.Bank).AB ← main.main
+//		...
+func (i *Inferer) WriteLockCycles(w io.Writer) {
+	for _, c := range i.LockCycles() {
+		fmt.Fprintln(w, c.String())
+	}
+}
+
+// UnusedEndpoints returns the channels where a direction is never used (see
+// migoinfer.FindUnusedEndpoints).
+func (i *Inferer) UnusedEndpoints() []migoinfer.UnusedEndpoint {
+	defer tracing.Start(nil, "check unused endpoints").End()
+	return migoinfer.FindUnusedEndpoints(&i.Env)
+}
+
+// WriteUnusedEndpoints writes the channels where a direction is never used to
+// w, each followed by the operations on the used direction, e.g.
+//
+//	main.go:4:12: channel main.main0.t0_chan0 is sent to but never received from
+//		main.go:6:6: send via ch in main.main$1
+func (i *Inferer) WriteUnusedEndpoints(w io.Writer) {
+	for _, u := range i.UnusedEndpoints() {
+		fmt.Fprintln(w, u.String())
+	}
+}
+
+// DefaultBounds returns the default bounds of the exploration of states of the
+// inferred MiGo program (see Deadlocks).
+func DefaultBounds() migoinfer.Bounds {
+	return migoinfer.DefaultBounds()
+}
+
+// Deadlocks returns the deadlocks of the inferred MiGo program found by
+// bounded exploration of its states (see migoinfer.FindDeadlocks). The second
+// return value is false if the exploration reached the bounds.
+func (i *Inferer) Deadlocks(bounds migoinfer.Bounds) ([]migoinfer.Deadlock, bool) {
+	defer tracing.Start(nil, "check deadlocks").End()
+	return migoinfer.FindDeadlocks(i.Env.Prog, i.Env.Spawns, i.Env.Chans, bounds)
+}
+
+// DeadlocksFrom returns the deadlocks of the inferred MiGo program from the
+// definition of entry function fn (see Deadlocks).
+func (i *Inferer) DeadlocksFrom(fn *gossa.Function, bounds migoinfer.Bounds) ([]migoinfer.Deadlock, bool) {
+	defer tracing.Start(nil, "check deadlocks", tracing.String("entry", fn.String())).End()
+	entry := fn.String()
+	for def, f := range i.Env.DefFuncs() {
+		if f == fn {
+			entry = def
+		}
+	}
+	return migoinfer.FindDeadlocksFrom(i.Env.Prog, entry, i.Env.Spawns, i.Env.Chans, bounds)
+}
+
+// WriteDeadlocks writes the deadlocks of the inferred MiGo program to w, and
+// returns the number of deadlocks found, e.g.
+//
+//	global deadlock:
+//		goroutine main.main blocked in main.main on recv main.main0.t0_chan0
+//			channel created at main.go:4:12
+func (i *Inferer) WriteDeadlocks(w io.Writer) int {
+	deadlocks, complete := i.Deadlocks(i.Bounds)
+	for _, d := range deadlocks {
+		fmt.Fprintln(w, d.String())
+	}
+	if !complete {
+		fmt.Fprintln(w, "warning: state space bounds reached, deadlocks may be missed")
+	}
+	if len(deadlocks) == 0 && complete {
+		fmt.Fprintln(w, "no deadlock found")
+	}
+	return len(deadlocks)
+}
+
+// Buffers returns the sufficiency of the buffers of the buffered channels of
+// the inferred MiGo program (see migoinfer.FindBuffers), i.e. the smallest
+// buffer size which does not introduce deadlocks found within bounds.
+func (i *Inferer) Buffers(bounds migoinfer.Bounds) []migoinfer.Buffer {
+	return migoinfer.FindBuffers(i.Env.Prog, i.Env.Spawns, i.Env.Chans, bounds)
+}
+
+// WriteBuffers writes the sufficiency of the buffers of the buffered channels
+// to w, each followed by the deadlock with a smaller buffer if the buffer is
+// load-bearing, e.g.
+//
+//	main.go:5:12: channel main.main0.t0_chan0 buffer 10: load-bearing, needs 2
+//		global deadlock:
+//			goroutine main.main blocked in main.main on send main.main0.t0_chan0
+//				channel created at main.go:5:12
+func (i *Inferer) WriteBuffers(w io.Writer) {
+	for _, b := range i.Buffers(i.Bounds) {
+		fmt.Fprintln(w, b.String())
+	}
+}
+
+// WriteTrace writes the trace of MiGo actions steps (e.g. leading to a
+// deadlock) mapped back to the source to w (see migoinfer.Replay).
+func (i *Inferer) WriteTrace(w io.Writer, steps []migoinfer.Step) {
+	migoinfer.WriteTrace(w, migoinfer.Replay(&i.Env, steps))
+}
+
+// WriteDeadlockTraces writes the deadlocks of the inferred MiGo program to w,
+// each followed by the trace leading to the deadlock mapped back to the
+// source (see migoinfer.Replay), and returns the number of deadlocks found.
+func (i *Inferer) WriteDeadlockTraces(w io.Writer) int {
+	deadlocks, complete := i.Deadlocks(i.Bounds)
+	for _, d := range deadlocks {
+		fmt.Fprintln(w, d.String())
+		fmt.Fprintln(w, "trace:")
+		i.WriteTrace(w, d.Trace)
+	}
+	if !complete {
+		fmt.Fprintln(w, "warning: state space bounds reached, deadlocks may be missed")
+	}
+	if len(deadlocks) == 0 && complete {
+		fmt.Fprintln(w, "no deadlock found")
+	}
+	return len(deadlocks)
+}
+
+// ReplayTrace reads a trace of MiGo actions (e.g. a counterexample of an
+// external checker) from r in the format of migoinfer.ParseTrace, and writes
+// the trace mapped back to the source to w.
+func (i *Inferer) ReplayTrace(r io.Reader, w io.Writer) error {
+	trace, err := migoinfer.ParseTrace(r)
+	if err != nil {
+		return err
+	}
+	migoinfer.WriteTrace(w, migoinfer.Replay(&i.Env, trace))
+	return nil
+}
+
+// WriteChanDirs writes the directions of channel parameters of each MiGo
+// definition to w, e.g.
+//
+//	main.worker(jobs <-chan, results chan<-)
+func (i *Inferer) WriteChanDirs(w io.Writer) {
+	for _, f := range i.Env.Prog.Funcs {
+		dirs, ok := i.Env.ChanDirs[f.SimpleName()]
+		if !ok {
+			continue
+		}
+		var params []string
+		for _, p := range f.Params {
+			if dir, ok := dirs[p.Callee.Name()]; ok {
+				params = append(params, fmt.Sprintf("%s %s", p.Callee.Name(), chanDirString(dir)))
+			}
+		}
+		fmt.Fprintf(w, "%s(%s)\n", f.SimpleName(), strings.Join(params, ", "))
+	}
+}
+
+func chanDirString(dir types.ChanDir) string {
+	switch dir {
+	case types.SendOnly:
+		return "chan<-"
+	case types.RecvOnly:
+		return "<-chan"
+	}
+	return "chan"
 }
 
 // AddLogFiles extends current Logger and writes additional log to files.
@@ -2,15 +2,19 @@ package migoinfer_test
 
 import (
 	"bytes"
+	gobuild "go/build"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/nickng/gospal/diag"
 	"github.com/nickng/gospal/migoinfer"
 	"github.com/nickng/gospal/ssa/build"
+	"golang.org/x/tools/go/ssa"
 )
 
 func init() {
@@ -40,23 +44,56 @@ func TestPrimitives(t *testing.T) {
 		{"Send", "send"},
 		{"Recv", "recv"},
 		{"Close", "close"},
+		{"Range over channel closed later", "close-range"},
+		{"Deferred close", "defer-close"},
+		{"Mutual recursion", "recursion-mutual"},
+		{"Recursion through spawn", "recursive-spawn"},
+		{"Worker pool", "workerpool"},
+		{"signal.Notify", "signal-notify"},
+		{"Models of net/http, os/exec and bufio", "models-stdlib"},
 		{"Select", "select"},
 		{"Select2", "select2"},
 		{"Select with Default", "select-default"},
+		{"Select with only Default", "select-default-only"},
 		{"Select with Empty continuations", "select-nocont"},
+		{"Send under short-circuit condition", "branch-cond"},
 		{"Closure", "closure-send"},
 		{"Complex loop", "loop-complex"},
 		{"Channel direction", "chandir"},
 		{"Return channel/Set channel in struct", "returnch-setch"},
 		{"Interfaces with val receiver", "iface"},
 		{"Interfaces with ptr receiver", "iface2"},
+		{"Interface call with several implementations", "iface-choice"},
 		{"Channel chain by overwriting chan vars", "overwrite-chan"},
+		{"Channel chain spawning bound methods", "bound-spawn"},
+		{"Channels in struct fields shared by methods", "struct-methods"},
+		{"Broadcast over channels in a map", "map-broadcast"},
+		{"Loops guarded by atomic flags", "atomic-flag"},
+		{"Spawns in loops over a slice of channels", "range-spawn"},
+		{"Event loop returning from select", "event-loop"},
+		{"Anonymous goroutines with arguments and captures", "anon-spawn"},
+		{"reflect.Select over static and dynamic cases", "reflect-select"},
+		{"Channel converted to interface and named type", "convert-chan"},
 		{"While-true loop", "whiletrue"},
 		{"for-select loop", "for-select"},
 		{"nil channel", "nilchan"},
 		{"Select on nil channel", "nilchan2"},
 		{"Explicitly declared nil channel", "nilchan3"},
 		{"nil channel reuse with 2 channel", "nilchan4"},
+		{"Select case disabled by nil channel", "nilchan-select"},
+		{"Context with timeout", "context-timeout"},
+		{"Context cancelled by parent", "context-parent"},
+		{"Channel returned by accessor without body", "return-accessor"},
+		{"Select with time.After", "timer-after"},
+		{"Select with time.NewTimer", "timer-newtimer"},
+		{"Select with time.NewTicker", "timer-ticker"},
+		{"Timer reset in for-select loop", "timer-reset"},
+		{"Pipeline stages connected by returned channels", "pipeline"},
+		{"Request/reply channel", "reqreply"},
+		{"Channels created by package initialisers", "init-chan"},
+		{"Buffer size from package variables", "chansize-global"},
+		{"Call to function which does not return", "noreturn"},
+		{"Directives in comments", "directive"},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -96,3 +133,480 @@ func TestPrimitives(t *testing.T) {
 		})
 	}
 }
+
+// newInferer returns an inferer of the program in testdata dir, writing its
+// output to the returned buffer.
+func newInferer(t *testing.T, dir string) (*migoinfer.Inferer, *bytes.Buffer) {
+	t.Helper()
+	info, err := build.FromFiles(path.Join(tdRoot, dir, "main.go")).Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var buf bytes.Buffer
+	inferer := migoinfer.New(info, nil)
+	inferer.SetOutput(&buf)
+	return inferer, &buf
+}
+
+// infer analyses the program in testdata dir with the inferer configured by
+// setup (if not nil), and returns the inferer and its output.
+func infer(t *testing.T, dir string, setup func(*migoinfer.Inferer)) (*migoinfer.Inferer, string) {
+	t.Helper()
+	inferer, buf := newInferer(t, dir)
+	if setup != nil {
+		setup(inferer)
+	}
+	inferer.Analyse()
+	return inferer, buf.String()
+}
+
+// expectOutput compares the output got with the expected output in file of
+// testdata dir.
+func expectOutput(t *testing.T, dir, file, got string) {
+	t.Helper()
+	migob, err := ioutil.ReadFile(path.Join(tdRoot, dir, file))
+	if err != nil {
+		t.Fatalf("cannot read output file: %v", err)
+	}
+	if want, got := string(bytes.TrimSpace(migob)), strings.TrimSpace(got); want != got {
+		t.Errorf("Output of %s does not match\nExpect:\n%s\nGot:\n%s\n", path.Join(dir, file), want, got)
+	}
+}
+
+// Tests errgroup.Group with g.Go in a loop. The errgroup package is not a
+// dependency of the module, so a stub is loaded from the GOPATH of the test.
+func TestErrgroupLoop(t *testing.T) {
+	testdir := path.Join(tdRoot, "errgroup-loop")
+	t.Setenv("GO111MODULE", "off")
+	defer func(gopath string) { gobuild.Default.GOPATH = gopath }(gobuild.Default.GOPATH)
+	gobuild.Default.GOPATH = path.Join(testdir, "gopath")
+
+	_, got := infer(t, "errgroup-loop", nil)
+	expectOutput(t, "errgroup-loop", MiGoExpect, got)
+}
+
+// Tests that the parallel analysis emits the same program as the serial
+// analysis for any number of workers.
+func TestAnalyseParallel(t *testing.T) {
+	for _, dir := range []string{"whiletrue", "directive", "wide"} {
+		for _, reuse := range []bool{false, true} {
+			serial := analyseParallel(t, dir, reuse, 0)
+			for _, workers := range []int{1, 2, 8} {
+				if got := analyseParallel(t, dir, reuse, workers); got != serial {
+					t.Errorf("Parallel output of %s (%d workers, reuse summaries %t) does not match serial output\nExpect:\n%s\nGot:\n%s\n",
+						dir, workers, reuse, serial, got)
+				}
+			}
+		}
+	}
+}
+
+// analyseParallel returns the MiGo program of testdata dir, analysed by
+// workers (or serially if workers is 0).
+func analyseParallel(t *testing.T, dir string, reuse bool, workers int) string {
+	inferer, buf := newInferer(t, dir)
+	inferer.ReuseSummaries(reuse)
+	if workers == 0 {
+		inferer.Analyse()
+	} else {
+		inferer.AnalyseParallel(workers)
+	}
+	return buf.String()
+}
+
+// Tests that functions are summarised as opaque when the budget is exceeded.
+func TestBudget(t *testing.T) {
+	inferer, got := infer(t, "whiletrue", func(inferer *migoinfer.Inferer) {
+		inferer.SetBudget(time.Nanosecond, 0)
+	})
+	expectOutput(t, "whiletrue", "budget.expect", got)
+	approx := inferer.Approximations()
+	if len(approx) != 1 || approx[0].Func != "main.fork" || approx[0].Count != 2 {
+		t.Errorf("Approximations mismatch:\nExpect:\t%s\nGot:\t%v\n", "main.fork opaque at 2 call site(s)", approx)
+	}
+}
+
+// Tests that calls deeper than the context depth reuse the definitions of
+// functions already analysed.
+func TestContextDepth(t *testing.T) {
+	inferer, got := infer(t, "context-depth", func(inferer *migoinfer.Inferer) {
+		inferer.SetContextDepth(1)
+	})
+	expectOutput(t, "context-depth", "depth1.expect", got)
+	approx := inferer.Approximations()
+	if len(approx) != 1 || approx[0].Func != "main.send" || approx[0].Level.String() != "context-insensitive" {
+		t.Errorf("Approximations mismatch:\nExpect:\t%s\nGot:\t%v\n", "main.send context-insensitive", approx)
+	}
+}
+
+// Tests calls of a library handled by plugin handlers, where a topic is a
+// buffered channel, Publish a send and Next a receive.
+func TestPlugin(t *testing.T) {
+	_, got := infer(t, "plugin", func(inferer *migoinfer.Inferer) {
+		inferer.HandleCall("main.NewTopic", func(e *migoinfer.Emitter, c *ssa.CallCommon, ret ssa.Value) bool {
+			if call, ok := ret.(*ssa.Call); ok {
+				e.NewChan(call, ret, 1)
+			}
+			return true
+		})
+		inferer.HandleInstr(func(e *migoinfer.Emitter, instr ssa.Instruction) bool {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok || call.Common().StaticCallee() == nil {
+				return false
+			}
+			switch call.Common().StaticCallee().String() {
+			case "(*main.Topic).Publish":
+				e.Send(instr, call.Common().Args[0])
+				return true
+			case "(*main.Topic).Next":
+				e.Recv(instr, call.Common().Args[0])
+				return true
+			}
+			return false
+		})
+	})
+	expectOutput(t, "plugin", MiGoExpect, got)
+}
+
+func TestSummaries(t *testing.T) {
+	sums, err := migoinfer.ReadSummaries(path.Join(tdRoot, "plugin", "summaries.yaml"))
+	if err != nil {
+		t.Fatalf("cannot read summaries: %v", err)
+	}
+	if len(sums) != 3 || sums[1].Func != "(*main.Topic).Publish" || sums[0].Effects[0].Size != 1 {
+		t.Fatalf("Summaries mismatch:\nGot:\t%+v\n", sums)
+	}
+	// The summaries model the library as the handlers in TestPlugin do.
+	_, got := infer(t, "plugin", func(inferer *migoinfer.Inferer) {
+		inferer.AddSummaries(sums)
+	})
+	expectOutput(t, "plugin", MiGoExpect, got)
+}
+
+func TestSummariesInvalid(t *testing.T) {
+	for _, data := range []string{
+		`[{"func": "f", "effects": [{"op": "wait"}]}]`,
+		`[{"func": "f", "params": ["ch"], "effects": [{"op": "send", "chan": "c"}]}]`,
+		`[{"effects": []}]`,
+	} {
+		if _, err := migoinfer.ParseSummaries([]byte(data), false); err == nil {
+			t.Errorf("Invalid summaries accepted: %s", data)
+		}
+	}
+}
+
+func TestLockOrder(t *testing.T) {
+	inferer, _ := infer(t, "lockorder", nil)
+	cycles := inferer.LockCycles()
+	if len(cycles) != 1 {
+		t.Fatalf("Lock order cycles mismatch:\nExpect:\t%d\nGot:\t%v\n", 1, cycles)
+	}
+	expect := []string{"(main.Bank).a", "(main.Bank).b"}
+	if got := cycles[0].Locks; strings.Join(got, " ") != strings.Join(expect, " ") {
+		t.Errorf("Locks mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+	}
+	for _, e := range cycles[0].Edges {
+		if len(e.Acquired.Stack) < 2 || len(e.Held.Stack) < 2 {
+			t.Errorf("Acquisition stack missing:\nGot:\t%v\n", e)
+		}
+	}
+}
+
+func TestSilentGoroutines(t *testing.T) {
+	for _, summarise := range []bool{false, true} {
+		// Raw, as the empty definitions of silent goroutines and their
+		// spawns are removed from the cleaned up program anyway.
+		inferer, got := infer(t, "silent", func(inferer *migoinfer.Inferer) {
+			inferer.Raw = true
+			inferer.SummariseSilent(summarise)
+		})
+		silent := inferer.SilentGoroutines()
+		if len(silent) != 1 || silent[0].Func != "main.compute" {
+			t.Errorf("Silent goroutines mismatch:\nExpect:\t%s\nGot:\t%v\n", "main.compute", silent)
+		}
+		if summarise {
+			expectOutput(t, "silent", "summarise.expect", got)
+		} else {
+			expectOutput(t, "silent", "raw.expect", got)
+		}
+	}
+}
+
+func TestReuseSummaries(t *testing.T) {
+	_, got := infer(t, "fanin", func(inferer *migoinfer.Inferer) {
+		inferer.ReuseSummaries(true)
+	})
+	expectOutput(t, "fanin", "reuse.expect", got)
+}
+
+// Tests that the streamed definitions are the raw definitions, written once.
+func TestStream(t *testing.T) {
+	defs := func(stream bool) []string {
+		_, got := infer(t, "fanin", func(inferer *migoinfer.Inferer) {
+			inferer.Raw = true
+			inferer.Stream(stream)
+		})
+		var headers []string
+		for _, line := range strings.Split(got, "\n") {
+			if strings.HasPrefix(line, "def ") {
+				headers = append(headers, line)
+			}
+		}
+		return headers
+	}
+	streamed := make(map[string]int)
+	for _, def := range defs(true) {
+		streamed[def]++
+	}
+	for def, n := range streamed {
+		if n != 1 {
+			t.Errorf("Definitions %s mismatch:\nExpect:\t%d\nGot:\t%d\n", def, 1, n)
+		}
+	}
+	for _, def := range defs(false) {
+		if streamed[def] == 0 {
+			t.Errorf("Definition %s not streamed", def)
+		}
+	}
+}
+
+// Tests that a loop creating a channel per iteration is unrolled up to the
+// unroll limit.
+func TestUnroll(t *testing.T) {
+	for _, tc := range []struct {
+		limit     int
+		expect    string // Expected output.
+		truncated int
+	}{
+		{limit: migoinfer.DefaultUnrollLimit, expect: MiGoExpect, truncated: 0},
+		{limit: 2, expect: "limit2.expect", truncated: 1},
+		{limit: 0, expect: "limit0.expect", truncated: 1},
+	} {
+		inferer, got := infer(t, "unroll", func(inferer *migoinfer.Inferer) {
+			inferer.SetUnrollLimit(tc.limit)
+		})
+		expectOutput(t, "unroll", tc.expect, got)
+		if truncated := len(inferer.UnrollDiagnostics()); truncated != tc.truncated {
+			t.Errorf("Truncated loops with limit %d mismatch:\nExpect:\t%d\nGot:\t%d\n", tc.limit, tc.truncated, truncated)
+		}
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	inferer, _ := infer(t, "buffers", nil)
+	needed := make(map[int64]int64) // Size → needed.
+	for _, b := range inferer.Buffers(migoinfer.DefaultBounds()) {
+		needed[b.Size] = b.Needed
+	}
+	expect := map[int64]int64{2: 2, 10: 1}
+	for size, n := range expect {
+		if needed[size] != n {
+			t.Errorf("Buffer of size %d mismatch:\nExpect:\t%d\nGot:\t%d\n", size, n, needed[size])
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	inferer, _ := infer(t, "verify", nil)
+
+	// Gong reads closures with $ replaced.
+	gong := &migoinfer.Gong{Command: []string{"sh", "-c", `grep -q 'spawn main.main_1(' "$1" && echo 'Liveness: True'; echo 'Safety: False'`, "sh"}}
+	v, err := inferer.Verify(gong)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	expect := []migoinfer.Property{{Name: "Liveness", Holds: true}, {Name: "Safety", Holds: false}}
+	if len(v.Properties) != len(expect) || v.Properties[0] != expect[0] || v.Properties[1] != expect[1] {
+		t.Errorf("Gong verdict mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, v.Properties)
+	}
+	if v.Holds() || len(v.Diagnostics()) != 1 {
+		t.Errorf("Expecting 1 property not shown: %v", v.Diagnostics())
+	}
+
+	kittel := &migoinfer.KITTeL{Command: []string{"sh", "-c", `grep -q '^eval_main_count_start(' "$1" && echo 'Termination successfully shown!'`, "sh"}}
+	if v, err = inferer.Verify(kittel); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if len(v.Properties) != 1 || v.Properties[0].Name != "termination of main.count" || !v.Holds() {
+		t.Errorf("KITTeL verdict mismatch:\nExpect:\t%s\nGot:\t%v\n", "termination of main.count", v.Properties)
+	}
+}
+
+func TestWriteITS(t *testing.T) {
+	info, err := build.FromFiles(path.Join(tdRoot, "verify", "main.go")).Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	fn, err := info.FindFunc("main.count")
+	if err != nil || fn == nil {
+		t.Fatalf("cannot find main.count: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := migoinfer.WriteITS(&buf, fn); err != nil {
+		t.Fatalf("cannot write ITS: %v", err)
+	}
+	for _, expect := range []string{"eval_main_count_start(v_n, ", " + 1)", " < v_n ]", " >= v_n ]"} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Expecting %q in ITS:\n%s", expect, buf.String())
+		}
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	inferer, _ := infer(t, "verify", nil)
+
+	defs := make(map[string]migoinfer.Definition)
+	for _, def := range inferer.Definitions() {
+		defs[def.Name] = def
+	}
+	if def, ok := defs["main.main"]; !ok || def.Func != "main.main" || !strings.Contains(def.Pos, "main.go:13") {
+		t.Errorf("Definition main.main mismatch:\nExpect:\t%s\nGot:\t%+v\n", "main.main at main.go:13", def)
+	}
+	if def, ok := defs["main.main$1"]; !ok || !strings.Contains(def.Spawn, "main.go:15") || def.MiGo == "" {
+		t.Errorf("Definition main.main$1 mismatch:\nExpect:\t%s\nGot:\t%+v\n", "spawned at main.go:15", def)
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	def := "def main.f(ch, done):\n    let t0 = newchan main.f0.t0_chan0, 0;\n    send ch;\n    recv t0;\n"
+	expect := []string{"def main.f(p0, p1):", "    let v0 = newchan c0, 0;", "    send p0;", "    recv v0;"}
+	if got := migoinfer.Normalise(def); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("Normalised definition mismatch:\nExpect:\t%q\nGot:\t%q\n", expect, got)
+	}
+
+	old, _ := infer(t, "verify", nil)
+	new, _ := infer(t, "verify", nil)
+	if diffs := migoinfer.Diff(old, new); len(diffs) != 0 {
+		t.Errorf("Expecting no difference between the same programs but got %v", diffs)
+	}
+}
+
+func TestLogOptions(t *testing.T) {
+	info, err := build.FromFiles(path.Join(tdRoot, "verify", "main.go")).Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	f, err := ioutil.TempFile("", "gospal-log-")
+	if err != nil {
+		t.Fatalf("cannot create log: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	inferer := migoinfer.New(info, nil)
+	inferer.SetOutput(ioutil.Discard)
+	inferer.SetLogOptions(migoinfer.LogOptions{Level: migoinfer.Debug, JSON: true, Func: "main.count", Files: []string{f.Name()}})
+	inferer.Analyse()
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("cannot read log: %v", err)
+	}
+	if !strings.Contains(string(b), `"func":"main.count"`) {
+		t.Errorf("Expecting debug log of main.count but got:\n%s", b)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, tc := range []struct {
+		exclude []string
+		expect  string // Expected output.
+	}{
+		{exclude: nil, expect: MiGoExpect},
+		{exclude: []string{"*.go"}, expect: "exclude.expect"},
+	} {
+		_, got := infer(t, "verify", func(inferer *migoinfer.Inferer) {
+			inferer.SetFilter(nil, tc.exclude)
+		})
+		expectOutput(t, "verify", tc.expect, got)
+	}
+}
+
+func TestAnalyseEntry(t *testing.T) {
+	info, err := build.FromFiles(path.Join(tdRoot, "verify", "main.go")).Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	entries := inferer.Entrypoints()
+	if len(entries) != 1 || entries[0].Name() != "main" {
+		t.Fatalf("Entry points mismatch:\nExpect:\t%s\nGot:\t%v\n", "main.main", entries)
+	}
+	inferer.AnalyseEntry(entries[0])
+	if deadlocks, complete := inferer.DeadlocksFrom(entries[0], migoinfer.DefaultBounds()); len(deadlocks) != 0 || !complete {
+		t.Errorf("Expecting no deadlock from main.main but got %v (complete: %t)", deadlocks, complete)
+	}
+}
+
+// Tests that panics on channels found by the deadlock checker are reported
+// as diagnostics of their rule.
+func TestDeadlockPanic(t *testing.T) {
+	inferer, _ := infer(t, "deadlock-panic", nil)
+	diags := inferer.DeadlockDiagnostics(migoinfer.DefaultBounds())
+	if len(diags) == 0 {
+		t.Fatalf("Expecting %s but got no diagnostics", diag.DoubleClose.ID)
+	}
+	for _, d := range diags {
+		if d.Rule.Code != diag.DoubleClose.Code || !strings.HasPrefix(d.Message, "panic: close of closed channel: ") {
+			t.Errorf("Diagnostic mismatch:\nExpect:\t%s panic: close of closed channel\nGot:\t%s %s\n", diag.DoubleClose.ID, d.Rule.ID, d.Message)
+		}
+	}
+}
+
+// Tests the dump of the SSA, store and MiGo of the blocks of a function.
+func TestDebugFunc(t *testing.T) {
+	info, err := build.FromFiles(path.Join(tdRoot, "verify", "main.go")).Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	mainFn := inferer.Entrypoints()[0]
+	inferer.DebugFunc(mainFn)
+	inferer.AnalyseEntry(mainFn)
+	var buf bytes.Buffer
+	inferer.WriteDebugFunc(&buf)
+	for _, expect := range []string{"main.main", "SSA", "Store", "MiGo", "make chan int", "entry:", "exit:", "newchan"} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Expecting %q in dump of main.main:\n%s", expect, buf.String())
+		}
+	}
+}
+
+// Tests the communication topology, from the spawns and channel operations.
+func TestTopology(t *testing.T) {
+	inferer, _ := infer(t, "verify", nil)
+	topo := inferer.Topology()
+	if len(topo.Spawns) != 1 || topo.Spawns[0].Spawner != "main.main" || topo.Spawns[0].Spawned != "main.main$1" {
+		t.Errorf("Spawns mismatch:\nExpect:\t%s\nGot:\t%v\n", "main.main → main.main$1", topo.Spawns)
+	}
+	if len(topo.Chans) != 1 {
+		t.Fatalf("Channels mismatch:\nExpect:\t%d\nGot:\t%v\n", 1, topo.Chans)
+	}
+	ch := topo.Chans[0]
+	if ch.Creator != "main.main" || len(ch.Senders) != 1 || ch.Senders[0].Func != "main.main$1" || len(ch.Receivers) != 1 || ch.Receivers[0].Func != "main.main" {
+		t.Fatalf("Channel mismatch:\nExpect:\t%s\nGot:\t%+v\n", "main.main creates, main.main$1 sends, main.main receives", ch)
+	}
+	if !strings.Contains(ch.Senders[0].Pos, "main.go:15:") {
+		t.Errorf("Position of send mismatch:\nExpect:\t%s\nGot:\t%s\n", "main.go:15", ch.Senders[0].Pos)
+	}
+}
+
+// Tests the source map of a program with a goroutine sending to main.
+func TestSourceMap(t *testing.T) {
+	inferer, _ := infer(t, "verify", nil)
+	m := inferer.SourceMap()
+	if span, ok := m.Lookup("main.main"); !ok || span.Line != 13 {
+		t.Errorf("Span of main.main mismatch:\nExpect:\t%s\nGot:\t%s\n", "main.go:13", span)
+	}
+	if span, ok := m.Lookup("main.main$1/spawn"); !ok || span.Line != 15 {
+		t.Errorf("Span of spawn mismatch:\nExpect:\t%s\nGot:\t%s\n", "main.go:15", span)
+	}
+	found := false
+	for _, e := range m.Elements {
+		if e.Kind == "send" && e.Span.Line == 15 {
+			found = found || len(m.At(e.Span.File, 15, e.Span.Col)) > 0
+		}
+	}
+	if !found {
+		t.Errorf("Expecting send at main.go:15 but got %v", m.Elements)
+	}
+}
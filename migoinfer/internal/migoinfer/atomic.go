@@ -0,0 +1,174 @@
+package migoinfer
+
+// Models of sync/atomic flags.
+//
+// Atomic integers and booleans are commonly used as stop flags which gate
+// loops containing communication, e.g.
+//
+//	for atomic.LoadInt32(&stop) == 0 {
+//		ch <- x
+//	}
+//
+// A flag is a package variable or a struct field (of any struct value) which
+// is loaded atomically. The flag is shared state: a branch on the flag may
+// take the 'set' branch only if the flag is written (atomically by Store, Add,
+// Swap or CompareAndSwap, or assigned a non-zero value) somewhere in the
+// program. Otherwise the flag keeps its zero value, and only the 'unset' branch
+// is emitted, i.e. a loop gated by a flag which is never set does not
+// terminate.
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+const atomicPkg = "sync/atomic"
+
+// atomicOp returns the operation (e.g. Load, Store) and the address operated
+// on if c is a call to a sync/atomic function or method.
+func atomicOp(c *ssa.CallCommon) (op string, addr ssa.Value) {
+	fn := c.StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != atomicPkg || len(c.Args) == 0 {
+		return "", nil
+	}
+	for _, prefix := range []string{"Load", "Store", "Add", "Swap", "CompareAndSwap"} {
+		if strings.HasPrefix(fn.Name(), prefix) {
+			// Function: first argument is the address,
+			// Method (e.g. (*atomic.Bool).Load): receiver is the address.
+			return prefix, c.Args[0]
+		}
+	}
+	return "", nil
+}
+
+// flagOf returns the object (package variable or struct field) of the flag at
+// address addr, or nil if the flag cannot be identified.
+func flagOf(addr ssa.Value) types.Object {
+	switch addr := addr.(type) {
+	case *ssa.Global:
+		return addr.Object()
+	case *ssa.FieldAddr:
+		if t, ok := addr.X.Type().Underlying().(*types.Pointer); ok {
+			if s, ok := t.Elem().Underlying().(*types.Struct); ok {
+				return s.Field(addr.Field)
+			}
+		}
+	}
+	return nil
+}
+
+// atomicFlags returns the flags which are written atomically in the program.
+func (env *Environment) atomicFlags() map[types.Object]bool {
+	if env.flags != nil {
+		return env.flags
+	}
+	env.flags = make(map[types.Object]bool)
+	for fn := range ssautil.AllFunctions(env.Info.Prog) {
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				var addr ssa.Value
+				switch instr := instr.(type) {
+				case ssa.CallInstruction:
+					if op, a := atomicOp(instr.Common()); op != "" && op != "Load" {
+						addr = a
+					}
+				case *ssa.Store: // Non-atomic write.
+					if c, ok := instr.Val.(*ssa.Const); !ok || !isZero(c) {
+						addr = instr.Addr
+					}
+				}
+				if addr != nil {
+					if obj := flagOf(addr); obj != nil {
+						env.flags[obj] = true
+					}
+				}
+			}
+		}
+	}
+	return env.flags
+}
+
+// isZero returns true if c is the zero value of a flag.
+func isZero(c *ssa.Const) bool {
+	if c.Value == nil {
+		return true
+	}
+	switch c.Value.Kind() {
+	case constant.Bool:
+		return !constant.BoolVal(c.Value)
+	case constant.Int, constant.Float:
+		return constant.Sign(c.Value) == 0
+	}
+	return false
+}
+
+// unsetFlag returns the index of the successor taken by a branch on cond if
+// cond tests an atomic flag which is never set, or -1 otherwise.
+func (env *Environment) unsetFlag(cond ssa.Value) int {
+	taken, ok := env.zeroFlagCond(cond)
+	if !ok {
+		return -1
+	}
+	if taken {
+		return 0
+	}
+	return 1
+}
+
+// zeroFlagCond evaluates cond when the atomic flag it loads is zero, and
+// returns false as second return value if cond does not test a flag which is
+// never set.
+func (env *Environment) zeroFlagCond(cond ssa.Value) (val, ok bool) {
+	switch cond := cond.(type) {
+	case *ssa.UnOp:
+		if cond.Op == token.NOT {
+			val, ok := env.zeroFlagCond(cond.X)
+			return !val, ok
+		}
+	case *ssa.Call:
+		// e.g. (*atomic.Bool).Load()
+		if env.isNeverSet(cond) {
+			return false, true
+		}
+	case *ssa.BinOp:
+		load, c := cond.X, cond.Y
+		if _, isConst := load.(*ssa.Const); isConst {
+			load, c = c, load
+		}
+		k, isConst := c.(*ssa.Const)
+		if !isConst || k.Value == nil || !env.isNeverSet(load) {
+			return false, false
+		}
+		switch cond.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			zero := constant.MakeInt64(0)
+			if k.Value.Kind() == constant.Bool {
+				zero = constant.MakeBool(false)
+			}
+			if load == cond.X {
+				return constant.Compare(zero, cond.Op, k.Value), true
+			}
+			return constant.Compare(k.Value, cond.Op, zero), true
+		}
+	}
+	return false, false
+}
+
+// isNeverSet returns true if v is an atomic load of a flag which is never set.
+func (env *Environment) isNeverSet(v ssa.Value) bool {
+	call, ok := v.(*ssa.Call)
+	if !ok {
+		return false
+	}
+	if op, addr := atomicOp(call.Common()); op == "Load" {
+		if obj := flagOf(addr); obj != nil {
+			return !env.atomicFlags()[obj]
+		}
+	}
+	return false
+}
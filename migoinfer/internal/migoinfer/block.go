@@ -8,7 +8,9 @@ import (
 	"github.com/nickng/gospal/block"
 	"github.com/nickng/gospal/callctx"
 	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/internal/intern"
 	"github.com/nickng/gospal/loop"
+	"github.com/nickng/gospal/store/chans"
 	"github.com/nickng/migo"
 	"golang.org/x/tools/go/ssa"
 )
@@ -28,8 +30,11 @@ type Block struct {
 	callctx.Context                 // Function context.
 	Env             *Environment    // Program environment.
 
-	Loop      *loop.Detector // Loop detector.
-	*Exported                // Local variables.
+	Loop      *loop.Detector  // Loop detector.
+	*Exported                 // Local variables.
+	deferred  deferredStmts   // Emitted deferred calls.
+	inits     []*ssa.Function // Package initialisers to call on entry.
+	pools     poolFuncs       // Worker pools.
 	*Logger
 }
 
@@ -48,7 +53,7 @@ func NewBlock(fn *funcs.Instance, ctx callctx.Context, env *Environment) *Block
 		} else {
 			blks[i] = &BlockData{
 				visitNode: block.NewVisitNode(fn.Function().Blocks[i]),
-				migoFunc:  migo.NewFunction(fmt.Sprintf("%s#%d", fn.Name(), i)),
+				migoFunc:  migo.NewFunction(intern.Sprintf("%s#%d", fn.Name(), i)),
 			}
 		}
 	}
@@ -59,7 +64,10 @@ func NewBlock(fn *funcs.Instance, ctx callctx.Context, env *Environment) *Block
 		Context:    ctx,
 		Env:        env,
 		Loop:       loop.NewDetector(),
+		deferred:   make(deferredStmts),
+		pools:      make(poolFuncs),
 	}
+	b.Loop.SetRanges(env.intervals(fn.Function()))
 	return &b
 }
 
@@ -111,10 +119,7 @@ func (b *Block) PrevBlk() *ssa.BasicBlock {
 
 // SetLogger sets logger for Block.
 func (b *Block) SetLogger(l *Logger) {
-	b.Logger = &Logger{
-		SugaredLogger: l.SugaredLogger,
-		module:        color.GreenString("block"),
-	}
+	b.Logger = l.withModule(color.GreenString("block"))
 }
 
 // visitInstrs traverses the instructions inside the (unvisited) block.
@@ -124,9 +129,21 @@ func (b *Block) visitInstrs(blk *ssa.BasicBlock) {
 	// Create a new instruction visitor for a new MiGo function.
 	blkBody := NewInstruction(b.Callee, b.Context, b.Env, blkMeta.migoFunc)
 	blkBody.Exported = b.Exported
+	blkBody.deferred = b.deferred
+	blkBody.pools = b.pools
+	blkBody.loop = b.loopOf(blk)
 	blkBody.SetLogger(b.Logger)
+	if blk.Index == 0 {
+		for _, initFn := range b.inits {
+			blkBody.callInit(initFn)
+		}
+	}
+	b.recordState(blk, false)
 	// Handle control-flow instructions.
-	for _, instr := range blk.Instrs {
+	for i, instr := range blk.Instrs {
+		if i == len(blk.Instrs)-1 {
+			b.recordState(blk, true)
+		}
 		switch instr := instr.(type) { // These should be at the end of the blocks.
 		case *ssa.Jump:
 			blkBody.VisitJump(instr)
@@ -148,7 +165,12 @@ func (b *Block) visitInstrs(blk *ssa.BasicBlock) {
 			}
 			// Output if-then-else MiGo once.
 			if b.NodeVisited(blkMeta.visitNode) && !blkMeta.emitted {
-				if l := b.Loop.ForLoopAt(blk); blk.Comment == "for.loop" && l.ParamsOK() {
+				if poolFn, ok := b.pools[blk]; ok {
+					// Worker pool: replicated worker instead of the loop.
+					loopDone := migoCall(b.Callee.Name(), blk.Succs[1], blkBody.Exported)
+					blkMeta.migoFunc.AddStmts(migoPool(poolFn), loopDone)
+					blkMeta.emitted = true
+				} else if l := b.Loop.ForLoopAt(blk); blk.Comment == "for.loop" && l.ParamsOK() {
 					loopBody := migoCall(b.Callee.Name(), blk.Parent().Blocks[l.BodyIdx()], blkBody.Exported)
 					loopDone := migoCall(b.Callee.Name(), blk.Parent().Blocks[l.DoneIdx()], blkBody.Exported)
 					// For loop entry block.
@@ -162,16 +184,37 @@ func (b *Block) visitInstrs(blk *ssa.BasicBlock) {
 				} else if isSelCondBlk(instr.Cond) {
 					// Select case body block.
 					blkMeta.emitted = true
-				} else if blk.Comment != "cond.true" && blk.Comment != "cond.false" {
+				} else if ch := rangeChan(b.Context, instr.Cond); blk.Comment == "rangechan.loop" && ch != nil && !b.Env.mayClose(ch) {
+					// Channel is never closed: range loop does not terminate.
+					b.Debugf("%s Range over unclosed channel %s", b.Module(), ch.UniqName())
+					loopBody := migoCall(b.Callee.Name(), blk.Succs[0], blkBody.Exported)
+					blkMeta.migoFunc.AddStmts(loopBody)
+					blkMeta.emitted = true
+				} else if b.inForCond(blk) {
+					// Part of for-loop condition (see ifFor of loop header).
+				} else if succ := b.Env.unsetFlag(instr.Cond); succ >= 0 {
+					// Atomic flag is never set: only the unset branch is taken.
+					b.Debugf("%s Atomic flag never set: %s", b.Module(), instr.Cond.String())
+					blkMeta.migoFunc.AddStmts(migoCall(b.Callee.Name(), blk.Succs[succ], blkBody.Exported))
+					blkMeta.emitted = true
+				} else if succ := b.feasibleBranch(blk, instr); succ >= 0 {
+					// Condition decided by dominating branches and context.
+					b.Debugf("%s Infeasible branch pruned: %s\n\t%s",
+						b.Module(), instr.Cond.String(), b.Env.getPos(instr.Cond))
+					blkMeta.migoFunc.AddStmts(migoCall(b.Callee.Name(), blk.Succs[succ], blkBody.Exported))
+					blkMeta.emitted = true
+				} else {
 					callThen := migoCall(b.Callee.Name(), blk.Succs[0], blkBody.Exported)
 					callElse := migoCall(b.Callee.Name(), blk.Succs[1], blkBody.Exported)
-					// For loop intermediate blocks.
+					// Data-dependent branch: internal choice of both branches.
 					ifstmt := &migo.IfStatement{
 						Then: []migo.Statement{callThen},
 						Else: []migo.Statement{callElse},
 					}
 					blkMeta.migoFunc.AddStmts(ifstmt)
 					blkMeta.emitted = true
+					b.Env.BranchConds[blkMeta.migoFunc.SimpleName()] = fmt.Sprintf("%s\t%s",
+						instr.Cond.String(), b.Env.getPos(instr.Cond))
 				}
 			}
 
@@ -200,11 +243,28 @@ func (b *Block) visitInstrs(blk *ssa.BasicBlock) {
 			b.mergePhi(blkMeta, instr)
 			b.Loop.ExtractIndex(instr)
 
+		case *ssa.Next:
+			// Range loop header: the iterator is read in the loop body,
+			// which is visited before the header is (i.e. all in-edges).
+			blkBody.VisitNext(instr)
+
 		default:
 			if b.NodeVisited(blkMeta.visitNode) {
 				blkBody.VisitInstr(instr)
 			}
 		}
+		if blkBody.exited {
+			b.Debugf("%s Exit %s#%d (no return)", b.Module(), b.Callee.UniqName(), blk.Index)
+			// The successors are not reached from blk, but a block is only
+			// visited once all its in-edges are, e.g. the join of an if
+			// which calls log.Fatal.
+			for _, succ := range blk.Succs {
+				if !b.EdgeVisited(blkMeta.visitNode, b.meta[succ.Index].visitNode) {
+					b.JumpBlk(blk, succ)
+				}
+			}
+			break
+		}
 	}
 }
 
@@ -220,6 +280,34 @@ func isSelCondBlk(cond ssa.Value) bool {
 	return false
 }
 
+// rangeChan returns the channel ranged over if cond is the test of a range
+// loop over a channel, i.e. the ok of a comma-ok receive.
+func rangeChan(ctx callctx.Context, cond ssa.Value) *chans.Chan {
+	if ext, ok := cond.(*ssa.Extract); ok && ext.Index == 1 {
+		if recv, ok := ext.Tuple.(*ssa.UnOp); ok && recv.Op == token.ARROW {
+			if ch, ok := ctx.Get(recv.X).(*chans.Chan); ok {
+				return ch
+			}
+		}
+	}
+	return nil
+}
+
+// inForCond returns true if blk is part of a short-circuit condition (e.g.
+// a && b) of a for-loop, which is emitted as a whole by the loop header.
+func (b *Block) inForCond(blk *ssa.BasicBlock) bool {
+	if blk.Comment != "cond.true" && blk.Comment != "cond.false" {
+		return false
+	}
+	for (blk.Comment == "cond.true" || blk.Comment == "cond.false") && len(blk.Preds) > 0 {
+		blk = blk.Preds[0]
+	}
+	if l := b.Loop.ForLoopAt(blk); blk.Comment == "for.loop" && l != nil {
+		return l.ParamsOK()
+	}
+	return false
+}
+
 // mergePhi deals with variables in the context and exported names for φ.
 //
 // Given a φ-node, e.g.
@@ -0,0 +1,137 @@
+package migoinfer
+
+// Analysis budgets.
+//
+// A Budget bounds the wall-clock time and heap size of an analysis. The budget
+// is checked at each call (and spawn), and the analysis degrades as the budget
+// is used up instead of running forever (or out of memory):
+//
+//   - when half of the budget is used, calls to functions already analysed are
+//     no longer analysed again in the context of the call, but call the
+//     existing definition (context-insensitive), and
+//   - when the budget is exceeded, functions not analysed are summarised as
+//     opaque, i.e. not communicating, so the analysis finishes quickly.
+//
+// Each degraded call is recorded as an Approximation, which is reported so the
+// results can be interpreted accordingly.
+//
+// Independently of the budget, calls nested deeper than the context depth (if
+// any) to functions already analysed call the existing definition, i.e. the
+// contexts are k-limited.
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Degradation is the level of precision of an analysis.
+type Degradation int
+
+const (
+	Precise     Degradation = iota // Context-sensitive.
+	Insensitive                    // Functions analysed once.
+	Opaque                         // Functions not analysed.
+)
+
+func (d Degradation) String() string {
+	switch d {
+	case Insensitive:
+		return "context-insensitive"
+	case Opaque:
+		return "opaque"
+	}
+	return "precise"
+}
+
+// Budget is the resource budget of an analysis.
+type Budget struct {
+	Time time.Duration // Wall-clock time (0 means unbounded).
+	Heap uint64        // Heap size in bytes (0 means unbounded).
+
+	start  time.Time
+	calls  int
+	level  Degradation
+	reason string // Reason of the current level.
+}
+
+// heapSample is the number of checks between samples of the heap size, as
+// reading memory statistics stops the world.
+const heapSample = 64
+
+// check returns the current level of degradation given the resources used.
+func (b *Budget) check() Degradation {
+	if b == nil || b.level == Opaque {
+		return b.Level()
+	}
+	if b.start.IsZero() {
+		b.start = time.Now()
+	}
+	b.calls++
+	used, reason := 0.0, ""
+	if b.Time > 0 {
+		elapsed := time.Since(b.start)
+		used = elapsed.Seconds() / b.Time.Seconds()
+		reason = fmt.Sprintf("%v of time budget %v used", elapsed.Round(time.Millisecond), b.Time)
+	}
+	if b.Heap > 0 && b.calls%heapSample == 1 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		if heap := float64(m.HeapAlloc) / float64(b.Heap); heap > used {
+			used = heap
+			reason = fmt.Sprintf("%d MiB of heap budget %d MiB used", m.HeapAlloc>>20, b.Heap>>20)
+		}
+	}
+	switch {
+	case used >= 1:
+		b.level, b.reason = Opaque, reason
+	case used >= 0.5 && b.level < Insensitive:
+		b.level, b.reason = Insensitive, reason
+	}
+	return b.level
+}
+
+// Level returns the current level of degradation.
+func (b *Budget) Level() Degradation {
+	if b == nil {
+		return Precise
+	}
+	return b.level
+}
+
+// Approximation is a call analysed with degraded precision.
+type Approximation struct {
+	Func   string      // Function called (or spawned).
+	Pos    string      // First call site degraded.
+	Level  Degradation // Level of degradation.
+	Reason string      // Budget used when degraded.
+	Count  int         // Number of call sites degraded.
+}
+
+func (a Approximation) String() string {
+	what := "analysed once (context-insensitive)"
+	if a.Level == Opaque {
+		what = "summarised as opaque (not communicating)"
+	}
+	return fmt.Sprintf("%s: %s %s at %d call site(s): %s", a.Pos, a.Func, what, a.Count, a.Reason)
+}
+
+// approximate records a degraded call to fn at call site c, degraded because
+// of reason.
+func (env *Environment) approximate(fn *ssa.Function, c *ssa.CallCommon, level Degradation, reason string) {
+	for i := range env.Degraded {
+		if a := &env.Degraded[i]; a.Func == fn.String() && a.Level == level {
+			a.Count++
+			return
+		}
+	}
+	env.Degraded = append(env.Degraded, Approximation{
+		Func:   fn.String(),
+		Pos:    env.getPos(c),
+		Level:  level,
+		Reason: reason,
+		Count:  1,
+	})
+}
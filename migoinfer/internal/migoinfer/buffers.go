@@ -0,0 +1,199 @@
+package migoinfer
+
+// Buffer sufficiency.
+//
+// The buffer size of a channel is load-bearing if the program deadlocks with
+// a smaller buffer, i.e. the producers fill the buffer while the consumers are
+// blocked (or not ready yet), and the buffer is what keeps the producers from
+// blocking forever. FindBuffers checks each buffered channel of a MiGo program
+// with the bounded deadlock checker (see FindDeadlocks), replacing its buffer
+// size with smaller sizes, and reports the smallest size which does not
+// introduce deadlocks, e.g. a "magic" buffer of 10 which only needs 2.
+//
+// A buffer is insufficient if the program deadlocks with a send on the channel
+// blocked at the inferred size; larger sizes (up to MaxBufferGrowth more) are
+// then checked for the smallest size removing the deadlocks.
+//
+// The sizes are checked in increasing order, assuming a larger buffer does
+// not introduce deadlocks. The result is as precise as the inferred model: a
+// loop sending an unknown number of values is sent to at least once, so a
+// buffer sized by the number of iterations is not load-bearing in the model.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/migo"
+)
+
+// MaxBufferGrowth is the number of buffer slots added to an insufficient buffer
+// to find a sufficient size.
+const MaxBufferGrowth = 16
+
+// Buffer is the sufficiency of the buffer of a channel.
+type Buffer struct {
+	Chan     string    // MiGo channel name.
+	Pos      string    // Creation site.
+	Size     int64     // Inferred buffer size.
+	Needed   int64     // Smallest size without new deadlocks (-1 if unknown).
+	Deadlock *Deadlock // Deadlock with size Needed-1 (or at Size if insufficient).
+	Complete bool      // Bounds of checking not reached.
+}
+
+// LoadBearing returns true if the program deadlocks with a smaller buffer.
+func (b Buffer) LoadBearing() bool { return b.Needed > 0 }
+
+// Insufficient returns true if the program deadlocks with a send on the
+// channel blocked at the inferred size.
+func (b Buffer) Insufficient() bool { return b.Needed < 0 || b.Needed > b.Size }
+
+func (b Buffer) String() string {
+	pos := b.Pos
+	if pos == "" {
+		pos = "-"
+	}
+	var verdict string
+	switch {
+	case b.Needed < 0:
+		verdict = fmt.Sprintf("insufficient, deadlocks with up to %d", b.Size+MaxBufferGrowth)
+	case b.Needed > b.Size:
+		verdict = fmt.Sprintf("insufficient, needs %d", b.Needed)
+	case b.Needed == 0:
+		verdict = "not load-bearing, unbuffered does not deadlock"
+	case b.Needed == b.Size:
+		verdict = "load-bearing, every slot needed"
+	default:
+		verdict = fmt.Sprintf("load-bearing, needs %d", b.Needed)
+	}
+	s := fmt.Sprintf("%s: channel %s buffer %d: %s", pos, b.Chan, b.Size, verdict)
+	if !b.Complete {
+		s += " (bound reached, incomplete)"
+	}
+	if b.Deadlock != nil {
+		s += "\n\t" + strings.Replace(b.Deadlock.String(), "\n", "\n\t", -1)
+	}
+	return s
+}
+
+// FindBuffers returns the sufficiency of the buffers of the buffered channels
+// of prog, in order of channel name (see FindDeadlocks for the arguments).
+func FindBuffers(prog *migo.Program, spawns, chanPos map[string]string, bounds Bounds) []Buffer {
+	sizes := make(map[string]int64)
+	for _, f := range prog.Funcs {
+		bufferSizes(f.Stmts, sizes)
+	}
+	var names []string
+	for name, size := range sizes {
+		if size > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	check := func(name string, size int64) (map[string]Deadlock, bool) {
+		c := newChecker(spawns, chanPos, bounds)
+		if name != "" {
+			c.sizes = map[string]int64{name: size}
+		}
+		deadlocks, complete := c.run(prog)
+		keyed := make(map[string]Deadlock)
+		for _, d := range deadlocks {
+			keyed[d.String()] = d
+		}
+		return keyed, complete
+	}
+	base, baseComplete := check("", 0)
+
+	var buffers []Buffer
+	for _, name := range names {
+		b := Buffer{Chan: name, Pos: chanPos[name], Size: sizes[name], Needed: -1, Complete: baseComplete}
+		if d, ok := blockedSend(base, name); ok {
+			// Insufficient: grow the buffer until the send does not block.
+			b.Deadlock = &d
+			for size := b.Size + 1; size <= b.Size+MaxBufferGrowth; size++ {
+				deadlocks, complete := check(name, size)
+				b.Complete = b.Complete && complete
+				if _, ok := blockedSend(deadlocks, name); !ok {
+					b.Needed = size
+					break
+				}
+			}
+			buffers = append(buffers, b)
+			continue
+		}
+		b.Needed = b.Size
+		for size := int64(0); size < b.Size; size++ {
+			deadlocks, complete := check(name, size)
+			b.Complete = b.Complete && complete
+			d, ok := newDeadlock(base, deadlocks)
+			if !ok {
+				b.Needed = size
+				break
+			}
+			b.Deadlock = &d
+		}
+		buffers = append(buffers, b)
+	}
+	return buffers
+}
+
+// bufferSizes records the buffer sizes of the channels created by stmts.
+func bufferSizes(stmts []migo.Statement, sizes map[string]int64) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			if stmt.Chan != "nilchan" {
+				sizes[stmt.Chan] = stmt.Size
+			}
+		case *migo.IfStatement:
+			bufferSizes(stmt.Then, sizes)
+			bufferSizes(stmt.Else, sizes)
+		case *migo.IfForStatement:
+			bufferSizes(stmt.Then, sizes)
+			bufferSizes(stmt.Else, sizes)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				bufferSizes(c, sizes)
+			}
+		}
+	}
+}
+
+// blockedSend returns a deadlock of deadlocks where a send on channel name is
+// blocked.
+func blockedSend(deadlocks map[string]Deadlock, name string) (Deadlock, bool) {
+	for _, key := range sortedKeys(deadlocks) {
+		d := deadlocks[key]
+		if d.Panic != "" {
+			continue
+		}
+		for _, b := range d.Blocked {
+			for _, op := range b.Ops {
+				if op == fmt.Sprintf("%s %s", opSend, name) {
+					return d, true
+				}
+			}
+		}
+	}
+	return Deadlock{}, false
+}
+
+// newDeadlock returns a deadlock of deadlocks which is not in base.
+func newDeadlock(base, deadlocks map[string]Deadlock) (Deadlock, bool) {
+	for _, key := range sortedKeys(deadlocks) {
+		if _, ok := base[key]; !ok {
+			return deadlocks[key], true
+		}
+	}
+	return Deadlock{}, false
+}
+
+func sortedKeys(deadlocks map[string]Deadlock) []string {
+	keys := make([]string, 0, len(deadlocks))
+	for key := range deadlocks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,162 @@
+package migoinfer
+
+// Modelling of the standard context package.
+//
+// A cancellable context is represented by the channel returned by its Done()
+// method. The channel is created at the context.WithCancel (or WithTimeout,
+// WithDeadline) call site, and the cancel function closes it.
+//
+// Derived contexts from context.WithValue share the Done channel of the
+// parent. Contexts from context.Background() and context.TODO() are never
+// cancelled, so their Done channel is left undefined and becomes a nilchan.
+//
+// The cancel function closes the Done channel unless it is already closed
+// (see cancel.Close), since a context may be cancelled more than once, e.g. by
+// a cancel() followed by a deferred cancel().
+//
+// A context with a deadline (context.WithTimeout, WithDeadline) is cancelled
+// when the deadline expires, even if the cancel function is never called. The
+// call spawns an environment process which cancels the context after an
+// internal (τ) action, i.e.
+//
+//	def ch.deadline(ch): tau; cancel ch;
+//
+// A context derived from a cancellable parent is cancelled when the parent is.
+// As in the context package, the call spawns an environment process which
+// waits for either context to be cancelled, i.e.
+//
+//	def ch.propagate(parent, ch): select case recv parent; cancel ch; case recv ch; endselect;
+//
+// where cancel ch is the conditional close of cancel.Close, so the process is
+// blocked forever if neither context is ever cancelled (as reported by go vet
+// for a lost cancel function).
+
+import (
+	"fmt"
+	"go/types"
+
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/internal/cancel"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+const contextPkg = "context"
+
+// isContext returns true if t is context.Context or context.CancelFunc.
+//
+// Both types are handles to the Done channel of a context.
+func isContext(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok {
+		if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == contextPkg {
+			return obj.Name() == "Context" || obj.Name() == "CancelFunc"
+		}
+	}
+	return false
+}
+
+// visitContextCall handles calls to the context package, and returns true if
+// the call is fully handled (i.e. the callee should not be analysed).
+// The return value ret is nil if the call is not an *ssa.Call (e.g. deferred).
+func (v *Instruction) visitContextCall(c *ssa.CallCommon, ret ssa.Value) bool {
+	if c.IsInvoke() {
+		if !isContext(c.Value.Type()) {
+			return false
+		}
+		if c.Method.Name() == "Done" && ret != nil {
+			v.Debugf("%s context Done() %s", v.Module(), c.Value.Name())
+			v.Put(ret, v.Get(c.Value))
+		}
+		return true // Other methods (Err, Value, Deadline) do not communicate.
+	}
+	if isContext(c.Value.Type()) { // cancel()
+		if ch, ok := v.Get(c.Value).(*chans.Chan); ok {
+			name := v.FindExported(v.Context, ch)
+			if _, ok := name.(Unexported); ok {
+				v.Warnf("%s context cancel() %s unavail. in current scope (unexported)\n\t%s",
+					v.Module(), c.Value.Name(), v.Env.getPos(c.Value))
+				return true
+			}
+			v.Debugf("%s context cancel() %s", v.Module(), c.Value.Name())
+			v.MiGo.AddStmts(&cancel.Close{Chan: name.Name()})
+			v.MiGo.HasComm = true // Not a MiGo communication, kept by CleanUp.
+		}
+		return true
+	}
+	fn := c.StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != contextPkg {
+		return false
+	}
+	if ret == nil {
+		return true
+	}
+	switch fn.Name() {
+	case "WithCancel", "WithTimeout", "WithDeadline":
+		ch := chans.New(v.Callee, ret, 0)
+		if updater, ok := v.Context.(callctx.Updater); ok {
+			updater.PutUniq(ret, ch)
+		} else {
+			v.Fatal("Cannot update context")
+		}
+		v.Export(ret)
+		v.MiGo.AddStmts(migoNewChan(v.Logger, ret, ch))
+		if parent, ok := v.Get(c.Args[0]).(*chans.Chan); ok {
+			v.contextPropagate(parent, ret, ch)
+		}
+		if fn.Name() != "WithCancel" {
+			v.contextDeadline(ret, ch)
+		}
+	case "WithValue":
+		v.Put(ret, v.Get(c.Args[0]))
+	}
+	return true
+}
+
+// contextDeadline spawns the environment process cancelling the context with
+// Done channel ch (created as local) when its deadline expires.
+func (v *Instruction) contextDeadline(local ssa.Value, ch *chans.Chan) {
+	envFn := migo.NewFunction(fmt.Sprintf("%s.deadline", ch.UniqName()))
+	if !v.Env.deadlines[ch] {
+		envFn.AddParams(&migo.Parameter{Caller: local, Callee: local})
+		envFn.AddStmts(&migo.TauStatement{}, &cancel.Close{Chan: local.Name()})
+		envFn.HasComm = true
+		v.Env.addFunction(envFn)
+		v.Env.deadlines[ch] = true
+	}
+	v.Debugf("%s context deadline: spawn %s", v.Module(), envFn.SimpleName())
+	stmt := &migo.SpawnStatement{Name: envFn.Name}
+	stmt.AddParams(&migo.Parameter{Caller: local, Callee: local})
+	v.MiGo.AddStmts(stmt)
+}
+
+// contextPropagate spawns the environment process cancelling the context with
+// Done channel ch (created as local) when its parent context, with Done
+// channel parent, is cancelled.
+func (v *Instruction) contextPropagate(parent *chans.Chan, local ssa.Value, ch *chans.Chan) {
+	name := v.FindExported(v.Context, parent)
+	if _, ok := name.(Unexported); ok {
+		v.Debugf("%s context parent %s unavail. in current scope (unexported)",
+			v.Module(), parent.UniqName())
+		return
+	}
+	envFn, ok := v.Env.parents[ch]
+	if !ok {
+		envFn = migo.NewFunction(fmt.Sprintf("%s.propagate", ch.UniqName()))
+		envFn.AddParams(
+			&migo.Parameter{Caller: name, Callee: name},
+			&migo.Parameter{Caller: local, Callee: local})
+		envFn.AddStmts(&migo.SelectStatement{Cases: [][]migo.Statement{
+			{&migo.RecvStatement{Chan: name.Name()}, &cancel.Close{Chan: local.Name()}},
+			{&migo.RecvStatement{Chan: local.Name()}},
+		}})
+		v.Env.addFunction(envFn)
+		v.Env.parents[ch] = envFn
+	}
+	v.Debugf("%s context parent %s: spawn %s", v.Module(), parent.UniqName(), envFn.SimpleName())
+	stmt := &migo.SpawnStatement{Name: envFn.Name}
+	stmt.AddParams(
+		&migo.Parameter{Caller: name, Callee: envFn.Params[0].Callee},
+		&migo.Parameter{Caller: local, Callee: envFn.Params[1].Callee})
+	v.MiGo.AddStmts(stmt)
+}
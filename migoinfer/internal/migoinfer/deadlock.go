@@ -0,0 +1,750 @@
+package migoinfer
+
+// Bounded deadlock checking.
+//
+// FindDeadlocks explores the state space of an inferred MiGo program
+// explicitly, without external verification tools. A state is the channels
+// created so far (with the number of buffered values and whether they are
+// closed) and the processes, where a process is a stack of definitions being
+// executed. The semantics follows MiGo:
+//
+//   - send and receive on an unbuffered channel synchronise two processes,
+//     send (receive) on a buffered channel succeeds if the buffer is not full
+//     (empty), and receive on a closed channel always succeeds,
+//   - if-then-else is an internal choice, and select is an external choice of
+//     its cases (a τ guard, i.e. default, is always enabled),
+//   - a timeout (see timer.Timeout) is a receive from the buffer of the
+//     timer, filled when the timer is started (see timer.Start),
+//   - cancelling a context (see cancel.Close) closes its Done channel unless
+//     it is already closed,
+//   - operations on nilchan block forever, and operations on channels which
+//     are not bound (e.g. parameters of the entry definition) never block.
+//
+// A state with no transitions where some processes have not terminated is a
+// deadlock: a global deadlock if the main process is blocked, or a partial
+// deadlock if the main process has terminated but other processes are blocked
+// forever (i.e. goroutines leaked at exit). A close of a closed channel or of
+// nilchan, and a send on a closed channel, panic: the state after the action
+// is an error state, reported as a Deadlock with the panic (see
+// Deadlock.Panic), where the exploration stops.
+//
+// Actions local to a process (newchan, τ, call, spawn and if-then-else) are
+// independent of other processes, so only the local actions of one process
+// are explored in a state where such actions exist (partial-order reduction).
+// The reduction preserves deadlocks and error states since local actions are
+// invisible: they neither read nor change the channels, and do not enable or
+// disable the actions of other processes (a spawn only adds a process). A
+// process which only performs local actions forever (e.g. def f(): tau; call
+// f();) would hide the actions of the other processes, so all processes are
+// explored in a state where the local actions lead to a visited state (the
+// cycle condition of partial-order reduction).
+//
+// The exploration is bounded by the number of states, processes, nested calls
+// and channels. If a bound is reached the result is incomplete, i.e. deadlocks
+// may be missed.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/internal/cancel"
+	"github.com/nickng/gospal/internal/timer"
+	"github.com/nickng/migo"
+)
+
+// Default bounds of deadlock checking.
+const (
+	DefaultMaxStates = 100000
+	DefaultMaxProcs  = 32
+	DefaultMaxDepth  = 64
+	DefaultMaxChans  = 256
+)
+
+// Bounds are the limits of the state space explored by deadlock checking.
+type Bounds struct {
+	MaxStates int // Number of states.
+	MaxProcs  int // Number of processes in a state.
+	MaxDepth  int // Number of nested (non-tail) calls in a process.
+	MaxChans  int // Number of channels in a state.
+}
+
+// DefaultBounds returns the default bounds of deadlock checking.
+func DefaultBounds() Bounds {
+	return Bounds{
+		MaxStates: DefaultMaxStates,
+		MaxProcs:  DefaultMaxProcs,
+		MaxDepth:  DefaultMaxDepth,
+		MaxChans:  DefaultMaxChans,
+	}
+}
+
+// Blocked is a process blocked in a deadlock.
+type Blocked struct {
+	Goroutine string   // MiGo definition of the process (spawned or main).
+	ID        int      // Identifier of the process in the trace.
+	SpawnPos  string   // Position of spawn site (or empty if unknown).
+	Def       string   // MiGo definition where the process is blocked.
+	Ops       []string // Blocking operations, e.g. "recv main.main0.t0_chan0".
+	ChanPos   []string // Positions of creation of the channels in Ops.
+}
+
+func (b Blocked) String() string {
+	return b.format("blocked")
+}
+
+// format returns the description of b, where state is the state of the
+// process on its operations, e.g. "blocked".
+func (b Blocked) format(state string) string {
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("goroutine %s", b.Goroutine))
+	if b.SpawnPos != "" {
+		buf.WriteString(fmt.Sprintf(" (spawned at %s)", b.SpawnPos))
+	}
+	buf.WriteString(fmt.Sprintf(" %s in %s on %s", state, b.Def, strings.Join(b.Ops, " | ")))
+	for _, pos := range b.ChanPos {
+		if pos != "" {
+			buf.WriteString(fmt.Sprintf("\n\t\tchannel created at %s", pos))
+		}
+	}
+	return buf.String()
+}
+
+// Deadlock is a blocking configuration of the MiGo program, or an error
+// state where a process panics (if Panic is not empty).
+type Deadlock struct {
+	Global  bool      // Main process is blocked.
+	Blocked []Blocked // Blocked processes, or the panicking process.
+	Panic   string    // Panic of the process, e.g. "close of closed channel".
+	Trace   []Step    // Actions from the initial state to the deadlock.
+}
+
+func (d Deadlock) String() string {
+	var buf strings.Builder
+	if d.Panic != "" {
+		buf.WriteString(fmt.Sprintf("panic: %s:", d.Panic))
+		for _, b := range d.Blocked {
+			buf.WriteString("\n\t")
+			buf.WriteString(b.format("panics"))
+		}
+		return buf.String()
+	}
+	if d.Global {
+		buf.WriteString("global deadlock:")
+	} else {
+		buf.WriteString("partial deadlock (after main terminates):")
+	}
+	for _, b := range d.Blocked {
+		buf.WriteString("\n\t")
+		buf.WriteString(b.String())
+	}
+	return buf.String()
+}
+
+// mcChan is the state of a channel.
+type mcChan struct {
+	name   string // MiGo channel name (see migo.NewChanStatement).
+	size   int64
+	count  int64 // Number of buffered values.
+	closed bool
+}
+
+// Channel identifiers which are not indices of created channels.
+const (
+	nilChanID     = -1 // nilchan, blocks forever.
+	unknownChanID = -2 // Unbound channel, never blocks.
+)
+
+// mcFrame is an executing statement list of a process.
+type mcFrame struct {
+	def   string
+	stmts []migo.Statement
+	pc    int
+	env   map[string]int // Channel names → channel identifiers.
+}
+
+// mcProc is a process.
+type mcProc struct {
+	def    string // Spawned definition.
+	id     int    // Identifier of the process in the trace.
+	main   bool
+	frames []mcFrame
+}
+
+// mcTrace is the trace of actions leading to a state.
+type mcTrace struct {
+	step Step
+	prev *mcTrace
+}
+
+// mcState is a state of the program.
+type mcState struct {
+	procs  []*mcProc
+	chans  []mcChan
+	trace  *mcTrace
+	nextID int       // Identifier of the next spawned process.
+	panic  *Deadlock // Panic of the action leading to the state (error state).
+}
+
+func (s *mcState) clone() *mcState {
+	t := &mcState{
+		procs:  make([]*mcProc, len(s.procs)),
+		chans:  make([]mcChan, len(s.chans)),
+		trace:  s.trace,
+		nextID: s.nextID,
+	}
+	copy(t.chans, s.chans)
+	for i, p := range s.procs {
+		q := *p
+		q.frames = make([]mcFrame, len(p.frames))
+		copy(q.frames, p.frames)
+		t.procs[i] = &q
+	}
+	return t
+}
+
+// checker explores the states of a MiGo program.
+type checker struct {
+	funcs    map[string]*migo.Function
+	bounds   Bounds
+	codes    map[*migo.Statement]int // Statement lists, for state keys.
+	complete bool
+	found    map[string]bool
+	spawns   map[string]string
+	chanPos  map[string]string
+	sizes    map[string]int64 // Buffer sizes replacing the inferred sizes, by channel.
+	result   []Deadlock
+}
+
+// FindDeadlocks returns the deadlocks of prog found within bounds, where spawns
+// maps the MiGo definition of each goroutine to its spawn site and chanPos
+// maps the MiGo channel names to their creation sites. The second return value
+// is false if a bound is reached.
+func FindDeadlocks(prog *migo.Program, spawns, chanPos map[string]string, bounds Bounds) ([]Deadlock, bool) {
+	return newChecker(spawns, chanPos, bounds).run(prog)
+}
+
+// FindDeadlocksFrom returns the deadlocks of prog from the definition entry
+// (see FindDeadlocks).
+func FindDeadlocksFrom(prog *migo.Program, entry string, spawns, chanPos map[string]string, bounds Bounds) ([]Deadlock, bool) {
+	return newChecker(spawns, chanPos, bounds).run(prog, entry)
+}
+
+// newChecker returns a checker of programs (see FindDeadlocks).
+func newChecker(spawns, chanPos map[string]string, bounds Bounds) *checker {
+	return &checker{
+		funcs:    make(map[string]*migo.Function),
+		bounds:   bounds,
+		codes:    make(map[*migo.Statement]int),
+		complete: true,
+		found:    make(map[string]bool),
+		spawns:   simpleNames(spawns),
+		chanPos:  chanPos,
+	}
+}
+
+// run returns the deadlocks of prog from entries (or main.main, or the
+// definitions not used if empty), and false if a bound is reached.
+func (c *checker) run(prog *migo.Program, entries ...string) ([]Deadlock, bool) {
+	used := make(map[string]bool)
+	for _, f := range prog.Funcs {
+		c.funcs[f.SimpleName()] = f
+		markUsed(f.Stmts, used)
+	}
+	switch _, ok := c.funcs["main.main"]; {
+	case len(entries) > 0:
+	case ok:
+		entries = append(entries, "main.main")
+	default:
+		for _, f := range prog.Funcs {
+			if !used[f.SimpleName()] && len(f.Params) == 0 {
+				entries = append(entries, f.SimpleName())
+			}
+		}
+	}
+	for _, entry := range entries {
+		c.explore(entry)
+	}
+	return c.result, c.complete
+}
+
+// explore explores the states from the entry definition.
+func (c *checker) explore(entry string) {
+	init := &mcState{procs: []*mcProc{{def: entry, main: true}}, nextID: 1}
+	c.call(init.procs[0], entry, nil, nil)
+	visited := make(map[string]bool)
+	stack := []*mcState{c.normalise(init)}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if s.panic != nil {
+			c.reportPanic(s)
+			continue
+		}
+		key := c.key(s)
+		if visited[key] {
+			continue
+		}
+		if len(visited) >= c.bounds.MaxStates {
+			c.complete = false
+			return
+		}
+		visited[key] = true
+		succs := c.successors(s, visited)
+		if len(succs) == 0 && len(s.procs) > 0 {
+			c.report(s)
+		}
+		for _, succ := range succs {
+			stack = append(stack, c.normalise(succ))
+		}
+	}
+}
+
+// call pushes a frame of definition def to process p with channels of the
+// caller env passed as params.
+func (c *checker) call(p *mcProc, def string, params []*migo.Parameter, env map[string]int) {
+	def = simpleName(def)
+	f, ok := c.funcs[def]
+	if !ok || len(f.Stmts) == 0 {
+		return // Definition without communication.
+	}
+	calleeEnv := make(map[string]int)
+	for _, param := range params {
+		id, ok := env[param.Caller.Name()]
+		if !ok {
+			id = unknownChanID
+		}
+		calleeEnv[param.Callee.Name()] = id
+	}
+	if len(p.frames) >= c.bounds.MaxDepth {
+		c.complete = false
+		return
+	}
+	p.frames = append(p.frames, mcFrame{def: def, stmts: f.Stmts, env: calleeEnv})
+}
+
+// normalise removes completed frames and terminated processes of s.
+func (c *checker) normalise(s *mcState) *mcState {
+	procs := s.procs[:0]
+	for _, p := range s.procs {
+		for len(p.frames) > 0 && p.frames[len(p.frames)-1].pc >= len(p.frames[len(p.frames)-1].stmts) {
+			p.frames = p.frames[:len(p.frames)-1]
+		}
+		if len(p.frames) > 0 {
+			procs = append(procs, p)
+		}
+	}
+	s.procs = procs
+	return s
+}
+
+// key returns the canonical representation of s.
+func (c *checker) key(s *mcState) string {
+	var buf strings.Builder
+	for _, ch := range s.chans {
+		fmt.Fprintf(&buf, "%s/%d/%d/%t;", ch.name, ch.size, ch.count, ch.closed)
+	}
+	for _, p := range s.procs {
+		fmt.Fprintf(&buf, "|%s/%t", p.def, p.main)
+		for _, f := range p.frames {
+			fmt.Fprintf(&buf, "[%d:%d", c.code(f.stmts), f.pc)
+			names := make([]string, 0, len(f.env))
+			for name := range f.env {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&buf, ",%s=%d", name, f.env[name])
+			}
+			buf.WriteString("]")
+		}
+	}
+	return buf.String()
+}
+
+// code returns the identifier of the statement list stmts.
+func (c *checker) code(stmts []migo.Statement) int {
+	id, ok := c.codes[&stmts[0]]
+	if !ok {
+		id = len(c.codes)
+		c.codes[&stmts[0]] = id
+	}
+	return id*1024 + len(stmts)
+}
+
+// next returns the next statement of process p.
+func next(p *mcProc) (migo.Statement, *mcFrame) {
+	f := &p.frames[len(p.frames)-1]
+	return f.stmts[f.pc], f
+}
+
+// isLocal returns true if stmt is independent of other processes.
+func isLocal(stmt migo.Statement) bool {
+	switch stmt.(type) {
+	case *migo.SendStatement, *migo.RecvStatement, *migo.CloseStatement, *migo.SelectStatement, *timer.Timeout, *cancel.Close:
+		return false
+	}
+	return true
+}
+
+// successors returns the successor states of s, where visited are the keys of
+// the states explored.
+func (c *checker) successors(s *mcState, visited map[string]bool) []*mcState {
+	for i, p := range s.procs {
+		if stmt, _ := next(p); isLocal(stmt) {
+			if succs := c.local(s, i); !c.closesCycle(succs, visited) {
+				return succs
+			}
+			return c.expand(s)
+		}
+	}
+	return c.communications(s)
+}
+
+// closesCycle returns true if one of the states succs was visited.
+func (c *checker) closesCycle(succs []*mcState, visited map[string]bool) bool {
+	for _, succ := range succs {
+		if visited[c.key(c.normalise(succ))] {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns the successor states of s by the local actions of all the
+// processes, and by communications.
+func (c *checker) expand(s *mcState) []*mcState {
+	var succs []*mcState
+	for i, p := range s.procs {
+		if stmt, _ := next(p); isLocal(stmt) {
+			succs = append(succs, c.local(s, i)...)
+		}
+	}
+	return append(succs, c.communications(s)...)
+}
+
+// communications returns the successor states of s by the communication
+// actions of the processes.
+func (c *checker) communications(s *mcState) []*mcState {
+	var succs []*mcState
+	offers := make([][]mcOffer, len(s.procs))
+	for i, p := range s.procs {
+		offers[i] = c.offers(p)
+	}
+	for i := range s.procs {
+		for _, o := range offers[i] {
+			ch := o.ch
+			switch {
+			case o.op == opTau || ch == unknownChanID:
+				succs = append(succs, c.step(s, i, o, nil))
+			case ch == nilChanID && o.op == opClose:
+				succs = append(succs, c.fail(s, i, o, "close of nil channel"))
+			case ch == nilChanID:
+				// Blocks forever.
+			case o.op == opClose && s.chans[ch].closed:
+				if o.once { // Already cancelled.
+					succs = append(succs, c.step(s, i, o, nil))
+				} else {
+					succs = append(succs, c.fail(s, i, o, "close of closed channel"))
+				}
+			case o.op == opClose:
+				t := c.step(s, i, o, nil)
+				t.chans[ch].closed = true
+				succs = append(succs, t)
+			case o.op == opSend && s.chans[ch].closed:
+				succs = append(succs, c.fail(s, i, o, "send on closed channel"))
+			case o.op == opSend && s.chans[ch].size > 0:
+				if s.chans[ch].count < s.chans[ch].size {
+					t := c.step(s, i, o, nil)
+					t.chans[ch].count++
+					succs = append(succs, t)
+				}
+			case o.op == opRecv && s.chans[ch].count > 0:
+				t := c.step(s, i, o, nil)
+				t.chans[ch].count--
+				succs = append(succs, t)
+			case o.op == opRecv && s.chans[ch].closed:
+				succs = append(succs, c.step(s, i, o, nil))
+			case o.op == opSend: // Unbuffered: synchronise with a receiver.
+				for j := range s.procs {
+					if j == i {
+						continue
+					}
+					for _, r := range offers[j] {
+						if r.op == opRecv && r.ch == ch {
+							t := c.stepPeer(s, i, o, nil, s.procs[j].id)
+							succs = append(succs, c.stepPeer(s, j, r, t, s.procs[i].id))
+						}
+					}
+				}
+			}
+		}
+	}
+	return succs
+}
+
+// local returns the successors of the local action of process i of s.
+func (c *checker) local(s *mcState, i int) []*mcState {
+	t := s.clone()
+	p := t.procs[i]
+	stmt, f := next(p)
+	def := f.def
+	f.pc++
+	switch stmt := stmt.(type) {
+	case *migo.NewChanStatement:
+		t.record(Step{ID: p.id, Goroutine: p.def, Def: def, Action: "newchan", Chan: stmt.Chan, Peer: -1})
+		env := make(map[string]int, len(f.env)+1)
+		for k, v := range f.env {
+			env[k] = v
+		}
+		if stmt.Chan == "nilchan" {
+			env[stmt.Name.Name()] = nilChanID
+		} else if len(t.chans) >= c.bounds.MaxChans {
+			c.complete = false
+			env[stmt.Name.Name()] = unknownChanID
+		} else {
+			size := stmt.Size
+			if sz, ok := c.sizes[stmt.Chan]; ok {
+				size = sz
+			}
+			env[stmt.Name.Name()] = len(t.chans)
+			t.chans = append(t.chans, mcChan{name: stmt.Chan, size: size})
+		}
+		f.env = env
+	case *timer.Start:
+		if id, ok := f.env[stmt.Chan]; ok && id >= 0 {
+			t.chans[id].count = 1
+		}
+	case *migo.CallStatement:
+		env := f.env
+		if f.pc >= len(f.stmts) { // Tail call.
+			p.frames = p.frames[:len(p.frames)-1]
+		}
+		c.call(p, stmt.Name, stmt.Params, env)
+	case *migo.SpawnStatement:
+		if len(t.procs) >= c.bounds.MaxProcs {
+			c.complete = false
+			break
+		}
+		q := &mcProc{def: simpleName(stmt.Name), id: t.nextID}
+		t.nextID++
+		t.record(Step{ID: p.id, Goroutine: p.def, Def: def, Action: "spawn", Chan: q.def, Peer: q.id})
+		c.call(q, stmt.Name, stmt.Params, f.env)
+		t.procs = append(t.procs, q)
+	case *migo.IfStatement:
+		u := t.clone()
+		t.record(Step{ID: p.id, Goroutine: p.def, Def: def, Action: "then", Peer: -1})
+		u.record(Step{ID: p.id, Goroutine: p.def, Def: def, Action: "else", Peer: -1})
+		c.branch(t.procs[i], stmt.Then)
+		c.branch(u.procs[i], stmt.Else)
+		return []*mcState{t, u}
+	case *migo.IfForStatement:
+		u := t.clone()
+		t.record(Step{ID: p.id, Goroutine: p.def, Def: def, Action: "then", Peer: -1})
+		u.record(Step{ID: p.id, Goroutine: p.def, Def: def, Action: "else", Peer: -1})
+		c.branch(t.procs[i], stmt.Then)
+		c.branch(u.procs[i], stmt.Else)
+		return []*mcState{t, u}
+	}
+	return []*mcState{t}
+}
+
+// branch pushes the statements stmts (e.g. a branch or the rest of a select
+// case) to process p, in the environment of the current frame.
+func (c *checker) branch(p *mcProc, stmts []migo.Statement) {
+	if len(stmts) == 0 {
+		return
+	}
+	f := p.frames[len(p.frames)-1]
+	if f.pc >= len(f.stmts) { // Last statement, replace the frame.
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+	p.frames = append(p.frames, mcFrame{def: f.def, stmts: stmts, env: f.env})
+}
+
+// mcOffer is a communication action offered by a process.
+type mcOffer struct {
+	op   opKind
+	ch   int
+	name string           // Local name of the channel.
+	rest []migo.Statement // Rest of select case.
+	sel  bool             // Action is a select case guard.
+	once bool             // Close is a no-op if the channel is closed.
+}
+
+// opTau is a select case guarded by τ (i.e. default).
+const opTau opKind = -1
+
+// offers returns the communication actions offered by process p.
+func (c *checker) offers(p *mcProc) []mcOffer {
+	stmt, f := next(p)
+	chanID := func(name string) int {
+		if id, ok := f.env[name]; ok {
+			return id
+		}
+		return unknownChanID
+	}
+	switch stmt := stmt.(type) {
+	case *migo.SendStatement:
+		return []mcOffer{{op: opSend, ch: chanID(stmt.Chan), name: stmt.Chan}}
+	case *migo.RecvStatement:
+		return []mcOffer{{op: opRecv, ch: chanID(stmt.Chan), name: stmt.Chan}}
+	case *migo.CloseStatement:
+		return []mcOffer{{op: opClose, ch: chanID(stmt.Chan), name: stmt.Chan}}
+	case *timer.Timeout:
+		return []mcOffer{{op: opRecv, ch: chanID(stmt.Chan), name: stmt.Chan}}
+	case *cancel.Close:
+		return []mcOffer{{op: opClose, ch: chanID(stmt.Chan), name: stmt.Chan, once: true}}
+	case *migo.SelectStatement:
+		var offers []mcOffer
+		for _, cas := range stmt.Cases {
+			o := mcOffer{op: opTau, sel: true}
+			if len(cas) > 0 {
+				switch guard := cas[0].(type) {
+				case *migo.SendStatement:
+					o = mcOffer{op: opSend, ch: chanID(guard.Chan), name: guard.Chan, sel: true}
+				case *migo.RecvStatement:
+					o = mcOffer{op: opRecv, ch: chanID(guard.Chan), name: guard.Chan, sel: true}
+				case *timer.Timeout:
+					o = mcOffer{op: opRecv, ch: chanID(guard.Chan), name: guard.Chan, sel: true}
+				}
+				o.rest = cas[1:]
+			}
+			offers = append(offers, o)
+		}
+		return offers
+	}
+	return nil
+}
+
+// step returns the state after process i performs the action o in s (or in t
+// if t is not nil).
+func (c *checker) step(s *mcState, i int, o mcOffer, t *mcState) *mcState {
+	return c.stepPeer(s, i, o, t, -1)
+}
+
+// stepPeer is step where the action synchronises with process peer (or -1).
+func (c *checker) stepPeer(s *mcState, i int, o mcOffer, t *mcState, peer int) *mcState {
+	if t == nil {
+		t = s.clone()
+	}
+	p := t.procs[i]
+	f := &p.frames[len(p.frames)-1]
+	st := Step{ID: p.id, Goroutine: p.def, Def: f.def, Action: o.op.String(), Chan: o.name, Peer: peer}
+	if o.op == opTau {
+		st.Action, st.Chan = "default", ""
+	} else if o.ch >= 0 {
+		st.Chan = s.chans[o.ch].name
+	}
+	st.occ = occurrence(f.stmts[:f.pc], o)
+	t.record(st)
+	f.pc++
+	if o.sel {
+		c.branch(p, o.rest)
+	}
+	return t
+}
+
+// record appends step to the trace of s.
+func (s *mcState) record(step Step) {
+	s.trace = &mcTrace{step: step, prev: s.trace}
+}
+
+// steps returns the trace of s.
+func (s *mcState) steps() []Step {
+	var steps []Step
+	for t := s.trace; t != nil; t = t.prev {
+		steps = append(steps, t.step)
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return steps
+}
+
+// occurrence returns the number of statements in stmts performing the action
+// o on the same channel, to tell apart operations of a definition on the same
+// channel.
+func occurrence(stmts []migo.Statement, o mcOffer) int {
+	n := 0
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.SendStatement:
+			if o.op == opSend && stmt.Chan == o.name {
+				n++
+			}
+		case *migo.RecvStatement:
+			if o.op == opRecv && stmt.Chan == o.name {
+				n++
+			}
+		case *migo.CloseStatement:
+			if o.op == opClose && stmt.Chan == o.name {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// fail returns the error state after process i of s panics performing the
+// action o, where what is the panic.
+func (c *checker) fail(s *mcState, i int, o mcOffer, what string) *mcState {
+	p := s.procs[i]
+	b := Blocked{Goroutine: p.def, ID: p.id, SpawnPos: c.spawns[p.def], Def: p.frames[len(p.frames)-1].def}
+	ch := o.name
+	if o.ch >= 0 {
+		ch = s.chans[o.ch].name
+		b.ChanPos = append(b.ChanPos, c.chanPos[ch])
+	}
+	b.Ops = []string{fmt.Sprintf("%s %s", o.op, ch)}
+	t := c.step(s, i, o, nil)
+	t.panic = &Deadlock{Global: p.main, Blocked: []Blocked{b}, Panic: what}
+	return t
+}
+
+// reportPanic records the panic of error state s.
+func (c *checker) reportPanic(s *mcState) {
+	d := *s.panic
+	key := fmt.Sprintf("%s:%s", d.Panic, d.Blocked[0])
+	if !c.found[key] {
+		c.found[key] = true
+		d.Trace = s.steps()
+		c.result = append(c.result, d)
+	}
+}
+
+// report records the deadlock in terminal state s.
+func (c *checker) report(s *mcState) {
+	var d Deadlock
+	var keys []string
+	for _, p := range s.procs {
+		stmt, f := next(p)
+		b := Blocked{Goroutine: p.def, ID: p.id, SpawnPos: c.spawns[p.def], Def: f.def}
+		if p.main {
+			d.Global = true
+		}
+		offers := c.offers(p)
+		if len(offers) == 0 {
+			b.Ops = []string{fmt.Sprint(stmt)}
+		}
+		for _, o := range offers {
+			if o.op == opTau {
+				continue
+			}
+			ch := o.name
+			if o.ch >= 0 {
+				ch = s.chans[o.ch].name
+				b.ChanPos = append(b.ChanPos, c.chanPos[ch])
+			}
+			b.Ops = append(b.Ops, fmt.Sprintf("%s %s", o.op, ch))
+		}
+		d.Blocked = append(d.Blocked, b)
+		keys = append(keys, b.String())
+	}
+	key := fmt.Sprintf("%t:%s", d.Global, strings.Join(keys, ";"))
+	if !c.found[key] {
+		c.found[key] = true
+		d.Trace = s.steps()
+		c.result = append(c.result, d)
+	}
+}
@@ -0,0 +1,60 @@
+package migoinfer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/internal/cancel"
+	"github.com/nickng/migo"
+	"github.com/nickng/migo/parser"
+)
+
+// Tests that panics on channels are error states reported with the panicking
+// process, and that repeated cancellations do not panic.
+func TestFindDeadlocksPanic(t *testing.T) {
+	tests := []struct {
+		name   string
+		prog   string
+		expect string
+	}{
+		{"Double close", `def main.main(): let c = newchan c, 0; spawn main.closer(c); close c;
+def main.closer(c): close c;`, "close of closed channel"},
+		{"Send on closed", `def main.main(): let c = newchan c, 1; close c; send c;`, "send on closed channel"},
+		{"Close of nil", `def main.main(): let c = newchan nilchan, 0; close c;`, "close of nil channel"},
+		// Without the cycle condition, the local actions of spin forever
+		// hide the close of main.
+		{"Local cycle", `def main.main(): let c = newchan c, 0; spawn main.spin(c); close c; close c;
+def main.spin(c): tau; call main.spin(c);`, "close of closed channel"},
+	}
+	for _, tc := range tests {
+		prog, err := parser.Parse(strings.NewReader(tc.prog))
+		if err != nil {
+			t.Fatalf("%s: cannot parse MiGo: %v", tc.name, err)
+		}
+		deadlocks, complete := FindDeadlocks(prog, nil, nil, DefaultBounds())
+		if len(deadlocks) == 0 || !complete {
+			t.Errorf("%s: expecting panic %q but got %v (complete: %t)", tc.name, tc.expect, deadlocks, complete)
+			continue
+		}
+		if d := deadlocks[0]; d.Panic != tc.expect || len(d.Trace) == 0 {
+			t.Errorf("%s: panic mismatch:\nExpect:\t%s\nGot:\t%s (trace: %v)\n", tc.name, tc.expect, d.Panic, d.Trace)
+		}
+	}
+}
+
+// Tests that a context cancelled twice is closed once.
+func TestFindDeadlocksCancel(t *testing.T) {
+	prog, err := parser.Parse(strings.NewReader(`def main.main(): let c = newchan c, 0; close c; recv c; close c;`))
+	if err != nil {
+		t.Fatalf("cannot parse MiGo: %v", err)
+	}
+	stmts := prog.Funcs[0].Stmts
+	for i, stmt := range stmts {
+		if stmt, ok := stmt.(*migo.CloseStatement); ok {
+			stmts[i] = &cancel.Close{Chan: stmt.Chan}
+		}
+	}
+	if deadlocks, complete := FindDeadlocks(prog, nil, nil, DefaultBounds()); len(deadlocks) != 0 || !complete {
+		t.Errorf("Expecting no deadlock but got %v (complete: %t)", deadlocks, complete)
+	}
+}
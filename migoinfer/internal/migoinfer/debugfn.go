@@ -0,0 +1,64 @@
+package migoinfer
+
+// Debugging of functions.
+//
+// When Environment.DebugFunc is set, the Block visitor records the state of
+// the analysis at the entry and exit (before the control flow instruction) of
+// each block of the function, i.e. the values of the SSA values of the
+// function in the store of the context, and the local variables exported to
+// the MiGo definition of the block. The states are recorded for each instance
+// of the function analysed, in order of visit.
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// BlockState is the state of the analysis at the entry or exit of a block.
+type BlockState struct {
+	Instance string   // Instance of the function.
+	Block    int      // Index of the block.
+	Exit     bool     // Exit (or entry) of the block.
+	Def      string   // MiGo definition of the block.
+	Store    []string // Values in the store, e.g. "t0 = main.main.t0_chan0".
+	Exported []string // Local variables exported to the MiGo definition.
+}
+
+// recordState records the state of the analysis of block blk, if its
+// function is debugged.
+func (b *Block) recordState(blk *ssa.BasicBlock, exit bool) {
+	if b.Env.DebugFunc == nil || b.Env.DebugFunc != b.Callee.Function() {
+		return
+	}
+	s := BlockState{
+		Instance: b.Callee.UniqName(),
+		Block:    blk.Index,
+		Exit:     exit,
+		Def:      b.meta[blk.Index].migoFunc.SimpleName(),
+	}
+	fn := b.Callee.Function()
+	var values []ssa.Value
+	for _, p := range fn.Params {
+		values = append(values, p)
+	}
+	for _, fv := range fn.FreeVars {
+		values = append(values, fv)
+	}
+	for _, blk := range fn.Blocks {
+		for _, instr := range blk.Instrs {
+			if v, ok := instr.(ssa.Value); ok {
+				values = append(values, v)
+			}
+		}
+	}
+	for _, v := range values {
+		if val := b.Context.Get(v); val != nil {
+			s.Store = append(s.Store, fmt.Sprintf("%s = %s", v.Name(), val.UniqName()))
+		}
+	}
+	for _, name := range b.Exported.names {
+		s.Exported = append(s.Exported, name.Name())
+	}
+	b.Env.BlockStates = append(b.Env.BlockStates, s)
+}
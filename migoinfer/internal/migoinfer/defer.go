@@ -0,0 +1,135 @@
+package migoinfer
+
+// Handling of deferred calls.
+//
+// A deferred call is not executed at the defer statement, but at every exit
+// of the function (i.e. ssa.RunDefers before each ssa.Return). The deferred
+// calls of a function exit are those in blocks dominating the exit block,
+// executed in reverse order of the defer statements. Deferred calls in blocks
+// which reach but do not dominate the exit block are conditional, and are
+// emitted as an internal choice of running the call or not.
+//
+// Deferred closures (e.g. defer func() { ch <- x }()) are analysed at function
+// exit with their captures bound, where captured variables hold the values at
+// function exit.
+
+import (
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// deferredStmts holds the MiGo statements emitted for each deferred call, so
+// the statements are reused on every exit of the function instead of analysing
+// the deferred call again.
+type deferredStmts map[*ssa.Defer][]migo.Statement
+
+// deferredCalls returns the deferred calls which may be executed on exit of
+// blk in the order of the defer statements, and whether each of them is
+// conditional (i.e. not executed on every path to blk).
+func deferredCalls(blk *ssa.BasicBlock) ([]*ssa.Defer, map[*ssa.Defer]bool) {
+	var defers []*ssa.Defer
+	conditional := make(map[*ssa.Defer]bool)
+	for _, b := range blk.Parent().DomPreorder() {
+		dominates := b.Dominates(blk)
+		if !dominates && !reaches(b, blk) {
+			continue
+		}
+		for _, instr := range b.Instrs {
+			if d, ok := instr.(*ssa.Defer); ok {
+				defers = append(defers, d)
+				conditional[d] = !dominates
+			}
+		}
+	}
+	return defers, conditional
+}
+
+// reaches returns true if there is a path from block b to block blk.
+func reaches(b, blk *ssa.BasicBlock) bool {
+	seen := map[*ssa.BasicBlock]bool{b: true}
+	queue := []*ssa.BasicBlock{b}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		for _, succ := range curr.Succs {
+			if succ == blk {
+				return true
+			}
+			if !seen[succ] {
+				seen[succ] = true
+				queue = append(queue, succ)
+			}
+		}
+	}
+	return false
+}
+
+// runDefers emits the deferred calls for the exit block blk.
+func (v *Instruction) runDefers(blk *ssa.BasicBlock) {
+	defers, conditional := deferredCalls(blk)
+	for i := len(defers) - 1; i >= 0; i-- {
+		d := defers[i]
+		stmts, ok := v.deferred[d]
+		if ok {
+			v.Debugf("%s Run deferred %s (again)", v.Module(), d.Common())
+		} else {
+			v.Debugf("%s Run deferred %s\n\t%s", v.Module(), d.Common(), v.Env.getPos(d))
+			body := *v
+			body.MiGo = migo.NewFunction(v.MiGo.SimpleName())
+			body.doDefer(d)
+			stmts = body.MiGo.Stmts
+			if v.deferred != nil {
+				v.deferred[d] = stmts
+			}
+		}
+		if conditional[d] && len(stmts) > 0 {
+			v.Debugf("%s Deferred %s is conditional", v.Module(), d.Common())
+			v.MiGo.AddStmts(&migo.IfStatement{Then: stmts, Else: []migo.Statement{}})
+		} else {
+			v.MiGo.AddStmts(stmts...)
+		}
+	}
+}
+
+// doDefer performs a deferred call.
+func (v *Instruction) doDefer(d *ssa.Defer) {
+	if v.visitContextCall(d.Common(), nil) || v.visitTimeCall(d.Common(), nil) ||
+		v.visitErrgroupCall(d.Common(), nil) || v.visitModel(d.Common(), nil) {
+		return
+	}
+	if mc, ok := d.Call.Value.(*ssa.MakeClosure); ok {
+		v.deferClosure(d, mc)
+		return
+	}
+	common := v.unbind(d.Common())
+	if defs := v.invokeCandidates(common); defs != nil {
+		v.doInvokeCall(common, nil, defs)
+		return
+	}
+	def := v.createDefinition(common)
+	if def == nil {
+		return
+	}
+	v.doCall(common, nil, def)
+}
+
+// deferClosure performs a deferred call of closure mc, with the captures bound
+// to their values at function exit.
+func (v *Instruction) deferClosure(d *ssa.Defer, mc *ssa.MakeClosure) {
+	common := v.unbind(d.Common())
+	if common != d.Common() { // Bound method.
+		if def := v.createDefinition(common); def != nil {
+			v.doCall(common, nil, def)
+		}
+		return
+	}
+	def := funcs.MakeClosureDefinition(mc.Fn.(*ssa.Function), mc.Bindings)
+	v.Put(mc, def)
+	v.Debugf("%s ↳ deferred closure %s", v.Module(), def.String())
+	if v.isRecursive(def.Function) {
+		v.doRecursiveCall(common, nil, def)
+		return
+	}
+	v.doCall(common, nil, def)
+}
@@ -0,0 +1,47 @@
+package migoinfer
+
+// Directives.
+//
+// Directive comments (see ssa.Directives) in the analysed sources guide the
+// inference where the analysis cannot determine the behaviour of the program
+// precisely: functions with an assume-noeffect directive are modelled as not
+// communicating (see NoComm), and a channel-cap directive on a make(chan)
+// overrides the buffer size of the channel created.
+
+import (
+	"strconv"
+
+	gssa "github.com/nickng/gospal/ssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// directiveModels adds the models of functions with an assume-noeffect
+// directive to models.
+func directiveModels(info *gssa.Info, models map[string]Model) {
+	if info == nil || info.Directives == nil {
+		return
+	}
+	for obj := range info.Directives.Funcs {
+		if _, ok := info.Directives.Func(obj, gssa.AssumeNoEffect); !ok {
+			continue
+		}
+		if fn := info.Prog.FuncValue(obj); fn != nil {
+			models[fn.String()] = NoComm
+		}
+	}
+}
+
+// directiveChanSize returns the buffer size of channel ch given by a
+// channel-cap directive, if any.
+func (v *Instruction) directiveChanSize(ch ssa.Value) (int64, bool) {
+	dir, ok := v.Env.Info.Directives.At(ch.Pos(), gssa.ChannelCap)
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(dir.Arg, 10, 64)
+	if err != nil || size < 0 {
+		v.Env.Errors <- ErrChanCapInvalid{Pos: v.Env.Info.FSet.Position(dir.Pos), Arg: dir.Arg}
+		return 0, false
+	}
+	return size, true
+}
@@ -2,11 +2,21 @@ package migoinfer
 
 import (
 	"go/token"
+	"go/types"
 	"log"
 	"os"
 
+	"github.com/nickng/gospal/absint"
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/callgraph"
+	"github.com/nickng/gospal/fn"
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/internal/intern"
 	gssa "github.com/nickng/gospal/ssa"
 	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/sym"
+	"github.com/nickng/gospal/tracing"
 	"github.com/nickng/migo"
 	"golang.org/x/tools/go/ssa"
 )
@@ -17,19 +27,101 @@ type Environment struct {
 	Prog        *migo.Program
 	Info        *gssa.Info
 	Globals     *store.Store
+	GlobalChans []*ssa.Global // Package variables initialised to channels.
 	Errors      chan error
 	SkipPkg     map[*ssa.Package]bool
 	VisitedFunc map[*ssa.CallCommon]bool
+	Models      map[string]Model                    // Behavioural models of library functions.
+	ChanDirs    map[string]map[string]types.ChanDir // Channel parameter directions.
+	BranchConds map[string]string                   // Branch conditions, by MiGo definition.
+	Spawns      map[string]string                   // Spawn sites, by MiGo definition.
+	SpawnEdges  []SpawnEdge                         // Spawns of goroutines, by function.
+	Chans       map[string]string                   // Creation sites, by MiGo channel name.
+	Timers      map[string]Timer                    // Timer channels, by MiGo channel name.
+	CallGraph   *callgraph.Graph                    // Resolves dynamic calls if not nil.
+	Solver      sym.Solver                          // Prunes infeasible branches if not nil.
+	ChanOps     map[*chans.Chan][]*ChanOp           // Operations on channels.
+	Instances   *funcs.Instances                    // Numbers function instances.
+	Toplevel    callctx.Context                     // Context of entry points.
+	Budget      *Budget                             // Degrades analysis if not nil.
+	Degraded    []Approximation                     // Calls analysed with degraded precision.
+	Hooks       []Hook                              // Handlers of instructions (see Hook).
+	LockOrder   map[[2]string]*LockEdge             // Lock-order graph, by held and acquired lock.
+	Silent      []SilentGoroutine                   // Spawns of goroutines which do not communicate.
+	Filter      *Filter                             // Selects the functions analysed if not nil.
+	DebugFunc   *ssa.Function                       // Records the states of its blocks if not nil.
+	BlockStates []BlockState                        // States of the blocks of DebugFunc.
+	Span        *tracing.Span                       // Span of the inference if tracing.
+	Impls       *fn.Cache                           // Resolved implementations of invoke calls.
+	Stream      *Stream                             // Writes definitions instead of Prog if not nil.
+	Truncated   []TruncatedUnroll                   // Loops unrolled up to UnrollLimit.
+
+	SummariseSilent bool // Do not analyse goroutines which do not communicate.
+	ReuseSummaries  bool // Reuse definitions of functions across equivalent contexts.
+	UnrollLimit     int  // Maximum iterations unrolled of loops creating a channel per iteration.
+	ContextDepth    int  // Maximum calls in a context analysed separately (0 means unbounded).
+
+	Shared        *SharedSummaries               // Summaries of other analyses if not nil.
+	SharedVisible func(owner *ssa.Function) bool // Owners of Shared summaries reusable.
+
+	groups    map[*chans.Chan]*group // errgroup.Group states.
+	handlers  []*httpHandler         // Registered HTTP handlers.
+	flags     map[types.Object]bool  // Atomic flags which are set.
+	signals   map[*chans.Chan]bool   // Channels registered by signal.Notify.
+	deadlines map[*chans.Chan]bool   // Done channels of contexts with a deadline.
+	nilChans  int                    // Number of fresh nil channels.
+	held      []LockAcq              // Locks held.
+	silent    map[*ssa.Function]bool // Functions which do not communicate.
+	noReturns map[*ssa.Function]bool // Functions which do not return (see noReturn).
+
+	spans           []*tracing.Span                  // Spans of the functions being analysed.
+	analysed        map[*ssa.Function]string         // MiGo definitions of analysed functions.
+	summaries       map[string]string                // MiGo definitions, by summary key (see summaryKey).
+	summarisableFns map[*ssa.Function]bool           // Functions which may be summarised.
+	sharedUsed      []*SharedSummary                 // Shared summaries reused.
+	sharedNames     map[string]bool                  // MiGo definitions of sharedUsed.
+	ranges          map[*ssa.Function]*absint.Result // Ranges of integers (see intervals).
+	flow            *chanFlow                        // Flow of channels (see chanFlow).
+	hoisted         map[*ssa.MakeChan][]*chans.Chan  // Payload channels created with their carriers.
+	globalConsts    map[*ssa.Global]*ssa.Const       // Constants of package variables (see globalConst).
+	parents         map[*chans.Chan]*migo.Function   // Propagation of cancellation, by Done channel of child context.
+	returns         map[string]*chans.Chan           // Channels returned by methods without body (see summariseReturns).
 }
 
 // NewEnvironment initialises a new environment.
 func NewEnvironment(info *gssa.Info) Environment {
+	models := DefaultModels()
+	directiveModels(info, models)
 	return Environment{
 		Prog:        migo.NewProgram(),
 		Info:        info,
 		Globals:     store.New(),
 		Errors:      make(chan error),
 		VisitedFunc: make(map[*ssa.CallCommon]bool),
+		Models:      models,
+		ChanDirs:    make(map[string]map[string]types.ChanDir),
+		BranchConds: make(map[string]string),
+		Spawns:      make(map[string]string),
+		Chans:       make(map[string]string),
+		Timers:      make(map[string]Timer),
+		ChanOps:     make(map[*chans.Chan][]*ChanOp),
+		Instances:   funcs.NewInstances(),
+		Impls:       fn.NewCache(),
+		Toplevel:    callctx.NewToplevel(),
+		LockOrder:   make(map[[2]string]*LockEdge),
+		groups:      make(map[*chans.Chan]*group),
+		signals:     make(map[*chans.Chan]bool),
+		deadlines:   make(map[*chans.Chan]bool),
+		parents:     make(map[*chans.Chan]*migo.Function),
+		returns:     make(map[string]*chans.Chan),
+		analysed:    make(map[*ssa.Function]string),
+		hoisted:     make(map[*ssa.MakeChan][]*chans.Chan),
+
+		UnrollLimit: DefaultUnrollLimit,
+
+		summaries:       make(map[string]string),
+		summarisableFns: make(map[*ssa.Function]bool),
+		sharedNames:     make(map[string]bool),
 	}
 }
 
@@ -48,8 +140,31 @@ func (env Environment) HandleErrors() {
 	}
 }
 
+// DefFuncs returns the functions of the MiGo definitions of the functions
+// analysed at call sites, by definition.
+func (env *Environment) DefFuncs() map[string]*ssa.Function {
+	fns := make(map[string]*ssa.Function, len(env.analysed))
+	for fn, def := range env.analysed {
+		fns[def] = fn
+	}
+	return fns
+}
+
+// intervals returns the ranges of the integers of fn (see absint.Intervals).
+func (env *Environment) intervals(fn *ssa.Function) *absint.Result {
+	if env.ranges == nil {
+		env.ranges = make(map[*ssa.Function]*absint.Result)
+	}
+	res, ok := env.ranges[fn]
+	if !ok {
+		res = absint.Analyse(fn, absint.Intervals{})
+		env.ranges[fn] = res
+	}
+	return res
+}
+
 // getPos returns a string representation of the given item.
 // Note this is a pointer receiver on Environment for use by the Visitors.
 func (env *Environment) getPos(p Poser) string {
-	return env.Info.FSet.Position(p.Pos()).String()
+	return intern.String(env.Info.FSet.Position(p.Pos()).String())
 }
@@ -0,0 +1,204 @@
+package migoinfer
+
+// Modelling of golang.org/x/sync/errgroup.
+//
+// An errgroup.Group is represented by a join channel, created where the Group
+// is allocated (or by errgroup.WithContext). g.Go(f) spawns a wrapper which
+// calls f then sends on the join channel, and g.Wait() receives from the join
+// channel once for every g.Go call site of the group.
+//
+// The context returned by errgroup.WithContext is represented by its own Done
+// channel (see context.go), closed by g.Wait(). Cancellation on the first
+// error is not modelled.
+//
+// A g.Go call site inside a loop spawns any number of goroutines, so g.Wait()
+// joins them with a receive loop mirroring the spawning loop, i.e. a
+// replicated process receiving from the join channel any number of times (see
+// also pool.go):
+//
+//	def join.wait(g): if recv g; call join.wait(g); else endif;
+
+import (
+	"go/types"
+
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/internal/intern"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+const errgroupPkg = "golang.org/x/sync/errgroup"
+
+// group is the state of an errgroup.Group.
+type group struct {
+	nGo   int            // Number of g.Go call sites outside loops.
+	nLoop int            // Number of g.Go call sites in loops.
+	ctx   *chans.Chan    // Done channel of context from WithContext (or nil).
+	wait  *migo.Function // Receive loop joining the loops (or nil).
+}
+
+// isErrgroup returns true if t is errgroup.Group or *errgroup.Group.
+func isErrgroup(t types.Type) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == errgroupPkg {
+			return obj.Name() == "Group"
+		}
+	}
+	return false
+}
+
+// newGroup creates the join channel of an errgroup.Group k.
+func (v *Instruction) newGroup(k ssa.Value) *chans.Chan {
+	join := chans.New(v.Callee, k, 0)
+	if updater, ok := v.Context.(callctx.Updater); ok {
+		updater.PutUniq(k, join)
+	} else {
+		v.Fatal("Cannot update context")
+	}
+	v.Env.groups[join] = new(group)
+	v.Export(k)
+	v.MiGo.AddStmts(migoNewChan(v.Logger, k, join))
+	return join
+}
+
+// visitErrgroupAlloc handles allocation of an errgroup.Group, and returns true
+// if the allocation is handled.
+func (v *Instruction) visitErrgroupAlloc(instr *ssa.Alloc) bool {
+	if !isErrgroup(instr.Type()) {
+		return false
+	}
+	v.Debugf("%s Allocate errgroup %s", v.Module(), instr.Name())
+	v.newGroup(instr)
+	return true
+}
+
+// visitErrgroupCall handles calls to the errgroup package, and returns true if
+// the call is fully handled (i.e. the callee should not be analysed).
+// The return value ret is nil if the call is not an *ssa.Call (e.g. deferred).
+func (v *Instruction) visitErrgroupCall(c *ssa.CallCommon, ret ssa.Value) bool {
+	fn := c.StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != errgroupPkg {
+		return false
+	}
+	if fn.Signature.Recv() == nil {
+		if fn.Name() == "WithContext" && ret != nil {
+			v.errgroupWithContext(ret)
+		}
+		return true
+	}
+	join, ok := v.Get(c.Args[0]).(*chans.Chan)
+	if !ok {
+		v.Warnf("%s errgroup %s is undefined", v.Module(), c.Args[0].Name())
+		return true
+	}
+	g, ok := v.Env.groups[join]
+	if !ok {
+		return true
+	}
+	switch fn.Name() {
+	case "Go", "TryGo":
+		v.errgroupGo(join, g, c)
+	case "Wait":
+		v.errgroupWait(join, g)
+	}
+	return true // Other methods (e.g. SetLimit) do not communicate.
+}
+
+// errgroupWithContext creates the group and the context returned by
+// errgroup.WithContext.
+func (v *Instruction) errgroupWithContext(ret ssa.Value) {
+	var grp, ctx *ssa.Extract
+	for _, ref := range *ret.Referrers() {
+		if ext, ok := ref.(*ssa.Extract); ok {
+			switch ext.Index {
+			case 0:
+				grp = ext
+			case 1:
+				ctx = ext
+			}
+		}
+	}
+	if grp == nil {
+		return
+	}
+	join := v.newGroup(grp)
+	if ctx != nil {
+		done := chans.New(v.Callee, ctx, 0)
+		if updater, ok := v.Context.(callctx.Updater); ok {
+			updater.PutUniq(ctx, done)
+		}
+		v.Env.groups[join].ctx = done
+		v.Export(ctx)
+		v.MiGo.AddStmts(migoNewChan(v.Logger, ctx, done))
+	}
+}
+
+// errgroupGo spawns the function of g.Go call c in a wrapper which sends on
+// join when the function returns.
+func (v *Instruction) errgroupGo(join *chans.Chan, g *group, c *ssa.CallCommon) {
+	common := v.unbind(&ssa.CallCommon{Value: c.Args[1]})
+	def := v.createDefinition(common)
+	if def == nil {
+		return
+	}
+	if call := callInstr(c); call != nil && reaches(call.Block(), call.Block()) {
+		g.nLoop++
+	} else {
+		g.nGo++
+	}
+	wrapper := migo.NewFunction(intern.Sprintf("%s.go%d", join.UniqName(), g.nGo+g.nLoop))
+	body := *v
+	body.MiGo = wrapper
+	body.doCall(common, nil, def)
+	wrapper.AddStmts(&migo.SendStatement{Chan: v.FindExported(v.Context, join).Name()})
+
+	stmt := &migo.SpawnStatement{Name: wrapper.Name}
+	for _, name := range v.Exported.names {
+		wrapper.AddParams(&migo.Parameter{Caller: name, Callee: name})
+		stmt.AddParams(&migo.Parameter{Caller: name, Callee: name})
+	}
+	v.Env.addFunction(wrapper)
+	v.Debugf("%s errgroup Go %s", v.Module(), wrapper.SimpleName())
+	v.MiGo.AddStmts(stmt)
+}
+
+// errgroupWait joins all goroutines of the group, then cancels its context.
+func (v *Instruction) errgroupWait(join *chans.Chan, g *group) {
+	name := v.FindExported(v.Context, join).Name()
+	for i := 0; i < g.nGo; i++ {
+		v.MiGo.AddStmts(&migo.RecvStatement{Chan: name})
+	}
+	if g.nLoop > 0 {
+		v.MiGo.AddStmts(v.errgroupWaitLoop(join, g))
+	}
+	if g.ctx != nil {
+		if _, ok := v.FindExported(v.Context, g.ctx).(Unexported); !ok {
+			v.MiGo.AddStmts(&migo.CloseStatement{Chan: v.FindExported(v.Context, g.ctx).Name()})
+		}
+	}
+}
+
+// errgroupWaitLoop returns a call to the receive loop of group g joining the
+// goroutines spawned by g.Go call sites in loops.
+func (v *Instruction) errgroupWaitLoop(join *chans.Chan, g *group) migo.Statement {
+	name := v.FindExported(v.Context, join)
+	if g.wait == nil {
+		g.wait = migo.NewFunction(intern.Sprintf("%s.wait", join.UniqName()))
+		g.wait.AddParams(&migo.Parameter{Caller: name, Callee: name})
+		again := &migo.CallStatement{Name: g.wait.Name}
+		again.AddParams(&migo.Parameter{Caller: name, Callee: name})
+		g.wait.AddStmts(&migo.IfStatement{
+			Then: []migo.Statement{&migo.RecvStatement{Chan: name.Name()}, again},
+			Else: []migo.Statement{},
+		})
+		v.Env.addFunction(g.wait)
+	}
+	v.Debugf("%s errgroup Wait loop %s", v.Module(), g.wait.SimpleName())
+	stmt := &migo.CallStatement{Name: g.wait.Name}
+	stmt.AddParams(&migo.Parameter{Caller: name, Callee: g.wait.Params[0].Callee})
+	return stmt
+}
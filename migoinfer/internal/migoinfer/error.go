@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/token"
 
+	"github.com/nickng/gospal/absint"
 	"github.com/pkg/errors"
 )
 
@@ -19,3 +20,21 @@ type ErrChanBufSzNonStatic struct {
 func (e ErrChanBufSzNonStatic) Error() string {
 	return fmt.Sprintf("%s: channel buffer size is not constant", e.Pos.String())
 }
+
+type ErrChanBufSzRange struct {
+	Pos   token.Position
+	Range absint.Interval
+}
+
+func (e ErrChanBufSzRange) Error() string {
+	return fmt.Sprintf("%s: channel buffer size is not constant but in %s, using %d", e.Pos.String(), e.Range, e.Range.Lo)
+}
+
+type ErrChanCapInvalid struct {
+	Pos token.Position
+	Arg string
+}
+
+func (e ErrChanCapInvalid) Error() string {
+	return fmt.Sprintf("%s: invalid channel-cap directive %q", e.Pos.String(), e.Arg)
+}
@@ -0,0 +1,72 @@
+package migoinfer
+
+import (
+	"go/constant"
+
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/sym"
+	"golang.org/x/tools/go/ssa"
+)
+
+// ctxConsts gives the constant values bound in a call context, e.g.
+// parameters of a call with constant arguments.
+type ctxConsts struct {
+	callctx.Context
+}
+
+func (c ctxConsts) Const(v ssa.Value) (constant.Value, bool) {
+	if k, ok := c.Get(v).(store.Const); ok {
+		return k.Value, true
+	}
+	return nil, false
+}
+
+// branchFacts returns the conditions which hold on entry to blk, i.e. the
+// conditions of the branches with an edge dominating blk.
+func branchFacts(blk *ssa.BasicBlock, env sym.Env) []sym.Expr {
+	var facts []sym.Expr
+	for dom := blk.Idom(); dom != nil; dom = dom.Idom() {
+		ifInstr, ok := dom.Instrs[len(dom.Instrs)-1].(*ssa.If)
+		if !ok {
+			continue
+		}
+		cond, ok := sym.FromValue(ifInstr.Cond, env)
+		if !ok {
+			continue
+		}
+		for i, succ := range dom.Succs {
+			if len(succ.Preds) != 1 || !succ.Dominates(blk) {
+				continue
+			}
+			if i == 0 {
+				facts = append(facts, cond)
+			} else {
+				facts = append(facts, sym.Negate(cond))
+			}
+		}
+	}
+	return facts
+}
+
+// feasibleBranch returns the index of the only feasible successor of the
+// branch instr (at the end of blk), or -1 if both may be taken or pruning of
+// infeasible branches is disabled.
+func (b *Block) feasibleBranch(blk *ssa.BasicBlock, instr *ssa.If) int {
+	if b.Env.Solver == nil {
+		return -1
+	}
+	env := ctxConsts{b.Context}
+	cond, ok := sym.FromValue(instr.Cond, env)
+	if !ok {
+		return -1
+	}
+	val, ok := sym.Decide(b.Env.Solver, branchFacts(blk, env), cond)
+	if !ok {
+		return -1
+	}
+	if val {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,50 @@
+package migoinfer
+
+// Channels in struct fields.
+//
+// A struct holding channels (e.g. a server with a quit channel) is shared by
+// its methods through the receiver, so all methods of the same object must
+// refer to the same channels. Fields of a struct are keys local to the scope
+// which defines them (see structs.Struct), so a struct created in a callee
+// (e.g. a constructor) is rebound to the caller scope on return, where each
+// defined field is a structs.SField of the caller's struct. Similarly, a
+// channel field of a receiver created inside a method (e.g. by a Start method)
+// is bound to the field of the caller's struct (see bindCallParameters).
+
+import (
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/structs"
+	"golang.org/x/tools/go/ssa"
+)
+
+// rebindStruct returns a copy of the struct s defined in callee fn, with the
+// values of its fields bound to the fields of k in the current scope.
+// Channels in the fields are created by the caller.
+func (v *Instruction) rebindStruct(k store.Key, fn *Function, s *structs.Struct) store.Value {
+	if _, ok := k.(ssa.Value); !ok {
+		return s
+	}
+	rs := structs.New(v.Callee, k)
+	if rs == nil || len(rs.Fields) != len(s.Fields) {
+		return s
+	}
+	for i, field := range s.Fields {
+		if field == nil {
+			continue
+		}
+		fieldVal := fn.Get(field)
+		if isUndefined(fieldVal) {
+			continue
+		}
+		sf := structs.SField{Struct: rs, Index: i}
+		rs.Fields[i] = sf
+		v.Put(sf, fieldVal)
+		if ch, ok := fieldVal.(*chans.Chan); ok && isChan(sf) {
+			v.Debugf("%s Field %s of returned struct ↦ %s", v.Module(), sf.Name(), ch.UniqName())
+			v.MiGo.AddStmts(migoNewChan(v.Logger, sf, ch))
+			v.Export(sf)
+		}
+	}
+	return rs
+}
@@ -0,0 +1,69 @@
+package migoinfer
+
+import (
+	"go/token"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Filter selects the functions whose bodies are analysed, by glob patterns
+// (see path.Match) on the import path of their package or the base name of
+// their file, e.g. "*/mocks", "example.com/gen/..." or "*.pb.go". A pattern
+// ending with /... also matches the packages under the path.
+//
+// Static calls of functions not selected are handled as calls of functions
+// which do not communicate (see NoComm), after the builtin models.
+type Filter struct {
+	Include []string // Only functions matching a pattern are selected, if not empty.
+	Exclude []string // Functions matching a pattern are not selected.
+}
+
+// Selects returns true if the body of fn should be analysed.
+func (f *Filter) Selects(fn *ssa.Function, fset *token.FileSet) bool {
+	if fn.Pkg == nil {
+		return true
+	}
+	pkg, file := fn.Pkg.Pkg.Path(), ""
+	if fset != nil && fn.Pos().IsValid() {
+		file = filepath.Base(fset.Position(fn.Pos()).Filename)
+	}
+	for _, pattern := range f.Exclude {
+		if matchGlob(pattern, pkg, file) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matchGlob(pattern, pkg, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob returns true if pattern matches the import path pkg or the
+// filename file.
+func matchGlob(pattern, pkg, file string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		if ok, _ := path.Match(prefix, pkg); ok {
+			return true
+		}
+		for p := pkg; strings.Contains(p, "/"); {
+			p = p[:strings.LastIndex(p, "/")]
+			if ok, _ := path.Match(prefix, p); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if ok, _ := path.Match(pattern, pkg); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, file)
+	return file != "" && ok
+}
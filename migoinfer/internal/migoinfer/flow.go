@@ -0,0 +1,363 @@
+package migoinfer
+
+// Flow of channels in the program.
+//
+// The analysis follows the program from the entry point, so a fact about a
+// channel learnt in a function (e.g. the channels sent over it) is only known
+// by the functions analysed after it. The flow of channels is computed before
+// the analysis instead, for the whole program, as the creation sites
+// (ssa.MakeChan) of the channels each value may hold, e.g.
+//
+//	reply := <-requests // reply is any channel sent over requests.
+//	reply <- resp
+//
+// The flow is insensitive to the order of instructions and to the calling
+// contexts. Memory is summarised by allocation (ssa.Alloc and ssa.Global), by
+// field (of any struct value) and by element type (of slices, arrays and
+// maps), and the values sent over a channel are summarised by its creation
+// site. The channels closed are the channels the argument of a call to close
+// may hold. Calls are followed if the callee is static, or a function (or
+// closure) value flowing to the call. Invoke calls (i.e. method calls on
+// interfaces) are not followed.
+
+import (
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/nickng/gospal/store/chans"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// A flowNode is a value or memory location which may hold flowObjs, i.e.
+// an ssa.Value or one of the *Node types below.
+type flowNode interface{}
+
+// A flowObj is an object flowing in the program: a channel (*ssa.MakeChan), a
+// function (*ssa.Function), or the memory (*ssa.Alloc, *ssa.Global,
+// fieldObj or elemObj) a pointer points to.
+type flowObj interface{}
+
+type (
+	fieldObj   struct{ Field *types.Var } // Field of any struct value.
+	elemObj    struct{ T string }         // Elements of containers of type T.
+	memNode    struct{ Obj flowObj }      // Value stored in memory Obj.
+	sentNode   struct{ Obj flowObj }      // Values sent over channel Obj.
+	resultNode struct {                   // Result Index of Fn.
+		Fn    *ssa.Function
+		Index int
+	}
+	tupleNode struct { // Component Index of tuple V.
+		V     ssa.Value
+		Index int
+	}
+)
+
+// chanFlow is the flow of channels in the program.
+type chanFlow struct {
+	objs     map[flowNode]map[flowObj]bool // Objects held by nodes.
+	edges    map[flowNode][]flowNode       // Nodes holding the objects of a node.
+	watchers map[flowNode][]func(flowObj)  // Handlers of objects added to a node.
+	closed   map[flowObj]bool              // Channels closed.
+	work     []flowEdge
+}
+
+type flowEdge struct {
+	Node flowNode
+	Obj  flowObj
+}
+
+// chanFlow returns the flow of channels in the program, computed on first use.
+func (env *Environment) chanFlow() *chanFlow {
+	if env.flow != nil {
+		return env.flow
+	}
+	env.flow = &chanFlow{
+		objs:     make(map[flowNode]map[flowObj]bool),
+		edges:    make(map[flowNode][]flowNode),
+		watchers: make(map[flowNode][]func(flowObj)),
+		closed:   make(map[flowObj]bool),
+	}
+	for fn := range ssautil.AllFunctions(env.Info.Prog) {
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				env.flow.visit(instr)
+			}
+		}
+	}
+	env.flow.solve()
+	return env.flow
+}
+
+// add adds object obj to node n.
+func (f *chanFlow) add(n flowNode, obj flowObj) {
+	objs, ok := f.objs[n]
+	if !ok {
+		objs = make(map[flowObj]bool)
+		f.objs[n] = objs
+	}
+	if !objs[obj] {
+		objs[obj] = true
+		f.work = append(f.work, flowEdge{Node: n, Obj: obj})
+	}
+}
+
+// flow adds an edge from node src to node dst, i.e. dst holds the objects of
+// src.
+func (f *chanFlow) flow(src, dst flowNode) {
+	f.edges[src] = append(f.edges[src], dst)
+	for obj := range f.objs[src] {
+		f.add(dst, obj)
+	}
+}
+
+// watch calls do with every object of node n.
+func (f *chanFlow) watch(n flowNode, do func(obj flowObj)) {
+	f.watchers[n] = append(f.watchers[n], do)
+	for obj := range f.objs[n] {
+		do(obj)
+	}
+}
+
+// solve propagates the objects along the edges until fixpoint.
+func (f *chanFlow) solve() {
+	for len(f.work) > 0 {
+		e := f.work[len(f.work)-1]
+		f.work = f.work[:len(f.work)-1]
+		for _, dst := range f.edges[e.Node] {
+			f.add(dst, e.Obj)
+		}
+		for _, do := range f.watchers[e.Node] {
+			do(e.Obj)
+		}
+	}
+}
+
+// node returns the node of value v.
+func (f *chanFlow) node(v ssa.Value) flowNode {
+	switch v := v.(type) {
+	case *ssa.Function:
+		f.add(v, v)
+	case *ssa.Global:
+		f.add(v, v)
+	}
+	return v
+}
+
+// elemOf returns the elements of container type t.
+func elemOf(t types.Type) flowObj {
+	if ptr, ok := t.Underlying().(*types.Pointer); ok { // Pointer to array.
+		t = ptr.Elem()
+	}
+	return elemObj{T: types.TypeString(t.Underlying(), nil)}
+}
+
+// load makes dst hold the values stored in the memory pointed to by addr.
+func (f *chanFlow) load(addr ssa.Value, dst flowNode) {
+	f.watch(f.node(addr), func(obj flowObj) { f.flow(memNode{obj}, dst) })
+}
+
+// store makes the memory pointed to by addr hold the objects of src.
+func (f *chanFlow) store(addr ssa.Value, src flowNode) {
+	f.watch(f.node(addr), func(obj flowObj) { f.flow(src, memNode{obj}) })
+}
+
+// recv makes dst hold the values sent over channel ch.
+func (f *chanFlow) recv(ch ssa.Value, dst flowNode) {
+	f.watch(f.node(ch), func(obj flowObj) { f.flow(sentNode{obj}, dst) })
+}
+
+// send makes channel ch carry the objects of src.
+func (f *chanFlow) send(ch ssa.Value, src flowNode) {
+	f.watch(f.node(ch), func(obj flowObj) { f.flow(src, sentNode{obj}) })
+}
+
+func (f *chanFlow) visit(instr ssa.Instruction) {
+	switch instr := instr.(type) {
+	case *ssa.MakeChan:
+		f.add(instr, instr)
+	case *ssa.Alloc:
+		f.add(instr, instr)
+	case *ssa.MakeClosure:
+		fn := instr.Fn.(*ssa.Function)
+		f.add(instr, fn)
+		for i, binding := range instr.Bindings {
+			f.flow(f.node(binding), fn.FreeVars[i])
+		}
+	case *ssa.Phi:
+		for _, edge := range instr.Edges {
+			f.flow(f.node(edge), instr)
+		}
+	case *ssa.ChangeType:
+		f.flow(f.node(instr.X), instr)
+	case *ssa.ChangeInterface:
+		f.flow(f.node(instr.X), instr)
+	case *ssa.MakeInterface:
+		f.flow(f.node(instr.X), instr)
+	case *ssa.Slice:
+		f.flow(f.node(instr.X), instr)
+	case *ssa.TypeAssert:
+		if instr.CommaOk {
+			f.flow(f.node(instr.X), tupleNode{instr, 0})
+		} else {
+			f.flow(f.node(instr.X), instr)
+		}
+	case *ssa.Extract:
+		f.flow(tupleNode{instr.Tuple, instr.Index}, instr)
+	case *ssa.FieldAddr:
+		if t, ok := instr.X.Type().Underlying().(*types.Pointer); ok {
+			if s, ok := t.Elem().Underlying().(*types.Struct); ok {
+				f.add(instr, fieldObj{s.Field(instr.Field)})
+			}
+		}
+	case *ssa.Field:
+		if s, ok := instr.X.Type().Underlying().(*types.Struct); ok {
+			f.flow(memNode{fieldObj{s.Field(instr.Field)}}, instr)
+		}
+	case *ssa.IndexAddr:
+		f.add(instr, elemOf(instr.X.Type()))
+	case *ssa.Index:
+		f.flow(memNode{elemOf(instr.X.Type())}, instr)
+	case *ssa.Lookup:
+		if instr.CommaOk {
+			f.flow(memNode{elemOf(instr.X.Type())}, tupleNode{instr, 0})
+		} else {
+			f.flow(memNode{elemOf(instr.X.Type())}, instr)
+		}
+	case *ssa.MapUpdate:
+		f.flow(f.node(instr.Key), memNode{elemOf(instr.Map.Type())})
+		f.flow(f.node(instr.Value), memNode{elemOf(instr.Map.Type())})
+	case *ssa.Next:
+		if rng, ok := instr.Iter.(*ssa.Range); ok && !instr.IsString {
+			f.flow(memNode{elemOf(rng.X.Type())}, tupleNode{instr, 1})
+			f.flow(memNode{elemOf(rng.X.Type())}, tupleNode{instr, 2})
+		}
+	case *ssa.Store:
+		f.store(instr.Addr, f.node(instr.Val))
+	case *ssa.UnOp:
+		switch {
+		case instr.Op == token.MUL:
+			f.load(instr.X, instr)
+		case instr.Op == token.ARROW && instr.CommaOk:
+			f.recv(instr.X, tupleNode{instr, 0})
+		case instr.Op == token.ARROW:
+			f.recv(instr.X, instr)
+		}
+	case *ssa.Send:
+		f.send(instr.Chan, f.node(instr.X))
+	case *ssa.Select:
+		recvIdx := selectCaseRecv
+		for _, state := range instr.States {
+			if state.Dir == types.RecvOnly {
+				f.recv(state.Chan, tupleNode{instr, recvIdx})
+				recvIdx++
+			} else {
+				f.send(state.Chan, f.node(state.Send))
+			}
+		}
+	case *ssa.Return:
+		for i, res := range instr.Results {
+			f.flow(f.node(res), resultNode{instr.Parent(), i})
+		}
+	case ssa.CallInstruction:
+		f.call(instr)
+	}
+}
+
+// call connects the arguments and results of call instruction instr to the
+// parameters and results of its callees.
+func (f *chanFlow) call(instr ssa.CallInstruction) {
+	common := instr.Common()
+	if common.IsInvoke() {
+		return
+	}
+	if b, ok := common.Value.(*ssa.Builtin); ok {
+		if b.Name() == "close" {
+			f.watch(f.node(common.Args[0]), func(obj flowObj) { f.closed[obj] = true })
+		}
+		return
+	}
+	f.watch(f.node(common.Value), func(obj flowObj) {
+		fn, ok := obj.(*ssa.Function)
+		if !ok || len(fn.Params) != len(common.Args) {
+			return
+		}
+		for i, arg := range common.Args {
+			f.flow(f.node(arg), fn.Params[i])
+		}
+		call, ok := instr.(*ssa.Call)
+		if !ok {
+			return
+		}
+		switch fn.Signature.Results().Len() {
+		case 0:
+		case 1:
+			f.flow(resultNode{fn, 0}, call)
+		default:
+			for i := 0; i < fn.Signature.Results().Len(); i++ {
+				f.flow(resultNode{fn, i}, tupleNode{call, i})
+			}
+		}
+	})
+}
+
+// chans returns the channels node n may hold.
+func (f *chanFlow) chans(n flowNode) []*ssa.MakeChan {
+	var chs []*ssa.MakeChan
+	for obj := range f.objs[n] {
+		if ch, ok := obj.(*ssa.MakeChan); ok {
+			chs = append(chs, ch)
+		}
+	}
+	sort.Slice(chs, func(i, j int) bool { return chs[i].Pos() < chs[j].Pos() })
+	return chs
+}
+
+// isClosed returns true if channel ch is closed somewhere in the program.
+func (f *chanFlow) isClosed(ch *ssa.MakeChan) bool {
+	return f.closed[ch]
+}
+
+// mayClose returns true if channel ch may be closed, i.e. a call to close in
+// the program may close the channel created by its make (see chanFlow), or ch
+// is closed by a model (e.g. the Done channel of a context).
+func (env *Environment) mayClose(ch *chans.Chan) bool {
+	if mkch, ok := ch.Value.(*ssa.MakeChan); ok && env.chanFlow().isClosed(mkch) {
+		return true
+	}
+	return ch.IsClosed()
+}
+
+// A payload is a channel sent over a channel, either as the value sent
+// (Field is -1) or in field Field of the struct (or pointer to struct) sent.
+type payload struct {
+	Field int
+	Chan  *ssa.MakeChan
+}
+
+// payloads returns the channels sent over channel ch.
+func (f *chanFlow) payloads(ch *ssa.MakeChan) []payload {
+	var payloads []payload
+	elem := ch.Type().Underlying().(*types.Chan).Elem()
+	if _, ok := elem.Underlying().(*types.Chan); ok {
+		for _, c := range f.chans(sentNode{ch}) {
+			payloads = append(payloads, payload{Field: -1, Chan: c})
+		}
+		return payloads
+	}
+	if ptr, ok := elem.Underlying().(*types.Pointer); ok {
+		elem = ptr.Elem()
+	}
+	if s, ok := elem.Underlying().(*types.Struct); ok {
+		for i := 0; i < s.NumFields(); i++ {
+			if _, ok := s.Field(i).Type().Underlying().(*types.Chan); !ok {
+				continue
+			}
+			for _, c := range f.chans(memNode{fieldObj{s.Field(i)}}) {
+				payloads = append(payloads, payload{Field: i, Chan: c})
+			}
+		}
+	}
+	return payloads
+}
@@ -0,0 +1,107 @@
+package migoinfer
+
+// For-select event loops.
+//
+// An event loop is a select in an infinite loop, where one of the cases
+// terminates the loop, e.g.
+//
+//	for {
+//		select {
+//		case v := <-ch:
+//			use(v)
+//		case <-done:
+//			return
+//		}
+//	}
+//
+// The select is emitted directly as a tail-recursive definition of the block
+// containing the select:
+//
+//	def f#1(ch, done): select
+//	    case recv ch; call f#2(ch, done);
+//	    case recv done;
+//	  endselect;
+//
+// A case which continues the loop without other statements (e.g. through the
+// select.done and loop blocks) calls the definition of the select block
+// directly, and a case which returns (without deferred calls) ends the case
+// instead of calling an empty definition.
+
+import (
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// forSelectNext returns the block a select case body blk continues to in a
+// for-select loop of sel, skipping blocks which only jump to another block.
+// The returned block is the block of sel if the case continues the loop, or
+// nil if the case returns from the function.
+func forSelectNext(sel *ssa.Select, blk *ssa.BasicBlock) (next *ssa.BasicBlock, ok bool) {
+	seen := make(map[*ssa.BasicBlock]bool)
+	for !seen[blk] {
+		seen[blk] = true
+		if blk == sel.Block() {
+			return blk, !hasPhi(blk)
+		}
+		if len(blk.Instrs) != 1 {
+			return nil, false
+		}
+		switch blk.Instrs[0].(type) {
+		case *ssa.Return: // No deferred calls (RunDefers) nor other statements.
+			return nil, true
+		case *ssa.Jump:
+			blk = blk.Succs[0]
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// hasPhi returns true if blk has φ-nodes, i.e. parameters of its definition
+// are renamed on entry.
+func hasPhi(blk *ssa.BasicBlock) bool {
+	for _, instr := range blk.Instrs {
+		if _, ok := instr.(*ssa.Phi); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isForSelect returns true if sel is the select of a for-select loop, i.e. a
+// blocking select with a case continuing the loop and a case returning.
+func isForSelect(sel *ssa.Select, bodyBlks []*ssa.BasicBlock) bool {
+	if !sel.Blocking {
+		return false
+	}
+	var loops, exits bool
+	for _, blk := range bodyBlks {
+		if blk == nil {
+			continue
+		}
+		if next, ok := forSelectNext(sel, blk); ok && next != nil {
+			loops = true
+		} else if ok {
+			exits = true
+		}
+	}
+	return loops && exits
+}
+
+// forSelectCase returns the continuation of the case with body block blk of
+// the for-select loop of sel, i.e. a call to the definition of the select
+// block if the case continues the loop, or nil if the case returns. The second
+// return value is false if the case body has other statements.
+func (v *Instruction) forSelectCase(sel *ssa.Select, blk *ssa.BasicBlock) (migo.Statement, bool) {
+	next, ok := forSelectNext(sel, blk)
+	if !ok {
+		return nil, false
+	}
+	if next == nil {
+		v.Debugf("%s For-select case block #%d returns", v.Module(), blk.Index)
+		return nil, true
+	}
+	v.Debugf("%s For-select case block #%d continues loop at #%d", v.Module(), blk.Index, next.Index)
+	return migoCall(v.Callee.Name(), next, v.Exported), true
+}
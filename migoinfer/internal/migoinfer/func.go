@@ -1,11 +1,18 @@
 package migoinfer
 
 import (
+	"go/types"
+
 	"github.com/fatih/color"
 	"github.com/nickng/gospal/block"
 	"github.com/nickng/gospal/callctx"
 	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/metrics"
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/maps"
 	"github.com/nickng/gospal/store/structs"
+	"github.com/nickng/gospal/tracing"
 	"github.com/pkg/errors"
 	"golang.org/x/tools/go/ssa"
 )
@@ -33,7 +40,7 @@ type Function struct {
 // In particular, the caller context contains the caller *ssa.Function and
 // its corresponding call function.
 func NewFunction(call *funcs.Call, ctx callctx.Context, env *Environment) *Function {
-	callee := funcs.Instantiate(call)
+	callee := env.Instances.Instantiate(call)
 	f := Function{
 		Callee:   callee,
 		Context:  callctx.Switch(ctx, callee),
@@ -55,7 +62,18 @@ func (f *Function) EnterFunc(fn *ssa.Function) {
 		f.Env.Errors <- errors.Wrap(ErrFnIsNil, "When entering function")
 	}
 	defer f.ExitFunc(fn)
+	metrics.FuncsEntered.Inc()
 	nBlock := len(f.Callee.Function().Blocks)
+	parent := f.Env.Span
+	if n := len(f.Env.spans); n > 0 {
+		parent = f.Env.spans[n-1]
+	}
+	span := tracing.Start(parent, "infer function", tracing.String("function", fn.String()), tracing.Int("blocks", nBlock))
+	f.Env.spans = append(f.Env.spans, span)
+	defer func() {
+		f.Env.spans = f.Env.spans[:len(f.Env.spans)-1]
+		span.End()
+	}()
 	f.Debugf("%s Enter %s (%d blocks)", f.Module(), fn.Name(), nBlock)
 
 	if nBlock > 0 {
@@ -64,6 +82,14 @@ func (f *Function) EnterFunc(fn *ssa.Function) {
 	}
 }
 
+// SetInits sets the package initialisers to call on entry of the function,
+// before the function body.
+func (f *Function) SetInits(inits ...*ssa.Function) {
+	if b, ok := f.Analyser.(*Block); b != nil && ok {
+		b.inits = inits
+	}
+}
+
 // ExitFunc finalises analysis of a function.
 func (f *Function) ExitFunc(fn *ssa.Function) {
 	if fn != nil {
@@ -72,17 +98,14 @@ func (f *Function) ExitFunc(fn *ssa.Function) {
 	if b, ok := f.Analyser.(*Block); b != nil && ok {
 		// Since a function is complete analysed, we can print its content.
 		for _, data := range b.meta {
-			f.Env.Prog.AddFunction(data.migoFunc)
+			f.Env.addFunction(data.migoFunc)
 		}
 	}
 }
 
 // SetLogger sets logger for Function and its child block.Analyser.
 func (f *Function) SetLogger(l *Logger) {
-	f.Logger = &Logger{
-		SugaredLogger: l.SugaredLogger,
-		module:        color.CyanString("func "),
-	}
+	f.Logger = l.withFunc(color.CyanString("func "), f.Callee.Function())
 	if b, ok := f.Analyser.(*Block); b != nil && ok {
 		if ls, ok := f.Analyser.(LogSetter); f.Analyser != nil && ok {
 			ls.SetLogger(f.Logger)
@@ -94,14 +117,48 @@ func (f *Function) exportParams() {
 	for _, param := range f.Callee.Definition().Parameters[:f.Callee.Definition().NParam+f.Callee.Definition().NFreeVar] {
 		if isChan(param) {
 			f.Export(param)
+			f.recordDir(param)
+			if ch, ok := f.Get(param).(*chans.Chan); ok {
+				f.exportPayloads(param, ch)
+			}
+		} else if ch, ok := f.Get(param).(*chans.Chan); ok && types.IsInterface(param.Type()) {
+			// Channel passed as an interface, e.g. interface{} asserted
+			// back to the channel in the body.
+			f.Export(param)
+			f.exportPayloads(param, ch)
+		} else if closure, ok := f.Get(param).(*funcs.Definition); ok {
+			for _, binding := range closure.Bindings() {
+				if isChan(binding) {
+					f.Export(binding)
+					f.recordDir(binding)
+				}
+			}
+		} else if m, ok := f.Get(param).(*maps.Map); ok {
+			f.exportMap(param, m)
 		} else if isStruct(param) {
 			if paramStruct, ok := f.Get(param).(*structs.Struct); ok {
 				for _, paramField := range paramStruct.Expand() {
 					if isChan(paramField) {
 						f.Export(paramField)
+						f.recordDir(paramField)
+						if ch, ok := f.Get(paramField).(*chans.Chan); ok {
+							f.exportPayloads(paramField, ch)
+						}
+					} else if m, ok := f.Get(paramField).(*maps.Map); ok {
+						f.exportMap(paramField, m)
 					}
 				}
 			}
 		}
 	}
 }
+
+// recordDir records the direction of channel parameter k of the function.
+func (f *Function) recordDir(k store.Key) {
+	dirs, ok := f.Env.ChanDirs[f.Callee.Name()]
+	if !ok {
+		dirs = make(map[string]types.ChanDir)
+		f.Env.ChanDirs[f.Callee.Name()] = dirs
+	}
+	dirs[k.Name()] = chans.Dir(k)
+}
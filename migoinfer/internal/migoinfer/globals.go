@@ -0,0 +1,152 @@
+package migoinfer
+
+// Handling of package variables initialised by package initialisers.
+//
+// Channels created in init() (or package-level var initialisers, which are
+// part of the synthetic package initialiser) and stored in package variables
+// outlive the initialiser. Since a MiGo definition cannot return channels to
+// its caller, such channels are created by the caller of the initialiser
+// instead (similar to channels returned by a function), and passed to the
+// initialiser as parameters. The analysis calls main.init at the start of
+// main.main, so the channels are created in main.main.
+//
+// Package variables are only visible in main.main and the initialisers, i.e.
+// a package variable used in other functions is not passed as parameter.
+
+import (
+	"go/constant"
+	"go/token"
+	"strings"
+
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// isInit returns true if fn is a package initialiser, i.e. the synthetic
+// package initialiser or a user-defined init function.
+func isInit(fn *ssa.Function) bool {
+	if fn == nil || fn.Parent() != nil || fn.Signature.Recv() != nil {
+		return false
+	}
+	return fn.Name() == "init" || strings.HasPrefix(fn.Name(), "init#")
+}
+
+// globalOf returns the package variable which val is stored to, or nil if val
+// is not stored to a package variable.
+func globalOf(val ssa.Value) *ssa.Global {
+	refs := val.Referrers()
+	if refs == nil {
+		return nil
+	}
+	for _, ref := range *refs {
+		if st, ok := ref.(*ssa.Store); ok && st.Val == val {
+			if g, ok := st.Addr.(*ssa.Global); ok {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// isGlobalInit returns true if the channel val is created to initialise a
+// package variable in a package initialiser. The channel is then created by
+// the caller of the initialiser.
+func (v *Instruction) isGlobalInit(val ssa.Value) bool {
+	return isInit(v.Callee.Function()) && globalOf(val) != nil
+}
+
+// putGlobal records the channel ch stored in package variable g by a package
+// initialiser.
+func (v *Instruction) putGlobal(g *ssa.Global, ch *chans.Chan) {
+	if !isInit(v.Callee.Function()) {
+		return
+	}
+	v.Debugf("%s Package variable %s ↦ %s", v.Module(), g.Name(), ch.UniqName())
+	v.Env.Globals.Put(g, ch)
+	v.Env.GlobalChans = append(v.Env.GlobalChans, g)
+}
+
+// bindGlobals binds the channels of package variables initialised by the
+// callee fn (i.e. Env.GlobalChans from index start) in the caller, and returns
+// the MiGo parameters to pass them to the callee.
+//
+// If the caller is not a package initialiser, the channels are created in the
+// caller.
+func (v *Instruction) bindGlobals(fn *Function, start int) []*migo.Parameter {
+	var params []*migo.Parameter
+	for _, g := range v.Env.GlobalChans[start:] {
+		ch, ok := v.Env.Globals.Get(g).(*chans.Chan)
+		if !ok {
+			continue
+		}
+		callee := fn.FindExported(fn.Context, ch)
+		if _, ok := callee.(Unexported); ok {
+			continue
+		}
+		v.Put(g, ch)
+		if !isInit(v.Callee.Function()) {
+			v.MiGo.AddStmts(migoNewChan(v.Logger, g, ch))
+		}
+		v.Export(g)
+		params = append(params, &migo.Parameter{Caller: g, Callee: callee})
+	}
+	return params
+}
+
+// callInit calls the package initialiser initFn.
+func (v *Instruction) callInit(initFn *ssa.Function) {
+	v.Debugf("%s Call package initialiser %s", v.Module(), initFn.String())
+	v.doCall(nil, nil, funcs.MakeDefinition(initFn))
+}
+
+// globalConst returns the constant package variable g holds, i.e. the constant
+// assigned by every store to g in the program, or nil if g is assigned
+// different constants or a non-constant, or the address of g is taken (so g
+// may be assigned indirectly).
+func (env *Environment) globalConst(g *ssa.Global) *ssa.Const {
+	if env.globalConsts == nil {
+		env.globalConsts = make(map[*ssa.Global]*ssa.Const)
+		assigned := make(map[*ssa.Global]bool) // Assigned a non-constant.
+		for fn := range ssautil.AllFunctions(env.Info.Prog) {
+			for _, blk := range fn.Blocks {
+				for _, instr := range blk.Instrs {
+					if st, ok := instr.(*ssa.Store); ok {
+						if g, ok := st.Addr.(*ssa.Global); ok {
+							c, isConst := st.Val.(*ssa.Const)
+							if prev, ok := env.globalConsts[g]; !isConst || ok && !sameConst(prev, c) {
+								assigned[g] = true
+							}
+							env.globalConsts[g] = c
+						}
+					}
+					for i, op := range instr.Operands(nil) {
+						g, ok := (*op).(*ssa.Global)
+						if !ok {
+							continue
+						}
+						_, isStore := instr.(*ssa.Store)
+						load, isLoad := instr.(*ssa.UnOp)
+						if !(isStore && i == 0) && !(isLoad && load.Op == token.MUL) {
+							assigned[g] = true // Address taken.
+						}
+					}
+				}
+			}
+		}
+		for g := range assigned {
+			env.globalConsts[g] = nil
+		}
+	}
+	return env.globalConsts[g]
+}
+
+// sameConst returns true if constants a and b have the same value.
+func sameConst(a, b *ssa.Const) bool {
+	if a.Value == nil || b.Value == nil {
+		return a.Value == nil && b.Value == nil
+	}
+	return constant.Compare(a.Value, token.EQL, b.Value)
+}
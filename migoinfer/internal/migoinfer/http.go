@@ -0,0 +1,118 @@
+package migoinfer
+
+// Models of net/http servers.
+//
+// An HTTP server serves every request in a new goroutine. Handlers registered
+// by http.Handle, http.HandleFunc (or the ServeMux equivalents) are recorded,
+// and a server (e.g. http.ListenAndServe) spawns each of them, as well as the
+// handler passed to the server explicitly.
+//
+// Handlers are spawned once per server, i.e. concurrent requests to the same
+// handler are not modelled. The Handler field of http.Server is not resolved,
+// so methods of http.Server only spawn the registered handlers.
+
+import (
+	"go/types"
+
+	"github.com/nickng/gospal/funcs"
+	"golang.org/x/tools/go/ssa"
+)
+
+const httpPkg = "net/http"
+
+// httpHandler is a registered HTTP handler.
+type httpHandler struct {
+	common *ssa.CallCommon   // Call to the handler.
+	def    *funcs.Definition // Definition of the handler.
+}
+
+// isHTTPHandler returns true if t is http.Handler.
+func isHTTPHandler(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok {
+		if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == httpPkg {
+			return obj.Name() == "Handler"
+		}
+	}
+	return false
+}
+
+// nilArgs returns nil arguments for calling a function of signature sig.
+// Handler arguments (http.ResponseWriter and *http.Request) do not carry
+// channels.
+func nilArgs(sig *types.Signature) []ssa.Value {
+	args := make([]ssa.Value, sig.Params().Len())
+	for i := range args {
+		args[i] = ssa.NewConst(nil, sig.Params().At(i).Type())
+	}
+	return args
+}
+
+// handlerCall returns a call to the handler h, where h is either a function
+// (e.g. argument of http.HandleFunc) or an http.Handler.
+func (v *Instruction) handlerCall(h ssa.Value) *httpHandler {
+	if c, ok := h.(*ssa.Const); ok && c.IsNil() {
+		return nil
+	}
+	// http.HandlerFunc(f) ⇒ f
+	for {
+		if mi, ok := h.(*ssa.MakeInterface); ok {
+			h = mi.X
+		} else if ct, ok := h.(*ssa.ChangeType); ok {
+			h = ct.X
+		} else if conv, ok := h.(*ssa.Convert); ok {
+			h = conv.X
+		} else {
+			break
+		}
+	}
+	var common *ssa.CallCommon
+	if sig, ok := h.Type().Underlying().(*types.Signature); ok {
+		common = &ssa.CallCommon{Value: h, Args: nilArgs(sig)}
+	} else {
+		obj, _, _ := types.LookupFieldOrMethod(h.Type(), true, nil, "ServeHTTP")
+		meth, ok := obj.(*types.Func)
+		if !ok {
+			v.Warnf("%s %s is not an HTTP handler", v.Module(), h.Name())
+			return nil
+		}
+		if types.IsInterface(h.Type()) {
+			common = &ssa.CallCommon{Value: h, Method: meth, Args: nilArgs(meth.Type().(*types.Signature))}
+		} else if fn := v.Env.Info.Prog.LookupMethod(h.Type(), meth.Pkg(), meth.Name()); fn != nil {
+			common = &ssa.CallCommon{Value: fn, Args: append([]ssa.Value{h}, nilArgs(meth.Type().(*types.Signature))...)}
+		} else {
+			return nil
+		}
+	}
+	common = v.unbind(common)
+	def := v.createDefinition(common)
+	if def == nil {
+		return nil
+	}
+	return &httpHandler{common: common, def: def}
+}
+
+// httpHandle is the Model of handler registration.
+func httpHandle(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool {
+	if handler := v.handlerCall(c.Args[len(c.Args)-1]); handler != nil {
+		v.Debugf("%s Register HTTP handler %s", v.Module(), handler.common)
+		v.Env.handlers = append(v.Env.handlers, handler)
+	}
+	return true
+}
+
+// httpServe is the Model of HTTP servers, which spawns the handlers.
+func httpServe(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool {
+	handlers := v.Env.handlers
+	for _, arg := range c.Args {
+		if isHTTPHandler(arg.Type()) {
+			if handler := v.handlerCall(arg); handler != nil {
+				handlers = []*httpHandler{handler} // Not DefaultServeMux.
+			}
+		}
+	}
+	for _, handler := range handlers {
+		v.Debugf("%s Serve HTTP handler %s", v.Module(), handler.common)
+		v.doGo(handler.common, handler.def)
+	}
+	return true
+}
@@ -1,15 +1,20 @@
 package migoinfer
 
 import (
+	"fmt"
 	"go/token"
 	"go/types"
+	"strings"
 
 	"github.com/fatih/color"
+	"github.com/nickng/gospal/absint"
 	"github.com/nickng/gospal/callctx"
 	"github.com/nickng/gospal/fn"
 	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/loop"
 	"github.com/nickng/gospal/store"
 	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/maps"
 	"github.com/nickng/gospal/store/structs"
 	"github.com/nickng/migo"
 	"github.com/pkg/errors"
@@ -24,6 +29,10 @@ type Instruction struct {
 
 	MiGo      *migo.Function // MiGo function definition of current block.
 	*Exported                // Local variables.
+	deferred  deferredStmts  // Emitted deferred calls of the function.
+	pools     poolFuncs      // Worker pools of the function.
+	loop      *loop.Info     // For-loop whose body is the block, if any.
+	exited    bool           // Control does not reach rest of the block.
 	*Logger
 }
 
@@ -38,6 +47,13 @@ func NewInstruction(callee *funcs.Instance, ctx callctx.Context, env *Environmen
 }
 
 func (v *Instruction) VisitInstr(instr ssa.Instruction) {
+	switch instr.(type) {
+	case *ssa.Call, *ssa.Go: // Hooks tried by VisitCall and VisitGo.
+	default:
+		if v.visitHooks(instr) {
+			return
+		}
+	}
 	switch instr := instr.(type) {
 	case *ssa.Alloc:
 		v.Debugf("%s Alloc: %s = %s\n\t%s",
@@ -169,6 +185,9 @@ func (v *Instruction) VisitInstr(instr ssa.Instruction) {
 }
 
 func (v *Instruction) VisitAlloc(instr *ssa.Alloc) {
+	if v.visitErrgroupAlloc(instr) {
+		return
+	}
 	t := instr.Type().(*types.Pointer).Elem()
 	switch t := t.Underlying().(type) {
 	case *types.Struct:
@@ -176,6 +195,10 @@ func (v *Instruction) VisitAlloc(instr *ssa.Alloc) {
 		if updater, ok := v.Context.(callctx.Updater); ok {
 			updater.PutUniq(instr, structs.New(v.Callee, instr))
 		}
+	case *types.Array:
+		if isChanMap(t) {
+			v.Put(instr, maps.New(v.Callee, instr))
+		}
 	default:
 		v.Debugf("%s Alloc %s = type %s (delay write)",
 			v.Module(), instr.Name(), t.String())
@@ -186,7 +209,29 @@ func (v *Instruction) VisitBinOp(instr *ssa.BinOp) {
 }
 
 func (v *Instruction) VisitCall(instr *ssa.Call) {
-	def := v.createDefinition(instr.Common())
+	if v.visitHooks(instr) {
+		return
+	}
+	if v.visitContextCall(instr.Common(), instr) || v.visitTimeCall(instr.Common(), instr) ||
+		v.visitErrgroupCall(instr.Common(), instr) || v.visitModel(instr.Common(), instr) {
+		return
+	}
+	if v.Env.noReturn(instr.Common().StaticCallee()) {
+		defer func() { v.exited = true }()
+	}
+	if b, ok := instr.Call.Value.(*ssa.Builtin); ok && b.Name() == "append" {
+		v.visitAppend(instr)
+		return
+	}
+	common := v.unbind(instr.Common())
+	if defs := v.invokeCandidates(common); defs != nil {
+		if _, ok := v.Env.VisitedFunc[instr.Common()]; !ok {
+			v.Env.VisitedFunc[instr.Common()] = true
+			v.doInvokeCall(common, instr, defs)
+		}
+		return
+	}
+	def := v.createDefinition(common)
 	if def == nil {
 		return
 	}
@@ -194,16 +239,24 @@ func (v *Instruction) VisitCall(instr *ssa.Call) {
 		return
 	}
 	v.Env.VisitedFunc[instr.Common()] = true
-	v.doCall(instr, def)
+	if v.isRecursive(def.Function) {
+		v.doRecursiveCall(common, instr, def)
+		return
+	}
+	if keys := v.summaryArgs(common, def); keys != nil {
+		v.bindElems(keys, func(v *Instruction) { v.doCall(common, instr, def) })
+		return
+	}
+	v.doCall(common, instr, def)
 }
 
 func (v *Instruction) VisitChangeInterface(instr *ssa.ChangeInterface) {
+	v.putConverted(instr, instr.X)
 }
 
 func (v *Instruction) VisitChangeType(instr *ssa.ChangeType) {
-	if _, ok := instr.X.Type().(*types.Chan); ok {
-		v.Put(instr, v.Get(instr.X))
-	}
+	// e.g. chan T → Events (type Events chan T), chan T → <-chan T.
+	v.putConverted(instr, instr.X)
 }
 
 func (v *Instruction) VisitConvert(instr *ssa.Convert) {
@@ -213,12 +266,47 @@ func (v *Instruction) VisitDebugRef(instr *ssa.DebugRef) {
 }
 
 func (v *Instruction) VisitDefer(instr *ssa.Defer) {
+	v.Debugf("%s Defer %s (delayed until function exit)\n\t%s",
+		v.Module(), instr.Common(), v.Env.getPos(instr))
 }
 
 func (v *Instruction) VisitExtract(instr *ssa.Extract) {
+	if sel, ok := instr.Tuple.(*ssa.Select); ok {
+		// Received values are after the select index and recvOk.
+		recvIdx := instr.Index - selectCaseRecv
+		for _, state := range sel.States {
+			if state.Dir == types.RecvOnly {
+				if recvIdx == 0 {
+					v.bindPayload(instr, state.Chan)
+					return
+				}
+				recvIdx--
+			}
+		}
+		return
+	}
+	switch val := v.Get(instr.Tuple).(type) {
+	case *chans.Chan:
+		if isChan(instr) {
+			v.Put(instr, val)
+		}
+	case *structs.Struct:
+		if isStruct(instr) {
+			v.Put(instr, val)
+		}
+	case *maps.Map: // Lookup (commaok) or Next.
+		v.putMapValue(instr, val)
+	}
 }
 
 func (v *Instruction) VisitField(instr *ssa.Field) {
+	if struc, ok := v.Get(instr.X).(*structs.Struct); ok {
+		if field := struc.Fields[instr.Field]; field != nil {
+			if fieldVal := v.Get(field); !isUndefined(fieldVal) {
+				v.Put(instr, fieldVal)
+			}
+		}
+	}
 }
 
 func (v *Instruction) VisitFieldAddr(instr *ssa.FieldAddr) {
@@ -233,8 +321,10 @@ func (v *Instruction) VisitFieldAddr(instr *ssa.FieldAddr) {
 				// By overwriting field with fieldVal which Get retrieves
 				// The old dangling Exported field will point to a real fieldVal
 				v.Put(field, fieldVal)
-				v.Unexport(field)
-				v.Export(field)
+				if isChan(field) { // Other fields are not MiGo names.
+					v.Unexport(field)
+					v.Export(field)
+				}
 				v.Put(instr, fieldVal)
 			}
 		} else {
@@ -244,6 +334,10 @@ func (v *Instruction) VisitFieldAddr(instr *ssa.FieldAddr) {
 			}
 			struc.Fields[instr.Field] = instr
 		}
+	case *chans.Chan:
+		if struc.IsTimer() { // Timer.C or Ticker.C
+			v.Put(instr, struc)
+		}
 	case store.MockValue:
 		v.Debugf("%s struct undefined\n\t%s", v.Module(), v.Env.getPos(instr))
 	default:
@@ -253,7 +347,21 @@ func (v *Instruction) VisitFieldAddr(instr *ssa.FieldAddr) {
 }
 
 func (v *Instruction) VisitGo(instr *ssa.Go) {
-	def := v.createDefinition(instr.Common())
+	if v.visitHooks(instr) {
+		return
+	}
+	if v.visitModel(instr.Common(), nil) { // e.g. go http.ListenAndServe(⋯)
+		return
+	}
+	common := v.unbind(instr.Common())
+	if defs := v.invokeCandidates(common); defs != nil {
+		if _, ok := v.Env.VisitedFunc[instr.Common()]; !ok {
+			v.Env.VisitedFunc[instr.Common()] = true
+			v.doInvokeGo(common, defs)
+		}
+		return
+	}
+	def := v.createDefinition(common)
 	if def == nil {
 		return
 	}
@@ -261,27 +369,59 @@ func (v *Instruction) VisitGo(instr *ssa.Go) {
 		return
 	}
 	v.Env.VisitedFunc[instr.Common()] = true
-	v.doGo(instr, def)
+	if v.isRecursive(def.Function) {
+		v.doRecursiveGo(common, def)
+		return
+	}
+	if hdr := workerPool(instr, def.Function); hdr != nil && v.pools != nil {
+		v.doPool(hdr, common, def)
+		return
+	}
+	if keys := v.summaryArgs(common, def); keys != nil {
+		v.bindElems(keys, func(v *Instruction) { v.doGo(common, def) })
+		return
+	}
+	v.doGo(common, def)
 }
 
 func (v *Instruction) VisitIf(instr *ssa.If) {
 }
 
 func (v *Instruction) VisitIndex(instr *ssa.Index) {
+	if m, ok := v.Get(instr.X).(*maps.Map); ok {
+		v.putMapValue(instr, m)
+	}
 }
 
 func (v *Instruction) VisitIndexAddr(instr *ssa.IndexAddr) {
+	if m, ok := v.Get(instr.X).(*maps.Map); ok {
+		v.putMapValue(instr, m)
+	}
 }
 
 func (v *Instruction) VisitJump(instr *ssa.Jump) {
 }
 
 func (v *Instruction) VisitLookup(instr *ssa.Lookup) {
+	if m, ok := v.Get(instr.X).(*maps.Map); ok {
+		if instr.CommaOk {
+			v.Put(instr, m)
+			return
+		}
+		v.putMapValue(instr, m)
+	}
 }
 
 func (v *Instruction) VisitMakeChan(instr *ssa.MakeChan) {
+	if ch, ok := v.createdPayload(instr); ok {
+		v.Debugf("%s %s = MakeChan skipped (created with carrier as %s)",
+			v.Module(), instr.Name(), ch.UniqName())
+		v.Put(instr, ch)
+		v.MiGo.AddStmts(&migo.TauStatement{})
+		return
+	}
 	newch := v.newChan(instr)
-	isReturnValue := v.Callee.Definition().IsReturn(instr)
+	isReturnValue := v.Callee.Definition().IsReturn(instr) || isReturnedVar(v.Callee.Definition(), instr)
 	var isParameter bool
 	str, field, isField := getStruct(instr)
 	if !isField { // Could be that the field is stored by *t0 = make(chan)
@@ -301,19 +441,40 @@ func (v *Instruction) VisitMakeChan(instr *ssa.MakeChan) {
 			}
 		}
 		if s, ok := v.Get(str).(*structs.Struct); ok {
-			s.Fields[field] = instr
+			if sf, ok := s.Fields[field].(structs.SField); ok && isParameter {
+				// Field of a receiver/parameter, keep the exported field so
+				// the channel is visible to the caller (see bindCallParameters).
+				v.Put(sf, newch)
+				v.Put(instr, newch)
+			} else {
+				s.Fields[field] = instr
+			}
 		}
 	}
 	if isReturnValue || isParameter {
 		v.Debugf("%s %s = MakeChan skipped\n\treturn value? %t\n\tparameter? %t",
 			v.Module(),
 			instr.Name(), isReturnValue, isParameter)
+		if isReturnValue && !isParameter {
+			// Returned channel is created by the caller and passed in as
+			// parameter (see paramsToMigoParam), so a stage of a pipeline
+			// (e.g. out := sq(in)) uses the channel of the caller.
+			v.Put(instr, newch)
+			v.Export(instr)
+		}
 		v.MiGo.AddStmts(&migo.TauStatement{})
 		return
 	}
 	v.Put(instr, newch)
 	v.Export(instr)
+	if v.isGlobalInit(instr) {
+		v.Debugf("%s %s = MakeChan for package variable (created by caller)",
+			v.Module(), instr.Name())
+		v.MiGo.AddStmts(&migo.TauStatement{})
+		return
+	}
 	v.MiGo.AddStmts(migoNewChan(v.Logger, instr, newch))
+	v.createPayloads(instr, newch)
 }
 
 func (v *Instruction) VisitMakeClosure(instr *ssa.MakeClosure) {
@@ -331,30 +492,50 @@ func (v *Instruction) VisitMakeInterface(instr *ssa.MakeInterface) {
 }
 
 func (v *Instruction) VisitMakeMap(instr *ssa.MakeMap) {
+	if isChanMap(instr.Type()) {
+		v.Put(instr, maps.New(v.Callee, instr))
+	}
 }
 
 func (v *Instruction) VisitMakeSlice(instr *ssa.MakeSlice) {
+	if isChanMap(instr.Type()) {
+		v.Put(instr, maps.New(v.Callee, instr))
+	}
 }
 
 func (v *Instruction) VisitMapUpdate(instr *ssa.MapUpdate) {
+	if m, ok := v.Get(instr.Map).(*maps.Map); ok {
+		v.mapUpdate(m, instr.Key, instr.Value)
+	}
 }
 
 func (v *Instruction) VisitNext(instr *ssa.Next) {
+	if m, ok := v.Get(instr.Iter).(*maps.Map); ok {
+		v.Put(instr, m)
+	}
 }
 
 func (v *Instruction) VisitPanic(instr *ssa.Panic) {
+	v.Debugf("%s Panic: run deferred calls and exit\n\t%s",
+		v.Module(), v.Env.getPos(instr))
+	v.runDefers(instr.Block())
+	v.exited = true
 }
 
 func (v *Instruction) VisitPhi(instr *ssa.Phi) {
 }
 
 func (v *Instruction) VisitRange(instr *ssa.Range) {
+	if m, ok := v.Get(instr.X).(*maps.Map); ok {
+		v.Put(instr, m)
+	}
 }
 
 func (v *Instruction) VisitReturn(instr *ssa.Return) {
 }
 
 func (v *Instruction) VisitRunDefers(instr *ssa.RunDefers) {
+	v.runDefers(instr.Block())
 }
 
 func (v *Instruction) VisitSelect(instr *ssa.Select) {
@@ -362,12 +543,18 @@ func (v *Instruction) VisitSelect(instr *ssa.Select) {
 }
 
 func (v *Instruction) VisitSend(instr *ssa.Send) {
+	if m, ok := v.Get(instr.Chan).(*maps.Map); ok {
+		v.MiGo.AddStmts(v.migoBroadcast(instr.Chan, m, migoSend)...)
+		return
+	}
+	v.recordChanOp(opSend, instr, instr.Pos(), instr.Chan)
 	v.MiGo.AddStmts(migoSend(v, instr.Chan, v.Get(instr.Chan)))
+	v.blockNilChan(instr.Chan)
 }
 
 func (v *Instruction) VisitSlice(instr *ssa.Slice) {
 	handle := v.Get(instr.X)
-	if instr.Low == nil && instr.High == nil { // Full slice.
+	if _, ok := handle.(*maps.Map); ok || instr.Low == nil && instr.High == nil { // Full slice.
 		v.Put(instr, handle)
 	}
 }
@@ -376,6 +563,17 @@ func (v *Instruction) VisitStore(instr *ssa.Store) {
 	val := v.Get(instr.Val)
 	if val != nil {
 		v.Put(instr.Addr, val)
+		if ia, ok := instr.Addr.(*ssa.IndexAddr); ok {
+			if m, ok := v.Get(ia.X).(*maps.Map); ok {
+				v.mapUpdate(m, nil, instr.Val)
+				v.unroll(instr, ia, m)
+			}
+		}
+		if g, ok := instr.Addr.(*ssa.Global); ok {
+			if ch, ok := val.(*chans.Chan); ok {
+				v.putGlobal(g, ch)
+			}
+		}
 	} else {
 		v.Fatalf("Store: %s is not defined", instr.Val.Name())
 	}
@@ -388,7 +586,14 @@ func (v *Instruction) VisitTypeAssert(instr *ssa.TypeAssert) {
 func (v *Instruction) VisitUnOp(instr *ssa.UnOp) {
 	switch instr.Op {
 	case token.ARROW:
+		if m, ok := v.Get(instr.X).(*maps.Map); ok {
+			v.MiGo.AddStmts(v.migoBroadcast(instr.X, m, migoRecv)...)
+			return
+		}
+		v.recordChanOp(opRecv, instr, instr.Pos(), instr.X)
 		v.MiGo.AddStmts(migoRecv(v, instr.X, v.Get(instr.X)))
+		v.bindPayload(instr, instr.X)
+		v.blockNilChan(instr.X)
 	case token.MUL:
 		if _, err := callctx.Deref(v.Context, instr.X, instr); err != nil {
 			v.Env.Errors <- errors.WithStack(err) // internal error.
@@ -400,16 +605,51 @@ func (v *Instruction) VisitUnOp(instr *ssa.UnOp) {
 
 // SetLogger sets logger for Instruction.
 func (v *Instruction) SetLogger(l *Logger) {
-	v.Logger = &Logger{
-		SugaredLogger: l.SugaredLogger,
-		module:        color.RedString("instr"),
+	v.Logger = l.withModule(color.RedString("instr"))
+}
+
+// unbind resolves a call to a bound method wrapper (i.e. a method value such as
+// s.run) to a call of the method, with the bound receiver as first argument.
+// The original call is returned if it is not a call to a bound method.
+func (v *Instruction) unbind(c *ssa.CallCommon) *ssa.CallCommon {
+	if c.IsInvoke() {
+		return c
+	}
+	var wrapper *ssa.Function
+	var bindings []ssa.Value
+	switch fv := c.Value.(type) {
+	case *ssa.MakeClosure:
+		wrapper, bindings = fv.Fn.(*ssa.Function), fv.Bindings
+	default:
+		if def, ok := v.Get(fv).(*funcs.Definition); ok {
+			wrapper, bindings = def.Function, def.Bindings()
+		}
+	}
+	if wrapper == nil || len(bindings) != 1 || !strings.HasPrefix(wrapper.Synthetic, "bound method wrapper") {
+		return c
+	}
+	recv := bindings[0]
+	for _, blk := range wrapper.Blocks {
+		for _, instr := range blk.Instrs {
+			if call, ok := instr.(*ssa.Call); ok {
+				if call.Call.IsInvoke() {
+					v.Debugf("%s Unbind %s → invoke %s", v.Module(), wrapper.Name(), call.Call.Method.Name())
+					return &ssa.CallCommon{Value: recv, Method: call.Call.Method, Args: c.Args}
+				}
+				if fn := call.Call.StaticCallee(); fn != nil {
+					v.Debugf("%s Unbind %s → %s", v.Module(), wrapper.Name(), fn.String())
+					return &ssa.CallCommon{Value: fn, Args: append([]ssa.Value{recv}, c.Args...)}
+				}
+			}
+		}
 	}
+	return c
 }
 
 func (v *Instruction) createDefinition(c *ssa.CallCommon) *funcs.Definition {
 	if !c.IsInvoke() {
 		switch fn := c.Value.(type) {
-		case *ssa.Function, *ssa.MakeClosure:
+		case *ssa.Function:
 			def, ok := v.Get(fn).(*funcs.Definition)
 			if !ok {
 				def = funcs.MakeDefinition(c.StaticCallee())
@@ -417,16 +657,43 @@ func (v *Instruction) createDefinition(c *ssa.CallCommon) *funcs.Definition {
 			}
 			v.Debugf("%s ↳ def %s", v.Module(), def.String())
 			return def
+		case *ssa.MakeClosure:
+			def, ok := v.Get(fn).(*funcs.Definition)
+			if !ok {
+				// Closure not visited: bind the captures directly.
+				def = funcs.MakeClosureDefinition(fn.Fn.(*ssa.Function), fn.Bindings)
+				v.Put(fn, def)
+			}
+			v.Debugf("%s ↳ closure %s", v.Module(), def.String())
+			return def
 		case *ssa.Builtin:
 			if fn.Name() == "close" {
 				if len(c.Args) != 1 {
 					v.Fatal("%s inconsistent: close should have 1 arg",
 						v.Module())
 				}
-				exported := v.FindExported(v.Context, v.Get(c.Args[0]))
-				v.MiGo.AddStmts(&migo.CloseStatement{Chan: exported.Name()})
+				if m, ok := v.Get(c.Args[0]).(*maps.Map); ok {
+					v.MiGo.AddStmts(v.migoBroadcast(c.Args[0], m, migoClose)...)
+				} else {
+					if call := callInstr(c); call != nil {
+						v.recordChanOp(opClose, call, c.Pos(), c.Args[0])
+					}
+					v.MiGo.AddStmts(migoClose(v, c.Args[0], v.Get(c.Args[0])))
+				}
 			}
 			v.Debugf("%s %v", v.Module(), fn)
+		default:
+			// Function value (e.g. closure passed as parameter).
+			if def, ok := v.Get(fn).(*funcs.Definition); ok {
+				v.Debugf("%s ↳ func value %s ↦ %s", v.Module(), fn.Name(), def.String())
+				return def
+			}
+			// Function value from unknown origin, e.g. a struct field.
+			if callees := v.graphCallees(c); len(callees) == 1 && len(callees[0].FreeVars) == 0 {
+				def := funcs.MakeDefinition(callees[0])
+				v.Debugf("%s ↳ func value %s ↦ %s (callgraph)", v.Module(), fn.Name(), def.String())
+				return def
+			}
 		}
 		return nil
 	}
@@ -442,7 +709,10 @@ func (v *Instruction) createDefinition(c *ssa.CallCommon) *funcs.Definition {
 		v.Module(), c, c.Method, c.Value, c.Value,
 	)
 	if c.Value != nil {
-		implFn, err := fn.LookupImpl(v.Env.Info.Prog, c.Method, c.Value)
+		implFn, err := v.Env.Impls.LookupImpl(v.Env.Info.Prog, c.Method, c.Value)
+		if implFns := v.graphCallees(c); err != nil && len(implFns) == 1 {
+			implFn, err = implFns[0], nil
+		}
 		if err != nil {
 			v.Warnf("%s Cannot find method %v for invoke call: %v\n\tMeth: %s\n\tImpl: %s:%s",
 				v.Module(), c, err,
@@ -465,10 +735,12 @@ func (v *Instruction) createDefinition(c *ssa.CallCommon) *funcs.Definition {
 	return nil
 }
 
-func (v *Instruction) doCall(c *ssa.Call, def *funcs.Definition) {
-	call := funcs.MakeCall(def, c.Common(), c)
+// doCall performs a function call. The return value ret is nil if the call
+// does not return a value to the caller (e.g. deferred call).
+func (v *Instruction) doCall(c *ssa.CallCommon, ret ssa.Value, def *funcs.Definition) {
+	call := funcs.MakeCall(def, c, ret)
 	if call == nil {
-		v.Warnf("%s Skipping nil call %s", v.Module(), c.Common())
+		v.Warnf("%s Skipping nil call %s", v.Module(), c)
 		return
 	}
 	v.Debugf("%s Definition: %v", v.Module(), def.String())
@@ -483,10 +755,32 @@ func (v *Instruction) doCall(c *ssa.Call, def *funcs.Definition) {
 		// Since the function does not have body,
 		// calling it will not produce migo definitions.
 		// Instead of trying to visit the function, skip over this.
+		v.summariseReturns(call)
+		return
+	}
+	key, summarised := v.summaryKey(call)
+	if name, ok := v.reuseSummary(key); summarised && ok {
+		stmt := &migo.CallStatement{Name: name}
+		stmt.AddParams(paramsToMigoParam(v, fn, call)...)
+		v.MiGo.AddStmts(stmt)
+		return
+	}
+	if name, degraded := v.degrade(c, call); degraded {
+		if name != "" {
+			stmt := &migo.CallStatement{Name: name}
+			stmt.AddParams(paramsToMigoParam(v, fn, call)...)
+			v.MiGo.AddStmts(stmt)
+		}
+		v.summariseReturns(call)
 		return
 	}
 
+	nGlobal := len(v.Env.GlobalChans)
 	fn.EnterFunc(call.Function())
+	v.Env.analysed[call.Function()] = fn.Callee.Name()
+	if summarised && len(v.Env.GlobalChans) == nGlobal {
+		v.Env.summaries[key] = fn.Callee.Name()
+	}
 	stmt := &migo.CallStatement{Name: fn.Callee.Name()}
 
 	v.bindCallParameters(call, fn)
@@ -497,15 +791,32 @@ func (v *Instruction) doCall(c *ssa.Call, def *funcs.Definition) {
 		caller := v.Get(callerName)
 		callee := fn.Get(call.Definition().Return(i))
 		if caller != callee {
+			if s, ok := callee.(*structs.Struct); ok && isStruct(callerName) {
+				callee = v.rebindStruct(callerName, fn, s)
+			}
 			v.Put(callerName, callee)
 			if isChan(callerName) { // Caller is a channel.
 				if _, ok := callerName.(store.Unused); !ok {
 					if calleeCh, ok := callee.(*chans.Chan); ok {
-						v.MiGo.AddStmts(migoNewChan(v.Logger, callerName, calleeCh))
+						if _, ok := v.FindExported(v.Context, calleeCh).(Unexported); !ok {
+							// Channel already in caller scope, e.g. returned by
+							// an accessor method of a struct holding the channel.
+							v.Debugf("%s Return existing channel %s", v.Module(), calleeCh.UniqName())
+							continue
+						}
+						if ret, ok := callerName.(ssa.Value); !ok || !v.isGlobalInit(ret) {
+							v.MiGo.AddStmts(migoNewChan(v.Logger, callerName, calleeCh))
+						}
 						v.Export(callerName) // Export caller name
 					} else {
 						// Callee does not initialise channel.
 					}
+				} else if calleeCh, ok := callee.(*chans.Chan); ok {
+					if _, ok := fn.FindExported(fn.Context, calleeCh).(Unexported); !ok {
+						// Return value unused but channel used by callee,
+						// e.g. output of a pipeline stage discarded.
+						v.MiGo.AddStmts(migoNewChan(v.Logger, callerName, calleeCh))
+					}
 				}
 			}
 		}
@@ -513,6 +824,7 @@ func (v *Instruction) doCall(c *ssa.Call, def *funcs.Definition) {
 
 	// Convert type Chan parameters to MiGo parameters.
 	migoParams := paramsToMigoParam(v, fn, call)
+	migoParams = append(migoParams, v.bindGlobals(fn, nGlobal)...)
 	stmt.AddParams(migoParams...)
 	if b, ok := fn.Analyser.(*Block); ok {
 		for _, data := range b.meta {
@@ -522,27 +834,111 @@ func (v *Instruction) doCall(c *ssa.Call, def *funcs.Definition) {
 	v.MiGo.AddStmts(stmt)
 }
 
-func (v *Instruction) doGo(g *ssa.Go, def *funcs.Definition) {
-	call := funcs.MakeCall(def, g.Common(), nil)
+// putConverted binds the result of a representation-preserving conversion
+// conv of x to the value of x, so that the channels (or structs, maps and
+// closures holding channels) keep their identity across the conversion.
+func (v *Instruction) putConverted(conv, x ssa.Value) {
+	if val := v.Get(x); !isUndefined(val) {
+		v.Debugf("%s Convert %s → %s (%s)", v.Module(), x.Name(), conv.Name(), conv.Type())
+		v.Put(conv, val)
+	}
+}
+
+// summariseReturns creates the channels returned by call to a function without
+// body (e.g. in a package not built), so the returned channels keep their
+// identity in the caller.
+//
+// A method without body called on the same receiver returns the same
+// channels (e.g. an accessor of a channel of the receiver), if they are in
+// scope, whereas other functions (e.g. factories) return new channels.
+func (v *Instruction) summariseReturns(call *funcs.Call) {
+	var recv store.Value
+	if call.Function().Signature.Recv() != nil && call.NParam() > 0 {
+		if val := v.Get(call.Param(0)); !isUndefined(val) {
+			recv = val
+		}
+	}
+	for i := 0; i < call.NReturn(); i++ {
+		ret, ok := call.Return(i).(ssa.Value)
+		if !ok || !isChan(ret) || !isUndefined(v.Get(ret)) {
+			continue
+		}
+		var key string
+		if recv != nil {
+			key = fmt.Sprintf("%s.%s#%d", recv.UniqName(), call.Function().String(), i)
+			if ch, ok := v.Env.returns[key]; ok {
+				if _, ok := v.FindExported(v.Context, ch).(Unexported); !ok {
+					v.Debugf("%s Return existing channel %s of %s", v.Module(), ch.UniqName(), call.Function().String())
+					v.Put(ret, ch)
+					continue
+				}
+			}
+		}
+		ch := chans.New(v.Callee, ret, 0)
+		v.Debugf("%s Summarise return value %s of %s", v.Module(), ret.Name(), call.Function().String())
+		v.Put(ret, ch)
+		v.Export(ret)
+		v.MiGo.AddStmts(migoNewChan(v.Logger, ret, ch))
+		if recv != nil {
+			v.Env.returns[key] = ch
+		}
+	}
+}
+
+// doGo spawns a goroutine. The arguments of the spawn and the captures of a
+// spawned closure (e.g. go func(id int) { ... }(i)) are both bound to the
+// parameters of the goroutine.
+func (v *Instruction) doGo(c *ssa.CallCommon, def *funcs.Definition) {
+	call := funcs.MakeCall(def, c, nil)
 	if call == nil {
-		v.Infof("%s Skipping nil go %s", v.Module(), g.Common())
+		v.Infof("%s Skipping nil go %s", v.Module(), c)
 		return
 	}
 	v.Debugf("%s Definition: %v", v.Module(), def.String())
 	v.Debugf("%s    Go/Call: %v", v.Module(), call.String())
+	for i := 0; i < call.NBind(); i++ {
+		v.Debugf("%s    Capture: %s ↦ %s", v.Module(), call.Definition().FreeVar(i).Name(), call.Bind(i).Name())
+	}
 	fn := NewFunction(call, v.Context, v.Env)
 	fn.SetLogger(v.Logger)
 	v.Debugf("%s Context at caller: %v%v", v.Module(), v.Context, v.Exported)
 	v.Debugf("%s Context at callee: %v%v", v.Module(), fn.Context, fn.Exported)
 	fn.exportParams()
 
+	if len(call.Function().Blocks) == 0 {
+		// Spawning a function without body does not produce a definition.
+		v.Debugf("%s Skipping go %s (no body)", v.Module(), call.Function().String())
+		return
+	}
+	if v.silentSpawn(call.Function(), c) {
+		return
+	}
+	if name, degraded := v.degrade(c, call); degraded {
+		if name != "" {
+			stmt := &migo.SpawnStatement{Name: name}
+			stmt.AddParams(paramsToMigoParam(v, fn, call)...)
+			v.MiGo.AddStmts(stmt)
+		}
+		return
+	}
+
+	nGlobal := len(v.Env.GlobalChans)
+	held := v.Env.held // The goroutine does not hold the locks of the spawner.
+	v.Env.held = nil
 	fn.EnterFunc(call.Function())
+	v.Env.held = held
+	v.Env.analysed[call.Function()] = fn.Callee.Name()
 	stmt := &migo.SpawnStatement{Name: fn.Callee.Name()}
+	if _, ok := v.Env.Spawns[fn.Callee.Name()]; !ok {
+		v.Env.Spawns[fn.Callee.Name()] = v.Env.getPos(c)
+	}
+	v.Env.SpawnEdges = append(v.Env.SpawnEdges, SpawnEdge{Spawner: v.Callee.Function(), Spawned: call.Function(), Pos: c.Pos()})
 
 	v.bindCallParameters(call, fn)
 
 	// Convert type Chan parameters to MiGo parameters.
 	migoParams := paramsToMigoParam(v, fn, call)
+	migoParams = append(migoParams, v.bindGlobals(fn, nGlobal)...)
 	stmt.AddParams(migoParams...)
 	if b, ok := fn.Analyser.(*Block); ok {
 		for _, data := range b.meta {
@@ -552,6 +948,58 @@ func (v *Instruction) doGo(g *ssa.Go, def *funcs.Definition) {
 	v.MiGo.AddStmts(stmt)
 }
 
+// degrade checks the budget and the context depth of the analysis before
+// call, and returns true if the callee should not be analysed. The MiGo
+// definition to call instead is returned if the callee is analysed already
+// (context-insensitive), or empty if the callee is opaque. Package initialisers
+// (c is nil) are always analysed, as they initialise the package variables.
+func (v *Instruction) degrade(c *ssa.CallCommon, call *funcs.Call) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	switch level := v.Env.Budget.check(); level {
+	case Insensitive:
+		if name, ok := v.Env.analysed[call.Function()]; ok {
+			v.Debugf("%s Budget: call %s (context-insensitive)", v.Module(), name)
+			v.Env.approximate(call.Function(), c, level, v.Env.Budget.reason)
+			return name, true
+		}
+	case Opaque:
+		if name, ok := v.Env.analysed[call.Function()]; ok {
+			v.Env.approximate(call.Function(), c, Insensitive, v.Env.Budget.reason)
+			return name, true
+		}
+		v.Debugf("%s Budget: skip %s (opaque)", v.Module(), call.Function().String())
+		v.Env.approximate(call.Function(), c, level, v.Env.Budget.reason)
+		return "", true
+	}
+	if k := v.Env.ContextDepth; k > 0 && v.contextDepth() >= k {
+		if name, ok := v.Env.analysed[call.Function()]; ok {
+			v.Debugf("%s Context depth: call %s (context-insensitive)", v.Module(), name)
+			v.Env.approximate(call.Function(), c, Insensitive, fmt.Sprintf("context depth %d reached", k))
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// contextDepth returns the number of calls in the context of the current
+// function.
+func (v *Instruction) contextDepth() int {
+	depth := 0
+	for ctx := v.Context; ctx != nil; {
+		callee, ok := ctx.(callctx.Callee)
+		if !ok {
+			break
+		}
+		if inst := callee.Call(); inst != nil && inst.Call() != nil {
+			depth++
+		}
+		ctx = callee.CallerCtx()
+	}
+	return depth
+}
+
 // getStruct returns the field variable and field index if the given value is a
 // struct field.
 func getStruct(value ssa.Value) (ssa.Value, int, bool) {
@@ -566,6 +1014,20 @@ func getStruct(value ssa.Value) (ssa.Value, int, bool) {
 	return nil, -1, false
 }
 
+// isReturnedVar returns true if the channel ch is stored to a local variable
+// returned by def, e.g. a channel captured by a closure of the function, so
+// the return value is loaded from the variable instead of ch itself.
+func isReturnedVar(def *funcs.Definition, ch ssa.Value) bool {
+	for _, ref := range *ch.Referrers() {
+		if st, ok := ref.(*ssa.Store); ok && st.Val == ch {
+			if local, ok := st.Addr.(*ssa.Alloc); ok && def.IsReturn(local) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // getParameterName looks for a parent struct or returns the origin value if it
 // is not part of a struct.
 func (v *Instruction) getParameterName(value ssa.Value) migo.NamedVar {
@@ -580,15 +1042,8 @@ func (v *Instruction) getParameterName(value ssa.Value) migo.NamedVar {
 
 // newChan creates a new channel instance
 func (v *Instruction) newChan(ch ssa.Value) *chans.Chan {
-	var bufSize int64
-	bufsz, ok := ch.(*ssa.MakeChan).Size.(*ssa.Const)
-	if !ok {
-		v.Env.Errors <- ErrChanBufSzNonStatic{Pos: v.Env.Info.FSet.Position(ch.Pos())}
-		bufSize = 1
-	} else {
-		bufSize = bufsz.Int64()
-	}
-	newch := chans.New(v.Callee, ch, bufSize)
+	newch := chans.New(v.Callee, ch, v.bufSize(ch))
+	v.Env.Chans[newch.UniqName()] = v.Env.getPos(ch)
 	if updater, ok := v.Context.(callctx.Updater); ok {
 		updater.PutUniq(ch, newch)
 	} else {
@@ -597,12 +1052,88 @@ func (v *Instruction) newChan(ch ssa.Value) *chans.Chan {
 	return newch
 }
 
+// bufSize returns the buffer size of channel ch, or 1 if it cannot be
+// determined statically.
+func (v *Instruction) bufSize(ch ssa.Value) int64 {
+	bufSize, ok := v.directiveChanSize(ch)
+	if !ok {
+		bufSize, ok = v.chanSize(ch.(*ssa.MakeChan).Size)
+	}
+	if !ok {
+		bufSize, ok = v.chanSizeRange(ch.(*ssa.MakeChan))
+	}
+	if !ok {
+		v.Env.Errors <- ErrChanBufSzNonStatic{Pos: v.Env.Info.FSet.Position(ch.Pos())}
+		bufSize = 1
+	}
+	return bufSize
+}
+
+// chanSize returns the channel buffer size if it can be determined statically.
+//
+// The size is either a constant, a constant from a caller (i.e. passed in as
+// parameter), or a package variable only assigned a constant.
+func (v *Instruction) chanSize(size ssa.Value) (int64, bool) {
+	switch size := size.(type) {
+	case *ssa.Const:
+		return size.Int64(), true
+	case *ssa.Convert:
+		return v.chanSize(size.X)
+	case *ssa.ChangeType:
+		return v.chanSize(size.X)
+	case *ssa.UnOp:
+		if g, ok := size.X.(*ssa.Global); ok && size.Op == token.MUL {
+			if c := v.Env.globalConst(g); c != nil {
+				return c.Int64(), true
+			}
+		}
+	}
+	if c, ok := v.Get(size).(store.Const); ok {
+		return c.Int64(), true
+	}
+	return 0, false
+}
+
+// chanSizeRange returns the channel buffer size of mkch from the range of its
+// size (see absint.Intervals), i.e. the size if the range is a singleton, or
+// else the lower bound if positive, e.g. 2 for runtime.NumCPU()*2.
+func (v *Instruction) chanSizeRange(mkch *ssa.MakeChan) (int64, bool) {
+	s, ok := v.Env.intervals(mkch.Parent()).Before(mkch).(absint.IntervalState)
+	if !ok || s == nil {
+		return 0, false
+	}
+	r := s.Of(mkch.Size)
+	if size, ok := r.Const(); ok {
+		return size, true
+	}
+	if r.Lo > 0 && r.Lo != absint.NegInf {
+		v.Env.Errors <- ErrChanBufSzRange{Pos: v.Env.Info.FSet.Position(mkch.Pos()), Range: r}
+		return r.Lo, true
+	}
+	return 0, false
+}
+
 const (
 	selectCaseIndex = 0
 	selectCaseValue = 1
+	selectCaseRecv  = 2 // First received value.
 )
 
+// getSelectCases returns the select statement of sel. The cases are in the
+// order of sel.States, followed by the default case (a τ branch) if the select
+// is non-blocking (i.e. the select index is -1 when no case is ready).
 func (v *Instruction) getSelectCases(sel *ssa.Select) migo.Statement {
+	if len(sel.States) == 0 {
+		if !sel.Blocking { // select { default: }
+			return &migo.TauStatement{}
+		}
+		// select {}
+		v.Debugf("%s Empty select blocks forever\n\t%s", v.Module(), v.Env.getPos(sel))
+		nc := newFreshNilChan(v.Env, types.NewChan(types.SendRecv, types.NewStruct(nil, nil)))
+		v.MiGo.AddStmts(migoNilChan(v, nc))
+		v.exited = true
+		return &migo.RecvStatement{Chan: nc.Name()}
+	}
 	nCases := len(sel.States)
 	if !sel.Blocking {
 		nCases++
@@ -615,6 +1146,7 @@ func (v *Instruction) getSelectCases(sel *ssa.Select) migo.Statement {
 	if !sel.Blocking {
 		stmt.Cases[nCases-1] = append(stmt.Cases[nCases-1], &migo.TauStatement{})
 	}
+	bodyBlks := make([]*ssa.BasicBlock, len(sel.States))
 	for _, selCase := range *sel.Referrers() {
 		switch c := selCase.(type) {
 		case *ssa.Extract:
@@ -626,10 +1158,16 @@ func (v *Instruction) getSelectCases(sel *ssa.Select) migo.Statement {
 					case *ssa.BinOp: // Select branch is this form, t_test = t_index == intval
 						if con, ok := selTest.Y.(*ssa.Const); selTest.X == c && selTest.Op == token.EQL && ok {
 							idx := int(con.Int64())
+							isNil := v.isNilChan(sel.States[idx].Chan)
 
-							bodyGuard := v.selBodyGuard(sel, idx)
+							var bodyGuard migo.Statement
+							if !isNil {
+								bodyGuard = v.selBodyGuard(sel, idx)
+							}
 							bodyBlk, defaultBlk := v.selBodyBlock(sel, idx, selTest.Block())
-							if bodyBlk != nil {
+							if isNil {
+								// Case removed (see removeNilCases).
+							} else if bodyBlk != nil {
 								stmt.Cases[idx] = append(stmt.Cases[idx], bodyGuard)
 								v.Debugf("%s Select index #%d block #%d (%s)", v.Module(), idx, bodyBlk.Index, bodyBlk.Comment)
 							} else {
@@ -638,8 +1176,9 @@ func (v *Instruction) getSelectCases(sel *ssa.Select) migo.Statement {
 							if defaultBlk != nil {
 								stmt.Cases[idx+1] = append(stmt.Cases[idx+1], migoCall(v.Callee.Name(), defaultBlk, v.Exported))
 							}
-							if bodyBlk != nil { // Return (no continuation)
+							if bodyBlk != nil && !isNil { // Return (no continuation)
 								stmt.Cases[idx] = append(stmt.Cases[idx], migoCall(v.Callee.Name(), bodyBlk, v.Exported))
+								bodyBlks[idx] = bodyBlk
 							}
 						}
 					default:
@@ -650,7 +1189,22 @@ func (v *Instruction) getSelectCases(sel *ssa.Select) migo.Statement {
 			}
 		}
 	}
-	return stmt
+	if isForSelect(sel, bodyBlks) {
+		v.Debugf("%s For-select loop\n\t%s", v.Module(), v.Env.getPos(sel))
+		for idx, bodyBlk := range bodyBlks {
+			if bodyBlk == nil {
+				continue
+			}
+			if next, ok := v.forSelectCase(sel, bodyBlk); ok {
+				// Replace call to the case body block.
+				stmt.Cases[idx] = stmt.Cases[idx][:len(stmt.Cases[idx])-1]
+				if next != nil {
+					stmt.Cases[idx] = append(stmt.Cases[idx], next)
+				}
+			}
+		}
+	}
+	return v.removeNilCases(sel, stmt)
 }
 
 // selBodyGuard returns the guard action of a select case (except for default).
@@ -658,8 +1212,14 @@ func (v *Instruction) selBodyGuard(sel *ssa.Select, caseIdx int) migo.Statement
 	// Select guard actions then jump to body blocks
 	switch sel.States[caseIdx].Dir {
 	case types.SendOnly:
+		v.recordChanOp(opSend, sel, sel.States[caseIdx].Pos, sel.States[caseIdx].Chan)
 		return migoSend(v, sel.States[caseIdx].Chan, v.Get(sel.States[caseIdx].Chan))
 	case types.RecvOnly:
+		if isOneShotTimer(v.Get(sel.States[caseIdx].Chan)) {
+			v.Debugf("%s Select case #%d is a timeout\n\t%s",
+				v.Module(), caseIdx, v.Env.getPos(sel))
+		}
+		v.recordChanOp(opRecv, sel, sel.States[caseIdx].Pos, sel.States[caseIdx].Chan)
 		return migoRecv(v, sel.States[caseIdx].Chan, v.Get(sel.States[caseIdx].Chan))
 	default:
 		v.Fatalf("%s Select case is guarded by neither send nor receive.\n\t%s",
@@ -675,6 +1235,9 @@ func (v *Instruction) selBodyGuard(sel *ssa.Select, caseIdx int) migo.Statement
 func (v *Instruction) selBodyBlock(sel *ssa.Select, caseIdx int, testBlk *ssa.BasicBlock) (bodyBlk, tauBlk *ssa.BasicBlock) {
 	switch inst := testBlk.Instrs[len(testBlk.Instrs)-1].(type) {
 	case *ssa.If: // Normal case.
+		// The else branch of the last case test of a non-blocking select is
+		// the default case, the else branch of other case tests is the
+		// next case test (or unreachable for blocking select).
 		if isLastCase := caseIdx == len(sel.States)-1 && !sel.Blocking; isLastCase {
 			v.Debugf("%s Select default block #%d.\n\t%s",
 				v.Module(), caseIdx+1, v.Env.getPos(sel))
@@ -750,6 +1313,16 @@ func (v *Instruction) bindCallParameters(call *funcs.Call, fn *Function) {
 						v.Put(argField, fn.Get(prmField.Key))
 						argField.Struct.Fields[argField.Index] = argField
 					}
+					// Channel field of receiver/parameter created inside
+					// function (e.g. by a Start method).
+					if argField.Key == nil && prmField.Key == nil && isChan(argField) && isUndefined(v.Get(argField)) {
+						if ch, ok := fn.Get(prmField).(*chans.Chan); ok {
+							v.MiGo.AddStmts(migoNewChan(v.Logger, argField, ch))
+							v.Put(argField, ch)
+							v.Export(argField)
+							argField.Struct.Fields[argField.Index] = argField
+						}
+					}
 				case *structs.Struct:
 					// Ignore.
 				}
@@ -0,0 +1,114 @@
+package migoinfer
+
+// Dynamically dispatched interface calls.
+//
+// If the implementation of an invoke call cannot be determined statically
+// (e.g. the interface is a function parameter), every candidate implementation
+// (see fn.LookupImpls, or fn.LookupCallees if a callgraph is given) may be
+// called. The call is emitted as an internal
+// choice over the calls to each candidate, e.g. for x.f() with candidates
+// (*T).f and (U).f
+//
+//	if call T.f(⋯) else call U.f(⋯) endif;
+//
+// The return value of the call is the return value of the last candidate.
+
+import (
+	"github.com/nickng/gospal/fn"
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// invokeCandidates returns the definitions of the candidate implementations
+// of invoke call c if there are more than one, or nil otherwise.
+func (v *Instruction) invokeCandidates(c *ssa.CallCommon) []*funcs.Definition {
+	if !c.IsInvoke() || c.Value == nil {
+		return nil
+	}
+	implFns, err := v.lookupImpls(c)
+	if err != nil || len(implFns) < 2 {
+		return nil
+	}
+	defs := make([]*funcs.Definition, len(implFns))
+	for i, implFn := range implFns {
+		def, ok := v.Get(implFn).(*funcs.Definition)
+		if !ok {
+			def = funcs.MakeDefinition(implFn)
+			v.Put(implFn, def)
+		}
+		v.Debugf("%s ↳ invoke candidate %s", v.Module(), def.String())
+		defs[i] = def
+	}
+	return defs
+}
+
+// lookupImpls returns the candidate implementations of invoke call c, using
+// the callgraph of the environment if there is one.
+func (v *Instruction) lookupImpls(c *ssa.CallCommon) ([]*ssa.Function, error) {
+	if v.Env.CallGraph != nil {
+		return fn.LookupCallees(v.Env.Info.Prog, v.Env.CallGraph, c)
+	}
+	return v.Env.Impls.LookupImpls(v.Env.Info.Prog, c.Method, c.Value)
+}
+
+// graphCallees returns the functions which may be called by c according to
+// the callgraph of the environment, or nil if there is no callgraph.
+func (v *Instruction) graphCallees(c *ssa.CallCommon) []*ssa.Function {
+	if v.Env.CallGraph == nil {
+		return nil
+	}
+	fns, err := fn.LookupCallees(v.Env.Info.Prog, v.Env.CallGraph, c)
+	if err != nil {
+		return nil
+	}
+	return fns
+}
+
+// doChoice emits an internal choice over the calls (or spawns, depending on
+// do) of each candidate definition in defs.
+func (v *Instruction) doChoice(defs []*funcs.Definition, do func(v *Instruction, def *funcs.Definition)) {
+	var branches [][]migo.Statement
+	for _, def := range defs {
+		body := *v
+		body.MiGo = migo.NewFunction(v.MiGo.SimpleName())
+		do(&body, def)
+		if body.MiGo.Stmts == nil {
+			body.MiGo.Stmts = []migo.Statement{}
+		}
+		branches = append(branches, body.MiGo.Stmts)
+	}
+	v.MiGo.AddStmts(migoChoice(branches)...)
+}
+
+// migoChoice returns the nested if-statements choosing between branches.
+func migoChoice(branches [][]migo.Statement) []migo.Statement {
+	if len(branches) == 1 {
+		return branches[0]
+	}
+	return []migo.Statement{&migo.IfStatement{Then: branches[0], Else: migoChoice(branches[1:])}}
+}
+
+// doInvokeCall calls every candidate implementation defs of c.
+func (v *Instruction) doInvokeCall(c *ssa.CallCommon, ret ssa.Value, defs []*funcs.Definition) {
+	v.Debugf("%s Choice of %d implementations for %s", v.Module(), len(defs), c)
+	v.doChoice(defs, func(v *Instruction, def *funcs.Definition) {
+		if v.isRecursive(def.Function) {
+			v.doRecursiveCall(c, ret, def)
+			return
+		}
+		v.doCall(c, ret, def)
+	})
+}
+
+// doInvokeGo spawns one of the candidate implementations defs of c.
+func (v *Instruction) doInvokeGo(c *ssa.CallCommon, defs []*funcs.Definition) {
+	v.Debugf("%s Choice of %d implementations for go %s", v.Module(), len(defs), c)
+	v.doChoice(defs, func(v *Instruction, def *funcs.Definition) {
+		if v.isRecursive(def.Function) {
+			v.doRecursiveGo(c, def)
+			return
+		}
+		v.doGo(c, def)
+	})
+}
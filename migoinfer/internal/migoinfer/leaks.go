@@ -0,0 +1,337 @@
+package migoinfer
+
+// Goroutine leak heuristics.
+//
+// FindLeaks looks for goroutines in an inferred MiGo program which may block
+// forever, independently of external checkers. The program is walked from its
+// top-level definitions (i.e. definitions not called or spawned by others),
+// and every spawn starts a new process. The channel operations of each
+// process are collected, where channels are identified by their newchan.
+//
+// A blocking operation (a send on an unbuffered channel or a receive, outside
+// of select) of a goroutine is reported if
+//
+//   - no other process has a matching operation on the channel, i.e. the
+//     goroutine can never be joined, or
+//   - the goroutine always performs the operation, but the only process with a
+//     matching operation is its spawner, which does not perform it on every
+//     path (e.g. the classic leaked worker after an early return).
+//
+// The heuristics are not sound nor complete: the number of operations and
+// their ordering are not considered.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/internal/cancel"
+	"github.com/nickng/migo"
+)
+
+// Leak is a goroutine which may block forever.
+type Leak struct {
+	Goroutine string // MiGo definition of the goroutine.
+	Spawner   string // MiGo definition which spawns the goroutine.
+	SpawnPos  string // Position of spawn site (or empty if unknown).
+	Op        string // Blocking operation, i.e. "send" or "recv".
+	Chan      string // Channel name (in the goroutine) of the operation.
+	NoPeer    bool   // Matching operation does not exist in any process.
+}
+
+func (l Leak) String() string {
+	pos := l.SpawnPos
+	if pos == "" {
+		pos = "-"
+	}
+	reason := "peer not on every path of " + l.Spawner
+	if l.NoPeer {
+		reason = "no peer"
+	}
+	return fmt.Sprintf("%s: goroutine %s may leak: blocked on %s %s (%s)",
+		pos, l.Goroutine, l.Op, l.Chan, reason)
+}
+
+type opKind int
+
+const (
+	opSend opKind = iota
+	opRecv
+	opClose
+)
+
+func (k opKind) String() string {
+	switch k {
+	case opSend:
+		return "send"
+	case opRecv:
+		return "recv"
+	}
+	return "close"
+}
+
+// chanOp is an operation on a channel (identified by its newchan).
+type chanOp struct {
+	ch string
+	op opKind
+}
+
+// opSet is a set of channel operations.
+type opSet map[chanOp]bool
+
+func (s opSet) union(t opSet) opSet {
+	u := make(opSet)
+	for op := range s {
+		u[op] = true
+	}
+	for op := range t {
+		u[op] = true
+	}
+	return u
+}
+
+func (s opSet) intersect(t opSet) opSet {
+	u := make(opSet)
+	for op := range s {
+		if t[op] {
+			u[op] = true
+		}
+	}
+	return u
+}
+
+// blockingOp is a blocking operation of a process and its local channel name.
+type blockingOp struct {
+	chanOp
+	name string
+}
+
+// process is a goroutine (or a top-level process) in the MiGo program.
+type process struct {
+	def      string
+	spawner  *process
+	may      opSet            // Operations which may be performed.
+	must     opSet            // Operations performed on every path.
+	blocking []blockingOp     // Blocking operations.
+	visited  map[string]opSet // Called definitions (with arguments).
+}
+
+// leakFinder walks a MiGo program to collect operations of each process.
+type leakFinder struct {
+	funcs   map[string]*migo.Function
+	sizes   map[string]int64 // Buffer sizes, by channel.
+	spawned map[string]bool  // Spawned definitions (with arguments).
+	procs   []*process
+}
+
+// FindLeaks returns the goroutines of prog which may leak, where spawns maps
+// the MiGo definition of each goroutine to its spawn site.
+func FindLeaks(prog *migo.Program, spawns map[string]string) []Leak {
+	spawns = simpleNames(spawns)
+	lf := leakFinder{
+		funcs:   make(map[string]*migo.Function),
+		sizes:   make(map[string]int64),
+		spawned: make(map[string]bool),
+	}
+	used := make(map[string]bool)
+	for _, f := range prog.Funcs {
+		lf.funcs[f.SimpleName()] = f
+		markUsed(f.Stmts, used)
+	}
+	for _, f := range prog.Funcs {
+		if !used[f.SimpleName()] && len(f.Params) == 0 {
+			lf.run(f.SimpleName(), nil, make(map[string]string))
+		}
+	}
+
+	var leaks []Leak
+	for _, p := range lf.procs {
+		if p.spawner == nil {
+			continue
+		}
+		reported := make(map[chanOp]bool)
+		for _, b := range p.blocking {
+			if reported[b.chanOp] || b.op == opSend && lf.sizes[b.ch] > 0 {
+				continue
+			}
+			reported[b.chanOp] = true
+			var peers []*process
+			for _, q := range lf.procs {
+				if q != p && lf.hasPeer(q.may, b.chanOp) {
+					peers = append(peers, q)
+				}
+			}
+			leak := Leak{
+				Goroutine: p.def,
+				Spawner:   p.spawner.def,
+				SpawnPos:  spawns[p.def],
+				Op:        b.op.String(),
+				Chan:      b.name,
+			}
+			if len(peers) == 0 {
+				leak.NoPeer = true
+				leaks = append(leaks, leak)
+			} else if len(peers) == 1 && peers[0] == p.spawner && p.must[b.chanOp] && !lf.hasPeer(p.spawner.must, b.chanOp) {
+				leaks = append(leaks, leak)
+			}
+		}
+	}
+	sort.SliceStable(leaks, func(i, j int) bool { return leaks[i].SpawnPos < leaks[j].SpawnPos })
+	return leaks
+}
+
+// markUsed marks the definitions called or spawned in stmts.
+func markUsed(stmts []migo.Statement, used map[string]bool) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			used[simpleName(stmt.Name)] = true
+		case *migo.SpawnStatement:
+			used[simpleName(stmt.Name)] = true
+		case *migo.IfStatement:
+			markUsed(stmt.Then, used)
+			markUsed(stmt.Else, used)
+		case *migo.IfForStatement:
+			markUsed(stmt.Then, used)
+			markUsed(stmt.Else, used)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				markUsed(c, used)
+			}
+		}
+	}
+}
+
+// simpleName returns the name of the definition called or spawned as name, as
+// printed in MiGo, i.e. without the quotes of the package path.
+func simpleName(name string) string {
+	return (&migo.Function{Name: name}).SimpleName()
+}
+
+// simpleNames returns m keyed by the simple names of its definitions.
+func simpleNames(m map[string]string) map[string]string {
+	names := make(map[string]string, len(m))
+	for def, v := range m {
+		names[simpleName(def)] = v
+	}
+	return names
+}
+
+// hasPeer returns true if ops has an operation matching op.
+func (lf *leakFinder) hasPeer(ops opSet, op chanOp) bool {
+	switch op.op {
+	case opSend:
+		return ops[chanOp{ch: op.ch, op: opRecv}]
+	case opRecv:
+		return ops[chanOp{ch: op.ch, op: opSend}] || ops[chanOp{ch: op.ch, op: opClose}]
+	}
+	return false
+}
+
+// run starts a new process of definition def with channels env.
+func (lf *leakFinder) run(def string, spawner *process, env map[string]string) {
+	p := &process{
+		def:     def,
+		spawner: spawner,
+		may:     make(opSet),
+		visited: make(map[string]opSet),
+	}
+	lf.procs = append(lf.procs, p)
+	if f, ok := lf.funcs[def]; ok {
+		p.must = lf.walk(p, f.Stmts, env, false)
+	}
+}
+
+// args returns the channels env of the callee of a call/spawn with params,
+// and a key identifying the call.
+func (lf *leakFinder) args(name string, params []*migo.Parameter, env map[string]string) (map[string]string, string) {
+	calleeEnv := make(map[string]string)
+	chs := []string{name}
+	for _, param := range params {
+		if ch, ok := env[param.Caller.Name()]; ok {
+			calleeEnv[param.Callee.Name()] = ch
+			chs = append(chs, ch)
+		}
+	}
+	return calleeEnv, strings.Join(chs, ",")
+}
+
+// walk collects the operations of stmts in process p, and returns the
+// operations performed on every path. If stmts is a select case (isCase), its
+// first statement is the guard of the case, which is not blocking.
+func (lf *leakFinder) walk(p *process, stmts []migo.Statement, env map[string]string, isCase bool) opSet {
+	must := make(opSet)
+	addOp := func(name string, op opKind, guard bool) {
+		ch, ok := env[name]
+		if !ok {
+			return // Unknown channel.
+		}
+		o := chanOp{ch: ch, op: op}
+		p.may[o], must[o] = true, true
+		if !guard && op != opClose {
+			p.blocking = append(p.blocking, blockingOp{chanOp: o, name: name})
+		}
+	}
+	for i, stmt := range stmts {
+		guard := isCase && i == 0
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			env[stmt.Name.Name()] = stmt.Chan
+			lf.sizes[stmt.Chan] = stmt.Size
+		case *migo.SendStatement:
+			addOp(stmt.Chan, opSend, guard)
+		case *migo.RecvStatement:
+			addOp(stmt.Chan, opRecv, guard)
+		case *migo.CloseStatement:
+			addOp(stmt.Chan, opClose, guard)
+		case *cancel.Close:
+			addOp(stmt.Chan, opClose, guard)
+		case *migo.CallStatement:
+			calleeEnv, key := lf.args(stmt.Name, stmt.Params, env)
+			if ops, ok := p.visited[key]; ok {
+				must = must.union(ops) // nil (in progress) is empty.
+				continue
+			}
+			p.visited[key] = nil
+			if f, ok := lf.funcs[simpleName(stmt.Name)]; ok {
+				ops := lf.walk(p, f.Stmts, calleeEnv, false)
+				p.visited[key] = ops
+				must = must.union(ops)
+			}
+		case *migo.SpawnStatement:
+			calleeEnv, key := lf.args(stmt.Name, stmt.Params, env)
+			if !lf.spawned[key] {
+				lf.spawned[key] = true
+				lf.run(simpleName(stmt.Name), p, calleeEnv)
+			}
+		case *migo.IfStatement:
+			then := lf.walk(p, stmt.Then, copyEnv(env), false)
+			els := lf.walk(p, stmt.Else, copyEnv(env), false)
+			must = must.union(then.intersect(els))
+		case *migo.IfForStatement:
+			then := lf.walk(p, stmt.Then, copyEnv(env), false)
+			els := lf.walk(p, stmt.Else, copyEnv(env), false)
+			must = must.union(then.intersect(els))
+		case *migo.SelectStatement:
+			var cases opSet
+			for j, c := range stmt.Cases {
+				ops := lf.walk(p, c, copyEnv(env), true)
+				if j == 0 {
+					cases = ops
+				} else {
+					cases = cases.intersect(ops)
+				}
+			}
+			must = must.union(cases)
+		}
+	}
+	return must
+}
+
+func copyEnv(env map[string]string) map[string]string {
+	m := make(map[string]string, len(env))
+	for k, v := range env {
+		m[k] = v
+	}
+	return m
+}
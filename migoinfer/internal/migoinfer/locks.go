@@ -0,0 +1,219 @@
+package migoinfer
+
+// Lock-order analysis.
+//
+// Calls to the Lock and Unlock methods of sync.Mutex and sync.RWMutex are
+// modelled (see DefaultModels) to track the locks held during inference. A
+// lock is identified by its class: the package variable or struct field of
+// the mutex (of any struct value), or the allocation site of a local mutex.
+// Acquiring lock B while holding lock A adds the edge A → B to the lock-order
+// graph (Environment.LockOrder), with the acquisition stacks of both locks.
+//
+// A cycle in the lock-order graph (e.g. A → B and B → A) is a potential
+// deadlock if the acquisitions run concurrently, and is reported by
+// FindLockCycles. This complements the deadlock detection on the MiGo types,
+// which only model channels.
+//
+// Read locks are treated as write locks, as a pending writer blocks new
+// readers. Nested acquisitions of the same class (e.g. two values of the same
+// struct type) are not tracked, as the values cannot be told apart. The locks
+// held are tracked along the order the blocks are visited, so a lock released
+// in one branch only is released in the rest of the function.
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/callctx"
+	"golang.org/x/tools/go/ssa"
+)
+
+// LockAcq is an acquisition of a lock.
+type LockAcq struct {
+	Lock  string   // Lock class.
+	Stack []string // Position of the acquisition, then the functions (innermost first).
+}
+
+func (a LockAcq) String() string {
+	if len(a.Stack) == 0 {
+		return a.Lock
+	}
+	return fmt.Sprintf("%s at %s in %s", a.Lock, a.Stack[0], strings.Join(a.Stack[1:], " ← "))
+}
+
+// LockEdge is an edge of the lock-order graph: lock Acquired is acquired while
+// holding lock Held.
+type LockEdge struct {
+	Held, Acquired LockAcq
+}
+
+// LockCycle is a cycle of the lock-order graph.
+type LockCycle struct {
+	Locks []string    // Lock classes in acquisition order.
+	Edges []*LockEdge // Edges of the cycle, Edges[i] acquires Locks[i+1] holding Locks[i].
+}
+
+// Pos returns the position of the first acquisition of the cycle.
+func (c LockCycle) Pos() string {
+	if len(c.Edges) == 0 || len(c.Edges[0].Acquired.Stack) == 0 {
+		return ""
+	}
+	return c.Edges[0].Acquired.Stack[0]
+}
+
+func (c LockCycle) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: potential deadlock: lock order cycle %s → %s", c.Pos(), strings.Join(c.Locks, " → "), c.Locks[0])
+	for _, e := range c.Edges {
+		fmt.Fprintf(&buf, "\n\t%s\n\t\twhile holding %s", e.Acquired, e.Held)
+	}
+	return buf.String()
+}
+
+// lockModel returns the Model of a call to the Lock (or Unlock) method of a
+// mutex.
+func lockModel(acquire bool) Model {
+	return func(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool {
+		if len(c.Args) == 0 {
+			return true
+		}
+		class := lockClass(c.Args[0])
+		if class == "" {
+			v.Debugf("%s Model %s: unknown lock", v.Module(), c)
+			return true
+		}
+		if acquire {
+			v.acquire(class, c)
+		} else {
+			v.release(class)
+		}
+		return true
+	}
+}
+
+// lockClass returns the class of the lock at address addr, or empty if the
+// lock cannot be identified.
+func lockClass(addr ssa.Value) string {
+	switch addr := addr.(type) {
+	case *ssa.Global:
+		return addr.Pkg.Pkg.Name() + "." + addr.Name()
+	case *ssa.FieldAddr:
+		if t, ok := addr.X.Type().Underlying().(*types.Pointer); ok {
+			if s, ok := t.Elem().Underlying().(*types.Struct); ok {
+				return fmt.Sprintf("(%s).%s", types.TypeString(t.Elem(), relName), s.Field(addr.Field).Name())
+			}
+		}
+	case *ssa.UnOp: // Pointer to mutex loaded from a variable or field.
+		if addr.Op == token.MUL {
+			return lockClass(addr.X)
+		}
+	case *ssa.Alloc:
+		if addr.Parent() != nil {
+			return addr.Parent().String() + "." + addr.Comment
+		}
+	}
+	return ""
+}
+
+// relName qualifies types by package name.
+func relName(pkg *types.Package) string { return pkg.Name() }
+
+// acquire records the acquisition of lock class at call site c, and the edges
+// from the locks held.
+func (v *Instruction) acquire(class string, c *ssa.CallCommon) {
+	acq := LockAcq{Lock: class, Stack: v.lockStack(c)}
+	v.Debugf("%s Acquire lock %s", v.Module(), class)
+	for _, h := range v.Env.held {
+		if h.Lock == class {
+			continue
+		}
+		key := [2]string{h.Lock, class}
+		if _, ok := v.Env.LockOrder[key]; !ok {
+			v.Env.LockOrder[key] = &LockEdge{Held: h, Acquired: acq}
+		}
+	}
+	v.Env.held = append(v.Env.held, acq)
+}
+
+// release removes the last acquisition of lock class from the locks held.
+func (v *Instruction) release(class string) {
+	v.Debugf("%s Release lock %s", v.Module(), class)
+	for i := len(v.Env.held) - 1; i >= 0; i-- {
+		if v.Env.held[i].Lock == class {
+			v.Env.held = append(v.Env.held[:i], v.Env.held[i+1:]...)
+			return
+		}
+	}
+}
+
+// lockStack returns the acquisition stack at call site c: the position of c,
+// then the functions of the call contexts (innermost first).
+func (v *Instruction) lockStack(c *ssa.CallCommon) []string {
+	stack := []string{v.Env.getPos(c)}
+	if fn := v.Callee.Function(); fn != nil {
+		stack = append(stack, fn.String())
+	}
+	for ctx := v.Context; ctx != nil; {
+		callee, ok := ctx.(callctx.Callee)
+		if !ok {
+			break
+		}
+		if inst := callee.Call(); inst != nil && inst.Call() != nil {
+			if name := inst.Function().String(); name != stack[len(stack)-1] {
+				stack = append(stack, name)
+			}
+		}
+		ctx = callee.CallerCtx()
+	}
+	return stack
+}
+
+// FindLockCycles returns the cycles of the lock-order graph of env, i.e. the
+// locks which may be acquired in inconsistent orders.
+func FindLockCycles(env *Environment) []LockCycle {
+	succs := make(map[string][]string)
+	for key := range env.LockOrder {
+		succs[key[0]] = append(succs[key[0]], key[1])
+	}
+	var locks []string
+	for l := range succs {
+		sort.Strings(succs[l])
+		locks = append(locks, l)
+	}
+	sort.Strings(locks)
+
+	var cycles []LockCycle
+	// Each cycle is found once, from its smallest lock.
+	for _, start := range locks {
+		var path []string
+		onPath := make(map[string]bool)
+		var visit func(l string)
+		visit = func(l string) {
+			path = append(path, l)
+			onPath[l] = true
+			for _, next := range succs[l] {
+				switch {
+				case next == start:
+					cycle := LockCycle{Locks: append([]string(nil), path...)}
+					for i, from := range path {
+						to := start
+						if i+1 < len(path) {
+							to = path[i+1]
+						}
+						cycle.Edges = append(cycle.Edges, env.LockOrder[[2]string{from, to}])
+					}
+					cycles = append(cycles, cycle)
+				case next > start && !onPath[next]:
+					visit(next)
+				}
+			}
+			path = path[:len(path)-1]
+			onPath[l] = false
+		}
+		visit(start)
+	}
+	return cycles
+}
@@ -1,12 +1,28 @@
 package migoinfer
 
-import "go.uber.org/zap"
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/tools/go/ssa"
+)
 
 // Logger encapsulates a Logger and module which it belongs to.
 // Use this through SetLogger() of visitor.
 type Logger struct {
 	*zap.SugaredLogger
 	module string
+
+	base      *zap.SugaredLogger // Logger without the fields of the function.
+	unfocused *zap.SugaredLogger // Logger of functions not in focus.
+	focus     string             // Functions in focus (by substring of name).
+}
+
+// NewLogger returns a new Logger, which logs the analysis of the functions
+// with name containing focus with l, and of other functions with unfocused.
+// All functions are in focus if focus is empty.
+func NewLogger(l, unfocused *zap.SugaredLogger, focus string) *Logger {
+	return &Logger{SugaredLogger: l, base: l, unfocused: unfocused, focus: focus}
 }
 
 type LogSetter interface {
@@ -17,3 +33,31 @@ type LogSetter interface {
 func (l *Logger) Module() string {
 	return l.module
 }
+
+// withModule returns a copy of l for module.
+func (l *Logger) withModule(module string) *Logger {
+	sub := *l
+	sub.module = module
+	return &sub
+}
+
+// withFunc returns a copy of l for module, with the package and function of
+// fn as context fields of the log entries.
+func (l *Logger) withFunc(module string, fn *ssa.Function) *Logger {
+	sub := l.withModule(module)
+	if sub.base == nil {
+		sub.base = l.SugaredLogger
+	}
+	if fn == nil {
+		return sub
+	}
+	base := sub.base
+	if sub.focus != "" && !strings.Contains(fn.String(), sub.focus) && sub.unfocused != nil {
+		base = sub.unfocused
+	}
+	if fn.Pkg != nil {
+		base = base.With("pkg", fn.Pkg.Pkg.Path())
+	}
+	sub.SugaredLogger = base.With("func", fn.String())
+	return sub
+}
@@ -0,0 +1,214 @@
+package migoinfer
+
+// Channels in map registries.
+//
+// Subscription systems store per-client channels in a map (as keys or
+// elements), and later range over the map to broadcast, e.g.
+//
+//	for ch := range subscribers {
+//		ch <- msg
+//	}
+//
+// A map is summarised as the set of distinct channels stored in it (see
+// maps.Map), and a value read from the map is any of them. Communication on a
+// value read from the map is emitted as an internal choice over the channels
+// in the map, and since it is in a loop, the loop body is replicated for each
+// of the channels, i.e. a replicated broadcast.
+//
+// Slices and arrays of channels are summarised in the same way, e.g. the
+// channels of
+//
+//	chans := []chan int{a, b}
+//	for _, ch := range chans {
+//		go drain(ch)
+//	}
+//
+// When a summary of several channels is passed to a function (as argument or
+// closure capture), the call (or spawn) is emitted as an internal choice over
+// the channels, each branch binding the argument to one channel. In a loop,
+// every iteration chooses a channel, which replicates the spawn for the
+// channels of the summary. This is sound for both per-loop and per-iteration
+// loop variables (i.e. before and after Go 1.22), since a captured loop
+// variable holds the summary in either case.
+//
+// Channels stored in the map after it is passed to a function are not visible
+// to the function.
+
+import (
+	"go/types"
+
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/maps"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// isChanMap returns true if t is a map with channel keys or elements, or a
+// slice or array (or pointer to array) of channels.
+func isChanMap(t types.Type) bool {
+	isChanType := func(t types.Type) bool {
+		_, ok := t.Underlying().(*types.Chan)
+		return ok
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Map:
+		return isChanType(t.Key()) || isChanType(t.Elem())
+	case *types.Slice:
+		return isChanType(t.Elem())
+	case *types.Array:
+		return isChanType(t.Elem())
+	case *types.Pointer:
+		if arr, ok := t.Elem().Underlying().(*types.Array); ok {
+			return isChanType(arr.Elem())
+		}
+	}
+	return false
+}
+
+// mapValue returns the value read from map m, which is the channel if there
+// is only one channel in the map, or the map itself otherwise.
+// The returned value is nil if the map is empty.
+func mapValue(m *maps.Map) store.Value {
+	switch len(m.Elems) {
+	case 0:
+		return nil
+	case 1:
+		return m.Elems[0]
+	}
+	return m
+}
+
+// putMapValue binds the value read from map m to k if k is a channel.
+func (v *Instruction) putMapValue(k store.Key, m *maps.Map) {
+	if val := mapValue(m); val != nil && isChan(k) {
+		v.Put(k, val)
+	}
+}
+
+// mapUpdate adds the channels in key and value (key is nil for slices) to the
+// map.
+func (v *Instruction) mapUpdate(m *maps.Map, key, value ssa.Value) {
+	for _, k := range []ssa.Value{key, value} {
+		if k == nil { // Slice element.
+			continue
+		}
+		if ch, ok := v.Get(k).(*chans.Chan); ok && isChan(k) {
+			if m.Add(ch) {
+				v.Debugf("%s Map %s ∋ %s", v.Module(), m.Name(), ch.UniqName())
+			}
+		}
+	}
+}
+
+// migoBroadcast returns an internal choice of stmt over every channel in map m
+// read as local.
+func (v *Instruction) migoBroadcast(local store.Key, m *maps.Map, stmt func(v *Instruction, local store.Key, ch store.Value) migo.Statement) []migo.Statement {
+	var branches [][]migo.Statement
+	for i, elem := range m.Elems {
+		ch, ok := elem.(*chans.Chan)
+		if !ok {
+			continue
+		}
+		body := *v
+		body.MiGo = migo.NewFunction(v.MiGo.SimpleName())
+		body.MiGo.AddStmts(stmt(&body, maps.Elem{Map: local, Index: i, T: ch.Type()}, ch))
+		branches = append(branches, body.MiGo.Stmts)
+	}
+	if len(branches) == 0 {
+		return nil
+	}
+	v.Debugf("%s Broadcast to %d channels of %s", v.Module(), len(branches), m.Name())
+	return migoChoice(branches)
+}
+
+// exportMap exports the channels in map m (parameter k) of the function.
+func (f *Function) exportMap(k store.Key, m *maps.Map) {
+	for i, elem := range m.Elems {
+		if ch, ok := elem.(*chans.Chan); ok {
+			ek := maps.Elem{Map: k, Index: i, T: ch.Type()}
+			f.Put(ek, ch)
+			f.Export(ek)
+			f.recordDir(ek)
+		}
+	}
+}
+
+// mapArgs returns the caller and callee names of the channels in map m passed
+// as arg to param.
+func (v *Instruction) mapArgs(arg, param store.Key, m *maps.Map) (args, params []store.Key) {
+	for i, elem := range m.Elems {
+		if ch, ok := elem.(*chans.Chan); ok {
+			argElem := maps.Elem{Map: arg, Index: i, T: ch.Type()}
+			v.Put(argElem, ch)
+			args = append(args, argElem)
+			params = append(params, maps.Elem{Map: param, Index: i, T: ch.Type()})
+		}
+	}
+	return args, params
+}
+
+// visitAppend adds the channels appended by call to append (to the summary of
+// the slice appended to).
+func (v *Instruction) visitAppend(call *ssa.Call) {
+	if !isChanMap(call.Type()) {
+		return
+	}
+	m, ok := v.Get(call.Call.Args[0]).(*maps.Map)
+	if !ok {
+		m = maps.New(v.Callee, call)
+	}
+	for _, arg := range call.Call.Args[1:] {
+		if elems, ok := v.Get(arg).(*maps.Map); ok {
+			for _, elem := range elems.Elems {
+				m.Add(elem)
+			}
+		}
+	}
+	v.Put(call, m)
+}
+
+// summaryArgs returns the channel arguments (and closure captures) of call c
+// of def which are summaries of several channels.
+func (v *Instruction) summaryArgs(c *ssa.CallCommon, def *funcs.Definition) []store.Key {
+	var keys []store.Key
+	for _, arg := range c.Args {
+		keys = append(keys, arg)
+	}
+	for _, binding := range def.Bindings() {
+		keys = append(keys, binding)
+	}
+	var summaries []store.Key
+	for _, k := range keys {
+		if m, ok := v.Get(k).(*maps.Map); ok && isChan(k) && len(m.Elems) > 1 {
+			summaries = append(summaries, k)
+		}
+	}
+	return summaries
+}
+
+// bindElems performs do with each of keys bound to one of the channels of its
+// summary, as an internal choice over the channels.
+func (v *Instruction) bindElems(keys []store.Key, do func(v *Instruction)) {
+	if len(keys) == 0 {
+		do(v)
+		return
+	}
+	k := keys[0]
+	m := v.Get(k).(*maps.Map)
+	var branches [][]migo.Statement
+	for _, elem := range m.Elems {
+		body := *v
+		body.MiGo = migo.NewFunction(v.MiGo.SimpleName())
+		v.Put(k, elem)
+		body.bindElems(keys[1:], do)
+		if body.MiGo.Stmts == nil {
+			body.MiGo.Stmts = []migo.Statement{}
+		}
+		branches = append(branches, body.MiGo.Stmts)
+	}
+	v.Put(k, m)
+	v.Debugf("%s Bind %s to %d channels of %s", v.Module(), k.Name(), len(branches), m.Name())
+	v.MiGo.AddStmts(migoChoice(branches)...)
+}
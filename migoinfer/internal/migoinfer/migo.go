@@ -10,8 +10,10 @@ import (
 
 	"github.com/nickng/gospal/callctx"
 	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/internal/timer"
 	"github.com/nickng/gospal/store"
 	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/maps"
 	"github.com/nickng/gospal/store/structs"
 	"github.com/nickng/migo"
 )
@@ -121,14 +123,11 @@ type freshNilChan struct {
 	typ   types.Type // Type of given nil chan.
 }
 
-func newFreshNilChan(t types.Type) freshNilChan {
-	defer func() { nextNilChan++ }()
-	return freshNilChan{count: nextNilChan, typ: t}
+func newFreshNilChan(env *Environment, t types.Type) freshNilChan {
+	defer func() { env.nilChans++ }()
+	return freshNilChan{count: env.nilChans, typ: t}
 }
 
-// nextNilChan keeps track of current count of unnamed fresh nilchan.
-var nextNilChan int
-
 func (n freshNilChan) Name() string     { return fmt.Sprintf("nil%d", n.count) }
 func (n freshNilChan) Pos() token.Pos   { return token.NoPos }
 func (n freshNilChan) Type() types.Type { return n.typ }
@@ -157,17 +156,30 @@ func timeChan(ch store.Key) bool {
 	return false
 }
 
-// migoRecv returns a Receive Statement in MiGo.
+// migoRecv returns a Receive Statement in MiGo, or a Timeout of a one-shot
+// timer.
 func migoRecv(v *Instruction, local store.Key, ch store.Value) migo.Statement {
-	if timeChan(local) {
+	if isOneShotTimer(ch) {
+		v.Debugf("%s migo recv name=%v (one-shot timer, timeout)", v.Module(), local)
+		if recv, ok := migoRecvChan(v, local, ch).(*migo.RecvStatement); ok {
+			v.MiGo.HasComm = true // Not a MiGo communication, kept by CleanUp.
+			return &timer.Timeout{Chan: recv.Chan}
+		}
+		return &migo.TauStatement{}
+	}
+	if timeChan(local) || isTickerChan(ch) {
 		v.Debugf("%s migo recv name=%v (time chan, replace with τ)", v.Module(), local)
 		return &migo.TauStatement{}
 	}
+	return migoRecvChan(v, local, ch)
+}
 
+// migoRecvChan returns a Receive Statement in MiGo of channel ch.
+func migoRecvChan(v *Instruction, local store.Key, ch store.Value) migo.Statement {
 	v.Debugf("%s migo recv name=%v, value=%s", v.Module(), local, ch.UniqName())
 	if c, ok := local.(*ssa.Const); ok {
 		if c.IsNil() {
-			nc := newFreshNilChan(local.Type())
+			nc := newFreshNilChan(v.Env, local.Type())
 			v.MiGo.AddStmts(migoNilChan(v, nc))
 			return &migo.RecvStatement{Chan: nc.Name()}
 		}
@@ -197,7 +209,7 @@ func migoSend(v *Instruction, local store.Key, ch store.Value) migo.Statement {
 	v.Debugf("%s migo send name=%v, value=%s", v.Module(), local, ch.UniqName())
 	if c, ok := local.(*ssa.Const); ok {
 		if c.IsNil() {
-			nc := newFreshNilChan(local.Type())
+			nc := newFreshNilChan(v.Env, local.Type())
 			v.MiGo.AddStmts(migoNilChan(v, nc))
 			return &migo.SendStatement{Chan: nc.Name()}
 		}
@@ -222,6 +234,45 @@ func migoSend(v *Instruction, local store.Key, ch store.Value) migo.Statement {
 	}
 }
 
+// migoClose returns a Close Statement in MiGo.
+//
+// The channel is marked closed for the operations analysed after the close
+// (see ChanOp). A range loop over the channel takes the termination branch if
+// the channel may be closed anywhere in the program (see mayClose), regardless
+// of the order of analysis. Receiving from a closed channel is not blocking in
+// MiGo, so the loop exit is reachable after the close.
+func migoClose(v *Instruction, local store.Key, ch store.Value) migo.Statement {
+	v.Debugf("%s migo close name=%v, value=%s", v.Module(), local, ch.UniqName())
+	if c, ok := local.(*ssa.Const); ok {
+		if c.IsNil() {
+			nc := newFreshNilChan(v.Env, local.Type())
+			v.MiGo.AddStmts(migoNilChan(v, nc))
+			return &migo.CloseStatement{Chan: nc.Name()}
+		}
+	}
+	if u, ok := local.(*ssa.UnOp); ok && u.Op == token.MUL { // Deref
+		// Use deref'd versions: u.X ⇒ local, v.Get(u.X) ⇒ ch instead.
+		local, ch = u.X, v.Get(u.X)
+	}
+	if c, ok := ch.(*chans.Chan); ok {
+		c.SetClosed()
+	}
+	switch exported := v.FindExported(v.Context, ch).(type) {
+	case Unexported:
+		v.Warnf("%s Channel %s/%s unavail. in current scope (unexported)\n\t%s",
+			v.Module(), local.Name(), ch.UniqName(), v.Env.getPos(local))
+		if _, isField := local.(structs.SField); !isField { // If not defined as a struct-field.
+			v.MiGo.AddStmts(migoNilChan(v, local))
+		}
+		return &migo.CloseStatement{Chan: local.Name()}
+	default:
+		// Channel exists and exported: this is the name we want to close.
+		v.Debugf("%s Close %s⇔%s ↦ %s\t%s",
+			v.Module(), local.Name(), exported.Name(), ch.UniqName(), local.Type())
+		return &migo.CloseStatement{Chan: exported.Name()}
+	}
+}
+
 // isDefinedMiGoName checks that given name is defined.
 //
 // The primary use of this function is for detecting nilchan within MiGo def.
@@ -268,7 +319,18 @@ func isDefinedMiGoName(v *Instruction, name store.Key) bool {
 func paramsToMigoParam(v *Instruction, fn *Function, call *funcs.Call) []*migo.Parameter {
 	// Converts an argument and a function parameter pair to migo Parameter.
 	convertToMigoParam := func(arg, param store.Key) *migo.Parameter {
-		switch ch := v.Get(arg).(type) {
+		if c, ok := arg.(*ssa.Const); ok && c.IsNil() {
+			nc := newFreshNilChan(v.Env, c.Type())
+			v.MiGo.AddStmts(migoNilChan(v, nc))
+			return &migo.Parameter{Caller: nc, Callee: param}
+		}
+		val := v.Get(arg)
+		if field, ok := arg.(structs.SField); ok && field.Key != nil && isUndefined(val) {
+			// Field of a struct argument (e.g. the receiver of a bound
+			// method): the value is stored under the field.
+			val = v.Get(field.Key)
+		}
+		switch ch := val.(type) {
 		case store.MockValue:
 			if _, isPhi := arg.(*ssa.Phi); isPhi {
 				v.Warnf("%s Undefined argument %s is Phi ⇔ %v",
@@ -300,6 +362,11 @@ func paramsToMigoParam(v *Instruction, fn *Function, call *funcs.Call) []*migo.P
 	for i, arg := range call.Parameters[:call.NParam()+call.NBind()] {
 		arg := underlying(arg)
 		param := underlying(call.Definition().Param(i))
+		if c, ok := arg.(*ssa.Const); ok && c.IsNil() && isStruct(arg) {
+			// Fields of a nil struct pointer cannot be used, e.g. the
+			// request passed to an HTTP handler (see nilArgs).
+			continue
+		}
 		if isStruct(arg) && isStruct(param) {
 			argStruct := v.Get(arg)
 			paramStruct := fn.Get(param)
@@ -324,6 +391,17 @@ func paramsToMigoParam(v *Instruction, fn *Function, call *funcs.Call) []*migo.P
 				case structs.SField:
 					if isChan(argField) {
 						migoParams = append(migoParams, convertToMigoParam(argField, paramFields[i]))
+						if ch, ok := v.Get(argField).(*chans.Chan); ok {
+							args, params := v.payloadArgs(argField, paramFields[i], ch)
+							for j := range args {
+								migoParams = append(migoParams, convertToMigoParam(args[j], params[j]))
+							}
+						}
+					} else if m, ok := v.Get(argField).(*maps.Map); ok {
+						args, params := v.mapArgs(argField, paramFields[i], m)
+						for j := range args {
+							migoParams = append(migoParams, convertToMigoParam(args[j], params[j]))
+						}
 					}
 				case *structs.Struct:
 					// Ignore.
@@ -336,13 +414,47 @@ func paramsToMigoParam(v *Instruction, fn *Function, call *funcs.Call) []*migo.P
 		}
 		if isChan(arg) {
 			migoParams = append(migoParams, convertToMigoParam(arg, call.Definition().Param(i)))
+			if ch, ok := v.Get(arg).(*chans.Chan); ok {
+				args, params := v.payloadArgs(arg, call.Definition().Param(i), ch)
+				for j := range args {
+					migoParams = append(migoParams, convertToMigoParam(args[j], params[j]))
+				}
+			}
+		}
+		if m, ok := v.Get(arg).(*maps.Map); ok {
+			args, params := v.mapArgs(arg, call.Definition().Param(i), m)
+			for j := range args {
+				migoParams = append(migoParams, convertToMigoParam(args[j], params[j]))
+			}
+		}
+		if closure, ok := v.Get(arg).(*funcs.Definition); ok {
+			// Closure argument (or captured closure): pass its captured
+			// channels along.
+			for _, binding := range closure.Bindings() {
+				if isChan(binding) {
+					migoParams = append(migoParams, convertToMigoParam(binding, binding))
+				}
+			}
 		}
 	}
 	// Convert return value.
+	// A returned channel is created by the caller, and passed to the callee
+	// if the callee uses it, e.g. a pipeline stage which spawns a goroutine
+	// sending on the returned channel.
 	for i, param := range call.Parameters[call.NParam()+call.NBind():] {
 		if isChan(param) {
 			migoParam := &migo.Parameter{Caller: param, Callee: call.Definition().Return(i)}
-			if exported := fn.FindExported(fn.Context, fn.Get(call.Definition().Return(i))); exported != nil {
+			exported := fn.FindExported(fn.Context, fn.Get(call.Definition().Return(i)))
+			if _, ok := exported.(Unexported); ok {
+				continue // Channel not used by callee.
+			}
+			if ch, ok := v.Get(param).(*chans.Chan); ok {
+				name := v.FindExported(v.Context, ch)
+				if _, ok := name.(Unexported); !ok {
+					migoParam.Caller = name // e.g. channel returned by accessor.
+				}
+			}
+			if exported != nil {
 				migoParam.Callee = exported
 				for j := range migoParams {
 					if migoParams[j].Callee.Name() == exported.Name() {
@@ -0,0 +1,237 @@
+package migoinfer
+
+// Channel misuse checks.
+//
+// The operations on channels are recorded during inference with the channel
+// (store value) they operate on, so operations through different aliases of
+// a channel (e.g. a parameter and a struct field) are on the same channel.
+// FindChanMisuses reports
+//
+//   - double close: a channel closed twice, i.e. closed by two different
+//     operations (or function contexts) unless they are exclusive branches of
+//     the same function,
+//   - send on closed: a send which may follow a close of the channel, i.e.
+//     reachable from the close in the same function, or in another function
+//     analysed after the close,
+//   - close by receiver: a channel closed by a function which only receives
+//     from it while others send to it, i.e. closed from its receive-only
+//     endpoint, and
+//   - receive from silent channel: a receive from a channel which is never
+//     sent to or closed in the program.
+//
+// The aliasing evidence of a report are the other operations on the channel,
+// with the local names of the channel.
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/internal/intern"
+	"github.com/nickng/gospal/store/chans"
+	"golang.org/x/tools/go/ssa"
+)
+
+// ChanOp is an operation on a channel recorded during inference.
+type ChanOp struct {
+	Op     opKind
+	Pos    token.Pos
+	Local  ssa.Value // Name of the channel at the operation.
+	Def    string    // MiGo definition of the operation.
+	Closed bool      // Channel was closed when the operation was analysed.
+	instr  ssa.Instruction
+}
+
+// ChanMisuse is a misuse of a channel.
+type ChanMisuse struct {
+	Kind     string   // Kind of misuse, e.g. "double close".
+	Pos      string   // Position of the operation.
+	Chan     string   // Channel.
+	Message  string   // Description of the misuse.
+	Evidence []string // Other operations on the channel (aliases).
+}
+
+func (m ChanMisuse) String() string {
+	pos := m.Pos
+	if pos == "" {
+		pos = "-"
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %s: %s", pos, m.Kind, m.Message)
+	for _, e := range m.Evidence {
+		fmt.Fprintf(&buf, "\n\t%s", e)
+	}
+	return buf.String()
+}
+
+// recordChanOp records the operation op of instr (at pos) on channel local.
+func (v *Instruction) recordChanOp(op opKind, instr ssa.Instruction, pos token.Pos, local ssa.Value) {
+	ch, ok := v.Get(local).(*chans.Chan)
+	if !ok {
+		return
+	}
+	if !pos.IsValid() {
+		pos = instr.Pos()
+	}
+	v.Env.ChanOps[ch] = append(v.Env.ChanOps[ch], &ChanOp{
+		Op:     op,
+		Pos:    pos,
+		Local:  local,
+		Def:    v.MiGo.SimpleName(),
+		Closed: ch.IsClosed(),
+		instr:  instr,
+	})
+}
+
+// callInstr returns the call instruction of c.
+func callInstr(c *ssa.CallCommon) ssa.CallInstruction {
+	for _, arg := range c.Args {
+		refs := arg.Referrers()
+		if refs == nil {
+			continue
+		}
+		for _, instr := range *refs {
+			if call, ok := instr.(ssa.CallInstruction); ok && call.Common() == c {
+				return call
+			}
+		}
+	}
+	return nil
+}
+
+// fnName returns the name of the function (context) of the operation, i.e.
+// the MiGo definition without the block index.
+func (op *ChanOp) fnName() string {
+	if i := strings.Index(op.Def, "#"); i >= 0 {
+		return op.Def[:i]
+	}
+	return op.Def
+}
+
+// opPos returns a string representation of the position of op.
+func (env *Environment) opPos(op *ChanOp) string {
+	return intern.String(env.Info.FSet.Position(op.Pos).String())
+}
+
+// after returns true if instruction b may execute after instruction a in the
+// same invocation of their function.
+func after(a, b ssa.Instruction) bool {
+	if a.Block() != b.Block() {
+		return reaches(a.Block(), b.Block())
+	}
+	for _, instr := range a.Block().Instrs {
+		if instr == a {
+			return true // b is after a, or a loop.
+		}
+		if instr == b {
+			break
+		}
+	}
+	return reaches(a.Block(), a.Block())
+}
+
+// FindChanMisuses returns the misuses of the channels operated on during
+// inference.
+func FindChanMisuses(env *Environment) []ChanMisuse {
+	var misuses []ChanMisuse
+	for ch, ops := range env.ChanOps {
+		misuses = append(misuses, chanMisuses(env, ch, ops)...)
+	}
+	sort.SliceStable(misuses, func(i, j int) bool {
+		if misuses[i].Pos != misuses[j].Pos {
+			return misuses[i].Pos < misuses[j].Pos
+		}
+		return misuses[i].Kind < misuses[j].Kind
+	})
+	return misuses
+}
+
+// chanMisuses returns the misuses of channel ch with operations ops.
+func chanMisuses(env *Environment, ch *chans.Chan, ops []*ChanOp) []ChanMisuse {
+	var misuses []ChanMisuse
+	name := ch.Value.Name()
+	if pos := ch.Value.Pos(); pos.IsValid() {
+		name = fmt.Sprintf("%s (created at %s)", name, env.getPos(ch.Value))
+	}
+	evidence := func(except *ChanOp) []string {
+		var ev []string
+		seen := make(map[string]bool)
+		for _, op := range ops {
+			if op == except {
+				continue
+			}
+			e := fmt.Sprintf("%s: %s via %s in %s", env.opPos(op), op.Op, op.Local.Name(), op.fnName())
+			if !seen[e] {
+				seen[e] = true
+				ev = append(ev, e)
+			}
+		}
+		return ev
+	}
+	report := func(kind string, op *ChanOp, format string, args ...interface{}) {
+		misuses = append(misuses, ChanMisuse{
+			Kind:     kind,
+			Pos:      env.opPos(op),
+			Chan:     ch.UniqName(),
+			Message:  fmt.Sprintf(format, args...),
+			Evidence: evidence(op),
+		})
+	}
+	var closes, sends, recvs []*ChanOp
+	senders := make(map[string]bool)
+	receivers := make(map[string]bool)
+	for _, op := range ops {
+		switch op.Op {
+		case opClose:
+			closes = append(closes, op)
+		case opSend:
+			sends = append(sends, op)
+			senders[op.fnName()] = true
+		case opRecv:
+			recvs = append(recvs, op)
+			receivers[op.fnName()] = true
+		}
+	}
+	// Double close.
+	reported := make(map[*ChanOp]bool)
+	for i, a := range closes {
+		for _, b := range closes[i+1:] {
+			if reported[b] || a.Pos == b.Pos && a.fnName() == b.fnName() {
+				continue
+			}
+			sameFn := a.fnName() == b.fnName() && a.instr.Parent() == b.instr.Parent()
+			if sameFn && !after(a.instr, b.instr) && !after(b.instr, a.instr) {
+				continue // Exclusive branches.
+			}
+			reported[b] = true
+			report("double close", b, "channel %s may be closed twice (also closed at %s)", name, env.opPos(a))
+		}
+	}
+	// Send on closed.
+	for _, s := range sends {
+		for _, c := range closes {
+			sameFn := s.fnName() == c.fnName() && s.instr.Parent() == c.instr.Parent()
+			if sameFn && after(c.instr, s.instr) || !sameFn && s.Closed {
+				report("send on closed", s, "send on channel %s which may be closed at %s", name, env.opPos(c))
+				break
+			}
+		}
+	}
+	// Close by receiver.
+	for _, c := range closes {
+		fn := c.fnName()
+		if receivers[fn] && !senders[fn] && len(sends) > 0 {
+			report("close by receiver", c, "channel %s closed by %s which only receives from it", name, fn)
+		}
+	}
+	// Receive from channel never sent to or closed.
+	if len(sends) == 0 && len(closes) == 0 && !ch.IsTimer() && !env.signals[ch] {
+		if _, ok := ch.Value.(*ssa.MakeChan); ok {
+			for _, r := range recvs {
+				report("recv never sent", r, "receive from channel %s which is never sent to or closed", name)
+			}
+		}
+	}
+	return misuses
+}
@@ -0,0 +1,108 @@
+package migoinfer
+
+// Behavioural models of library functions.
+//
+// A Model is a summary of the communication behaviour of a library function,
+// used in place of analysing the function body. Library entry points such as
+// net/http servers spawn goroutines (or communicate internally) in ways that
+// cannot be inferred precisely from their implementation, and analysing their
+// bodies produces large but uninformative MiGo definitions.
+//
+// The default models are in DefaultModels; the models used by an analysis are
+// in Environment.Models, which can be changed (e.g. removed, so the function
+// body is analysed instead) before the analysis starts.
+
+import "golang.org/x/tools/go/ssa"
+
+// A Model is a behavioural summary of a library function. It is called in
+// place of the function at call site c, and returns true if the call is fully
+// handled (i.e. the callee should not be analysed).
+// The return value ret is nil if the call is not an *ssa.Call (e.g. deferred).
+type Model func(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool
+
+// NoComm is the Model of a function which does not communicate, e.g. blocking
+// I/O or functions which only use goroutines internally.
+func NoComm(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool {
+	v.Debugf("%s Model %s: no communication", v.Module(), c)
+	return true
+}
+
+// DefaultModels returns the builtin models of standard library functions,
+// keyed by the full function name (see ssa.Function.String).
+func DefaultModels() map[string]Model {
+	models := map[string]Model{
+		// net/http handler registration and servers.
+		"net/http.Handle":                      httpHandle,
+		"net/http.HandleFunc":                  httpHandle,
+		"(*net/http.ServeMux).Handle":          httpHandle,
+		"(*net/http.ServeMux).HandleFunc":      httpHandle,
+		"net/http.ListenAndServe":              httpServe,
+		"net/http.ListenAndServeTLS":           httpServe,
+		"net/http.Serve":                       httpServe,
+		"net/http.ServeTLS":                    httpServe,
+		"(*net/http.Server).ListenAndServe":    httpServe,
+		"(*net/http.Server).ListenAndServeTLS": httpServe,
+		"(*net/http.Server).Serve":             httpServe,
+		"(*net/http.Server).ServeTLS":          httpServe,
+		"(*net/http.Server).Shutdown":          NoComm,
+		"(*net/http.Server).Close":             NoComm,
+		// os/signal.
+		"os/signal.Notify": signalNotify,
+		"os/signal.Stop":   NoComm,
+		"os/signal.Ignore": NoComm,
+		"os/signal.Reset":  NoComm,
+		// reflect.
+		"reflect.Select": reflectSelect,
+		// sync mutexes (see locks.go).
+		"(*sync.Mutex).Lock":      lockModel(true),
+		"(*sync.Mutex).Unlock":    lockModel(false),
+		"(*sync.RWMutex).Lock":    lockModel(true),
+		"(*sync.RWMutex).Unlock":  lockModel(false),
+		"(*sync.RWMutex).RLock":   lockModel(true),
+		"(*sync.RWMutex).RUnlock": lockModel(false),
+	}
+	// Functions which communicate (or spawn goroutines) internally only, e.g.
+	// HTTP clients (including timeouts), subprocesses and buffered I/O.
+	for _, name := range []string{
+		"net/http.Get",
+		"net/http.Head",
+		"net/http.Post",
+		"net/http.PostForm",
+		"(*net/http.Client).Do",
+		"(*net/http.Client).Get",
+		"(*net/http.Client).Head",
+		"(*net/http.Client).Post",
+		"(*net/http.Client).PostForm",
+		"(*os/exec.Cmd).Start",
+		"(*os/exec.Cmd).Wait",
+		"(*os/exec.Cmd).Run",
+		"(*os/exec.Cmd).Output",
+		"(*os/exec.Cmd).CombinedOutput",
+		"(*bufio.Scanner).Scan",
+		"(*bufio.Reader).ReadString",
+		"(*bufio.Reader).ReadBytes",
+		"(*bufio.Reader).ReadLine",
+		"net.Listen",
+		"net.Dial",
+		"net.DialTimeout",
+	} {
+		models[name] = NoComm
+	}
+	return models
+}
+
+// visitModel handles calls to functions with a Model, and returns true if the
+// call is fully handled (i.e. the callee should not be analysed).
+func (v *Instruction) visitModel(c *ssa.CallCommon, ret ssa.Value) bool {
+	fn := c.StaticCallee()
+	if fn == nil || fn.Pkg == nil {
+		return false
+	}
+	if model, ok := v.Env.Models[fn.String()]; ok {
+		return model(v, c, ret)
+	}
+	if v.Env.Filter != nil && !v.Env.Filter.Selects(fn, v.Env.Info.FSet) {
+		return NoComm(v, c, ret)
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package migoinfer
+
+// Handling of operations on nil channels.
+//
+// A channel which is definitely nil (i.e. the nil constant, or a variable
+// assigned the nil constant) blocks forever on send and receive, so the rest
+// of the function is unreachable after the operation. A select case on a nil
+// channel is never selected, which is used deliberately to disable cases, so
+// the case is removed from the select.
+//
+// Channels which are possibly nil (e.g. an uninitialised struct field) are
+// represented by a nilchan in MiGo, but are otherwise treated as ordinary
+// channels.
+
+import (
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// isNilChan returns true if the channel local is definitely nil.
+func (v *Instruction) isNilChan(local ssa.Value) bool {
+	if c, ok := local.(*ssa.Const); ok {
+		return c.IsNil()
+	}
+	if c, ok := v.Get(local).(store.Const); ok {
+		return c.IsNil()
+	}
+	return false
+}
+
+// blockNilChan terminates the current definition after an operation on the
+// nil channel local, which blocks forever.
+func (v *Instruction) blockNilChan(local ssa.Value) {
+	if v.isNilChan(local) {
+		v.Debugf("%s Operation on nil channel %s blocks forever\n\t%s",
+			v.Module(), local.Name(), v.Env.getPos(local))
+		v.exited = true
+	}
+}
+
+// removeNilCases removes the cases of select statement stmt which are on nil
+// channels. If all cases of a blocking select are removed, the select blocks
+// forever and is replaced by a receive on a nil channel.
+func (v *Instruction) removeNilCases(sel *ssa.Select, stmt *migo.SelectStatement) migo.Statement {
+	var cases [][]migo.Statement
+	for i, c := range stmt.Cases {
+		if i < len(sel.States) && v.isNilChan(sel.States[i].Chan) {
+			v.Debugf("%s Select case #%d on nil channel removed", v.Module(), i)
+			continue
+		}
+		cases = append(cases, c)
+	}
+	if len(cases) == 0 {
+		v.Debugf("%s Select on nil channels blocks forever\n\t%s", v.Module(), v.Env.getPos(sel))
+		nc := newFreshNilChan(v.Env, sel.States[0].Chan.Type())
+		v.MiGo.AddStmts(migoNilChan(v, nc))
+		v.exited = true
+		return &migo.RecvStatement{Chan: nc.Name()}
+	}
+	stmt.Cases = cases
+	return stmt
+}
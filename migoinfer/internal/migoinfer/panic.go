@@ -0,0 +1,85 @@
+package migoinfer
+
+// Handling of panic and functions that do not return.
+//
+// A panic terminates the current definition after running the deferred calls
+// (see runDefers). A call to a function that never returns normally (i.e. no
+// return of its body is reachable, or it exits the program) also terminates
+// the caller, so the communication after the call is not included.
+//
+// Recover is approximated: a function with deferred calls may recover from a
+// panic, and in that case returns normally via its recover block (ssa
+// Function.Recover). Such functions are treated as returning, regardless of
+// whether the deferred calls actually call recover().
+
+import "golang.org/x/tools/go/ssa"
+
+// exitFuncs are functions which do not return to the caller.
+var exitFuncs = map[string]bool{
+	"os.Exit":        true,
+	"runtime.Goexit": true,
+	"log.Fatal":      true,
+	"log.Fatalf":     true,
+	"log.Fatalln":    true,
+}
+
+// noReturn returns true if a call to fn never returns to the caller, i.e. fn
+// exits, or no return of fn is reachable without calling a function which
+// does not return (e.g. a helper calling log.Fatal). The results are
+// memoised, and fn is assumed to return while its body is visited (e.g. by
+// recursive calls).
+func (env *Environment) noReturn(fn *ssa.Function) bool {
+	if fn == nil {
+		return false
+	}
+	if fn.Pkg != nil && fn.Signature.Recv() == nil {
+		if exitFuncs[fn.Pkg.Pkg.Path()+"."+fn.Name()] {
+			return true
+		}
+	}
+	if len(fn.Blocks) == 0 || fn.Recover != nil {
+		return false // No body, assume it returns, or it may recover.
+	}
+	if env.noReturns == nil {
+		env.noReturns = make(map[*ssa.Function]bool)
+	}
+	if noRet, ok := env.noReturns[fn]; ok {
+		return noRet
+	}
+	env.noReturns[fn] = false
+	noRet := !env.reachesReturn(fn)
+	env.noReturns[fn] = noRet
+	return noRet
+}
+
+// reachesReturn returns true if a return of fn is reachable from its entry
+// block without calling a function which does not return.
+func (env *Environment) reachesReturn(fn *ssa.Function) bool {
+	visited := make(map[*ssa.BasicBlock]bool)
+	blocks := []*ssa.BasicBlock{fn.Blocks[0]}
+	for len(blocks) > 0 {
+		blk := blocks[len(blocks)-1]
+		blocks = blocks[:len(blocks)-1]
+		if visited[blk] || env.exits(blk) {
+			continue
+		}
+		visited[blk] = true
+		if len(blk.Instrs) > 0 {
+			if _, ok := blk.Instrs[len(blk.Instrs)-1].(*ssa.Return); ok {
+				return true
+			}
+		}
+		blocks = append(blocks, blk.Succs...)
+	}
+	return false
+}
+
+// exits returns true if blk calls a function which does not return.
+func (env *Environment) exits(blk *ssa.BasicBlock) bool {
+	for _, instr := range blk.Instrs {
+		if call, ok := instr.(*ssa.Call); ok && env.noReturn(call.Common().StaticCallee()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package migoinfer
+
+// Channels sent over channels.
+//
+// In request/reply patterns, a channel (or a struct with a channel field) is
+// sent over another channel, and the receiver communicates on the channel
+// received, e.g.
+//
+//	func server(requests chan chan int) {
+//		reply := <-requests
+//		reply <- 42
+//	}
+//
+// A MiGo definition can only communicate on the channels of its parameters,
+// and the reply channel is usually created after the server is spawned. The
+// channels which may be sent over a channel (its payloads, see
+// chanFlow.payloads) are created with the channel instead (similar to channels
+// of package variables, see globals.go), and passed along with the channel
+// as extra parameters (named by chans.Payload), so the receiver binds the
+// value received to the payloads regardless of the order of analysis. The
+// creation of a payload channel is then skipped (τ) if the channel created
+// with the carrier is in scope.
+//
+// A value received is any of the payloads of the channel. Communication on a
+// value with several payloads is an internal choice over the payloads (see
+// maps.go). Channels created in a loop are created once for all iterations.
+
+import (
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/maps"
+	"github.com/nickng/gospal/store/structs"
+	"golang.org/x/tools/go/ssa"
+)
+
+// createPayloads creates the payload channels of channel ch (created by mkch)
+// which are not created yet in the current scope.
+func (v *Instruction) createPayloads(mkch *ssa.MakeChan, ch *chans.Chan) {
+	var payloads []store.Value
+	for i, p := range v.Env.chanFlow().payloads(mkch) {
+		k := chans.Payload{Chan: mkch, Index: i, T: p.Chan.Type()}
+		pch, ok := v.Get(p.Chan).(*chans.Chan)
+		if !ok || p.Chan.Parent() != mkch.Parent() {
+			pch = chans.New(ch, p.Chan, v.bufSize(p.Chan))
+			v.Env.Chans[pch.UniqName()] = v.Env.getPos(p.Chan)
+			v.Env.hoisted[p.Chan] = append(v.Env.hoisted[p.Chan], pch)
+			v.Debugf("%s Payload %s of %s created with %s",
+				v.Module(), p.Chan.Name(), mkch.Name(), pch.UniqName())
+			v.MiGo.AddStmts(migoNewChan(v.Logger, k, pch))
+		}
+		v.Put(k, pch)
+		v.Export(k)
+		payloads = append(payloads, pch)
+	}
+	ch.SetPayloads(payloads)
+}
+
+// createdPayload returns the channel created for mkch with its carrier (see
+// createPayloads) if the channel is in scope.
+func (v *Instruction) createdPayload(mkch *ssa.MakeChan) (*chans.Chan, bool) {
+	for _, ch := range v.Env.hoisted[mkch] {
+		if !isUnexported(v.FindExported(v.Context, ch)) {
+			return ch, true
+		}
+	}
+	return nil, false
+}
+
+// bindPayload binds the received value recv to the payloads of channel ch, so
+// that channels sent over channels keep their identity.
+func (v *Instruction) bindPayload(recv ssa.Value, ch ssa.Value) {
+	c, ok := v.Get(ch).(*chans.Chan)
+	if !ok || len(c.Payloads()) == 0 {
+		return
+	}
+	mkch, ok := c.Value.(*ssa.MakeChan)
+	if !ok {
+		return
+	}
+	fields := make(map[int][]store.Value)
+	for i, p := range v.Env.chanFlow().payloads(mkch) {
+		fields[p.Field] = append(fields[p.Field], c.Payloads()[i])
+	}
+	if vals, ok := fields[-1]; ok {
+		v.Debugf("%s Receive %d payloads from %s", v.Module(), len(vals), c.UniqName())
+		v.Put(recv, payloadValue(v, recv, vals))
+		return
+	}
+	s := structs.New(v.Callee, recv)
+	if s == nil {
+		return
+	}
+	for field, vals := range fields {
+		var key store.Key = structs.SField{Struct: s, Index: field}
+		if len(vals) == 1 {
+			// Name the field by the payload in scope, so the field is not
+			// exported under a new name (see VisitFieldAddr).
+			if exported := v.FindExported(v.Context, vals[0]); !isUnexported(exported) {
+				key = exported
+			}
+		}
+		s.Fields[field] = key
+		v.Put(key, payloadValue(v, recv, vals))
+	}
+	v.Debugf("%s Receive struct with payloads from %s", v.Module(), c.UniqName())
+	v.Put(recv, s)
+}
+
+// payloadValue returns the value received by recv as one of the channels vals,
+// i.e. the channel if there is only one, or else a summary of the channels.
+func payloadValue(v *Instruction, recv ssa.Value, vals []store.Value) store.Value {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	m := maps.New(v.Callee, recv)
+	for _, val := range vals {
+		m.Add(val)
+	}
+	return m
+}
+
+// payloadArgs returns the caller and callee names of the payloads of channel
+// ch passed as arg to param.
+func (v *Instruction) payloadArgs(arg, param store.Key, ch *chans.Chan) (args, params []store.Key) {
+	for i, p := range ch.Payloads() {
+		if p, ok := p.(*chans.Chan); ok {
+			argPayload := chans.Payload{Chan: arg, Index: i, T: p.Type()}
+			v.Put(argPayload, p)
+			args = append(args, argPayload)
+			params = append(params, chans.Payload{Chan: param, Index: i, T: p.Type()})
+		}
+	}
+	return args, params
+}
+
+// exportPayloads exports the payloads of channel ch (parameter k) of the
+// function.
+func (f *Function) exportPayloads(k store.Key, ch *chans.Chan) {
+	for i, p := range ch.Payloads() {
+		if p, ok := p.(*chans.Chan); ok {
+			pk := chans.Payload{Chan: k, Index: i, T: p.Type()}
+			f.Put(pk, p)
+			f.Export(pk)
+			f.recordDir(pk)
+		}
+	}
+}
+
+// isUnexported returns true if k is not an exported name (see FindExported).
+func isUnexported(k store.Key) bool {
+	_, ok := k.(Unexported)
+	return ok
+}
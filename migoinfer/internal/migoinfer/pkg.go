@@ -2,7 +2,6 @@ package migoinfer
 
 import (
 	"github.com/fatih/color"
-	"github.com/nickng/gospal/callctx"
 	"github.com/nickng/gospal/funcs"
 	"golang.org/x/tools/go/ssa"
 )
@@ -36,7 +35,7 @@ func (p *Package) InitGlobals(pkg *ssa.Package) {
 func (p *Package) VisitInit(pkg *ssa.Package) {
 	if initFn := pkg.Func("init"); initFn != nil {
 		initDef := funcs.MakeCall(funcs.MakeDefinition(initFn), nil, nil)
-		fn := NewFunction(initDef, callctx.Toplevel(), p.Env)
+		fn := NewFunction(initDef, p.Env.Toplevel, p.Env)
 		fn.SetLogger(p.Logger)
 		fn.EnterFunc(initDef.Function())
 		return
@@ -46,8 +45,5 @@ func (p *Package) VisitInit(pkg *ssa.Package) {
 
 // SetLogger sets logger for Package.
 func (p *Package) SetLogger(l *Logger) {
-	p.Logger = &Logger{
-		SugaredLogger: l.SugaredLogger,
-		module:        color.BlueString("pkg  "),
-	}
+	p.Logger = l.withModule(color.BlueString("pkg  "))
 }
@@ -0,0 +1,87 @@
+package migoinfer
+
+// Plugins.
+//
+// A Hook handles SSA instructions in place of the builtin visitor, e.g. the
+// calls of a concurrency library which is not in the standard library. Hooks
+// are registered in Environment.Hooks, and tried in order before the builtin
+// handling of each instruction, except control flow instructions (Jump, If,
+// Return and Phi), which are handled by the Block visitor. The methods of
+// Instruction below give hooks access to the channels of the current context
+// and emit MiGo statements, so the channel operations emitted are checked like
+// builtin ones.
+
+import (
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// A Hook handles instruction instr, and returns true if the instruction is
+// fully handled (i.e. the builtin visitor should not visit instr).
+type Hook func(v *Instruction, instr ssa.Instruction) bool
+
+// visitHooks tries the hooks of the environment on instr, and returns true if
+// instr is handled by a hook.
+func (v *Instruction) visitHooks(instr ssa.Instruction) bool {
+	for _, hook := range v.Env.Hooks {
+		if hook(v, instr) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewChan binds value to a new channel with buffer size, created by instr
+// (e.g. a call returning the channel), and emits its creation.
+func (v *Instruction) NewChan(instr ssa.Instruction, value ssa.Value, size int64) {
+	ch := chans.New(v.Callee, value, size)
+	v.Env.Chans[ch.UniqName()] = v.Env.getPos(instr)
+	if updater, ok := v.Context.(callctx.Updater); ok {
+		updater.PutUniq(value, ch)
+	} else {
+		v.Fatal("Cannot update context")
+	}
+	v.Export(value)
+	v.MiGo.AddStmts(migoNewChan(v.Logger, value, ch))
+}
+
+// EmitSend emits a send on channel ch by instr.
+func (v *Instruction) EmitSend(instr ssa.Instruction, ch ssa.Value) {
+	v.recordChanOp(opSend, instr, instr.Pos(), ch)
+	v.MiGo.AddStmts(migoSend(v, ch, v.Get(ch)))
+}
+
+// EmitRecv emits a receive from channel ch by instr.
+func (v *Instruction) EmitRecv(instr ssa.Instruction, ch ssa.Value) {
+	v.recordChanOp(opRecv, instr, instr.Pos(), ch)
+	v.MiGo.AddStmts(migoRecv(v, ch, v.Get(ch)))
+}
+
+// EmitClose emits a close of channel ch by instr.
+func (v *Instruction) EmitClose(instr ssa.Instruction, ch ssa.Value) {
+	v.recordChanOp(opClose, instr, instr.Pos(), ch)
+	v.MiGo.AddStmts(migoClose(v, ch, v.Get(ch)))
+}
+
+// Emit emits MiGo statements in the current definition.
+func (v *Instruction) Emit(stmts ...migo.Statement) {
+	v.MiGo.AddStmts(stmts...)
+}
+
+// Pos returns the source position of p.
+func (v *Instruction) Pos(p Poser) string {
+	return v.Env.getPos(p)
+}
+
+// Spawn spawns function value fn with args as a goroutine, e.g. a callback
+// run in a goroutine by a library function.
+func (v *Instruction) Spawn(fn ssa.Value, args ...ssa.Value) {
+	common := v.unbind(&ssa.CallCommon{Value: fn, Args: args})
+	def := v.createDefinition(common)
+	if def == nil {
+		return
+	}
+	v.doGo(common, def)
+}
@@ -0,0 +1,106 @@
+package migoinfer
+
+// Recognition of worker pools.
+//
+// A worker pool is a for-loop which only spawns a worker, where the worker
+// ranges over a channel parameter (the jobs channel), e.g.
+//
+//   for w := 0; w < n; w++ {
+//       go worker(jobs, results)
+//   }
+//
+// Instead of emitting the loop (which unrolls the spawns up to the loop bound
+// in a verifier), the loop is emitted as a call to a replicated process which
+// spawns the worker and nondeterministically spawns more, i.e.
+//
+//   def pool(jobs, results): spawn worker(jobs, results); if call pool(jobs, results) else endif;
+//
+// The number of workers is therefore a parameter of the model (at least one).
+
+import (
+	"go/token"
+
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/internal/intern"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// poolFuncs holds the replicated process of each worker pool, keyed by the
+// for-loop header block of the pool.
+type poolFuncs map[*ssa.BasicBlock]*migo.Function
+
+// workerPool returns the for-loop header block if g spawns the worker of a
+// worker pool, or nil otherwise.
+func workerPool(g *ssa.Go, worker *ssa.Function) *ssa.BasicBlock {
+	body := g.Block()
+	if body.Comment != "for.body" || len(body.Preds) != 1 || body.Preds[0].Comment != "for.loop" {
+		return nil
+	}
+	for _, instr := range body.Instrs {
+		switch instr := instr.(type) {
+		case *ssa.Go:
+			if instr != g {
+				return nil
+			}
+		case *ssa.Call, *ssa.Send, *ssa.Select, *ssa.Defer, *ssa.Panic:
+			return nil
+		case *ssa.UnOp:
+			if instr.Op == token.ARROW {
+				return nil
+			}
+		}
+	}
+	if !rangesOverParam(worker) {
+		return nil
+	}
+	return body.Preds[0]
+}
+
+// rangesOverParam returns true if fn ranges over a channel parameter.
+func rangesOverParam(fn *ssa.Function) bool {
+	if fn == nil {
+		return false
+	}
+	for _, blk := range fn.Blocks {
+		if blk.Comment != "rangechan.loop" {
+			continue
+		}
+		for _, instr := range blk.Instrs {
+			if recv, ok := instr.(*ssa.UnOp); ok && recv.Op == token.ARROW {
+				if _, ok := recv.X.(*ssa.Parameter); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// doPool spawns the worker in the replicated process of the worker pool with
+// for-loop header hdr.
+func (v *Instruction) doPool(hdr *ssa.BasicBlock, c *ssa.CallCommon, def *funcs.Definition) {
+	poolFn := migo.NewFunction(intern.Sprintf("%s#%d_pool", v.Callee.Name(), hdr.Index))
+	body := *v
+	body.MiGo = poolFn
+	body.doGo(c, def)
+
+	again := &migo.CallStatement{Name: poolFn.Name}
+	for _, name := range v.Exported.names {
+		poolFn.AddParams(&migo.Parameter{Caller: name, Callee: name})
+		again.AddParams(&migo.Parameter{Caller: name, Callee: name})
+	}
+	poolFn.AddStmts(&migo.IfStatement{Then: []migo.Statement{again}, Else: []migo.Statement{}})
+	v.Debugf("%s Worker pool %s", v.Module(), poolFn.SimpleName())
+	v.Env.addFunction(poolFn)
+	v.pools[hdr] = poolFn
+}
+
+// migoPool returns a 'call' to the replicated process of a worker pool.
+func migoPool(poolFn *migo.Function) migo.Statement {
+	stmt := &migo.CallStatement{Name: poolFn.Name}
+	for _, param := range poolFn.Params {
+		stmt.AddParams(&migo.Parameter{Caller: param.Caller, Callee: param.Callee})
+	}
+	return stmt
+}
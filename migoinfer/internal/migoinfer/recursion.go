@@ -0,0 +1,95 @@
+package migoinfer
+
+// Handling of recursive function calls.
+//
+// A recursive call is not analysed by entering the function again (which
+// would unfold the recursion), but emitted as a call to the MiGo definition
+// of the function being analysed. The recursive MiGo definition is then the
+// fixpoint of the function behaviour.
+//
+// Mutually recursive functions (i.e. functions in the same strongly connected
+// component of the callgraph) are handled the same way: a call to a function
+// already on the call stack is emitted as a call to its MiGo definition, so
+// the definitions of the component refer to each other.
+//
+// The definitions are not analysed again until a fixpoint: a recursive call
+// refers to the MiGo definition by name, so the behaviour of the recursion is
+// the fixpoint of the MiGo definitions, not of an analysis summary. The facts
+// which would depend on the order of analysis (e.g. channels sent over or
+// closed by a later call of the recursion) are computed for the whole program
+// before the analysis (see chanFlow).
+//
+// The components of the callgraph (see ssa.CallGraph.SCCs) are not computed:
+// the call stack is the chain of contexts of the calls and spawns analysed
+// from the current entry point, so a component is only detected once a cycle
+// of calls is reached from the entry point, and a component reached from
+// several entry points is detected (and its definitions emitted) once per
+// entry point. A spawn enters the spawned function in the context of the
+// spawner, as a call does, so recursion through go statements (e.g. f spawns
+// g which calls f) is detected the same way, and is a spawn of a definition
+// of the component, i.e. an unbounded number of goroutines. A call which is
+// not entered (e.g. a function without body, or a call degraded by the budget
+// or the context depth, see Budget) is not on the call stack, and does not
+// unfold the recursion since its callee is not analysed again.
+
+import (
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// isRecursive returns true if calling fn from the current function is a
+// (directly or mutually) recursive call, i.e. fn is on the call stack.
+func (v *Instruction) isRecursive(fn *ssa.Function) bool {
+	if fn == nil {
+		return false
+	}
+	if v.Callee.Function() == fn {
+		return true
+	}
+	for ctx := v.Context; ctx != nil; {
+		callee, ok := ctx.(callctx.Callee)
+		if !ok {
+			break
+		}
+		if inst := callee.Call(); inst != nil && inst.Call() != nil && inst.Function() == fn {
+			return true
+		}
+		ctx = callee.CallerCtx()
+	}
+	return false
+}
+
+// recursiveParams returns the MiGo parameters of a recursive call to def,
+// and the name of the MiGo definition being called.
+func (v *Instruction) recursiveParams(c *ssa.CallCommon, ret ssa.Value, def *funcs.Definition) (string, []*migo.Parameter) {
+	call := funcs.MakeCall(def, c, ret)
+	if call == nil {
+		v.Warnf("%s Skipping nil recursive call %s", v.Module(), c)
+		return "", nil
+	}
+	fn := NewFunction(call, v.Context, v.Env)
+	fn.SetLogger(v.Logger)
+	fn.exportParams()
+	v.Debugf("%s Recursive call to %s", v.Module(), fn.Callee.Name())
+	return fn.Callee.Name(), paramsToMigoParam(v, fn, call)
+}
+
+// doRecursiveCall emits a call to the function being analysed.
+func (v *Instruction) doRecursiveCall(c *ssa.CallCommon, ret ssa.Value, def *funcs.Definition) {
+	if name, params := v.recursiveParams(c, ret, def); name != "" {
+		stmt := &migo.CallStatement{Name: name}
+		stmt.AddParams(params...)
+		v.MiGo.AddStmts(stmt)
+	}
+}
+
+// doRecursiveGo emits a spawn of the function being analysed.
+func (v *Instruction) doRecursiveGo(c *ssa.CallCommon, def *funcs.Definition) {
+	if name, params := v.recursiveParams(c, nil, def); name != "" {
+		stmt := &migo.SpawnStatement{Name: name}
+		stmt.AddParams(params...)
+		v.MiGo.AddStmts(stmt)
+	}
+}
@@ -0,0 +1,195 @@
+package migoinfer
+
+// Models of reflect.Select.
+//
+// reflect.Select(cases) is a select statement over a dynamic number of cases.
+// If the slice of cases is built statically in the function, e.g.
+//
+//	cases := []reflect.SelectCase{
+//		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)},
+//	}
+//	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+//
+// i.e. from slice literals and appends of slice literals with constant
+// directions and channels converted by reflect.ValueOf, the call is a select
+// statement of the cases. Otherwise (e.g. the cases are built in a loop), the
+// cases cannot be recovered and the call is conservatively modelled as a τ
+// action, i.e. one of the cases is always ready and none of the channels are
+// used. This may miss blocking on the channels, but does not introduce
+// communication which may not happen.
+
+import (
+	"go/types"
+
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Directions of reflect.SelectCase (see reflect.SelectDir).
+const (
+	reflectSelectSend    = 1
+	reflectSelectRecv    = 2
+	reflectSelectDefault = 3
+)
+
+// reflectCase is a case of reflect.Select.
+type reflectCase struct {
+	dir int64
+	ch  ssa.Value // Channel (before conversion to reflect.Value).
+}
+
+// reflectSelect is the Model of reflect.Select.
+func reflectSelect(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool {
+	cases, ok := reflectCases(c.Args[0])
+	if ok {
+		for _, rc := range cases {
+			if rc.dir != reflectSelectDefault && isUndefined(v.Get(rc.ch)) {
+				ok = false
+			}
+		}
+	}
+	if !ok || len(cases) == 0 {
+		v.Debugf("%s Model reflect.Select: cases unknown (τ)\n\t%s", v.Module(), v.Env.getPos(c))
+		v.MiGo.AddStmts(&migo.TauStatement{})
+		return true
+	}
+	stmt := &migo.SelectStatement{Cases: make([][]migo.Statement, len(cases))}
+	for i, rc := range cases {
+		switch rc.dir {
+		case reflectSelectSend:
+			stmt.Cases[i] = []migo.Statement{migoSend(v, rc.ch, v.Get(rc.ch))}
+		case reflectSelectRecv:
+			stmt.Cases[i] = []migo.Statement{migoRecv(v, rc.ch, v.Get(rc.ch))}
+		default:
+			stmt.Cases[i] = []migo.Statement{&migo.TauStatement{}}
+		}
+	}
+	v.Debugf("%s Model reflect.Select: %d cases", v.Module(), len(cases))
+	v.MiGo.AddStmts(stmt)
+	return true
+}
+
+// reflectCases returns the cases in slice, or false as second return value if
+// the cases cannot be determined statically.
+func reflectCases(slice ssa.Value) ([]reflectCase, bool) {
+	switch s := slice.(type) {
+	case *ssa.Const: // nil slice.
+		return nil, s.IsNil()
+	case *ssa.Slice: // Slice literal, e.g. []reflect.SelectCase{⋯}.
+		if arr, ok := s.X.(*ssa.Alloc); ok && s.Low == nil && s.High == nil {
+			return arrayCases(arr)
+		}
+	case *ssa.Call: // append(cases, ⋯)
+		if b, ok := s.Call.Value.(*ssa.Builtin); ok && b.Name() == "append" {
+			var cases []reflectCase
+			for _, arg := range s.Call.Args {
+				argCases, ok := reflectCases(arg)
+				if !ok {
+					return nil, false
+				}
+				cases = append(cases, argCases...)
+			}
+			return cases, true
+		}
+	}
+	return nil, false
+}
+
+// arrayCases returns the cases stored in the array arr.
+func arrayCases(arr *ssa.Alloc) ([]reflectCase, bool) {
+	t, ok := arr.Type().Underlying().(*types.Pointer)
+	if !ok {
+		return nil, false
+	}
+	at, ok := t.Elem().Underlying().(*types.Array)
+	if !ok {
+		return nil, false
+	}
+	cases := make([]reflectCase, at.Len())
+	found := make([]bool, at.Len())
+	for _, ref := range *arr.Referrers() {
+		ia, ok := ref.(*ssa.IndexAddr)
+		if !ok {
+			continue
+		}
+		idx, ok := ia.Index.(*ssa.Const)
+		if !ok {
+			return nil, false
+		}
+		rc, ok := caseAt(ia)
+		if i := idx.Int64(); ok && i < int64(len(cases)) {
+			cases[i], found[i] = rc, true
+		} else {
+			return nil, false
+		}
+	}
+	for _, f := range found {
+		if !f {
+			return nil, false
+		}
+	}
+	return cases, true
+}
+
+// caseAt returns the case stored at address addr.
+func caseAt(addr ssa.Value) (reflectCase, bool) {
+	var rc reflectCase
+	for _, ref := range *addr.Referrers() {
+		switch ref := ref.(type) {
+		case *ssa.Store: // Composite literal, e.g. cases[0] = reflect.SelectCase{⋯}.
+			if load, ok := ref.Val.(*ssa.UnOp); ok && ref.Addr == addr {
+				if lit, ok := load.X.(*ssa.Alloc); ok {
+					return caseAt(lit)
+				}
+			}
+			return rc, false
+		case *ssa.FieldAddr:
+			for _, fref := range *ref.Referrers() {
+				st, ok := fref.(*ssa.Store)
+				if !ok || st.Addr != ref {
+					continue
+				}
+				switch fieldName(ref) {
+				case "Dir":
+					c, ok := st.Val.(*ssa.Const)
+					if !ok {
+						return rc, false
+					}
+					rc.dir = c.Int64()
+				case "Chan":
+					rc.ch = valueOf(st.Val)
+				}
+			}
+		}
+	}
+	if rc.dir != reflectSelectDefault && rc.ch == nil {
+		return rc, false
+	}
+	return rc, rc.dir >= reflectSelectSend && rc.dir <= reflectSelectDefault
+}
+
+// fieldName returns the name of the field at fa.
+func fieldName(fa *ssa.FieldAddr) string {
+	if t, ok := fa.X.Type().Underlying().(*types.Pointer); ok {
+		if s, ok := t.Elem().Underlying().(*types.Struct); ok {
+			return s.Field(fa.Field).Name()
+		}
+	}
+	return ""
+}
+
+// valueOf returns the channel converted to reflect.Value by
+// reflect.ValueOf(ch), or nil if val is not such conversion.
+func valueOf(val ssa.Value) ssa.Value {
+	call, ok := val.(*ssa.Call)
+	if !ok {
+		return nil
+	}
+	if fn := call.Call.StaticCallee(); fn == nil || fn.String() != "reflect.ValueOf" {
+		return nil
+	}
+	if mi, ok := call.Call.Args[0].(*ssa.MakeInterface); ok && isChan(mi.X) {
+		return mi.X
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package migoinfer
+
+// Reuse of function summaries across equivalent contexts.
+//
+// A function is analysed in the context of each call, and each analysis is a
+// MiGo definition. Contexts often differ only in bindings irrelevant to the
+// callee, e.g. fan-in of a helper taking a channel, which is a MiGo parameter
+// anyway. If Environment.ReuseSummaries is set, the summary key of a call is
+// the callee with the projection of the context onto the inputs the callee
+// uses, i.e. for each parameter (and capture) with referrers, whether its
+// argument is a channel, a nil channel or a constant (which decides branches,
+// see feasibleBranch), and the locks held. A call with the key of a previous
+// call calls the MiGo definition of the previous call instead of analysing
+// the callee again.
+//
+// Only callees whose parameters, captures and results are channels or basic
+// values are summarised, so the callee cannot bind channels (or locks) in the
+// scope of the caller, and callees which bind new package variables holding
+// channels are not summarised, as the globals are parameters of the
+// definition. Operations of the callee on the channels of the reused contexts
+// are not recorded (e.g. for channel misuses).
+//
+// Summaries may also be shared across analyses (see SharedSummaries), e.g.
+// the analyses of the callees of a function in a parallel analysis, as the
+// summary key does not depend on the analysis. The definitions of a shared
+// summary are renamed after the key and the function analysed, so they are
+// the same whichever analysis runs first.
+
+import (
+	"fmt"
+	"go/types"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nickng/gospal/funcs"
+	"github.com/nickng/gospal/metrics"
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// summarisable returns true if the definitions of fn may be reused across
+// contexts, i.e. its parameters, captures and results are channels or basic
+// values.
+func (env *Environment) summarisable(fn *ssa.Function) bool {
+	if ok, seen := env.summarisableFns[fn]; seen {
+		return ok
+	}
+	ok := true
+	for _, p := range fn.Params {
+		ok = ok && chanOrBasic(p.Type())
+	}
+	for _, fv := range fn.FreeVars {
+		ok = ok && chanOrBasic(fv.Type())
+	}
+	results := fn.Signature.Results()
+	for i := 0; i < results.Len(); i++ {
+		_, isBasic := results.At(i).Type().Underlying().(*types.Basic)
+		ok = ok && isBasic
+	}
+	env.summarisableFns[fn] = ok
+	return ok
+}
+
+// chanOrBasic returns true if t is a channel or basic (non-pointer) type.
+func chanOrBasic(t types.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *types.Chan:
+		return true
+	case *types.Basic:
+		return t.Kind() != types.UnsafePointer
+	}
+	return false
+}
+
+// summaryKey returns the summary key of call in the context of v, or false if
+// the callee is not summarised.
+func (v *Instruction) summaryKey(call *funcs.Call) (string, bool) {
+	if !v.Env.ReuseSummaries || !v.Env.summarisable(call.Function()) {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(call.Function().String())
+	for i, arg := range call.Parameters[:call.NParam()+call.NBind()] {
+		if param, ok := call.Definition().Param(i).(ssa.Value); ok {
+			if refs := param.Referrers(); refs != nil && len(*refs) == 0 {
+				b.WriteString(";_") // Unused.
+				continue
+			}
+		}
+		if c, ok := arg.(*ssa.Const); ok {
+			b.WriteString(";" + c.String())
+			continue
+		}
+		switch val := v.Get(arg).(type) {
+		case *chans.Chan:
+			b.WriteString(";chan")
+		case store.MockValue:
+			b.WriteString(";nil")
+		case store.Const:
+			b.WriteString(";" + val.UniqName())
+		default:
+			fmt.Fprintf(&b, ";%T", val)
+		}
+	}
+	for _, h := range v.Env.held {
+		b.WriteString(";lock " + h.Lock)
+	}
+	return b.String(), true
+}
+
+// reuseSummary returns the MiGo definition of the previous call with key, if
+// any, or else of the summary of key shared by the analysis of a function
+// visible (see Environment.Shared).
+func (v *Instruction) reuseSummary(key string) (string, bool) {
+	name, ok := v.Env.summaries[key]
+	if !ok && key != "" {
+		if sum := v.Env.Shared.lookup(key, v.Env.SharedVisible); sum != nil {
+			name, ok = sum.Name, true
+			v.Env.summaries[key] = name
+			v.Env.sharedUsed = append(v.Env.sharedUsed, sum)
+			for _, f := range sum.Funcs {
+				v.Env.sharedNames[f.Name] = true
+			}
+		}
+	}
+	if ok {
+		metrics.SummariesReused.Inc()
+		v.Debugf("%s Reuse summary %s", v.Module(), name)
+	}
+	return name, ok
+}
+
+// SharedSummaries are the summaries of the analyses of several functions
+// (e.g. by the workers of a parallel analysis), for reuse by the analyses of
+// their callers. A summary is the MiGo definition of a function for a
+// summary key, copied with the definitions it calls, renamed after its key
+// and owner (the function whose analysis computed it), so the names do not
+// clash across analyses.
+//
+// SharedSummaries is safe for concurrent use.
+type SharedSummaries struct {
+	mu    sync.Mutex
+	byKey map[string][]*SharedSummary
+}
+
+// SharedSummary is a summary shared by the analysis of Owner.
+type SharedSummary struct {
+	Owner *ssa.Function    // Function whose analysis computed the summary.
+	Name  string           // MiGo definition of the summary.
+	Funcs []*migo.Function // Definitions of the summary, with the definitions called.
+
+	Spawns      map[string]string                   // Spawn sites, by MiGo definition.
+	BranchConds map[string]string                   // Branch conditions, by MiGo definition.
+	ChanDirs    map[string]map[string]types.ChanDir // Channel parameter directions.
+}
+
+// NewSharedSummaries returns an empty set of shared summaries.
+func NewSharedSummaries() *SharedSummaries {
+	return &SharedSummaries{byKey: make(map[string][]*SharedSummary)}
+}
+
+// lookup returns the summary of key of the first owner (by name) visible, or
+// nil if there is none, so the summary chosen does not depend on the order of
+// the analyses.
+func (s *SharedSummaries) lookup(key string, visible func(owner *ssa.Function) bool) *SharedSummary {
+	if s == nil || visible == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found *SharedSummary
+	for _, sum := range s.byKey[key] {
+		if visible(sum.Owner) && (found == nil || sum.Owner.String() < found.Owner.String()) {
+			found = sum
+		}
+	}
+	return found
+}
+
+// SharedUsed returns the shared summaries used by the analysis, whose
+// definitions are not in Prog.
+func (env *Environment) SharedUsed() []*SharedSummary {
+	return env.sharedUsed
+}
+
+// PublishSummaries adds the summaries computed by the analysis of owner to
+// shared.
+func (env *Environment) PublishSummaries(shared *SharedSummaries, owner *ssa.Function) {
+	defs := make(map[string]*migo.Function) // By name, as called.
+	for _, f := range env.Prog.Funcs {
+		defs[f.Name] = f
+	}
+	for _, s := range env.sharedUsed {
+		for _, f := range s.Funcs {
+			defs[f.Name] = f
+		}
+	}
+	var keys []string
+	for key, name := range env.summaries {
+		if _, ok := defs[name]; ok && !env.sharedNames[name] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(key + "\x00" + owner.String()))
+		tag := fmt.Sprintf("#s%08x", h.Sum32())
+
+		// Definitions called by the summary, renamed unless shared already.
+		rename := make(map[string]string)
+		var order []string
+		var visit func(name string)
+		visit = func(name string) {
+			if _, ok := rename[name]; ok {
+				return
+			}
+			rename[name] = name
+			if !env.sharedNames[name] {
+				rename[name] = name + tag
+			}
+			order = append(order, name)
+			if f, ok := defs[name]; ok {
+				walkCalls(f.Stmts, visit)
+			}
+		}
+		visit(env.summaries[key])
+		sum := &SharedSummary{
+			Owner:       owner,
+			Name:        rename[env.summaries[key]],
+			Spawns:      make(map[string]string),
+			BranchConds: make(map[string]string),
+			ChanDirs:    make(map[string]map[string]types.ChanDir),
+		}
+		for _, name := range order {
+			f, ok := defs[name]
+			if !ok {
+				continue
+			}
+			if env.sharedNames[name] {
+				sum.Funcs = append(sum.Funcs, f)
+				continue
+			}
+			g := migo.NewFunction(rename[name])
+			g.AddParams(f.Params...)
+			g.AddStmts(renameCalls(f.Stmts, rename)...)
+			sum.Funcs = append(sum.Funcs, g)
+			if pos, ok := env.Spawns[name]; ok {
+				sum.Spawns[rename[name]] = pos
+			}
+			if cond, ok := env.BranchConds[simpleName(name)]; ok {
+				sum.BranchConds[simpleName(rename[name])] = cond
+			}
+			if dirs, ok := env.ChanDirs[name]; ok {
+				sum.ChanDirs[rename[name]] = dirs
+			}
+		}
+		shared.mu.Lock()
+		shared.byKey[key] = append(shared.byKey[key], sum)
+		shared.mu.Unlock()
+	}
+}
+
+// walkCalls calls f with the definition called (or spawned) by each statement
+// of stmts.
+func walkCalls(stmts []migo.Statement, f func(name string)) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			f(stmt.Name)
+		case *migo.SpawnStatement:
+			f(stmt.Name)
+		case *migo.IfStatement:
+			walkCalls(stmt.Then, f)
+			walkCalls(stmt.Else, f)
+		case *migo.IfForStatement:
+			walkCalls(stmt.Then, f)
+			walkCalls(stmt.Else, f)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				walkCalls(c, f)
+			}
+		}
+	}
+}
+
+// renameCalls returns a copy of stmts with the definitions called (or
+// spawned) renamed by rename. Other statements are not copied.
+func renameCalls(stmts []migo.Statement, rename map[string]string) []migo.Statement {
+	copied := make([]migo.Statement, len(stmts))
+	for i, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			call := &migo.CallStatement{Name: rename[stmt.Name]}
+			call.AddParams(stmt.Params...)
+			copied[i] = call
+		case *migo.SpawnStatement:
+			spawn := &migo.SpawnStatement{Name: rename[stmt.Name]}
+			spawn.AddParams(stmt.Params...)
+			copied[i] = spawn
+		case *migo.IfStatement:
+			copied[i] = &migo.IfStatement{Then: renameCalls(stmt.Then, rename), Else: renameCalls(stmt.Else, rename)}
+		case *migo.IfForStatement:
+			s := *stmt
+			s.Then, s.Else = renameCalls(stmt.Then, rename), renameCalls(stmt.Else, rename)
+			copied[i] = &s
+		case *migo.SelectStatement:
+			s := *stmt
+			s.Cases = make([][]migo.Statement, len(stmt.Cases))
+			for j, c := range stmt.Cases {
+				s.Cases[j] = renameCalls(c, rename)
+			}
+			copied[i] = &s
+		default:
+			copied[i] = stmt
+		}
+	}
+	return copied
+}
@@ -0,0 +1,51 @@
+package migoinfer
+
+// Models of os/signal.
+//
+// signal.Notify(ch, ⋯) registers the runtime as an external producer on ch,
+// which may send on ch at any time (e.g. when the process is interrupted).
+// Notify spawns an environment process which repeatedly chooses to send on ch
+// or stop, i.e.
+//
+//	def ch.signal(ch): if send ch; call ch.signal(ch) else endif;
+
+import (
+	"fmt"
+
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/migo"
+	"golang.org/x/tools/go/ssa"
+)
+
+// signalNotify is the Model of signal.Notify.
+func signalNotify(v *Instruction, c *ssa.CallCommon, ret ssa.Value) bool {
+	ch, ok := v.Get(c.Args[0]).(*chans.Chan)
+	if !ok {
+		v.Warnf("%s signal.Notify: %s is not a channel\n\t%s",
+			v.Module(), c.Args[0].Name(), v.Env.getPos(c.Args[0]))
+		return true
+	}
+	name := v.FindExported(v.Context, ch)
+	if _, ok := name.(Unexported); ok {
+		v.Warnf("%s signal.Notify: channel %s unavail. in current scope (unexported)",
+			v.Module(), ch.UniqName())
+		return true
+	}
+	envFn := migo.NewFunction(fmt.Sprintf("%s.signal", ch.UniqName()))
+	if !v.Env.signals[ch] {
+		again := &migo.CallStatement{Name: envFn.Name}
+		again.AddParams(&migo.Parameter{Caller: name, Callee: name})
+		envFn.AddParams(&migo.Parameter{Caller: name, Callee: name})
+		envFn.AddStmts(&migo.IfStatement{
+			Then: []migo.Statement{&migo.SendStatement{Chan: name.Name()}, again},
+			Else: []migo.Statement{},
+		})
+		v.Env.addFunction(envFn)
+		v.Env.signals[ch] = true
+	}
+	v.Debugf("%s Model signal.Notify: spawn %s", v.Module(), envFn.SimpleName())
+	stmt := &migo.SpawnStatement{Name: envFn.Name}
+	stmt.AddParams(&migo.Parameter{Caller: name, Callee: name})
+	v.MiGo.AddStmts(stmt)
+	return true
+}
@@ -0,0 +1,141 @@
+package migoinfer
+
+// Non-communicating goroutines.
+//
+// A spawned goroutine is silent if its body (and the functions it calls)
+// contains no channel operations, lock (or other sync) operations and spawns,
+// i.e. it is pure computation. Silent goroutines are recorded in
+// Environment.Silent for reporting, e.g. when communication is expected but
+// missing. If Environment.SummariseSilent is set, silent goroutines are not
+// analysed nor spawned in MiGo, which shrinks the model without changing its
+// behaviour.
+//
+// Functions in the analysed (source) packages are inspected; library functions
+// are silent unless their package is modelled (e.g. sync, time) or they have
+// a Model, e.g. fmt.Println is silent although it uses sync internally. Dynamic
+// calls are not silent, as their callees are unknown.
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// syncPkgs are the library packages which communicate (or synchronise).
+var syncPkgs = map[string]bool{
+	"context":                    true,
+	"net/http":                   true,
+	"os/signal":                  true,
+	"reflect":                    true,
+	"sync":                       true,
+	"sync/atomic":                true,
+	"time":                       true,
+	"golang.org/x/sync/errgroup": true,
+	"golang.org/x/net/context":   true,
+}
+
+// SilentGoroutine is a spawn of a goroutine which does not communicate.
+type SilentGoroutine struct {
+	Func string // Function spawned.
+	Pos  string // Spawn site.
+}
+
+func (s SilentGoroutine) String() string {
+	return s.Pos + ": goroutine " + s.Func + " does not communicate (no channel, lock or spawn operations)"
+}
+
+// isSilent returns true if fn does not communicate.
+func (env *Environment) isSilent(fn *ssa.Function) bool {
+	if env.silent == nil {
+		env.silent = make(map[*ssa.Function]bool)
+	}
+	if silent, ok := env.silent[fn]; ok {
+		return silent
+	}
+	silent := env.silentBody(fn, make(map[*ssa.Function]bool))
+	env.silent[fn] = silent
+	return silent
+}
+
+// silentBody returns true if the body of fn does not communicate, given the
+// functions visited from the same root. Only the functions which communicate
+// are memoised, as the functions visited (e.g. recursive calls) are assumed
+// not to communicate by themselves.
+func (env *Environment) silentBody(fn *ssa.Function, visited map[*ssa.Function]bool) bool {
+	visited[fn] = true
+	if _, ok := env.Models[fn.String()]; ok {
+		return false
+	}
+	if fn.Pkg != nil && syncPkgs[fn.Pkg.Pkg.Path()] {
+		return false
+	}
+	if !env.isSource(fn) || (env.Filter != nil && !env.Filter.Selects(fn, env.Info.FSet)) {
+		return true
+	}
+	for _, blk := range fn.Blocks {
+		for _, instr := range blk.Instrs {
+			switch instr := instr.(type) {
+			case *ssa.Send, *ssa.Select, *ssa.MakeChan, *ssa.Go:
+				return false
+			case *ssa.UnOp:
+				if instr.Op == token.ARROW {
+					return false
+				}
+			case ssa.CallInstruction:
+				c := instr.Common()
+				if b, ok := c.Value.(*ssa.Builtin); ok {
+					if b.Name() == "close" {
+						return false
+					}
+					continue
+				}
+				callee := c.StaticCallee()
+				if callee == nil {
+					return false
+				}
+				if silent, ok := env.silent[callee]; ok && !silent {
+					return false
+				}
+				if !visited[callee] && !env.silentBody(callee, visited) {
+					env.silent[callee] = false
+					return false
+				}
+			}
+			if v, ok := instr.(ssa.Value); ok && isChan(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isSource returns true if fn is in a source package of the analysis (or its
+// package is unknown).
+func (env *Environment) isSource(fn *ssa.Function) bool {
+	if fn.Pkg == nil || env.Info.LProg == nil {
+		return true
+	}
+	for _, pkg := range env.Info.LProg.InitialPackages() {
+		if pkg.Pkg == fn.Pkg.Pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// silentSpawn records the spawn of fn at c if fn does not communicate, and
+// returns true if the spawn should not be analysed.
+func (v *Instruction) silentSpawn(fn *ssa.Function, c *ssa.CallCommon) bool {
+	if c.IsInvoke() || c.StaticCallee() == nil || !v.Env.isSilent(fn) {
+		return false
+	}
+	v.Debugf("%s Silent goroutine %s", v.Module(), fn.String())
+	spawn := SilentGoroutine{Func: fn.String(), Pos: v.Env.getPos(c)}
+	for _, s := range v.Env.Silent {
+		if s == spawn {
+			return v.Env.SummariseSilent
+		}
+	}
+	v.Env.Silent = append(v.Env.Silent, spawn)
+	return v.Env.SummariseSilent
+}
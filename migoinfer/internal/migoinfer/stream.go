@@ -0,0 +1,111 @@
+package migoinfer
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/nickng/migo"
+)
+
+// Stream writes the MiGo definitions of a program as they are finalised, i.e.
+// when the analysis of their function exits, instead of keeping the program
+// in memory (see Environment.Stream), so the memory of the emission does not
+// grow with the program.
+//
+// Definitions may call definitions written later, or never written (e.g.
+// functions analysed opaquely), which Close writes as stubs. Definitions are
+// not cleaned up (as with -raw), and are written once by name.
+type Stream struct {
+	w       *bufio.Writer
+	err     error
+	defined map[string]bool              // Definitions written.
+	pending map[string][]*migo.Parameter // Definitions called but not written, with the parameters of a call.
+	order   []string                     // Names of pending, in order of first call.
+}
+
+// NewStream returns a Stream writing to w.
+func NewStream(w io.Writer) *Stream {
+	return &Stream{
+		w:       bufio.NewWriter(w),
+		defined: make(map[string]bool),
+		pending: make(map[string][]*migo.Parameter),
+	}
+}
+
+// Write writes definition f, unless a definition of the same name is written.
+func (s *Stream) Write(f *migo.Function) {
+	name := f.SimpleName()
+	if s.defined[name] {
+		return
+	}
+	s.defined[name] = true
+	delete(s.pending, name)
+	s.calls(f.Stmts)
+	if s.err == nil {
+		_, s.err = s.w.WriteString(f.String())
+	}
+}
+
+// calls records the definitions called by stmts which are not written.
+func (s *Stream) calls(stmts []migo.Statement) {
+	call := func(name string, params []*migo.Parameter) {
+		name = migo.NewFunction(name).SimpleName() // As definitions are named.
+		if _, ok := s.pending[name]; !ok && !s.defined[name] {
+			s.pending[name] = params
+			s.order = append(s.order, name)
+		}
+	}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			call(stmt.Name, stmt.Params)
+		case *migo.SpawnStatement:
+			call(stmt.Name, stmt.Params)
+		case *migo.IfStatement:
+			s.calls(stmt.Then)
+			s.calls(stmt.Else)
+		case *migo.IfForStatement:
+			s.calls(stmt.Then)
+			s.calls(stmt.Else)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				s.calls(c)
+			}
+		}
+	}
+}
+
+// Close writes a stub (a silent step) for each definition called but not
+// written, i.e. the fix-up of forward references, and flushes the stream.
+func (s *Stream) Close() error {
+	for _, name := range s.order {
+		params, ok := s.pending[name]
+		if !ok {
+			continue
+		}
+		stub := migo.NewFunction(name)
+		for _, p := range params {
+			stub.AddParams(&migo.Parameter{Caller: p.Callee, Callee: p.Callee})
+		}
+		stub.AddStmts(&migo.TauStatement{})
+		s.defined[name] = true
+		if s.err == nil {
+			_, s.err = s.w.WriteString(stub.String())
+		}
+	}
+	s.pending, s.order = make(map[string][]*migo.Parameter), nil
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+// addFunction adds definition f to the program of env, or writes f to the
+// stream of env if streaming.
+func (env *Environment) addFunction(f *migo.Function) {
+	if env.Stream != nil {
+		env.Stream.Write(f)
+		return
+	}
+	env.Prog.AddFunction(f)
+}
@@ -0,0 +1,127 @@
+package migoinfer
+
+// Modelling of timer channels from the standard time package.
+//
+// time.After, time.Tick, time.NewTimer and time.NewTicker create channels
+// which are sent to by the runtime when the timer fires. These are represented
+// by timer channels (see chans.NewTimer).
+//
+// A one-shot timer (time.After, time.NewTimer) is started when it is created
+// (see timer.Start), and a receive from the timer is a timeout (see
+// timer.Timeout), i.e. an internal action in MiGo labelled with the timer,
+// which can proceed once the timer is started. In particular, the timeout
+// case of a select, e.g.
+//
+//   select {
+//   case v := <-ch:
+//   case <-time.After(d):
+//   }
+//
+// is guarded by a timeout (distinguishable from a default case), and a
+// timeout which already fired cannot be selected again unless the timer is
+// restarted by (*Timer).Reset. A stopped timer (by (*Timer).Stop) is assumed
+// to fire anyway.
+//
+// A receive from a repeating timer (time.Tick, time.NewTicker) is an internal
+// (τ) action since it can always proceed eventually.
+
+import (
+	"go/constant"
+	"time"
+
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/internal/timer"
+	"github.com/nickng/gospal/store/chans"
+	"golang.org/x/tools/go/ssa"
+)
+
+const timePkg = "time"
+
+// Timer is a timer channel created by the time package.
+type Timer struct {
+	Ticker   bool          // Fires repeatedly (time.Tick, time.NewTicker).
+	Duration time.Duration // Duration (or period), or 0 if not constant.
+	Pos      string        // Creation site.
+}
+
+// timerDuration returns the duration d if it is a constant, or 0.
+func timerDuration(d ssa.Value) time.Duration {
+	if k, ok := d.(*ssa.Const); ok && k.Value != nil {
+		if n, exact := constant.Int64Val(constant.ToInt(k.Value)); exact && n > 0 {
+			return time.Duration(n)
+		}
+	}
+	return 0
+}
+
+// visitTimeCall handles calls to the time package, and returns true if the
+// call is fully handled (i.e. the callee should not be analysed).
+// The return value ret is nil if the call is not an *ssa.Call (e.g. deferred).
+func (v *Instruction) visitTimeCall(c *ssa.CallCommon, ret ssa.Value) bool {
+	fn := c.StaticCallee()
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg.Path() != timePkg {
+		return false
+	}
+	switch fn.Name() {
+	case "After", "Tick", "NewTimer", "NewTicker":
+		if ret == nil {
+			return true
+		}
+		ch := chans.NewTimer(v.Callee, ret)
+		if fn.Name() == "Tick" || fn.Name() == "NewTicker" {
+			ch = chans.NewTicker(v.Callee, ret)
+		}
+		if updater, ok := v.Context.(callctx.Updater); ok {
+			updater.PutUniq(ret, ch)
+		} else {
+			v.Fatal("Cannot update context")
+		}
+		v.Debugf("%s time.%s creates timer channel %s",
+			v.Module(), fn.Name(), ch.UniqName())
+		t := Timer{Ticker: ch.IsTicker(), Pos: v.Env.getPos(c)}
+		if len(c.Args) > 0 {
+			t.Duration = timerDuration(c.Args[0])
+		}
+		v.Env.Timers[ch.UniqName()] = t
+		v.Export(ret)
+		v.MiGo.AddStmts(migoNewChan(v.Logger, ret, ch))
+		if !ch.IsTicker() {
+			v.MiGo.AddStmts(&timer.Start{Chan: ret.Name()})
+		}
+		return true
+	case "Reset": // (*Timer).Reset restarts the timer.
+		if fn.Signature.Recv() == nil || len(c.Args) == 0 {
+			return true
+		}
+		if ch := v.Get(c.Args[0]); isOneShotTimer(ch) {
+			switch exported := v.FindExported(v.Context, ch).(type) {
+			case Unexported:
+				v.Warnf("%s Timer %s unavail. in current scope (unexported)\n\t%s",
+					v.Module(), c.Args[0].Name(), v.Env.getPos(c))
+			default:
+				v.Debugf("%s time.Timer.Reset restarts timer channel %s",
+					v.Module(), ch.UniqName())
+				v.MiGo.AddStmts(&timer.Start{Chan: exported.Name()})
+				v.MiGo.HasComm = true // Not a MiGo communication, kept by CleanUp.
+			}
+		}
+		return true
+	case "AfterFunc":
+		return false
+	}
+	// Other functions (e.g. Sleep, Timer.Stop) do not communicate.
+	return true
+}
+
+// isOneShotTimer returns true if the channel value is a one-shot timer
+// channel.
+func isOneShotTimer(ch interface{}) bool {
+	c, ok := ch.(*chans.Chan)
+	return ok && c.IsTimer() && !c.IsTicker()
+}
+
+// isTickerChan returns true if the channel value is a repeating timer channel.
+func isTickerChan(ch interface{}) bool {
+	c, ok := ch.(*chans.Chan)
+	return ok && c.IsTicker()
+}
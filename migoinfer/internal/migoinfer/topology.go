@@ -0,0 +1,166 @@
+package migoinfer
+
+// Communication topology.
+//
+// The topology of a program is the graph of the functions analysed with the
+// goroutines they spawn and the channels they operate on, i.e. for each
+// channel its creator, senders, receivers and closers. It is built from the
+// spawns and channel operations recorded during inference (not from the MiGo
+// program), so each edge is annotated with the position of the spawn or
+// operation in the source.
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+
+	"github.com/nickng/gospal/store/chans"
+	"golang.org/x/tools/go/ssa"
+)
+
+// SpawnEdge is a spawn of a goroutine recorded during inference.
+type SpawnEdge struct {
+	Spawner *ssa.Function
+	Spawned *ssa.Function
+	Pos     token.Pos
+}
+
+// TopoEdge is an edge of the topology between a function and a channel (or
+// the goroutine spawned), at position Pos.
+type TopoEdge struct {
+	Func string `json:"func"`
+	Pkg  string `json:"pkg"` // Package of the function.
+	Pos  string `json:"pos"`
+}
+
+// TopoSpawn is a spawn of a goroutine in the topology.
+type TopoSpawn struct {
+	Spawner string `json:"spawner"`
+	Spawned string `json:"spawned"`
+	Pkg     string `json:"pkg"` // Package of the function spawned.
+	Pos     string `json:"pos"`
+}
+
+// TopoChan is a channel in the topology.
+type TopoChan struct {
+	Name      string     `json:"name"`
+	Pos       string     `json:"pos"`     // Creation site.
+	Creator   string     `json:"creator"` // Function creating the channel, if known.
+	Pkg       string     `json:"pkg"`     // Package of the creator.
+	Senders   []TopoEdge `json:"senders"`
+	Receivers []TopoEdge `json:"receivers"`
+	Closers   []TopoEdge `json:"closers"`
+}
+
+// Topology is the communication topology of a program.
+type Topology struct {
+	Spawns []TopoSpawn `json:"spawns"`
+	Chans  []TopoChan  `json:"chans"`
+}
+
+// Topology returns the communication topology of the analysed program, with
+// the spawns and channels sorted by position.
+func (env *Environment) Topology() *Topology {
+	t := new(Topology)
+	seen := make(map[TopoSpawn]bool)
+	for _, s := range env.SpawnEdges {
+		spawn := TopoSpawn{Spawner: s.Spawner.String(), Spawned: s.Spawned.String(), Pkg: pkgPath(s.Spawned), Pos: env.Info.FSet.Position(s.Pos).String()}
+		if !seen[spawn] {
+			seen[spawn] = true
+			t.Spawns = append(t.Spawns, spawn)
+		}
+	}
+	sort.SliceStable(t.Spawns, func(i, j int) bool { return t.Spawns[i].Pos < t.Spawns[j].Pos })
+
+	for ch, ops := range env.ChanOps {
+		c := TopoChan{Name: ch.UniqName(), Pos: env.chanPos(ch)}
+		if instr, ok := ch.Value.(ssa.Instruction); ok && instr.Parent() != nil {
+			c.Creator, c.Pkg = instr.Parent().String(), pkgPath(instr.Parent())
+		}
+		type opEdge struct {
+			op opKind
+			e  TopoEdge
+		}
+		seen := make(map[opEdge]bool)
+		for _, op := range ops {
+			e := TopoEdge{Func: op.instr.Parent().String(), Pkg: pkgPath(op.instr.Parent()), Pos: env.opPos(op)}
+			if seen[opEdge{op.Op, e}] {
+				continue // Operation analysed in several contexts.
+			}
+			seen[opEdge{op.Op, e}] = true
+			switch op.Op {
+			case opSend:
+				c.Senders = append(c.Senders, e)
+			case opRecv:
+				c.Receivers = append(c.Receivers, e)
+			case opClose:
+				c.Closers = append(c.Closers, e)
+			}
+		}
+		t.Chans = append(t.Chans, c)
+	}
+	sort.Slice(t.Chans, func(i, j int) bool {
+		if t.Chans[i].Pos != t.Chans[j].Pos {
+			return t.Chans[i].Pos < t.Chans[j].Pos
+		}
+		return t.Chans[i].Name < t.Chans[j].Name
+	})
+	return t
+}
+
+// pkgPath returns the path of the package of fn, or empty if none (e.g. a
+// wrapper).
+func pkgPath(fn *ssa.Function) string {
+	if fn.Pkg == nil {
+		return ""
+	}
+	return fn.Pkg.Pkg.Path()
+}
+
+// chanPos returns the creation site of ch, or empty if unknown.
+func (env *Environment) chanPos(ch *chans.Chan) string {
+	if pos, ok := env.Chans[ch.UniqName()]; ok {
+		return pos
+	}
+	if ch.Value.Pos().IsValid() {
+		return env.getPos(ch.Value)
+	}
+	return ""
+}
+
+// WriteDot writes the topology to w in graphviz dot format, with a box for
+// each function and an ellipse for each channel. Spawns are dashed edges
+// between functions, and channel edges go from the creator (dotted) and the
+// senders to the channel, and from the channel to the receivers, labelled by
+// the positions of the operations.
+func (t *Topology) WriteDot(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("digraph topology {\n  node [shape=box];\n")
+	for _, s := range t.Spawns {
+		fmt.Fprintf(bufw, "  %q -> %q [style=dashed,color=blue,label=%q];\n", s.Spawner, s.Spawned, "go "+s.Pos)
+	}
+	for _, c := range t.Chans {
+		node := "chan " + c.Name
+		label := c.Name
+		if c.Pos != "" {
+			label += "\n" + c.Pos
+		}
+		fmt.Fprintf(bufw, "  %q [shape=ellipse,label=%q];\n", node, label)
+		if c.Creator != "" {
+			fmt.Fprintf(bufw, "  %q -> %q [style=dotted,label=\"make\"];\n", c.Creator, node)
+		}
+		for _, e := range c.Senders {
+			fmt.Fprintf(bufw, "  %q -> %q [label=%q];\n", e.Func, node, "send "+e.Pos)
+		}
+		for _, e := range c.Closers {
+			fmt.Fprintf(bufw, "  %q -> %q [color=red,label=%q];\n", e.Func, node, "close "+e.Pos)
+		}
+		for _, e := range c.Receivers {
+			fmt.Fprintf(bufw, "  %q -> %q [label=%q];\n", node, e.Func, "recv "+e.Pos)
+		}
+	}
+	bufw.WriteString("}\n")
+	return bufw.Flush()
+}
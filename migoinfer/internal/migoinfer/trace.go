@@ -0,0 +1,192 @@
+package migoinfer
+
+// Counterexample traces.
+//
+// A trace is the sequence of MiGo actions of the processes from the initial
+// state to a deadlock, found by FindDeadlocks (or imported from an external
+// checker with ParseTrace). Replay maps each action back to the Go source:
+//
+//   - newchan to the creation site of the channel,
+//   - spawn to the spawn site of the goroutine,
+//   - send, recv and close to the channel operation in the definition, as
+//     recorded during inference, and
+//   - then/else to the branch condition of the definition.
+//
+// WriteTrace renders the trace as an interleaved narrative, where the actions
+// of each goroutine are indented in their own column.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Step is an action of a process in a trace.
+type Step struct {
+	ID        int    // Identifier of the process, 0 is the main process.
+	Goroutine string // MiGo definition of the process (spawned or main).
+	Def       string // MiGo definition of the action.
+	Action    string // e.g. "send", "recv", "close", "newchan", "spawn", "then".
+	Chan      string // Channel of the action (or spawned definition).
+	Peer      int    // Process synchronised with (or spawned), or -1.
+	Pos       string // Source position of the action (see Replay).
+	Detail    string // Details of the action, e.g. branch condition.
+
+	occ int // Occurrence of the action on the channel in the definition.
+}
+
+func (s Step) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "g%d %s: %s", s.ID, s.Def, s.Action)
+	if s.Chan != "" {
+		fmt.Fprintf(&buf, " %s", s.Chan)
+	}
+	if s.Peer >= 0 {
+		fmt.Fprintf(&buf, " g%d", s.Peer)
+	}
+	return buf.String()
+}
+
+// Replay returns the steps of trace mapped to their source positions.
+func Replay(env *Environment, trace []Step) []Step {
+	ops := make(map[string][]string) // def/op/chan → positions.
+	for ch, chOps := range env.ChanOps {
+		for _, op := range chOps {
+			k := fmt.Sprintf("%s/%s/%s", op.Def, op.Op, ch.UniqName())
+			pos := env.opPos(op)
+			if dup := ops[k]; len(dup) == 0 || dup[len(dup)-1] != pos {
+				ops[k] = append(ops[k], pos)
+			}
+		}
+	}
+	spawns := simpleNames(env.Spawns)
+	steps := make([]Step, len(trace))
+	for i, s := range trace {
+		switch s.Action {
+		case "newchan":
+			s.Pos = env.Chans[s.Chan]
+		case "spawn":
+			s.Pos = spawns[s.Chan]
+		case "send", "recv", "close":
+			if pos := ops[fmt.Sprintf("%s/%s/%s", s.Def, s.Action, s.Chan)]; len(pos) > 0 {
+				if s.occ < len(pos) {
+					s.Pos = pos[s.occ]
+				} else {
+					s.Pos = pos[len(pos)-1]
+				}
+			}
+		case "then", "else":
+			if cond, ok := env.BranchConds[s.Def]; ok {
+				if i := strings.Index(cond, "\t"); i >= 0 {
+					s.Detail, s.Pos = cond[:i], cond[i+1:]
+				}
+			}
+		}
+		steps[i] = s
+	}
+	return steps
+}
+
+// WriteTrace writes trace to w as an interleaved narrative of the goroutines,
+// one step per line, e.g.
+//
+//	g0 main.main
+//	  1 newchan main.main0.t0_chan0                main.go:4:7
+//	  2 spawn main.main$1 (g1)                     main.go:5:2
+//	g1 main.main$1
+//	  3   send main.main0.t1_chan0 (with g0)       main.go:8:5
+//	g0 main.main
+//	  4 recv main.main0.t1_chan0 (with g1)         main.go:6:2
+//
+// where the actions of goroutine gN are indented by N columns.
+func WriteTrace(w io.Writer, trace []Step) {
+	names := make(map[int]string)
+	last := -1
+	for i, s := range trace {
+		if s.ID != last {
+			if _, ok := names[s.ID]; !ok {
+				names[s.ID] = s.Goroutine
+			}
+			fmt.Fprintf(w, "g%d %s\n", s.ID, names[s.ID])
+			last = s.ID
+		}
+		indent := s.ID
+		if indent > 8 {
+			indent = 8
+		}
+		desc := s.Action
+		switch {
+		case s.Action == "spawn":
+			desc = fmt.Sprintf("spawn %s (g%d)", s.Chan, s.Peer)
+		case s.Chan != "" && s.Peer >= 0:
+			desc = fmt.Sprintf("%s %s (with g%d)", s.Action, s.Chan, s.Peer)
+		case s.Chan != "":
+			desc = fmt.Sprintf("%s %s", s.Action, s.Chan)
+		}
+		if s.Detail != "" {
+			desc = fmt.Sprintf("%s [%s]", desc, s.Detail)
+		}
+		line := fmt.Sprintf("%3d %s%s", i+1, strings.Repeat("  ", indent), desc)
+		if s.Pos != "" {
+			fmt.Fprintf(w, "%-44s %s\n", line, s.Pos)
+		} else {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// ParseTrace parses a trace of MiGo actions from r, one step per line in the
+// format of Step.String, e.g.
+//
+//	g0 main.main: newchan main.main0.t0_chan0
+//	g0 main.main: spawn main.main$1 g1
+//	g1 main.main$1: send main.main0.t0_chan0 g0
+//
+// Empty lines and lines starting with # are ignored. The goroutine of a
+// process is the definition of its first step (or spawn).
+func ParseTrace(r io.Reader) ([]Step, error) {
+	var trace []Step
+	goroutines := make(map[int]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expecting gN def: action", n)
+		}
+		head, fields := strings.Fields(line[:i]), strings.Fields(line[i+2:])
+		if len(head) != 2 || !strings.HasPrefix(head[0], "g") || len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: expecting gN def: action", n)
+		}
+		id, err := strconv.Atoi(head[0][1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad goroutine %s", n, head[0])
+		}
+		step := Step{ID: id, Def: head[1], Action: fields[0], Peer: -1}
+		if len(fields) > 1 {
+			step.Chan = fields[1]
+		}
+		if len(fields) > 2 && strings.HasPrefix(fields[2], "g") {
+			if step.Peer, err = strconv.Atoi(fields[2][1:]); err != nil {
+				return nil, fmt.Errorf("line %d: bad peer %s", n, fields[2])
+			}
+		}
+		if _, ok := goroutines[id]; !ok {
+			goroutines[id] = step.Def
+		}
+		if step.Action == "spawn" && step.Peer >= 0 {
+			goroutines[step.Peer] = step.Chan
+		}
+		step.Goroutine = goroutines[id]
+		trace = append(trace, step)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
@@ -0,0 +1,129 @@
+package migoinfer
+
+// Bounded unrolling of loops creating channels.
+//
+// A loop body is analysed once, so a channel created in the body is a single
+// channel of the model for all the iterations, which is sound when the
+// channel of an iteration is not used after the iteration, but conflates the
+// channels of a loop creating a distinct channel per iteration, e.g.
+//
+//	for i := 0; i < 3; i++ {
+//		chs[i] = make(chan int)
+//	}
+//
+// When a loop with a constant number of iterations (see loop.Info.Iterations)
+// stores the channel created in its body in a slice or array of channels at
+// the loop index, the creation of the channel is unrolled, i.e. a distinct
+// channel is created for each iteration, up to Environment.UnrollLimit, and
+// all of them are in the summary of the slice (see maps.go). Loops with more
+// iterations than the limit are unrolled up to the limit, and recorded as
+// truncated (see Environment.Truncated).
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/loop"
+	"github.com/nickng/gospal/store/chans"
+	"github.com/nickng/gospal/store/maps"
+	"golang.org/x/tools/go/ssa"
+)
+
+// DefaultUnrollLimit is the default maximum number of iterations unrolled of
+// a loop creating a channel per iteration.
+const DefaultUnrollLimit = 8
+
+// TruncatedUnroll is a loop creating a channel per iteration with more
+// iterations than the unroll limit.
+type TruncatedUnroll struct {
+	Pos        string // Position of the creation of the channel.
+	Func       string // Function of the loop.
+	Iterations int64  // Number of iterations of the loop.
+	Limit      int    // Number of iterations unrolled.
+}
+
+func (t TruncatedUnroll) String() string {
+	return fmt.Sprintf("%s: loop in %s creating a channel per iteration unrolled %d of %d iterations",
+		t.Pos, t.Func, t.Limit, t.Iterations)
+}
+
+// iterChan is the local name of the channel created in an unrolled iteration
+// of a loop.
+type iterChan struct {
+	ch   *ssa.MakeChan
+	iter int
+}
+
+func (k iterChan) Name() string     { return fmt.Sprintf("%s_iter%d", k.ch.Name(), k.iter) }
+func (k iterChan) Pos() token.Pos   { return k.ch.Pos() }
+func (k iterChan) String() string   { return fmt.Sprintf("%s (iteration %d)", k.ch.String(), k.iter) }
+func (k iterChan) Type() types.Type { return k.ch.Type() }
+
+// loopOf returns the for-loop whose body is blk, or nil if blk is not the body
+// of a for-loop.
+func (b *Block) loopOf(blk *ssa.BasicBlock) *loop.Info {
+	for _, pred := range blk.Preds {
+		if l := b.Loop.ForLoopAt(pred); pred.Comment == "for.loop" && l != nil && l.BodyIdx() == blk.Index {
+			return l
+		}
+	}
+	return nil
+}
+
+// unroll unrolls the creation of the channel stored by st in slice m (at
+// address ia) if the channel is created per iteration of the loop of the
+// block, i.e. the channel is created in the loop body and stored at the loop
+// index.
+func (v *Instruction) unroll(st *ssa.Store, ia *ssa.IndexAddr, m *maps.Map) {
+	mk, ok := st.Val.(*ssa.MakeChan)
+	if !ok || v.loop == nil || mk.Block() != st.Block() || ia.Index != v.loop.IndexVar() {
+		return
+	}
+	ch, ok := v.Get(mk).(*chans.Chan)
+	if !ok {
+		return
+	}
+	n, ok := v.loop.Iterations()
+	if !ok || n < 2 {
+		return
+	}
+	limit := v.Env.UnrollLimit
+	if limit < 1 {
+		limit = 1 // The channel of the body.
+	}
+	unrolled := int(n)
+	if n > int64(limit) {
+		unrolled = limit
+		v.Env.truncate(TruncatedUnroll{
+			Pos:        v.Env.getPos(mk),
+			Func:       mk.Parent().String(),
+			Iterations: n,
+			Limit:      limit,
+		})
+	}
+	updater, ok := v.Context.(callctx.Updater)
+	if !ok {
+		return
+	}
+	v.Debugf("%s Unroll %s: %d of %d iterations", v.Module(), mk.Name(), unrolled, n)
+	for iter := 1; iter < unrolled; iter++ {
+		k, c := iterChan{ch: mk, iter: iter}, chans.NewIteration(ch, iter)
+		v.Env.Chans[c.UniqName()] = v.Env.getPos(mk)
+		updater.PutUniq(k, c)
+		v.Export(k)
+		v.MiGo.AddStmts(migoNewChan(v.Logger, k, c))
+		m.Add(c)
+	}
+}
+
+// truncate records the truncated unrolling t, once per loop.
+func (env *Environment) truncate(t TruncatedUnroll) {
+	for _, u := range env.Truncated {
+		if u == t {
+			return
+		}
+	}
+	env.Truncated = append(env.Truncated, t)
+}
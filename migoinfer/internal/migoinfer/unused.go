@@ -0,0 +1,108 @@
+package migoinfer
+
+// Unused channel endpoints.
+//
+// FindUnusedEndpoints looks for channels created in the program where one
+// direction is never used, i.e. the channel is sent to (or closed) but never
+// received from, or received from but never sent to nor closed, by any
+// goroutine analysed. These almost always indicate a goroutine leak or dead
+// code. Channels are those of the program-wide channel registry
+// (Environment.Chans), with the operations recorded during inference
+// (Environment.ChanOps), so operations through aliases count.
+//
+// Channels registered by signal.Notify are sent to by the runtime and not
+// reported. Operations in packages which are not analysed are not seen, so
+// channels passed to those packages may be reported.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnusedEndpoint is a channel where one (or both) directions are never used.
+type UnusedEndpoint struct {
+	Chan    string   // MiGo name of the channel.
+	Pos     string   // Creation site of the channel.
+	Unused  string   // Direction never used, i.e. "send", "recv" or "send/recv".
+	Message string   // Description of the unused endpoint.
+	Used    []string // Operations on the used direction.
+}
+
+func (u UnusedEndpoint) String() string {
+	pos := u.Pos
+	if pos == "" {
+		pos = "-"
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: channel %s %s", pos, u.Chan, u.Message)
+	for _, op := range u.Used {
+		fmt.Fprintf(&buf, "\n\t%s", op)
+	}
+	return buf.String()
+}
+
+// FindUnusedEndpoints returns the channels created in the program where a
+// direction is never used, ordered by creation site.
+func FindUnusedEndpoints(env *Environment) []UnusedEndpoint {
+	ops := make(map[string][]*ChanOp)
+	signal := make(map[string]bool)
+	for ch, chOps := range env.ChanOps {
+		ops[ch.UniqName()] = append(ops[ch.UniqName()], chOps...)
+	}
+	for ch := range env.signals {
+		signal[ch.UniqName()] = true
+	}
+	for ch := range env.deadlines {
+		signal[ch.UniqName()] = true
+	}
+	var unused []UnusedEndpoint
+	for name, pos := range env.Chans {
+		if signal[name] {
+			continue
+		}
+		var sent, recvd bool
+		var used []string
+		for _, op := range ops[name] {
+			switch op.Op {
+			case opSend, opClose:
+				sent = true
+			case opRecv:
+				recvd = true
+			}
+			used = append(used, fmt.Sprintf("%s: %s via %s in %s", env.opPos(op), op.Op, op.Local.Name(), op.fnName()))
+		}
+		u := UnusedEndpoint{Chan: name, Pos: pos, Used: dedup(used)}
+		switch {
+		case sent && recvd:
+			continue
+		case sent:
+			u.Unused, u.Message = "recv", "is sent to but never received from"
+		case recvd:
+			u.Unused, u.Message = "send", "is received from but never sent to or closed"
+		default:
+			u.Unused, u.Message = "send/recv", "is created but never used"
+		}
+		unused = append(unused, u)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		if unused[i].Pos != unused[j].Pos {
+			return unused[i].Pos < unused[j].Pos
+		}
+		return unused[i].Chan < unused[j].Chan
+	})
+	return unused
+}
+
+// dedup returns ss without duplicates, in order of first occurrence.
+func dedup(ss []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -9,6 +9,9 @@ import (
 )
 
 func isChan(k store.Key) bool {
+	if isContext(k.Type()) || isErrgroup(k.Type()) {
+		return true
+	}
 	switch t := k.Type().Underlying().(type) {
 	case *types.Chan:
 		return true
@@ -22,6 +25,9 @@ func isChan(k store.Key) bool {
 }
 
 func isStruct(k store.Key) bool {
+	if isErrgroup(k.Type()) { // errgroup.Group is a channel.
+		return false
+	}
 	switch t := k.Type().Underlying().(type) {
 	case *types.Struct:
 		return true
@@ -34,3 +40,9 @@ func isStruct(k store.Key) bool {
 	}
 	return false
 }
+
+// isUndefined returns true if v is a placeholder for an undefined value.
+func isUndefined(v store.Value) bool {
+	_, ok := v.(store.MockValue)
+	return ok
+}
@@ -0,0 +1,206 @@
+package migoinfer
+
+// Integer transition systems.
+//
+// The termination of the loops of a function is checked on its integer
+// transition system: a function symbol per basic block, whose arguments are
+// the integer parameters and φ-nodes of the function, and a rewrite rule per
+// edge of the control flow graph, guarded by the branch condition. Values
+// which are not integers (or are results of calls) are unconstrained
+// variables, and conditions which cannot be expressed (e.g. !=) are dropped,
+// so the system over-approximates the function.
+
+import (
+	"bufio"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/sym"
+	gossa "golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// itsUnsafe matches the characters of names not accepted in function symbols
+// and variables.
+var itsUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// loopFuncs returns the functions of the analysed packages with loops, in
+// order of position.
+func loopFuncs(info *ssa.Info) []*gossa.Function {
+	src := make(map[*gossa.Package]bool)
+	for _, p := range info.LProg.InitialPackages() {
+		src[info.Prog.Package(p.Pkg)] = true
+	}
+	var fns []*gossa.Function
+	for fn := range ssautil.AllFunctions(info.Prog) {
+		if fn.Pkg != nil && src[fn.Pkg] && fn.Synthetic == "" && hasLoop(fn) {
+			fns = append(fns, fn)
+		}
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].Pos() < fns[j].Pos() })
+	return fns
+}
+
+// hasLoop returns true if fn has a back edge.
+func hasLoop(fn *gossa.Function) bool {
+	for _, b := range fn.Blocks {
+		for _, s := range b.Succs {
+			if s.Dominates(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteITS writes the integer transition system of fn to w in the format of
+// KITTeL, e.g. for i := 0; i < n; i++ {} is
+//
+//	eval_main_count_start(v_n, v_t0) -> eval_main_count_0(v_n, v_t0)
+//	eval_main_count_0(v_n, v_t0) -> eval_main_count_3(v_n, 0)
+//	eval_main_count_1(v_n, v_t0) -> eval_main_count_3(v_n, (v_t0 + 1))
+//	eval_main_count_3(v_n, v_t0) -> eval_main_count_1(v_n, v_t0) [ v_t0 < v_n ]
+func WriteITS(w io.Writer, fn *gossa.Function) error {
+	var vars []gossa.Value
+	for _, p := range fn.Params {
+		if e, ok := sym.FromValue(p, nil); ok && e.Sort() == sym.Int {
+			vars = append(vars, p)
+		}
+	}
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if phi, ok := instr.(*gossa.Phi); ok {
+				if e, ok := sym.FromValue(phi, nil); ok && e.Sort() == sym.Int {
+					vars = append(vars, phi)
+				}
+			}
+		}
+	}
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = itsVar(sym.Var{Name: fn.String() + "." + v.Name()})
+	}
+	args := strings.Join(names, ", ")
+	head := "eval_" + itsUnsafe.ReplaceAllString(fn.String(), "_")
+
+	bufw := bufio.NewWriter(w)
+	if len(fn.Blocks) > 0 {
+		fmt.Fprintf(bufw, "%s_start(%s) -> %s_0(%s)\n", head, args, head, args)
+	}
+	for _, b := range fn.Blocks {
+		cond, _ := b.Instrs[len(b.Instrs)-1].(*gossa.If)
+		for i, s := range b.Succs {
+			next := make([]string, len(vars))
+			for j, v := range vars {
+				next[j] = names[j]
+				if phi, ok := v.(*gossa.Phi); ok && phi.Block() == s {
+					next[j] = itsExpr(phi.Edges[predIndex(s, b)])
+				}
+			}
+			guard := ""
+			if cond != nil {
+				guard = itsGuard(cond.Cond, i == 0)
+			}
+			fmt.Fprintf(bufw, "%s_%d(%s) -> %s_%d(%s)%s\n", head, b.Index, args, head, s.Index, strings.Join(next, ", "), guard)
+		}
+	}
+	return bufw.Flush()
+}
+
+// predIndex returns the index of pred in the predecessors of b.
+func predIndex(b, pred *gossa.BasicBlock) int {
+	for i, p := range b.Preds {
+		if p == pred {
+			return i
+		}
+	}
+	return 0
+}
+
+// itsGuard returns the guard of the then (or else) branch of condition cond,
+// or empty if the condition cannot be expressed.
+func itsGuard(cond gossa.Value, then bool) string {
+	e, ok := sym.FromValue(cond, nil)
+	if !ok {
+		return ""
+	}
+	if !then {
+		e = sym.Negate(e)
+	}
+	if n, ok := e.(sym.Not); ok { // Negated comparison.
+		if b, ok := n.X.(sym.Binary); ok {
+			if op, ok := negCmp[b.Op]; ok {
+				e = sym.Binary{Op: op, X: b.X, Y: b.Y}
+			}
+		}
+	}
+	if atom, ok := itsAtom(e); ok {
+		return " [ " + atom + " ]"
+	}
+	return ""
+}
+
+// negCmp are the negations of the comparisons.
+var negCmp = map[token.Token]token.Token{
+	token.EQL: token.NEQ,
+	token.NEQ: token.EQL,
+	token.LSS: token.GEQ,
+	token.LEQ: token.GTR,
+	token.GTR: token.LEQ,
+	token.GEQ: token.LSS,
+}
+
+// itsAtom returns the constraint of a comparison of integers.
+func itsAtom(e sym.Expr) (string, bool) {
+	b, ok := e.(sym.Binary)
+	if !ok || b.X.Sort() != sym.Int || b.Y.Sort() != sym.Int {
+		return "", false
+	}
+	switch b.Op {
+	case token.EQL:
+		return fmt.Sprintf("%s == %s", itsTerm(b.X), itsTerm(b.Y)), true
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return fmt.Sprintf("%s %s %s", itsTerm(b.X), b.Op, itsTerm(b.Y)), true
+	}
+	return "", false // Disequalities are not expressed.
+}
+
+// itsExpr returns the term of integer value v.
+func itsExpr(v gossa.Value) string {
+	e, ok := sym.FromValue(v, nil)
+	if !ok {
+		return itsVar(sym.Var{Name: v.Name()})
+	}
+	return itsTerm(e)
+}
+
+// itsTerm returns the term of integer expression e.
+func itsTerm(e sym.Expr) string {
+	switch e := e.(type) {
+	case sym.Var:
+		return itsVar(e)
+	case sym.Const:
+		if constant.Sign(e.Value) < 0 {
+			return fmt.Sprintf("(0 - %s)", constant.UnaryOp(token.SUB, e.Value, 0).ExactString())
+		}
+		return e.Value.ExactString()
+	case sym.Binary:
+		return fmt.Sprintf("(%s %s %s)", itsTerm(e.X), e.Op, itsTerm(e.Y))
+	}
+	return itsVar(sym.Var{Name: e.String()})
+}
+
+// itsVar returns the variable of v, by its name without the function.
+func itsVar(v sym.Var) string {
+	name := v.Name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return "v_" + itsUnsafe.ReplaceAllString(name, "_")
+}
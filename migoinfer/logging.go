@@ -0,0 +1,64 @@
+package migoinfer
+
+import (
+	"log"
+
+	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Verbosity levels of the log of the inference.
+const (
+	Quiet   = -1 // Errors only.
+	Normal  = 0  // Warnings and errors.
+	Verbose = 1  // Progress of the inference.
+	Debug   = 2  // Every step of the inference.
+)
+
+// LogOptions are the options of the log of the inference.
+type LogOptions struct {
+	Level int      // Verbosity level, e.g. Normal.
+	JSON  bool     // Log entries in JSON instead of text.
+	Func  string   // Log at Level only the functions with name containing Func (all if empty), and others at Normal.
+	Files []string // Files to write the log to, in addition to stderr.
+}
+
+// SetLogOptions replaces the log of the inference with a leveled, structured
+// log with opts. Entries of the analysis of a function carry the package and
+// the function as fields.
+func (i *Inferer) SetLogOptions(opts LogOptions) {
+	l := newLeveledLogger(opts.Level, opts.JSON, opts.Files)
+	unfocused := l
+	if opts.Func != "" && opts.Level > Normal {
+		unfocused = newLeveledLogger(Normal, opts.JSON, opts.Files)
+	}
+	i.Logger = migoinfer.NewLogger(l, unfocused, opts.Func)
+}
+
+// newLeveledLogger returns a new logger at verbosity level, writing to stderr
+// and files.
+func newLeveledLogger(level int, json bool, files []string) *zap.SugaredLogger {
+	cfg := zap.NewProductionConfig()
+	if !json {
+		cfg.Encoding = "console"
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+	switch {
+	case level <= Quiet:
+		cfg.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
+	case level == Normal:
+		cfg.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+	case level == Verbose:
+		cfg.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	default:
+		cfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+		cfg.Sampling = nil // Keep every step.
+	}
+	cfg.OutputPaths = append(cfg.OutputPaths, files...)
+	l, err := cfg.Build()
+	if err != nil {
+		log.Fatal("Cannot create new logger:", err)
+	}
+	return l.Sugar()
+}
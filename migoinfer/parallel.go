@@ -0,0 +1,317 @@
+package migoinfer
+
+import (
+	"log"
+	"runtime"
+	"sync"
+
+	"github.com/nickng/gospal/metrics"
+	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
+	"github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/tracing"
+	gossa "golang.org/x/tools/go/ssa"
+)
+
+// AnalyseParallel infers the MiGo program as Analyse, with the entry points
+// of the program (the main functions, and the functions with the entrypoint
+// directive) analysed concurrently by workers goroutines (GOMAXPROCS if
+// workers < 1).
+//
+// The definitions of a function depend on the bindings of its callers, so
+// the unit of work is an entry point, analysed from the top-level context
+// as by Analyse (after the package initialisers if not a main function), and a function called by several entry points is
+// analysed once per entry point. The entry points are grouped by the
+// strongly connected components of the static callgraph, and scheduled
+// bottom-up, i.e. an entry point is analysed once the entry points it calls
+// are analysed. Each entry point is analysed in its own environment, and the
+// definitions emitted are merged deterministically in the order of Analyse:
+// the definition of a name is taken from the first entry point emitting it.
+//
+// If summaries are reused (see ReuseSummaries), the summaries computed by the
+// analysis of an entry point are shared with the analyses of the entry points
+// calling it, so a callee is analysed once per summary key across workers
+// rather than once per analysis. The summary reused for a key is the one of
+// the first entry point (by function name) computing it, and the definitions
+// of summaries are named after the key and the callee, so the output does not
+// depend on the number of workers or the order of the analyses.
+//
+// A program with a single entry point, or analysed from the entry function
+// (see SetEntryFunc) or as a stream (see Stream), is analysed by Analyse.
+func (i *Inferer) AnalyseParallel(workers int) {
+	entries, err := i.entries()
+	if err != nil || i.EntryFunc != "" || i.stream || len(entries) < 2 {
+		i.Analyse()
+		return
+	}
+	defer metrics.Inference.Start()()
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	i.Env.Span = tracing.Start(nil, "inference", tracing.Int("workers", workers))
+	defer i.Env.Span.End()
+	cg, err := i.Info.BuildCallGraph("static", false)
+	if err != nil {
+		log.Fatal("Cannot build callgraph:", err)
+	}
+	entry := make(map[*gossa.Function]entrypoint)
+	for _, e := range entries {
+		entry[e.fn] = e
+	}
+
+	// Components of the entry points, callees before callers.
+	var sccs [][]*gossa.Function
+	scc := make(map[*gossa.Function]int)
+	for _, c := range cg.SCCs() {
+		var fns []*gossa.Function
+		for _, fn := range c {
+			if _, ok := entry[fn]; ok {
+				scc[fn] = len(sccs)
+				fns = append(fns, fn)
+			}
+		}
+		if len(fns) > 0 {
+			sccs = append(sccs, fns)
+		}
+	}
+	deps := make([]int, len(sccs))      // Number of callee components not analysed.
+	callers := make([][]int, len(sccs)) // Caller components.
+	callees := make([][]int, len(sccs)) // Callee components.
+	for c, fns := range sccs {
+		seen := make(map[int]bool)
+		for _, fn := range fns {
+			for _, callee := range reachable(cg, fn) {
+				if d, ok := scc[callee]; ok && d != c && !seen[d] {
+					seen[d] = true
+					callers[d] = append(callers[d], c)
+					callees[c] = append(callees[c], d)
+					deps[c]++
+				}
+			}
+		}
+	}
+	// Components analysed before each component, i.e. whose summaries are
+	// shared with it.
+	below := make([]map[int]bool, len(sccs))
+	for c := range sccs {
+		below[c] = make(map[int]bool)
+		for _, callee := range callees[c] {
+			below[c][callee] = true
+			for d := range below[callee] {
+				below[c][d] = true
+			}
+		}
+	}
+	var shared *migoinfer.SharedSummaries
+	if i.Env.ReuseSummaries {
+		shared = migoinfer.NewSharedSummaries()
+	}
+
+	results := make(map[*gossa.Function]*Inferer)
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		ready = make(chan int, len(sccs))
+	)
+	for c := range sccs {
+		if deps[c] == 0 {
+			ready <- c
+		}
+	}
+	wg.Add(len(sccs))
+	for w := 0; w < workers; w++ {
+		go func() {
+			for c := range ready {
+				for _, fn := range sccs[c] {
+					inferer, pkg, stop := i.worker()
+					inferer.Env.Shared = shared
+					inferer.Env.SharedVisible = func(owner *gossa.Function) bool {
+						d, ok := scc[owner]
+						return ok && below[c][d]
+					}
+					if !entry[fn].main {
+						inferer.visitInits(pkg)
+					}
+					inferer.analyseEntrypoint(entry[fn])
+					if shared != nil {
+						inferer.Env.PublishSummaries(shared, fn)
+					}
+					stop()
+					mu.Lock()
+					results[fn] = inferer
+					mu.Unlock()
+				}
+				mu.Lock()
+				for _, caller := range callers[c] {
+					if deps[caller]--; deps[caller] == 0 {
+						ready <- caller
+					}
+				}
+				mu.Unlock()
+				wg.Done()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ready)
+	i.merge(entries, results)
+	if !i.Raw {
+		i.Env.Prog.CleanUp()
+	}
+	i.writeProg()
+}
+
+// reachable returns the functions reachable from fn in the callgraph cg.
+func reachable(cg *ssa.CallGraph, fn *gossa.Function) []*gossa.Function {
+	var fns []*gossa.Function
+	seen := map[*gossa.Function]bool{fn: true}
+	for todo := []*gossa.Function{fn}; len(todo) > 0; {
+		n := cg.Graph().Nodes[todo[0]]
+		todo = todo[1:]
+		if n == nil {
+			continue
+		}
+		for _, e := range n.Out {
+			if callee := e.Callee.Func; !seen[callee] {
+				seen[callee] = true
+				fns = append(fns, callee)
+				todo = append(todo, callee)
+			}
+		}
+	}
+	return fns
+}
+
+// worker returns a new Inferer for an independent analysis, configured as i,
+// the package visitor with the globals of the program initialised, and the
+// function to call when the analysis is done.
+func (i *Inferer) worker() (*Inferer, *migoinfer.Package, func()) {
+	w := New(i.Info, nil)
+	w.errWriter = i.errWriter
+	w.Logger = i.Logger
+	w.Env.Models = i.Env.Models
+	w.Env.Hooks = i.Env.Hooks
+	w.Env.CallGraph = i.Env.CallGraph
+	w.Env.Solver = i.Env.Solver
+	w.Env.Impls = i.Env.Impls
+	w.Env.SummariseSilent = i.Env.SummariseSilent
+	w.Env.ReuseSummaries = i.Env.ReuseSummaries
+	w.Env.Filter = i.Env.Filter
+	w.Env.Span = i.Env.Span
+	stop := w.handleErrors()
+	pkg := migoinfer.NewPackage(&w.Env)
+	pkg.SetLogger(w.Logger)
+	for _, p := range w.Info.Prog.AllPackages() {
+		pkg.InitGlobals(p)
+	}
+	return w, pkg, stop
+}
+
+// merge merges the programs and environments of the analyses of each entry
+// point in results into i, in the order of entries.
+func (i *Inferer) merge(entries []entrypoint, results map[*gossa.Function]*Inferer) {
+	var fns []*gossa.Function
+	for _, e := range entries {
+		fns = append(fns, e.fn)
+	}
+	defs := make(map[string]bool)
+	for _, fn := range fns {
+		for _, f := range results[fn].Env.Prog.Funcs {
+			if name := f.SimpleName(); !defs[name] {
+				defs[name] = true
+				i.Env.Prog.AddFunction(f)
+			}
+		}
+	}
+	for _, fn := range fns {
+		for _, sum := range results[fn].Env.SharedUsed() {
+			for _, f := range sum.Funcs {
+				if name := f.SimpleName(); !defs[name] {
+					defs[name] = true
+					i.Env.Prog.AddFunction(f)
+				}
+			}
+			mergeShared(&i.Env, sum)
+		}
+	}
+	for _, fn := range fns {
+		env := &results[fn].Env
+		for def, dirs := range env.ChanDirs {
+			if _, ok := i.Env.ChanDirs[def]; !ok {
+				i.Env.ChanDirs[def] = dirs
+			}
+		}
+		for _, m := range []struct{ from, to map[string]string }{
+			{env.BranchConds, i.Env.BranchConds},
+			{env.Spawns, i.Env.Spawns},
+			{env.Chans, i.Env.Chans},
+		} {
+			for k, v := range m.from {
+				if _, ok := m.to[k]; !ok {
+					m.to[k] = v
+				}
+			}
+		}
+		for ch, t := range env.Timers {
+			i.Env.Timers[ch] = t
+		}
+		for ch, ops := range env.ChanOps {
+			i.Env.ChanOps[ch] = append(i.Env.ChanOps[ch], ops...)
+		}
+		i.Env.SpawnEdges = append(i.Env.SpawnEdges, env.SpawnEdges...)
+		for _, t := range env.Truncated {
+			if !hasTruncated(i.Env.Truncated, t) {
+				i.Env.Truncated = append(i.Env.Truncated, t)
+			}
+		}
+		for _, s := range env.Silent {
+			if !hasSilent(i.Env.Silent, s) {
+				i.Env.Silent = append(i.Env.Silent, s)
+			}
+		}
+		for key, e := range env.LockOrder {
+			if _, ok := i.Env.LockOrder[key]; !ok {
+				i.Env.LockOrder[key] = e
+			}
+		}
+	}
+}
+
+// mergeShared merges the maps of the definitions of shared summary sum into
+// env.
+func mergeShared(env *migoinfer.Environment, sum *migoinfer.SharedSummary) {
+	for def, dirs := range sum.ChanDirs {
+		if _, ok := env.ChanDirs[def]; !ok {
+			env.ChanDirs[def] = dirs
+		}
+	}
+	for def, cond := range sum.BranchConds {
+		if _, ok := env.BranchConds[def]; !ok {
+			env.BranchConds[def] = cond
+		}
+	}
+	for def, pos := range sum.Spawns {
+		if _, ok := env.Spawns[def]; !ok {
+			env.Spawns[def] = pos
+		}
+	}
+}
+
+// hasSilent returns true if spawn s is in spawns.
+func hasSilent(spawns []migoinfer.SilentGoroutine, s migoinfer.SilentGoroutine) bool {
+	for _, spawn := range spawns {
+		if spawn == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTruncated returns true if truncated unrolling t is in truncated.
+func hasTruncated(truncated []migoinfer.TruncatedUnroll, t migoinfer.TruncatedUnroll) bool {
+	for _, u := range truncated {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package migoinfer
+
+import (
+	"sync"
+
+	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
+	"github.com/nickng/gospal/store"
+	"github.com/nickng/migo"
+	gossa "golang.org/x/tools/go/ssa"
+)
+
+// A CallHandler handles a static call of a function in place of inference
+// (i.e. the function body is not analysed), e.g. the Publish method of a
+// pub/sub library modelled as a send. ret is the value returned by the call,
+// or nil if the call is deferred. It returns true if the call is fully
+// handled, or false to analyse the call as usual.
+type CallHandler func(e *Emitter, call *gossa.CallCommon, ret gossa.Value) bool
+
+// An InstrHandler handles SSA instruction instr in place of inference, and
+// returns true if the instruction is fully handled. InstrHandlers are tried
+// in order of registration before the builtin inference of each instruction,
+// except control flow instructions (Jump, If, Return and Phi).
+type InstrHandler func(e *Emitter, instr gossa.Instruction) bool
+
+// Emitter gives handlers access to the values of the current context (in the
+// store of the analysis) and emits MiGo statements in the current definition.
+type Emitter struct {
+	v *migoinfer.Instruction
+}
+
+// Func returns the function being analysed.
+func (e *Emitter) Func() *gossa.Function { return e.v.Callee.Function() }
+
+// Get returns the value of v in the current context, e.g. a channel.
+func (e *Emitter) Get(v gossa.Value) store.Value { return e.v.Get(v) }
+
+// Put binds k to value v in the current context, e.g. the result of a call to
+// an existing channel.
+func (e *Emitter) Put(k store.Key, v store.Value) { e.v.Put(k, v) }
+
+// NewChan binds value (e.g. the result of a call) to a new channel with buffer
+// size, created by instr.
+func (e *Emitter) NewChan(instr gossa.Instruction, value gossa.Value, size int64) {
+	e.v.NewChan(instr, value, size)
+}
+
+// Send emits a send on channel ch by instr.
+func (e *Emitter) Send(instr gossa.Instruction, ch gossa.Value) { e.v.EmitSend(instr, ch) }
+
+// Recv emits a receive from channel ch by instr.
+func (e *Emitter) Recv(instr gossa.Instruction, ch gossa.Value) { e.v.EmitRecv(instr, ch) }
+
+// Close emits a close of channel ch by instr.
+func (e *Emitter) Close(instr gossa.Instruction, ch gossa.Value) { e.v.EmitClose(instr, ch) }
+
+// Spawn spawns function value fn (e.g. a callback argument of the call) with
+// args as a goroutine.
+func (e *Emitter) Spawn(fn gossa.Value, args ...gossa.Value) { e.v.Spawn(fn, args...) }
+
+// Emit emits arbitrary MiGo statements, e.g. a τ (internal) action.
+func (e *Emitter) Emit(stmts ...migo.Statement) { e.v.Emit(stmts...) }
+
+// Pos returns the source position of instr.
+func (e *Emitter) Pos(instr gossa.Instruction) string { return e.v.Pos(instr) }
+
+// registry is the handlers registered for all inferers.
+var registry struct {
+	sync.Mutex
+	calls  map[string]CallHandler
+	instrs []InstrHandler
+}
+
+// RegisterCall registers h as the handler of static calls of function name
+// (format: see ssa.Function.String, e.g. "(*example.com/pubsub.Topic).Publish")
+// for inferers created afterwards. It is intended to be called from the init
+// function of the package providing the handler.
+func RegisterCall(name string, h CallHandler) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.calls == nil {
+		registry.calls = make(map[string]CallHandler)
+	}
+	registry.calls[name] = h
+}
+
+// RegisterInstr registers h as a handler of instructions for inferers created
+// afterwards (see RegisterCall).
+func RegisterInstr(h InstrHandler) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.instrs = append(registry.instrs, h)
+}
+
+// registerHandlers adds the registered handlers to inferer i.
+func (i *Inferer) registerHandlers() {
+	registry.Lock()
+	defer registry.Unlock()
+	for name, h := range registry.calls {
+		i.HandleCall(name, h)
+	}
+	for _, h := range registry.instrs {
+		i.HandleInstr(h)
+	}
+}
+
+// HandleCall uses h to handle static calls of function name (see
+// RegisterCall), replacing the builtin model of the function if any.
+func (i *Inferer) HandleCall(name string, h CallHandler) {
+	i.Env.Models[name] = func(v *migoinfer.Instruction, c *gossa.CallCommon, ret gossa.Value) bool {
+		return h(&Emitter{v: v}, c, ret)
+	}
+}
+
+// HandleInstr uses h to handle instructions (see RegisterInstr).
+func (i *Inferer) HandleInstr(h InstrHandler) {
+	i.Env.Hooks = append(i.Env.Hooks, func(v *migoinfer.Instruction, instr gossa.Instruction) bool {
+		return h(&Emitter{v: v}, instr)
+	})
+}
@@ -0,0 +1,130 @@
+package migoinfer
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/srcmap"
+	gossa "golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// SourceMap returns the source map of the inferred MiGo program, which maps
+// its definitions, spawns, branch conditions, channels and channel operations
+// to the Go source (see package srcmap for the identifiers of the elements).
+func (i *Inferer) SourceMap() *srcmap.Map {
+	m := srcmap.New()
+	fset := i.Info.FSet
+	fns := i.Env.DefFuncs()
+	var byName map[string]*gossa.Function // Functions by name, for entry points.
+	spawns := i.spawnSites()
+	for _, f := range i.Env.Prog.Funcs {
+		name := f.SimpleName()
+		base, blk := name, -1
+		if idx := strings.Index(name, "#"); idx >= 0 {
+			base = name[:idx]
+			if n, err := strconv.Atoi(name[idx+1:]); err == nil {
+				blk = n
+			}
+		}
+		fn, ok := fns[base]
+		if !ok {
+			if byName == nil {
+				byName = make(map[string]*gossa.Function)
+				for fn := range ssautil.AllFunctions(i.Info.Prog) {
+					byName[fn.String()] = fn
+				}
+			}
+			fn = byName[base]
+		}
+		if fn != nil {
+			start, end := funcSpan(fn, blk)
+			if start.IsValid() {
+				m.Add(name, "def", srcmap.MakeSpan(fset.Position(start), fset.Position(end)))
+			}
+		}
+		if spawn, ok := spawns[name]; ok {
+			m.Add(name+"/spawn", "spawn", pointSpan(spawn))
+		}
+		if cond, ok := i.Env.BranchConds[name]; ok {
+			if idx := strings.Index(cond, "\t"); idx >= 0 {
+				m.Add(name+"/cond", "cond", pointSpan(cond[idx+1:]))
+			}
+		}
+	}
+	for ch, pos := range i.Env.Chans {
+		m.Add("chan:"+ch, "chan", pointSpan(pos))
+	}
+
+	// Operations of each definition, numbered in source order.
+	type opKey struct {
+		def, kind string
+		pos       token.Pos
+	}
+	seen := make(map[opKey]bool)
+	var ops []opKey
+	for _, chOps := range i.Env.ChanOps {
+		for _, op := range chOps {
+			k := opKey{def: op.Def, kind: op.Op.String(), pos: op.Pos}
+			if !seen[k] && op.Pos.IsValid() {
+				seen[k] = true
+				ops = append(ops, k)
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].def != ops[j].def {
+			return ops[i].def < ops[j].def
+		}
+		if ops[i].kind != ops[j].kind {
+			return ops[i].kind < ops[j].kind
+		}
+		return ops[i].pos < ops[j].pos
+	})
+	count := make(map[string]int)
+	for _, k := range ops {
+		id := fmt.Sprintf("%s/%s/%d", k.def, k.kind, count[k.def+"/"+k.kind])
+		count[k.def+"/"+k.kind]++
+		m.Add(id, k.kind, srcmap.MakeSpan(fset.Position(k.pos), token.Position{}))
+	}
+	m.Sort()
+	return m
+}
+
+// funcSpan returns the span of fn, or of its block blk if blk is not -1.
+func funcSpan(fn *gossa.Function, blk int) (start, end token.Pos) {
+	if blk < 0 {
+		if syn := fn.Syntax(); syn != nil {
+			return syn.Pos(), syn.End()
+		}
+		return fn.Pos(), token.NoPos
+	}
+	if blk >= len(fn.Blocks) {
+		return token.NoPos, token.NoPos
+	}
+	for _, instr := range fn.Blocks[blk].Instrs {
+		pos := instr.Pos()
+		if !pos.IsValid() {
+			continue
+		}
+		if !start.IsValid() || pos < start {
+			start = pos
+		}
+		if pos > end {
+			end = pos
+		}
+	}
+	if end == start {
+		end = token.NoPos
+	}
+	return start, end
+}
+
+// pointSpan returns the span of position pos (file:line:col).
+func pointSpan(pos string) srcmap.Span {
+	return srcmap.MakeSpan(diag.ParsePos(pos), token.Position{})
+}
@@ -0,0 +1,215 @@
+package migoinfer
+
+// Declarative summaries.
+//
+// A summary file declares the behaviour of external functions (e.g. of a
+// library which is not analysed) as data, in place of a CallHandler written in
+// Go. A summary file is a list of summaries in JSON, or in a subset of YAML
+// (see parseYAML), e.g.
+//
+//	# Behaviour of example.com/pubsub.
+//	- func: example.com/pubsub.NewTopic
+//	  effects:
+//	    - {op: newchan, chan: result, size: 1}
+//	- func: (*example.com/pubsub.Topic).Publish
+//	  params: [t, msg]
+//	  effects:
+//	    - op: send
+//	      chan: t
+//	- func: (*example.com/pubsub.Topic).Subscribe
+//	  params: [t, handler]
+//	  effects:
+//	    - op: spawn
+//	      func: handler
+//	      args: [t]
+//
+// where the parameters of effects are names of Params, or indices (strings,
+// e.g. "0") of the arguments of the call (the receiver first), and result is the value returned
+// by the call. The channel of an effect is the channel (in the store of the
+// analysis) the parameter refers to, e.g. a channel, or the channel bound to
+// the result of a constructor by newchan.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nickng/migo"
+	gossa "golang.org/x/tools/go/ssa"
+)
+
+// Summary is the declarative summary of the behaviour of a function.
+type Summary struct {
+	Func    string   `json:"func"`             // Function (see RegisterCall).
+	Params  []string `json:"params,omitempty"` // Names of the arguments.
+	Effects []Effect `json:"effects"`          // Effects of a call, in order.
+}
+
+// Effect is an effect of a call of a summarised function.
+type Effect struct {
+	Op   string   `json:"op"`             // send, recv, close, newchan, spawn or tau.
+	Chan string   `json:"chan,omitempty"` // Channel of send, recv, close and newchan.
+	Size int64    `json:"size,omitempty"` // Buffer size of newchan.
+	Func string   `json:"func,omitempty"` // Function value spawned by spawn.
+	Args []string `json:"args,omitempty"` // Arguments of the spawned function.
+}
+
+// resultParam is the parameter referring to the result of a call.
+const resultParam = "result"
+
+// ParseSummaries parses summaries from data, in YAML if yaml is set, or JSON
+// otherwise, and checks the parameters of their effects.
+func ParseSummaries(data []byte, yaml bool) ([]Summary, error) {
+	if yaml {
+		v, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var sums []Summary
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sums); err != nil {
+		return nil, err
+	}
+	for _, s := range sums {
+		if err := s.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Func, err)
+		}
+	}
+	return sums, nil
+}
+
+// ReadSummaries reads the summaries of file, in YAML if its extension is .yaml
+// or .yml, or JSON otherwise.
+func ReadSummaries(file string) ([]Summary, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(file)
+	sums, err := ParseSummaries(data, ext == ".yaml" || ext == ".yml")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return sums, nil
+}
+
+// AddSummaries uses summaries sums to handle the calls of their functions (see
+// HandleCall).
+func (i *Inferer) AddSummaries(sums []Summary) {
+	for _, s := range sums {
+		s := s
+		i.HandleCall(s.Func, s.handle)
+	}
+}
+
+// check returns an error if an effect of s is unknown, or refers to an unknown
+// parameter.
+func (s *Summary) check() error {
+	if s.Func == "" {
+		return fmt.Errorf("missing func")
+	}
+	for n, e := range s.Effects {
+		var params []string
+		switch e.Op {
+		case "send", "recv", "close", "newchan":
+			params = []string{e.Chan}
+		case "spawn":
+			params = append([]string{e.Func}, e.Args...)
+		case "tau":
+		default:
+			return fmt.Errorf("effect %d: unknown op %q", n, e.Op)
+		}
+		for _, p := range params {
+			if _, ok := s.param(p); !ok && p != resultParam {
+				return fmt.Errorf("effect %d: unknown parameter %q", n, p)
+			}
+		}
+	}
+	return nil
+}
+
+// param returns the index of the argument of parameter p of s.
+func (s *Summary) param(p string) (int, bool) {
+	for i, name := range s.Params {
+		if name == p {
+			return i, true
+		}
+	}
+	i, err := strconv.Atoi(p)
+	return i, err == nil && i >= 0
+}
+
+// value returns the value of parameter p of s in call c returning ret, or nil
+// if the call has no such argument.
+func (s *Summary) value(p string, c *gossa.CallCommon, ret gossa.Value) gossa.Value {
+	if p == resultParam {
+		return ret
+	}
+	if i, ok := s.param(p); ok && i < len(c.Args) {
+		return c.Args[i]
+	}
+	return nil
+}
+
+// handle is the CallHandler of s.
+func (s *Summary) handle(e *Emitter, c *gossa.CallCommon, ret gossa.Value) bool {
+	instr := callInstruction(e.Func(), c)
+	if instr == nil {
+		return false
+	}
+	for _, eff := range s.Effects {
+		switch eff.Op {
+		case "tau":
+			e.Emit(&migo.TauStatement{})
+			continue
+		case "spawn":
+			fn := s.value(eff.Func, c, ret)
+			if fn == nil {
+				continue
+			}
+			var args []gossa.Value
+			for _, a := range eff.Args {
+				if arg := s.value(a, c, ret); arg != nil {
+					args = append(args, arg)
+				}
+			}
+			e.Spawn(fn, args...)
+			continue
+		}
+		ch := s.value(eff.Chan, c, ret)
+		if ch == nil {
+			continue
+		}
+		switch eff.Op {
+		case "newchan":
+			e.NewChan(instr, ch, eff.Size)
+		case "send":
+			e.Send(instr, ch)
+		case "recv":
+			e.Recv(instr, ch)
+		case "close":
+			e.Close(instr, ch)
+		}
+	}
+	return true
+}
+
+// callInstruction returns the instruction of call c in fn.
+func callInstruction(fn *gossa.Function, c *gossa.CallCommon) gossa.Instruction {
+	for _, blk := range fn.Blocks {
+		for _, instr := range blk.Instrs {
+			if call, ok := instr.(gossa.CallInstruction); ok && call.Common() == c {
+				return instr
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+// Anonymous goroutines take the job id as an argument and capture the jobs
+// and acks channels.
+
+func main() {
+	jobs := make(chan int)
+	acks := make(chan bool)
+	for i := 0; i < 2; i++ {
+		go func(id int) {
+			jobs <- id
+			<-acks
+		}(i)
+	}
+	for i := 0; i < 2; i++ {
+		<-jobs
+		acks <- true
+	}
+}
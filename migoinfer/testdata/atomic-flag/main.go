@@ -0,0 +1,30 @@
+package main
+
+import "sync/atomic"
+
+// Workers loop until an atomic stop flag is set: stop is never set, but quit
+// is set by main.
+
+var stop, quit int32
+
+func worker(ch chan int) {
+	for atomic.LoadInt32(&stop) == 0 {
+		ch <- 1
+	}
+}
+
+func poller(ch chan int) {
+	for atomic.LoadInt32(&quit) == 0 {
+		ch <- 2
+	}
+}
+
+func main() {
+	ch := make(chan int)
+	go worker(ch)
+	<-ch
+	polls := make(chan int)
+	go poller(polls)
+	<-polls
+	atomic.StoreInt32(&quit, 1)
+}
@@ -0,0 +1,28 @@
+package main
+
+// stage forwards a value from in to out.
+type stage struct {
+	in, out chan int
+}
+
+func (s *stage) run() {
+	v := <-s.in
+	print(v)
+	s.out <- v
+}
+
+func main() {
+	ch0 := make(chan int)
+	from := ch0
+	to := make(chan int)
+	s := &stage{in: from, out: to}
+	go s.run()
+	for i := 0; i < 1; i++ {
+		from = to
+		to = make(chan int)
+		s := &stage{in: from, out: to}
+		go s.run()
+	}
+	go func(ch0 chan int) { ch0 <- 1 }(ch0)
+	print(<-to)
+}
@@ -0,0 +1,21 @@
+package main
+
+type config struct {
+	async bool
+	quiet bool
+}
+
+func notify(cfg config, ch chan int) {
+	if cfg.async && !cfg.quiet {
+		ch <- 1
+	}
+}
+
+func main() {
+	ch := make(chan int, 1)
+	notify(config{async: true}, ch)
+	select {
+	case <-ch:
+	default:
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+func main() {
+	ch := make(chan int, 2) // Every slot needed.
+	ch <- 1
+	ch <- 2
+	<-ch
+	<-ch
+
+	done := make(chan bool, 10) // Only needs 1.
+	done <- true
+	<-done
+}
@@ -0,0 +1,21 @@
+package main
+
+// Buffer sizes from package variables: n is only assigned a constant, m is
+// also assigned in reset, so its value at make is unknown.
+
+var (
+	n = 2
+	m = 3
+)
+
+func reset() {
+	m = 0
+}
+
+func main() {
+	a := make(chan int, n)
+	b := make(chan int, m)
+	a <- 1
+	b <- 1
+	reset()
+}
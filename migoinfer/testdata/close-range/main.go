@@ -0,0 +1,22 @@
+package main
+
+// The consumer ranging over ch is analysed before the producer closing ch.
+
+func consume(ch chan int, done chan struct{}) {
+	for range ch {
+	}
+	done <- struct{}{}
+}
+
+func produce(ch chan int) {
+	ch <- 1
+	close(ch)
+}
+
+func main() {
+	ch := make(chan int)
+	done := make(chan struct{})
+	go consume(ch, done)
+	go produce(ch)
+	<-done
+}
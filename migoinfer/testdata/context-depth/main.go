@@ -0,0 +1,19 @@
+package main
+
+// send is called directly by main, and through wrap.
+
+func send(ch chan int) {
+	ch <- 1
+}
+
+func wrap(ch chan int) {
+	send(ch)
+}
+
+func main() {
+	ch := make(chan int, 2)
+	send(ch)
+	wrap(ch)
+	<-ch
+	<-ch
+}
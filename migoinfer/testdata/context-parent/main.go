@@ -0,0 +1,19 @@
+package main
+
+import "context"
+
+func worker(ctx context.Context, done chan struct{}) {
+	<-ctx.Done()
+	done <- struct{}{}
+}
+
+func main() {
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, stop := context.WithCancel(parent)
+	defer stop()
+	done := make(chan struct{})
+	go worker(ctx, done)
+	cancel()
+	<-done
+	cancel()
+}
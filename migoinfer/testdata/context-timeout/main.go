@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func worker(ctx context.Context, done chan struct{}) {
+	<-ctx.Done()
+	done <- struct{}{}
+}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go worker(ctx, done)
+	<-done
+}
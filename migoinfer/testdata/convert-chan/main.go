@@ -0,0 +1,19 @@
+package main
+
+// Events is a named channel type.
+type Events chan int
+
+func produce(v interface{}) {
+	ch := v.(chan int)
+	ch <- 1
+}
+
+func consume(ev Events) {
+	print(<-ev)
+}
+
+func main() {
+	ch := make(chan int)
+	go produce(ch)
+	consume(Events(ch))
+}
@@ -0,0 +1,13 @@
+package main
+
+// Both main and closer close ch, so the second close panics.
+
+func closer(ch chan int) {
+	close(ch)
+}
+
+func main() {
+	ch := make(chan int)
+	go closer(ch)
+	close(ch)
+}
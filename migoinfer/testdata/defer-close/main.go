@@ -0,0 +1,32 @@
+package main
+
+// Deferred close at every exit of work (two returns), and a conditional
+// deferred close in maybe.
+
+func work(n int, results chan int, done chan struct{}) {
+	defer close(done)
+	if n > 0 {
+		results <- n
+		return
+	}
+	results <- 0
+}
+
+func maybe(n int, ch chan int) {
+	if n > 0 {
+		defer close(ch)
+	}
+	ch <- n
+}
+
+func main() {
+	results := make(chan int, 1)
+	done := make(chan struct{})
+	go work(1, results, done)
+	<-done
+	<-results
+
+	ch := make(chan int, 1)
+	maybe(2, ch)
+	<-ch
+}
@@ -0,0 +1,22 @@
+package main
+
+import "os"
+
+func main() {
+	n := len(os.Args)
+	//gospal:channel-cap 16
+	ch := make(chan int, n)
+	ch <- 1
+	drain(ch)
+}
+
+//gospal:assume-noeffect
+func drain(ch chan int) {
+	<-ch
+}
+
+//gospal:entrypoint
+func Serve() {
+	ch := make(chan int)
+	close(ch)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "golang.org/x/sync/errgroup"
+
+// Goroutines of an errgroup spawned in a loop, joined by g.Wait.
+
+func fetch(results chan int, i int) error {
+	results <- i
+	return nil
+}
+
+func main() {
+	results := make(chan int, 3)
+	var g errgroup.Group
+	for i := 0; i < 3; i++ {
+		i := i
+		g.Go(func() error { return fetch(results, i) })
+	}
+	g.Wait()
+	close(results)
+}
@@ -0,0 +1,22 @@
+package main
+
+// An event loop serves requests until it is told to stop.
+
+func loop(reqs chan int, done chan struct{}) {
+	for {
+		select {
+		case <-reqs:
+		case <-done:
+			return
+		}
+	}
+}
+
+func main() {
+	reqs := make(chan int)
+	done := make(chan struct{})
+	go loop(reqs, done)
+	reqs <- 1
+	reqs <- 2
+	done <- struct{}{}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// send is called in contexts which differ only in the value sent.
+func send(ch chan int, v int) {
+	ch <- v
+}
+
+func main() {
+	ch := make(chan int, 3)
+	n := len(os.Args)
+	send(ch, n)
+	send(ch, n+1)
+	send(ch, n+2)
+	fmt.Println(<-ch, <-ch, <-ch)
+}
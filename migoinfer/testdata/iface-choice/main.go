@@ -0,0 +1,21 @@
+package main
+
+type notifier interface {
+	notify(ch chan int)
+}
+
+type sender struct{}
+
+func (sender) notify(ch chan int) { ch <- 1 }
+
+type closer struct{}
+
+func (closer) notify(ch chan int) { close(ch) }
+
+func main() {
+	ch := make(chan int)
+	notifiers := []notifier{sender{}, closer{}}
+	n := notifiers[len("x")]
+	go n.notify(ch)
+	<-ch
+}
@@ -0,0 +1,30 @@
+package main
+
+// events is created by a package variable initialiser.
+var events = startEventLoop()
+
+var done chan struct{}
+
+func init() {
+	done = make(chan struct{})
+}
+
+func startEventLoop() chan int {
+	ch := make(chan int)
+	go func() {
+		for v := range ch {
+			print(v)
+		}
+	}()
+	return ch
+}
+
+func finish(done chan struct{}) {
+	close(done)
+}
+
+func main() {
+	events <- 1
+	go finish(done)
+	<-done
+}
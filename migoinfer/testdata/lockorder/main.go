@@ -0,0 +1,31 @@
+package main
+
+import "sync"
+
+// Bank acquires its locks in inconsistent orders (AB-BA).
+type Bank struct {
+	a, b sync.Mutex
+	done chan struct{}
+}
+
+func (k *Bank) AB() {
+	k.a.Lock()
+	k.b.Lock()
+	k.b.Unlock()
+	k.a.Unlock()
+	k.done <- struct{}{}
+}
+
+func (k *Bank) BA() {
+	k.b.Lock()
+	defer k.b.Unlock()
+	k.a.Lock()
+	k.a.Unlock()
+}
+
+func main() {
+	k := &Bank{done: make(chan struct{})}
+	go k.AB()
+	k.BA()
+	<-k.done
+}
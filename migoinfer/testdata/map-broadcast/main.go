@@ -0,0 +1,23 @@
+package main
+
+// Subscribers register channels in a map, which is ranged over to broadcast.
+
+func subscriber(ch chan int, done chan bool) {
+	<-ch
+	done <- true
+}
+
+func main() {
+	subs := make(map[string]chan int)
+	done := make(chan bool)
+	for _, name := range []string{"a", "b"} {
+		ch := make(chan int, 1)
+		subs[name] = ch
+		go subscriber(ch, done)
+	}
+	for _, ch := range subs {
+		ch <- 1
+	}
+	<-done
+	<-done
+}
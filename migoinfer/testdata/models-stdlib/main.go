@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+func main() {
+	hits := make(chan int, 1)
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		hits <- 1
+	})
+	done := make(chan struct{})
+	go func() {
+		exec.Command("true").Run()
+		s := bufio.NewScanner(strings.NewReader("input"))
+		for s.Scan() {
+		}
+		close(done)
+	}()
+	http.ListenAndServe(":8080", nil)
+	<-done
+	<-hits
+}
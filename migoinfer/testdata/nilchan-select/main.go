@@ -0,0 +1,21 @@
+package main
+
+// A nil channel disables its select case, and blocks forever otherwise.
+
+func main() {
+	var disabled chan int // nil.
+	ch := make(chan int)
+	go func() {
+		ch <- 1
+	}()
+	select {
+	case <-disabled:
+		print("never")
+	case v := <-ch:
+		print(v)
+	}
+	go func(nilch chan int) {
+		nilch <- 2 // Blocks forever.
+		close(ch)
+	}(disabled)
+}
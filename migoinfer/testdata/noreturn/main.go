@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// usage never returns, since it always calls log.Fatal.
+func usage() {
+	log.Fatal("usage: noreturn [arg]")
+}
+
+func main() {
+	ch := make(chan int)
+	go func() {
+		ch <- 1
+	}()
+	if len(os.Args) > 2 {
+		usage()
+		ch <- 2 // Not reached.
+	}
+	if len(os.Args) > 1 && os.Args[1] == "" {
+		panic("empty argument")
+	}
+	<-ch
+}
@@ -0,0 +1,30 @@
+package main
+
+// gen sends n on the returned channel.
+func gen(n int) <-chan int {
+	out := make(chan int)
+	go func() {
+		out <- n
+		close(out)
+	}()
+	return out
+}
+
+// sq squares the values received from in and sends them on the returned
+// channel.
+func sq(in <-chan int) <-chan int {
+	out := make(chan int)
+	go func() {
+		for n := range in {
+			out <- n * n
+		}
+		close(out)
+	}()
+	return out
+}
+
+func main() {
+	for n := range sq(gen(2)) {
+		print(n)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+// Topic is a pub/sub topic of an internal library, modelled by a plugin.
+type Topic struct{ subs []func(string) }
+
+func NewTopic() *Topic { return new(Topic) }
+
+func (t *Topic) Publish(msg string) {
+	for _, sub := range t.subs {
+		sub(msg)
+	}
+}
+
+func (t *Topic) Next() string { return "" }
+
+func main() {
+	t := NewTopic()
+	t.Publish("hello")
+	t.Next()
+}
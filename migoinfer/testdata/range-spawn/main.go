@@ -0,0 +1,27 @@
+package main
+
+// Each goroutine spawned in a loop drains the channel of its iteration, passed
+// as an argument or captured by a closure.
+
+func drain(ch chan int) {
+	<-ch
+}
+
+func main() {
+	chans := []chan int{make(chan int), make(chan int)}
+	for _, ch := range chans {
+		go drain(ch)
+	}
+	for _, ch := range chans {
+		ch <- 1
+	}
+	done := []chan int{make(chan int), make(chan int)}
+	for _, ch := range done {
+		go func() {
+			ch <- 2
+		}()
+	}
+	for _, ch := range done {
+		<-ch
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+// Mutually recursive ping and pong, in the same strongly connected component
+// of the callgraph.
+
+func ping(n int, a, b chan int) {
+	if n == 0 {
+		close(a)
+		return
+	}
+	a <- n
+	pong(n-1, a, b)
+}
+
+func pong(n int, a, b chan int) {
+	<-b
+	ping(n, a, b)
+}
+
+func main() {
+	a := make(chan int)
+	b := make(chan int)
+	go ping(3, a, b)
+	for range a {
+		b <- 0
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+// f spawns g which calls f, i.e. recursion through a go statement.
+
+func f(ch chan int, n int) {
+	if n > 0 {
+		go g(ch, n-1)
+	}
+	ch <- n
+}
+
+func g(ch chan int, n int) {
+	f(ch, n)
+}
+
+func main() {
+	ch := make(chan int)
+	go f(ch, 3)
+	<-ch
+}
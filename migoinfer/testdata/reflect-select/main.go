@@ -0,0 +1,23 @@
+package main
+
+import "reflect"
+
+// reflect.Select over cases built statically is a select over the channels,
+// and over cases built in a loop is a τ action.
+
+func main() {
+	a := make(chan int)
+	b := make(chan int, 1)
+	go func() { a <- 1 }()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(a)},
+		{Dir: reflect.SelectSend, Chan: reflect.ValueOf(b), Send: reflect.ValueOf(2)},
+	}
+	reflect.Select(cases)
+
+	var dynamic []reflect.SelectCase
+	for _, ch := range []chan int{a, b} {
+		dynamic = append(dynamic, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	reflect.Select(dynamic)
+}
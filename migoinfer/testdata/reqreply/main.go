@@ -0,0 +1,39 @@
+package main
+
+// Request/reply: the reply channel is sent to the server (in a request, or as
+// the value sent), and created by the client after the server is spawned.
+
+type request struct {
+	n     int
+	reply chan int
+}
+
+func server(reqs chan request) {
+	for {
+		req := <-reqs
+		req.reply <- req.n * 2
+	}
+}
+
+func client(reqs chan request) {
+	reply := make(chan int)
+	reqs <- request{n: 21, reply: reply}
+	<-reply
+}
+
+func echo(replies chan chan int) {
+	reply := <-replies
+	reply <- 1
+}
+
+func main() {
+	reqs := make(chan request)
+	go server(reqs)
+	client(reqs)
+
+	replies := make(chan chan int)
+	go echo(replies)
+	reply := make(chan int)
+	replies <- reply
+	<-reply
+}
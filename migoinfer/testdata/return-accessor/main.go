@@ -0,0 +1,19 @@
+package main
+
+// Conn is implemented elsewhere, so its methods have no body.
+type Conn struct {
+	id int
+}
+
+// Done returns the channel closed when c is closed.
+func (c *Conn) Done() chan struct{}
+
+func worker(done chan struct{}) {
+	done <- struct{}{}
+}
+
+func main() {
+	c := &Conn{}
+	go worker(c.Done())
+	<-c.Done()
+}
@@ -0,0 +1,9 @@
+package main
+
+func main() {
+	ch := make(chan int, 1)
+	select {
+	default:
+	}
+	ch <- 1
+}
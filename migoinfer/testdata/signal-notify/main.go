@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+)
+
+func main() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	<-sigs
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func compute() {
+	fmt.Println(fib(20))
+}
+
+func main() {
+	ch := make(chan int)
+	go compute()
+	go func() { ch <- fib(10) }()
+	<-ch
+}
@@ -0,0 +1,33 @@
+package main
+
+// Channels held in the fields of a struct are shared by all its methods.
+
+type server struct {
+	reqs chan int
+	quit chan struct{}
+}
+
+func newServer() *server {
+	return &server{reqs: make(chan int), quit: make(chan struct{})}
+}
+
+func (s *server) run() {
+	for {
+		select {
+		case <-s.reqs:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *server) Stop() {
+	s.quit <- struct{}{}
+}
+
+func main() {
+	s := newServer()
+	go s.run()
+	s.reqs <- 1
+	s.Stop()
+}
@@ -0,0 +1,11 @@
+package main
+
+import "time"
+
+func main() {
+	ch := make(chan int)
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "time"
+
+func main() {
+	ch := make(chan int)
+	t := time.NewTimer(time.Second)
+	select {
+	case <-ch:
+		t.Stop()
+	case <-t.C:
+	}
+}
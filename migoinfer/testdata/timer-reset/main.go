@@ -0,0 +1,20 @@
+package main
+
+import "time"
+
+func main() {
+	ch := make(chan int)
+	go func() {
+		ch <- 1
+	}()
+	t := time.NewTimer(time.Second)
+	for {
+		select {
+		case <-ch:
+			t.Stop()
+			return
+		case <-t.C:
+			t.Reset(time.Second)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import "time"
+
+func main() {
+	done := make(chan struct{})
+	go func() {
+		done <- struct{}{}
+	}()
+	t := time.NewTicker(time.Second)
+	for {
+		select {
+		case <-done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+func worker(ch chan int) {
+	ch <- 1
+}
+
+func main() {
+	var chs [3]chan int
+	// Distinct channel per iteration.
+	for i := 0; i < 3; i++ {
+		chs[i] = make(chan int)
+	}
+	for i := 0; i < 3; i++ {
+		go worker(chs[i])
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Println(<-chs[i])
+	}
+}
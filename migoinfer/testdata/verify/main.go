@@ -0,0 +1,17 @@
+package main
+
+import "os"
+
+func count(n int) int {
+	s := 0
+	for i := 0; i < n; i++ {
+		s += i
+	}
+	return s
+}
+
+func main() {
+	ch := make(chan int)
+	go func() { ch <- count(len(os.Args)) }()
+	<-ch
+}
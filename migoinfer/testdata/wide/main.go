@@ -0,0 +1,24 @@
+package main
+
+import "fmt"
+
+// send is called by each of the workers.
+func send(ch chan int, v int) {
+	ch <- v
+}
+
+func a(ch chan int) { send(ch, 1) }
+func b(ch chan int) { send(ch, 2) }
+func c(ch chan int) { send(ch, 3) }
+func d(ch chan int) { send(ch, 4) }
+
+func main() {
+	ch := make(chan int)
+	go a(ch)
+	go b(ch)
+	go c(ch)
+	go d(ch)
+	for i := 0; i < 4; i++ {
+		fmt.Println(<-ch)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// N workers range over a jobs channel and send on a results channel.
+
+func worker(jobs <-chan int, results chan<- int) {
+	for j := range jobs {
+		results <- j * 2
+	}
+}
+
+func main() {
+	jobs := make(chan int, 5)
+	results := make(chan int, 5)
+	for w := 0; w < 3; w++ {
+		go worker(jobs, results)
+	}
+	for j := 0; j < 5; j++ {
+		jobs <- j
+	}
+	close(jobs)
+	for a := 0; a < 5; a++ {
+		<-results
+	}
+}
@@ -0,0 +1,297 @@
+package migoinfer
+
+// External verifiers.
+//
+// A Verifier runs an external checker on the inferred program: it writes the
+// input in the dialect of the checker, runs the command of the checker on the
+// input file, and parses the verdict (and counterexample trace, if any) from
+// its output. Traces are mapped back to the source with migoinfer.Replay.
+//
+// Verifiers of the MiGo types (Gong) check liveness and safety of the
+// channels, assuming the loops of the program terminate; the termination of
+// the loops is checked by termination provers (KITTeL) on integer transition
+// systems of the functions.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/migoinfer/internal/migoinfer"
+	"github.com/nickng/gospal/tracing"
+)
+
+// Verifier is an external verifier of an inferred program.
+type Verifier interface {
+	// Name returns the name of the verifier.
+	Name() string
+
+	// Verify runs the verifier on the program inferred by i.
+	Verify(i *Inferer) (*Verdict, error)
+}
+
+// Property is a property checked by a verifier.
+type Property struct {
+	Name  string // e.g. "Liveness", or the function of a loop.
+	Holds bool   // Property shown to hold (or not shown if false).
+	Pos   string // Source position of the subject of the property, if any.
+}
+
+// Verdict is the result of an external verifier.
+type Verdict struct {
+	Tool       string
+	Properties []Property
+	Trace      []migoinfer.Step // Counterexample mapped to the source, if any.
+	Output     string           // Output of the verifier.
+	rule       diag.Rule        // Rule of the properties not shown.
+}
+
+// Holds returns true if all the properties hold.
+func (v *Verdict) Holds() bool {
+	for _, p := range v.Properties {
+		if !p.Holds {
+			return false
+		}
+	}
+	return len(v.Properties) > 0
+}
+
+// WriteTo writes the verdict to w, one property per line, followed by the
+// counterexample trace, e.g.
+//
+//	gong: Liveness: false
+//	gong: Safety: true
+//	trace:
+//	g0 main.main
+//	  1 newchan main.main0.t0_chan0                main.go:4:7
+func (v *Verdict) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if len(v.Properties) == 0 {
+		fmt.Fprintf(&buf, "%s: no verdict\n", v.Tool)
+	}
+	for _, p := range v.Properties {
+		if p.Pos != "" {
+			fmt.Fprintf(&buf, "%s: %s: %s: %t\n", p.Pos, v.Tool, p.Name, p.Holds)
+		} else {
+			fmt.Fprintf(&buf, "%s: %s: %t\n", v.Tool, p.Name, p.Holds)
+		}
+	}
+	if len(v.Trace) > 0 {
+		buf.WriteString("trace:\n")
+		migoinfer.WriteTrace(&buf, v.Trace)
+	}
+	return buf.WriteTo(w)
+}
+
+// Diagnostics returns the properties not shown as diagnostics, at the subject
+// of the property (or the first step of the trace with a position), with the
+// steps of the trace as related locations.
+func (v *Verdict) Diagnostics() []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	for _, p := range v.Properties {
+		if p.Holds {
+			continue
+		}
+		dg := diag.Diagnostic{
+			Rule:    v.rule,
+			Message: fmt.Sprintf("%s: %s not shown", v.Tool, p.Name),
+			Pos:     diag.ParsePos(p.Pos),
+		}
+		for _, s := range v.Trace {
+			pos := diag.ParsePos(s.Pos)
+			if pos.Filename == "" {
+				continue
+			}
+			if dg.Pos.Filename == "" {
+				dg.Pos = pos
+			}
+			dg.Related = append(dg.Related, diag.Location{Pos: pos, Message: s.String()})
+		}
+		diags = append(diags, dg)
+	}
+	return diags
+}
+
+// Verify runs verifier v on the inferred program.
+func (i *Inferer) Verify(v Verifier) (*Verdict, error) {
+	defer tracing.Start(nil, "verify", tracing.String("verifier", v.Name())).End()
+	return v.Verify(i)
+}
+
+// NewVerifier returns the verifier of the given name ("gong" or "kittel"),
+// running the command line cmd (fields separated by spaces) with the input
+// file as last argument, or the default command if cmd is empty.
+func NewVerifier(name, cmd string) (Verifier, error) {
+	switch strings.ToLower(name) {
+	case "gong":
+		if cmd == "" {
+			cmd = "Gong"
+		}
+		return &Gong{Command: strings.Fields(cmd)}, nil
+	case "kittel":
+		if cmd == "" {
+			cmd = "kittel"
+		}
+		return &KITTeL{Command: strings.Fields(cmd)}, nil
+	}
+	return nil, fmt.Errorf("unknown verifier %s (expecting gong or kittel)", name)
+}
+
+// runTool writes the input of a tool with write to a temporary file with the
+// given suffix, and runs command on the file. The output of the command is
+// returned unless the command cannot be started or fails without output.
+func runTool(command []string, suffix string, write func(io.Writer) error) (string, error) {
+	if len(command) == 0 {
+		return "", fmt.Errorf("no command")
+	}
+	f, err := ioutil.TempFile("", "gospal-*"+suffix)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(command[0], append(command[1:len(command):len(command)], f.Name())...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil && out.Len() == 0 {
+		return "", fmt.Errorf("%s: %v", command[0], err)
+	}
+	return out.String(), nil
+}
+
+// Gong is the verifier of liveness and safety of MiGo types, see
+// https://github.com/nickng/gong.
+type Gong struct {
+	Command []string // Command line of Gong.
+}
+
+// Name returns the name of Gong.
+func (*Gong) Name() string { return "gong" }
+
+var (
+	// gongIdent matches identifiers and keywords of MiGo.
+	gongIdent = regexp.MustCompile(`[^\s(),;:=]+`)
+	// gongUnsafe matches the characters of identifiers not accepted by Gong.
+	gongUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.]`)
+	// gongVerdict matches the verdict of a property, e.g. "Liveness: True".
+	gongVerdict = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z ]*[A-Za-z]):\s*(True|False)\s*$`)
+)
+
+// gongDialect returns the MiGo program in the dialect of Gong, i.e. with
+// main.main first and the characters of identifiers not accepted by Gong
+// (e.g. $ of closures) replaced, and the original names of the identifiers
+// renamed.
+func gongDialect(i *Inferer) (string, map[string]string) {
+	var buf bytes.Buffer
+	for _, f := range i.Env.Prog.Funcs {
+		if f.SimpleName() == "main.main" {
+			buf.WriteString(f.String())
+		}
+	}
+	for _, f := range i.Env.Prog.Funcs {
+		if f.SimpleName() != "main.main" {
+			buf.WriteString(f.String())
+		}
+	}
+	renamed := make(map[string]string) // Gong name → MiGo name.
+	names := make(map[string]string)   // MiGo name → Gong name.
+	prog := gongIdent.ReplaceAllStringFunc(buf.String(), func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		name := gongUnsafe.ReplaceAllString(id, "_")
+		for n := 1; name != id && (renamed[name] != "" || names[name] != ""); n++ {
+			name = fmt.Sprintf("%s_%d", gongUnsafe.ReplaceAllString(id, "_"), n)
+		}
+		if name != id {
+			renamed[name] = id
+		}
+		names[id] = name
+		return name
+	})
+	return prog, renamed
+}
+
+// Verify runs Gong on the MiGo program inferred by i, and parses the verdicts
+// of the properties, e.g. "Liveness: True", and the counterexample trace in
+// the format of migoinfer.ParseTrace, if any.
+func (g *Gong) Verify(i *Inferer) (*Verdict, error) {
+	prog, renamed := gongDialect(i)
+	out, err := runTool(g.Command, ".migo", func(w io.Writer) error {
+		_, err := io.WriteString(w, prog)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	v := &Verdict{Tool: g.Name(), Output: out, rule: diag.Verification}
+	var trace bytes.Buffer
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if m := gongVerdict.FindStringSubmatch(line); m != nil {
+			v.Properties = append(v.Properties, Property{Name: m[1], Holds: m[2] == "True"})
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) > 2 && strings.HasPrefix(fields[0], "g") && strings.HasSuffix(fields[1], ":") {
+			trace.WriteString(gongIdent.ReplaceAllStringFunc(line, func(id string) string {
+				if name, ok := renamed[id]; ok {
+					return name
+				}
+				return id
+			}) + "\n")
+		}
+	}
+	if trace.Len() > 0 {
+		steps, err := migoinfer.ParseTrace(&trace)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse trace of %s: %v", g.Name(), err)
+		}
+		v.Trace = migoinfer.Replay(&i.Env, steps)
+	}
+	return v, nil
+}
+
+// KITTeL is the termination prover of integer term rewrite systems, see
+// https://github.com/s-falke/kittel-koat. The termination of each function
+// with loops is checked separately.
+type KITTeL struct {
+	Command []string // Command line of KITTeL.
+}
+
+// Name returns the name of KITTeL.
+func (*KITTeL) Name() string { return "kittel" }
+
+// Verify runs KITTeL on the integer transition system of each function with
+// loops of the analysed packages (see WriteITS), in order of position.
+func (k *KITTeL) Verify(i *Inferer) (*Verdict, error) {
+	v := &Verdict{Tool: k.Name(), rule: diag.Termination}
+	var outs []string
+	for _, fn := range loopFuncs(i.Info) {
+		out, err := runTool(k.Command, ".kittel", func(w io.Writer) error { return WriteITS(w, fn) })
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+		v.Properties = append(v.Properties, Property{
+			Name:  "termination of " + fn.String(),
+			Holds: strings.Contains(out, "Termination successfully shown"),
+			Pos:   i.Info.FSet.Position(fn.Pos()).String(),
+		})
+	}
+	v.Output = strings.Join(outs, "\n")
+	return v, nil
+}
@@ -0,0 +1,273 @@
+package migoinfer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non-empty line of a YAML document without comments.
+type yamlLine struct {
+	num    int // Line number.
+	indent int
+	text   string
+}
+
+// yamlParser parses the block structure of a YAML document.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML parses the YAML document data, in a subset of YAML with block
+// mappings and sequences (indented by spaces), flow mappings and sequences of
+// scalars (e.g. [a, b] and {op: send, chan: t}), scalars (plain, or single or
+// double quoted), and comments. Anchors, tags, multi-line scalars and multiple
+// documents are not supported. Mappings are map[string]interface{}, sequences
+// are []interface{}, and scalars are strings, int64, bool or nil.
+func parseYAML(data []byte) (interface{}, error) {
+	p := new(yamlParser)
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return v, nil
+}
+
+// stripComment returns text without its comment, if any.
+func stripComment(text string) string {
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// isItem returns true if text is an item of a block sequence.
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// block parses the block (sequence or mapping) at the current line, indented
+// by indent.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(line.text[1:], " ")
+		switch {
+		case rest == "":
+			p.pos++
+			v, err := p.nested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		case splitKey(rest) >= 0 && !strings.HasPrefix(rest, "{"):
+			// Mapping in the item, e.g. - key: value, with the following
+			// keys aligned with key.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			v, err := p.mapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		default:
+			v, err := parseScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.num, err)
+			}
+			p.pos++
+			seq = append(seq, v)
+		}
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		if isItem(line.text) {
+			return nil, fmt.Errorf("line %d: expecting key: value but got a sequence item", line.num)
+		}
+		idx := splitKey(line.text)
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expecting key: value but got %q", line.num, line.text)
+		}
+		key, err := parseKey(line.text[:idx])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.num, err)
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+		if value := strings.TrimSpace(line.text[idx+1:]); value != "" {
+			if m[key], err = parseScalar(value); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.num, err)
+			}
+			continue
+		}
+		if m[key], err = p.nested(indent, true); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// nested parses the block nested in the line before the current line indented
+// by indent, or returns nil if there is none. The items of a sequence in a
+// mapping (inMapping) may be indented by indent.
+func (p *yamlParser) nested(indent int, inMapping bool) (interface{}, error) {
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || inMapping && next.indent == indent && isItem(next.text) {
+		return p.block(next.indent)
+	}
+	return nil, nil
+}
+
+// splitKey returns the index of the colon separating the key and the value of
+// text, or -1 if text is not a key: value pair.
+func splitKey(text string) int {
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case i == 0 && (r == '"' || r == '\''):
+			quote = r
+		case r == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+// parseKey returns the key of a mapping.
+func parseKey(key string) (string, error) {
+	v, err := parseScalar(strings.TrimSpace(key))
+	if err != nil {
+		return "", err
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// parseScalar parses scalar value, or a flow sequence or mapping of scalars.
+func parseScalar(value string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %s", value)
+		}
+		seq := []interface{}{}
+		for _, item := range splitFlow(value[1 : len(value)-1]) {
+			v, err := parseScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case strings.HasPrefix(value, "{"):
+		if !strings.HasSuffix(value, "}") {
+			return nil, fmt.Errorf("unterminated flow mapping %s", value)
+		}
+		m := make(map[string]interface{})
+		for _, item := range splitFlow(value[1 : len(value)-1]) {
+			idx := splitKey(item)
+			if idx < 0 {
+				return nil, fmt.Errorf("expecting key: value but got %q", item)
+			}
+			key, err := parseKey(item[:idx])
+			if err != nil {
+				return nil, err
+			}
+			if m[key], err = parseScalar(strings.TrimSpace(item[idx+1:])); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("unterminated string %s", value)
+		}
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	case value == "~" || value == "null":
+		return nil, nil
+	case value == "true" || value == "false":
+		return value == "true", nil
+	}
+	if i, err := strconv.ParseInt(value, 0, 64); err == nil {
+		return i, nil
+	}
+	return value, nil
+}
+
+// splitFlow splits the items of a flow sequence or mapping separated by commas
+// (outside quotes), without surrounding spaces.
+func splitFlow(items string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range items {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			parts = append(parts, strings.TrimSpace(items[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(items[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
@@ -0,0 +1,238 @@
+// Package pluscal generates PlusCal algorithms (TLA+) from MiGo programs, for
+// model checking with TLC.
+//
+// There is one algorithm per entry point, i.e. per top-level role of the
+// session of the program (see session.Extract), with one process per
+// goroutine spawned from the entry point. The statements of a process are the
+// states of the local type of the goroutine (see session.NewAutomaton), each
+// a label whose branches (either) are the transitions from the state.
+//
+// Channels are FIFO queues (sequences) in the variable chans, with their
+// capacities in Cap, and closed channels in the variable closed:
+//
+//   - a send on a buffered channel waits for a free slot and appends to the
+//     queue, and a send on an unbuffered channel waits for the queue to be
+//     empty, appends, and waits for a receiver to take the message,
+//   - a receive waits for a message, which it removes from the queue, or for
+//     the channel to be closed, and
+//   - a close sets the channel as closed.
+//
+// A send on an unbuffered channel in a select commits to its case once the
+// message is queued, i.e. before a receiver takes it.
+//
+// The TLC configuration of an algorithm checks the specification for
+// deadlocks, i.e. states where some goroutine is blocked forever, as
+// terminated processes are not deadlocked.
+package pluscal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/migo"
+)
+
+// Algorithm is the PlusCal algorithm of an entry point.
+type Algorithm struct {
+	Name  string          // Name of the module.
+	Entry string          // MiGo definition of the entry point.
+	Roles []*session.Role // Goroutines, the entry point first.
+
+	sizes map[string]int64
+}
+
+// Generate returns the algorithms of the entry points of prog.
+func Generate(prog *migo.Program) []*Algorithm {
+	sess := session.Extract(prog)
+	sizes := session.ChanSizes(prog)
+	var algs []*Algorithm
+	byRoot := make(map[*session.Role]*Algorithm)
+	used := make(map[string]bool)
+	for _, r := range sess.Roles {
+		root := r
+		for root.Spawner != nil {
+			root = root.Spawner
+		}
+		alg, ok := byRoot[root]
+		if !ok {
+			name := "Go_" + sanitise(root.Name)
+			for n := 1; used[name]; n++ {
+				name = fmt.Sprintf("Go_%s_%d", sanitise(root.Name), n)
+			}
+			used[name] = true
+			alg = &Algorithm{Name: name, Entry: root.Def, sizes: sizes}
+			byRoot[root] = alg
+			algs = append(algs, alg)
+		}
+		alg.Roles = append(alg.Roles, r)
+	}
+	return algs
+}
+
+// ident returns the identifier of the process of role name.
+func ident(name string) string {
+	return "P_" + sanitise(name)
+}
+
+// sanitise returns name with the characters not allowed in TLA+ identifiers
+// replaced.
+func sanitise(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// WriteTLA writes the module of alg with the algorithm to w. The translation
+// of the algorithm to TLA+ is added by the PlusCal translator.
+func (alg *Algorithm) WriteTLA(w io.Writer) error {
+	procs := make([]*process, len(alg.Roles))
+	chans := make(map[string]bool)
+	for i, r := range alg.Roles {
+		procs[i] = newProcess(r, i+1, alg.sizes)
+		for ch := range procs[i].chans {
+			chans[ch] = true
+		}
+	}
+	var chs []string
+	for ch := range chans {
+		chs = append(chs, ch)
+	}
+	sort.Strings(chs)
+	var names, caps []string
+	for _, ch := range chs {
+		names = append(names, fmt.Sprintf("%q", ch))
+		caps = append(caps, fmt.Sprintf("%q :> %d", ch, alg.sizes[ch]))
+	}
+
+	bufw := bufio.NewWriter(w)
+	fmt.Fprintf(bufw, "---- MODULE %s ----\n", alg.Name)
+	fmt.Fprintf(bufw, "\\* Entry point %s.\n", alg.Entry)
+	bufw.WriteString("EXTENDS Naturals, Sequences, TLC\n\n")
+	fmt.Fprintf(bufw, "Chans == {%s}\n", strings.Join(names, ", "))
+	if len(caps) == 0 {
+		bufw.WriteString("Cap == [c \\in Chans |-> 0]\n\n")
+	} else {
+		fmt.Fprintf(bufw, "Cap == %s\n\n", strings.Join(caps, " @@ "))
+	}
+	fmt.Fprintf(bufw, "(* --algorithm %s\n", alg.Name)
+	bufw.WriteString("variables\n  chans = [c \\in Chans |-> <<>>],\n  closed = [c \\in Chans |-> FALSE];\n\n")
+	for _, p := range procs {
+		p.write(bufw)
+	}
+	bufw.WriteString("end algorithm; *)\n====\n")
+	return bufw.Flush()
+}
+
+// WriteCfg writes the TLC configuration of alg to w.
+func (alg *Algorithm) WriteCfg(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "\\* TLC configuration of %s.\nSPECIFICATION Spec\nCHECK_DEADLOCK TRUE\n", alg.Name)
+	return err
+}
+
+// process is the PlusCal process of a role.
+type process struct {
+	role  *session.Role
+	id    int
+	a     *session.Automaton
+	sizes map[string]int64
+	chans map[string]bool
+}
+
+func newProcess(r *session.Role, id int, sizes map[string]int64) *process {
+	p := &process{role: r, id: id, a: session.NewAutomaton(r.Type), sizes: sizes, chans: make(map[string]bool)}
+	for _, t := range p.a.Transitions {
+		if t.Msg != nil {
+			p.chans[t.Msg.Chan] = true
+		}
+	}
+	return p
+}
+
+// label returns the label of state s of p.
+func (p *process) label(s int) string {
+	return fmt.Sprintf("p%d_s%d", p.id, s)
+}
+
+// target returns the goto target of state s of p.
+func (p *process) target(s int) string {
+	if s == p.a.Final {
+		return "Done"
+	}
+	return p.label(s)
+}
+
+func (p *process) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "\\* Goroutine %s.\nprocess %s = %d\nbegin\n", p.role.Name, ident(p.role.Name), p.id)
+	from := make(map[int][]session.Transition)
+	for _, t := range p.a.Transitions {
+		from[t.Src] = append(from[t.Src], t)
+	}
+	var acks []string // Labels waiting for receivers of unbuffered sends.
+	for s := 0; s < p.a.States; s++ {
+		if s == p.a.Final {
+			continue
+		}
+		fmt.Fprintf(w, "  %s:\n", p.label(s))
+		trs := from[s]
+		switch len(trs) {
+		case 0:
+			w.WriteString("    await FALSE;\n")
+		case 1:
+			p.writeTransition(w, trs[0], 0, "    ", &acks)
+		default:
+			for i, t := range trs {
+				if i == 0 {
+					w.WriteString("    either\n")
+				} else {
+					w.WriteString("    or\n")
+				}
+				p.writeTransition(w, t, i, "      ", &acks)
+			}
+			w.WriteString("    end either;\n")
+		}
+	}
+	for _, ack := range acks {
+		w.WriteString(ack)
+	}
+	w.WriteString("end process;\n\n")
+}
+
+// writeTransition writes transition t (the i-th from its state) indented by
+// indent, and adds the label waiting for the receiver of an unbuffered send
+// to acks.
+func (p *process) writeTransition(w *bufio.Writer, t session.Transition, i int, indent string, acks *[]string) {
+	m := t.Msg
+	if m == nil {
+		fmt.Fprintf(w, "%sgoto %s;\n", indent, p.target(t.Dst))
+		return
+	}
+	ch := fmt.Sprintf("%q", m.Chan)
+	switch {
+	case m.Send && m.Label == "close":
+		fmt.Fprintf(w, "%s\\* close %s\n%sclosed[%s] := TRUE;\n", indent, m.Chan, indent, ch)
+	case m.Send && p.sizes[m.Chan] > 0:
+		fmt.Fprintf(w, "%s\\* send %s\n%sawait Len(chans[%s]) < Cap[%s];\n", indent, m.Label, indent, ch, ch)
+		fmt.Fprintf(w, "%schans[%s] := Append(chans[%s], %q);\n", indent, ch, ch, m.Label)
+	case m.Send:
+		ack := fmt.Sprintf("%s_ack%d", p.label(t.Src), i)
+		fmt.Fprintf(w, "%s\\* send %s\n%sawait chans[%s] = <<>>;\n", indent, m.Label, indent, ch)
+		fmt.Fprintf(w, "%schans[%s] := Append(chans[%s], %q);\n", indent, ch, ch, m.Label)
+		fmt.Fprintf(w, "%sgoto %s;\n", indent, ack)
+		*acks = append(*acks, fmt.Sprintf("  %s:\n    await chans[%s] = <<>>;\n    goto %s;\n", ack, ch, p.target(t.Dst)))
+		return
+	default:
+		fmt.Fprintf(w, "%s\\* recv %s\n%sawait chans[%s] /= <<>> \\/ closed[%s];\n", indent, m.Label, indent, ch, ch)
+		fmt.Fprintf(w, "%sif chans[%s] /= <<>> then\n%s  chans[%s] := Tail(chans[%s]);\n%send if;\n", indent, ch, indent, ch, ch, indent)
+	}
+	fmt.Fprintf(w, "%sgoto %s;\n", indent, p.target(t.Dst))
+}
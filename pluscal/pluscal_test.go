@@ -0,0 +1,54 @@
+package pluscal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests the algorithm of a program with a goroutine sending to main.
+func TestGenerate(t *testing.T) {
+	info, err := build.FromFiles("../migoinfer/testdata/verify/main.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	var alg *Algorithm
+	for _, a := range Generate(inferer.Env.Prog) {
+		if a.Entry == "main.main" {
+			alg = a
+		}
+	}
+	if alg == nil || alg.Name != "Go_main_main" || len(alg.Roles) != 2 {
+		t.Fatalf("Algorithm of main.main mismatch:\nExpect:\t%s with 2 processes\nGot:\t%+v\n", "Go_main_main", alg)
+	}
+	var buf bytes.Buffer
+	if err := alg.WriteTLA(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tla := buf.String()
+	for _, expect := range []string{
+		"---- MODULE Go_main_main ----",
+		"(* --algorithm Go_main_main",
+		"process P_main_main = 1\nbegin\n  p1_s0:\n",
+		"process P_main_main_1 = 2",
+		"_ack0:\n    await chans[\"",
+		"goto Done;",
+		"end algorithm; *)\n====\n",
+	} {
+		if !strings.Contains(tla, expect) {
+			t.Errorf("Expecting %q in module:\n%s", expect, tla)
+		}
+	}
+	buf.Reset()
+	if err := alg.WriteCfg(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "CHECK_DEADLOCK TRUE") {
+		t.Errorf("Expecting deadlock check in configuration:\n%s", buf.String())
+	}
+}
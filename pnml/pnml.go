@@ -0,0 +1,243 @@
+// Package pnml translates MiGo programs to place/transition Petri nets in the
+// Petri Net Markup Language (PNML), for analysis with Petri net tools, e.g.
+// the boundedness of channels or the reachability of markings.
+//
+// Each role of the session of the program (see session.Extract), i.e. each
+// goroutine, is a state machine whose places are the states of its local type
+// (see session.NewAutomaton), marked by one token at its initial state. Roles
+// start at the start of the program, i.e. the net over-approximates the
+// interleavings of goroutines with their spawns. Channels are places:
+//
+//   - the occupancy of a buffered channel c is place buf:c, with the free
+//     slots of c in place free:c (initially the capacity of c), so a send
+//     moves a token from free:c to buf:c and a receive back,
+//   - a send and a receive on an unbuffered channel is a single transition
+//     (rendezvous) of the roles of the sender and the receiver, and
+//   - a close of a channel c puts a token in place closed:c, enabling the
+//     receives from c. A marking with two tokens in closed:c is a double
+//     close. Receives from closed channels are enabled before the buffer of
+//     the channel is empty, as there are no inhibitor arcs.
+package pnml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/migo"
+)
+
+// Place is a place of a net.
+type Place struct {
+	ID      string
+	Name    string
+	Initial int // Initial marking.
+}
+
+// Transition is a transition of a net.
+type Transition struct {
+	ID   string
+	Name string
+}
+
+// Arc is an arc of a net from a place to a transition or back.
+type Arc struct {
+	Source, Target string
+	Weight         int
+}
+
+// Net is a place/transition net.
+type Net struct {
+	Name        string
+	Places      []*Place
+	Transitions []*Transition
+	Arcs        []*Arc
+
+	places map[string]*Place  // Places, by name.
+	arcs   map[[2]string]*Arc // Arcs, by source and target.
+}
+
+// endpoint is a send or receive of a role on a channel.
+type endpoint struct {
+	role     string
+	src, dst *Place
+}
+
+// New returns the net of prog.
+func New(prog *migo.Program) *Net {
+	n := &Net{Name: "migo", places: make(map[string]*Place), arcs: make(map[[2]string]*Arc)}
+	sizes := session.ChanSizes(prog)
+	sends := make(map[string][]endpoint) // Unbuffered sends, by channel.
+	recvs := make(map[string][]endpoint) // Receives, by channel.
+	closed := make(map[string]bool)
+	for _, r := range session.Extract(prog).Roles {
+		a := session.NewAutomaton(r.Type)
+		state := func(s int) *Place {
+			if s == a.Final {
+				return n.place(fmt.Sprintf("%s.end", r.Name), 0)
+			}
+			return n.place(fmt.Sprintf("%s.%d", r.Name, s), 0)
+		}
+		state(0).Initial = 1
+		for _, tr := range a.Transitions {
+			src, dst := state(tr.Src), state(tr.Dst)
+			m := tr.Msg
+			switch {
+			case m == nil:
+				n.transition(r.Name+": tau", []*Place{src}, []*Place{dst})
+			case m.Send && m.Label == "close":
+				closed[m.Chan] = true
+				n.transition(r.Name+": close "+m.Chan, []*Place{src}, []*Place{dst, n.place("closed:"+m.Chan, 0)})
+			case sizes[m.Chan] > 0:
+				buf, free := n.place("buf:"+m.Chan, 0), n.place("free:"+m.Chan, int(sizes[m.Chan]))
+				if m.Send {
+					n.transition(r.Name+": send "+m.Chan, []*Place{src, free}, []*Place{dst, buf})
+				} else {
+					n.transition(r.Name+": recv "+m.Chan, []*Place{src, buf}, []*Place{dst, free})
+				}
+			case m.Send:
+				sends[m.Chan] = append(sends[m.Chan], endpoint{role: r.Name, src: src, dst: dst})
+			}
+			if m != nil && !m.Send {
+				recvs[m.Chan] = append(recvs[m.Chan], endpoint{role: r.Name, src: src, dst: dst})
+			}
+		}
+	}
+	var chans []string
+	for ch := range recvs {
+		chans = append(chans, ch)
+	}
+	sort.Strings(chans)
+	for _, ch := range chans {
+		for _, r := range recvs[ch] {
+			if sizes[ch] > 0 {
+				continue
+			}
+			for _, s := range sends[ch] {
+				if s.role != r.role {
+					n.transition(fmt.Sprintf("%s → %s: %s", s.role, r.role, ch), []*Place{s.src, r.src}, []*Place{s.dst, r.dst})
+				}
+			}
+		}
+		if closed[ch] {
+			c := n.place("closed:"+ch, 0)
+			for _, r := range recvs[ch] {
+				n.transition(r.role+": recv "+ch+" (closed)", []*Place{r.src, c}, []*Place{r.dst, c})
+			}
+		}
+	}
+	return n
+}
+
+// place returns the place name, added with initial marking if it does not
+// exist.
+func (n *Net) place(name string, initial int) *Place {
+	if p, ok := n.places[name]; ok {
+		return p
+	}
+	p := &Place{ID: fmt.Sprintf("p%d", len(n.Places)), Name: name, Initial: initial}
+	n.Places = append(n.Places, p)
+	n.places[name] = p
+	return p
+}
+
+// transition adds a transition name from places in to places out.
+func (n *Net) transition(name string, in, out []*Place) {
+	t := &Transition{ID: fmt.Sprintf("t%d", len(n.Transitions)), Name: name}
+	n.Transitions = append(n.Transitions, t)
+	for _, p := range in {
+		n.arc(p.ID, t.ID)
+	}
+	for _, p := range out {
+		n.arc(t.ID, p.ID)
+	}
+}
+
+// arc adds an arc from source to target, or increments its weight.
+func (n *Net) arc(source, target string) {
+	key := [2]string{source, target}
+	if a, ok := n.arcs[key]; ok {
+		a.Weight++
+		return
+	}
+	a := &Arc{Source: source, Target: target, Weight: 1}
+	n.Arcs = append(n.Arcs, a)
+	n.arcs[key] = a
+}
+
+// Place returns the place name, or nil if it does not exist.
+func (n *Net) Place(name string) *Place {
+	return n.places[name]
+}
+
+// PNML documents.
+type (
+	text struct {
+		Text string `xml:"text"`
+	}
+	pnmlPlace struct {
+		ID      string `xml:"id,attr"`
+		Name    text   `xml:"name"`
+		Marking *text  `xml:"initialMarking,omitempty"`
+	}
+	pnmlTransition struct {
+		ID   string `xml:"id,attr"`
+		Name text   `xml:"name"`
+	}
+	pnmlArc struct {
+		ID          string `xml:"id,attr"`
+		Source      string `xml:"source,attr"`
+		Target      string `xml:"target,attr"`
+		Inscription *text  `xml:"inscription,omitempty"`
+	}
+	pnmlDoc struct {
+		XMLName xml.Name `xml:"http://www.pnml.org/version-2009/grammar/pnml pnml"`
+		Net     struct {
+			ID   string `xml:"id,attr"`
+			Type string `xml:"type,attr"`
+			Name text   `xml:"name"`
+			Page struct {
+				ID          string           `xml:"id,attr"`
+				Places      []pnmlPlace      `xml:"place"`
+				Transitions []pnmlTransition `xml:"transition"`
+				Arcs        []pnmlArc        `xml:"arc"`
+			} `xml:"page"`
+		} `xml:"net"`
+	}
+)
+
+// WritePNML writes n to w in PNML.
+func (n *Net) WritePNML(w io.Writer) error {
+	var doc pnmlDoc
+	doc.Net.ID, doc.Net.Type, doc.Net.Name.Text = "net", "http://www.pnml.org/version-2009/grammar/ptnet", n.Name
+	doc.Net.Page.ID = "page"
+	for _, p := range n.Places {
+		pp := pnmlPlace{ID: p.ID, Name: text{p.Name}}
+		if p.Initial > 0 {
+			pp.Marking = &text{fmt.Sprint(p.Initial)}
+		}
+		doc.Net.Page.Places = append(doc.Net.Page.Places, pp)
+	}
+	for _, t := range n.Transitions {
+		doc.Net.Page.Transitions = append(doc.Net.Page.Transitions, pnmlTransition{ID: t.ID, Name: text{t.Name}})
+	}
+	for i, a := range n.Arcs {
+		pa := pnmlArc{ID: fmt.Sprintf("a%d", i), Source: a.Source, Target: a.Target}
+		if a.Weight > 1 {
+			pa.Inscription = &text{fmt.Sprint(a.Weight)}
+		}
+		doc.Net.Page.Arcs = append(doc.Net.Page.Arcs, pa)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
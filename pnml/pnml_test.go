@@ -0,0 +1,46 @@
+package pnml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests the net of a program with a goroutine sending to main on an
+// unbuffered channel.
+func TestNew(t *testing.T) {
+	info, err := build.FromFiles("../migoinfer/testdata/verify/main.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	n := New(inferer.Env.Prog)
+	if p := n.Place("main.main.0"); p == nil || p.Initial != 1 {
+		t.Errorf("Initial place of main.main mismatch:\nExpect:\t%d\nGot:\t%v\n", 1, p)
+	}
+	found := false
+	for _, tr := range n.Transitions {
+		found = found || strings.HasPrefix(tr.Name, "main.main$1 → main.main: ")
+	}
+	if !found {
+		t.Errorf("Expecting rendezvous of main.main$1 and main.main but got %v", n.Transitions)
+	}
+
+	var buf bytes.Buffer
+	if err := n.WritePNML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc pnmlDoc
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid PNML: %v\n%s", err, buf.String())
+	}
+	if len(doc.Net.Page.Places) != len(n.Places) || len(doc.Net.Page.Arcs) != len(n.Arcs) {
+		t.Errorf("Size of net mismatch:\nExpect:\t%d places %d arcs\nGot:\t%d places %d arcs\n",
+			len(n.Places), len(n.Arcs), len(doc.Net.Page.Places), len(doc.Net.Page.Arcs))
+	}
+}
@@ -0,0 +1,143 @@
+// Package protocoltest checks protocol tests with go test, keeping protocol
+// specifications and the code implementing them in sync.
+//
+// A protocol test is a test function named TestProtocolXxx, with a protocol
+// directive giving the protocol specification of the test (see
+// session.ParseSpec), which calls Check, e.g.
+//
+//	//gospal:protocol testdata/pingpong.proto
+//	func TestProtocolPingPong(t *testing.T) {
+//		ping, reply := make(chan int), make(chan int)
+//		go pong(ping, reply)
+//		ping <- 1
+//		<-reply
+//		protocoltest.Check(t)
+//	}
+//
+// The test runs the protocol, and Check infers the session of the test
+// function statically, failing the test if a role deviates from the
+// specification.
+package protocoltest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/ssa/build"
+	gossa "golang.org/x/tools/go/ssa"
+)
+
+// Prefix is the prefix of the names of protocol tests.
+const Prefix = "TestProtocol"
+
+// checkFunc is Check, which is not analysed in protocol tests.
+const checkFunc = "github.com/nickng/gospal/protocoltest.Check"
+
+// loaded is the package under test with its tests, built once per test
+// binary.
+var loaded struct {
+	sync.Mutex
+	info *ssa.Info
+	err  error
+}
+
+// load returns the program of the package in the current directory (i.e. the
+// package under test) with its tests.
+func load() (*ssa.Info, error) {
+	loaded.Lock()
+	defer loaded.Unlock()
+	if loaded.info == nil && loaded.err == nil {
+		loaded.info, loaded.err = build.FromPackages(".").WithTests(true).Default().Build()
+	}
+	return loaded.info, loaded.err
+}
+
+// A Test is a protocol test function (named TestProtocolXxx) whose session is
+// checked against the protocol specification of its protocol directive (see
+// ssa.Protocol).
+type Test struct {
+	Func *gossa.Function
+	Spec string // Path of the protocol specification.
+}
+
+// Tests returns the protocol tests of the program info, in source order.
+func Tests(info *ssa.Info) []Test {
+	var tests []Test
+	for obj := range info.Directives.Funcs {
+		dir, ok := info.Directives.Func(obj, ssa.Protocol)
+		if !ok || !strings.HasPrefix(obj.Name(), Prefix) {
+			continue
+		}
+		fn := info.Prog.FuncValue(obj)
+		if fn == nil {
+			continue
+		}
+		spec := dir.Arg
+		if !filepath.IsAbs(spec) {
+			spec = filepath.Join(filepath.Dir(info.FSet.Position(dir.Pos).Filename), spec)
+		}
+		tests = append(tests, Test{Func: fn, Spec: spec})
+	}
+	sort.Slice(tests, func(a, b int) bool { return tests[a].Func.Pos() < tests[b].Func.Pos() })
+	return tests
+}
+
+// Conform analyses protocol test pt of program info from the test function
+// only (see migoinfer.Inferer.AnalyseEntry), and returns the deviations of the
+// session of the test from its protocol specification.
+func Conform(info *ssa.Info, pt Test) ([]session.Deviation, error) {
+	f, err := os.Open(pt.Spec)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	spec, err := session.ParseSpec(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", pt.Spec, err)
+	}
+	inferer := migoinfer.New(info, ioutil.Discard)
+	inferer.SkipFunc(checkFunc)
+	inferer.AnalyseEntry(pt.Func)
+	return session.Extract(inferer.Env.Prog).Conform(spec, inferer.Env.Spawns, inferer.Env.Chans), nil
+}
+
+// Check checks protocol test t, i.e. the session of the test function of t
+// against the protocol specification of its protocol directive, and reports
+// the deviations as errors of t.
+func Check(t *testing.T) {
+	t.Helper()
+	name := t.Name()
+	if i := strings.Index(name, "/"); i >= 0 { // Subtest.
+		name = name[:i]
+	}
+	if !strings.HasPrefix(name, Prefix) {
+		t.Fatalf("%s is not a protocol test (%sXxx)", name, Prefix)
+	}
+	info, err := load()
+	if err != nil {
+		t.Fatalf("Cannot build package under test: %v", err)
+	}
+	for _, pt := range Tests(info) {
+		if pt.Func.Name() != name {
+			continue
+		}
+		devs, err := Conform(info, pt)
+		if err != nil {
+			t.Fatalf("Cannot check protocol: %v", err)
+		}
+		for _, d := range devs {
+			t.Error(d.String())
+		}
+		return
+	}
+	t.Fatalf("%s has no %s%s directive", name, ssa.DirectivePrefix, ssa.Protocol)
+}
@@ -0,0 +1,21 @@
+package protocoltest_test
+
+import (
+	"testing"
+
+	"github.com/nickng/gospal/protocoltest"
+)
+
+func pong(ping, reply chan int) {
+	x := <-ping
+	reply <- x
+}
+
+//gospal:protocol testdata/pingpong.proto
+func TestProtocolPingPong(t *testing.T) {
+	ping, reply := make(chan int), make(chan int)
+	go pong(ping, reply)
+	ping <- 1
+	<-reply
+	protocoltest.Check(t)
+}
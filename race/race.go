@@ -0,0 +1,559 @@
+// Package race implements a conservative static data race detector.
+//
+// The detector finds shared variables accessed by goroutines which may happen
+// in parallel (MHP), where at least one of the accesses is a write, and the
+// accesses are not protected by a common lock.
+//
+// Goroutines are identified by their spawn sites (go statements), starting
+// from main.main. Functions called (statically) by a goroutine are part of the
+// goroutine; a goroutine spawned in a loop (or by a goroutine with many
+// instances) has many instances which may run in parallel with each other.
+//
+// Shared variables are package variables, variables captured by reference by
+// closures, and struct fields. Struct fields are identified by their type and
+// name, i.e. fields of different objects of the same type are not
+// distinguished. Elements of slices and maps are not tracked.
+//
+// Locks held at each access (locksets) are computed by a dataflow analysis of
+// sync.Mutex and sync.RWMutex Lock/Unlock calls (see absint.Locks), where a
+// lock held on every path to an access protects it. Locks are identified the
+// same way as shared variables.
+//
+// Two accesses in different goroutines are ordered (i.e. do not race) if
+//
+//   - one is in a package initialiser, which runs before main.main,
+//   - one is in the spawning goroutine before the go statement (i.e. not
+//     reachable from the go statement), or
+//   - the spawned goroutine signals the spawner by a send on (or close of) a
+//     channel or sync.WaitGroup.Done after the access, and the access of the
+//     spawner is only reachable after a receive on the channel (or
+//     sync.WaitGroup.Wait).
+//
+// Calls to dynamically dispatched functions and spawns of function values are
+// not followed, and functions in the standard library are not analysed.
+package race
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/nickng/gospal/absint"
+	"github.com/nickng/gospal/diag"
+	gssa "github.com/nickng/gospal/ssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Access is an access to a shared variable.
+type Access struct {
+	Pos       token.Position // Position of the access.
+	Write     bool           // Access is a write.
+	Goroutine string         // Root function of the goroutine.
+
+	instr  ssa.Instruction
+	anchor ssa.Instruction // Instruction in the goroutine root function.
+	locks  absint.LockSet
+	thread *thread
+}
+
+func (a Access) String() string {
+	op := "read"
+	if a.Write {
+		op = "write"
+	}
+	return fmt.Sprintf("%s: %s in goroutine %s", a.Pos, op, a.Goroutine)
+}
+
+// Race is a pair of conflicting accesses to a shared variable.
+type Race struct {
+	Var           string // Shared variable.
+	First, Second Access
+}
+
+func (r Race) String() string {
+	return fmt.Sprintf("data race on %s\n\t%s\n\t%s", r.Var, r.First, r.Second)
+}
+
+// Diagnostic returns the race as a diagnostic at the first access, with the
+// second access as related location.
+func (r Race) Diagnostic() diag.Diagnostic {
+	return diag.Diagnostic{
+		Rule:    diag.DataRace,
+		Message: fmt.Sprintf("data race on %s: %s", r.Var, r.First),
+		Pos:     r.First.Pos,
+		Related: []diag.Location{{Pos: r.Second.Pos, Message: "conflicting " + r.Second.String()}},
+	}
+}
+
+// thread is a goroutine.
+type thread struct {
+	root    *ssa.Function
+	name    string
+	spawner *thread
+	spawn   *ssa.Go         // Spawn site (nil for main).
+	anchor  ssa.Instruction // Spawn site in the spawner root function.
+	multi   bool            // Many instances may run in parallel.
+	free    map[*ssa.FreeVar]ssa.Value
+}
+
+// detector holds the state of race detection.
+type detector struct {
+	fset     *token.FileSet
+	threads  []*thread
+	spawned  map[spawnKey]*thread
+	accesses map[string][]*Access // By shared variable.
+	names    map[string]string    // Names of shared variables.
+	reach    map[[2]ssa.Instruction]map[ssa.Instruction]bool
+}
+
+type spawnKey struct {
+	spawn   *ssa.Go
+	spawner *thread
+}
+
+// Check returns the data races in the main packages of the program.
+func Check(info *gssa.Info) ([]Race, error) {
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		return nil, err
+	}
+	d := detector{
+		fset:     info.FSet,
+		spawned:  make(map[spawnKey]*thread),
+		accesses: make(map[string][]*Access),
+		names:    make(map[string]string),
+		reach:    make(map[[2]ssa.Instruction]map[ssa.Instruction]bool),
+	}
+	for _, main := range mains {
+		mainFn := main.Func("main")
+		if mainFn == nil {
+			continue
+		}
+		t := &thread{root: mainFn, name: mainFn.String(), free: make(map[*ssa.FreeVar]ssa.Value)}
+		d.threads = append(d.threads, t)
+		if initFn := main.Func("init"); initFn != nil {
+			d.analyse(t, initFn)
+		}
+		d.analyse(t, mainFn)
+	}
+	return d.races(), nil
+}
+
+// isStd returns true if the package path is in the standard library.
+func isStd(fn *ssa.Function) bool {
+	if fn.Pkg == nil {
+		return true
+	}
+	path := fn.Pkg.Pkg.Path()
+	if path == "main" || path == "command-line-arguments" {
+		return false
+	}
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// isInit returns true if fn is a package initialiser.
+func isInit(fn *ssa.Function) bool {
+	return fn.Parent() == nil && fn.Signature.Recv() == nil &&
+		(fn.Name() == "init" || strings.HasPrefix(fn.Name(), "init#"))
+}
+
+// work is a function to analyse in a thread, reached from anchor in the root
+// function of the thread.
+type work struct {
+	fn     *ssa.Function
+	anchor ssa.Instruction
+}
+
+// analyse analyses the functions reachable from root in thread t.
+func (d *detector) analyse(t *thread, root *ssa.Function) {
+	entries := map[work]absint.LockSet{{fn: root}: make(absint.LockSet)}
+	queue := []work{{fn: root}}
+	for len(queue) > 0 {
+		w := queue[0]
+		queue = queue[1:]
+		for _, call := range d.analyseFunc(t, w, entries[w]) {
+			next := work{fn: call.fn, anchor: w.anchor}
+			if w.fn == t.root || w.anchor == nil && w.fn == root {
+				next.anchor = call.instr
+			}
+			locks, ok := entries[next]
+			if !ok {
+				entries[next] = call.locks
+				queue = append(queue, next)
+			} else if l := locks.Intersect(call.locks); !l.Equal(locks) {
+				entries[next] = l
+				queue = append(queue, next)
+			}
+		}
+	}
+}
+
+// callSite is a call to fn at instr with locks held.
+type callSite struct {
+	fn    *ssa.Function
+	instr ssa.Instruction
+	locks absint.LockSet
+}
+
+// analyseFunc records the accesses of w.fn in thread t, with locks held on
+// entry, and returns the calls of the function.
+func (d *detector) analyseFunc(t *thread, w work, entry absint.LockSet) []callSite {
+	fn := w.fn
+	if len(fn.Blocks) == 0 || isStd(fn) {
+		return nil
+	}
+	res := absint.Analyse(fn, &absint.Locks{
+		Held: entry,
+		Key: func(v ssa.Value) (string, bool) {
+			k, _, ok := d.location(t, v)
+			return k, ok
+		},
+	})
+	var calls []callSite
+	res.Walk(func(instr ssa.Instruction, s absint.State) {
+		locks := s.(absint.LockSet)
+		anchor := w.anchor
+		if anchor == nil || fn == t.root {
+			anchor = instr
+		}
+		switch instr := instr.(type) {
+		case *ssa.Store:
+			d.access(t, instr, instr.Addr, true, anchor, locks)
+		case *ssa.UnOp:
+			if instr.Op == token.MUL {
+				d.access(t, instr, instr.X, false, anchor, locks)
+			}
+		case *ssa.Go:
+			d.spawn(t, instr, anchor)
+		case ssa.CallInstruction:
+			if callee := d.callee(t, instr.Common()); callee != nil {
+				calls = append(calls, callSite{fn: callee, instr: instr, locks: locks.Clone()})
+			}
+		}
+	})
+	return calls
+}
+
+// callee returns the function called by c, and binds the captures of a
+// closure called in thread t.
+func (d *detector) callee(t *thread, c *ssa.CallCommon) *ssa.Function {
+	if mc, ok := c.Value.(*ssa.MakeClosure); ok {
+		fn := mc.Fn.(*ssa.Function)
+		d.bindFreeVars(t, fn, mc.Bindings)
+		return fn
+	}
+	return c.StaticCallee()
+}
+
+// bindFreeVars binds the captures of closure fn to bindings in thread t.
+func (d *detector) bindFreeVars(t *thread, fn *ssa.Function, bindings []ssa.Value) {
+	for i, fv := range fn.FreeVars {
+		if i < len(bindings) {
+			t.free[fv] = d.resolve(t, bindings[i])
+		}
+	}
+}
+
+// resolve returns the value bound to v if v is a captured variable.
+func (d *detector) resolve(t *thread, v ssa.Value) ssa.Value {
+	if fv, ok := v.(*ssa.FreeVar); ok {
+		if b, ok := t.free[fv]; ok {
+			return b
+		}
+	}
+	return v
+}
+
+// location returns the key and name of the shared variable at addr, or false
+// if addr is not a shared variable.
+func (d *detector) location(t *thread, addr ssa.Value) (key, name string, ok bool) {
+	switch a := d.resolve(t, addr).(type) {
+	case *ssa.Global:
+		return "g:" + a.String(), a.String(), true
+	case *ssa.Alloc:
+		if a.Heap { // Escaping local variable, e.g. captured by a closure.
+			name := a.Comment
+			if name == "" {
+				name = a.Name()
+			}
+			return fmt.Sprintf("a:%p", a), fmt.Sprintf("%s (%s)", name, d.fset.Position(a.Pos())), true
+		}
+	case *ssa.FieldAddr:
+		if alloc, ok := a.X.(*ssa.Alloc); ok && !alloc.Heap {
+			return "", "", false // Local struct.
+		}
+		if ptr, ok := a.X.Type().Underlying().(*types.Pointer); ok {
+			if s, ok := ptr.Elem().Underlying().(*types.Struct); ok {
+				name := fmt.Sprintf("(%s).%s", ptr.Elem(), s.Field(a.Field).Name())
+				return "f:" + name, name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// access records an access of instr to addr in thread t.
+func (d *detector) access(t *thread, instr ssa.Instruction, addr ssa.Value, write bool, anchor ssa.Instruction, locks absint.LockSet) {
+	key, name, ok := d.location(t, addr)
+	if !ok {
+		return
+	}
+	pos := instr.Pos()
+	if !pos.IsValid() {
+		pos = addr.Pos()
+	}
+	d.names[key] = name
+	d.accesses[key] = append(d.accesses[key], &Access{
+		Pos:       d.fset.Position(pos),
+		Write:     write,
+		Goroutine: t.name,
+		instr:     instr,
+		anchor:    anchor,
+		locks:     locks.Clone(),
+		thread:    t,
+	})
+}
+
+// spawn creates (and analyses) the goroutine spawned by g in thread t.
+func (d *detector) spawn(t *thread, g *ssa.Go, anchor ssa.Instruction) {
+	k := spawnKey{spawn: g, spawner: t}
+	if _, ok := d.spawned[k]; ok {
+		return
+	}
+	var root *ssa.Function
+	var bindings []ssa.Value
+	switch fv := g.Call.Value.(type) {
+	case *ssa.MakeClosure:
+		root, bindings = fv.Fn.(*ssa.Function), fv.Bindings
+	default:
+		root = g.Call.StaticCallee()
+	}
+	if root == nil || g.Call.IsInvoke() {
+		return
+	}
+	child := &thread{
+		root:    root,
+		name:    root.String(),
+		spawner: t,
+		spawn:   g,
+		anchor:  anchor,
+		multi:   t.multi || d.reachable(g, nil)[g],
+		free:    make(map[*ssa.FreeVar]ssa.Value),
+	}
+	for i, fv := range root.FreeVars {
+		if i < len(bindings) {
+			child.free[fv] = d.resolve(t, bindings[i])
+		}
+	}
+	d.spawned[k] = child
+	d.threads = append(d.threads, child)
+	d.analyse(child, root)
+}
+
+// reachable returns the instructions reachable from instruction from (in the
+// same function invocation) without passing through avoid.
+func (d *detector) reachable(from, avoid ssa.Instruction) map[ssa.Instruction]bool {
+	k := [2]ssa.Instruction{from, avoid}
+	if r, ok := d.reach[k]; ok {
+		return r
+	}
+	r := make(map[ssa.Instruction]bool)
+	visited := make(map[*ssa.BasicBlock]bool)
+	type item struct {
+		b     *ssa.BasicBlock
+		start int
+	}
+	b := from.Block()
+	start := 0
+	for i, instr := range b.Instrs {
+		if instr == from {
+			start = i + 1
+		}
+	}
+	queue := []item{{b, start}}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		blocked := false
+		for _, instr := range it.b.Instrs[it.start:] {
+			if instr == avoid {
+				blocked = true
+				break
+			}
+			r[instr] = true
+		}
+		if blocked {
+			continue
+		}
+		for _, succ := range it.b.Succs {
+			if !visited[succ] {
+				visited[succ] = true
+				queue = append(queue, item{succ, 0})
+			}
+		}
+	}
+	d.reach[k] = r
+	return r
+}
+
+// races returns the conflicting accesses which may happen in parallel.
+func (d *detector) races() []Race {
+	var races []Race
+	seen := make(map[string]bool)
+	var keys []string
+	for k := range d.accesses {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		accesses := d.accesses[k]
+		for i, a := range accesses {
+			for _, b := range accesses[i:] {
+				if !a.Write && !b.Write {
+					continue
+				}
+				if len(a.locks.Intersect(b.locks)) > 0 || !d.parallel(a, b) {
+					continue
+				}
+				first, second := *a, *b
+				if second.Pos.String() < first.Pos.String() {
+					first, second = second, first
+				}
+				id := fmt.Sprintf("%s|%s|%s", k, first.Pos, second.Pos)
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				races = append(races, Race{Var: d.names[k], First: first, Second: second})
+			}
+		}
+	}
+	return races
+}
+
+// parallel returns true if accesses a and b may happen in parallel.
+func (d *detector) parallel(a, b *Access) bool {
+	if a.thread == b.thread {
+		return a.thread.multi
+	}
+	return !d.before(a, b) && !d.before(b, a)
+}
+
+// before returns true if a happens before b (in different threads).
+func (d *detector) before(a, b *Access) bool {
+	if a.thread.spawner == nil && isInit(a.instr.Parent()) {
+		return true
+	}
+	// Find the goroutine spawned by the thread of a which runs b.
+	for child := b.thread; child != nil; child = child.spawner {
+		if child.spawner == a.thread {
+			return !d.reachable(child.anchor, nil)[a.anchor]
+		}
+	}
+	// Thread of a signals the spawner (thread of b) on exit.
+	if a.thread.spawner == b.thread {
+		return d.joined(a, b)
+	}
+	return false
+}
+
+// joined returns true if the goroutine of a signals its spawner (the thread
+// of b) after a, and b is only reachable from the spawn after a receive of
+// the signal.
+func (d *detector) joined(a, b *Access) bool {
+	t := a.thread
+	if t.spawn.Parent() != b.thread.root {
+		return false
+	}
+	for _, blk := range t.root.Blocks {
+		for _, instr := range blk.Instrs {
+			sig, deferred := d.signal(t, instr)
+			if sig == nil {
+				continue
+			}
+			if !deferred && (a.instr.Parent() != t.root || d.reachable(instr, nil)[a.anchor] || instr == a.anchor) {
+				continue // Access may be after the signal.
+			}
+			for _, join := range d.joins(b.thread.root, sig) {
+				if d.reachable(join, nil)[b.anchor] && !d.reachable(t.anchor, join)[b.anchor] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// signal returns the value (in the spawner) signalled by instr of goroutine t,
+// i.e. a channel sent on or closed, or a sync.WaitGroup on which Done is
+// called, and whether the signal is deferred.
+func (d *detector) signal(t *thread, instr ssa.Instruction) (ssa.Value, bool) {
+	var v ssa.Value
+	var deferred bool
+	switch instr := instr.(type) {
+	case *ssa.Send:
+		v = instr.Chan
+	case ssa.CallInstruction:
+		c := instr.Common()
+		_, deferred = instr.(*ssa.Defer)
+		if b, ok := c.Value.(*ssa.Builtin); ok && b.Name() == "close" {
+			v = c.Args[0]
+		} else if fn := c.StaticCallee(); fn != nil && fn.String() == "(*sync.WaitGroup).Done" {
+			v = c.Args[0]
+		}
+	}
+	if v == nil {
+		return nil, false
+	}
+	v = d.resolve(t, base(v))
+	if p, ok := v.(*ssa.Parameter); ok {
+		for i, param := range t.root.Params {
+			if param == p && i < len(t.spawn.Call.Args) {
+				return base(t.spawn.Call.Args[i]), deferred
+			}
+		}
+		return nil, false
+	}
+	return v, deferred
+}
+
+// joins returns the instructions of fn which wait for the signal sig, i.e. a
+// receive on channel sig, or sync.WaitGroup.Wait on sig.
+func (d *detector) joins(fn *ssa.Function, sig ssa.Value) []ssa.Instruction {
+	var joins []ssa.Instruction
+	for _, blk := range fn.Blocks {
+		for _, instr := range blk.Instrs {
+			switch instr := instr.(type) {
+			case *ssa.UnOp:
+				if instr.Op == token.ARROW && base(instr.X) == sig {
+					joins = append(joins, instr)
+				}
+			case *ssa.Call:
+				if fn := instr.Call.StaticCallee(); fn != nil && fn.String() == "(*sync.WaitGroup).Wait" {
+					if base(instr.Call.Args[0]) == sig {
+						joins = append(joins, instr)
+					}
+				}
+			}
+		}
+	}
+	return joins
+}
+
+// base returns the variable loaded by v (if v is a load), so that a value and
+// the loads of the same variable are identified.
+func base(v ssa.Value) ssa.Value {
+	switch u := v.(type) {
+	case *ssa.UnOp:
+		if u.Op == token.MUL {
+			return u.X
+		}
+	case *ssa.ChangeType:
+		return base(u.X)
+	case *ssa.MakeInterface:
+		return base(u.X)
+	}
+	return v
+}
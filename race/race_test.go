@@ -0,0 +1,57 @@
+package race
+
+import (
+	"testing"
+
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests unprotected accesses of a global from two goroutines.
+func TestUnlocked(t *testing.T) {
+	info, err := build.FromFiles("testdata/unlocked.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	races, err := Check(info)
+	if err != nil {
+		t.Fatalf("race detection failed: %v", err)
+	}
+	if len(races) == 0 {
+		t.Errorf("Expecting data race on main.counter but got none")
+	}
+	for _, r := range races {
+		if expect, got := "main.counter", r.Var; expect != got {
+			t.Errorf("Race on wrong variable:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+		}
+	}
+}
+
+// Tests accesses of a global protected by a common lock.
+func TestLocked(t *testing.T) {
+	info, err := build.FromFiles("testdata/locked.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	races, err := Check(info)
+	if err != nil {
+		t.Fatalf("race detection failed: %v", err)
+	}
+	for _, r := range races {
+		t.Errorf("Unexpected race: %v", r)
+	}
+}
+
+// Tests accesses of a global ordered by spawn and channel receive.
+func TestJoined(t *testing.T) {
+	info, err := build.FromFiles("testdata/joined.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	races, err := Check(info)
+	if err != nil {
+		t.Fatalf("race detection failed: %v", err)
+	}
+	for _, r := range races {
+		t.Errorf("Unexpected race: %v", r)
+	}
+}
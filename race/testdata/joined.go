@@ -0,0 +1,14 @@
+package main
+
+var counter int
+
+func main() {
+	done := make(chan bool)
+	counter++
+	go func() {
+		counter++
+		done <- true
+	}()
+	<-done
+	counter++
+}
@@ -0,0 +1,22 @@
+package main
+
+import "sync"
+
+var (
+	mu      sync.Mutex
+	counter int
+)
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		mu.Lock()
+		counter++
+		mu.Unlock()
+		done <- true
+	}()
+	mu.Lock()
+	counter++
+	mu.Unlock()
+	<-done
+}
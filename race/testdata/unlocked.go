@@ -0,0 +1,13 @@
+package main
+
+var counter int
+
+func main() {
+	done := make(chan bool)
+	go func() {
+		counter++
+		done <- true
+	}()
+	counter++
+	<-done
+}
@@ -0,0 +1,321 @@
+// Package report generates self-contained HTML reports of the analysis of a
+// program, to attach to design reviews and postmortems.
+//
+// A report shows the communication topology of the goroutines (the
+// choreography graph, see session.Choreography) as an SVG diagram, the
+// behaviour of each goroutine as its local session type and MiGo definition,
+// and the diagnostics of the checks, each linked to a snippet of the source
+// code around its position (and related positions) with syntax highlighting.
+// Everything is inlined in the page, so the report can be viewed offline.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/session"
+)
+
+// DefaultContext is the default number of lines of source shown before and
+// after the position of a diagnostic.
+const DefaultContext = 3
+
+// Goroutine is the behaviour of a goroutine in a report.
+type Goroutine struct {
+	Name      string // Name of the goroutine (role of the session).
+	Spawn     string // Position of the spawn site, if any.
+	Behaviour string // Local session type.
+	MiGo      string // MiGo definition.
+}
+
+// Report is the content of a report.
+type Report struct {
+	Title       string
+	Topology    *session.Choreography // Communication topology, if not nil.
+	Goroutines  []Goroutine
+	Diagnostics []diag.Diagnostic
+	Context     int // Lines of source around diagnostics, or DefaultContext if 0.
+
+	files map[string][]template.HTML // Highlighted lines of source files.
+}
+
+// snippet is the source around a position.
+type snippet struct {
+	ID    string
+	Pos   string
+	Lines []line
+}
+
+// line is a highlighted line of a snippet.
+type line struct {
+	No   int
+	Code template.HTML
+	Mark bool // Line of the position.
+}
+
+// location is a location of a diagnostic in a report.
+type location struct {
+	Pos     string
+	Message string
+	Snippet *snippet // Source around the position, or nil if unavailable.
+}
+
+// finding is a diagnostic in a report.
+type finding struct {
+	ID       string
+	Severity string
+	Rule     string
+	Message  string
+	Primary  location
+	Related  []location
+}
+
+// WriteHTML writes the report to w as a self-contained HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	if r.Context <= 0 {
+		r.Context = DefaultContext
+	}
+	r.files = make(map[string][]template.HTML)
+	var findings []finding
+	for i, d := range r.Diagnostics {
+		f := finding{
+			ID:       fmt.Sprintf("d%d", i),
+			Severity: string(severity(d)),
+			Rule:     d.Rule.ID,
+			Message:  d.Message,
+			Primary:  r.location(fmt.Sprintf("src-d%d", i), d.Pos, ""),
+		}
+		for j, rel := range d.Related {
+			f.Related = append(f.Related, r.location(fmt.Sprintf("src-d%dr%d", i, j), rel.Pos, rel.Message))
+		}
+		findings = append(findings, f)
+	}
+	var topology template.HTML
+	if r.Topology != nil && len(r.Topology.Roles) > 0 {
+		topology = template.HTML(topologySVG(r.Topology))
+	}
+	return reportTmpl.Execute(w, struct {
+		*Report
+		Topology template.HTML
+		Findings []finding
+	}{r, topology, findings})
+}
+
+// severity returns the severity of d, or the default severity of its rule.
+func severity(d diag.Diagnostic) diag.Severity {
+	switch {
+	case d.Severity != "":
+		return d.Severity
+	case d.Rule.Severity != "":
+		return d.Rule.Severity
+	}
+	return diag.Warning
+}
+
+// location returns the location of pos with the source around it.
+func (r *Report) location(id string, pos token.Position, msg string) location {
+	loc := location{Pos: pos.String(), Message: msg}
+	if pos.Filename == "" || pos.Line <= 0 {
+		return loc
+	}
+	lines, ok := r.files[pos.Filename]
+	if !ok {
+		if src, err := ioutil.ReadFile(pos.Filename); err == nil {
+			lines = Highlight(src)
+		}
+		r.files[pos.Filename] = lines
+	}
+	if pos.Line > len(lines) {
+		return loc
+	}
+	s := &snippet{ID: id, Pos: pos.String()}
+	for n := pos.Line - r.Context; n <= pos.Line+r.Context; n++ {
+		if n >= 1 && n <= len(lines) {
+			s.Lines = append(s.Lines, line{No: n, Code: lines[n-1], Mark: n == pos.Line})
+		}
+	}
+	loc.Snippet = s
+	return loc
+}
+
+// Highlight returns the lines of Go source src as HTML, with keywords,
+// literals and comments in spans of class kw, lit and com.
+func Highlight(src []byte) []template.HTML {
+	var buf bytes.Buffer
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, src, nil, scanner.ScanComments)
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		off := file.Offset(pos)
+		if off < last || off > len(src) {
+			continue // Automatically inserted semicolon.
+		}
+		text := string(src[off:])
+		switch {
+		case tok == token.SEMICOLON && lit == "\n":
+			continue
+		case lit != "":
+			text = text[:len(lit)]
+		default:
+			text = text[:len(tok.String())]
+		}
+		class := ""
+		switch {
+		case tok.IsKeyword():
+			class = "kw"
+		case tok == token.COMMENT:
+			class = "com"
+		case tok == token.STRING || tok == token.CHAR || tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			class = "lit"
+		}
+		buf.WriteString(html.EscapeString(string(src[last:off])))
+		if class == "" {
+			buf.WriteString(html.EscapeString(text))
+		} else {
+			// Spans are split at newlines, to keep lines self-contained.
+			for i, part := range strings.Split(text, "\n") {
+				if i > 0 {
+					buf.WriteString("\n")
+				}
+				fmt.Fprintf(&buf, `<span class="%s">%s</span>`, class, html.EscapeString(part))
+			}
+		}
+		last = off + len(text)
+	}
+	buf.WriteString(html.EscapeString(string(src[last:])))
+	var lines []template.HTML
+	for _, l := range strings.Split(buf.String(), "\n") {
+		lines = append(lines, template.HTML(strings.TrimSuffix(l, "\r")))
+	}
+	return lines
+}
+
+// topologySVG returns the choreography c as an SVG diagram, with the roles
+// (and shared channels) in a circle, the edges labelled by phase and message,
+// and the spawns dashed.
+func topologySVG(c *session.Choreography) string {
+	names := append([]string(nil), c.Roles...)
+	node := func(name, ch string) string {
+		if name == "" {
+			name = "[" + ch + "]"
+			for _, n := range names {
+				if n == name {
+					return name
+				}
+			}
+			names = append(names, name)
+		}
+		return name
+	}
+	type arc struct{ from, to, label string }
+	var arcs []arc
+	for _, e := range c.Edges {
+		arcs = append(arcs, arc{node(e.From, e.Chan), node(e.To, e.Chan), fmt.Sprintf("%d: %s", e.Phase, strings.Join(e.Labels, ", "))})
+	}
+	const w, h = 800, 600
+	cx, cy, rad := w/2.0, h/2.0, math.Min(w, h)/2-80
+	xy := make(map[string][2]float64)
+	for i, n := range names {
+		a := 2*math.Pi*float64(i)/float64(len(names)) - math.Pi/2
+		xy[n] = [2]float64{cx + rad*math.Cos(a), cy + rad*math.Sin(a)}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg class="topology" width="%d" height="%d" xmlns="http://www.w3.org/2000/svg">`, w, h)
+	buf.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z"/></marker></defs>`)
+	curve := func(from, to string, bend float64) (string, float64, float64) {
+		a, b := xy[from], xy[to]
+		if from == to {
+			return fmt.Sprintf("M%.1f,%.1f c40,-60 80,0 20,15", a[0], a[1]-15), a[0] + 40, a[1] - 50
+		}
+		mx := (a[0]+b[0])/2 - (b[1]-a[1])*bend
+		my := (a[1]+b[1])/2 + (b[0]-a[0])*bend
+		return fmt.Sprintf("M%.1f,%.1f Q%.1f,%.1f %.1f,%.1f", a[0], a[1], mx, my, b[0], b[1]), (a[0] + 2*mx + b[0]) / 4, (a[1] + 2*my + b[1]) / 4
+	}
+	for _, s := range c.Spawns {
+		if _, ok := xy[s.Spawner]; !ok {
+			continue
+		}
+		d, _, _ := curve(s.Spawner, s.Role, 0)
+		fmt.Fprintf(&buf, `<path class="spawn" d="%s"><title>%s spawns %s</title></path>`, d, html.EscapeString(s.Spawner), html.EscapeString(s.Role))
+	}
+	for _, a := range arcs {
+		d, lx, ly := curve(a.from, a.to, 0.15)
+		fmt.Fprintf(&buf, `<g class="edge"><path d="%s"/><text x="%.1f" y="%.1f">%s</text><title>%s -&gt; %s</title></g>`,
+			d, lx, ly, html.EscapeString(a.label), html.EscapeString(a.from), html.EscapeString(a.to))
+	}
+	for _, n := range names {
+		p, class := xy[n], "role"
+		if strings.HasPrefix(n, "[") {
+			class = "chan"
+		}
+		width := 8*float64(len(n)) + 16
+		fmt.Fprintf(&buf, `<g class="%s"><rect x="%.1f" y="%.1f" width="%.1f" height="24" rx="6"/><text x="%.1f" y="%.1f" text-anchor="middle">%s</text></g>`,
+			class, p[0]-width/2, p[1]-12, width, p[0], p[1]+4, html.EscapeString(n))
+	}
+	buf.WriteString(`</svg>`)
+	return buf.String()
+}
+
+var reportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+pre, code { font-family: monospace; }
+pre.migo { background: #f8f8f8; padding: 0.5em; }
+.error { color: #b00; } .warning { color: #b60; } .note { color: #06b; }
+.snippet { background: #f8f8f8; border-left: 3px solid #ccc; margin: 0.5em 0; }
+.snippet .no { color: #999; display: inline-block; width: 4em; text-align: right; padding-right: 1em; }
+.snippet .mark { background: #ffd; }
+.kw { color: #a0a; font-weight: bold; } .lit { color: #080; } .com { color: #888; font-style: italic; }
+.topology .role rect { fill: #eef; stroke: #336; }
+.topology .chan rect { fill: #ffe; stroke: #663; }
+.topology .edge path { fill: none; stroke: #333; marker-end: url(#arrow); }
+.topology .edge text { font-size: 11px; fill: #333; }
+.topology .spawn { fill: none; stroke: #36c; stroke-dasharray: 2,3; marker-end: url(#arrow); }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<h2>Topology</h2>
+{{if .Topology}}{{.Topology}}{{else}}<p>No communication between goroutines.</p>{{end}}
+<h2>Goroutines</h2>
+{{range .Goroutines}}<h3 id="g-{{.Name}}">{{.Name}}</h3>
+{{if .Spawn}}<p>Spawned at <code>{{.Spawn}}</code></p>{{end}}
+<p>Behaviour: <code>{{.Behaviour}}</code></p>
+{{if .MiGo}}<pre class="migo">{{.MiGo}}</pre>{{end}}
+{{else}}<p>No goroutines.</p>
+{{end}}
+<h2>Diagnostics</h2>
+{{if .Findings}}<table>
+<tr><th>Severity</th><th>Rule</th><th>Message</th><th>Position</th></tr>
+{{range .Findings}}<tr><td class="{{.Severity}}">{{.Severity}}</td><td>{{.Rule}}</td><td>{{.Message}}</td><td><a href="#{{.ID}}">{{.Primary.Pos}}</a></td></tr>
+{{end}}</table>
+{{range .Findings}}<h3 id="{{.ID}}" class="{{.Severity}}">{{.Message}} [{{.Rule}}]</h3>
+{{template "location" .Primary}}
+{{range .Related}}<p>{{.Message}}</p>{{template "location" .}}{{end}}
+{{end}}{{else}}<p>No diagnostics.</p>{{end}}
+</body>
+</html>
+{{define "location"}}<p><code>{{.Pos}}</code></p>{{with .Snippet}}<pre class="snippet" id="{{.ID}}">{{range .Lines}}<span class="{{if .Mark}}mark{{end}}"><span class="no">{{.No}}</span>{{.Code}}</span>
+{{end}}</pre>{{end}}{{end}}
+`))
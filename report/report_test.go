@@ -0,0 +1,73 @@
+package report
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/session"
+)
+
+// Tests syntax highlighting of source lines.
+func TestHighlight(t *testing.T) {
+	src := "package main\n\n// Comment\nfunc main() { s := \"a<b\" }\n"
+	lines := Highlight([]byte(src))
+	if expect, got := 5, len(lines); expect != got {
+		t.Fatalf("Wrong number of lines:\nExpect:\t%d\nGot:\t%d\n", expect, got)
+	}
+	for i, expect := range []string{
+		`<span class="kw">package</span> main`,
+		``,
+		`<span class="com">// Comment</span>`,
+		`<span class="kw">func</span> main() { s := <span class="lit">&#34;a&lt;b&#34;</span> }`,
+	} {
+		if got := string(lines[i]); got != expect {
+			t.Errorf("Wrong highlighting of line %d:\nExpect:\t%s\nGot:\t%s\n", i+1, expect, got)
+		}
+	}
+}
+
+// Tests that a report contains the topology, goroutines and diagnostics with
+// links to the source.
+func TestWriteHTML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(file, []byte("package main\n\nfunc main() {\n\tch := make(chan int)\n\tch <- 1\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := Report{
+		Title: "test",
+		Topology: &session.Choreography{
+			Roles: []string{"main.main", "main.main$1"},
+			Edges: []*session.ChoreoEdge{{From: "main.main", To: "main.main$1", Chan: "ch", Labels: []string{"int"}, Phase: 1}},
+		},
+		Goroutines:  []Goroutine{{Name: "main.main$1", Spawn: file + ":5:2", Behaviour: "ch?int.end"}},
+		Diagnostics: []diag.Diagnostic{{Rule: diag.GoroutineLeak, Message: "goroutine may leak", Pos: diag.ParsePos(file + ":5:2")}},
+	}
+	var buf bytes.Buffer
+	if err := r.WriteHTML(&buf); err != nil {
+		t.Fatalf("cannot write report: %v", err)
+	}
+	for _, expect := range []string{
+		"<svg",
+		"main.main$1",
+		"1: int",
+		"ch?int.end",
+		`href="#d0"`,
+		`id="d0"`,
+		`<span class="mark"><span class="no">5</span>`,
+		"goroutine-leak",
+	} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Report does not contain %q:\n%s", expect, buf.String())
+		}
+	}
+}
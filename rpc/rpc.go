@@ -0,0 +1,303 @@
+// Package rpc provides a JSON-RPC backend for editor extensions (e.g. a VS
+// Code extension), which runs the analysis in its own process over stdio with
+// a smaller protocol than LSP, so the analysis is not linked into the
+// extension host.
+//
+// Messages are JSON-RPC 2.0 framed by Content-Length headers, as in LSP (and
+// vscode-jsonrpc). The methods are
+//
+//	analyze         analyse packages or files (AnalyzeParams), returns AnalyzeResult
+//	getModel        MiGo model of the last analysis (ModelParams), returns ModelResult
+//	getDiagnostics  diagnostics of the last analysis (DiagnosticsParams), returns []diag.Diagnostic
+//	subscribe       notify the client of analyses (SubscribeParams)
+//	shutdown        no-op, before exit
+//
+// and the notification exit stops the server. A subscribed client is notified
+// of each analysis by the notification analyzed (AnalyzedParams). Requests are
+// handled in order, so a request after analyze gets the result of the
+// analysis.
+package rpc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/internal/jsonrpc"
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// AnalyzeParams are the parameters of analyze.
+type AnalyzeParams struct {
+	Dir      string            `json:"dir,omitempty"`      // Directory of the packages (default current directory).
+	Packages []string          `json:"packages,omitempty"` // Package patterns (default .).
+	Files    []string          `json:"files,omitempty"`    // Files analysed as a main package instead of packages.
+	Overlay  map[string]string `json:"overlay,omitempty"`  // Content of unsaved files, by filename.
+	Entry    string            `json:"entry,omitempty"`    // Entry function (default entry points).
+	Tests    bool              `json:"tests,omitempty"`    // Also analyse the tests of packages.
+}
+
+// AnalyzeResult is the result of analyze.
+type AnalyzeResult struct {
+	Version     int `json:"version"`     // Number of the analysis, from 1.
+	Definitions int `json:"definitions"` // Number of MiGo definitions.
+	Diagnostics int `json:"diagnostics"` // Number of diagnostics.
+}
+
+// ModelParams are the parameters of getModel.
+type ModelParams struct {
+	Func string `json:"func,omitempty"` // Go function of the definitions (default all).
+}
+
+// ModelResult is the result of getModel.
+type ModelResult struct {
+	Version     int                    `json:"version"`
+	MiGo        string                 `json:"migo"` // MiGo program of the definitions.
+	Definitions []migoinfer.Definition `json:"definitions"`
+}
+
+// DiagnosticsParams are the parameters of getDiagnostics.
+type DiagnosticsParams struct {
+	File string `json:"file,omitempty"` // File of the diagnostics (default all).
+}
+
+// SubscribeParams are the parameters of subscribe.
+type SubscribeParams struct {
+	Diagnostics bool `json:"diagnostics,omitempty"` // Include the diagnostics in notifications.
+	Unsubscribe bool `json:"unsubscribe,omitempty"` // Stop the notifications.
+}
+
+// AnalyzedParams are the parameters of the notification analyzed.
+type AnalyzedParams struct {
+	Version     int               `json:"version"`
+	Error       string            `json:"error,omitempty"` // Error of a failed analysis.
+	Diagnostics []diag.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// Server is a JSON-RPC backend serving the analysis to a client.
+type Server struct {
+	Log io.Writer // Log of the server (defaults to discard).
+
+	conn       *jsonrpc.Conn
+	version    int
+	last       *result // Result of the last successful analysis.
+	subscribed bool
+	withDiags  bool
+}
+
+// result is the result of an analysis.
+type result struct {
+	version int
+	defs    []migoinfer.Definition
+	diags   []diag.Diagnostic
+}
+
+// NewServer returns a new server.
+func NewServer() *Server {
+	return &Server{Log: ioutil.Discard}
+}
+
+// Serve serves requests read from r, writing responses to w, until the exit
+// notification or the end of r.
+func Serve(r io.Reader, w io.Writer) error {
+	return NewServer().Serve(r, w)
+}
+
+// Serve serves requests read from r, writing responses to w, until the exit
+// notification or the end of r.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = jsonrpc.NewConn(r, w)
+	for {
+		msg, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles a request or notification.
+func (s *Server) handle(msg *jsonrpc.Message) error {
+	fmt.Fprintf(s.Log, "rpc: %s\n", msg.Method)
+	var (
+		result interface{}
+		rerr   *jsonrpc.Error
+	)
+	switch msg.Method {
+	case "analyze":
+		var p AnalyzeParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			result, rerr = s.analyze(p)
+		}
+	case "getModel":
+		var p ModelParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			result, rerr = s.model(p)
+		}
+	case "getDiagnostics":
+		var p DiagnosticsParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			result, rerr = s.diagnostics(p)
+		}
+	case "subscribe":
+		var p SubscribeParams
+		if rerr = jsonrpc.Unmarshal(msg.Params, &p); rerr == nil {
+			s.subscribed, s.withDiags = !p.Unsubscribe, p.Diagnostics
+		}
+	case "shutdown":
+	default:
+		if msg.ID != nil {
+			rerr = &jsonrpc.Error{Code: jsonrpc.MethodNotFound, Message: "method not found: " + msg.Method}
+		}
+	}
+	if msg.ID == nil { // Notification.
+		return nil
+	}
+	if rerr != nil {
+		result = nil // Not a typed nil result.
+	}
+	return s.conn.Reply(msg.ID, result, rerr)
+}
+
+// lastResult returns the result of the last analysis, or an error if there is
+// none.
+func (s *Server) lastResult() (*result, *jsonrpc.Error) {
+	if s.last == nil {
+		return nil, &jsonrpc.Error{Code: jsonrpc.ServerError, Message: "no analysis, call analyze first"}
+	}
+	return s.last, nil
+}
+
+// analyze runs the analysis of p, and notifies the subscribed client.
+func (s *Server) analyze(p AnalyzeParams) (*AnalyzeResult, *jsonrpc.Error) {
+	s.version++
+	res, err := infer(p)
+	if err != nil {
+		fmt.Fprintf(s.Log, "rpc: analysis %d: %v\n", s.version, err)
+		if s.subscribed {
+			s.conn.Notify("analyzed", AnalyzedParams{Version: s.version, Error: err.Error()})
+		}
+		return nil, &jsonrpc.Error{Code: jsonrpc.ServerError, Message: err.Error()}
+	}
+	res.version = s.version
+	s.last = res
+	if s.subscribed {
+		n := AnalyzedParams{Version: res.version}
+		if s.withDiags {
+			n.Diagnostics = res.diags
+		}
+		s.conn.Notify("analyzed", n)
+	}
+	return &AnalyzeResult{Version: res.version, Definitions: len(res.defs), Diagnostics: len(res.diags)}, nil
+}
+
+// model returns the MiGo definitions of the last analysis.
+func (s *Server) model(p ModelParams) (*ModelResult, *jsonrpc.Error) {
+	res, rerr := s.lastResult()
+	if rerr != nil {
+		return nil, rerr
+	}
+	m := &ModelResult{Version: res.version, Definitions: []migoinfer.Definition{}}
+	var buf bytes.Buffer
+	for _, d := range res.defs {
+		if p.Func == "" || d.Func == p.Func {
+			m.Definitions = append(m.Definitions, d)
+			buf.WriteString(d.MiGo)
+		}
+	}
+	m.MiGo = buf.String()
+	return m, nil
+}
+
+// diagnostics returns the diagnostics of the last analysis.
+func (s *Server) diagnostics(p DiagnosticsParams) ([]diag.Diagnostic, *jsonrpc.Error) {
+	res, rerr := s.lastResult()
+	if rerr != nil {
+		return nil, rerr
+	}
+	diags := []diag.Diagnostic{}
+	for _, d := range res.diags {
+		if p.File == "" || sameFile(d.Pos.Filename, p.File) {
+			diags = append(diags, d)
+		}
+	}
+	return diags, nil
+}
+
+// sameFile returns true if the paths a and b are the same file.
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return a == b || errA == nil && errB == nil && absA == absB
+}
+
+// infer builds the packages (or files) of p and infers their MiGo program.
+func infer(p AnalyzeParams) (res *result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("analysis failed: %v", r)
+		}
+	}()
+	var conf build.Configurer
+	switch {
+	case len(p.Files) > 0:
+		overlay := make(map[string][]byte)
+		files := make([]string, len(p.Files))
+		for i, f := range p.Files {
+			if p.Dir != "" && !filepath.IsAbs(f) {
+				f = filepath.Join(p.Dir, f)
+			}
+			files[i] = f
+		}
+		for f, content := range p.Overlay {
+			if p.Dir != "" && !filepath.IsAbs(f) {
+				f = filepath.Join(p.Dir, f)
+			}
+			overlay[f] = []byte(content)
+		}
+		conf = build.FromOverlay(files, overlay)
+	default:
+		patterns := p.Packages
+		if len(patterns) == 0 {
+			patterns = []string{"."}
+		}
+		conf = build.FromPackagesIn(p.Dir, patterns...).WithTests(p.Tests)
+	}
+	info, err := conf.Default().Build()
+	if err != nil {
+		return nil, err
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.SetTests(p.Tests)
+	if p.Entry != "" {
+		if fn, err := info.FindFunc(p.Entry); err != nil || fn == nil {
+			return nil, fmt.Errorf("cannot find entry function %s", p.Entry)
+		}
+		inferer.SetEntryFunc(p.Entry)
+	}
+	inferer.Analyse()
+
+	diags := inferer.LeakDiagnostics()
+	diags = append(diags, inferer.DeadlockDiagnostics(inferer.Bounds)...)
+	diags = append(diags, inferer.ChanMisuseDiagnostics()...)
+	diags = append(diags, inferer.LockCycleDiagnostics()...)
+	diags = append(diags, inferer.UnusedEndpointDiagnostics()...)
+	diags = diag.Suppress(diags, info.Directives.Ignored)
+	diag.Sort(diags)
+	if diags == nil {
+		diags = []diag.Diagnostic{}
+	}
+	return &result{defs: inferer.Definitions(), diags: diags}, nil
+}
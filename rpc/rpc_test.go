@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/internal/jsonrpc"
+)
+
+// frame frames JSON-RPC messages with Content-Length headers.
+func frame(msgs ...string) string {
+	var buf strings.Builder
+	for _, m := range msgs {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return buf.String()
+}
+
+// serve serves the messages in, and returns the messages written.
+func serve(t *testing.T, in ...string) []*jsonrpc.Message {
+	var out bytes.Buffer
+	if err := Serve(strings.NewReader(frame(in...)), &out); err != nil {
+		t.Fatal(err)
+	}
+	c := jsonrpc.NewConn(&out, nil)
+	var msgs []*jsonrpc.Message
+	for {
+		msg, err := c.Read()
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// decode decodes the result (or params) v of a message into res.
+func decode(t *testing.T, v interface{}, res interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, res); err != nil {
+		t.Fatalf("Cannot decode %s: %v", b, err)
+	}
+}
+
+// Tests that requests before analyze, and unknown methods, are errors.
+func TestNoAnalysis(t *testing.T) {
+	msgs := serve(t,
+		`{"jsonrpc":"2.0","id":1,"method":"getModel"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	if expect, got := 2, len(msgs); expect != got {
+		t.Fatalf("Responses mismatch:\nExpect:\t%d\nGot:\t%d\n", expect, got)
+	}
+	if msgs[0].Error == nil || msgs[0].Error.Code != jsonrpc.ServerError || msgs[0].Result != nil {
+		t.Errorf("getModel error mismatch:\nExpect:\t%d\nGot:\t%+v\n", jsonrpc.ServerError, msgs[0])
+	}
+	if msgs[1].Error == nil || msgs[1].Error.Code != jsonrpc.MethodNotFound {
+		t.Errorf("Unknown method error mismatch:\nExpect:\t%d\nGot:\t%+v\n", jsonrpc.MethodNotFound, msgs[1].Error)
+	}
+}
+
+// Tests analyze with a subscription, then getModel and getDiagnostics of the
+// analysis.
+func TestAnalyze(t *testing.T) {
+	msgs := serve(t,
+		`{"jsonrpc":"2.0","id":1,"method":"subscribe","params":{"diagnostics":true}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"analyze","params":{"files":["testdata/leak.go"]}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"getModel","params":{"func":"main.main"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"getDiagnostics","params":{"file":"testdata/leak.go"}}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	// Response to subscribe, notification, then responses.
+	if expect, got := 5, len(msgs); expect != got {
+		t.Fatalf("Messages mismatch:\nExpect:\t%d\nGot:\t%d\n", expect, got)
+	}
+	if msgs[1].Method != "analyzed" {
+		t.Fatalf("Notification mismatch:\nExpect:\tanalyzed\nGot:\t%+v\n", msgs[1])
+	}
+	var n AnalyzedParams
+	decode(t, msgs[1].Params, &n)
+	if n.Version != 1 || n.Error != "" || len(n.Diagnostics) == 0 {
+		t.Errorf("Notification mismatch:\nExpect:\tversion 1 with diagnostics\nGot:\t%+v\n", n)
+	}
+	var res AnalyzeResult
+	decode(t, msgs[2].Result, &res)
+	if res.Version != 1 || res.Definitions == 0 || res.Diagnostics != len(n.Diagnostics) {
+		t.Errorf("analyze result mismatch:\nGot:\t%+v\n", res)
+	}
+	var model ModelResult
+	decode(t, msgs[3].Result, &model)
+	if len(model.Definitions) == 0 || !strings.Contains(model.MiGo, "main.main") {
+		t.Errorf("getModel result mismatch:\nGot:\t%+v\n", model)
+	}
+	var diags []diag.Diagnostic
+	decode(t, msgs[4].Result, &diags)
+	leak := false
+	for _, d := range diags {
+		leak = leak || d.Rule == diag.GoroutineLeak
+	}
+	if !leak {
+		t.Errorf("getDiagnostics result mismatch:\nExpect:\t%s\nGot:\t%v\n", diag.GoroutineLeak.ID, diags)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+func main() {
+	ch := make(chan int)
+	go func() {
+		ch <- 1 // Leaks: never received.
+	}()
+}
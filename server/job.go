@@ -0,0 +1,258 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// extract extracts a zip or tar.gz archive to dir, and returns the root of
+// the sources, i.e. the directory with go.mod if the archive has a single
+// top-level directory (e.g. an archive of a repository).
+func extract(archive []byte, dir string) (string, error) {
+	var err error
+	switch {
+	case bytes.HasPrefix(archive, []byte("PK\x03\x04")):
+		err = extractZip(archive, dir)
+	case bytes.HasPrefix(archive, []byte{0x1f, 0x8b}):
+		err = extractTarGz(archive, dir)
+	default:
+		return "", fmt.Errorf("unknown archive format (expecting zip or tar.gz)")
+	}
+	if err != nil {
+		return "", err
+	}
+	return moduleRoot(dir), nil
+}
+
+// extractPath returns the path of archive entry name in dir, or an error if
+// the entry is outside dir.
+func extractPath(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// writeFile writes the content of r to path, creating its directory.
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func extractZip(archive []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		path, err := extractPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if !f.Mode().IsRegular() {
+			continue // Directories are created with files, links are skipped.
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(path, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(archive []byte, dir string) error {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := extractPath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := writeFile(path, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// moduleRoot returns dir, or its single subdirectory if it has go.mod and
+// dir does not.
+func moduleRoot(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return dir
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	sub := filepath.Join(dir, entries[0].Name())
+	if _, err := os.Stat(filepath.Join(sub, "go.mod")); err == nil {
+		return sub
+	}
+	return dir
+}
+
+// download fetches module (module@version) with the go command, and copies
+// its sources to dir (the module cache is read-only).
+func download(module, dir string) (string, error) {
+	if !strings.Contains(module, "@") {
+		module += "@latest"
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("go", "mod", "download", "-json", module)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &out, &stderr
+	err := cmd.Run()
+	var mod struct{ Dir, Error string }
+	if jerr := json.Unmarshal(out.Bytes(), &mod); jerr == nil && mod.Error != "" {
+		return "", fmt.Errorf("cannot download %s: %s", module, mod.Error)
+	}
+	if err != nil || mod.Dir == "" {
+		return "", fmt.Errorf("cannot download %s: %v: %s", module, err, strings.TrimSpace(stderr.String()))
+	}
+	root := filepath.Join(dir, "src")
+	err = filepath.Walk(mod.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(mod.Dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return writeFile(filepath.Join(root, rel), f)
+	})
+	if err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// analyse analyses the packages of the request in root, and returns the
+// result with the positions relative to root.
+func analyse(root string, req Request) (res *Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("analysis failed: %v", r)
+		}
+	}()
+	info, err := build.FromPackagesIn(root, req.Packages...).Default().WithTests(req.Tests).Build()
+	if err != nil {
+		return nil, err
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.SetTests(req.Tests)
+	if req.Entry != "" {
+		if fn, err := info.FindFunc(req.Entry); err != nil || fn == nil {
+			return nil, fmt.Errorf("cannot find entry function %s", req.Entry)
+		}
+		inferer.SetEntryFunc(req.Entry)
+	} else if len(inferer.Entrypoints()) == 0 {
+		if _, err := ssa.MainPkgs(info.Prog, true); !req.Tests || err != nil {
+			return nil, fmt.Errorf("no entry point (main function or entrypoint directive) found")
+		}
+	}
+	inferer.Analyse()
+
+	res = &Result{Definitions: inferer.Definitions()}
+	var migo bytes.Buffer
+	for _, f := range inferer.Env.Prog.Funcs {
+		if f.SimpleName() == "main.main" {
+			migo.WriteString(f.String())
+		}
+	}
+	for _, f := range inferer.Env.Prog.Funcs {
+		if f.SimpleName() != "main.main" {
+			migo.WriteString(f.String())
+		}
+	}
+	res.MiGo = migo.String()
+
+	diags := inferer.LeakDiagnostics()
+	diags = append(diags, inferer.DeadlockDiagnostics(inferer.Bounds)...)
+	diags = append(diags, inferer.ChanMisuseDiagnostics()...)
+	diags = append(diags, inferer.LockCycleDiagnostics()...)
+	diags = append(diags, inferer.UnusedEndpointDiagnostics()...)
+	for i := range diags {
+		diags[i].Pos.Filename = relPath(root, diags[i].Pos.Filename)
+		for j := range diags[i].Related {
+			diags[i].Related[j].Pos.Filename = relPath(root, diags[i].Related[j].Pos.Filename)
+		}
+	}
+	diag.Sort(diags)
+	res.Diagnostics = diags
+	if res.Diagnostics == nil {
+		res.Diagnostics = []diag.Diagnostic{}
+	}
+	for i := range res.Definitions {
+		d := &res.Definitions[i]
+		d.Pos, d.Spawn, d.CondPos = relPos(root, d.Pos), relPos(root, d.Spawn), relPos(root, d.CondPos)
+	}
+	return res, nil
+}
+
+// relPath returns path relative to root if it is in root.
+func relPath(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// relPos returns position pos (file:line:col) relative to root.
+func relPos(root, pos string) string {
+	if pos == "" {
+		return pos
+	}
+	p := diag.ParsePos(pos)
+	if p.Filename == "" {
+		return pos
+	}
+	return strings.Replace(pos, p.Filename, relPath(root, p.Filename), 1)
+}
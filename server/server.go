@@ -0,0 +1,294 @@
+// Package server provides an HTTP server which runs the analysis as a
+// service, so the expensive analysis of a code base is run (and cached) once
+// centrally instead of on every machine.
+//
+// A job analyses a module given by reference (module@version, fetched with
+// the go command) or uploaded as an archive (zip or tar.gz). The API is in
+// JSON:
+//
+//	POST   /jobs                   submit a job (Request, or an archive with ?pkg=patterns)
+//	GET    /jobs                   list the jobs
+//	GET    /jobs/{id}              status of a job
+//	GET    /jobs/{id}/result       MiGo program, definitions and diagnostics
+//	GET    /jobs/{id}/migo         MiGo program (text)
+//	GET    /jobs/{id}/diagnostics  diagnostics
+//	DELETE /jobs/{id}              delete a job (and its results)
+//
+// Jobs are run in order of submission by a fixed number of workers. Results
+// are cached by the content of the archive (or the module reference, if it
+// has an exact version) and the options of the job, i.e. submitting a job
+// which is already analysed (or queued) returns the existing job.
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/migoinfer"
+)
+
+// MaxArchive is the maximum size of an uploaded archive in bytes.
+const MaxArchive = 64 << 20
+
+// Status is the status of a job.
+type Status string
+
+// Statuses of jobs.
+const (
+	Queued  Status = "queued"
+	Running Status = "running"
+	Done    Status = "done"
+	Failed  Status = "failed"
+)
+
+// Request is a request to analyse a module.
+type Request struct {
+	Module   string   `json:"module,omitempty"` // Module reference, e.g. example.com/mod@v1.2.3.
+	Packages []string `json:"packages"`         // Package patterns (default ./...).
+	Entry    string   `json:"entry,omitempty"`  // Entry function (default entry points).
+	Tests    bool     `json:"tests,omitempty"`  // Also analyse the tests.
+}
+
+// Result is the result of a job.
+type Result struct {
+	MiGo        string                 `json:"migo"`
+	Definitions []migoinfer.Definition `json:"definitions"`
+	Diagnostics []diag.Diagnostic      `json:"diagnostics"`
+}
+
+// Job is an analysis job.
+type Job struct {
+	ID       string     `json:"id"`
+	Status   Status     `json:"status"`
+	Request  Request    `json:"request"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	key     string  // Cache key, or empty if not cacheable.
+	archive []byte  // Uploaded archive, if any.
+	result  *Result // Result, once done.
+}
+
+// Server is an HTTP server of analysis jobs.
+type Server struct {
+	Dir string    // Directory of the sources of the jobs (defaults to the temporary directory).
+	Log io.Writer // Log of the server (defaults to discard).
+
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	cache map[string]string // Job ID, by cache key.
+	queue chan *Job
+	next  int
+}
+
+// exactVersion matches exact (cacheable) module versions.
+var exactVersion = regexp.MustCompile(`@v[0-9]+\.[0-9]+\.[0-9]+`)
+
+// NewServer returns a new server which runs jobs with the given number of
+// workers.
+func NewServer(workers int) *Server {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &Server{
+		Log:   ioutil.Discard,
+		jobs:  make(map[string]*Job),
+		cache: make(map[string]string),
+		queue: make(chan *Job, 1024),
+	}
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// ServeHTTP serves the API.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "jobs" && r.Method == http.MethodPost:
+		s.submit(w, r)
+	case path == "jobs" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		jobs := make([]*Job, 0, len(s.jobs))
+		for _, job := range s.jobs {
+			jobs = append(jobs, job)
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+		writeJSON(w, http.StatusOK, jobs)
+		s.mu.Unlock()
+	case strings.HasPrefix(path, "jobs/"):
+		parts := strings.SplitN(strings.TrimPrefix(path, "jobs/"), "/", 2)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job, ok := s.jobs[parts[0]]
+		if !ok {
+			http.Error(w, "no such job", http.StatusNotFound)
+			return
+		}
+		if len(parts) == 1 {
+			switch r.Method {
+			case http.MethodGet:
+				writeJSON(w, http.StatusOK, job)
+			case http.MethodDelete:
+				delete(s.jobs, job.ID)
+				if s.cache[job.key] == job.ID {
+					delete(s.cache, job.key)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		if job.Status != Done {
+			http.Error(w, fmt.Sprintf("job %s is %s", job.ID, job.Status), http.StatusConflict)
+			return
+		}
+		switch parts[1] {
+		case "result":
+			writeJSON(w, http.StatusOK, job.result)
+		case "migo":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, job.result.MiGo)
+		case "diagnostics":
+			writeJSON(w, http.StatusOK, job.result.Diagnostics)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// submit submits the job of a request, or returns the cached job.
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	job := &Job{Created: time.Now(), Status: Queued}
+	h := sha256.New()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&job.Request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if job.Request.Module == "" {
+			http.Error(w, "invalid request: missing module", http.StatusBadRequest)
+			return
+		}
+		if exactVersion.MatchString(job.Request.Module) {
+			fmt.Fprintf(h, "module\x00%s\x00", job.Request.Module)
+		} else {
+			h = nil // Version resolved at analysis, e.g. latest.
+		}
+	} else {
+		archive, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxArchive))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot read archive: %v", err), http.StatusBadRequest)
+			return
+		}
+		job.archive = archive
+		job.Request.Packages = r.URL.Query()["pkg"]
+		job.Request.Entry = r.URL.Query().Get("entry")
+		job.Request.Tests = r.URL.Query().Get("tests") == "true"
+		fmt.Fprintf(h, "archive\x00")
+		h.Write(archive)
+	}
+	if len(job.Request.Packages) == 0 {
+		job.Request.Packages = []string{"./..."}
+	}
+	if h != nil {
+		fmt.Fprintf(h, "\x00%q\x00%s\x00%t", job.Request.Packages, job.Request.Entry, job.Request.Tests)
+		job.key = hex.EncodeToString(h.Sum(nil))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.cache[job.key]; ok && job.key != "" {
+		writeJSON(w, http.StatusOK, s.jobs[id])
+		return
+	}
+	s.next++
+	job.ID = fmt.Sprintf("%d", s.next)
+	s.jobs[job.ID] = job
+	if job.key != "" {
+		s.cache[job.key] = job.ID
+	}
+	select {
+	case s.queue <- job:
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		delete(s.jobs, job.ID)
+		delete(s.cache, job.key)
+		http.Error(w, "too many queued jobs", http.StatusServiceUnavailable)
+	}
+}
+
+// work runs the queued jobs.
+func (s *Server) work() {
+	for job := range s.queue {
+		s.mu.Lock()
+		if _, ok := s.jobs[job.ID]; !ok {
+			s.mu.Unlock()
+			continue // Deleted while queued.
+		}
+		job.Status = Running
+		s.mu.Unlock()
+
+		fmt.Fprintf(s.Log, "server: job %s: running\n", job.ID)
+		res, err := s.run(job)
+		now := time.Now()
+
+		s.mu.Lock()
+		job.Finished, job.archive = &now, nil
+		if err != nil {
+			job.Status, job.Error = Failed, err.Error()
+			if s.cache[job.key] == job.ID {
+				delete(s.cache, job.key) // Retried on resubmission.
+			}
+		} else {
+			job.Status, job.result = Done, res
+		}
+		s.mu.Unlock()
+		fmt.Fprintf(s.Log, "server: job %s: %s %s\n", job.ID, job.Status, job.Error)
+	}
+}
+
+// run fetches the sources of job and analyses them.
+func (s *Server) run(job *Job) (*Result, error) {
+	dir, err := ioutil.TempDir(s.Dir, "gospal-job")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	var root string
+	if job.archive != nil {
+		root, err = extract(job.archive, dir)
+	} else {
+		root, err = download(job.Request.Module, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return analyse(root, job.Request)
+}
+
+// writeJSON writes v as the JSON response with status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
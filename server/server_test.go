@@ -0,0 +1,101 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipArchive returns a zip archive of files (by name).
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// do serves a request and decodes the JSON response to v.
+func do(t *testing.T, s *Server, method, url string, body []byte, v interface{}) int {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(method, url, bytes.NewReader(body)))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("Invalid response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// Tests that an uploaded module is analysed, and that resubmitting it returns
+// the cached job.
+func TestSubmitArchive(t *testing.T) {
+	archive := zipArchive(t, map[string]string{
+		"leak/go.mod": "module example.com/leak\n",
+		"leak/main.go": `package main
+
+func main() {
+	ch := make(chan int)
+	go func() { ch <- 1 }()
+}
+`,
+	})
+	s := NewServer(1)
+	var job Job
+	if code := do(t, s, "POST", "/jobs", archive, &job); code != http.StatusAccepted {
+		t.Fatalf("Status of submission mismatch:\nExpect:\t%d\nGot:\t%d\n", http.StatusAccepted, code)
+	}
+	for deadline := time.Now().Add(time.Minute); job.Status == Queued || job.Status == Running; time.Sleep(100 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Job not finished: %+v", job)
+		}
+		do(t, s, "GET", "/jobs/"+job.ID, nil, &job)
+	}
+	if job.Status != Done {
+		t.Fatalf("Job failed: %s", job.Error)
+	}
+	var res struct {
+		MiGo        string
+		Diagnostics []struct{ Rule, Pos string }
+	}
+	do(t, s, "GET", "/jobs/"+job.ID+"/result", nil, &res)
+	found := false
+	for _, d := range res.Diagnostics {
+		found = found || d.Rule == "goroutine-leak" && strings.HasPrefix(d.Pos, "main.go:")
+	}
+	if !found {
+		t.Errorf("Expecting goroutine leak in main.go but got %v", res.Diagnostics)
+	}
+
+	var cached Job
+	if code := do(t, s, "POST", "/jobs", archive, &cached); code != http.StatusOK || cached.ID != job.ID {
+		t.Errorf("Cached job mismatch:\nExpect:\t%d %s\nGot:\t%d %s\n", http.StatusOK, job.ID, code, cached.ID)
+	}
+}
+
+// Tests that archives with entries outside the directory are rejected.
+func TestExtractOutside(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := extract(zipArchive(t, map[string]string{"../evil.go": "package evil\n"}), dir); err == nil {
+		t.Errorf("Expecting error for archive entry outside the directory")
+	}
+}
@@ -0,0 +1,88 @@
+package session
+
+import "github.com/nickng/migo"
+
+// Automaton is the finite-state automaton of a local type, where the
+// transitions are the messages of the local type, or internal actions (e.g.
+// loops back to a recursion).
+type Automaton struct {
+	States      int // Number of states, where the initial state is 0.
+	Final       int // Final state (end), or -1 if the local type does not end.
+	Transitions []Transition
+}
+
+// Transition is a transition of an automaton from state Src to Dst, labelled
+// by a message, or internal if Msg is nil.
+type Transition struct {
+	Src, Dst int
+	Msg      *Msg
+}
+
+// NewAutomaton returns the automaton of local type l. The branches of a choice
+// are the transitions from the same state.
+func NewAutomaton(l Local) *Automaton {
+	a := &Automaton{Final: -1}
+	recs := make(map[*Rec]int)
+	a.build(l, a.newState(), recs)
+	return a
+}
+
+func (a *Automaton) newState() int {
+	a.States++
+	return a.States - 1
+}
+
+// build adds the transitions of l from state at.
+func (a *Automaton) build(l Local, at int, recs map[*Rec]int) {
+	switch l := l.(type) {
+	case *Msg:
+		next := a.newState()
+		a.Transitions = append(a.Transitions, Transition{Src: at, Dst: next, Msg: l})
+		a.build(l.Cont, next, recs)
+	case *Choice:
+		for _, b := range l.Branches {
+			a.build(b, at, recs)
+		}
+	case *Rec:
+		recs[l] = at
+		a.build(l.Body, at, recs)
+	case *Var:
+		if s, ok := recs[l.rec]; ok && s != at {
+			a.Transitions = append(a.Transitions, Transition{Src: at, Dst: s})
+		}
+	default: // End.
+		if a.Final < 0 {
+			a.Final = a.newState()
+		}
+		a.Transitions = append(a.Transitions, Transition{Src: at, Dst: a.Final})
+	}
+}
+
+// ChanSizes returns the buffer sizes of the channels created in prog, by
+// channel (MiGo newchan).
+func ChanSizes(prog *migo.Program) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, f := range prog.Funcs {
+		chanSizes(f.Stmts, sizes)
+	}
+	return sizes
+}
+
+func chanSizes(stmts []migo.Statement, sizes map[string]int64) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			sizes[stmt.Chan] = stmt.Size
+		case *migo.IfStatement:
+			chanSizes(stmt.Then, sizes)
+			chanSizes(stmt.Else, sizes)
+		case *migo.IfForStatement:
+			chanSizes(stmt.Then, sizes)
+			chanSizes(stmt.Else, sizes)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				chanSizes(c, sizes)
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package session
+
+// Choreography graph.
+//
+// The choreography of a session is the bird's-eye view of its communication:
+// which role sends to which role, over which channels, and in which phase.
+// Unlike the global protocol (see Synthesise), it is always defined, e.g. a
+// channel shared by several senders (or receivers) is a node of the graph
+// between the roles which use it.
+//
+// The phase of a message is a lower bound of the number of messages its
+// sender and receiver exchange before it, i.e. the larger of the number of
+// messages before the first send (in the local type of the sender) and before
+// the first receive (in the local type of the receiver). Messages of the same
+// phase may happen in any order, and messages of a later phase may only
+// happen after some messages of the earlier phases.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Choreography is the communication graph of a session.
+type Choreography struct {
+	Roles  []string      `json:"roles"`
+	Spawns []ChoreoSpawn `json:"spawns"`
+	Edges  []*ChoreoEdge `json:"edges"`
+}
+
+// ChoreoSpawn is the spawn of role Role by role Spawner.
+type ChoreoSpawn struct {
+	Spawner string `json:"spawner"`
+	Role    string `json:"role"`
+}
+
+// ChoreoEdge is the messages from role From to role To on channel Chan. If the
+// channel is shared, i.e. sent to or received from by several roles, the
+// messages are to the channel (To is empty) or from the channel (From is
+// empty).
+type ChoreoEdge struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Chan   string   `json:"chan"`
+	Labels []string `json:"labels"` // Message labels, e.g. "close".
+	Phase  int      `json:"phase"`
+}
+
+func (e *ChoreoEdge) String() string {
+	from, to := e.From, e.To
+	if from == "" {
+		from = "[" + e.Chan + "]"
+	}
+	if to == "" {
+		to = "[" + e.Chan + "]"
+	}
+	return fmt.Sprintf("%d: %s -> %s: %s", e.Phase, from, to, strings.Join(e.Labels, ", "))
+}
+
+// Choreography returns the choreography graph of the session, with the edges
+// in order of phase.
+func (s *Session) Choreography() *Choreography {
+	c := &Choreography{Roles: []string{}, Spawns: []ChoreoSpawn{}, Edges: []*ChoreoEdge{}}
+	// Depths of the first send (and receive) on each channel, by role.
+	sends := make(map[string]map[string]int)
+	recvs := make(map[string]map[string]int)
+	for _, r := range s.Roles {
+		c.Roles = append(c.Roles, r.Name)
+		if r.Spawner != nil {
+			c.Spawns = append(c.Spawns, ChoreoSpawn{Spawner: r.Spawner.Name, Role: r.Name})
+		}
+		sends[r.Name], recvs[r.Name] = depths(r.Type)
+	}
+
+	// Channels without unique sender and receiver are nodes of the graph.
+	shared := make(map[string]bool)
+	for _, r := range s.Roles {
+		walk(r.Type, func(m *Msg) {
+			if m.Peer == "" {
+				shared[m.Chan] = true
+			}
+		})
+	}
+	edges := make(map[[3]string]*ChoreoEdge)
+	for _, r := range s.Roles {
+		walk(r.Type, func(m *Msg) {
+			var key [3]string
+			switch {
+			case m.Send && shared[m.Chan]:
+				key = [3]string{r.Name, "", m.Chan}
+			case m.Send:
+				key = [3]string{r.Name, m.Peer, m.Chan}
+			case shared[m.Chan]:
+				key = [3]string{"", r.Name, m.Chan}
+			default: // Recorded at the sender.
+				return
+			}
+			e, ok := edges[key]
+			if !ok {
+				e = &ChoreoEdge{From: key[0], To: key[1], Chan: m.Chan, Phase: -1}
+				edges[key] = e
+				c.Edges = append(c.Edges, e)
+			}
+			if !hasLabel(e.Labels, m.Label) {
+				e.Labels = append(e.Labels, m.Label)
+			}
+		})
+	}
+	for _, e := range c.Edges {
+		sort.Strings(e.Labels)
+		if d, ok := sends[e.From][e.Chan]; ok {
+			e.Phase = d
+		}
+		if d, ok := recvs[e.To][e.Chan]; ok && d > e.Phase {
+			e.Phase = d
+		}
+		if e.Phase < 0 {
+			e.Phase = 0
+		}
+	}
+	sort.SliceStable(c.Edges, func(i, j int) bool { return c.Edges[i].Phase < c.Edges[j].Phase })
+	return c
+}
+
+// depths returns the smallest number of messages before a send (and receive)
+// on each channel in t.
+func depths(t Local) (sends, recvs map[string]int) {
+	sends, recvs = make(map[string]int), make(map[string]int)
+	best := make(map[Local]int)
+	var visit func(t Local, d int)
+	visit = func(t Local, d int) {
+		if b, ok := best[t]; ok && b <= d {
+			return
+		}
+		best[t] = d
+		switch t := t.(type) {
+		case *Msg:
+			m := recvs
+			if t.Send {
+				m = sends
+			}
+			if b, ok := m[t.Chan]; !ok || d < b {
+				m[t.Chan] = d
+			}
+			visit(t.Cont, d+1)
+		case *Choice:
+			for _, b := range t.Branches {
+				visit(b, d)
+			}
+		case *Rec:
+			visit(t.Body, d)
+		}
+	}
+	visit(t, 0)
+	return sends, recvs
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Phases returns the number of phases of the choreography.
+func (c *Choreography) Phases() int {
+	n := 0
+	for _, e := range c.Edges {
+		if e.Phase+1 > n {
+			n = e.Phase + 1
+		}
+	}
+	return n
+}
+
+// WriteDot writes the choreography to w in graphviz dot format, with a node
+// for each role (and shared channel), and an edge for each channel between
+// roles labelled by phase and messages. Spawns are dotted edges.
+func (c *Choreography) WriteDot(w io.Writer) error {
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("digraph choreography {\n  node [shape=box];\n")
+	for _, r := range c.Roles {
+		fmt.Fprintf(bufw, "  %q;\n", r)
+	}
+	shared := make(map[string]bool)
+	for _, e := range c.Edges {
+		if (e.From == "" || e.To == "") && !shared[e.Chan] {
+			shared[e.Chan] = true
+			fmt.Fprintf(bufw, "  %q [shape=ellipse,label=%q];\n", "["+e.Chan+"]", e.Chan)
+		}
+	}
+	for _, sp := range c.Spawns {
+		fmt.Fprintf(bufw, "  %q -> %q [style=dotted,color=blue];\n", sp.Spawner, sp.Role)
+	}
+	for _, e := range c.Edges {
+		from, to := e.From, e.To
+		if from == "" {
+			from = "[" + e.Chan + "]"
+		}
+		if to == "" {
+			to = "[" + e.Chan + "]"
+		}
+		label := fmt.Sprintf("%d: %s", e.Phase, strings.Join(e.Labels, ", "))
+		fmt.Fprintf(bufw, "  %q -> %q [label=%q];\n", from, to, label)
+	}
+	bufw.WriteString("}\n")
+	return bufw.Flush()
+}
+
+// WriteHTML writes the choreography to w as a self-contained interactive HTML
+// page, which draws the roles in a circle and the edges up to the phase
+// selected, and highlights the edges of a role on hover.
+func (c *Choreography) WriteHTML(w io.Writer) error {
+	data, err := json.Marshal(c) // Escapes <, > and &.
+	if err != nil {
+		return err
+	}
+	bufw := bufio.NewWriter(w)
+	fmt.Fprintf(bufw, choreoHTML, data)
+	return bufw.Flush()
+}
+
+const choreoHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Choreography</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+.role rect { fill: #eef; stroke: #336; }
+.chan ellipse { fill: #ffe; stroke: #663; }
+.edge path { fill: none; stroke: #333; marker-end: url(#arrow); }
+.edge text { font-size: 11px; fill: #333; }
+.spawn path { fill: none; stroke: #36c; stroke-dasharray: 2,3; marker-end: url(#arrow); }
+.dim { opacity: 0.15; }
+.hl path { stroke: #c33; stroke-width: 2; }
+</style>
+</head>
+<body>
+<h1>Choreography</h1>
+<p>
+<label>Phase <input id="phase" type="range" min="0" value="0"> <span id="phaseval"></span></label>
+<label><input id="spawns" type="checkbox" checked> spawns</label>
+</p>
+<svg id="graph" width="900" height="700">
+<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z"/></marker></defs>
+</svg>
+<script id="data" type="application/json">%s</script>
+<script>
+(function() {
+  var c = JSON.parse(document.getElementById("data").textContent);
+  var svg = document.getElementById("graph"), ns = "http://www.w3.org/2000/svg";
+  var nodes = {}, names = c.roles.slice();
+  c.edges.forEach(function(e) {
+    ["from", "to"].forEach(function(k) {
+      if (e[k] === "") { e[k] = "[" + e.chan + "]"; if (names.indexOf(e[k]) < 0) names.push(e[k]); }
+    });
+  });
+  var cx = 450, cy = 350, r = Math.min(cx, cy) - 80;
+  names.forEach(function(n, i) {
+    var a = 2 * Math.PI * i / names.length - Math.PI / 2;
+    nodes[n] = {x: cx + r * Math.cos(a), y: cy + r * Math.sin(a)};
+  });
+  function el(name, attrs, parent) {
+    var e = document.createElementNS(ns, name);
+    for (var k in attrs) e.setAttribute(k, attrs[k]);
+    (parent || svg).appendChild(e);
+    return e;
+  }
+  function curve(from, to, bend) {
+    var a = nodes[from], b = nodes[to];
+    if (from === to) return "M" + a.x + "," + (a.y - 15) + " c40,-60 80,0 20,15";
+    var mx = (a.x + b.x) / 2 - (b.y - a.y) * bend, my = (a.y + b.y) / 2 + (b.x - a.x) * bend;
+    return "M" + a.x + "," + a.y + " Q" + mx + "," + my + " " + b.x + "," + b.y;
+  }
+  var spawns = c.spawns.map(function(s) {
+    var g = el("g", {"class": "spawn"});
+    el("path", {d: curve(s.spawner, s.role, 0)}, g);
+    return g;
+  });
+  var edges = c.edges.map(function(e, i) {
+    var g = el("g", {"class": "edge"});
+    var p = el("path", {id: "edge" + i, d: curve(e.from, e.to, 0.15)}, g);
+    var t = el("text", {}, g), tp = el("textPath", {startOffset: "50%%"}, t);
+    tp.setAttributeNS("http://www.w3.org/1999/xlink", "href", "#" + p.id);
+    tp.setAttribute("href", "#" + p.id);
+    tp.textContent = e.phase + ": " + e.labels.join(", ");
+    el("title", {}, g).textContent = e.from + " -> " + e.to + " on " + e.chan + " (phase " + e.phase + ")";
+    return {e: e, g: g};
+  });
+  names.forEach(function(n) {
+    var p = nodes[n], shared = c.roles.indexOf(n) < 0;
+    var g = el("g", {"class": shared ? "chan" : "role"});
+    var t = el("text", {x: p.x, y: p.y + 4, "text-anchor": "middle"}, g);
+    t.textContent = n;
+    var w = Math.max(60, n.length * 7 + 16);
+    if (shared) el("ellipse", {cx: p.x, cy: p.y, rx: w / 2, ry: 14}, g);
+    else el("rect", {x: p.x - w / 2, y: p.y - 14, width: w, height: 28}, g);
+    g.appendChild(t);
+    g.addEventListener("mouseover", function() {
+      edges.forEach(function(x) {
+        var on = x.e.from === n || x.e.to === n;
+        x.g.classList.toggle("hl", on);
+        x.g.classList.toggle("dim", !on);
+      });
+    });
+    g.addEventListener("mouseout", function() {
+      edges.forEach(function(x) { x.g.classList.remove("hl"); x.g.classList.remove("dim"); });
+    });
+  });
+  var phase = document.getElementById("phase"), maxPhase = 0;
+  c.edges.forEach(function(e) { if (e.phase > maxPhase) maxPhase = e.phase; });
+  phase.max = maxPhase;
+  phase.value = maxPhase;
+  function update() {
+    document.getElementById("phaseval").textContent = phase.value + " / " + maxPhase;
+    edges.forEach(function(x) { x.g.style.display = x.e.phase <= +phase.value ? "" : "none"; });
+    var show = document.getElementById("spawns").checked;
+    spawns.forEach(function(g) { g.style.display = show ? "" : "none"; });
+  }
+  phase.addEventListener("input", update);
+  document.getElementById("spawns").addEventListener("change", update);
+  update();
+})();
+</script>
+</body>
+</html>
+`
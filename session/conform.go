@@ -0,0 +1,191 @@
+package session
+
+import (
+	"fmt"
+
+	"github.com/nickng/gospal/diag"
+)
+
+// Deviation is a deviation of the inferred local type of a role from its
+// specification.
+type Deviation struct {
+	Role     string // Role deviating.
+	Pos      string // Spawn site of the role (or empty if unknown).
+	ChanPos  string // Creation site of the channel of the message (or empty).
+	Expected string // Expected local type at the deviation.
+	Got      string // Inferred local type at the deviation.
+}
+
+func (d Deviation) String() string {
+	pos := d.Pos
+	if pos == "" {
+		pos = "-"
+	}
+	s := fmt.Sprintf("%s: role %s deviates from protocol: expected %s, got %s", pos, d.Role, d.Expected, d.Got)
+	if d.ChanPos != "" {
+		s += fmt.Sprintf("\n\tchannel created at %s", d.ChanPos)
+	}
+	return s
+}
+
+// Diagnostic returns the deviation as a diagnostic, at the spawn site of the
+// role, with the creation site of the channel as related location.
+func (d Deviation) Diagnostic() diag.Diagnostic {
+	dg := diag.Diagnostic{
+		Rule:    diag.ProtocolConformance,
+		Message: fmt.Sprintf("role %s deviates from protocol: expected %s, got %s", d.Role, d.Expected, d.Got),
+		Pos:     diag.ParsePos(d.Pos),
+	}
+	if d.ChanPos != "" {
+		dg.Related = append(dg.Related, diag.Location{Pos: diag.ParsePos(d.ChanPos), Message: "channel created here"})
+	}
+	return dg
+}
+
+// Conform checks the local types of the roles of the session against spec,
+// and returns the deviations (at most one per role). spawns and chans are the
+// spawn sites of goroutines (by MiGo definition) and the creation sites of
+// channels (by MiGo channel), used as the locations of the deviations.
+//
+// The inferred type of a role conforms to its expected type if it is a
+// subtype of the expected type, i.e. the role only sends the messages the
+// expected type may send, and receives (at least) the messages the expected
+// type may receive. Messages with labels (and channels) not mentioned in the
+// expected type are ignored, so a specification can be restricted to some
+// channels of a role. A role declared in spec but not in the session deviates.
+func (s *Session) Conform(spec *Spec, spawns, chans map[string]string) []Deviation {
+	var devs []Deviation
+	for _, name := range spec.Roles {
+		r := s.Role(name)
+		if r == nil {
+			devs = append(devs, Deviation{Role: name, Expected: spec.Types[name].String(), Got: "no such role"})
+			continue
+		}
+		c := conformance{
+			labels:  make(map[string]bool),
+			visited: make(map[[2]Local]bool),
+		}
+		walk(spec.Types[name], func(m *Msg) {
+			c.labels[m.Label] = true
+			if m.Chan != "" {
+				c.labels[m.Chan] = true
+			}
+		})
+		if c.check(r.Type, spec.Types[name]) {
+			continue
+		}
+		d := Deviation{Role: name, Pos: spawns[r.Def], Expected: c.expected.String(), Got: c.got.String()}
+		if m, ok := c.got.(*Msg); ok {
+			d.ChanPos = chans[m.Chan]
+		}
+		devs = append(devs, d)
+	}
+	return devs
+}
+
+// conformance is the state of a subtyping check.
+type conformance struct {
+	labels        map[string]bool   // Labels (and channels) of the expected type.
+	visited       map[[2]Local]bool // Pairs of types assumed to conform.
+	got, expected Local             // Types at the deviation.
+}
+
+// hidden returns true if message m is not mentioned in the expected type.
+func (c *conformance) hidden(m *Msg) bool {
+	return !c.labels[m.Label] && !c.labels[m.Chan]
+}
+
+// match returns true if inferred message m matches expected message e.
+func match(m, e *Msg) bool {
+	if m.Send != e.Send {
+		return false
+	}
+	if e.Label != m.Label && e.Label != m.Chan && e.Chan != m.Chan {
+		return false
+	}
+	return e.Peer == "" || e.Peer == "*" || e.Peer == m.Peer
+}
+
+// check returns true if inferred type t conforms to expected type e.
+func (c *conformance) check(t, e Local) bool {
+	t, e = unfold(t), unfold(e)
+	pair := [2]Local{t, e}
+	if c.visited[pair] {
+		return true
+	}
+	c.visited[pair] = true
+	fail := func() bool {
+		if c.got == nil {
+			c.got, c.expected = t, e
+		}
+		return false
+	}
+	if m, ok := t.(*Msg); ok && c.hidden(m) {
+		return c.check(m.Cont, e)
+	}
+	switch t := t.(type) {
+	case *End:
+		if _, ok := e.(*End); ok {
+			return true
+		}
+		if ec, ok := e.(*Choice); ok && ec.Kind != External {
+			for _, b := range ec.Branches {
+				if _, ok := unfold(b).(*End); ok {
+					return true
+				}
+			}
+		}
+		return fail()
+	case *Msg:
+		for _, b := range branches(e) {
+			if em, ok := unfold(b).(*Msg); ok && match(t, em) {
+				return c.check(t.Cont, em.Cont)
+			}
+		}
+		return fail()
+	case *Choice:
+		if t.Kind == External {
+			// Every message the expected type receives is received.
+			ec, ok := e.(*Choice)
+			if !ok {
+				ec = &Choice{Kind: External, Branches: []Local{e}}
+			}
+			for _, b := range ec.Branches {
+				em, ok := unfold(b).(*Msg)
+				if !ok {
+					return fail()
+				}
+				found := false
+				for _, tb := range t.Branches {
+					if tm, ok := unfold(tb).(*Msg); ok && match(tm, em) {
+						if !c.check(tm.Cont, em.Cont) {
+							return false
+						}
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fail()
+				}
+			}
+			return true
+		}
+		// Every branch selected by the role is expected.
+		for _, b := range t.Branches {
+			if !c.check(b, e) {
+				return false
+			}
+		}
+		return true
+	}
+	return fail()
+}
+
+// branches returns the branches of choice t, or t if it is not a choice.
+func branches(t Local) []Local {
+	if c, ok := t.(*Choice); ok {
+		return c.Branches
+	}
+	return []Local{t}
+}
@@ -0,0 +1,387 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nickng/gospal/internal/cancel"
+	"github.com/nickng/gospal/internal/timer"
+	"github.com/nickng/migo"
+)
+
+// MaxNodes is the maximum size of the local type of a role. Calls are inlined
+// in the local types, so the extraction of a role stops at MaxNodes and the
+// role is marked as truncated.
+var MaxNodes = 100000
+
+// Role is a participant of the session, i.e. a goroutine (or a top-level
+// process) of the MiGo program.
+type Role struct {
+	Name      string // Name of the role.
+	Def       string // MiGo definition of the goroutine.
+	Spawner   *Role  // Role which spawns the role, or nil if top-level.
+	Type      Local  // Local session type.
+	Truncated bool   // Type exceeds MaxNodes.
+}
+
+// Session is the roles of a MiGo program with their local types.
+type Session struct {
+	Roles []*Role
+}
+
+// extractor walks a MiGo program to build the local types of each role.
+type extractor struct {
+	funcs   map[string]*migo.Function
+	spawned map[string]bool // Spawned definitions (with arguments).
+	names   map[string]int  // Number of roles, by definition.
+	sess    *Session
+}
+
+// frame is a definition being inlined in a role.
+type frame struct {
+	role  *Role
+	nodes int
+	stack map[string]*Rec // Definitions (with arguments) being inlined.
+	nRec  int
+}
+
+// Extract returns the session of prog, where the top-level definitions (i.e.
+// definitions not called or spawned by others, without parameters) and the
+// goroutines they spawn are roles.
+func Extract(prog *migo.Program) *Session {
+	x := extractor{
+		funcs:   make(map[string]*migo.Function),
+		spawned: make(map[string]bool),
+		names:   make(map[string]int),
+		sess:    new(Session),
+	}
+	used := make(map[string]bool)
+	for _, f := range prog.Funcs {
+		x.funcs[f.SimpleName()] = f
+		markUsed(f.Stmts, used)
+	}
+	for _, f := range prog.Funcs {
+		if !used[f.SimpleName()] && len(f.Params) == 0 {
+			x.run(f.SimpleName(), nil, make(map[string]string))
+		}
+	}
+	x.sess.resolvePeers()
+	return x.sess
+}
+
+// markUsed marks the definitions called or spawned in stmts.
+func markUsed(stmts []migo.Statement, used map[string]bool) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *migo.CallStatement:
+			used[simpleName(stmt.Name)] = true
+		case *migo.SpawnStatement:
+			used[simpleName(stmt.Name)] = true
+		case *migo.IfStatement:
+			markUsed(stmt.Then, used)
+			markUsed(stmt.Else, used)
+		case *migo.IfForStatement:
+			markUsed(stmt.Then, used)
+			markUsed(stmt.Else, used)
+		case *migo.SelectStatement:
+			for _, c := range stmt.Cases {
+				markUsed(c, used)
+			}
+		}
+	}
+}
+
+// simpleName returns the name of the definition called or spawned as name,
+// as the definitions are named (see migo.Function.SimpleName).
+func simpleName(name string) string {
+	return migo.NewFunction(name).SimpleName()
+}
+
+// run adds a role for definition def with channels env.
+func (x *extractor) run(def string, spawner *Role, env map[string]string) {
+	x.names[def]++
+	name := def
+	if n := x.names[def]; n > 1 {
+		name = fmt.Sprintf("%s[%d]", def, n)
+	}
+	r := &Role{Name: name, Def: def, Spawner: spawner}
+	x.sess.Roles = append(x.sess.Roles, r)
+	fr := &frame{role: r, stack: make(map[string]*Rec)}
+	r.Type = x.call(fr, def, nil, env, end)
+	r.Truncated = fr.nodes > MaxNodes
+}
+
+// args returns the channels env of the callee of a call/spawn with params,
+// and a key identifying the call.
+func args(name string, params []*migo.Parameter, env map[string]string) (map[string]string, string) {
+	calleeEnv := make(map[string]string)
+	chs := []string{name}
+	for _, param := range params {
+		if ch, ok := env[param.Caller.Name()]; ok {
+			calleeEnv[param.Callee.Name()] = ch
+			chs = append(chs, ch)
+		}
+	}
+	return calleeEnv, strings.Join(chs, ",")
+}
+
+// call returns the local type of the body of definition def followed by k.
+// Recursive calls are recursion variables, where the continuation of
+// non-tail recursive calls is ignored (loops are tail calls in MiGo).
+func (x *extractor) call(fr *frame, def string, params []*migo.Parameter, env map[string]string, k Local) Local {
+	calleeEnv := env
+	key := def
+	if params != nil {
+		calleeEnv, key = args(def, params, env)
+	}
+	if r, ok := fr.stack[key]; ok {
+		r.used = true
+		return &Var{Name: r.Var, rec: r}
+	}
+	f, ok := x.funcs[def]
+	if !ok {
+		return k
+	}
+	fr.nRec++
+	r := &Rec{Var: fmt.Sprintf("X%d", fr.nRec)}
+	fr.stack[key] = r
+	body := x.seq(fr, f.Stmts, calleeEnv, k)
+	delete(fr.stack, key)
+	if !r.used {
+		return body
+	}
+	r.Body = body
+	return r
+}
+
+// seq returns the local type of stmts followed by k.
+func (x *extractor) seq(fr *frame, stmts []migo.Statement, env map[string]string, k Local) Local {
+	for i, stmt := range stmts {
+		if fr.nodes++; fr.nodes > MaxNodes {
+			return end
+		}
+		rest := func() Local { return x.seq(fr, stmts[i+1:], copyEnv(env), k) }
+		switch stmt := stmt.(type) {
+		case *migo.NewChanStatement:
+			env[stmt.Name.Name()] = stmt.Chan
+		case *migo.SendStatement:
+			if ch, ok := env[stmt.Chan]; ok {
+				return &Msg{Send: true, Chan: ch, Label: stmt.Chan, Cont: rest()}
+			}
+		case *migo.RecvStatement:
+			if ch, ok := env[stmt.Chan]; ok {
+				return &Msg{Chan: ch, Label: stmt.Chan, Cont: rest()}
+			}
+		case *migo.CloseStatement:
+			if ch, ok := env[stmt.Chan]; ok {
+				return &Msg{Send: true, Chan: ch, Label: "close", Cont: rest()}
+			}
+		case *cancel.Close:
+			if ch, ok := env[stmt.Chan]; ok {
+				return &Msg{Send: true, Chan: ch, Label: "close", Cont: rest()}
+			}
+		case *timer.Start:
+			if ch, ok := env[stmt.Chan]; ok {
+				return &Msg{Send: true, Chan: ch, Label: stmt.Chan, Cont: rest()}
+			}
+		case *timer.Timeout:
+			if ch, ok := env[stmt.Chan]; ok {
+				return &Msg{Chan: ch, Label: stmt.Chan, Cont: rest()}
+			}
+		case *migo.CallStatement:
+			return x.call(fr, simpleName(stmt.Name), stmt.Params, env, rest())
+		case *migo.SpawnStatement:
+			def := simpleName(stmt.Name)
+			calleeEnv, key := args(def, stmt.Params, env)
+			if !x.spawned[key] {
+				x.spawned[key] = true
+				x.run(def, fr.role, calleeEnv)
+			}
+		case *migo.IfStatement:
+			return x.choice(fr, [][]migo.Statement{stmt.Then, stmt.Else}, env, rest())
+		case *migo.IfForStatement:
+			return x.choice(fr, [][]migo.Statement{stmt.Then, stmt.Else}, env, rest())
+		case *migo.SelectStatement:
+			return x.sel(fr, stmt, env, rest())
+		}
+	}
+	return k
+}
+
+// choice returns the internal choice between branches followed by k.
+func (x *extractor) choice(fr *frame, branches [][]migo.Statement, env map[string]string, k Local) Local {
+	c := &Choice{Kind: Internal}
+	for _, b := range branches {
+		t := x.seq(fr, b, copyEnv(env), k)
+		if !hasBranch(c, t) {
+			c.Branches = append(c.Branches, t)
+		}
+	}
+	if len(c.Branches) == 1 {
+		return c.Branches[0] // Branches do not communicate.
+	}
+	return c
+}
+
+// sel returns the choice of select statement stmt followed by k.
+func (x *extractor) sel(fr *frame, stmt *migo.SelectStatement, env map[string]string, k Local) Local {
+	c := &Choice{Kind: External}
+	var sends, recvs, taus int
+	for _, cas := range stmt.Cases {
+		if len(cas) > 0 {
+			switch cas[0].(type) {
+			case *migo.SendStatement, *migo.CloseStatement:
+				sends++
+			case *migo.RecvStatement:
+				recvs++
+			default:
+				taus++
+			}
+		}
+		if t := x.seq(fr, cas, copyEnv(env), k); !hasBranch(c, t) {
+			c.Branches = append(c.Branches, t)
+		}
+	}
+	switch {
+	case sends > 0 && recvs == 0 && taus == 0:
+		c.Kind = Internal
+	case sends > 0 || taus > 0:
+		c.Kind = Mixed
+	}
+	if len(c.Branches) == 1 {
+		return c.Branches[0]
+	}
+	return c
+}
+
+func hasBranch(c *Choice, t Local) bool {
+	for _, b := range c.Branches {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+func copyEnv(env map[string]string) map[string]string {
+	m := make(map[string]string, len(env))
+	for k, v := range env {
+		m[k] = v
+	}
+	return m
+}
+
+// resolvePeers sets the peers of the messages, i.e. the role at the other end
+// of the channel if it is unique.
+func (s *Session) resolvePeers() {
+	senders := make(map[string]map[string]bool)
+	receivers := make(map[string]map[string]bool)
+	add := func(m map[string]map[string]bool, ch, role string) {
+		if m[ch] == nil {
+			m[ch] = make(map[string]bool)
+		}
+		m[ch][role] = true
+	}
+	for _, r := range s.Roles {
+		walk(r.Type, func(m *Msg) {
+			if m.Send {
+				add(senders, m.Chan, r.Name)
+			} else {
+				add(receivers, m.Chan, r.Name)
+			}
+		})
+	}
+	only := func(roles map[string]bool) string {
+		if len(roles) != 1 {
+			return ""
+		}
+		for r := range roles {
+			return r
+		}
+		return ""
+	}
+	for _, r := range s.Roles {
+		walk(r.Type, func(m *Msg) {
+			if m.Send {
+				m.Peer = only(receivers[m.Chan])
+			} else {
+				m.Peer = only(senders[m.Chan])
+			}
+		})
+	}
+}
+
+// walk calls f on each message of t.
+func walk(t Local, f func(*Msg)) {
+	visited := make(map[Local]bool)
+	var visit func(Local)
+	visit = func(t Local) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		switch t := t.(type) {
+		case *Msg:
+			f(t)
+			visit(t.Cont)
+		case *Choice:
+			for _, b := range t.Branches {
+				visit(b)
+			}
+		case *Rec:
+			visit(t.Body)
+		}
+	}
+	visit(t)
+}
+
+// Role returns the role with the given name, or nil if not found.
+func (s *Session) Role(name string) *Role {
+	for _, r := range s.Roles {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Endpoints returns the roles which send on and receive from channel ch
+// (MiGo newchan), in order of the roles.
+func (s *Session) Endpoints(ch string) (senders, receivers []string) {
+	for _, r := range s.Roles {
+		var send, recv bool
+		walk(r.Type, func(m *Msg) {
+			if m.Chan == ch {
+				send, recv = send || m.Send, recv || !m.Send
+			}
+		})
+		if send {
+			senders = append(senders, r.Name)
+		}
+		if recv {
+			receivers = append(receivers, r.Name)
+		}
+	}
+	return senders, receivers
+}
+
+// WriteTo writes the local type of each role to w, one per line, e.g.
+//
+//	main.main: main.main$1!ch; main.main$1?reply
+//	main.main$1: main.main?ch; main.main!reply
+func (s *Session) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, r := range s.Roles {
+		trunc := ""
+		if r.Truncated {
+			trunc = " (truncated)"
+		}
+		c, err := fmt.Fprintf(w, "%s: %s%s\n", r.Name, r.Type, trunc)
+		n += int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,281 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxStates is the maximum number of states explored by Synthesise.
+var MaxStates = 10000
+
+// Global is a global session type.
+type Global interface {
+	String() string
+	global()
+}
+
+// GEnd is the terminated global type.
+type GEnd struct{}
+
+// Interaction is a message from role From to role To, followed by Cont.
+type Interaction struct {
+	From, To string
+	Chan     string
+	Label    string
+	Cont     Global
+}
+
+// GChoice is a choice of role From between Branches, which are interactions
+// from From to To with distinct labels.
+type GChoice struct {
+	From, To string
+	Branches []*Interaction
+}
+
+// GRec is a recursive global type, where GVar in Body stands for the type.
+type GRec struct {
+	Var  string
+	Body Global
+
+	used bool
+}
+
+// GVar is a recursion variable.
+type GVar struct {
+	Name string
+}
+
+func (*GEnd) global()        {}
+func (*Interaction) global() {}
+func (*GChoice) global()     {}
+func (*GRec) global()        {}
+func (*GVar) global()        {}
+
+func (*GEnd) String() string { return "end" }
+
+func (i *Interaction) String() string {
+	if _, ok := i.Cont.(*GEnd); ok {
+		return fmt.Sprintf("%s -> %s: %s", i.From, i.To, i.Label)
+	}
+	return fmt.Sprintf("%s -> %s: %s; %s", i.From, i.To, i.Label, i.Cont)
+}
+
+func (c *GChoice) String() string {
+	var branches []string
+	for _, b := range c.Branches {
+		branches = append(branches, b.String())
+	}
+	return fmt.Sprintf("choice at %s {%s}", c.From, strings.Join(branches, " or "))
+}
+
+func (r *GRec) String() string { return fmt.Sprintf("rec %s {%s}", r.Var, r.Body) }
+
+func (v *GVar) String() string { return v.Name }
+
+// Errors of global protocol synthesis, when the projection conditions do not
+// hold.
+var (
+	ErrSharedChan       = errors.New("channel is not point-to-point")
+	ErrMixedChoice      = errors.New("mixed choice (select on sends and receives, or with default)")
+	ErrUndirectedChoice = errors.New("choice is not communicated to a single role")
+	ErrStuck            = errors.New("no interaction possible but roles not terminated")
+	ErrTooLarge         = errors.New("too many states")
+)
+
+// ErrSynthesis is an error of global protocol synthesis, at a role.
+type ErrSynthesis struct {
+	Role string
+	Err  error
+}
+
+func (e ErrSynthesis) Error() string {
+	return fmt.Sprintf("cannot synthesise global protocol at role %s: %v", e.Role, e.Err)
+}
+
+// synth is the state of global protocol synthesis.
+type synth struct {
+	roles  []*Role
+	index  map[string]int
+	path   map[string]*GRec // States on the current path.
+	states int
+	nRec   int
+}
+
+// Synthesise returns the global protocol of the session, if the projection
+// conditions hold:
+//
+//   - every channel is point-to-point, i.e. sent to (or closed) by a single
+//     role and received from by a single other role,
+//   - choices are directed, i.e. each branch of an internal choice starts with
+//     a message to the same role, with distinct labels, and select statements
+//     do not mix sends and receives, and
+//   - the roles do not get stuck, i.e. until the top-level roles terminate
+//     (goroutines are terminated with the program), some role can send a
+//     message the peer is ready to receive.
+//
+// Messages are synchronous, including messages on buffered channels. When
+// several interactions are possible, the interaction of the first role (in
+// order of Roles) is chosen, so independent interactions are sequenced.
+func (s *Session) Synthesise() (Global, error) {
+	for _, r := range s.Roles {
+		var err error
+		walk(r.Type, func(m *Msg) {
+			if m.Peer == "" && err == nil {
+				err = ErrSynthesis{Role: r.Name, Err: fmt.Errorf("%v: %s", ErrSharedChan, m.Chan)}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sy := synth{roles: s.Roles, index: make(map[string]int), path: make(map[string]*GRec)}
+	state := make([]Local, len(s.Roles))
+	for i, r := range s.Roles {
+		sy.index[r.Name] = i
+		state[i] = unfold(r.Type)
+	}
+	return sy.synth(state)
+}
+
+// key returns a key identifying state.
+func key(state []Local) string {
+	var b strings.Builder
+	for _, t := range state {
+		fmt.Fprintf(&b, "%p,", t)
+	}
+	return b.String()
+}
+
+// synth returns the global type of the roles in state.
+func (sy *synth) synth(state []Local) (Global, error) {
+	k := key(state)
+	if r, ok := sy.path[k]; ok {
+		r.used = true
+		return &GVar{Name: r.Var}, nil
+	}
+	if sy.states++; sy.states > MaxStates {
+		return nil, ErrTooLarge
+	}
+	sy.nRec++
+	r := &GRec{Var: fmt.Sprintf("X%d", sy.nRec)}
+	sy.path[k] = r
+	defer delete(sy.path, k)
+
+	g, err := sy.step(state)
+	if err != nil || !r.used {
+		return g, err
+	}
+	r.Body = g
+	return r, nil
+}
+
+// step returns the global type of the first possible interaction in state.
+func (sy *synth) step(state []Local) (Global, error) {
+	done := true
+	for i, t := range state {
+		if _, ok := t.(*End); !ok && sy.roles[i].Spawner == nil {
+			done = false
+		}
+		var sends []*Msg
+		switch t := t.(type) {
+		case *Msg:
+			if t.Send {
+				sends = []*Msg{t}
+			}
+		case *Choice:
+			switch t.Kind {
+			case Mixed:
+				return nil, ErrSynthesis{Role: sy.roles[i].Name, Err: ErrMixedChoice}
+			case Internal:
+				var err error
+				if sends, err = sy.choiceSends(t); err != nil {
+					return nil, ErrSynthesis{Role: sy.roles[i].Name, Err: err}
+				}
+			}
+		}
+		if len(sends) == 0 {
+			continue
+		}
+		j, ok := sy.index[sends[0].Peer]
+		if !ok || !sy.ready(state[j], sends) {
+			continue
+		}
+		var branches []*Interaction
+		for _, m := range sends {
+			next := append([]Local(nil), state...)
+			next[i] = unfold(m.Cont)
+			next[j] = unfold(recvFor(state[j], m.Chan).Cont)
+			cont, err := sy.synth(next)
+			if err != nil {
+				return nil, err
+			}
+			branches = append(branches, &Interaction{From: sy.roles[i].Name, To: m.Peer, Chan: m.Chan, Label: m.Label, Cont: cont})
+		}
+		if len(branches) == 1 {
+			return branches[0], nil
+		}
+		return &GChoice{From: sy.roles[i].Name, To: sends[0].Peer, Branches: branches}, nil
+	}
+	if done {
+		return &GEnd{}, nil
+	}
+	var blocked []string
+	for i, t := range state {
+		if _, ok := t.(*End); !ok {
+			blocked = append(blocked, sy.roles[i].Name)
+		}
+	}
+	sort.Strings(blocked)
+	return nil, ErrSynthesis{Role: strings.Join(blocked, ", "), Err: ErrStuck}
+}
+
+// choiceSends returns the first messages of the branches of internal choice
+// c, which must be sends to the same role with distinct labels.
+func (sy *synth) choiceSends(c *Choice) ([]*Msg, error) {
+	var sends []*Msg
+	labels := make(map[string]bool)
+	for _, b := range c.Branches {
+		m, ok := unfold(b).(*Msg)
+		if !ok || !m.Send {
+			return nil, ErrUndirectedChoice
+		}
+		if len(sends) > 0 && m.Peer != sends[0].Peer || labels[m.Chan+"."+m.Label] {
+			return nil, ErrUndirectedChoice
+		}
+		labels[m.Chan+"."+m.Label] = true
+		sends = append(sends, m)
+	}
+	return sends, nil
+}
+
+// ready returns true if t can receive every message of sends.
+func (sy *synth) ready(t Local, sends []*Msg) bool {
+	for _, m := range sends {
+		if recvFor(t, m.Chan) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// recvFor returns the receive on channel ch t is ready to perform, or nil.
+func recvFor(t Local, ch string) *Msg {
+	switch t := t.(type) {
+	case *Msg:
+		if !t.Send && t.Chan == ch {
+			return t
+		}
+	case *Choice:
+		if t.Kind != External {
+			return nil
+		}
+		for _, b := range t.Branches {
+			if m, ok := unfold(b).(*Msg); ok && !m.Send && m.Chan == ch {
+				return m
+			}
+		}
+	}
+	return nil
+}
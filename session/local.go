@@ -0,0 +1,131 @@
+// Package session extracts multiparty session types from inferred MiGo
+// programs.
+//
+// Each goroutine (process) of a MiGo program is a role, and its behaviour is
+// abstracted as a local session type (Local), i.e. the sequence of messages
+// the role sends to and receives from the other roles, with choices and
+// recursion. The label of a message is the name of the channel at the sender
+// (or "close" for closing a channel), and the peer of a message is the role
+// at the other end of the channel.
+//
+// When the projection conditions hold (see Synthesise), a global protocol
+// (Global) is synthesised from the local types, i.e. the interactions between
+// the roles as seen by an external observer.
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Local is a local session type.
+type Local interface {
+	String() string
+	local()
+}
+
+// End is the terminated local type.
+type End struct{}
+
+// Msg is a message sent (or received) on a channel, followed by Cont.
+type Msg struct {
+	Send  bool   // Send (or receive).
+	Chan  string // Channel (MiGo newchan).
+	Label string // Message label.
+	Peer  string // Role at the other end, or empty if not unique.
+	Cont  Local
+}
+
+// ChoiceKind is the kind of a choice.
+type ChoiceKind int
+
+// Kinds of choices.
+const (
+	Internal ChoiceKind = iota // Selected by the role (if or select on sends).
+	External                   // Offered to peers (select on receives).
+	Mixed                      // Select on sends and receives, or with default.
+)
+
+// Choice is a choice between Branches.
+type Choice struct {
+	Kind     ChoiceKind
+	Branches []Local
+}
+
+// Rec is a recursive local type, where Var in Body stands for the type.
+type Rec struct {
+	Var  string
+	Body Local
+
+	used bool // Var occurs in Body.
+}
+
+// Var is a recursion variable.
+type Var struct {
+	Name string
+
+	rec *Rec
+}
+
+var end = &End{}
+
+func (*End) local()    {}
+func (*Msg) local()    {}
+func (*Choice) local() {}
+func (*Rec) local()    {}
+func (*Var) local()    {}
+
+func (*End) String() string { return "end" }
+
+func (m *Msg) String() string {
+	peer := m.Peer
+	if peer == "" {
+		peer = "[" + m.Chan + "]"
+	}
+	op := "?"
+	if m.Send {
+		op = "!"
+	}
+	if _, ok := m.Cont.(*End); ok {
+		return fmt.Sprintf("%s%s%s", peer, op, m.Label)
+	}
+	return fmt.Sprintf("%s%s%s; %s", peer, op, m.Label, m.Cont)
+}
+
+func (c *Choice) String() string {
+	var branches []string
+	for _, b := range c.Branches {
+		branches = append(branches, b.String())
+	}
+	op := "+"
+	switch c.Kind {
+	case External:
+		op = "&"
+	case Mixed:
+		op = "+&"
+	}
+	return fmt.Sprintf("%s{%s}", op, strings.Join(branches, ", "))
+}
+
+func (r *Rec) String() string { return fmt.Sprintf("rec %s {%s}", r.Var, r.Body) }
+
+func (v *Var) String() string { return v.Name }
+
+// unfold returns t with leading recursions unfolded, i.e. a Msg, Choice or
+// End.
+func unfold(t Local) Local {
+	for i := 0; i < 100; i++ {
+		switch u := t.(type) {
+		case *Rec:
+			t = u.Body
+		case *Var:
+			if u.rec == nil || u.rec.Body == nil {
+				return end
+			}
+			t = u.rec.Body
+		default:
+			return t
+		}
+	}
+	return end // Unguarded recursion.
+}
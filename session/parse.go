@@ -0,0 +1,225 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Spec is a protocol specification, i.e. the expected local types of some
+// roles.
+type Spec struct {
+	Roles []string         // Roles in order of declaration.
+	Types map[string]Local // Expected local types, by role.
+}
+
+// ErrParse is a syntax error in a protocol specification.
+type ErrParse struct {
+	Line int
+	Msg  string
+}
+
+func (e ErrParse) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ParseSpec parses a protocol specification from r. Each line declares the
+// expected local type of a role, in the syntax of Session.WriteTo, e.g.
+//
+//	// Comment.
+//	main.main: main.pong!ping; main.pong?reply; end
+//	main.pong: rec X {main.main?ping; main.main!reply; X}
+//
+// where peer!label is a send, peer?label a receive, +{...} an internal choice,
+// &{...} an external choice, and rec X {...} a recursive type. The peer * is
+// any role, and [ch] is the channel ch without a unique peer.
+func ParseSpec(r io.Reader) (*Spec, error) {
+	spec := &Spec{Types: make(map[string]Local)}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			return nil, ErrParse{Line: n, Msg: "expecting role: type"}
+		}
+		role := strings.TrimSpace(line[:i])
+		if _, ok := spec.Types[role]; ok {
+			return nil, ErrParse{Line: n, Msg: fmt.Sprintf("role %s declared twice", role)}
+		}
+		p := parser{src: line[i+2:], vars: make(map[string]*Rec)}
+		t, err := p.local()
+		if err == nil && p.next() != "" {
+			err = fmt.Errorf("unexpected %q", p.tok)
+		}
+		if err != nil {
+			return nil, ErrParse{Line: n, Msg: err.Error()}
+		}
+		spec.Roles = append(spec.Roles, role)
+		spec.Types[role] = t
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// parser is a parser of a local type.
+type parser struct {
+	src  string
+	tok  string
+	peek bool // tok is not consumed.
+	vars map[string]*Rec
+}
+
+func isDelim(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("!?;,{}[]", r)
+}
+
+// next returns the next token, or empty at the end of input.
+func (p *parser) next() string {
+	if p.peek {
+		p.peek = false
+		return p.tok
+	}
+	p.src = strings.TrimLeftFunc(p.src, unicode.IsSpace)
+	switch {
+	case p.src == "":
+		p.tok = ""
+	case strings.HasPrefix(p.src, "+&"):
+		p.tok = "+&"
+	case strings.HasPrefix(p.src, "+{"), strings.HasPrefix(p.src, "&{"), isDelim(rune(p.src[0])):
+		p.tok = p.src[:1]
+	default:
+		i := strings.IndexFunc(p.src, isDelim)
+		if i < 0 {
+			i = len(p.src)
+		}
+		p.tok = p.src[:i]
+	}
+	p.src = p.src[len(p.tok):]
+	return p.tok
+}
+
+func (p *parser) unread() { p.peek = true }
+
+func (p *parser) expect(tok string) error {
+	if t := p.next(); t != tok {
+		return fmt.Errorf("expecting %q but got %q", tok, t)
+	}
+	return nil
+}
+
+// name returns a name (e.g. a role, label or channel).
+func (p *parser) name() (string, error) {
+	t := p.next()
+	if t == "" || len(t) == 1 && isDelim(rune(t[0])) || t == "+&" {
+		return "", fmt.Errorf("expecting name but got %q", t)
+	}
+	return t, nil
+}
+
+// local parses a local type.
+func (p *parser) local() (Local, error) {
+	switch t := p.next(); t {
+	case "":
+		return nil, fmt.Errorf("unexpected end of type")
+	case "end":
+		return end, nil
+	case "rec":
+		v, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		r := &Rec{Var: v, used: true}
+		outer := p.vars[v]
+		p.vars[v] = r
+		body, err := p.local()
+		if err != nil {
+			return nil, err
+		}
+		p.vars[v] = outer
+		r.Body = body
+		return r, p.expect("}")
+	case "+", "&", "+&":
+		c := &Choice{Kind: Internal}
+		switch t {
+		case "&":
+			c.Kind = External
+		case "+&":
+			c.Kind = Mixed
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		for {
+			b, err := p.local()
+			if err != nil {
+				return nil, err
+			}
+			c.Branches = append(c.Branches, b)
+			switch sep := p.next(); sep {
+			case "}":
+				return c, nil
+			case ",":
+			default:
+				return nil, fmt.Errorf("expecting , or } but got %q", sep)
+			}
+		}
+	case "[":
+		ch, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return p.msg("", ch)
+	default:
+		if len(t) == 1 && isDelim(rune(t[0])) {
+			return nil, fmt.Errorf("unexpected %q", t)
+		}
+		if op := p.next(); op == "!" || op == "?" {
+			p.unread()
+			return p.msg(t, "")
+		}
+		p.unread()
+		r, ok := p.vars[t]
+		if !ok {
+			return nil, fmt.Errorf("undefined recursion variable %s", t)
+		}
+		return &Var{Name: t, rec: r}, nil
+	}
+}
+
+// msg parses a message to (or from) peer or on channel ch, after the peer.
+func (p *parser) msg(peer, ch string) (Local, error) {
+	m := &Msg{Peer: peer, Chan: ch, Cont: end}
+	switch op := p.next(); op {
+	case "!":
+		m.Send = true
+	case "?":
+	default:
+		return nil, fmt.Errorf("expecting ! or ? but got %q", op)
+	}
+	label, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	m.Label = label
+	if p.next() != ";" {
+		p.unread()
+		return m, nil
+	}
+	if m.Cont, err = p.local(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
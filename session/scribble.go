@@ -0,0 +1,219 @@
+package session
+
+// Scribble protocols.
+//
+// Scribble (http://www.scribble.org) is a language of multiparty session
+// types, where a global protocol describes the interactions between roles,
+// and a local protocol describes the behaviour of a single role, e.g.
+//
+//	global protocol Session(role main_main, role main_pong) {
+//		rec X1 {
+//			ch() from main_main to main_pong;
+//			reply() from main_pong to main_main;
+//			continue X1;
+//		}
+//	}
+//
+// Messages have no payload, and their labels are the labels of the session
+// (i.e. the name of the channel at the sender, or close). Names of roles and
+// labels are sanitised into Scribble identifiers.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// scribbleKeywords are the reserved words of Scribble.
+var scribbleKeywords = map[string]bool{
+	"module": true, "import": true, "type": true, "sig": true, "as": true,
+	"global": true, "local": true, "explicit": true, "aux": true,
+	"protocol": true, "role": true, "self": true, "instantiates": true,
+	"from": true, "to": true, "choice": true, "at": true, "or": true,
+	"rec": true, "continue": true, "par": true, "and": true, "interrupt": true,
+	"by": true, "throws": true, "catches": true, "do": true, "spawn": true,
+	"connect": true, "disconnect": true, "wrap": true, "with": true,
+}
+
+// scribbleIdent returns s as a Scribble identifier, i.e. letters, digits and
+// underscores, not starting with a digit or a keyword.
+func scribbleIdent(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	id := strings.TrimRight(b.String(), "_")
+	if id == "" || id[0] >= '0' && id[0] <= '9' || scribbleKeywords[id] {
+		id = "_" + id
+	}
+	return id
+}
+
+// scribbleWriter writes the protocols of a session in Scribble.
+type scribbleWriter struct {
+	w      *bufio.Writer
+	indent int
+	roles  map[string]string // Scribble identifiers of roles.
+	self   string            // Role of the local protocol written.
+}
+
+func (sw *scribbleWriter) line(format string, args ...interface{}) {
+	sw.w.WriteString(strings.Repeat("\t", sw.indent))
+	fmt.Fprintf(sw.w, format, args...)
+	sw.w.WriteByte('\n')
+}
+
+// WriteScribble writes the session to w as the Scribble module named module,
+// with the global protocol named protocol (if synthesisable, see Synthesise)
+// and the local protocol of each role, named protocol_role.
+//
+// Messages on channels shared by several roles (without a unique peer) cannot
+// be expressed in Scribble, and are written as comments in local protocols.
+func (s *Session) WriteScribble(w io.Writer, module, protocol string) error {
+	sw := &scribbleWriter{w: bufio.NewWriter(w), roles: make(map[string]string)}
+	used := make(map[string]bool)
+	var decls []string
+	for _, r := range s.Roles {
+		id := scribbleIdent(r.Name)
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s_%d", scribbleIdent(r.Name), n)
+		}
+		used[id] = true
+		sw.roles[r.Name] = id
+		decls = append(decls, "role "+id)
+	}
+	protocol = scribbleIdent(protocol)
+	sw.line("module %s;", scribbleIdent(module))
+
+	sw.line("")
+	if g, err := s.Synthesise(); err != nil {
+		sw.line("// No global protocol: %v", err)
+	} else {
+		sw.line("global protocol %s(%s) {", protocol, strings.Join(decls, ", "))
+		sw.indent++
+		sw.global(g)
+		sw.indent--
+		sw.line("}")
+	}
+	for _, r := range s.Roles {
+		sw.self = sw.roles[r.Name]
+		params := make([]string, len(decls))
+		copy(params, decls)
+		for i, other := range s.Roles {
+			if other == r {
+				params[i] = "self " + sw.self
+			}
+		}
+		sw.line("")
+		if r.Truncated {
+			sw.line("// Local protocol of %s is truncated.", r.Name)
+		}
+		sw.line("local protocol %s_%s(%s) {", protocol, sw.self, strings.Join(params, ", "))
+		sw.indent++
+		sw.local(r.Type)
+		sw.indent--
+		sw.line("}")
+	}
+	return sw.w.Flush()
+}
+
+// global writes the global type g.
+func (sw *scribbleWriter) global(g Global) {
+	for {
+		switch t := g.(type) {
+		case *Interaction:
+			sw.line("%s() from %s to %s;", scribbleIdent(t.Label), sw.roles[t.From], sw.roles[t.To])
+			g = t.Cont
+			continue
+		case *GChoice:
+			sw.line("choice at %s {", sw.roles[t.From])
+			for i, b := range t.Branches {
+				if i > 0 {
+					sw.line("} or {")
+				}
+				sw.indent++
+				sw.global(b)
+				sw.indent--
+			}
+			sw.line("}")
+		case *GRec:
+			sw.line("rec %s {", t.Var)
+			sw.indent++
+			sw.global(t.Body)
+			sw.indent--
+			sw.line("}")
+		case *GVar:
+			sw.line("continue %s;", t.Name)
+		}
+		return
+	}
+}
+
+// local writes the local type t.
+func (sw *scribbleWriter) local(t Local) {
+	for {
+		switch u := t.(type) {
+		case *Msg:
+			label := scribbleIdent(u.Label)
+			peer, ok := sw.roles[u.Peer]
+			switch {
+			case !ok && u.Send:
+				sw.line("// %s() to roles receiving from shared channel %s;", label, u.Chan)
+			case !ok:
+				sw.line("// %s() from roles sending to shared channel %s;", label, u.Chan)
+			case u.Send:
+				sw.line("%s() to %s;", label, peer)
+			default:
+				sw.line("%s() from %s;", label, peer)
+			}
+			t = u.Cont
+			continue
+		case *Choice:
+			at := sw.self
+			if u.Kind == External {
+				at = sw.chooser(u)
+			}
+			if u.Kind == Mixed {
+				sw.line("// Mixed choice (select on sends and receives, or with default).")
+			}
+			sw.line("choice at %s {", at)
+			for i, b := range u.Branches {
+				if i > 0 {
+					sw.line("} or {")
+				}
+				sw.indent++
+				sw.local(b)
+				sw.indent--
+			}
+			sw.line("}")
+		case *Rec:
+			sw.line("rec %s {", u.Var)
+			sw.indent++
+			sw.local(u.Body)
+			sw.indent--
+			sw.line("}")
+		case *Var:
+			sw.line("continue %s;", u.Name)
+		}
+		return
+	}
+}
+
+// chooser returns the role choosing the branch of external choice c, i.e. the
+// peer of the first message of the branches, or the role itself if unknown.
+func (sw *scribbleWriter) chooser(c *Choice) string {
+	for _, b := range c.Branches {
+		if m, ok := unfold(b).(*Msg); ok {
+			if peer, ok := sw.roles[m.Peer]; ok {
+				return peer
+			}
+		}
+	}
+	return sw.self
+}
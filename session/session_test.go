@@ -0,0 +1,230 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+func extract(t *testing.T, file string) *Session {
+	info, err := build.FromFiles(file).Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	return Extract(inferer.Env.Prog)
+}
+
+// Tests local types and global protocol of ping-pong with a looping server.
+func TestPingPong(t *testing.T) {
+	sess := extract(t, "testdata/pingpong.go")
+	main, pong := sess.Role("main.main"), sess.Role("main.pong")
+	if main == nil || pong == nil {
+		var buf bytes.Buffer
+		sess.WriteTo(&buf)
+		t.Fatalf("Roles mismatch:\nExpect:\t%v\nGot:\t%s\n", []string{"main.main", "main.pong"}, buf.String())
+	}
+	if pong.Spawner != main {
+		t.Errorf("Spawner of main.pong mismatch:\nExpect:\t%v\nGot:\t%v\n", main, pong.Spawner)
+	}
+	var sends, recvs int
+	walk(main.Type, func(m *Msg) {
+		if m.Peer != "main.pong" {
+			t.Errorf("Peer of message %s mismatch:\nExpect:\t%s\nGot:\t%s\n", m.Label, "main.pong", m.Peer)
+		}
+		if m.Send {
+			sends++
+		} else {
+			recvs++
+		}
+	})
+	if sends == 0 || recvs == 0 {
+		t.Errorf("Expecting sends and receives in main.main: %s", main.Type)
+	}
+	g, err := sess.Synthesise()
+	if err != nil {
+		t.Fatalf("Synthesis failed: %v", err)
+	}
+	if s := g.String(); !strings.Contains(s, "main.main -> main.pong") || !strings.Contains(s, "main.pong -> main.main") {
+		t.Errorf("Expecting interactions in both directions in global protocol: %s", s)
+	}
+}
+
+// Tests synthesis fails for a channel shared by several receivers.
+func TestShared(t *testing.T) {
+	sess := &Session{}
+	a := &Role{Name: "a", Type: &Msg{Send: true, Chan: "c", Label: "c", Cont: end}}
+	b := &Role{Name: "b", Type: &Msg{Chan: "c", Label: "c", Cont: end}}
+	c := &Role{Name: "c", Type: &Msg{Chan: "c", Label: "c", Cont: end}}
+	sess.Roles = []*Role{a, b, c}
+	sess.resolvePeers()
+	if _, err := sess.Synthesise(); err == nil {
+		t.Errorf("Expecting error for channel with two receivers")
+	}
+	sess.Roles = []*Role{a, b}
+	sess.resolvePeers()
+	g, err := sess.Synthesise()
+	if err != nil {
+		t.Fatalf("Synthesis failed: %v", err)
+	}
+	if expect := "a -> b: c"; g.String() != expect {
+		t.Errorf("Global protocol mismatch:\nExpect:\t%s\nGot:\t%s\n", expect, g)
+	}
+}
+
+// Tests senders and receivers of channels.
+func TestEndpoints(t *testing.T) {
+	sess := &Session{Roles: []*Role{
+		{Name: "a", Type: &Msg{Send: true, Chan: "c", Label: "c", Cont: &Msg{Chan: "d", Label: "d", Cont: end}}},
+		{Name: "b", Type: &Msg{Chan: "c", Label: "c", Cont: &Msg{Send: true, Chan: "d", Label: "d", Cont: end}}},
+		{Name: "c", Type: &Msg{Send: true, Chan: "c", Label: "c", Cont: end}},
+	}}
+	senders, receivers := sess.Endpoints("c")
+	if expect := "[a c] [b]"; fmt.Sprint(senders, " ", receivers) != expect {
+		t.Errorf("Endpoints of c mismatch:\nExpect:\t%s\nGot:\t%v %v\n", expect, senders, receivers)
+	}
+	senders, receivers = sess.Endpoints("d")
+	if expect := "[b] [a]"; fmt.Sprint(senders, " ", receivers) != expect {
+		t.Errorf("Endpoints of d mismatch:\nExpect:\t%s\nGot:\t%v %v\n", expect, senders, receivers)
+	}
+}
+
+// Tests inferred local types conform to themselves after printing and
+// parsing.
+func TestConformSelf(t *testing.T) {
+	sess := extract(t, "testdata/pingpong.go")
+	var buf bytes.Buffer
+	if _, err := sess.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := ParseSpec(&buf)
+	if err != nil {
+		t.Fatalf("Cannot parse local types: %v", err)
+	}
+	if len(spec.Roles) != len(sess.Roles) {
+		t.Errorf("Roles mismatch:\nExpect:\t%d\nGot:\t%d\n", len(sess.Roles), len(spec.Roles))
+	}
+	if devs := sess.Conform(spec, nil, nil); len(devs) > 0 {
+		t.Errorf("Expecting no deviation but got: %v", devs)
+	}
+}
+
+// Tests deviations from specifications, restricted to some messages.
+func TestConform(t *testing.T) {
+	sess := &Session{Roles: []*Role{
+		{Name: "a", Def: "a", Type: &Msg{Send: true, Chan: "c1", Label: "req", Cont: &Msg{Chan: "c2", Label: "resp", Cont: end}}},
+		{Name: "b", Def: "b", Type: &Msg{Chan: "c1", Label: "req", Cont: &Msg{Send: true, Chan: "c2", Label: "resp", Cont: end}}},
+	}}
+	sess.resolvePeers()
+	tests := []struct {
+		spec    string
+		deviate bool
+	}{
+		{"a: b!req; b?resp", false},
+		{"a: b!req", false}, // resp not specified.
+		{"a: rec X {+{b!req; b?resp; X, end}}", false},
+		{"a: b?req", true},
+		{"a: c!req; b?resp", true},
+		{"b: a?req; a!resp; a?req", true},
+		{"c: end", true},
+	}
+	for _, test := range tests {
+		spec, err := ParseSpec(strings.NewReader(test.spec))
+		if err != nil {
+			t.Errorf("Cannot parse %q: %v", test.spec, err)
+			continue
+		}
+		devs := sess.Conform(spec, map[string]string{"a": "a.go:1:1"}, map[string]string{"c1": "a.go:2:2"})
+		if deviate := len(devs) > 0; deviate != test.deviate {
+			t.Errorf("Deviation of %q mismatch:\nExpect:\t%v\nGot:\t%v\n", test.spec, test.deviate, devs)
+		}
+	}
+	for _, bad := range []string{"a b!req", "a: b!", "a: X", "a: +{b!req", "a: end\na: end"} {
+		if _, err := ParseSpec(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expecting parse error for %q", bad)
+		}
+	}
+}
+
+// Tests choreography of ping-pong: ping from main.main in the first phase,
+// reply from main.pong in the second.
+func TestChoreography(t *testing.T) {
+	c := extract(t, "testdata/pingpong.go").Choreography()
+	if len(c.Spawns) != 1 || c.Spawns[0] != (ChoreoSpawn{Spawner: "main.main", Role: "main.pong"}) {
+		t.Errorf("Spawns mismatch:\nExpect:\t%v\nGot:\t%v\n", []ChoreoSpawn{{"main.main", "main.pong"}}, c.Spawns)
+	}
+	var got []string
+	for _, e := range c.Edges {
+		got = append(got, fmt.Sprintf("%d: %s -> %s", e.Phase, e.From, e.To))
+	}
+	expect := []string{"0: main.main -> main.pong", "1: main.pong -> main.main"}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("Edges mismatch:\nExpect:\t%v\nGot:\t%v\n", expect, got)
+	}
+	if c.Phases() != 2 {
+		t.Errorf("Phases mismatch:\nExpect:\t%d\nGot:\t%d\n", 2, c.Phases())
+	}
+	var buf bytes.Buffer
+	if err := c.WriteDot(&buf); err != nil {
+		t.Fatalf("Cannot write dot: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"main.main" -> "main.pong" [label=`) {
+		t.Errorf("Expecting edge main.main -> main.pong in dot: %s", buf.String())
+	}
+	buf.Reset()
+	if err := c.WriteHTML(&buf); err != nil {
+		t.Fatalf("Cannot write HTML: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"from":"main.pong","to":"main.main"`) {
+		t.Errorf("Expecting edge main.pong -> main.main in HTML: %s", buf.String())
+	}
+}
+
+// Tests Scribble protocols of a request with a choice of responses.
+func TestScribble(t *testing.T) {
+	sess := &Session{Roles: []*Role{
+		{Name: "main.main", Type: &Msg{Send: true, Chan: "c1", Label: "req", Cont: &Choice{Kind: External, Branches: []Local{
+			&Msg{Chan: "c2", Label: "ok", Cont: end},
+			&Msg{Chan: "c3", Label: "err", Cont: end},
+		}}}},
+		{Name: "main.main$1", Type: &Msg{Chan: "c1", Label: "req", Cont: &Choice{Kind: Internal, Branches: []Local{
+			&Msg{Send: true, Chan: "c2", Label: "ok", Cont: end},
+			&Msg{Send: true, Chan: "c3", Label: "err", Cont: end},
+		}}}},
+	}}
+	sess.resolvePeers()
+	var buf bytes.Buffer
+	if err := sess.WriteScribble(&buf, "pingpong", "Session"); err != nil {
+		t.Fatalf("Cannot write Scribble: %v", err)
+	}
+	for _, expect := range []string{
+		"module pingpong;",
+		"global protocol Session(role main_main, role main_main_1) {",
+		"\treq() from main_main to main_main_1;\n\tchoice at main_main_1 {\n\t\tok() from main_main_1 to main_main;\n\t} or {\n\t\terr() from main_main_1 to main_main;\n\t}",
+		"local protocol Session_main_main(self main_main, role main_main_1) {\n\treq() to main_main_1;\n\tchoice at main_main_1 {\n\t\tok() from main_main_1;",
+		"local protocol Session_main_main_1(role main_main, self main_main_1) {",
+	} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Scribble mismatch:\nExpect:\t%s\nGot:\t%s\n", expect, buf.String())
+		}
+	}
+}
+
+// Tests Scribble identifiers of role and label names.
+func TestScribbleIdent(t *testing.T) {
+	for s, expect := range map[string]string{
+		"main.main":      "main_main",
+		"main.main$1[2]": "main_main_1_2",
+		"choice":         "_choice",
+		"0":              "_0",
+	} {
+		if got := scribbleIdent(s); got != expect {
+			t.Errorf("Identifier of %q mismatch:\nExpect:\t%s\nGot:\t%s\n", s, expect, got)
+		}
+	}
+}
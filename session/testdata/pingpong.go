@@ -0,0 +1,17 @@
+package main
+
+func pong(ping, reply chan int) {
+	for {
+		x := <-ping
+		reply <- x
+	}
+}
+
+func main() {
+	ping, reply := make(chan int), make(chan int)
+	go pong(ping, reply)
+	ping <- 1
+	<-reply
+	ping <- 2
+	<-reply
+}
@@ -0,0 +1,199 @@
+// Package sqlite exports the results of the analysis to a SQLite database, for
+// querying in SQL, e.g. the channels crossing package boundaries:
+//
+//	SELECT DISTINCT c.name, c.pkg, m.pkg
+//	FROM channels c JOIN communications m ON m.chan = c.name
+//	WHERE m.pkg <> c.pkg;
+//
+// The database is written as a SQL script (see Write), which is loaded with
+// the sqlite3 command (see Create), or exported as is to be loaded later,
+// e.g. with sqlite3 gospal.db < gospal.sql. The schema is
+//
+//	-- Channels, by unique name.
+//	channels(name, pos, creator, pkg)
+//	-- Goroutines spawned: function, its package, spawning function, spawn site.
+//	goroutines(id, func, pkg, spawner, pos)
+//	-- Operations on channels: op is send, recv or close.
+//	communications(id, chan, op, func, pkg, pos)
+//	-- MiGo definitions with their source metadata (params comma-separated).
+//	definitions(id, name, func, pos, params, spawn, cond, cond_pos, migo)
+//	-- Diagnostics of the checks, and their related locations.
+//	diagnostics(id, rule, severity, message, file, line, col)
+//	related(diagnostic, message, file, line, col)
+//
+// Positions are file:line:column strings, except in diagnostics.
+package sqlite
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/migoinfer"
+)
+
+// Schema is the SQL schema of the database.
+const Schema = `CREATE TABLE channels (
+  name TEXT PRIMARY KEY, -- Unique name of the channel.
+  pos TEXT,              -- Creation site.
+  creator TEXT,          -- Function creating the channel.
+  pkg TEXT               -- Package of the creator.
+);
+CREATE TABLE goroutines (
+  id INTEGER PRIMARY KEY,
+  func TEXT,             -- Function run by the goroutine.
+  pkg TEXT,              -- Package of the function.
+  spawner TEXT,          -- Function spawning the goroutine.
+  pos TEXT               -- Spawn site.
+);
+CREATE TABLE communications (
+  id INTEGER PRIMARY KEY,
+  chan TEXT REFERENCES channels(name),
+  op TEXT,               -- send, recv or close.
+  func TEXT,             -- Function of the operation.
+  pkg TEXT,              -- Package of the function.
+  pos TEXT               -- Position of the operation.
+);
+CREATE TABLE definitions (
+  id INTEGER PRIMARY KEY,
+  name TEXT,             -- MiGo definition, e.g. main.main#2.
+  func TEXT,             -- Go function of the definition.
+  pos TEXT,              -- Position of the Go function.
+  params TEXT,           -- Comma-separated parameters.
+  spawn TEXT,            -- Spawn site, if spawned as a goroutine.
+  cond TEXT,             -- Branch condition, if a branch.
+  cond_pos TEXT,         -- Position of the branch condition.
+  migo TEXT              -- MiGo of the definition.
+);
+CREATE TABLE diagnostics (
+  id INTEGER PRIMARY KEY,
+  rule TEXT,             -- Rule identifier, e.g. goroutine-leak.
+  severity TEXT,         -- error, warning or note.
+  message TEXT,
+  file TEXT,
+  line INTEGER,
+  col INTEGER
+);
+CREATE TABLE related (
+  diagnostic INTEGER REFERENCES diagnostics(id),
+  message TEXT,
+  file TEXT,
+  line INTEGER,
+  col INTEGER
+);
+CREATE INDEX communications_chan ON communications(chan);
+`
+
+// tables are the tables of the schema, dropped before creating the schema.
+var tables = []string{"channels", "goroutines", "communications", "definitions", "diagnostics", "related"}
+
+// quote returns s as a SQL string literal.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// insert writes an insert statement of values into table.
+func insert(w io.Writer, table string, values ...interface{}) {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			fields[i] = quote(v)
+		default:
+			fields[i] = fmt.Sprint(v)
+		}
+	}
+	fmt.Fprintf(w, "INSERT INTO %s VALUES (%s);\n", table, strings.Join(fields, ", "))
+}
+
+// severity returns the severity of d, or the default severity of its rule.
+func severity(d diag.Diagnostic) diag.Severity {
+	switch {
+	case d.Severity != "":
+		return d.Severity
+	case d.Rule.Severity != "":
+		return d.Rule.Severity
+	}
+	return diag.Warning
+}
+
+// Write writes the results of the analysis of inferer, and the diagnostics
+// diags, to w as a SQL script which (re)creates the tables of the schema.
+func Write(w io.Writer, inferer *migoinfer.Inferer, diags []diag.Diagnostic) error {
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("BEGIN TRANSACTION;\n")
+	for _, t := range tables {
+		fmt.Fprintf(bufw, "DROP TABLE IF EXISTS %s;\n", t)
+	}
+	bufw.WriteString(Schema)
+
+	topo := inferer.Topology()
+	for _, c := range topo.Chans {
+		insert(bufw, "channels", c.Name, c.Pos, c.Creator, c.Pkg)
+	}
+	for i, s := range topo.Spawns {
+		insert(bufw, "goroutines", i+1, s.Spawned, s.Pkg, s.Spawner, s.Pos)
+	}
+	id := 0
+	for _, c := range topo.Chans {
+		for _, e := range c.Senders {
+			id++
+			insert(bufw, "communications", id, c.Name, "send", e.Func, e.Pkg, e.Pos)
+		}
+		for _, e := range c.Receivers {
+			id++
+			insert(bufw, "communications", id, c.Name, "recv", e.Func, e.Pkg, e.Pos)
+		}
+		for _, e := range c.Closers {
+			id++
+			insert(bufw, "communications", id, c.Name, "close", e.Func, e.Pkg, e.Pos)
+		}
+	}
+	for i, d := range inferer.Definitions() {
+		insert(bufw, "definitions", i+1, d.Name, d.Func, d.Pos, strings.Join(d.Params, ","), d.Spawn, d.Cond, d.CondPos, d.MiGo)
+	}
+	for i, d := range diags {
+		insert(bufw, "diagnostics", i+1, d.Rule.ID, string(severity(d)), d.Message, d.Pos.Filename, d.Pos.Line, d.Pos.Column)
+		for _, r := range d.Related {
+			insert(bufw, "related", i+1, r.Message, r.Pos.Filename, r.Pos.Line, r.Pos.Column)
+		}
+	}
+	bufw.WriteString("COMMIT;\n")
+	return bufw.Flush()
+}
+
+// Command is the sqlite3 command which Create loads the script with.
+var Command = "sqlite3"
+
+// CheckCommand returns an error if Command is not found, e.g. to check before
+// the analysis that Create can write the database.
+func CheckCommand() error {
+	if _, err := exec.LookPath(Command); err != nil {
+		return fmt.Errorf("%v (install sqlite3, or write the SQL script to a .sql file instead)", err)
+	}
+	return nil
+}
+
+// Create writes the results of the analysis of inferer, and the diagnostics
+// diags, to the SQLite database file path with the sqlite3 command. The
+// tables of the schema are replaced if they exist.
+func Create(path string, inferer *migoinfer.Inferer, diags []diag.Diagnostic) error {
+	if err := CheckCommand(); err != nil {
+		return err
+	}
+	var script, stderr bytes.Buffer
+	if err := Write(&script, inferer, diags); err != nil {
+		return err
+	}
+	cmd := exec.Command(Command, "-bail", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &script, os.Stderr, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
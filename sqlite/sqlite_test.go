@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests quoting of SQL strings.
+func TestQuote(t *testing.T) {
+	if expect, got := `'it''s'`, quote("it's"); expect != got {
+		t.Errorf("Quoted string mismatch:\nExpect:\t%s\nGot:\t%s\n", expect, got)
+	}
+}
+
+// Tests the script of the results of a program with a goroutine sending to
+// main.
+func TestWrite(t *testing.T) {
+	info, err := build.FromFiles("../migoinfer/testdata/verify/main.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	var buf bytes.Buffer
+	if err := Write(&buf, inferer, inferer.LeakDiagnostics()); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+	for _, expect := range []string{
+		"CREATE TABLE channels",
+		"INSERT INTO channels VALUES (",
+		"INSERT INTO goroutines VALUES (1, 'main.main$1', 'main', 'main.main', ",
+		"'send', 'main.main$1', 'main', ",
+		"'recv', 'main.main', 'main', ",
+		"INSERT INTO definitions VALUES (",
+		"COMMIT;",
+	} {
+		if !strings.Contains(script, expect) {
+			t.Errorf("Expecting %q in script:\n%s", expect, script)
+		}
+	}
+}
+
+// Tests that Create loads the script with Command, and fails if Command is
+// not found.
+func TestCreate(t *testing.T) {
+	defer func(command string) { Command = command }(Command)
+	dir, err := ioutil.TempDir("", "gospal-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Command = filepath.Join(dir, "no-sqlite3")
+	if err := CheckCommand(); err == nil {
+		t.Errorf("Expecting %s not found", Command)
+	}
+	if err := Create(filepath.Join(dir, "gospal.db"), nil, nil); err == nil {
+		t.Errorf("Expecting %s not found when creating database", Command)
+	}
+
+	// Fake sqlite3 which writes the script to the database file.
+	Command = filepath.Join(dir, "sqlite3")
+	if err := ioutil.WriteFile(Command, []byte("#!/bin/sh\ncat > \"$2\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	info, err := build.FromFiles("../migoinfer/testdata/verify/main.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	db := filepath.Join(dir, "gospal.db")
+	if err := Create(db, inferer, nil); err != nil {
+		t.Fatal(err)
+	}
+	var script bytes.Buffer
+	if err := Write(&script, inferer, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(db); err != nil || string(b) != script.String() {
+		t.Errorf("Script loaded by %s mismatch:\nExpect:\n%s\nGot:\n%s\n", Command, script.String(), b)
+	}
+}
@@ -0,0 +1,180 @@
+// Package srcmap provides source maps, which link the elements of the models
+// inferred from a program (e.g. MiGo definitions and channel operations) to
+// spans of the Go source, and resolve them in both directions.
+//
+// The elements are identified by strings stable across output formats:
+//
+//	main.main#2               MiGo definition (kind def)
+//	main.main#2/spawn         spawn site of the goroutine of a definition (kind spawn)
+//	main.main#2/cond          branch condition of a definition (kind cond)
+//	main.main#2/send/0        n-th send (recv, close) of a definition, in source order
+//	chan:main.main.t0_chan0   creation site of a channel (kind chan)
+//
+// A source map is written as JSON, e.g.
+//
+//	{"version":1,"elements":[{"id":"main.main","kind":"def",
+//	  "span":{"file":"main.go","line":13,"col":1,"endLine":17,"endCol":2}}]}
+package srcmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"sort"
+)
+
+// Version is the version of the format of source maps.
+const Version = 1
+
+// Span is a span of source. The end is zero if the span is a point.
+type Span struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	EndLine int    `json:"endLine,omitempty"`
+	EndCol  int    `json:"endCol,omitempty"`
+}
+
+// MakeSpan returns the span from start to end (or the point start if end is
+// invalid).
+func MakeSpan(start, end token.Position) Span {
+	s := Span{File: start.Filename, Line: start.Line, Col: start.Column}
+	if end.IsValid() && end.Filename == start.Filename {
+		s.EndLine, s.EndCol = end.Line, end.Column
+	}
+	return s
+}
+
+func (s Span) String() string {
+	if s.EndLine == 0 {
+		return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d-%d:%d", s.File, s.Line, s.Col, s.EndLine, s.EndCol)
+}
+
+// end returns the end of s, i.e. the start if s is a point.
+func (s Span) end() (int, int) {
+	if s.EndLine == 0 {
+		return s.Line, s.Col
+	}
+	return s.EndLine, s.EndCol
+}
+
+// Contains returns true if position line:col of file is in s. A point
+// contains the positions of its line from its column.
+func (s Span) Contains(file string, line, col int) bool {
+	if file != s.File || line < s.Line || line == s.Line && col < s.Col {
+		return false
+	}
+	if s.EndLine == 0 {
+		return line == s.Line
+	}
+	endLine, endCol := s.end()
+	return line < endLine || line == endLine && col <= endCol
+}
+
+// size returns a measure of the size of s, to order nested spans.
+func (s Span) size() int {
+	endLine, endCol := s.end()
+	return (endLine-s.Line)*1000 + endCol - s.Col
+}
+
+// Element is an element of a model mapped to the source.
+type Element struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Span Span   `json:"span"`
+}
+
+// Map is a source map.
+type Map struct {
+	Version  int       `json:"version"`
+	Elements []Element `json:"elements"`
+
+	byID map[string]int
+}
+
+// New returns an empty source map.
+func New() *Map {
+	return &Map{Version: Version, Elements: []Element{}, byID: make(map[string]int)}
+}
+
+// Add maps the element id of kind to span, and replaces an existing mapping
+// of id.
+func (m *Map) Add(id, kind string, span Span) {
+	if span.File == "" {
+		return // No source.
+	}
+	if i, ok := m.byID[id]; ok {
+		m.Elements[i] = Element{ID: id, Kind: kind, Span: span}
+		return
+	}
+	m.byID[id] = len(m.Elements)
+	m.Elements = append(m.Elements, Element{ID: id, Kind: kind, Span: span})
+}
+
+// Lookup returns the span of the element id.
+func (m *Map) Lookup(id string) (Span, bool) {
+	if i, ok := m.byID[id]; ok {
+		return m.Elements[i].Span, true
+	}
+	return Span{}, false
+}
+
+// At returns the elements whose span contains position line:col of file,
+// innermost first.
+func (m *Map) At(file string, line, col int) []Element {
+	var elems []Element
+	for _, e := range m.Elements {
+		if e.Span.Contains(file, line, col) {
+			elems = append(elems, e)
+		}
+	}
+	sort.SliceStable(elems, func(i, j int) bool { return elems[i].Span.size() < elems[j].Span.size() })
+	return elems
+}
+
+// Sort sorts the elements by position, then identifier.
+func (m *Map) Sort() {
+	sort.SliceStable(m.Elements, func(i, j int) bool {
+		a, b := m.Elements[i].Span, m.Elements[j].Span
+		switch {
+		case a.File != b.File:
+			return a.File < b.File
+		case a.Line != b.Line:
+			return a.Line < b.Line
+		case a.Col != b.Col:
+			return a.Col < b.Col
+		}
+		return m.Elements[i].ID < m.Elements[j].ID
+	})
+	for i, e := range m.Elements {
+		m.byID[e.ID] = i
+	}
+}
+
+// WriteTo writes m to w in JSON.
+func (m *Map) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// Read reads a source map in JSON from r.
+func Read(r io.Reader) (*Map, error) {
+	m := New()
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported source map version %d", m.Version)
+	}
+	for i, e := range m.Elements {
+		m.byID[e.ID] = i
+	}
+	return m, nil
+}
@@ -0,0 +1,46 @@
+package srcmap
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Tests lookup of elements by identifier and by position, innermost first.
+func TestLookup(t *testing.T) {
+	m := New()
+	m.Add("main.main", "def", Span{File: "main.go", Line: 13, Col: 1, EndLine: 17, EndCol: 2})
+	m.Add("main.main#1", "def", Span{File: "main.go", Line: 14, Col: 2, EndLine: 15, EndCol: 40})
+	m.Add("main.main#1/send/0", "send", Span{File: "main.go", Line: 15, Col: 17})
+	m.Add("none", "def", Span{})
+
+	if span, ok := m.Lookup("main.main#1"); !ok || span.String() != "main.go:14:2-15:40" {
+		t.Errorf("Span mismatch:\nExpect:\t%s\nGot:\t%s\n", "main.go:14:2-15:40", span)
+	}
+	if _, ok := m.Lookup("none"); ok {
+		t.Errorf("Expecting element without source not mapped")
+	}
+	elems := m.At("main.go", 15, 20)
+	if len(elems) != 3 || elems[0].ID != "main.main#1/send/0" || elems[2].ID != "main.main" {
+		t.Errorf("Elements at position mismatch:\nExpect:\t%s\nGot:\t%v\n", "send, block, function", elems)
+	}
+	if elems := m.At("main.go", 16, 1); len(elems) != 1 || elems[0].ID != "main.main" {
+		t.Errorf("Elements at position mismatch:\nExpect:\t%s\nGot:\t%v\n", "function", elems)
+	}
+}
+
+// Tests that a written source map is read back.
+func TestReadWrite(t *testing.T) {
+	m := New()
+	m.Add("chan:main.main.t0_chan0", "chan", Span{File: "main.go", Line: 14, Col: 8})
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span, ok := read.Lookup("chan:main.main.t0_chan0"); !ok || span.Line != 14 {
+		t.Errorf("Span mismatch:\nExpect:\t%s\nGot:\t%s\n", "main.go:14:8", span)
+	}
+}
@@ -11,6 +11,12 @@
 // command line arguments), and the builder tool considers all of the files part
 // of the same package (i.e. in the same directory).
 //
+// Build from package patterns
+//
+// A number of package patterns in the format of the go command (e.g. ./...,
+// ./cmd/... or import paths) are supplied, and all matched packages (and
+// optionally their tests) are loaded in the same program.
+//
 // Build from a Reader
 //
 // This is mostly used for testing or demo, where the input source code is read
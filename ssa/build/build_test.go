@@ -52,6 +52,27 @@ func TestBuildFromFiles(t *testing.T) {
 	}
 }
 
+// Test loading from package patterns.
+func TestBuildFromPackages(t *testing.T) {
+	if !build.IsPackagePattern("./testdata") || build.IsPackagePattern("testdata/main.go") {
+		t.Errorf("Expects ./testdata to be a package pattern and testdata/main.go not")
+	}
+	conf := build.FromPackages("./testdata")
+	info, err := conf.Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	mains, err := ssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		t.Errorf("cannot find main package: %v", err)
+	}
+	for _, main := range mains {
+		if main.Func("main") == nil || main.Func("foo") == nil || main.Func("bar") == nil {
+			t.Errorf("cannot find main.main(), main.foo() and main.bar()")
+		}
+	}
+}
+
 // Test loading from string/reader.
 func TestBuildFromReader(t *testing.T) {
 	conf := build.FromReader(strings.NewReader(helloProg))
@@ -68,3 +68,38 @@ func FromReader(r io.Reader) Configurer {
 func (s *CachedSrc) NewReader() io.Reader {
 	return bytes.NewReader(s.cached)
 }
+
+// OverlaySrc is a set of filenames, where the content of some of the files
+// are given in memory (e.g. unsaved files of an editor).
+type OverlaySrc struct {
+	Files   []string
+	Overlay map[string][]byte // File content, by filename.
+}
+
+// FromOverlay returns a non-nil Builder from a slice of filenames, reading
+// the content of the files in overlay from memory instead of from disk.
+func FromOverlay(files []string, overlay map[string][]byte) Configurer {
+	return newConfig(&OverlaySrc{Files: files, Overlay: overlay})
+}
+
+// Content returns the content of file[i], or nil if the file is not in the
+// overlay.
+func (s *OverlaySrc) Content(i int) []byte {
+	if i < len(s.Files) {
+		return s.Overlay[s.Files[i]]
+	}
+	return nil
+}
+
+// NewReader returns an io.Reader for reading all files.
+func (s *OverlaySrc) NewReader() io.Reader {
+	var rds []io.Reader
+	for i := range s.Files {
+		if b := s.Content(i); b != nil {
+			rds = append(rds, bytes.NewReader(b))
+		} else {
+			rds = append(rds, (&FileSrc{Files: s.Files[i : i+1]}).Reader(0))
+		}
+	}
+	return io.MultiReader(rds...)
+}
@@ -2,13 +2,17 @@ package build
 
 import (
 	"fmt"
+	"go/ast"
 	"go/build"
+	"go/parser"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 
+	"github.com/nickng/gospal/metrics"
 	"github.com/nickng/gospal/ssa"
+	"github.com/nickng/gospal/tracing"
 	"golang.org/x/tools/go/loader"
 	gossa "golang.org/x/tools/go/ssa"
 	"golang.org/x/tools/go/ssa/ssautil"
@@ -25,6 +29,8 @@ type Configurer interface {
 	AddBadPkg(pkg, reason string) Configurer
 	WithBuildLog(l io.Writer, flags int) Configurer
 	WithPtaLog(l io.Writer, flags int) Configurer
+	WithTests(tests bool) Configurer
+	WithBuildTags(tags ...string) Configurer
 }
 
 // Config represents a build configuration.
@@ -35,6 +41,8 @@ type Config struct {
 	bldLFlags int       // Build log flags.
 	ptaLog    io.Writer // Pointer analysis log.
 	ptaLFlags int       // Pointer analysis log flags.
+	tests     bool      // Load test files of the packages.
+	tags      []string  // Additional build tags.
 
 	src srcReader // src points to the program source.
 }
@@ -65,6 +73,20 @@ func (c *Config) WithPtaLog(l io.Writer, flags int) Configurer {
 	return c
 }
 
+// WithTests loads the test files of the packages (of package patterns) with
+// the packages, so their test main packages can be analysed.
+func (c *Config) WithTests(tests bool) Configurer {
+	c.tests = tests
+	return c
+}
+
+// WithBuildTags adds build tags to satisfy when selecting the files of the
+// packages.
+func (c *Config) WithBuildTags(tags ...string) Configurer {
+	c.tags = append(c.tags, tags...)
+	return c
+}
+
 // AddBadPkg marks a package 'bad' to avoid loading.
 func (c *Config) AddBadPkg(pkg, reason string) Configurer {
 	//c := b.(*Config)
@@ -73,7 +95,12 @@ func (c *Config) AddBadPkg(pkg, reason string) Configurer {
 }
 
 func (c *Config) Build() (*ssa.Info, error) {
-	var lconf = loader.Config{Build: &build.Default}
+	defer metrics.Build.Start()()
+	span := tracing.Start(nil, "build")
+	defer span.End()
+	ctxt := build.Default
+	ctxt.BuildTags = append(ctxt.BuildTags[:len(ctxt.BuildTags):len(ctxt.BuildTags)], c.tags...)
+	var lconf = loader.Config{Build: &ctxt, ParserMode: parser.ParseComments} // Comments for directives.
 	bldLog := log.New(c.bldLog, "ssabuild: ", c.bldLFlags)
 
 	switch src := c.src.(type) {
@@ -85,6 +112,33 @@ func (c *Config) Build() (*ssa.Info, error) {
 		if len(args) > 0 {
 			return nil, fmt.Errorf("surplus arguments: %q", args)
 		}
+	case *PkgSrc:
+		pkgs, err := src.Packages(c.tags...)
+		if err != nil {
+			return nil, err
+		}
+		lconf.Cwd = src.Dir
+		for _, pkg := range pkgs {
+			if c.tests {
+				lconf.ImportWithTests(pkg)
+			} else {
+				lconf.Import(pkg)
+			}
+		}
+	case *OverlaySrc:
+		var parsed []*ast.File
+		for i, file := range src.Files {
+			var content interface{} // Read from disk if not in overlay.
+			if b := src.Content(i); b != nil {
+				content = b
+			}
+			f, err := lconf.ParseFile(file, content)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, f)
+		}
+		lconf.CreateFromFiles("", parsed...)
 	default:
 		os.Chdir(os.TempDir())
 		parsed, err := lconf.ParseFile("tmp", src.NewReader())
@@ -95,33 +149,46 @@ func (c *Config) Build() (*ssa.Info, error) {
 	}
 
 	// Load, parse and type-check program
+	load := tracing.Start(span, "load")
 	lprog, err := lconf.Load()
+	load.End()
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttrs(tracing.Int("packages", len(lprog.AllPackages)))
 	bldLog.Print("Program loaded and type checked")
 
 	prog := ssautil.CreateProgram(lprog, gossa.GlobalDebug|gossa.BareInits)
 
 	var ignoredPkgs []string
 	if len(c.badPkgs) == 0 {
+		bld := tracing.Start(span, "build ssa")
 		prog.Build()
+		bld.End()
 	} else {
 		for _, info := range lprog.AllPackages {
 			if reason, badPkg := c.badPkgs[info.Pkg.Path()]; badPkg {
 				bldLog.Printf("Skip package: %s (%s)", info.Pkg.Name(), reason)
 				ignoredPkgs = append(ignoredPkgs, info.Pkg.Name())
 			} else {
+				bld := tracing.Start(span, "build package", tracing.String("package", info.Pkg.Path()))
 				prog.Package(info.Pkg).Build()
+				bld.End()
 			}
 		}
 	}
 
+	directives := ssa.ParseDirectives(lprog)
+	for _, dir := range directives.Unknown {
+		bldLog.Printf("Unknown directive %s%s at %s", ssa.DirectivePrefix, dir.Name, lprog.Fset.Position(dir.Pos))
+	}
+
 	return &ssa.Info{
 		IgnoredPkgs: ignoredPkgs,
 		FSet:        lprog.Fset,
 		Prog:        prog,
 		LProg:       lprog,
+		Directives:  directives,
 		BldLog:      c.bldLog,
 		PtaLog:      c.ptaLog,
 	}, nil
@@ -0,0 +1,59 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// PkgSrc is a set of package patterns in the format of the go command, e.g.
+// ./..., ./cmd/... or import paths.
+type PkgSrc struct {
+	Patterns []string
+	Dir      string // Directory of the patterns, or current directory if empty.
+}
+
+// FromPackages returns a non-nil Builder from a slice of package patterns.
+// All packages matched by the patterns are loaded in the same program.
+func FromPackages(patterns ...string) Configurer {
+	return newConfig(&PkgSrc{Patterns: patterns})
+}
+
+// FromPackagesIn returns a non-nil Builder from a slice of package patterns
+// relative to directory dir, e.g. the root of a module.
+func FromPackagesIn(dir string, patterns ...string) Configurer {
+	return newConfig(&PkgSrc{Patterns: patterns, Dir: dir})
+}
+
+// IsPackagePattern returns true if arg is a package pattern (or import path)
+// instead of a filename.
+func IsPackagePattern(arg string) bool {
+	return !strings.HasSuffix(arg, ".go")
+}
+
+// Packages returns the import paths of the packages matched by the patterns
+// with build tags, as listed by the go command.
+func (s *PkgSrc) Packages(tags ...string) ([]string, error) {
+	var out, stderr bytes.Buffer
+	args := []string{"list", "-f", "{{.ImportPath}}"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, " "))
+	}
+	cmd := exec.Command("go", append(append(args, "--"), s.Patterns...)...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = s.Dir, &out, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cannot list packages %s: %v: %s", strings.Join(s.Patterns, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	pkgs := strings.Fields(out.String())
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages match %s", strings.Join(s.Patterns, " "))
+	}
+	return pkgs, nil
+}
+
+// NewReader returns an empty reader, the packages are read by the loader.
+func (s *PkgSrc) NewReader() io.Reader {
+	return bytes.NewReader(nil)
+}
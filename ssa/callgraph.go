@@ -24,6 +24,11 @@ type CallGraph struct {
 	allFns  []*ssa.Function  // Functions in the current Program (including unused).
 }
 
+// Graph returns the underlying callgraph.
+func (g *CallGraph) Graph() *callgraph.Graph {
+	return g.cg
+}
+
 // AllFunctions return all ssa.Functions defined in the current Program.
 func (g *CallGraph) AllFunctions() ([]*ssa.Function, error) {
 	// If cached.
@@ -97,6 +102,61 @@ func (g *CallGraph) UsedFunctions() ([]*ssa.Function, error) {
 	return g.usedFns, nil
 }
 
+// SCCs returns the strongly connected components of the callgraph, in
+// reverse topological order (i.e. callees before callers).
+//
+// Functions in the same component are mutually recursive. A component with a
+// single function is recursive only if the function calls itself.
+func (g *CallGraph) SCCs() [][]*ssa.Function {
+	var (
+		index   = make(map[*callgraph.Node]int)
+		lowlink = make(map[*callgraph.Node]int)
+		onStack = make(map[*callgraph.Node]bool)
+		stack   []*callgraph.Node
+		sccs    [][]*ssa.Function
+	)
+	var visit func(n *callgraph.Node)
+	visit = func(n *callgraph.Node) {
+		index[n] = len(index)
+		lowlink[n] = index[n]
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, e := range n.Out {
+			if _, ok := index[e.Callee]; !ok {
+				visit(e.Callee)
+				if lowlink[e.Callee] < lowlink[n] {
+					lowlink[n] = lowlink[e.Callee]
+				}
+			} else if onStack[e.Callee] && index[e.Callee] < lowlink[n] {
+				lowlink[n] = index[e.Callee]
+			}
+		}
+		if lowlink[n] == index[n] {
+			var scc []*ssa.Function
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				if top.Func != nil {
+					scc = append(scc, top.Func)
+				}
+				if top == n {
+					break
+				}
+			}
+			if len(scc) > 0 {
+				sccs = append(sccs, scc)
+			}
+		}
+	}
+	for _, n := range g.cg.Nodes {
+		if _, ok := index[n]; !ok {
+			visit(n)
+		}
+	}
+	return sccs
+}
+
 // populateEdges populates a slice of edges in the CallGraph.
 func (g *CallGraph) populateEdges(edge *callgraph.Edge) error {
 	e := &cgEdge{
@@ -203,6 +263,9 @@ func (info *Info) BuildCallGraph(algo string, tests bool) (*CallGraph, error) {
 		}
 		rtares := rta.Analyze(roots, true)
 		cg = rtares.CallGraph
+
+	default:
+		return nil, errors.Wrap(ErrUnknownAlgo, algo)
 	}
 
 	cg.DeleteSyntheticNodes()
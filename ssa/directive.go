@@ -0,0 +1,156 @@
+package ssa
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// DirectivePrefix is the prefix of directive comments, e.g.
+//
+//	//gospal:channel-cap 16
+const DirectivePrefix = "//gospal:"
+
+// Known directives.
+const (
+	// AssumeNoEffect in the doc comment of a function models the function as
+	// not communicating, so its body is not analysed.
+	AssumeNoEffect = "assume-noeffect"
+	// ChannelCap N on (or on the line before) a make(chan) sets the buffer
+	// size of the channel to N, e.g. if the size is not a constant.
+	ChannelCap = "channel-cap"
+	// Entrypoint in the doc comment of a function analyses the function as an
+	// entry point, in addition to main.main.
+	Entrypoint = "entrypoint"
+	// Protocol FILE in the doc comment of a test function TestProtocolXxx
+	// checks the session of the test against the protocol specification in
+	// FILE, relative to the directory of the source file.
+	Protocol = "protocol"
+	// Ignore CODES on (or on the line before) a statement suppresses the
+	// diagnostics at the statement of the rules CODES (comma separated codes
+	// or identifiers of rules), or of all rules if empty.
+	Ignore = "ignore"
+)
+
+// Directive is a directive comment in the source.
+type Directive struct {
+	Name string    // Name of the directive, e.g. channel-cap.
+	Arg  string    // Argument of the directive (or empty), e.g. 16.
+	Pos  token.Pos // Position of the comment.
+}
+
+// Directives are the directive comments of a program.
+type Directives struct {
+	All     []Directive                  // All directives, in source order.
+	Funcs   map[*types.Func][]Directive  // Directives of function declarations.
+	Unknown []Directive                  // Directives with unknown names.
+	lines   map[string]map[int]Directive // Directives by file and line.
+	fset    *token.FileSet
+}
+
+// ParseDirectives returns the directive comments of the source files of the
+// initial packages of lprog.
+func ParseDirectives(lprog *loader.Program) *Directives {
+	d := &Directives{
+		Funcs: make(map[*types.Func][]Directive),
+		lines: make(map[string]map[int]Directive),
+		fset:  lprog.Fset,
+	}
+	for _, pkg := range lprog.InitialPackages() {
+		for _, file := range pkg.Files {
+			for _, group := range file.Comments {
+				for _, c := range group.List {
+					if dir, ok := parseDirective(c); ok {
+						d.add(dir)
+					}
+				}
+			}
+			for _, decl := range file.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok || fd.Doc == nil {
+					continue
+				}
+				fn, ok := pkg.Defs[fd.Name].(*types.Func)
+				if !ok {
+					continue
+				}
+				for _, c := range fd.Doc.List {
+					if dir, ok := parseDirective(c); ok {
+						d.Funcs[fn] = append(d.Funcs[fn], dir)
+					}
+				}
+			}
+		}
+	}
+	return d
+}
+
+func parseDirective(c *ast.Comment) (Directive, bool) {
+	if !strings.HasPrefix(c.Text, DirectivePrefix) {
+		return Directive{}, false
+	}
+	fields := strings.Fields(c.Text[len(DirectivePrefix):])
+	if len(fields) == 0 {
+		return Directive{}, false
+	}
+	return Directive{Name: fields[0], Arg: strings.Join(fields[1:], " "), Pos: c.Pos()}, true
+}
+
+func (d *Directives) add(dir Directive) {
+	d.All = append(d.All, dir)
+	switch dir.Name {
+	case AssumeNoEffect, ChannelCap, Entrypoint, Protocol, Ignore:
+	default:
+		d.Unknown = append(d.Unknown, dir)
+	}
+	pos := d.fset.Position(dir.Pos)
+	if d.lines[pos.Filename] == nil {
+		d.lines[pos.Filename] = make(map[int]Directive)
+	}
+	d.lines[pos.Filename][pos.Line] = dir
+}
+
+// At returns the directive name on the line of pos or the line before, if
+// any.
+func (d *Directives) At(pos token.Pos, name string) (Directive, bool) {
+	if d == nil || !pos.IsValid() {
+		return Directive{}, false
+	}
+	p := d.fset.Position(pos)
+	for _, line := range []int{p.Line, p.Line - 1} {
+		if dir, ok := d.lines[p.Filename][line]; ok && dir.Name == name {
+			return dir, true
+		}
+	}
+	return Directive{}, false
+}
+
+// Ignored returns the argument of the ignore directive on the line of pos or
+// the line before, if any.
+func (d *Directives) Ignored(pos token.Position) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	for _, line := range []int{pos.Line, pos.Line - 1} {
+		if dir, ok := d.lines[pos.Filename][line]; ok && dir.Name == Ignore {
+			return dir.Arg, true
+		}
+	}
+	return "", false
+}
+
+// Func returns the directive name of function fn, if any.
+func (d *Directives) Func(fn *types.Func, name string) (Directive, bool) {
+	if d == nil {
+		return Directive{}, false
+	}
+	for _, dir := range d.Funcs[fn] {
+		if dir.Name == name {
+			return dir, true
+		}
+	}
+	return Directive{}, false
+}
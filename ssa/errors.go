@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrNoTestMainPkgs = errors.New("no main packages in tests")
 	ErrNoMainPkgs     = errors.New("no main packages")
+	ErrUnknownAlgo    = errors.New("unknown callgraph algorithm")
 )
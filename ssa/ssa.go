@@ -26,6 +26,8 @@ type Info struct {
 	Prog  *ssa.Program    // SSA IR for whole program.
 	LProg *loader.Program // Loaded program from go/loader.
 
+	Directives *Directives // Directive comments of the source.
+
 	BldLog io.Writer // Build log.
 	PtaLog io.Writer // Pointer analysis log.
 
@@ -3,12 +3,14 @@ package ssa_test
 import (
 	"bytes"
 	"fmt"
+	"go/types"
 	"log"
 	"strings"
 	"testing"
 
 	"github.com/nickng/gospal/ssa"
 	"github.com/nickng/gospal/ssa/build"
+	gossa "golang.org/x/tools/go/ssa"
 )
 
 // This tests basic build.
@@ -151,6 +153,45 @@ func TestCallGraphAllFunc(t *testing.T) {
 	}
 }
 
+// This tests grouping of mutually recursive functions in callgraph.
+func TestCallGraphSCCs(t *testing.T) {
+	s := `package main
+	func main() {
+		even(4)
+	}
+	func even(n int) bool {
+		if n == 0 {
+			return true
+		}
+		return odd(n - 1)
+	}
+	func odd(n int) bool {
+		if n == 0 {
+			return false
+		}
+		return even(n - 1)
+	}`
+
+	conf := build.FromReader(strings.NewReader(s))
+	info, err := conf.Build()
+	if err != nil {
+		t.Errorf("SSA build failed: %v", err)
+	}
+	graph, err := info.BuildCallGraph("static", false)
+	if err != nil {
+		t.Errorf("build callgraph failed: %v", err)
+	}
+	for _, scc := range graph.SCCs() {
+		for _, fn := range scc {
+			if fn.Name() == "even" || fn.Name() == "odd" {
+				if len(scc) != 2 {
+					t.Errorf("expecting main.{even, odd} in the same SCC, but got %v", scc)
+				}
+			}
+		}
+	}
+}
+
 func ExampleInfo_WriteTo() {
 	s := `package main
 	func main() { }`
@@ -201,3 +242,46 @@ func ExampleCallGraph_WriteGraphviz() {
 	//   "<root>" -> "main.main"
 	// }
 }
+
+// This tests parsing of directive comments.
+func TestDirectives(t *testing.T) {
+	s := `package main
+	//gospal:entrypoint
+	func f() {
+		//gospal:channel-cap 16
+		ch := make(chan int)
+		_ = ch
+	}
+	//gospal:unknown
+	func main() {}`
+
+	info, err := build.FromReader(strings.NewReader(s)).Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	if len(info.Directives.All) != 3 {
+		t.Errorf("Directives mismatch:\nExpect:\t%d\nGot:\t%d\n", 3, len(info.Directives.All))
+	}
+	if len(info.Directives.Unknown) != 1 {
+		t.Errorf("Unknown directives mismatch:\nExpect:\t%d\nGot:\t%d\n", 1, len(info.Directives.Unknown))
+	}
+	for _, pkg := range info.Prog.AllPackages() {
+		fn := pkg.Func("f")
+		if fn == nil {
+			continue
+		}
+		if _, ok := info.Directives.Func(fn.Object().(*types.Func), ssa.Entrypoint); !ok {
+			t.Errorf("entrypoint directive of f not found")
+		}
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				if mk, ok := instr.(*gossa.MakeChan); ok {
+					dir, ok := info.Directives.At(mk.Pos(), ssa.ChannelCap)
+					if !ok || dir.Arg != "16" {
+						t.Errorf("channel-cap mismatch:\nExpect:\t%s\nGot:\t%s\n", "16", dir.Arg)
+					}
+				}
+			}
+		}
+	}
+}
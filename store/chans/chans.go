@@ -3,7 +3,10 @@ package chans
 
 import (
 	"fmt"
+	"go/token"
+	"go/types"
 
+	"github.com/nickng/gospal/internal/intern"
 	"github.com/nickng/gospal/store"
 	"golang.org/x/tools/go/ssa"
 )
@@ -11,7 +14,13 @@ import (
 // Chan is a wrapper for a type chan SSA value.
 type Chan struct {
 	ssa.Value
-	size int64
+	size   int64
+	timer  bool // Channel is driven by a timer.
+	ticker bool // Timer channel fires repeatedly.
+
+	payloads []store.Value // Channels sent over the channel.
+	closed   bool          // Channel is closed in some path.
+	iter     int           // Iteration of an unrolled loop creating the channel.
 
 	ns store.Value // Namespace.
 }
@@ -24,10 +33,124 @@ func New(callsite store.Value, ch ssa.Value, size int64) *Chan {
 	}
 }
 
+// NewIteration returns the channel created by ch (as c) in iteration iter of
+// an unrolled loop, distinct from c.
+func NewIteration(c *Chan, iter int) *Chan {
+	return &Chan{
+		ns:    c.ns,
+		Value: c.Value,
+		size:  c.size,
+		iter:  iter,
+	}
+}
+
+// Iteration returns the iteration of the unrolled loop creating the channel
+// (0 if not unrolled).
+func (c *Chan) Iteration() int {
+	return c.iter
+}
+
+// NewTimer returns a timer-driven channel created by callsite.
+//
+// Timer channels are written to by the runtime (e.g. time.After), so they do
+// not have a sender in the program.
+func NewTimer(callsite store.Value, ch ssa.Value) *Chan {
+	return &Chan{
+		ns:    callsite,
+		Value: ch,
+		size:  1,
+		timer: true,
+	}
+}
+
+// NewTicker returns a timer-driven channel created by callsite which fires
+// repeatedly (e.g. time.Tick).
+func NewTicker(callsite store.Value, ch ssa.Value) *Chan {
+	c := NewTimer(callsite, ch)
+	c.ticker = true
+	return c
+}
+
 func (c *Chan) Size() int64 {
 	return c.size
 }
 
+// IsTimer returns true if the channel is driven by a timer.
+func (c *Chan) IsTimer() bool {
+	return c.timer
+}
+
+// IsTicker returns true if the channel is driven by a repeating timer.
+func (c *Chan) IsTicker() bool {
+	return c.ticker
+}
+
+// SetPayloads records the channels sent over the channel (as the value sent
+// or in the struct sent), so that a receiver can recover the identity of a
+// channel sent over another channel.
+func (c *Chan) SetPayloads(payloads []store.Value) {
+	c.payloads = payloads
+}
+
+// Payloads returns the channels sent over the channel.
+func (c *Chan) Payloads() []store.Value {
+	return c.payloads
+}
+
+// SetClosed marks the channel as closed.
+func (c *Chan) SetClosed() {
+	c.closed = true
+}
+
+// IsClosed returns true if the channel is closed in some path of the program.
+func (c *Chan) IsClosed() bool {
+	return c.closed
+}
+
 func (c *Chan) UniqName() string {
-	return fmt.Sprintf("%s.%s_chan%d", c.ns.UniqName(), c.Value.Name(), c.size)
+	if c.iter > 0 {
+		return intern.Sprintf("%s.%s_chan%d_iter%d", c.ns.UniqName(), c.Value.Name(), c.size, c.iter)
+	}
+	return intern.Sprintf("%s.%s_chan%d", c.ns.UniqName(), c.Value.Name(), c.size)
+}
+
+// Payload is a store.Key for the i-th channel sent over a channel Chan.
+//
+// Payload is used for naming the channels sent over a channel, when the
+// channel is passed across scope (e.g. as a function parameter).
+type Payload struct {
+	Chan  store.Key // Key of the channel in current scope.
+	Index int       // Index of the channel in Chan.Payloads.
+	T     types.Type
+}
+
+// Name returns a synthetic name for the channel in the form of "chan_pindex".
+func (p Payload) Name() string {
+	return intern.Sprintf("%s_p%d", p.Chan.Name(), p.Index)
+}
+
+func (p Payload) Pos() token.Pos {
+	return token.NoPos
+}
+
+func (p Payload) String() string {
+	return fmt.Sprintf("%s<-#%d", p.Chan.Name(), p.Index)
+}
+
+func (p Payload) Type() types.Type {
+	return p.T
+}
+
+// Dir returns the direction of channel k, where k is a channel or a pointer to
+// a channel. The direction of a bidirectional channel (or a non-channel) is
+// types.SendRecv.
+func Dir(k store.Key) types.ChanDir {
+	t := k.Type().Underlying()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem().Underlying()
+	}
+	if ch, ok := t.(*types.Chan); ok {
+		return ch.Dir()
+	}
+	return types.SendRecv
 }
@@ -0,0 +1,37 @@
+package chans
+
+import (
+	"go/constant"
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+type callsite struct{}
+
+func (callsite) UniqName() string { return "main.main0" }
+
+func TestTimer(t *testing.T) {
+	ch := ssa.NewConst(constant.MakeInt64(0), types.Typ[types.Int])
+	for _, test := range []struct {
+		name   string
+		ch     *Chan
+		timer  bool
+		ticker bool
+	}{
+		{"chan", New(callsite{}, ch, 0), false, false},
+		{"timer", NewTimer(callsite{}, ch), true, false},
+		{"ticker", NewTicker(callsite{}, ch), true, true},
+	} {
+		if got := test.ch.IsTimer(); got != test.timer {
+			t.Errorf("%s: IsTimer mismatch:\nExpect:\t%t\nGot:\t%t\n", test.name, test.timer, got)
+		}
+		if got := test.ch.IsTicker(); got != test.ticker {
+			t.Errorf("%s: IsTicker mismatch:\nExpect:\t%t\nGot:\t%t\n", test.name, test.ticker, got)
+		}
+		if test.timer && test.ch.Size() != 1 {
+			t.Errorf("%s: timer channel should be buffered (size 1) but got %d", test.name, test.ch.Size())
+		}
+	}
+}
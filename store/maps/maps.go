@@ -0,0 +1,74 @@
+// Package maps implements store.Value for map types.
+package maps
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+
+	"github.com/nickng/gospal/internal/intern"
+	"github.com/nickng/gospal/store"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Map is a wrapper for a type map SSA value.
+//
+// The contents of a Map are summarised: Map keeps track of the distinct values
+// stored in the map (as key or element), regardless of where they are stored.
+// Lookup of any key of the map returns the summary of the map.
+type Map struct {
+	ssa.Value
+
+	ns    store.Value   // Namespace.
+	Elems []store.Value // Distinct values stored in the map.
+}
+
+// New returns a new Map for m created in scope.
+func New(scope store.Value, m ssa.Value) *Map {
+	return &Map{
+		ns:    scope,
+		Value: m,
+	}
+}
+
+// Add adds the value v to the map, and returns true if v was not in the map.
+func (m *Map) Add(v store.Value) bool {
+	for _, elem := range m.Elems {
+		if elem == v {
+			return false
+		}
+	}
+	m.Elems = append(m.Elems, v)
+	return true
+}
+
+func (m *Map) UniqName() string {
+	return intern.Sprintf("%s.%s_map%d", m.ns.UniqName(), m.Value.Name(), len(m.Elems))
+}
+
+// Elem is a store.Key for the i-th value stored in a map Map.
+//
+// Elem is used for naming the values in a map, when the map is passed across
+// scope (e.g. as a function parameter).
+type Elem struct {
+	Map   store.Key // Key of the map in current scope.
+	Index int       // Index of the value in Map.Elems.
+	T     types.Type
+}
+
+// Name returns a synthetic name for the value in the form of "map_eindex".
+func (e Elem) Name() string {
+	return intern.Sprintf("%s_e%d", e.Map.Name(), e.Index)
+}
+
+func (e Elem) Pos() token.Pos {
+	return token.NoPos
+}
+
+func (e Elem) String() string {
+	return fmt.Sprintf("%s[#%d]", e.Map.Name(), e.Index)
+}
+
+func (e Elem) Type() types.Type {
+	return e.T
+}
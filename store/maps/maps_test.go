@@ -0,0 +1,29 @@
+package maps
+
+import (
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+type val string
+
+func (v val) UniqName() string { return string(v) }
+
+type empty struct{}
+
+func (empty) UniqName() string { return "_" }
+
+func TestMapAdd(t *testing.T) {
+	m := New(empty{}, ssa.NewConst(nil, types.NewMap(types.Typ[types.String], types.Typ[types.Int])))
+	for _, v := range []val{"a", "b", "a"} {
+		m.Add(v)
+	}
+	if expect, got := 2, len(m.Elems); expect != got {
+		t.Errorf("Map should have %d distinct values but got %d", expect, got)
+	}
+	if m.Add(val("b")) {
+		t.Errorf("Map should already have value b")
+	}
+}
@@ -51,6 +51,8 @@ func (v poolKey) UniqName() string {
 }
 
 func (p *Pool) Get(v Value) (ssa.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if obj, ok := p.pool[v]; ok {
 		return obj, nil
 	}
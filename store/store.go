@@ -10,7 +10,9 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"sync"
 
+	"github.com/nickng/gospal/metrics"
 	"golang.org/x/tools/go/ssa"
 )
 
@@ -71,6 +73,7 @@ func Extend(s *Store) *Store {
 // Get retrieves the Value in storage give Key k, if k is not found returns a
 // MockValue.
 func (s *Store) Get(k Key) Value {
+	metrics.StoreGets.Inc()
 	if v, ok := s.names[k]; ok {
 		s.logger.Printf("Get: %s ↦ %v\t%s", k.Name(), v.UniqName(), k.Type())
 		return v
@@ -80,6 +83,7 @@ func (s *Store) Get(k Key) Value {
 		return getConst(c)
 	}
 	s.logger.Printf("Get: %s ↦ (not found)\t%s", k.Name(), k.Type())
+	metrics.StoreMisses.Inc()
 	return MockValue{SrcPos: k.Pos(), Description: "Undefined"}
 }
 
@@ -150,14 +154,19 @@ func (c Const) UniqName() string {
 	return c.String()
 }
 
-var constants = make(map[*ssa.Const]Const)
+var constants = struct {
+	sync.Mutex
+	m map[*ssa.Const]Const
+}{m: make(map[*ssa.Const]Const)}
 
 // getConst returns a constant where same values gets the same Const.
 func getConst(c *ssa.Const) Const {
-	if con, ok := constants[c]; ok {
+	constants.Lock()
+	defer constants.Unlock()
+	if con, ok := constants.m[c]; ok {
 		return con
 	}
 	con := Const{Const: *c}
-	constants[c] = con
+	constants.m[c] = con
 	return con
 }
@@ -7,6 +7,7 @@ import (
 	"go/types"
 	"log"
 
+	"github.com/nickng/gospal/internal/intern"
 	"github.com/nickng/gospal/store"
 	"golang.org/x/tools/go/ssa"
 )
@@ -69,7 +70,7 @@ type SField struct {
 // field in the form of "struct_fieldindex"
 func (f SField) Name() string {
 	if f.Key == nil {
-		return fmt.Sprintf("%s_%d", f.Struct.Name(), f.Index)
+		return intern.Sprintf("%s_%d", f.Struct.Name(), f.Index)
 	}
 	return f.Key.Name()
 }
@@ -149,7 +150,7 @@ func FromType(t *types.Struct) *Struct {
 }
 
 func (s *Struct) UniqName() string {
-	return fmt.Sprintf("%s.%s_struct%d", s.ns.UniqName(), s.Value.Name(), len(s.Fields))
+	return intern.Sprintf("%s.%s_struct%d", s.ns.UniqName(), s.Value.Name(), len(s.Fields))
 }
 
 // Expand of a Struct traverses (recursively) all its fields and return a slice
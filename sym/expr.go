@@ -0,0 +1,196 @@
+// Package sym provides a lightweight symbolic evaluator of branch conditions
+// over integers and booleans, to decide whether a branch is feasible given
+// the conditions of the dominating branches and the constant values known in
+// the calling context.
+//
+// Conditions are translated from SSA values to expressions (Expr), where
+// values which cannot be represented (e.g. results of calls) are opaque
+// variables. Satisfiability is checked by a Solver: the builtin solver
+// (Intervals) reasons about comparisons of a variable with constants, and
+// external SMT solvers speaking SMT-LIB 2 can be plugged in (see SMTLIB).
+package sym
+
+import (
+	"fmt"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Sort is the sort of an expression.
+type Sort int
+
+// Sorts of expressions.
+const (
+	Int Sort = iota
+	Bool
+)
+
+func (s Sort) String() string {
+	if s == Bool {
+		return "Bool"
+	}
+	return "Int"
+}
+
+// Expr is a symbolic expression. String returns the expression in SMT-LIB 2
+// syntax.
+type Expr interface {
+	Sort() Sort
+	String() string
+}
+
+// Var is an (opaque) variable.
+type Var struct {
+	Name string
+	S    Sort
+}
+
+func (v Var) Sort() Sort { return v.S }
+
+func (v Var) String() string { return "|" + strings.Replace(v.Name, "|", "_", -1) + "|" }
+
+// Const is a constant integer or boolean.
+type Const struct {
+	Value constant.Value
+}
+
+func (c Const) Sort() Sort {
+	if c.Value.Kind() == constant.Bool {
+		return Bool
+	}
+	return Int
+}
+
+func (c Const) String() string {
+	if c.Value.Kind() == constant.Bool {
+		return fmt.Sprint(constant.BoolVal(c.Value))
+	}
+	if constant.Sign(c.Value) < 0 {
+		return fmt.Sprintf("(- %s)", constant.UnaryOp(token.SUB, c.Value, 0).ExactString())
+	}
+	return c.Value.ExactString()
+}
+
+// Not is a negation.
+type Not struct {
+	X Expr
+}
+
+func (n Not) Sort() Sort { return Bool }
+
+func (n Not) String() string { return fmt.Sprintf("(not %s)", n.X) }
+
+// Binary is a binary operation, where Op is one of the arithmetic operators
+// (+, -, *) or comparisons.
+type Binary struct {
+	Op   token.Token
+	X, Y Expr
+}
+
+func (b Binary) Sort() Sort {
+	switch b.Op {
+	case token.ADD, token.SUB, token.MUL:
+		return Int
+	}
+	return Bool
+}
+
+func (b Binary) String() string {
+	switch b.Op {
+	case token.NEQ:
+		return fmt.Sprintf("(not (= %s %s))", b.X, b.Y)
+	case token.EQL:
+		return fmt.Sprintf("(= %s %s)", b.X, b.Y)
+	}
+	return fmt.Sprintf("(%s %s %s)", b.Op, b.X, b.Y)
+}
+
+// Negate returns the negation of e.
+func Negate(e Expr) Expr {
+	if n, ok := e.(Not); ok {
+		return n.X
+	}
+	return Not{X: e}
+}
+
+// Env is the environment of the translation of SSA values.
+type Env interface {
+	// Const returns the constant value of v (e.g. a parameter bound to a
+	// constant argument) if known.
+	Const(v ssa.Value) (constant.Value, bool)
+}
+
+// sortOf returns the sort of type t, or false if values of t are not
+// represented.
+func sortOf(t types.Type) (Sort, bool) {
+	b, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return Int, false
+	}
+	switch {
+	case b.Info()&types.IsBoolean != 0:
+		return Bool, true
+	case b.Info()&types.IsInteger != 0:
+		return Int, true
+	}
+	return Int, false
+}
+
+// FromValue translates v to an expression, or returns false if values of the
+// type of v are not represented.
+func FromValue(v ssa.Value, env Env) (Expr, bool) {
+	s, ok := sortOf(v.Type())
+	if !ok {
+		return nil, false
+	}
+	if c, ok := v.(*ssa.Const); ok && c.Value != nil {
+		return Const{Value: c.Value}, true
+	}
+	if env != nil {
+		if c, ok := env.Const(v); ok && c != nil {
+			return Const{Value: c}, true
+		}
+	}
+	opaque := Var{Name: name(v), S: s}
+	switch v := v.(type) {
+	case *ssa.UnOp:
+		switch v.Op {
+		case token.NOT:
+			if x, ok := FromValue(v.X, env); ok {
+				return Negate(x), true
+			}
+		case token.SUB:
+			if x, ok := FromValue(v.X, env); ok {
+				return Binary{Op: token.SUB, X: Const{Value: constant.MakeInt64(0)}, Y: x}, true
+			}
+		}
+	case *ssa.BinOp:
+		switch v.Op {
+		case token.ADD, token.SUB, token.MUL, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			x, okx := FromValue(v.X, env)
+			y, oky := FromValue(v.Y, env)
+			if okx && oky && x.Sort() == y.Sort() {
+				return Binary{Op: v.Op, X: x, Y: y}, true
+			}
+		}
+	case *ssa.Convert:
+		if _, ok := sortOf(v.X.Type()); ok {
+			return FromValue(v.X, env)
+		}
+	case *ssa.ChangeType:
+		return FromValue(v.X, env)
+	}
+	return opaque, true
+}
+
+// name returns a name of v unique in the program.
+func name(v ssa.Value) string {
+	if fn := v.Parent(); fn != nil {
+		return fn.String() + "." + v.Name()
+	}
+	return v.String()
+}
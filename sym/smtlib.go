@@ -0,0 +1,85 @@
+package sym
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// SMTLIB is a Solver which runs an external SMT solver reading SMT-LIB 2 from
+// its standard input, e.g. "z3 -in" or "cvc4 --lang smt2". Integers are
+// unbounded in the queries, i.e. overflows are not modelled.
+type SMTLIB struct {
+	Command []string // Command line of the solver.
+}
+
+// NewSMTLIB returns a Solver running the command line cmd (fields separated
+// by spaces).
+func NewSMTLIB(cmd string) *SMTLIB {
+	return &SMTLIB{Command: strings.Fields(cmd)}
+}
+
+// WriteQuery writes the satisfiability query of the conjunction of exprs in
+// SMT-LIB 2 to w.
+func WriteQuery(w io.Writer, exprs []Expr) error {
+	vars := make(map[string]Var)
+	for _, e := range exprs {
+		collectVars(e, vars)
+	}
+	var names []string
+	for n := range vars {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("(set-logic QF_NIA)\n")
+	for _, n := range names {
+		fmt.Fprintf(bufw, "(declare-const %s %s)\n", vars[n], vars[n].S)
+	}
+	for _, e := range exprs {
+		fmt.Fprintf(bufw, "(assert %s)\n", e)
+	}
+	bufw.WriteString("(check-sat)\n(exit)\n")
+	return bufw.Flush()
+}
+
+// collectVars adds the variables of e to vars.
+func collectVars(e Expr, vars map[string]Var) {
+	switch e := e.(type) {
+	case Var:
+		vars[e.Name] = e
+	case Not:
+		collectVars(e.X, vars)
+	case Binary:
+		collectVars(e.X, vars)
+		collectVars(e.Y, vars)
+	}
+}
+
+// Check runs the solver on the conjunction of exprs, and returns Unknown if
+// the solver fails.
+func (s *SMTLIB) Check(exprs []Expr) Result {
+	if len(s.Command) == 0 {
+		return Unknown
+	}
+	var in, out bytes.Buffer
+	if err := WriteQuery(&in, exprs); err != nil {
+		return Unknown
+	}
+	cmd := exec.Command(s.Command[0], s.Command[1:]...)
+	cmd.Stdin, cmd.Stdout = &in, &out
+	if err := cmd.Run(); err != nil && out.Len() == 0 {
+		return Unknown
+	}
+	switch strings.TrimSpace(strings.SplitN(out.String(), "\n", 2)[0]) {
+	case "sat":
+		return Sat
+	case "unsat":
+		return Unsat
+	}
+	return Unknown
+}
@@ -0,0 +1,256 @@
+package sym
+
+import (
+	"go/constant"
+	"go/token"
+	"math"
+)
+
+// Result is a result of a satisfiability check.
+type Result int
+
+// Results of satisfiability checks.
+const (
+	Unknown Result = iota
+	Sat
+	Unsat
+)
+
+func (r Result) String() string {
+	switch r {
+	case Sat:
+		return "sat"
+	case Unsat:
+		return "unsat"
+	}
+	return "unknown"
+}
+
+// Solver checks the satisfiability of a conjunction of boolean expressions.
+// Solvers may return Unknown for any query, but must not return Unsat for a
+// satisfiable query.
+type Solver interface {
+	Check(exprs []Expr) Result
+}
+
+// Decide returns the value of cond under the assumptions facts, or false as
+// second return value if cond may be true or false.
+func Decide(s Solver, facts []Expr, cond Expr) (val, ok bool) {
+	if c, ok := fold(cond); ok && c.Kind() == constant.Bool {
+		return constant.BoolVal(c), true
+	}
+	if s.Check(append(facts[:len(facts):len(facts)], cond)) == Unsat {
+		return false, true
+	}
+	if s.Check(append(facts[:len(facts):len(facts)], Negate(cond))) == Unsat {
+		return true, true
+	}
+	return false, false
+}
+
+// fold returns the constant value of e, or false if e is not constant.
+func fold(e Expr) (constant.Value, bool) {
+	switch e := e.(type) {
+	case Const:
+		return e.Value, true
+	case Not:
+		if x, ok := fold(e.X); ok && x.Kind() == constant.Bool {
+			return constant.MakeBool(!constant.BoolVal(x)), true
+		}
+	case Binary:
+		x, okx := fold(e.X)
+		y, oky := fold(e.Y)
+		if !okx || !oky {
+			return nil, false
+		}
+		switch e.Op {
+		case token.ADD, token.SUB, token.MUL:
+			return constant.BinaryOp(x, e.Op, y), true
+		default:
+			return constant.MakeBool(constant.Compare(x, e.Op, y)), true
+		}
+	}
+	return nil, false
+}
+
+// Intervals is the builtin solver, which folds constant expressions and
+// reasons about comparisons of a variable with a constant, i.e. a conjunction
+// is unsatisfiable if the values of a variable allowed by the comparisons are
+// empty. Other expressions are ignored.
+type Intervals struct{}
+
+// interval is a set of integers [lo, hi] without the integers in ne.
+type interval struct {
+	lo, hi int64
+	ne     map[int64]bool
+}
+
+func (i *interval) empty() bool {
+	if i.lo > i.hi {
+		return true
+	}
+	if i.hi-i.lo < int64(len(i.ne)) && i.hi-i.lo >= 0 {
+		for n := i.lo; n <= i.hi; n++ {
+			if !i.ne[n] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Check returns Unsat if the conjunction of exprs is unsatisfiable, or
+// Unknown otherwise.
+func (Intervals) Check(exprs []Expr) Result {
+	vars := make(map[string]*interval)
+	get := func(v Var) *interval {
+		if i, ok := vars[v.Name]; ok {
+			return i
+		}
+		i := &interval{lo: math.MinInt64, hi: math.MaxInt64, ne: make(map[int64]bool)}
+		vars[v.Name] = i
+		return i
+	}
+	for _, e := range exprs {
+		if c, ok := fold(e); ok {
+			if c.Kind() == constant.Bool && !constant.BoolVal(c) {
+				return Unsat
+			}
+			continue
+		}
+		neg := false
+		if n, ok := e.(Not); ok {
+			e, neg = n.X, true
+		}
+		switch e := e.(type) {
+		case Var: // Boolean variable.
+			i := get(e)
+			if neg {
+				i.ne[1] = true
+			} else {
+				i.ne[0] = true
+			}
+			if i.ne[0] && i.ne[1] || i.empty() {
+				return Unsat
+			}
+		case Binary:
+			v, c, op, ok := atom(e)
+			if !ok {
+				continue
+			}
+			if neg {
+				op = negOp(op)
+			}
+			i := get(v)
+			switch op {
+			case token.EQL:
+				if c > i.lo {
+					i.lo = c
+				}
+				if c < i.hi {
+					i.hi = c
+				}
+			case token.NEQ:
+				i.ne[c] = true
+			case token.LSS:
+				if c == math.MinInt64 {
+					return Unsat
+				}
+				if c-1 < i.hi {
+					i.hi = c - 1
+				}
+			case token.LEQ:
+				if c < i.hi {
+					i.hi = c
+				}
+			case token.GTR:
+				if c == math.MaxInt64 {
+					return Unsat
+				}
+				if c+1 > i.lo {
+					i.lo = c + 1
+				}
+			case token.GEQ:
+				if c > i.lo {
+					i.lo = c
+				}
+			}
+			if i.empty() {
+				return Unsat
+			}
+		}
+	}
+	return Unknown
+}
+
+// atom returns the variable, constant and comparison of e if e compares a
+// variable with a constant, normalised as v op c.
+func atom(e Binary) (v Var, c int64, op token.Token, ok bool) {
+	x, okx := e.X.(Var)
+	y, oky := fold(e.Y)
+	op = e.Op
+	if !okx || !oky {
+		// c op v
+		x, okx = e.Y.(Var)
+		y, oky = fold(e.X)
+		if !okx || !oky {
+			return Var{}, 0, op, false
+		}
+		op = swapOp(op)
+	}
+	if y.Kind() == constant.Bool {
+		// Boolean equality, e.g. b == true.
+		n := int64(0)
+		if constant.BoolVal(y) {
+			n = 1
+		}
+		if op != token.EQL && op != token.NEQ {
+			return Var{}, 0, op, false
+		}
+		return x, n, op, true
+	}
+	n, exact := constant.Int64Val(y)
+	if !exact {
+		return Var{}, 0, op, false
+	}
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return x, n, op, true
+	}
+	return Var{}, 0, op, false
+}
+
+// negOp returns the comparison of the negation of op.
+func negOp(op token.Token) token.Token {
+	switch op {
+	case token.EQL:
+		return token.NEQ
+	case token.NEQ:
+		return token.EQL
+	case token.LSS:
+		return token.GEQ
+	case token.LEQ:
+		return token.GTR
+	case token.GTR:
+		return token.LEQ
+	case token.GEQ:
+		return token.LSS
+	}
+	return op
+}
+
+// swapOp returns the comparison with operands swapped, i.e. c op v as v op' c.
+func swapOp(op token.Token) token.Token {
+	switch op {
+	case token.LSS:
+		return token.GTR
+	case token.LEQ:
+		return token.GEQ
+	case token.GTR:
+		return token.LSS
+	case token.GEQ:
+		return token.LEQ
+	}
+	return op
+}
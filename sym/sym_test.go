@@ -0,0 +1,51 @@
+package sym
+
+import (
+	"bytes"
+	"go/constant"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func intConst(n int64) Const { return Const{Value: constant.MakeInt64(n)} }
+
+// Tests deciding conditions implied (or contradicted) by facts.
+func TestDecide(t *testing.T) {
+	n := Var{Name: "n", S: Int}
+	b := Var{Name: "b", S: Bool}
+	tests := []struct {
+		facts []Expr
+		cond  Expr
+		val   bool
+		ok    bool
+	}{
+		{nil, Binary{Op: token.LSS, X: intConst(1), Y: intConst(2)}, true, true},
+		{nil, Binary{Op: token.EQL, X: n, Y: intConst(0)}, false, false},
+		{[]Expr{Negate(Binary{Op: token.EQL, X: n, Y: intConst(0)})}, Binary{Op: token.EQL, X: n, Y: intConst(0)}, false, true},
+		{[]Expr{Binary{Op: token.GTR, X: n, Y: intConst(10)}}, Binary{Op: token.LSS, X: n, Y: intConst(5)}, false, true},
+		{[]Expr{Binary{Op: token.GEQ, X: n, Y: intConst(1)}, Binary{Op: token.LEQ, X: n, Y: intConst(1)}}, Binary{Op: token.EQL, X: intConst(1), Y: n}, true, true},
+		{[]Expr{Binary{Op: token.GTR, X: n, Y: intConst(10)}}, Binary{Op: token.LSS, X: n, Y: intConst(20)}, false, false},
+		{[]Expr{Negate(b)}, b, false, true},
+	}
+	for i, test := range tests {
+		val, ok := Decide(Intervals{}, test.facts, test.cond)
+		if ok != test.ok || ok && val != test.val {
+			t.Errorf("Decide #%d %v mismatch:\nExpect:\t%v (%v)\nGot:\t%v (%v)\n", i, test.cond, test.val, test.ok, val, ok)
+		}
+	}
+}
+
+// Tests the SMT-LIB 2 query of expressions.
+func TestWriteQuery(t *testing.T) {
+	n := Var{Name: "main.f.n", S: Int}
+	var buf bytes.Buffer
+	if err := WriteQuery(&buf, []Expr{Binary{Op: token.NEQ, X: n, Y: intConst(-1)}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"(declare-const |main.f.n| Int)", "(assert (not (= |main.f.n| (- 1))))", "(check-sat)"} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("Query mismatch:\nExpect:\t%s\nGot:\t%s\n", expect, buf.String())
+		}
+	}
+}
@@ -0,0 +1,479 @@
+// Package taint implements a taint analysis framework.
+//
+// A taint analysis is specified by a Spec of sources, sinks and sanitizers,
+// which are functions identified by their full name, e.g. os.Getenv or
+// (*net/http.Request).FormValue:
+//
+//   - the results of a call to a source are tainted,
+//   - a call to a sink with a tainted argument is a Flow to report, and
+//   - the results of a call to a sanitizer are not tainted.
+//
+// Taint is propagated through the program from the entry functions, using the
+// call contexts (see callctx) to pass taints of arguments to parameters (and
+// bindings to captures of closures) of callees, and the store of each context
+// to track the taints of local variables. Results of a callee are tainted if
+// the callee returns a tainted value, and references (pointers, slices, maps
+// and channels) passed to a callee are tainted if the callee taints them.
+// Callees are summarised by the taints of their parameters, so a function is
+// analysed once per distinct combination of tainted parameters.
+//
+// The analysis is flow-insensitive within a function, and field-insensitive,
+// i.e. storing a tainted value in a field (or element) taints the whole
+// object. Results of calls to functions in the standard library and calls
+// which cannot be resolved statically are tainted if any of their arguments
+// are tainted.
+package taint
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"strings"
+
+	"github.com/nickng/gospal/callctx"
+	"github.com/nickng/gospal/diag"
+	"github.com/nickng/gospal/funcs"
+	gssa "github.com/nickng/gospal/ssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// DefaultMaxDepth is the default maximum depth of calls analysed.
+const DefaultMaxDepth = 32
+
+// Spec is a specification of a taint analysis.
+type Spec struct {
+	Sources    []string // Functions returning tainted values.
+	Sinks      []string // Functions which must not be called with tainted values.
+	Sanitizers []string // Functions returning untainted values.
+}
+
+// ParseSpec reads a Spec from r, with one declaration per line:
+//
+//	source os.Getenv
+//	sink (*database/sql.DB).Query
+//	sanitizer html.EscapeString
+//
+// Empty lines and lines starting with # are ignored.
+func ParseSpec(r io.Reader) (*Spec, error) {
+	var spec Spec
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expecting kind and function name but got %q", line, s.Text())
+		}
+		switch fields[0] {
+		case "source":
+			spec.Sources = append(spec.Sources, fields[1])
+		case "sink":
+			spec.Sinks = append(spec.Sinks, fields[1])
+		case "sanitizer":
+			spec.Sanitizers = append(spec.Sanitizers, fields[1])
+		default:
+			return nil, fmt.Errorf("line %d: unknown kind %q", line, fields[0])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Taint is a tainted value in the store, created by a call to a source.
+type Taint struct {
+	Source string    // Source function.
+	Pos    token.Pos // Position of the call to the source.
+}
+
+func (t *Taint) UniqName() string {
+	return fmt.Sprintf("taint(%s)@%d", t.Source, t.Pos)
+}
+
+// Flow is a flow of a tainted value from a source to a sink.
+type Flow struct {
+	Source    string         // Source function.
+	SourcePos token.Position // Position of the call to the source.
+	Sink      string         // Sink function.
+	SinkPos   token.Position // Position of the call to the sink.
+	Arg       int            // Tainted argument of the sink.
+	Calls     []string       // Functions called from the entry to the sink.
+}
+
+func (f Flow) String() string {
+	return fmt.Sprintf("%s: tainted argument #%d of %s\n\tsource %s at %s\n\tcalls %s",
+		f.SinkPos, f.Arg, f.Sink, f.Source, f.SourcePos, strings.Join(f.Calls, " → "))
+}
+
+// Diagnostic returns the flow as a diagnostic at the sink, with the source as
+// related location.
+func (f Flow) Diagnostic() diag.Diagnostic {
+	return diag.Diagnostic{
+		Rule:    diag.TaintFlow,
+		Message: fmt.Sprintf("tainted argument #%d of %s (from %s)", f.Arg, f.Sink, f.Source),
+		Pos:     f.SinkPos,
+		Related: []diag.Location{{Pos: f.SourcePos, Message: "tainted by " + f.Source}},
+	}
+}
+
+// result is the summary of a function analysed with some tainted parameters.
+type result struct {
+	rets   []*Taint // Taints of return values.
+	params []*Taint // Taints of parameters and captures on return.
+}
+
+// Analysis is a taint analysis of a program.
+type Analysis struct {
+	MaxDepth int // Maximum depth of calls analysed.
+
+	info       *gssa.Info
+	sources    map[string]bool
+	sinks      map[string]bool
+	sanitizers map[string]bool
+	taints     map[*ssa.CallCommon]*Taint // Taints of source calls.
+	globals    map[*ssa.Global]*Taint
+	summaries  map[string]*result
+	stack      []*ssa.Function
+	flows      []Flow
+	seen       map[string]bool
+}
+
+// New returns a taint analysis of the program in info specified by spec.
+func New(info *gssa.Info, spec *Spec) *Analysis {
+	set := func(names []string) map[string]bool {
+		m := make(map[string]bool)
+		for _, name := range names {
+			m[name] = true
+		}
+		return m
+	}
+	return &Analysis{
+		MaxDepth:   DefaultMaxDepth,
+		info:       info,
+		sources:    set(spec.Sources),
+		sinks:      set(spec.Sinks),
+		sanitizers: set(spec.Sanitizers),
+		taints:     make(map[*ssa.CallCommon]*Taint),
+		globals:    make(map[*ssa.Global]*Taint),
+		seen:       make(map[string]bool),
+	}
+}
+
+// Analyse returns the flows from sources to sinks in the main packages of the
+// program in info, as specified by spec.
+func Analyse(info *gssa.Info, spec *Spec) ([]Flow, error) {
+	mains, err := gssa.MainPkgs(info.Prog, false)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*ssa.Function
+	for _, main := range mains {
+		for _, name := range []string{"init", "main"} {
+			if fn := main.Func(name); fn != nil {
+				entries = append(entries, fn)
+			}
+		}
+	}
+	return New(info, spec).Run(entries...), nil
+}
+
+// Run analyses the entry functions (in order) and returns the flows found.
+// The entry functions should not have parameters, e.g. main.main.
+//
+// Since package variables are shared by all functions, the entry functions
+// are analysed until no more package variables are tainted.
+func (a *Analysis) Run(entries ...*ssa.Function) []Flow {
+	for n := -1; n != len(a.globals); {
+		n = len(a.globals)
+		a.summaries = make(map[string]*result)
+		for _, fn := range entries {
+			call := funcs.MakeCall(funcs.MakeDefinition(fn), nil, nil)
+			a.analyseFunc(call, callctx.Switch(callctx.Toplevel(), funcs.Instantiate(call)))
+		}
+	}
+	return a.flows
+}
+
+// tainted returns the taint of k in ctx, or nil if k is not tainted.
+func (a *Analysis) tainted(ctx callctx.Context, k ssa.Value) *Taint {
+	if k == nil {
+		return nil
+	}
+	if g, ok := k.(*ssa.Global); ok {
+		return a.globals[g]
+	}
+	t, _ := ctx.Get(k).(*Taint)
+	return t
+}
+
+// taint marks k as tainted by t in ctx, and returns true if k was not tainted.
+func (a *Analysis) taint(ctx callctx.Context, k ssa.Value, t *Taint) bool {
+	if k == nil || t == nil || a.tainted(ctx, k) != nil {
+		return false
+	}
+	if g, ok := k.(*ssa.Global); ok {
+		a.globals[g] = t
+		return true
+	}
+	ctx.Put(k, t)
+	return true
+}
+
+// taintObj marks k, and the object k is derived from (by loads and addresses
+// of fields or elements), as tainted by t in ctx, and returns true if any of
+// them was not tainted.
+func (a *Analysis) taintObj(ctx callctx.Context, k ssa.Value, t *Taint) bool {
+	changed := false
+	for k != nil && t != nil {
+		if a.taint(ctx, k, t) {
+			changed = true
+		}
+		switch x := k.(type) {
+		case *ssa.FieldAddr:
+			k = x.X
+		case *ssa.IndexAddr:
+			k = x.X
+		case *ssa.UnOp:
+			if x.Op != token.MUL {
+				return changed
+			}
+			k = x.X
+		default:
+			return changed
+		}
+	}
+	return changed
+}
+
+// analyseFunc analyses the function of call in ctx (of the callee), and
+// returns the summary of the function.
+func (a *Analysis) analyseFunc(call *funcs.Call, ctx callctx.Context) *result {
+	def := call.Definition()
+	fn := def.Function
+	res := &result{
+		rets:   make([]*Taint, def.NReturn),
+		params: make([]*Taint, def.NParam+def.NFreeVar),
+	}
+	if len(a.stack) >= a.MaxDepth {
+		return res
+	}
+	a.stack = append(a.stack, fn)
+	defer func() { a.stack = a.stack[:len(a.stack)-1] }()
+	for changed := true; changed; {
+		changed = false
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				if a.visit(ctx, instr, res) {
+					changed = true
+				}
+			}
+		}
+	}
+	for i := range res.params {
+		if k, ok := def.Parameters[i].(ssa.Value); ok {
+			res.params[i] = a.tainted(ctx, k)
+		}
+	}
+	return res
+}
+
+// visit propagates taints through instr, and returns true if a new value is
+// tainted.
+func (a *Analysis) visit(ctx callctx.Context, instr ssa.Instruction, res *result) bool {
+	switch instr := instr.(type) {
+	case *ssa.Call:
+		return a.call(ctx, instr.Common(), instr)
+	case *ssa.Go:
+		return a.call(ctx, instr.Common(), nil)
+	case *ssa.Defer:
+		return a.call(ctx, instr.Common(), nil)
+	case *ssa.MakeClosure:
+		if _, ok := ctx.Get(instr).(*funcs.Definition); !ok {
+			ctx.Put(instr, funcs.MakeClosureDefinition(instr.Fn.(*ssa.Function), instr.Bindings))
+		}
+		return false
+	case *ssa.Store:
+		return a.taintObj(ctx, instr.Addr, a.tainted(ctx, instr.Val))
+	case *ssa.MapUpdate:
+		t := a.tainted(ctx, instr.Key)
+		if t == nil {
+			t = a.tainted(ctx, instr.Value)
+		}
+		return a.taintObj(ctx, instr.Map, t)
+	case *ssa.Send:
+		return a.taintObj(ctx, instr.Chan, a.tainted(ctx, instr.X))
+	case *ssa.Select:
+		changed := false
+		for _, st := range instr.States {
+			if st.Dir == types.SendOnly && a.taintObj(ctx, st.Chan, a.tainted(ctx, st.Send)) {
+				changed = true
+			}
+			if st.Dir == types.RecvOnly && a.taint(ctx, instr, a.tainted(ctx, st.Chan)) {
+				changed = true
+			}
+		}
+		return changed
+	case *ssa.Return:
+		changed := false
+		for i, r := range instr.Results {
+			if t := a.tainted(ctx, r); t != nil && i < len(res.rets) && res.rets[i] == nil {
+				res.rets[i] = t
+				changed = true
+			}
+		}
+		return changed
+	case ssa.Value:
+		// Results of other instructions are tainted by their operands, e.g.
+		// loads from a tainted address or arithmetic of tainted values.
+		for _, op := range instr.(ssa.Instruction).Operands(nil) {
+			if op != nil {
+				if t := a.tainted(ctx, *op); t != nil {
+					return a.taint(ctx, instr, t)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// call propagates taints through the call c (with result ret), and returns
+// true if a new value is tainted.
+func (a *Analysis) call(ctx callctx.Context, c *ssa.CallCommon, ret ssa.Value) bool {
+	var def *funcs.Definition
+	switch fv := c.Value.(type) {
+	case *ssa.MakeClosure:
+		def = funcs.MakeClosureDefinition(fv.Fn.(*ssa.Function), fv.Bindings)
+	default:
+		if fn := c.StaticCallee(); fn != nil {
+			def = funcs.MakeDefinition(fn)
+		} else if !c.IsInvoke() {
+			def, _ = ctx.Get(c.Value).(*funcs.Definition)
+		}
+	}
+	args := c.Args
+	if c.IsInvoke() {
+		args = append([]ssa.Value{c.Value}, c.Args...)
+	}
+	var argTaint *Taint
+	for _, arg := range args {
+		if argTaint = a.tainted(ctx, arg); argTaint != nil {
+			break
+		}
+	}
+	if def == nil {
+		return a.taint(ctx, ret, argTaint)
+	}
+	fn := def.Function
+	name := fn.String()
+	if a.sinks[name] {
+		for i, arg := range args {
+			if t := a.tainted(ctx, arg); t != nil {
+				a.report(t, fn, c, i)
+			}
+		}
+	}
+	if a.sources[name] {
+		t, ok := a.taints[c]
+		if !ok {
+			t = &Taint{Source: name, Pos: c.Pos()}
+			a.taints[c] = t
+		}
+		return a.taint(ctx, ret, t)
+	}
+	if a.sanitizers[name] {
+		return false
+	}
+	if len(fn.Blocks) == 0 || isStd(fn) {
+		return a.taint(ctx, ret, argTaint)
+	}
+	call := funcs.MakeCall(def, c, ret)
+	if call == nil {
+		return a.taint(ctx, ret, argTaint)
+	}
+	res := a.summary(ctx, call)
+	changed := false
+	for i, t := range res.rets {
+		if k, ok := call.Return(i).(ssa.Value); ok && a.taint(ctx, k, t) {
+			changed = true
+		}
+	}
+	for i, t := range res.params {
+		if k, ok := call.Parameters[i].(ssa.Value); ok && isRef(k.Type()) && a.taint(ctx, k, t) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// summary returns the summary of the function of call in ctx (of the caller).
+func (a *Analysis) summary(ctx callctx.Context, call *funcs.Call) *result {
+	var key strings.Builder
+	key.WriteString(call.Function().String())
+	for i := 0; i < call.NParam()+call.NBind(); i++ {
+		key.WriteRune('|')
+		if k, ok := call.Parameters[i].(ssa.Value); ok {
+			if t := a.tainted(ctx, k); t != nil {
+				key.WriteString(t.UniqName())
+			}
+		}
+	}
+	if res, ok := a.summaries[key.String()]; ok {
+		return res
+	}
+	// Placeholder for recursive calls.
+	a.summaries[key.String()] = &result{
+		rets:   make([]*Taint, call.NReturn()),
+		params: make([]*Taint, call.NParam()+call.NBind()),
+	}
+	res := a.analyseFunc(call, callctx.Switch(ctx, funcs.Instantiate(call)))
+	a.summaries[key.String()] = res
+	return res
+}
+
+// report records a flow of t to argument i of sink fn called by c.
+func (a *Analysis) report(t *Taint, fn *ssa.Function, c *ssa.CallCommon, i int) {
+	fset := a.info.FSet
+	id := fmt.Sprintf("%d|%d|%d", t.Pos, c.Pos(), i)
+	if a.seen[id] {
+		return
+	}
+	a.seen[id] = true
+	var calls []string
+	for _, caller := range a.stack {
+		calls = append(calls, caller.String())
+	}
+	a.flows = append(a.flows, Flow{
+		Source:    t.Source,
+		SourcePos: fset.Position(t.Pos),
+		Sink:      fn.String(),
+		SinkPos:   fset.Position(c.Pos()),
+		Arg:       i,
+		Calls:     append(calls, fn.String()),
+	})
+}
+
+// isRef returns true if values of type t are references, i.e. a callee can
+// taint the object referred to.
+func isRef(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan:
+		return true
+	}
+	return false
+}
+
+// isStd returns true if fn is in the standard library.
+func isStd(fn *ssa.Function) bool {
+	if fn.Pkg == nil {
+		return false
+	}
+	path := fn.Pkg.Pkg.Path()
+	if path == "main" || path == "command-line-arguments" {
+		return false
+	}
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
@@ -0,0 +1,58 @@
+package taint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests parsing of taint specification.
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec(strings.NewReader(`# Comment
+source os.Getenv
+
+sink main.exec
+sanitizer html.EscapeString
+`))
+	if err != nil {
+		t.Fatalf("cannot parse spec: %v", err)
+	}
+	if len(spec.Sources) != 1 || len(spec.Sinks) != 1 || len(spec.Sanitizers) != 1 {
+		t.Errorf("Wrong spec: %+v", spec)
+	}
+	if _, err := ParseSpec(strings.NewReader("origin os.Getenv")); err == nil {
+		t.Errorf("Expecting error for unknown kind")
+	}
+}
+
+// Tests flows through calls, fields and channels.
+func TestFlow(t *testing.T) {
+	info, err := build.FromFiles("testdata/flow.go").Default().Build()
+	if err != nil {
+		t.Fatalf("SSA build failed: %v", err)
+	}
+	spec := &Spec{
+		Sources:    []string{"os.Getenv"},
+		Sinks:      []string{"main.exec"},
+		Sanitizers: []string{"html.EscapeString"},
+	}
+	flows, err := Analyse(info, spec)
+	if err != nil {
+		t.Fatalf("taint analysis failed: %v", err)
+	}
+	lines := make(map[int]bool)
+	for _, f := range flows {
+		lines[f.SinkPos.Line] = true
+	}
+	for _, line := range []int{23, 34} {
+		if !lines[line] {
+			t.Errorf("Expecting flow to sink at line %d: %v", line, flows)
+		}
+	}
+	for _, line := range []int{24, 36} {
+		if lines[line] {
+			t.Errorf("Unexpected flow to sink at line %d", line)
+		}
+	}
+}
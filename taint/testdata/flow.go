@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+)
+
+type request struct {
+	query string
+}
+
+func exec(q string) {
+	fmt.Println(q)
+}
+
+func build(name string) string {
+	return "SELECT * FROM t WHERE name = '" + name + "'"
+}
+
+func handle(r *request) {
+	exec(build(r.query)) // Tainted.
+	exec(build(html.EscapeString(r.query)))
+}
+
+func main() {
+	r := &request{}
+	r.query = strings.TrimSpace(os.Getenv("QUERY"))
+	ch := make(chan string, 1)
+	go func() {
+		ch <- os.Getenv("USER")
+	}()
+	exec(<-ch) // Tainted.
+	handle(r)
+	exec("SELECT 1")
+}
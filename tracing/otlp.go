@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceName is the name of the service of the exported spans (the resource
+// attribute service.name), or the environment variable OTEL_SERVICE_NAME if
+// set.
+var ServiceName = "gospal"
+
+// ScopeName is the name of the instrumentation scope of the exported spans.
+const ScopeName = "github.com/nickng/gospal"
+
+// JSON encoding of OTLP (ExportTraceServiceRequest), where IDs are in
+// hexadecimal and 64-bit integers are strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string     `json:"traceId"`
+		SpanID       string     `json:"spanId"`
+		ParentSpanID string     `json:"parentSpanId,omitempty"`
+		Name         string     `json:"name"`
+		Kind         int        `json:"kind"` // SPAN_KIND_INTERNAL.
+		Start        string     `json:"startTimeUnixNano"`
+		End          string     `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr `json:"attributes,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		String *string `json:"stringValue,omitempty"`
+		Int    *string `json:"intValue,omitempty"`
+		Bool   *bool   `json:"boolValue,omitempty"`
+	}
+)
+
+func makeAttr(a Attr) otlpAttr {
+	var v otlpValue
+	switch x := a.Value.(type) {
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		v.Int = &s
+	case bool:
+		v.Bool = &x
+	default:
+		s := fmt.Sprint(x)
+		v.String = &s
+	}
+	return otlpAttr{Key: a.Key, Value: v}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// MarshalOTLP returns the OTLP/JSON export request of spans.
+func MarshalOTLP(spans []*Span) ([]byte, error) {
+	service := ServiceName
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		service = name
+	}
+	scope := otlpScopeSpans{Scope: otlpScope{Name: ScopeName}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID: hex.EncodeToString(s.TraceID[:]),
+			SpanID:  hex.EncodeToString(s.SpanID[:]),
+			Name:    s.Name,
+			Kind:    1,
+			Start:   unixNano(s.StartTime),
+			End:     unixNano(s.EndTime),
+		}
+		if s.ParentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		for _, a := range s.Attrs() {
+			span.Attributes = append(span.Attributes, makeAttr(a))
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	return json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttr{makeAttr(String("service.name", service))}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+}
+
+// FileExporter writes the export requests to W, one per line.
+type FileExporter struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+// Export writes the export request of spans.
+func (e *FileExporter) Export(spans []*Span) error {
+	b, err := MarshalOTLP(spans)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.W.Write(append(b, '\n'))
+	return err
+}
+
+// HTTPExporter posts the export requests to an OTLP/HTTP endpoint.
+type HTTPExporter struct {
+	URL    string            // URL of traces, e.g. http://localhost:4318/v1/traces.
+	Header map[string]string // Additional headers, e.g. authorisation.
+	Client *http.Client
+}
+
+// NewHTTPExporter returns an exporter to the collector at endpoint, i.e. the
+// base URL of the OTLP/HTTP receiver (e.g. http://localhost:4318), with the
+// headers of the environment variable OTEL_EXPORTER_OTLP_HEADERS (comma
+// separated key=value pairs) if set.
+func NewHTTPExporter(endpoint string) *HTTPExporter {
+	e := &HTTPExporter{
+		URL:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		Header: make(map[string]string),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if idx := strings.Index(kv, "="); idx > 0 {
+			e.Header[strings.TrimSpace(kv[:idx])] = strings.TrimSpace(kv[idx+1:])
+		}
+	}
+	return e
+}
+
+// Export posts the export request of spans.
+func (e *HTTPExporter) Export(spans []*Span) error {
+	b, err := MarshalOTLP(spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Header {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("export to %s: %s", e.URL, resp.Status)
+	}
+	return nil
+}
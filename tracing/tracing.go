@@ -0,0 +1,185 @@
+// Package tracing records spans of the phases of the analyses (e.g. building
+// each package, inferring each function, checking the inferred program), and
+// exports them in the OpenTelemetry protocol (OTLP), for diagnosing where time
+// is spent with an existing tracing backend.
+//
+// Tracing is process-wide and disabled by default, where starting a span
+// returns nil and the methods of a nil span do nothing, so instrumented code
+// need not check whether tracing is enabled, e.g.
+//
+//	span := tracing.Start(nil, "build", tracing.Int("packages", n))
+//	defer span.End()
+//
+// Spans are exported in batches in the JSON encoding of OTLP, to an OTLP/HTTP
+// endpoint of a collector (see HTTPExporter), or to a file, one request per
+// line (see FileExporter), e.g. for the otlpjsonfile receiver of the
+// OpenTelemetry collector.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Attr is an attribute of a span, with a string, int64 or bool value.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) Attr { return Attr{Key: key, Value: value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attr { return Attr{Key: key, Value: int64(value)} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attr { return Attr{Key: key, Value: value} }
+
+// Span is a timed operation of a trace, safe for concurrent use.
+type Span struct {
+	TraceID   [16]byte
+	SpanID    [8]byte
+	ParentID  [8]byte // Zero if root.
+	Name      string
+	StartTime time.Time
+	EndTime   time.Time // Zero until ended.
+
+	mu    sync.Mutex
+	attrs []Attr
+}
+
+// Exporter exports ended spans.
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// BatchSize is the number of ended spans exported together.
+const BatchSize = 512
+
+var tracer struct {
+	sync.Mutex
+	exporter Exporter
+	root     *Span
+	pending  []*Span
+	err      error // First export error.
+}
+
+// Enable enables tracing, exporting spans with e.
+func Enable(e Exporter) {
+	tracer.Lock()
+	defer tracer.Unlock()
+	tracer.exporter = e
+}
+
+// Enabled returns true if tracing is enabled.
+func Enabled() bool {
+	tracer.Lock()
+	defer tracer.Unlock()
+	return tracer.exporter != nil
+}
+
+// StartRoot starts a new trace with root span name, which is the parent of the
+// spans started without parent afterwards.
+func StartRoot(name string, attrs ...Attr) *Span {
+	if !Enabled() {
+		return nil
+	}
+	s := newSpan(name, attrs)
+	rand.Read(s.TraceID[:])
+	tracer.Lock()
+	tracer.root = s
+	tracer.Unlock()
+	return s
+}
+
+// Start starts span name, child of parent, or of the root span (see StartRoot)
+// if parent is nil. It returns nil if tracing is disabled.
+func Start(parent *Span, name string, attrs ...Attr) *Span {
+	if !Enabled() {
+		return nil
+	}
+	if parent == nil {
+		tracer.Lock()
+		parent = tracer.root
+		tracer.Unlock()
+	}
+	s := newSpan(name, attrs)
+	if parent != nil {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	return s
+}
+
+func newSpan(name string, attrs []Attr) *Span {
+	s := &Span{Name: name, StartTime: time.Now(), attrs: attrs}
+	rand.Read(s.SpanID[:])
+	return s
+}
+
+// SetAttrs adds attributes to s, e.g. results of the operation.
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// Attrs returns the attributes of s.
+func (s *Span) Attrs() []Attr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Attr(nil), s.attrs...)
+}
+
+// End ends s, which is exported with the next batch.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.EndTime.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	tracer.Lock()
+	defer tracer.Unlock()
+	if s == tracer.root {
+		tracer.root = nil
+	}
+	tracer.pending = append(tracer.pending, s)
+	if len(tracer.pending) >= BatchSize {
+		exportLocked()
+	}
+}
+
+// Flush exports the ended spans not exported yet, and returns the first error
+// of the exports, if any.
+func Flush() error {
+	tracer.Lock()
+	defer tracer.Unlock()
+	exportLocked()
+	return tracer.err
+}
+
+func exportLocked() {
+	if tracer.exporter == nil || len(tracer.pending) == 0 {
+		return
+	}
+	if err := tracer.exporter.Export(tracer.pending); err != nil && tracer.err == nil {
+		tracer.err = err
+	}
+	tracer.pending = nil
+}
+
+// TraceIDString returns the trace ID of s in hexadecimal.
+func (s *Span) TraceIDString() string { return hex.EncodeToString(s.TraceID[:]) }
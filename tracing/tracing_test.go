@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDisabled(t *testing.T) {
+	span := Start(nil, "build")
+	if span != nil {
+		t.Fatalf("Span started with tracing disabled: %v", span)
+	}
+	span.SetAttrs(Int("packages", 1))
+	span.End()
+}
+
+func TestExport(t *testing.T) {
+	var buf bytes.Buffer
+	Enable(&FileExporter{W: &buf})
+	defer Enable(nil)
+
+	root := StartRoot("migoinfer")
+	build := Start(nil, "build")
+	pkg := Start(build, "build package", String("package", "main"))
+	pkg.End()
+	build.SetAttrs(Int("packages", 1), Bool("tests", false))
+	build.End()
+	root.End()
+	if err := Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		t.Fatalf("Cannot decode export request: %v\n%s", err, buf.String())
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("Number of spans mismatch:\nExpect:\t%d\nGot:\t%d\n", 3, len(spans))
+	}
+	byName := make(map[string]otlpSpan)
+	for _, s := range spans {
+		if s.TraceID != root.TraceIDString() {
+			t.Errorf("Trace of %s mismatch:\nExpect:\t%s\nGot:\t%s\n", s.Name, root.TraceIDString(), s.TraceID)
+		}
+		byName[s.Name] = s
+	}
+	for child, parent := range map[string]string{"build package": "build", "build": "migoinfer"} {
+		if byName[child].ParentSpanID != byName[parent].SpanID {
+			t.Errorf("Parent of %s mismatch:\nExpect:\t%s\nGot:\t%s\n", child, byName[parent].SpanID, byName[child].ParentSpanID)
+		}
+	}
+	if byName["migoinfer"].ParentSpanID != "" {
+		t.Errorf("Root span has parent %s", byName["migoinfer"].ParentSpanID)
+	}
+	attrs := byName["build"].Attributes
+	if len(attrs) != 2 || attrs[0].Value.Int == nil || *attrs[0].Value.Int != "1" || attrs[1].Value.Bool == nil {
+		t.Errorf("Attributes mismatch:\nGot:\t%+v\n", attrs)
+	}
+}
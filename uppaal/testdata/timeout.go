@@ -0,0 +1,15 @@
+package main
+
+import "time"
+
+func main() {
+	ch := make(chan int)
+	go func() {
+		time.Sleep(time.Second)
+		ch <- 1
+	}()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+	}
+}
@@ -0,0 +1,302 @@
+// Package uppaal exports MiGo programs as networks of timed automata in the
+// XML format of the UPPAAL model checker, to verify timing-sensitive
+// properties, e.g. that the program terminates within a deadline.
+//
+// Each role of the session of the program (see session.Extract), i.e. each
+// goroutine, is a template whose locations are the states of its local type.
+// Channels are modelled by their capacity:
+//
+//   - unbuffered channels are urgent UPPAAL channels (c! and c?),
+//   - buffered channels are bounded counters (buf_c), and
+//   - closed channels are flags (closed_c), enabling receives once empty.
+//
+// One-shot timers (time.After, time.NewTimer) are clocks reset when the timer
+// is started, and a timeout of the timer is enabled once the clock reaches
+// the duration of the timer, and forced by then by an invariant (if the
+// duration is constant). Receives from repeating timers (time.Tick,
+// time.NewTicker) are internal actions in MiGo, and are not timed.
+//
+// Internal actions (branches) are urgent, i.e. take no time, so time only
+// passes while roles are blocked. The global clock now is never reset, and the
+// queries of the model check that the main role may and must terminate, and
+// terminates within the deadline (see Model).
+package uppaal
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nickng/gospal/session"
+	"github.com/nickng/migo"
+)
+
+// Model is a MiGo program with its timers.
+type Model struct {
+	Prog     *migo.Program
+	Timers   map[string]time.Duration // One-shot timers (0 if not constant), by MiGo channel name.
+	Unit     time.Duration            // Unit of time of the clocks (default 1ms).
+	Deadline time.Duration            // Deadline of the main role, if positive.
+}
+
+// edge is a transition of a template.
+type edge struct {
+	src, dst int
+	guard    string
+	sync     string
+	update   string
+}
+
+// template is the automaton of a role.
+type template struct {
+	name      string
+	nLocs     int
+	done      int            // Final location, or -1.
+	invariant map[int]string // Invariants of locations.
+	edges     []edge
+}
+
+// exporter builds the templates of a model.
+type exporter struct {
+	m      *Model
+	sizes  map[string]int64 // Buffer sizes, by channel.
+	chans  map[string]bool  // Channels used.
+	idents map[string]string
+	used   map[string]bool
+}
+
+// WriteXML writes the network of timed automata of m to w in UPPAAL XML.
+func (m *Model) WriteXML(w io.Writer) error {
+	x := &exporter{
+		m:      m,
+		sizes:  session.ChanSizes(m.Prog),
+		chans:  make(map[string]bool),
+		idents: make(map[string]string),
+		used:   map[string]bool{"now": true, "done": true},
+	}
+	sess := session.Extract(m.Prog)
+	var tmpls []*template
+	main := ""
+	for _, r := range sess.Roles {
+		a := session.NewAutomaton(r.Type)
+		t := &template{name: x.ident(r.Name), nLocs: a.States, done: a.Final, invariant: make(map[int]string)}
+		for _, tr := range a.Transitions {
+			if tr.Msg == nil {
+				t.edges = append(t.edges, edge{src: tr.Src, dst: tr.Dst})
+				continue
+			}
+			x.msg(t, tr.Msg, tr.Src, tr.Dst)
+		}
+		tmpls = append(tmpls, t)
+		if main == "" || r.Def == "main.main" && r.Spawner == nil {
+			main = t.name
+		}
+	}
+
+	bufw := bufio.NewWriter(w)
+	bufw.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	bufw.WriteString("<!DOCTYPE nta PUBLIC '-//Uppaal Team//DTD Flat System 1.1//EN' 'http://www.it.uu.se/research/group/darts/uppaal/flat-1_2.dtd'>\n")
+	bufw.WriteString("<nta>\n")
+	element(bufw, "declaration", x.declarations())
+	for _, t := range tmpls {
+		t.write(bufw)
+	}
+	names := make([]string, len(tmpls))
+	for i, t := range tmpls {
+		names[i] = t.name
+	}
+	if len(names) > 0 {
+		element(bufw, "system", fmt.Sprintf("system %s;", strings.Join(names, ", ")))
+	}
+	bufw.WriteString("<queries>\n")
+	if main != "" {
+		query(bufw, fmt.Sprintf("E<> %s.done", main), "The main role may terminate.")
+		query(bufw, fmt.Sprintf("A<> %s.done", main), "The main role terminates.")
+		if m.Deadline > 0 {
+			query(bufw, fmt.Sprintf("A[] (now > %d imply %s.done)", m.units(m.Deadline), main),
+				fmt.Sprintf("The main role terminates within %v.", m.Deadline))
+		}
+	}
+	bufw.WriteString("</queries>\n</nta>\n")
+	return bufw.Flush()
+}
+
+// units returns d in the unit of time of m, rounded up.
+func (m *Model) units(d time.Duration) int64 {
+	unit := m.Unit
+	if unit <= 0 {
+		unit = time.Millisecond
+	}
+	return int64((d + unit - 1) / unit)
+}
+
+// ident returns the identifier of name (e.g. a role or channel), unique in
+// the model.
+func (x *exporter) ident(name string) string {
+	if id, ok := x.idents[name]; ok {
+		return id
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if r < unicode.MaxASCII && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	base := b.String()
+	if base == "" || unicode.IsDigit(rune(base[0])) {
+		base = "_" + base
+	}
+	id := base
+	for n := 1; x.used[id]; n++ {
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+	x.used[id] = true
+	x.idents[name] = id
+	return id
+}
+
+// msg adds the transitions of message l from src to dst.
+func (x *exporter) msg(t *template, l *session.Msg, src, dst int) {
+	ch := x.ident(l.Chan)
+	if d, ok := x.m.Timers[l.Chan]; ok {
+		clock, armed := "x_"+ch, "armed_"+ch
+		x.chans[l.Chan] = true
+		if l.Send { // Timer started.
+			t.edges = append(t.edges, edge{src: src, dst: dst, update: fmt.Sprintf("%s = 0, %s = true", clock, armed)})
+			return
+		}
+		e := edge{src: src, dst: dst, guard: armed, update: armed + " = false"}
+		if d > 0 {
+			n := x.m.units(d)
+			e.guard = fmt.Sprintf("%s && %s >= %d", armed, clock, n)
+			inv := fmt.Sprintf("%s <= %d", clock, n)
+			if prev, ok := t.invariant[src]; ok && prev != inv {
+				inv = prev + " && " + inv
+			}
+			t.invariant[src] = inv
+		}
+		t.edges = append(t.edges, e)
+		return
+	}
+	x.chans[l.Chan] = true
+	size := x.sizes[l.Chan]
+	switch {
+	case l.Send && l.Label == "close":
+		t.edges = append(t.edges, edge{src: src, dst: dst, update: fmt.Sprintf("closed_%s = true", ch)})
+	case l.Send && size > 0:
+		t.edges = append(t.edges, edge{src: src, dst: dst, guard: fmt.Sprintf("buf_%s < %d", ch, size), update: fmt.Sprintf("buf_%s++", ch)})
+	case l.Send:
+		t.edges = append(t.edges, edge{src: src, dst: dst, sync: ch + "!"})
+	case size > 0:
+		t.edges = append(t.edges, edge{src: src, dst: dst, guard: fmt.Sprintf("buf_%s > 0", ch), update: fmt.Sprintf("buf_%s--", ch)})
+		t.edges = append(t.edges, edge{src: src, dst: dst, guard: fmt.Sprintf("closed_%s && buf_%s == 0", ch, ch)})
+	default:
+		t.edges = append(t.edges, edge{src: src, dst: dst, sync: ch + "?"})
+		t.edges = append(t.edges, edge{src: src, dst: dst, guard: "closed_" + ch})
+	}
+}
+
+// declarations returns the global declarations of the model.
+func (x *exporter) declarations() string {
+	var chans []string
+	for ch := range x.chans {
+		chans = append(chans, ch)
+	}
+	sort.Strings(chans)
+	var b strings.Builder
+	b.WriteString("// Global time, never reset.\nclock now;\n")
+	for _, name := range chans {
+		ch := x.ident(name)
+		fmt.Fprintf(&b, "// %s\n", name)
+		if _, ok := x.m.Timers[name]; ok {
+			fmt.Fprintf(&b, "clock x_%s;\nbool armed_%s;\n", ch, ch)
+			continue
+		}
+		if size := x.sizes[name]; size > 0 {
+			fmt.Fprintf(&b, "int[0,%d] buf_%s;\n", size, ch)
+		} else {
+			fmt.Fprintf(&b, "urgent chan %s;\n", ch)
+		}
+		fmt.Fprintf(&b, "bool closed_%s;\n", ch)
+	}
+	return b.String()
+}
+
+// urgent returns true if the transitions from loc are all internal and
+// unguarded, i.e. no time passes in loc.
+func (t *template) urgent(loc int) bool {
+	found := false
+	for _, e := range t.edges {
+		if e.src == loc {
+			if e.guard != "" || e.sync != "" {
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+func (t *template) write(w *bufio.Writer) {
+	w.WriteString("<template>\n")
+	element(w, "name", t.name)
+	for loc := 0; loc < t.nLocs; loc++ {
+		fmt.Fprintf(w, "<location id=\"%s_l%d\">", t.name, loc)
+		if loc == t.done {
+			element(w, "name", "done")
+		} else {
+			element(w, "name", fmt.Sprintf("l%d", loc))
+		}
+		if inv, ok := t.invariant[loc]; ok {
+			label(w, "invariant", inv)
+		}
+		if t.urgent(loc) {
+			w.WriteString("<urgent/>")
+		}
+		w.WriteString("</location>\n")
+	}
+	fmt.Fprintf(w, "<init ref=\"%s_l0\"/>\n", t.name)
+	for _, e := range t.edges {
+		fmt.Fprintf(w, "<transition><source ref=\"%s_l%d\"/><target ref=\"%s_l%d\"/>", t.name, e.src, t.name, e.dst)
+		if e.guard != "" {
+			label(w, "guard", e.guard)
+		}
+		if e.sync != "" {
+			label(w, "synchronisation", e.sync)
+		}
+		if e.update != "" {
+			label(w, "assignment", e.update)
+		}
+		w.WriteString("</transition>\n")
+	}
+	w.WriteString("</template>\n")
+}
+
+// element writes element name with text.
+func element(w *bufio.Writer, name, text string) {
+	fmt.Fprintf(w, "<%s>", name)
+	xml.EscapeText(w, []byte(text))
+	fmt.Fprintf(w, "</%s>\n", name)
+}
+
+// label writes a label of kind with text.
+func label(w *bufio.Writer, kind, text string) {
+	fmt.Fprintf(w, "<label kind=\"%s\">", kind)
+	xml.EscapeText(w, []byte(text))
+	w.WriteString("</label>")
+}
+
+// query writes a query with formula and comment.
+func query(w *bufio.Writer, formula, comment string) {
+	w.WriteString("<query>")
+	element(w, "formula", formula)
+	element(w, "comment", comment)
+	w.WriteString("</query>\n")
+}
@@ -0,0 +1,57 @@
+package uppaal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickng/gospal/migoinfer"
+	"github.com/nickng/gospal/ssa/build"
+)
+
+// Tests the automata of a program receiving from a goroutine with a timeout.
+func TestWriteXML(t *testing.T) {
+	info, err := build.FromFiles("testdata/timeout.go").Default().Build()
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	inferer := migoinfer.New(info, nil)
+	inferer.Analyse()
+	timers := make(map[string]time.Duration)
+	for ch, timer := range inferer.Timers() {
+		if !timer.Ticker {
+			timers[ch] = timer.Duration
+		}
+	}
+	if len(timers) != 1 {
+		t.Fatalf("Timers mismatch:\nExpect:\t%d\nGot:\t%v\n", 1, inferer.Timers())
+	}
+	m := &Model{Prog: inferer.Env.Prog, Timers: timers, Deadline: 3 * time.Second}
+	var buf bytes.Buffer
+	if err := m.WriteXML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	nta := buf.String()
+	for _, expect := range []string{
+		"urgent chan ",
+		"<name>main_main</name>",
+		" &gt;= 2000</label>",
+		"<label kind=\"invariant\">x_",
+		"<formula>A[] (now &gt; 3000 imply main_main.done)</formula>",
+	} {
+		if !strings.Contains(nta, expect) {
+			t.Errorf("Expecting %q in model:\n%s", expect, nta)
+		}
+	}
+	dec := xml.NewDecoder(&buf)
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Invalid XML: %v", err)
+		}
+	}
+}
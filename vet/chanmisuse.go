@@ -0,0 +1,235 @@
+package vet
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// ChanMisuse reports channels which may be closed twice, or sent to after
+// being closed.
+var ChanMisuse = &analysis.Analyzer{
+	Name:      "chanmisuse",
+	Doc:       "report channels which may be closed twice or sent to after being closed",
+	Requires:  []*analysis.Analyzer{buildssa.Analyzer},
+	Run:       runChanMisuse,
+	FactTypes: []analysis.Fact{new(closesFact)},
+}
+
+// closesFact is the fact that a function may close some of its channel
+// parameters (indices of Params of the function).
+type closesFact struct {
+	Params []int
+}
+
+func (*closesFact) AFact() {}
+
+func (f *closesFact) String() string {
+	return fmt.Sprintf("closes%v", f.Params)
+}
+
+// chanSite is a close of (or send on) a channel.
+type chanSite struct {
+	instr ssa.Instruction
+	ch    ssa.Value
+	pos   token.Pos
+}
+
+// misuse holds the state of the chanmisuse pass.
+type misuse struct {
+	pass   *analysis.Pass
+	closes map[*ssa.Function]map[int]bool // Channel parameters closed.
+}
+
+func runChanMisuse(pass *analysis.Pass) (interface{}, error) {
+	fns := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA).SrcFuncs
+	m := misuse{pass: pass, closes: make(map[*ssa.Function]map[int]bool)}
+	// Closed parameters of functions in the package (until fixpoint, as the
+	// functions may call each other).
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range fns {
+			for _, site := range m.closeSites(fn) {
+				for i, param := range fn.Params {
+					if chanBase(site.ch) == param && !m.closes[fn][i] {
+						if m.closes[fn] == nil {
+							m.closes[fn] = make(map[int]bool)
+						}
+						m.closes[fn][i] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	for fn, params := range m.closes {
+		if obj, ok := fn.Object().(*types.Func); ok && obj.Pkg() == pass.Pkg {
+			fact := new(closesFact)
+			for i := range params {
+				fact.Params = append(fact.Params, i)
+			}
+			sort.Ints(fact.Params)
+			pass.ExportObjectFact(obj, fact)
+		}
+	}
+	for _, fn := range fns {
+		m.check(fn)
+	}
+	return nil, nil
+}
+
+// closedParams returns the channel parameters closed by callee.
+func (m *misuse) closedParams(callee *ssa.Function) map[int]bool {
+	if callee.Pkg != nil && callee.Pkg.Pkg == m.pass.Pkg {
+		return m.closes[callee]
+	}
+	obj, ok := callee.Object().(*types.Func)
+	if !ok {
+		return nil
+	}
+	var fact closesFact
+	if !m.pass.ImportObjectFact(obj, &fact) {
+		return nil
+	}
+	params := make(map[int]bool)
+	for _, i := range fact.Params {
+		params[i] = true
+	}
+	return params
+}
+
+// closeSites returns the closes of channels in fn, directly or by calling a
+// function closing its parameter.
+func (m *misuse) closeSites(fn *ssa.Function) []chanSite {
+	var sites []chanSite
+	for _, blk := range fn.Blocks {
+		for _, instr := range blk.Instrs {
+			call, ok := instr.(ssa.CallInstruction)
+			if !ok {
+				continue
+			}
+			c := call.Common()
+			if b, ok := c.Value.(*ssa.Builtin); ok && b.Name() == "close" {
+				sites = append(sites, chanSite{instr: instr, ch: c.Args[0], pos: c.Pos()})
+				continue
+			}
+			if callee := c.StaticCallee(); callee != nil {
+				for i := range m.closedParams(callee) {
+					if i < len(c.Args) {
+						sites = append(sites, chanSite{instr: instr, ch: c.Args[i], pos: c.Pos()})
+					}
+				}
+			}
+		}
+	}
+	return sites
+}
+
+// sendSites returns the sends on channels in fn.
+func sendSites(fn *ssa.Function) []chanSite {
+	var sites []chanSite
+	for _, blk := range fn.Blocks {
+		for _, instr := range blk.Instrs {
+			switch instr := instr.(type) {
+			case *ssa.Send:
+				sites = append(sites, chanSite{instr: instr, ch: instr.Chan, pos: instr.Pos()})
+			case *ssa.Select:
+				for _, st := range instr.States {
+					if st.Dir == types.SendOnly {
+						sites = append(sites, chanSite{instr: instr, ch: st.Chan, pos: st.Pos})
+					}
+				}
+			}
+		}
+	}
+	return sites
+}
+
+// check reports the misuses of channels in fn.
+func (m *misuse) check(fn *ssa.Function) {
+	closes := m.closeSites(fn)
+	reported := make(map[ssa.Instruction]bool)
+	for _, cl := range closes {
+		after := reachable(cl.instr)
+		for _, other := range closes {
+			if reported[other.instr] || !after[other.instr] || chanBase(other.ch) != chanBase(cl.ch) {
+				continue
+			}
+			reported[other.instr] = true
+			if other.instr == cl.instr {
+				m.pass.Reportf(other.pos, "channel may be closed twice (closed in a loop)")
+			} else {
+				m.pass.Reportf(other.pos, "channel may be closed twice (closed at %v)", m.pass.Fset.Position(cl.pos))
+			}
+		}
+		for _, send := range sendSites(fn) {
+			if reported[send.instr] || !after[send.instr] || chanBase(send.ch) != chanBase(cl.ch) {
+				continue
+			}
+			reported[send.instr] = true
+			m.pass.Reportf(send.pos, "send on channel which may be closed (closed at %v)", m.pass.Fset.Position(cl.pos))
+		}
+	}
+}
+
+// chanBase returns the variable holding channel ch, so that a channel and the
+// loads of a variable assigned once are identified.
+func chanBase(ch ssa.Value) ssa.Value {
+	switch v := ch.(type) {
+	case *ssa.ChangeType:
+		return chanBase(v.X)
+	case *ssa.UnOp:
+		if v.Op != token.MUL {
+			return ch
+		}
+		switch x := v.X.(type) {
+		case *ssa.Alloc, *ssa.FreeVar:
+			stores := 0
+			for _, ref := range *x.Referrers() {
+				if st, ok := ref.(*ssa.Store); ok && st.Addr == x {
+					stores++
+				}
+			}
+			if stores <= 1 {
+				return x
+			}
+		case *ssa.Global:
+			return x
+		}
+	}
+	return ch
+}
+
+// reachable returns the instructions reachable from instr (in the same
+// function invocation), including instr itself if it is in a loop.
+func reachable(instr ssa.Instruction) map[ssa.Instruction]bool {
+	r := make(map[ssa.Instruction]bool)
+	blk := instr.Block()
+	after := false
+	for _, i := range blk.Instrs {
+		if after {
+			r[i] = true
+		}
+		after = after || i == instr
+	}
+	visited := make(map[*ssa.BasicBlock]bool)
+	queue := append([]*ssa.BasicBlock(nil), blk.Succs...)
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		if visited[b] {
+			continue
+		}
+		visited[b] = true
+		for _, i := range b.Instrs {
+			r[i] = true
+		}
+		queue = append(queue, b.Succs...)
+	}
+	return r
+}
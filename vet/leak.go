@@ -0,0 +1,75 @@
+package vet
+
+import (
+	"strings"
+
+	"github.com/nickng/gospal/migoinfer"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+)
+
+// Leak reports goroutines which may leak.
+var Leak = &analysis.Analyzer{
+	Name:     "goroutineleak",
+	Doc:      "report goroutines which may block forever on channel operations without a peer",
+	Requires: []*analysis.Analyzer{buildssa.Analyzer},
+	Run:      runLeak,
+}
+
+// Deadlock reports global and partial deadlocks.
+var Deadlock = &analysis.Analyzer{
+	Name:     "deadlock",
+	Doc:      "report deadlocks (and panics on channels) found by bounded exploration of the inferred MiGo types",
+	Requires: []*analysis.Analyzer{buildssa.Analyzer},
+	Run:      runDeadlock,
+}
+
+func runLeak(pass *analysis.Pass) (interface{}, error) {
+	inferer := inferMain(pass)
+	if inferer == nil {
+		return nil, nil
+	}
+	sites := spawnSites(pass)
+	for _, leak := range inferer.Leaks() {
+		if pos, ok := sites[leak.SpawnPos]; ok {
+			var noPeer string
+			if leak.NoPeer {
+				noPeer = " (no peer)"
+			}
+			pass.Reportf(pos, "goroutine %s may leak: blocked on %s %s%s",
+				leak.Goroutine, leak.Op, leak.Chan, noPeer)
+		}
+	}
+	return nil, nil
+}
+
+func runDeadlock(pass *analysis.Pass) (interface{}, error) {
+	inferer := inferMain(pass)
+	if inferer == nil {
+		return nil, nil
+	}
+	mainFn := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA).Pkg.Func("main")
+	sites := spawnSites(pass)
+	deadlocks, _ := inferer.Deadlocks(migoinfer.DefaultBounds())
+	for _, d := range deadlocks {
+		pos := mainFn.Pos()
+		var blocked []string
+		for _, b := range d.Blocked {
+			if p, ok := sites[b.SpawnPos]; ok && !d.Global {
+				pos = p
+			}
+			blocked = append(blocked, b.String())
+		}
+		if d.Panic != "" {
+			b := d.Blocked[0]
+			pass.Reportf(pos, "panic: %s: goroutine %s panics in %s on %s", d.Panic, b.Goroutine, b.Def, strings.Join(b.Ops, " | "))
+			continue
+		}
+		kind := "partial"
+		if d.Global {
+			kind = "global"
+		}
+		pass.Reportf(pos, "%s deadlock: %s", kind, strings.Join(blocked, "; "))
+	}
+	return nil, nil
+}
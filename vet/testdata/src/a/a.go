@@ -0,0 +1,29 @@
+package a
+
+import "b"
+
+func doubleClose(ch chan int) {
+	close(ch)
+	close(ch) // want "channel may be closed twice"
+}
+
+func sendAfterClose(ch chan int) {
+	close(ch)
+	ch <- 1 // want "send on channel which may be closed"
+}
+
+func closeInLoop(ch chan int) {
+	for i := 0; i < 2; i++ {
+		close(ch) // want "channel may be closed twice \\(closed in a loop\\)"
+	}
+}
+
+func closeAcrossPackages(done chan struct{}) {
+	b.Stop(done)
+	close(done) // want "channel may be closed twice"
+}
+
+func ok(ch chan int) {
+	ch <- 1
+	close(ch)
+}
@@ -0,0 +1,6 @@
+package b
+
+// Stop closes done.
+func Stop(done chan struct{}) {
+	close(done)
+}
@@ -0,0 +1,58 @@
+// Package vet provides the checks of gospal as Analyzers of
+// golang.org/x/tools/go/analysis, so they can run under go vet -vettool (see
+// cmd/gospal-vet) and in other drivers of the analysis framework.
+//
+// Analyzers work on one package at a time, using the SSA of the package built
+// by the buildssa pass, where functions of other packages have no body.
+//
+//   - ChanMisuse reports channels which may be closed twice or sent to after
+//     being closed. Functions closing their channel parameters are exported as
+//     facts, so closing a channel by calling a function in another package is
+//     also detected.
+//   - Leak reports goroutines which may leak, and Deadlock reports deadlocks
+//     of the MiGo types inferred from main packages. Functions of other
+//     packages are analysed as not communicating, so communication hidden in
+//     imported packages is missed.
+package vet
+
+import (
+	"go/token"
+
+	"github.com/nickng/gospal/migoinfer"
+	gssa "github.com/nickng/gospal/ssa"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Analyzers is the list of analyzers of gospal.
+var Analyzers = []*analysis.Analyzer{ChanMisuse, Leak, Deadlock}
+
+// inferMain returns the MiGo inferred from main.main of the package of pass,
+// or nil if the package is not a main package.
+func inferMain(pass *analysis.Pass) *migoinfer.Inferer {
+	pkg := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA).Pkg
+	if pkg.Pkg.Name() != "main" || pkg.Func("main") == nil {
+		return nil
+	}
+	inferer := migoinfer.New(&gssa.Info{FSet: pass.Fset, Prog: pkg.Prog}, nil)
+	inferer.Analyse()
+	return inferer
+}
+
+// spawnSites returns the positions of the go statements in the package of
+// pass, keyed by their string representation used by the inference.
+func spawnSites(pass *analysis.Pass) map[string]token.Pos {
+	sites := make(map[string]token.Pos)
+	for _, fn := range pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA).SrcFuncs {
+		for _, blk := range fn.Blocks {
+			for _, instr := range blk.Instrs {
+				if g, ok := instr.(*ssa.Go); ok {
+					sites[pass.Fset.Position(g.Common().Pos()).String()] = g.Pos()
+					sites[pass.Fset.Position(g.Pos()).String()] = g.Pos()
+				}
+			}
+		}
+	}
+	return sites
+}
@@ -0,0 +1,13 @@
+package vet
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// Tests reporting of channel misuse, including closes by functions of other
+// packages.
+func TestChanMisuse(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), ChanMisuse, "a")
+}